@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"path/filepath"
 	"strconv"
+	"sync"
 	"time"
 
 	"BRDPoSChain/BRCx/tradingstate"
@@ -15,6 +17,7 @@ import (
 	"BRDPoSChain/consensus"
 	"BRDPoSChain/core/state"
 	"BRDPoSChain/core/types"
+	"BRDPoSChain/event"
 	"BRDPoSChain/log"
 	"BRDPoSChain/p2p"
 	"BRDPoSChain/rpc"
@@ -29,11 +32,15 @@ const (
 	overflowIdx        // Indicator of message queue overflow
 	defaultCacheLimit  = 1024
 	MaximumTxMatchSize = 1000
+	// maximum number of stop orders triggered by one order, the others
+	// wait for the next trade of the pair
+	MaximumTriggeredStopOrders = 100
 )
 
 var (
 	ErrNonceTooHigh = errors.New("nonce too high")
 	ErrNonceTooLow  = errors.New("nonce too low")
+	ErrNotSDKNode   = errors.New("trades are only stored by SDK nodes")
 )
 
 type Config struct {
@@ -42,6 +49,9 @@ type Config struct {
 	DBName         string `toml:",omitempty"`
 	ConnectionUrl  string `toml:",omitempty"`
 	ReplicaSetName string `toml:",omitempty"`
+
+	// intervals of the OHLCV candles built from the trades, e.g. "1m", "1h", "1d"
+	CandleIntervals []string `toml:",omitempty"`
 }
 
 // DefaultConfig represents (shocker!) the default configuration.
@@ -52,7 +62,7 @@ var DefaultConfig = Config{
 type BRCX struct {
 	// Order related
 	db         BRCxDAO.BRCXDAO
-	mongodb    BRCxDAO.BRCXDAO
+	mongodb    BRCxDAO.BRCXDAO                  // SDK node database, mongodb or embedded
 	Triegc     *prque.Prque[int64, common.Hash] // Priority queue mapping block numbers to tries to gc
 	StateCache tradingstate.Database            // State database to reuse between imports (contains state cache)    *BRCx_state.TradingStateDB
 
@@ -62,6 +72,16 @@ type BRCX struct {
 	settings          syncmap.Map // holds configuration settings that can be dynamically changed
 	tokenDecimalCache *lru.Cache[common.Address, *big.Int]
 	orderCache        *lru.Cache[common.Hash, map[common.Hash]tradingstate.OrderHistoryItem]
+
+	// matching events for RPC subscriptions
+	tradesFeed      event.Feed
+	orderStatusFeed event.Feed
+	orderBookFeed   event.Feed
+	scope           event.SubscriptionScope
+
+	// OHLCV candles indexer
+	candleIntervals []uint64 // in seconds, sorted
+	candleLock      sync.Mutex
 }
 
 func (BRCx *BRCX) Protocols() []p2p.Protocol {
@@ -73,6 +93,7 @@ func (BRCx *BRCX) Start(server *p2p.Server) error {
 }
 
 func (BRCx *BRCX) Stop() error {
+	BRCx.scope.Close()
 	return nil
 }
 
@@ -92,6 +113,16 @@ func NewMongoDBEngine(cfg *Config) *BRCxDAO.MongoDatabase {
 	return mongoDB
 }
 
+// NewEmbeddedEngine opens the SDK node database embedded in the BRCx datadir,
+// it needs no external service unlike mongodb.
+func NewEmbeddedEngine(cfg *Config) *BRCxDAO.EmbeddedDatabase {
+	embeddedDB, err := BRCxDAO.NewEmbeddedDatabase(filepath.Join(cfg.DataDir, "sdk"), 0)
+	if err != nil {
+		log.Crit("Failed to init embedded engine", "err", err)
+	}
+	return embeddedDB
+}
+
 func New(cfg *Config) *BRCX {
 	BRCX := &BRCX{
 		orderNonce:        make(map[common.Address]*big.Int),
@@ -104,10 +135,20 @@ func New(cfg *Config) *BRCX {
 	BRCX.db = NewLDBEngine(cfg)
 	BRCX.sdkNode = false
 
-	if cfg.DBEngine == "mongodb" { // this is an add-on DBEngine for SDK nodes
+	switch cfg.DBEngine { // this is an add-on DBEngine for SDK nodes
+	case "mongodb":
 		BRCX.mongodb = NewMongoDBEngine(cfg)
 		BRCX.sdkNode = true
+	case "embedded":
+		BRCX.mongodb = NewEmbeddedEngine(cfg)
+		BRCX.sdkNode = true
+	}
+
+	candleIntervals, err := parseCandleIntervals(cfg.CandleIntervals)
+	if err != nil {
+		log.Crit("Failed to parse BRCx candle intervals", "err", err)
 	}
+	BRCX.candleIntervals = candleIntervals
 
 	BRCX.StateCache = tradingstate.NewDatabase(BRCX.db)
 	BRCX.settings.Store(overflowIdx, false)
@@ -191,6 +232,7 @@ func (BRCx *BRCX) ProcessOrderPending(header *types.Header, coinbase common.Addr
 			Type:            tx.Type(),
 			Hash:            tx.OrderHash(),
 			OrderID:         tx.OrderID(),
+			StopPrice:       tx.StopPrice(),
 			Signature: &tradingstate.Signature{
 				V: byte(n),
 				R: common.BigToHash(R),
@@ -305,7 +347,7 @@ func (BRCx *BRCX) ConvertBRCToToken(chain consensus.ChainContext, statedb *state
 //  2. txMatchData.Trades: includes information of matched orders.
 //     a. PutObject them to `trades` collection
 //     b. Update status of regrading orders to sdktypes.OrderStatusFilled
-func (BRCx *BRCX) SyncDataToSDKNode(takerOrderInTx *tradingstate.OrderItem, txHash common.Hash, txMatchTime time.Time, statedb *state.StateDB, trades []map[string]string, rejectedOrders []*tradingstate.OrderItem, dirtyOrderCount *uint64) error {
+func (BRCx *BRCX) SyncDataToSDKNode(takerOrderInTx *tradingstate.OrderItem, txHash common.Hash, txMatchTime time.Time, statedb *state.StateDB, trades []*tradingstate.TradeRecord, rejectedOrders []*tradingstate.OrderItem, dirtyOrderCount *uint64) error {
 	var (
 		// originTakerOrder: order get from db, nil if it doesn't exist
 		// takerOrderInTx: order decoded from txdata
@@ -368,38 +410,14 @@ func (BRCx *BRCX) SyncDataToSDKNode(takerOrderInTx *tradingstate.OrderItem, txHa
 		if trade == nil {
 			continue
 		}
-		tradeRecord := &tradingstate.Trade{}
-		quantity := tradingstate.ToBigInt(trade[tradingstate.TradeQuantity])
-		price := tradingstate.ToBigInt(trade[tradingstate.TradePrice])
-		if price.Cmp(big.NewInt(0)) <= 0 || quantity.Cmp(big.NewInt(0)) <= 0 {
+		quantity := trade.Quantity
+		price := trade.Price
+		if price == nil || price.Sign() <= 0 || quantity == nil || quantity.Sign() <= 0 {
 			return fmt.Errorf("trade misses important information. tradedPrice %v, tradedQuantity %v", price, quantity)
 		}
-		tradeRecord.Amount = quantity
-		tradeRecord.PricePoint = price
-		tradeRecord.BaseToken = updatedTakerOrder.BaseToken
-		tradeRecord.QuoteToken = updatedTakerOrder.QuoteToken
-		tradeRecord.Status = tradingstate.TradeStatusSuccess
-		tradeRecord.Taker = updatedTakerOrder.UserAddress
-		tradeRecord.Maker = common.HexToAddress(trade[tradingstate.TradeMaker])
-		tradeRecord.TakerOrderHash = updatedTakerOrder.Hash
-		tradeRecord.MakerOrderHash = common.HexToHash(trade[tradingstate.TradeMakerOrderHash])
-		tradeRecord.TxHash = txHash
-		tradeRecord.TakerOrderSide = updatedTakerOrder.Side
-		tradeRecord.TakerExchange = updatedTakerOrder.ExchangeAddress
-		tradeRecord.MakerExchange = common.HexToAddress(trade[tradingstate.TradeMakerExchange])
-
-		tradeRecord.MakeFee, _ = new(big.Int).SetString(trade[tradingstate.MakerFee], 10)
-		tradeRecord.TakeFee, _ = new(big.Int).SetString(trade[tradingstate.TakerFee], 10)
-
-		// set makerOrderType, takerOrderType
-		tradeRecord.MakerOrderType = trade[tradingstate.MakerOrderType]
-		tradeRecord.TakerOrderType = updatedTakerOrder.Type
-
-		if tradeRecord.CreatedAt.IsZero() {
-			tradeRecord.CreatedAt = txMatchTime
-		}
-		tradeRecord.UpdatedAt = txMatchTime
-		tradeRecord.Hash = tradeRecord.ComputeHash()
+		// trades of stop orders triggered by takerOrderInTx have their own taker
+		isTriggeredTrade := trade.TakerOrderHash != updatedTakerOrder.Hash
+		tradeRecord := trade.ToTrade(txHash, txMatchTime)
 
 		log.Debug("TRADE history", "amount", tradeRecord.Amount, "pricepoint", tradeRecord.PricePoint,
 			"taker", tradeRecord.Taker.Hex(), "maker", tradeRecord.Maker.Hex(), "takerOrder", tradeRecord.TakerOrderHash.Hex(), "makerOrder", tradeRecord.MakerOrderHash.Hex(),
@@ -412,27 +430,40 @@ func (BRCx *BRCX) SyncDataToSDKNode(takerOrderInTx *tradingstate.OrderItem, txHa
 		filledAmount := quantity
 		// maker dirty order
 		makerFilledAmount := big.NewInt(0)
-		if amount, ok := makerDirtyFilledAmount[trade[tradingstate.TradeMakerOrderHash]]; ok {
+		makerHash := trade.MakerOrderHash.Hex()
+		if amount, ok := makerDirtyFilledAmount[makerHash]; ok {
 			makerFilledAmount = tradingstate.CloneBigInt(amount)
 		}
 		makerFilledAmount = new(big.Int).Add(makerFilledAmount, filledAmount)
-		makerDirtyFilledAmount[trade[tradingstate.TradeMakerOrderHash]] = makerFilledAmount
-		makerDirtyHashes = append(makerDirtyHashes, trade[tradingstate.TradeMakerOrderHash])
+		makerDirtyFilledAmount[makerHash] = makerFilledAmount
+		makerDirtyHashes = append(makerDirtyHashes, makerHash)
+
+		if isTriggeredTrade {
+			// the triggered stop order is updated along with the makers
+			takerHash := tradeRecord.TakerOrderHash.Hex()
+			takerFilledAmount := big.NewInt(0)
+			if amount, ok := makerDirtyFilledAmount[takerHash]; ok {
+				takerFilledAmount = tradingstate.CloneBigInt(amount)
+			}
+			makerDirtyFilledAmount[takerHash] = new(big.Int).Add(takerFilledAmount, filledAmount)
+			makerDirtyHashes = append(makerDirtyHashes, takerHash)
+			continue
+		}
 
 		//updatedTakerOrder = BRCx.updateMatchedOrder(updatedTakerOrder, filledAmount, txMatchTime, txHash)
 		//  update filledAmount, status of takerOrder
 		updatedTakerOrder.FilledAmount = new(big.Int).Add(updatedTakerOrder.FilledAmount, filledAmount)
-		if updatedTakerOrder.FilledAmount.Cmp(updatedTakerOrder.Quantity) < 0 && updatedTakerOrder.Type == tradingstate.Limit {
+		if updatedTakerOrder.FilledAmount.Cmp(updatedTakerOrder.Quantity) < 0 && updatedTakerOrder.CanRest() {
 			updatedTakerOrder.Status = tradingstate.OrderStatusPartialFilled
 		} else {
 			updatedTakerOrder.Status = tradingstate.OrderStatusFilled
 		}
 	}
 
-	// for Market orders
+	// for Market, IOC and FOK orders
 	// filledAmount > 0 : FILLED
 	// otherwise: REJECTED
-	if updatedTakerOrder.Type == tradingstate.Market {
+	if !updatedTakerOrder.CanRest() {
 		if updatedTakerOrder.FilledAmount.Sign() > 0 {
 			updatedTakerOrder.Status = tradingstate.OrderStatusFilled
 		} else {
@@ -553,6 +584,23 @@ func (BRCx *BRCX) SyncDataToSDKNode(takerOrderInTx *tradingstate.OrderItem, txHa
 	return nil
 }
 
+// GetTradesByTxHash returns the trades of the matching transaction txHash as
+// stored by the SDK node database.
+func (BRCx *BRCX) GetTradesByTxHash(txHash common.Hash) ([]*tradingstate.TradeRecord, error) {
+	if !BRCx.IsSDKNode() {
+		return nil, ErrNotSDKNode
+	}
+	records := []*tradingstate.TradeRecord{}
+	items := BRCx.GetMongoDB().GetListItemByTxHash(txHash, &tradingstate.Trade{})
+	if items == nil {
+		return records, nil
+	}
+	for _, trade := range items.([]*tradingstate.Trade) {
+		records = append(records, trade.Record())
+	}
+	return records, nil
+}
+
 func (BRCx *BRCX) GetTradingState(block *types.Block, author common.Address) (*tradingstate.TradingStateDB, error) {
 	root, err := BRCx.GetTradingStateRoot(block, author)
 	if err != nil {
@@ -611,6 +659,12 @@ func (BRCx *BRCX) UpdateOrderCache(baseToken, quoteToken common.Address, orderHa
 }
 
 func (BRCx *BRCX) RollbackReorgTxMatch(txhash common.Hash) error {
+	if err := BRCx.rollbackCandles(txhash); err != nil {
+		return fmt.Errorf("failed to rollback candles. %v", err)
+	}
+	if !BRCx.IsSDKNode() {
+		return nil
+	}
 	db := BRCx.GetMongoDB()
 	db.InitBulk()
 
@@ -5,6 +5,9 @@ import (
 	"errors"
 	"sync"
 	"time"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/rpc"
 )
 
 const (
@@ -40,3 +43,122 @@ func NewPublicBRCXAPI(t *BRCX) *PublicBRCXAPI {
 func (api *PublicBRCXAPI) Version(ctx context.Context) string {
 	return ProtocolVersionStr
 }
+
+// Trades creates a subscription that fires for every trade of the given pair.
+func (api *PublicBRCXAPI) Trades(ctx context.Context, baseToken, quoteToken common.Address) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		events := make(chan TradesEvent, 128)
+		eventsSub := api.t.SubscribeTradesEvent(events)
+		defer eventsSub.Unsubscribe()
+
+		for {
+			select {
+			case ev := <-events:
+				if ev.BaseToken != baseToken || ev.QuoteToken != quoteToken {
+					continue
+				}
+				for _, trade := range ev.Trades {
+					notifier.Notify(rpcSub.ID, trade)
+				}
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// OrderStatus creates a subscription that fires when an order of the given user
+// is accepted, matched, cancelled or rejected.
+func (api *PublicBRCXAPI) OrderStatus(ctx context.Context, userAddress common.Address) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		events := make(chan OrderStatusEvent, 128)
+		eventsSub := api.t.SubscribeOrderStatusEvent(events)
+		defer eventsSub.Unsubscribe()
+
+		for {
+			select {
+			case ev := <-events:
+				for _, order := range ev.Orders {
+					if order.UserAddress == userAddress {
+						notifier.Notify(rpcSub.ID, order)
+					}
+				}
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// OrderBook creates a subscription that fires with the new volume of every
+// price level of the given pair changed by matching. A zero volume means the
+// level has been removed.
+func (api *PublicBRCXAPI) OrderBook(ctx context.Context, baseToken, quoteToken common.Address) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		events := make(chan OrderBookEvent, 128)
+		eventsSub := api.t.SubscribeOrderBookEvent(events)
+		defer eventsSub.Unsubscribe()
+
+		for {
+			select {
+			case ev := <-events:
+				var deltas []*OrderBookDelta
+				for _, delta := range ev.Deltas {
+					if delta.BaseToken == baseToken && delta.QuoteToken == quoteToken {
+						deltas = append(deltas, delta)
+					}
+				}
+				if len(deltas) > 0 {
+					notifier.Notify(rpcSub.ID, deltas)
+				}
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// GetCandles returns the OHLCV candles of the given pair opened between from
+// and to (unix timestamps), interval is one of the indexed intervals, e.g. "1m", "1h".
+func (api *PublicBRCXAPI) GetCandles(ctx context.Context, baseToken, quoteToken common.Address, interval string, from, to uint64) ([]*Candle, error) {
+	seconds, err := ParseCandleInterval(interval)
+	if err != nil {
+		return nil, err
+	}
+	return api.t.GetCandles(baseToken, quoteToken, seconds, from, to)
+}
+
+// GetTicker returns the summary of the trades of the given pair in the last 24 hours.
+func (api *PublicBRCXAPI) GetTicker(ctx context.Context, baseToken, quoteToken common.Address) (*Ticker, error) {
+	return api.t.GetTicker(baseToken, quoteToken, time.Now())
+}
@@ -0,0 +1,96 @@
+package BRCx
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"BRDPoSChain/BRCx/tradingstate"
+	"BRDPoSChain/common"
+	"BRDPoSChain/rpc"
+)
+
+func TestMatchingSubscriptions(t *testing.T) {
+	BRCx := New(&DefaultConfig)
+	defer BRCx.Stop()
+
+	server := rpc.NewServer()
+	defer server.Stop()
+	if err := server.RegisterName(ProtocolName, NewPublicBRCXAPI(BRCx)); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	var (
+		trades   = make(chan *tradingstate.TradeRecord, 8)
+		statuses = make(chan *OrderStatus, 8)
+		books    = make(chan []*OrderBookDelta, 8)
+		other    = make(chan *tradingstate.TradeRecord, 8)
+	)
+	for _, sub := range []struct {
+		ch   interface{}
+		args []interface{}
+	}{
+		{trades, []interface{}{"trades", testBaseToken, common.BRCNativeAddressBinary}},
+		{statuses, []interface{}{"orderStatus", testBuyer}},
+		{books, []interface{}{"orderBook", testBaseToken, common.BRCNativeAddressBinary}},
+		{other, []interface{}{"trades", common.HexToAddress("0x1000000000000000000000000000000000000003"), common.BRCNativeAddressBinary}},
+	} {
+		s, err := client.Subscribe(context.Background(), ProtocolName, sub.ch, sub.args...)
+		if err != nil {
+			t.Fatalf("failed to subscribe %v: %v", sub.args[0], err)
+		}
+		defer s.Unsubscribe()
+	}
+	// the subscriptions are tracked by the API goroutines asynchronously
+	for deadline := time.Now().Add(time.Second); BRCx.scope.Count() < 4; {
+		if time.Now().After(deadline) {
+			t.Fatalf("subscriptions not tracked, have %d", BRCx.scope.Count())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// a buy taking part of a resting ask, as imported in a block
+	statedb, tradingStateDb, orderBook := newMatchingTestState(t, BRCx)
+	restOrder(t, BRCx, statedb, tradingStateDb, orderBook, testOrder(tradingstate.Limit, tradingstate.Ask, 1, 5))
+	taker := testOrder(tradingstate.Limit, tradingstate.Bid, 1, 3)
+	matched, rejects, err := BRCx.processLimitOrder(common.Address{}, nil, statedb, tradingStateDb, orderBook, taker)
+	if err != nil || len(matched) != 1 {
+		t.Fatalf("limit order: trades %v , rejects %v , err %v", matched, rejects, err)
+	}
+	BRCx.PublishMatchingResult(tradingStateDb, taker, matched, rejects)
+
+	timeout := time.After(time.Second)
+	select {
+	case trade := <-trades:
+		if trade.TakerOrderHash != taker.Hash || trade.Quantity.Cmp(taker.Quantity) != 0 {
+			t.Fatalf("wrong trade notified: %+v", trade)
+		}
+	case <-timeout:
+		t.Fatal("trade not notified")
+	}
+	select {
+	case status := <-statuses:
+		if status.Hash != taker.Hash || status.Status != tradingstate.OrderStatusFilled || status.FilledAmount.Cmp(taker.Quantity) != 0 {
+			t.Fatalf("wrong order status notified: %+v", status)
+		}
+	case <-timeout:
+		t.Fatal("order status not notified")
+	}
+	select {
+	case deltas := <-books:
+		want := new(big.Int).Mul(common.BasePrice, big.NewInt(2))
+		if len(deltas) != 1 || deltas[0].Side != tradingstate.Ask || deltas[0].Volume.Cmp(want) != 0 {
+			t.Fatalf("wrong order book deltas notified: %v", deltas)
+		}
+	case <-timeout:
+		t.Fatal("order book deltas not notified")
+	}
+	select {
+	case trade := <-other:
+		t.Fatalf("trade of another pair notified: %+v", trade)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,412 @@
+package BRCx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"BRDPoSChain/BRCx/tradingstate"
+	"BRDPoSChain/common"
+	"BRDPoSChain/log"
+	"BRDPoSChain/rlp"
+)
+
+const (
+	// maximum number of candles returned by one GetCandles call
+	MaximumCandles = 1000
+	tickerPeriod   = 24 * 60 * 60
+)
+
+var (
+	ErrUnknownCandleInterval = errors.New("unknown candle interval")
+	ErrInvalidCandleRange    = errors.New("invalid candle range")
+
+	// DefaultCandleIntervals are the candle intervals indexed if none is configured
+	DefaultCandleIntervals = []string{"1m", "5m", "1h", "1d"}
+
+	candleKeyPrefix      = []byte("BRCx-candle-") // candleKeyPrefix + orderBook + interval + openTime -> Candle
+	candleTradeKeyPrefix = []byte("BRCx-ctrade-") // candleTradeKeyPrefix + orderBook + time + txHash + index -> candleTrade
+	candleTxKeyPrefix    = []byte("BRCx-ctx-")    // candleTxKeyPrefix + txHash -> keys of the trades indexed by the tx
+)
+
+// Candle is the OHLCV summary of the trades of a pair in one interval.
+type Candle struct {
+	OpenTime uint64   `json:"openTime"`
+	Open     *big.Int `json:"open"`
+	High     *big.Int `json:"high"`
+	Low      *big.Int `json:"low"`
+	Close    *big.Int `json:"close"`
+	Volume   *big.Int `json:"volume"` // traded quantity of base token
+	Count    uint64   `json:"count"`
+}
+
+// Ticker is the summary of the trades of a pair in the last 24 hours.
+type Ticker struct {
+	BaseToken   common.Address `json:"baseToken"`
+	QuoteToken  common.Address `json:"quoteToken"`
+	Open        *big.Int       `json:"open"`
+	High        *big.Int       `json:"high"`
+	Low         *big.Int       `json:"low"`
+	Last        *big.Int       `json:"last"`
+	PriceChange *big.Int       `json:"priceChange"`
+	Volume      *big.Int       `json:"volume"`
+	Count       uint64         `json:"count"`
+	From        uint64         `json:"from"`
+	To          uint64         `json:"to"`
+}
+
+// candleTrade is the part of a trade kept to rebuild candles after a reorg.
+type candleTrade struct {
+	Price    *big.Int
+	Quantity *big.Int
+}
+
+func (c *Candle) add(price, quantity *big.Int) {
+	if c.Count == 0 {
+		c.Open = new(big.Int).Set(price)
+		c.High = new(big.Int).Set(price)
+		c.Low = new(big.Int).Set(price)
+		c.Volume = new(big.Int)
+	}
+	if price.Cmp(c.High) > 0 {
+		c.High = new(big.Int).Set(price)
+	}
+	if price.Cmp(c.Low) < 0 {
+		c.Low = new(big.Int).Set(price)
+	}
+	c.Close = new(big.Int).Set(price)
+	c.Volume = new(big.Int).Add(c.Volume, quantity)
+	c.Count++
+}
+
+// ParseCandleInterval converts an interval like "1m", "5m", "1h" or "1d" to seconds.
+func ParseCandleInterval(interval string) (uint64, error) {
+	if len(interval) < 2 {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownCandleInterval, interval)
+	}
+	var unit uint64
+	switch interval[len(interval)-1] {
+	case 's':
+		unit = 1
+	case 'm':
+		unit = 60
+	case 'h':
+		unit = 60 * 60
+	case 'd':
+		unit = 24 * 60 * 60
+	default:
+		return 0, fmt.Errorf("%w: %q", ErrUnknownCandleInterval, interval)
+	}
+	n, err := strconv.ParseUint(interval[:len(interval)-1], 10, 64)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownCandleInterval, interval)
+	}
+	return n * unit, nil
+}
+
+// parseCandleIntervals returns the sorted unique intervals in seconds.
+func parseCandleIntervals(intervals []string) ([]uint64, error) {
+	if len(intervals) == 0 {
+		intervals = DefaultCandleIntervals
+	}
+	seen := make(map[uint64]bool)
+	result := []uint64{}
+	for _, interval := range intervals {
+		seconds, err := ParseCandleInterval(strings.TrimSpace(interval))
+		if err != nil {
+			return nil, err
+		}
+		if !seen[seconds] {
+			seen[seconds] = true
+			result = append(result, seconds)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result, nil
+}
+
+func (BRCx *BRCX) hasCandleInterval(interval uint64) bool {
+	for _, i := range BRCx.candleIntervals {
+		if i == interval {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeUint64(n uint64) []byte {
+	enc := make([]byte, 8)
+	binary.BigEndian.PutUint64(enc, n)
+	return enc
+}
+
+func candleKey(orderBook common.Hash, interval, openTime uint64) []byte {
+	key := append(append([]byte{}, candleKeyPrefix...), orderBook.Bytes()...)
+	key = append(key, encodeUint64(interval)...)
+	return append(key, encodeUint64(openTime)...)
+}
+
+func candleTradeKey(orderBook common.Hash, timestamp uint64, txHash common.Hash, index uint32) []byte {
+	key := append(append([]byte{}, candleTradeKeyPrefix...), orderBook.Bytes()...)
+	key = append(key, encodeUint64(timestamp)...)
+	key = append(key, txHash.Bytes()...)
+	return binary.BigEndian.AppendUint32(key, index)
+}
+
+func candleTxKey(txHash common.Hash) []byte {
+	return append(append([]byte{}, candleTxKeyPrefix...), txHash.Bytes()...)
+}
+
+// splitCandleTradeKey returns the order book and the time of a trade key.
+func splitCandleTradeKey(key []byte) (common.Hash, uint64) {
+	key = key[len(candleTradeKeyPrefix):]
+	return common.BytesToHash(key[:common.HashLength]), binary.BigEndian.Uint64(key[common.HashLength : common.HashLength+8])
+}
+
+func (BRCx *BRCX) readCandle(key []byte) (*Candle, error) {
+	if ok, _ := BRCx.db.Has(key); !ok {
+		return &Candle{}, nil
+	}
+	data, err := BRCx.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	candle := new(Candle)
+	if err := rlp.DecodeBytes(data, candle); err != nil {
+		return nil, err
+	}
+	return candle, nil
+}
+
+// IndexTrades adds the trades of a matching transaction to the candles of
+// their pairs. The trades are timed by the block of the transaction so that
+// all nodes build the same candles. Indexing a transaction twice is a no-op.
+func (BRCx *BRCX) IndexTrades(txHash common.Hash, txMatchTime time.Time, trades []*tradingstate.TradeRecord) error {
+	if len(trades) == 0 {
+		return nil
+	}
+	BRCx.candleLock.Lock()
+	defer BRCx.candleLock.Unlock()
+
+	txKey := candleTxKey(txHash)
+	if ok, _ := BRCx.db.Has(txKey); ok {
+		return nil
+	}
+	var (
+		batch     = BRCx.db.NewBatch()
+		timestamp = uint64(txMatchTime.Unix())
+		tradeKeys = make([][]byte, 0, len(trades))
+		candles   = make(map[string]*Candle)
+	)
+	for i, trade := range trades {
+		if trade.Price == nil || trade.Quantity == nil {
+			continue
+		}
+		orderBook := tradingstate.GetTradingOrderBookHash(trade.BaseToken, trade.QuoteToken)
+		key := candleTradeKey(orderBook, timestamp, txHash, uint32(i))
+		data, err := rlp.EncodeToBytes(&candleTrade{Price: trade.Price, Quantity: trade.Quantity})
+		if err != nil {
+			return err
+		}
+		if err := batch.Put(key, data); err != nil {
+			return err
+		}
+		tradeKeys = append(tradeKeys, key)
+
+		for _, interval := range BRCx.candleIntervals {
+			openTime := timestamp - timestamp%interval
+			ckey := candleKey(orderBook, interval, openTime)
+			candle, ok := candles[string(ckey)]
+			if !ok {
+				if candle, err = BRCx.readCandle(ckey); err != nil {
+					return err
+				}
+				candle.OpenTime = openTime
+				candles[string(ckey)] = candle
+			}
+			candle.add(trade.Price, trade.Quantity)
+		}
+	}
+	for key, candle := range candles {
+		data, err := rlp.EncodeToBytes(candle)
+		if err != nil {
+			return err
+		}
+		if err := batch.Put([]byte(key), data); err != nil {
+			return err
+		}
+	}
+	data, err := rlp.EncodeToBytes(tradeKeys)
+	if err != nil {
+		return err
+	}
+	if err := batch.Put(txKey, data); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// rollbackCandles removes the trades of a reorged transaction and rebuilds the
+// candles they belonged to from the remaining trades.
+func (BRCx *BRCX) rollbackCandles(txHash common.Hash) error {
+	BRCx.candleLock.Lock()
+	defer BRCx.candleLock.Unlock()
+
+	txKey := candleTxKey(txHash)
+	if ok, _ := BRCx.db.Has(txKey); !ok {
+		return nil
+	}
+	data, err := BRCx.db.Get(txKey)
+	if err != nil {
+		return err
+	}
+	var tradeKeys [][]byte
+	if err := rlp.DecodeBytes(data, &tradeKeys); err != nil {
+		return err
+	}
+	type bucket struct {
+		orderBook common.Hash
+		interval  uint64
+		openTime  uint64
+	}
+	var (
+		batch   = BRCx.db.NewBatch()
+		removed = make(map[string]bool)
+		buckets = make(map[bucket]bool)
+	)
+	for _, key := range tradeKeys {
+		if err := batch.Delete(key); err != nil {
+			return err
+		}
+		removed[string(key)] = true
+		orderBook, timestamp := splitCandleTradeKey(key)
+		for _, interval := range BRCx.candleIntervals {
+			buckets[bucket{orderBook, interval, timestamp - timestamp%interval}] = true
+		}
+	}
+	for b := range buckets {
+		candle := &Candle{OpenTime: b.openTime}
+		prefix := append(append([]byte{}, candleTradeKeyPrefix...), b.orderBook.Bytes()...)
+		it := BRCx.db.NewIterator(prefix, encodeUint64(b.openTime))
+		for it.Next() {
+			if _, timestamp := splitCandleTradeKey(it.Key()); timestamp >= b.openTime+b.interval {
+				break
+			}
+			if removed[string(it.Key())] {
+				continue
+			}
+			var trade candleTrade
+			if err := rlp.DecodeBytes(it.Value(), &trade); err != nil {
+				it.Release()
+				return err
+			}
+			candle.add(trade.Price, trade.Quantity)
+		}
+		it.Release()
+
+		key := candleKey(b.orderBook, b.interval, b.openTime)
+		if candle.Count == 0 {
+			err = batch.Delete(key)
+		} else {
+			data, err = rlp.EncodeToBytes(candle)
+			if err == nil {
+				err = batch.Put(key, data)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := batch.Delete(txKey); err != nil {
+		return err
+	}
+	log.Debug("BRCx reorg: rollback candles", "txhash", txHash.Hex(), "trades", len(tradeKeys))
+	return batch.Write()
+}
+
+// GetCandles returns the candles of a pair opened in [from, to], oldest first.
+func (BRCx *BRCX) GetCandles(baseToken, quoteToken common.Address, interval uint64, from, to uint64) ([]*Candle, error) {
+	if !BRCx.hasCandleInterval(interval) {
+		return nil, ErrUnknownCandleInterval
+	}
+	if from > to {
+		return nil, ErrInvalidCandleRange
+	}
+	orderBook := tradingstate.GetTradingOrderBookHash(baseToken, quoteToken)
+	prefix := append(append(append([]byte{}, candleKeyPrefix...), orderBook.Bytes()...), encodeUint64(interval)...)
+	it := BRCx.db.NewIterator(prefix, encodeUint64(from-from%interval))
+	defer it.Release()
+
+	candles := []*Candle{}
+	for it.Next() && len(candles) < MaximumCandles {
+		candle := new(Candle)
+		if err := rlp.DecodeBytes(it.Value(), candle); err != nil {
+			return nil, err
+		}
+		if candle.OpenTime > to {
+			break
+		}
+		candles = append(candles, candle)
+	}
+	return candles, it.Error()
+}
+
+// GetTicker returns the summary of the trades of a pair in the 24 hours
+// before now, built from the candles of the smallest indexed interval.
+func (BRCx *BRCX) GetTicker(baseToken, quoteToken common.Address, now time.Time) (*Ticker, error) {
+	if len(BRCx.candleIntervals) == 0 {
+		return nil, ErrUnknownCandleInterval
+	}
+	var (
+		interval = BRCx.candleIntervals[0]
+		to       = uint64(now.Unix())
+		from     = uint64(0)
+	)
+	if to > tickerPeriod {
+		from = to - tickerPeriod
+	}
+	// skip the candle which was opened before the period
+	if from%interval != 0 {
+		from += interval - from%interval
+	}
+	ticker := &Ticker{
+		BaseToken:  baseToken,
+		QuoteToken: quoteToken,
+		Volume:     new(big.Int),
+		From:       from,
+		To:         to,
+	}
+	for from <= to {
+		candles, err := BRCx.GetCandles(baseToken, quoteToken, interval, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, candle := range candles {
+			if ticker.Count == 0 {
+				ticker.Open, ticker.High, ticker.Low = candle.Open, candle.High, candle.Low
+			}
+			if candle.High.Cmp(ticker.High) > 0 {
+				ticker.High = candle.High
+			}
+			if candle.Low.Cmp(ticker.Low) < 0 {
+				ticker.Low = candle.Low
+			}
+			ticker.Last = candle.Close
+			ticker.Volume = new(big.Int).Add(ticker.Volume, candle.Volume)
+			ticker.Count += candle.Count
+		}
+		if len(candles) < MaximumCandles {
+			break
+		}
+		from = candles[len(candles)-1].OpenTime + interval
+	}
+	if ticker.Count > 0 {
+		ticker.PriceChange = new(big.Int).Sub(ticker.Last, ticker.Open)
+	}
+	return ticker, nil
+}
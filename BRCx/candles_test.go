@@ -0,0 +1,109 @@
+package BRCx
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"BRDPoSChain/BRCx/tradingstate"
+	"BRDPoSChain/common"
+)
+
+func TestParseCandleInterval(t *testing.T) {
+	tests := map[string]uint64{"30s": 30, "1m": 60, "5m": 300, "1h": 3600, "1d": 86400}
+	for interval, want := range tests {
+		if got, err := ParseCandleInterval(interval); err != nil || got != want {
+			t.Errorf("ParseCandleInterval(%q) = %d , %v , want %d", interval, got, err, want)
+		}
+	}
+	for _, interval := range []string{"", "m", "0m", "1w", "-1h"} {
+		if _, err := ParseCandleInterval(interval); err == nil {
+			t.Errorf("ParseCandleInterval(%q) expected an error", interval)
+		}
+	}
+}
+
+func TestIndexTrades(t *testing.T) {
+	BRCx := New(&Config{DataDir: t.TempDir()})
+	defer BRCx.db.Close()
+
+	base := common.HexToAddress("0x1000000000000000000000000000000000000002")
+	quote := common.BRCNativeAddressBinary
+	trade := func(price, quantity int64) *tradingstate.TradeRecord {
+		return &tradingstate.TradeRecord{BaseToken: base, QuoteToken: quote, Price: big.NewInt(price), Quantity: big.NewInt(quantity)}
+	}
+	start := time.Unix(1700000040, 0) // 1700000040 is the beginning of a minute
+	tx1, tx2, tx3 := common.HexToHash("0x1"), common.HexToHash("0x2"), common.HexToHash("0x3")
+
+	if err := BRCx.IndexTrades(tx1, start, []*tradingstate.TradeRecord{trade(100, 1), trade(120, 2)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := BRCx.IndexTrades(tx2, start.Add(30*time.Second), []*tradingstate.TradeRecord{trade(90, 3)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := BRCx.IndexTrades(tx3, start.Add(90*time.Second), []*tradingstate.TradeRecord{trade(110, 4)}); err != nil {
+		t.Fatal(err)
+	}
+	// indexing a transaction again doesn't count its trades twice
+	if err := BRCx.IndexTrades(tx2, start.Add(30*time.Second), []*tradingstate.TradeRecord{trade(90, 3)}); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(candle *Candle, openTime uint64, open, high, low, close, volume int64, count uint64) {
+		t.Helper()
+		if candle.OpenTime != openTime || candle.Open.Int64() != open || candle.High.Int64() != high || candle.Low.Int64() != low ||
+			candle.Close.Int64() != close || candle.Volume.Int64() != volume || candle.Count != count {
+			t.Fatalf("wrong candle %+v , want open time %d, ohlcv %d %d %d %d %d, count %d", candle, openTime, open, high, low, close, volume, count)
+		}
+	}
+	from := uint64(start.Unix())
+	candles, err := BRCx.GetCandles(base, quote, 60, from, from+3600)
+	if err != nil || len(candles) != 2 {
+		t.Fatalf("1m candles: %v , err %v", candles, err)
+	}
+	check(candles[0], from, 100, 120, 90, 90, 6, 3)
+	check(candles[1], from+60, 110, 110, 110, 110, 4, 1)
+
+	candles, err = BRCx.GetCandles(base, quote, 3600, from, from+3600)
+	if err != nil || len(candles) != 1 {
+		t.Fatalf("1h candles: %v , err %v", candles, err)
+	}
+	check(candles[0], from-from%3600, 100, 120, 90, 110, 10, 4)
+
+	if _, err := BRCx.GetCandles(base, quote, 120, from, from+3600); err != ErrUnknownCandleInterval {
+		t.Fatalf("expected %v , got %v", ErrUnknownCandleInterval, err)
+	}
+
+	ticker, err := BRCx.GetTicker(base, quote, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticker.Open.Int64() != 100 || ticker.High.Int64() != 120 || ticker.Low.Int64() != 90 || ticker.Last.Int64() != 110 ||
+		ticker.Volume.Int64() != 10 || ticker.Count != 4 || ticker.PriceChange.Int64() != 10 {
+		t.Fatalf("wrong ticker %+v", ticker)
+	}
+
+	// reorg removes the trades of tx2 from the candles
+	if err := BRCx.RollbackReorgTxMatch(tx2); err != nil {
+		t.Fatal(err)
+	}
+	candles, err = BRCx.GetCandles(base, quote, 60, from, from+3600)
+	if err != nil || len(candles) != 2 {
+		t.Fatalf("1m candles after rollback: %v , err %v", candles, err)
+	}
+	check(candles[0], from, 100, 120, 100, 120, 3, 2)
+
+	// reorg removes the candles left without trades
+	if err := BRCx.RollbackReorgTxMatch(tx3); err != nil {
+		t.Fatal(err)
+	}
+	candles, err = BRCx.GetCandles(base, quote, 60, from, from+3600)
+	if err != nil || len(candles) != 1 {
+		t.Fatalf("1m candles after rollback: %v , err %v", candles, err)
+	}
+	candles, err = BRCx.GetCandles(base, quote, 3600, from, from+3600)
+	if err != nil || len(candles) != 1 {
+		t.Fatalf("1h candles after rollback: %v , err %v", candles, err)
+	}
+	check(candles[0], from-from%3600, 100, 120, 100, 120, 3, 2)
+}
@@ -0,0 +1,249 @@
+package BRCx
+
+import (
+	"math/big"
+
+	"BRDPoSChain/BRCx/tradingstate"
+	"BRDPoSChain/common"
+	"BRDPoSChain/event"
+)
+
+// TradesEvent is posted when orders of a pair have been matched.
+type TradesEvent struct {
+	BaseToken  common.Address
+	QuoteToken common.Address
+	Trades     []*tradingstate.TradeRecord
+}
+
+// OrderStatus is the state of an order after it has been processed.
+type OrderStatus struct {
+	Hash         common.Hash    `json:"hash"`
+	OrderID      uint64         `json:"orderID"`
+	UserAddress  common.Address `json:"userAddress"`
+	BaseToken    common.Address `json:"baseToken"`
+	QuoteToken   common.Address `json:"quoteToken"`
+	Side         string         `json:"side"`
+	Type         string         `json:"type"`
+	Status       string         `json:"status"`
+	FilledAmount *big.Int       `json:"filledAmount"` // amount filled by this matching only
+}
+
+// OrderStatusEvent is posted when the status of orders has changed.
+type OrderStatusEvent struct {
+	Orders []*OrderStatus
+}
+
+// OrderBookDelta is the new volume of a price level, a zero volume means
+// the level has been removed from the book.
+type OrderBookDelta struct {
+	BaseToken  common.Address `json:"baseToken"`
+	QuoteToken common.Address `json:"quoteToken"`
+	Side       string         `json:"side"`
+	Price      *big.Int       `json:"price"`
+	Volume     *big.Int       `json:"volume"`
+}
+
+// OrderBookEvent is posted when price levels of a pair have changed.
+type OrderBookEvent struct {
+	Deltas []*OrderBookDelta
+}
+
+// SubscribeTradesEvent registers a subscription of TradesEvent.
+func (BRCx *BRCX) SubscribeTradesEvent(ch chan<- TradesEvent) event.Subscription {
+	return BRCx.scope.Track(BRCx.tradesFeed.Subscribe(ch))
+}
+
+// SubscribeOrderStatusEvent registers a subscription of OrderStatusEvent.
+func (BRCx *BRCX) SubscribeOrderStatusEvent(ch chan<- OrderStatusEvent) event.Subscription {
+	return BRCx.scope.Track(BRCx.orderStatusFeed.Subscribe(ch))
+}
+
+// SubscribeOrderBookEvent registers a subscription of OrderBookEvent.
+func (BRCx *BRCX) SubscribeOrderBookEvent(ch chan<- OrderBookEvent) event.Subscription {
+	return BRCx.scope.Track(BRCx.orderBookFeed.Subscribe(ch))
+}
+
+// PublishMatchingResult posts the trades, order status changes and book level
+// changes caused by processing order in a block of the canonical chain,
+// tradingStateDB is the trading state after the block.
+func (BRCx *BRCX) PublishMatchingResult(tradingStateDB *tradingstate.TradingStateDB, order *tradingstate.OrderItem, trades []*tradingstate.TradeRecord, rejects []*tradingstate.OrderItem) {
+	if BRCx.scope.Count() == 0 {
+		return
+	}
+	var (
+		statuses  []*OrderStatus
+		levels    []*OrderBookDelta
+		seen      = make(map[string]map[common.Hash]struct{})
+		orderBook = tradingstate.GetTradingOrderBookHash(order.BaseToken, order.QuoteToken)
+	)
+	// the levels touched by the makers and the orders rejected while matching
+	addLevel := func(side string, price *big.Int) {
+		if price == nil || price.Sign() <= 0 {
+			return
+		}
+		if seen[side] == nil {
+			seen[side] = make(map[common.Hash]struct{})
+		}
+		if _, ok := seen[side][common.BigToHash(price)]; ok {
+			return
+		}
+		seen[side][common.BigToHash(price)] = struct{}{}
+		levels = append(levels, &OrderBookDelta{
+			BaseToken:  order.BaseToken,
+			QuoteToken: order.QuoteToken,
+			Side:       side,
+			Price:      price,
+			Volume:     tradingStateDB.GetVolume(orderBook, price, side),
+		})
+	}
+	for _, trade := range trades {
+		if trade.TakerOrderSide == tradingstate.Bid {
+			addLevel(tradingstate.Ask, trade.Price)
+		} else {
+			addLevel(tradingstate.Bid, trade.Price)
+		}
+	}
+	for _, reject := range rejects {
+		if reject.Hash != order.Hash && !reject.IsUntriggeredStopOrder() {
+			addLevel(reject.Side, reject.Price)
+		}
+	}
+	isRejected := func(hash common.Hash) bool {
+		for _, reject := range rejects {
+			if reject.Hash == hash {
+				return true
+			}
+		}
+		return false
+	}
+
+	// filled amount per order, in the order of the trades
+	var (
+		filled     = make(map[common.Hash]*big.Int)
+		filledList []*OrderStatus
+	)
+	addFilled := func(status *OrderStatus, amount *big.Int) {
+		if current, ok := filled[status.Hash]; ok {
+			filled[status.Hash] = new(big.Int).Add(current, amount)
+			return
+		}
+		filled[status.Hash] = new(big.Int).Set(amount)
+		filledList = append(filledList, status)
+	}
+	for _, trade := range trades {
+		makerSide := tradingstate.Bid
+		if trade.TakerOrderSide == tradingstate.Bid {
+			makerSide = tradingstate.Ask
+		}
+		addFilled(&OrderStatus{
+			Hash:        trade.MakerOrderHash,
+			OrderID:     trade.MakerOrderID,
+			UserAddress: trade.Maker,
+			BaseToken:   trade.BaseToken,
+			QuoteToken:  trade.QuoteToken,
+			Side:        makerSide,
+			Type:        trade.MakerOrderType,
+		}, trade.Quantity)
+		if trade.TakerOrderHash != order.Hash {
+			// taker of a triggered stop order
+			addFilled(&OrderStatus{
+				Hash:        trade.TakerOrderHash,
+				UserAddress: trade.Taker,
+				BaseToken:   trade.BaseToken,
+				QuoteToken:  trade.QuoteToken,
+				Side:        trade.TakerOrderSide,
+				Type:        trade.TakerOrderType,
+			}, trade.Quantity)
+		}
+	}
+
+	// the processed order itself
+	takerStatus := &OrderStatus{
+		Hash:         order.Hash,
+		OrderID:      order.OrderID,
+		UserAddress:  order.UserAddress,
+		BaseToken:    order.BaseToken,
+		QuoteToken:   order.QuoteToken,
+		Side:         order.Side,
+		Type:         order.Type,
+		FilledAmount: new(big.Int),
+	}
+	for _, trade := range trades {
+		if trade.TakerOrderHash == order.Hash {
+			takerStatus.FilledAmount.Add(takerStatus.FilledAmount, trade.Quantity)
+		}
+	}
+	switch {
+	case order.Status == tradingstate.OrderStatusCancelled:
+		if isRejected(order.Hash) {
+			takerStatus.Status = tradingstate.OrderStatusRejected
+		} else {
+			takerStatus.Status = tradingstate.OrderStatusCancelled
+		}
+	case isRejected(order.Hash) || (!order.CanRest() && takerStatus.FilledAmount.Sign() == 0):
+		if takerStatus.FilledAmount.Sign() > 0 {
+			takerStatus.Status = tradingstate.OrderStatusFilled
+		} else {
+			takerStatus.Status = tradingstate.OrderStatusRejected
+		}
+	case !order.CanRest():
+		takerStatus.Status = tradingstate.OrderStatusFilled
+	default:
+		remaining := tradingStateDB.GetOrder(orderBook, common.BigToHash(new(big.Int).SetUint64(order.OrderID))).Quantity
+		switch {
+		case takerStatus.FilledAmount.Sign() == 0:
+			takerStatus.Status = tradingstate.OrderStatusOpen
+		case remaining == nil || remaining.Sign() == 0:
+			takerStatus.Status = tradingstate.OrderStatusFilled
+		default:
+			takerStatus.Status = tradingstate.OrderStatusPartialFilled
+		}
+	}
+	statuses = append(statuses, takerStatus)
+	// the order changes its own level only when it rests in or leaves the book
+	switch takerStatus.Status {
+	case tradingstate.OrderStatusOpen, tradingstate.OrderStatusPartialFilled, tradingstate.OrderStatusCancelled:
+		if !order.IsUntriggeredStopOrder() {
+			addLevel(order.Side, order.Price)
+		}
+	}
+
+	for _, status := range filledList {
+		status.FilledAmount = filled[status.Hash]
+		status.Status = tradingstate.OrderStatusPartialFilled
+		if isRejected(status.Hash) {
+			status.Status = tradingstate.OrderStatusRejected
+		} else if status.OrderID > 0 {
+			remaining := tradingStateDB.GetOrder(orderBook, common.BigToHash(new(big.Int).SetUint64(status.OrderID))).Quantity
+			if remaining == nil || remaining.Sign() == 0 {
+				status.Status = tradingstate.OrderStatusFilled
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	// makers rejected while matching leave the book without trading
+	for _, reject := range rejects {
+		if reject.Hash == order.Hash || filled[reject.Hash] != nil {
+			continue
+		}
+		statuses = append(statuses, &OrderStatus{
+			Hash:         reject.Hash,
+			OrderID:      reject.OrderID,
+			UserAddress:  reject.UserAddress,
+			BaseToken:    reject.BaseToken,
+			QuoteToken:   reject.QuoteToken,
+			Side:         reject.Side,
+			Type:         reject.Type,
+			Status:       tradingstate.OrderStatusRejected,
+			FilledAmount: new(big.Int),
+		})
+	}
+
+	if len(trades) > 0 {
+		BRCx.tradesFeed.Send(TradesEvent{BaseToken: order.BaseToken, QuoteToken: order.QuoteToken, Trades: trades})
+	}
+	BRCx.orderStatusFeed.Send(OrderStatusEvent{Orders: statuses})
+	if len(levels) > 0 {
+		BRCx.orderBookFeed.Send(OrderBookEvent{Deltas: levels})
+	}
+}
@@ -3,7 +3,6 @@ package BRCx
 import (
 	"encoding/json"
 	"math/big"
-	"strconv"
 	"time"
 
 	"BRDPoSChain/core/types"
@@ -18,7 +17,7 @@ import (
 	"BRDPoSChain/log"
 )
 
-func (BRCx *BRCX) CommitOrder(header *types.Header, coinbase common.Address, chain consensus.ChainContext, statedb *state.StateDB, tradingStateDB *tradingstate.TradingStateDB, orderBook common.Hash, order *tradingstate.OrderItem) ([]map[string]string, []*tradingstate.OrderItem, error) {
+func (BRCx *BRCX) CommitOrder(header *types.Header, coinbase common.Address, chain consensus.ChainContext, statedb *state.StateDB, tradingStateDB *tradingstate.TradingStateDB, orderBook common.Hash, order *tradingstate.OrderItem) ([]*tradingstate.TradeRecord, []*tradingstate.OrderItem, error) {
 	BRCxSnap := tradingStateDB.Snapshot()
 	dbSnap := statedb.Snapshot()
 	trades, rejects, err := BRCx.ApplyOrder(header, coinbase, chain, statedb, tradingStateDB, orderBook, order)
@@ -30,10 +29,10 @@ func (BRCx *BRCX) CommitOrder(header *types.Header, coinbase common.Address, cha
 	return trades, rejects, err
 }
 
-func (BRCx *BRCX) ApplyOrder(header *types.Header, coinbase common.Address, chain consensus.ChainContext, statedb *state.StateDB, tradingStateDB *tradingstate.TradingStateDB, orderBook common.Hash, order *tradingstate.OrderItem) ([]map[string]string, []*tradingstate.OrderItem, error) {
+func (BRCx *BRCX) ApplyOrder(header *types.Header, coinbase common.Address, chain consensus.ChainContext, statedb *state.StateDB, tradingStateDB *tradingstate.TradingStateDB, orderBook common.Hash, order *tradingstate.OrderItem) ([]*tradingstate.TradeRecord, []*tradingstate.OrderItem, error) {
 	var (
 		rejects []*tradingstate.OrderItem
-		trades  []map[string]string
+		trades  []*tradingstate.TradeRecord
 		err     error
 	)
 	nonce := tradingStateDB.GetNonce(order.UserAddress.Hash())
@@ -69,6 +68,12 @@ func (BRCx *BRCX) ApplyOrder(header *types.Header, coinbase common.Address, chai
 		}
 		return trades, rejects, nil
 	}
+	orderTypesEnabled := chain.Config().IsTIPBRCXOrderTypes(header.Number)
+	if tradingstate.AdvancedOrderType[order.Type] && !orderTypesEnabled {
+		log.Debug("Reject order type not enabled yet", "type", order.Type)
+		rejects = append(rejects, order)
+		return trades, rejects, nil
+	}
 	if order.Type != tradingstate.Market {
 		if order.Price.Sign() == 0 || common.BigToHash(order.Price).Big().Cmp(order.Price) != 0 {
 			log.Debug("Reject order price invalid", "price", order.Price)
@@ -88,7 +93,15 @@ func (BRCx *BRCX) ApplyOrder(header *types.Header, coinbase common.Address, chai
 		trades, rejects, err = BRCx.processMarketOrder(coinbase, chain, statedb, tradingStateDB, orderBook, order)
 		if err != nil {
 			log.Debug("Reject market order", "err", err, "order", tradingstate.ToJSON(order))
-			trades = []map[string]string{}
+			trades = []*tradingstate.TradeRecord{}
+			rejects = append(rejects, order)
+		}
+	} else if tradingstate.AdvancedOrderType[orderType] {
+		log.Debug("Process order", "type", orderType, "side", order.Side, "quantity", order.Quantity, "price", order.Price, "stopPrice", order.StopPrice)
+		trades, rejects, err = BRCx.processAdvancedOrder(coinbase, chain, statedb, tradingStateDB, orderBook, order)
+		if err != nil {
+			log.Debug("Reject order", "type", orderType, "err", err, "order", tradingstate.ToJSON(order))
+			trades = []*tradingstate.TradeRecord{}
 			rejects = append(rejects, order)
 		}
 	} else {
@@ -96,19 +109,157 @@ func (BRCx *BRCX) ApplyOrder(header *types.Header, coinbase common.Address, chai
 		trades, rejects, err = BRCx.processLimitOrder(coinbase, chain, statedb, tradingStateDB, orderBook, order)
 		if err != nil {
 			log.Debug("Reject limit order", "err", err, "order", tradingstate.ToJSON(order))
-			trades = []map[string]string{}
+			trades = []*tradingstate.TradeRecord{}
 			rejects = append(rejects, order)
 		}
 	}
+	if orderTypesEnabled && len(trades) > 0 {
+		stopTrades, stopRejects := BRCx.processTriggeredStopOrders(coinbase, chain, statedb, tradingStateDB, orderBook)
+		trades = append(trades, stopTrades...)
+		rejects = append(rejects, stopRejects...)
+	}
 
 	return trades, rejects, nil
 }
 
+// processAdvancedOrder : process the order types enabled at TIPBRCXOrderTypes
+func (BRCx *BRCX) processAdvancedOrder(coinbase common.Address, chain consensus.ChainContext, statedb *state.StateDB, tradingStateDB *tradingstate.TradingStateDB, orderBook common.Hash, order *tradingstate.OrderItem) ([]*tradingstate.TradeRecord, []*tradingstate.OrderItem, error) {
+	switch order.Type {
+	case tradingstate.PostOnly:
+		// a post-only order must rest in the book entirely, reject it if it would take liquidity
+		if order.Side == tradingstate.Bid {
+			minPrice, _ := tradingStateDB.GetBestAskPrice(orderBook)
+			if minPrice.Sign() > 0 && order.Price.Cmp(minPrice) >= 0 {
+				log.Debug("Reject post-only order crossing the book", "price", order.Price, "bestAsk", minPrice)
+				return nil, []*tradingstate.OrderItem{order}, nil
+			}
+		} else {
+			maxPrice, _ := tradingStateDB.GetBestBidPrice(orderBook)
+			if maxPrice.Sign() > 0 && order.Price.Cmp(maxPrice) <= 0 {
+				log.Debug("Reject post-only order crossing the book", "price", order.Price, "bestBid", maxPrice)
+				return nil, []*tradingstate.OrderItem{order}, nil
+			}
+		}
+		return BRCx.processLimitOrder(coinbase, chain, statedb, tradingStateDB, orderBook, order)
+	case tradingstate.ImmediateOrCancel, tradingstate.FillOrKill:
+		return BRCx.processImmediateOrder(coinbase, chain, statedb, tradingStateDB, orderBook, order)
+	case tradingstate.StopLimit:
+		if stopPriceReached(order.Side, order.StopPrice, tradingStateDB.GetLastPrice(orderBook)) {
+			// the stop price has already been reached, it is a limit order from now on
+			order.StopPrice = nil
+			return BRCx.processLimitOrder(coinbase, chain, statedb, tradingStateDB, orderBook, order)
+		}
+		orderId := tradingStateDB.GetNonce(orderBook)
+		order.OrderID = orderId + 1
+		tradingStateDB.SetNonce(orderBook, orderId+1)
+		orderIdHash := common.BigToHash(new(big.Int).SetUint64(order.OrderID))
+		tradingStateDB.InsertOrderItem(orderBook, orderIdHash, *order)
+		log.Debug("Stop order is added to the stop book", "side", order.Side, "stopPrice", order.StopPrice, "order", order)
+		return nil, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported order type: %s", order.Type)
+	}
+}
+
+// processImmediateOrder : process IOC and FOK orders, they never rest in the book.
+// The unmatched part of an IOC order is dropped, a FOK order which can not be matched
+// in full is rejected and leaves the book untouched
+func (BRCx *BRCX) processImmediateOrder(coinbase common.Address, chain consensus.ChainContext, statedb *state.StateDB, tradingStateDB *tradingstate.TradingStateDB, orderBook common.Hash, order *tradingstate.OrderItem) ([]*tradingstate.TradeRecord, []*tradingstate.OrderItem, error) {
+	BRCxSnap := tradingStateDB.Snapshot()
+	dbSnap := statedb.Snapshot()
+	_, trades, rejects, err := BRCx.matchLimitOrder(coinbase, chain, statedb, tradingStateDB, orderBook, order)
+	if err != nil {
+		return nil, nil, err
+	}
+	filledQuantity := new(big.Int)
+	for _, trade := range trades {
+		filledQuantity = tradingstate.Add(filledQuantity, trade.Quantity)
+	}
+	if order.Type == tradingstate.FillOrKill && filledQuantity.Cmp(order.Quantity) < 0 {
+		log.Debug("Reject fill-or-kill order", "quantity", order.Quantity, "filled", filledQuantity)
+		tradingStateDB.RevertToSnapshot(BRCxSnap)
+		statedb.RevertToSnapshot(dbSnap)
+		return nil, []*tradingstate.OrderItem{order}, nil
+	}
+	if filledQuantity.Sign() == 0 && !containsOrder(rejects, order) {
+		rejects = append(rejects, order)
+	}
+	return trades, rejects, nil
+}
+
+// processTriggeredStopOrders : move the stop orders reached by the last price of the
+// order book into the book as limit orders. Each triggered order may trade and move
+// the last price again, so it loops until no stop order is reached or the cap is hit
+func (BRCx *BRCX) processTriggeredStopOrders(coinbase common.Address, chain consensus.ChainContext, statedb *state.StateDB, tradingStateDB *tradingstate.TradingStateDB, orderBook common.Hash) ([]*tradingstate.TradeRecord, []*tradingstate.OrderItem) {
+	var (
+		trades  []*tradingstate.TradeRecord
+		rejects []*tradingstate.OrderItem
+	)
+	for i := 0; i < MaximumTriggeredStopOrders; i++ {
+		stopOrder, found := tradingStateDB.GetTriggeredStopOrder(orderBook, tradingStateDB.GetLastPrice(orderBook))
+		if !found {
+			break
+		}
+		BRCxSnap := tradingStateDB.Snapshot()
+		dbSnap := statedb.Snapshot()
+		order := &stopOrder
+		if err := tradingStateDB.CancelOrder(orderBook, order); err != nil {
+			log.Error("Failed to remove triggered stop order", "orderbook", orderBook.Hex(), "orderId", order.OrderID, "err", err)
+			tradingStateDB.RevertToSnapshot(BRCxSnap)
+			statedb.RevertToSnapshot(dbSnap)
+			break
+		}
+		order.StopPrice = nil
+		log.Debug("Process triggered stop order", "side", order.Side, "quantity", order.Quantity, "price", order.Price, "hash", order.Hash.Hex())
+		quantityToTrade, newTrades, newRejects, err := BRCx.matchLimitOrder(coinbase, chain, statedb, tradingStateDB, orderBook, order)
+		if err == nil && quantityToTrade.Sign() > 0 {
+			// the unmatched part rests in the book, keeping the order id it got in the stop book
+			order.Quantity = quantityToTrade
+			tradingStateDB.InsertOrderItem(orderBook, common.BigToHash(new(big.Int).SetUint64(order.OrderID)), *order)
+		}
+		if err != nil {
+			// the stop order can't be matched, drop it without touching the book
+			log.Debug("Reject triggered stop order", "err", err, "order", tradingstate.ToJSON(order))
+			tradingStateDB.RevertToSnapshot(BRCxSnap)
+			statedb.RevertToSnapshot(dbSnap)
+			if err := tradingStateDB.CancelOrder(orderBook, &stopOrder); err != nil {
+				break
+			}
+			rejects = append(rejects, order)
+			continue
+		}
+		trades = append(trades, newTrades...)
+		rejects = append(rejects, newRejects...)
+	}
+	return trades, rejects
+}
+
+// stopPriceReached returns true if the last price has reached the stop price:
+// stop buys trigger when the price rises to it, stop sells when the price falls to it
+func stopPriceReached(side string, stopPrice, lastPrice *big.Int) bool {
+	if stopPrice == nil || lastPrice == nil || lastPrice.Sign() <= 0 {
+		return false
+	}
+	if side == tradingstate.Bid {
+		return lastPrice.Cmp(stopPrice) >= 0
+	}
+	return lastPrice.Cmp(stopPrice) <= 0
+}
+
+func containsOrder(orders []*tradingstate.OrderItem, order *tradingstate.OrderItem) bool {
+	for _, o := range orders {
+		if o == order {
+			return true
+		}
+	}
+	return false
+}
+
 // processMarketOrder : process the market order
-func (BRCx *BRCX) processMarketOrder(coinbase common.Address, chain consensus.ChainContext, statedb *state.StateDB, tradingStateDB *tradingstate.TradingStateDB, orderBook common.Hash, order *tradingstate.OrderItem) ([]map[string]string, []*tradingstate.OrderItem, error) {
+func (BRCx *BRCX) processMarketOrder(coinbase common.Address, chain consensus.ChainContext, statedb *state.StateDB, tradingStateDB *tradingstate.TradingStateDB, orderBook common.Hash, order *tradingstate.OrderItem) ([]*tradingstate.TradeRecord, []*tradingstate.OrderItem, error) {
 	var (
-		trades     []map[string]string
-		newTrades  []map[string]string
+		trades     []*tradingstate.TradeRecord
+		newTrades  []*tradingstate.TradeRecord
 		rejects    []*tradingstate.OrderItem
 		newRejects []*tradingstate.OrderItem
 		err        error
@@ -149,10 +300,29 @@ func (BRCx *BRCX) processMarketOrder(coinbase common.Address, chain consensus.Ch
 
 // processLimitOrder : process the limit order, can change the quote
 // If not care for performance, we should make a copy of quote to prevent further reference problem
-func (BRCx *BRCX) processLimitOrder(coinbase common.Address, chain consensus.ChainContext, statedb *state.StateDB, tradingStateDB *tradingstate.TradingStateDB, orderBook common.Hash, order *tradingstate.OrderItem) ([]map[string]string, []*tradingstate.OrderItem, error) {
+func (BRCx *BRCX) processLimitOrder(coinbase common.Address, chain consensus.ChainContext, statedb *state.StateDB, tradingStateDB *tradingstate.TradingStateDB, orderBook common.Hash, order *tradingstate.OrderItem) ([]*tradingstate.TradeRecord, []*tradingstate.OrderItem, error) {
+	quantityToTrade, trades, rejects, err := BRCx.matchLimitOrder(coinbase, chain, statedb, tradingStateDB, orderBook, order)
+	if err != nil {
+		return nil, nil, err
+	}
+	if quantityToTrade.Cmp(tradingstate.Zero) > 0 {
+		orderId := tradingStateDB.GetNonce(orderBook)
+		order.OrderID = orderId + 1
+		order.Quantity = quantityToTrade
+		tradingStateDB.SetNonce(orderBook, orderId+1)
+		orderIdHash := common.BigToHash(new(big.Int).SetUint64(order.OrderID))
+		tradingStateDB.InsertOrderItem(orderBook, orderIdHash, *order)
+		log.Debug("After matching, order (unmatched part) is now added to tree", "side", order.Side, "order", order)
+	}
+	return trades, rejects, nil
+}
+
+// matchLimitOrder : match the limit order against the opposite side of the book up to its price,
+// returns the quantity left unmatched
+func (BRCx *BRCX) matchLimitOrder(coinbase common.Address, chain consensus.ChainContext, statedb *state.StateDB, tradingStateDB *tradingstate.TradingStateDB, orderBook common.Hash, order *tradingstate.OrderItem) (*big.Int, []*tradingstate.TradeRecord, []*tradingstate.OrderItem, error) {
 	var (
-		trades     []map[string]string
-		newTrades  []map[string]string
+		trades     []*tradingstate.TradeRecord
+		newTrades  []*tradingstate.TradeRecord
 		rejects    []*tradingstate.OrderItem
 		newRejects []*tradingstate.OrderItem
 		err        error
@@ -171,7 +341,7 @@ func (BRCx *BRCX) processLimitOrder(coinbase common.Address, chain consensus.Cha
 			log.Debug("Min price in asks tree", "price", minPrice.String())
 			quantityToTrade, newTrades, newRejects, err = BRCx.processOrderList(coinbase, chain, statedb, tradingStateDB, tradingstate.Ask, orderBook, minPrice, quantityToTrade, order)
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, nil, err
 			}
 			trades = append(trades, newTrades...)
 			rejects = append(rejects, newRejects...)
@@ -186,7 +356,7 @@ func (BRCx *BRCX) processLimitOrder(coinbase common.Address, chain consensus.Cha
 			log.Debug("Max price in bids tree", "price", maxPrice.String())
 			quantityToTrade, newTrades, newRejects, err = BRCx.processOrderList(coinbase, chain, statedb, tradingStateDB, tradingstate.Bid, orderBook, maxPrice, quantityToTrade, order)
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, nil, err
 			}
 			trades = append(trades, newTrades...)
 			rejects = append(rejects, newRejects...)
@@ -195,24 +365,15 @@ func (BRCx *BRCX) processLimitOrder(coinbase common.Address, chain consensus.Cha
 			log.Debug("processLimitOrder ", "side", side, "maxPrice", maxPrice, "orderPrice", price, "volume", volume)
 		}
 	}
-	if quantityToTrade.Cmp(zero) > 0 {
-		orderId := tradingStateDB.GetNonce(orderBook)
-		order.OrderID = orderId + 1
-		order.Quantity = quantityToTrade
-		tradingStateDB.SetNonce(orderBook, orderId+1)
-		orderIdHash := common.BigToHash(new(big.Int).SetUint64(order.OrderID))
-		tradingStateDB.InsertOrderItem(orderBook, orderIdHash, *order)
-		log.Debug("After matching, order (unmatched part) is now added to tree", "side", order.Side, "order", order)
-	}
-	return trades, rejects, nil
+	return quantityToTrade, trades, rejects, nil
 }
 
 // processOrderList : process the order list
-func (BRCx *BRCX) processOrderList(coinbase common.Address, chain consensus.ChainContext, statedb *state.StateDB, tradingStateDB *tradingstate.TradingStateDB, side string, orderBook common.Hash, price *big.Int, quantityStillToTrade *big.Int, order *tradingstate.OrderItem) (*big.Int, []map[string]string, []*tradingstate.OrderItem, error) {
+func (BRCx *BRCX) processOrderList(coinbase common.Address, chain consensus.ChainContext, statedb *state.StateDB, tradingStateDB *tradingstate.TradingStateDB, side string, orderBook common.Hash, price *big.Int, quantityStillToTrade *big.Int, order *tradingstate.OrderItem) (*big.Int, []*tradingstate.TradeRecord, []*tradingstate.OrderItem, error) {
 	quantityToTrade := tradingstate.CloneBigInt(quantityStillToTrade)
 	log.Debug("Process matching between order and orderlist", "quantityToTrade", quantityToTrade)
 	var (
-		trades []map[string]string
+		trades []*tradingstate.TradeRecord
 
 		rejects []*tradingstate.OrderItem
 	)
@@ -312,24 +473,30 @@ func (BRCx *BRCX) processOrderList(coinbase common.Address, chain consensus.Chai
 			log.Debug("Update quantity for orderId", "orderId", orderId.Hex())
 			log.Debug("TRADE", "orderBook", orderBook, "Taker price", price, "maker price", order.Price, "Amount", tradedQuantity, "orderId", orderId, "side", side)
 
-			tradeRecord := make(map[string]string)
-			tradeRecord[tradingstate.TradeTakerOrderHash] = order.Hash.Hex()
-			tradeRecord[tradingstate.TradeMakerOrderHash] = oldestOrder.Hash.Hex()
-			tradeRecord[tradingstate.TradeTimestamp] = strconv.FormatInt(time.Now().Unix(), 10)
-			tradeRecord[tradingstate.TradeQuantity] = tradedQuantity.String()
-			tradeRecord[tradingstate.TradeMakerExchange] = oldestOrder.ExchangeAddress.String()
-			tradeRecord[tradingstate.TradeMaker] = oldestOrder.UserAddress.String()
-			tradeRecord[tradingstate.TradeBaseToken] = oldestOrder.BaseToken.String()
-			tradeRecord[tradingstate.TradeQuoteToken] = oldestOrder.QuoteToken.String()
+			tradeRecord := &tradingstate.TradeRecord{
+				TakerOrderHash: order.Hash,
+				MakerOrderHash: oldestOrder.Hash,
+				MakerOrderID:   oldestOrder.OrderID,
+				Timestamp:      time.Now().Unix(),
+				Quantity:       tradedQuantity,
+				// maker price is actual price
+				// Taker price is offer price
+				// tradedPrice is always actual price
+				Price:          oldestOrder.Price,
+				Taker:          order.UserAddress,
+				TakerExchange:  order.ExchangeAddress,
+				Maker:          oldestOrder.UserAddress,
+				MakerExchange:  oldestOrder.ExchangeAddress,
+				BaseToken:      oldestOrder.BaseToken,
+				QuoteToken:     oldestOrder.QuoteToken,
+				TakerOrderSide: order.Side,
+				TakerOrderType: order.Type,
+				MakerOrderType: oldestOrder.Type,
+			}
 			if settleBalanceResult != nil {
-				tradeRecord[tradingstate.MakerFee] = settleBalanceResult.Maker.Fee.Text(10)
-				tradeRecord[tradingstate.TakerFee] = settleBalanceResult.Taker.Fee.Text(10)
+				tradeRecord.MakerFee = settleBalanceResult.Maker.Fee
+				tradeRecord.TakerFee = settleBalanceResult.Taker.Fee
 			}
-			// maker price is actual price
-			// Taker price is offer price
-			// tradedPrice is always actual price
-			tradeRecord[tradingstate.TradePrice] = oldestOrder.Price.String()
-			tradeRecord[tradingstate.MakerOrderType] = oldestOrder.Type
 			trades = append(trades, tradeRecord)
 
 			oldAveragePrice, oldTotalQuantity := tradingStateDB.GetMediumPriceAndTotalAmount(orderBook)
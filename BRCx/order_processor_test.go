@@ -4,10 +4,12 @@ import (
 	"math/big"
 	"reflect"
 	"testing"
+	"time"
 
 	"BRDPoSChain/BRCx/tradingstate"
 	"BRDPoSChain/common"
 	"BRDPoSChain/core/rawdb"
+	"BRDPoSChain/core/state"
 	"BRDPoSChain/core/types"
 )
 
@@ -574,3 +576,282 @@ func TestGetTradeQuantity(t *testing.T) {
 		})
 	}
 }
+
+func Test_stopPriceReached(t *testing.T) {
+	tests := []struct {
+		name      string
+		side      string
+		stopPrice *big.Int
+		lastPrice *big.Int
+		want      bool
+	}{
+		{"no last price", tradingstate.Bid, big.NewInt(100), nil, false},
+		{"zero last price", tradingstate.Ask, big.NewInt(100), common.Big0, false},
+		{"buy below stop", tradingstate.Bid, big.NewInt(100), big.NewInt(99), false},
+		{"buy at stop", tradingstate.Bid, big.NewInt(100), big.NewInt(100), true},
+		{"buy above stop", tradingstate.Bid, big.NewInt(100), big.NewInt(101), true},
+		{"sell above stop", tradingstate.Ask, big.NewInt(100), big.NewInt(101), false},
+		{"sell at stop", tradingstate.Ask, big.NewInt(100), big.NewInt(100), true},
+		{"sell below stop", tradingstate.Ask, big.NewInt(100), big.NewInt(99), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stopPriceReached(tt.side, tt.stopPrice, tt.lastPrice); got != tt.want {
+				t.Errorf("stopPriceReached() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessAdvancedOrder(t *testing.T) {
+	BRCx := New(&DefaultConfig)
+	db := rawdb.NewMemoryDatabase()
+	stateCache := tradingstate.NewDatabase(db)
+	tradingStateDb, _ := tradingstate.New(types.EmptyRootHash, stateCache)
+
+	orderBook := tradingstate.GetTradingOrderBookHash(common.HexToAddress("0x1000000000000000000000000000000000000002"), common.BRCNativeAddressBinary)
+	signature := &tradingstate.Signature{V: 1, R: common.HexToHash("111111"), S: common.HexToHash("222222222222")}
+	// resting ask at 100
+	ask := tradingstate.OrderItem{OrderID: 1, Type: tradingstate.Limit, Side: tradingstate.Ask, Price: big.NewInt(100), Quantity: big.NewInt(10), Signature: signature}
+	tradingStateDb.InsertOrderItem(orderBook, common.BigToHash(big.NewInt(1)), ask)
+	tradingStateDb.SetNonce(orderBook, 1)
+	tradingStateDb.SetLastPrice(orderBook, big.NewInt(90))
+
+	// post-only buy crossing the best ask is rejected
+	crossing := &tradingstate.OrderItem{Type: tradingstate.PostOnly, Side: tradingstate.Bid, Price: big.NewInt(100), Quantity: big.NewInt(1), Signature: signature}
+	trades, rejects, err := BRCx.processAdvancedOrder(common.Address{}, nil, nil, tradingStateDb, orderBook, crossing)
+	if err != nil || len(trades) != 0 || len(rejects) != 1 || rejects[0] != crossing {
+		t.Fatalf("crossing post-only order: trades %v , rejects %v , err %v", trades, rejects, err)
+	}
+
+	// post-only buy below the best ask rests in the book
+	resting := &tradingstate.OrderItem{Type: tradingstate.PostOnly, Side: tradingstate.Bid, Price: big.NewInt(95), Quantity: big.NewInt(1), Signature: signature}
+	trades, rejects, err = BRCx.processAdvancedOrder(common.Address{}, nil, nil, tradingStateDb, orderBook, resting)
+	if err != nil || len(trades) != 0 || len(rejects) != 0 {
+		t.Fatalf("resting post-only order: trades %v , rejects %v , err %v", trades, rejects, err)
+	}
+	if price, volume := tradingStateDb.GetBestBidPrice(orderBook); price.Cmp(big.NewInt(95)) != 0 || volume.Cmp(common.Big1) != 0 {
+		t.Fatalf("post-only order is not in the book: best bid %v , volume %v", price, volume)
+	}
+
+	// stop buy above the last price waits in the stop book
+	stop := &tradingstate.OrderItem{Type: tradingstate.StopLimit, Side: tradingstate.Bid, Price: big.NewInt(120), StopPrice: big.NewInt(110), Quantity: big.NewInt(2), Signature: signature}
+	trades, rejects, err = BRCx.processAdvancedOrder(common.Address{}, nil, nil, tradingStateDb, orderBook, stop)
+	if err != nil || len(trades) != 0 || len(rejects) != 0 {
+		t.Fatalf("stop order: trades %v , rejects %v , err %v", trades, rejects, err)
+	}
+	if price, _ := tradingStateDb.GetBestBidPrice(orderBook); price.Cmp(big.NewInt(95)) != 0 {
+		t.Fatalf("stop order is in the book: best bid %v", price)
+	}
+	if _, found := tradingStateDb.GetTriggeredStopOrder(orderBook, big.NewInt(109)); found {
+		t.Fatalf("stop order is triggered below its stop price")
+	}
+	triggered, found := tradingStateDb.GetTriggeredStopOrder(orderBook, big.NewInt(110))
+	if !found || triggered.OrderID != stop.OrderID {
+		t.Fatalf("stop order is not triggered at its stop price: got %d , want %d", triggered.OrderID, stop.OrderID)
+	}
+}
+
+var (
+	testBaseToken = common.HexToAddress("0x1000000000000000000000000000000000000002")
+	testRelayer   = common.HexToAddress("0x2000000000000000000000000000000000000001")
+	testSeller    = common.HexToAddress("0x3000000000000000000000000000000000000001")
+	testBuyer     = common.HexToAddress("0x3000000000000000000000000000000000000002")
+	testOrderHash uint64
+)
+
+// newMatchingTestState returns the states of a BRC pair with a relayer able to pay the
+// matching fees, a seller owning base tokens and a buyer owning BRC
+func newMatchingTestState(t *testing.T, BRCx *BRCX) (*state.StateDB, *tradingstate.TradingStateDB, common.Hash) {
+	db := rawdb.NewMemoryDatabase()
+	statedb, err := state.New(types.EmptyRootHash, state.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("failed to create state: %v", err)
+	}
+	tradingStateDb, err := tradingstate.New(types.EmptyRootHash, tradingstate.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("failed to create trading state: %v", err)
+	}
+	BRCx.SetTokenDecimal(testBaseToken, common.BasePrice)
+
+	relayerLoc := tradingstate.GetLocMappingAtKey(testRelayer.Hash(), tradingstate.RelayerMappingSlot["RELAYER_LIST"])
+	deposit := new(big.Int).Mul(common.BasePrice, big.NewInt(30000))
+	statedb.SetState(common.RelayerRegistrationSMC, common.BigToHash(new(big.Int).Add(relayerLoc, tradingstate.RelayerStructMappingSlot["_deposit"])), common.BigToHash(deposit))
+	statedb.SetState(common.RelayerRegistrationSMC, common.BigToHash(new(big.Int).Add(relayerLoc, tradingstate.RelayerStructMappingSlot["_owner"])), testRelayer.Hash())
+	statedb.AddBalance(common.RelayerRegistrationSMC, deposit)
+
+	statedb.SetNonce(testBaseToken, 1)
+	tradingstate.SetTokenBalance(testSeller, new(big.Int).Mul(common.BasePrice, big.NewInt(100)), testBaseToken, statedb)
+	statedb.AddBalance(testBuyer, new(big.Int).Mul(common.BasePrice, big.NewInt(1000)))
+
+	return statedb, tradingStateDb, tradingstate.GetTradingOrderBookHash(testBaseToken, common.BRCNativeAddressBinary)
+}
+
+// testOrder returns an order of the test pair, price and quantity are in whole tokens
+func testOrder(orderType, side string, price, quantity int64) *tradingstate.OrderItem {
+	order := &tradingstate.OrderItem{
+		Type:            orderType,
+		Side:            side,
+		Price:           new(big.Int).Mul(common.BasePrice, big.NewInt(price)),
+		Quantity:        new(big.Int).Mul(common.BasePrice, big.NewInt(quantity)),
+		FilledAmount:    new(big.Int),
+		BaseToken:       testBaseToken,
+		QuoteToken:      common.BRCNativeAddressBinary,
+		ExchangeAddress: testRelayer,
+		Signature:       &tradingstate.Signature{V: 1, R: common.HexToHash("111111"), S: common.HexToHash("222222222222")},
+	}
+	if side == tradingstate.Bid {
+		order.UserAddress = testBuyer
+	} else {
+		order.UserAddress = testSeller
+	}
+	testOrderHash++
+	order.Hash = common.BigToHash(new(big.Int).SetUint64(testOrderHash))
+	return order
+}
+
+func restOrder(t *testing.T, BRCx *BRCX, statedb *state.StateDB, tradingStateDb *tradingstate.TradingStateDB, orderBook common.Hash, order *tradingstate.OrderItem) {
+	trades, rejects, err := BRCx.processLimitOrder(common.Address{}, nil, statedb, tradingStateDb, orderBook, order)
+	if err != nil || len(trades) != 0 || len(rejects) != 0 {
+		t.Fatalf("failed to rest order: trades %v , rejects %v , err %v", trades, rejects, err)
+	}
+}
+
+func tradedQuantity(trades []*tradingstate.TradeRecord) *big.Int {
+	total := new(big.Int)
+	for _, trade := range trades {
+		total.Add(total, trade.Quantity)
+	}
+	return total
+}
+
+func TestProcessImmediateOrder(t *testing.T) {
+	BRCx := New(&DefaultConfig)
+	statedb, tradingStateDb, orderBook := newMatchingTestState(t, BRCx)
+	restOrder(t, BRCx, statedb, tradingStateDb, orderBook, testOrder(tradingstate.Limit, tradingstate.Ask, 1, 5))
+
+	// a fill-or-kill buy larger than the book is rejected and leaves the book and the balances untouched
+	buyerBalance := statedb.GetBalance(testBuyer)
+	fok := testOrder(tradingstate.FillOrKill, tradingstate.Bid, 1, 8)
+	trades, rejects, err := BRCx.processImmediateOrder(common.Address{}, nil, statedb, tradingStateDb, orderBook, fok)
+	if err != nil || len(trades) != 0 || len(rejects) != 1 || rejects[0] != fok {
+		t.Fatalf("unfillable fill-or-kill order: trades %v , rejects %v , err %v", trades, rejects, err)
+	}
+	if _, volume := tradingStateDb.GetBestAskPrice(orderBook); volume.Cmp(new(big.Int).Mul(common.BasePrice, big.NewInt(5))) != 0 {
+		t.Fatalf("fill-or-kill order changed the book: best ask volume %v", volume)
+	}
+	if balance := statedb.GetBalance(testBuyer); balance.Cmp(buyerBalance) != 0 {
+		t.Fatalf("fill-or-kill order changed the balance: have %v , want %v", balance, buyerBalance)
+	}
+
+	// an immediate-or-cancel buy takes the book and drops the rest
+	ioc := testOrder(tradingstate.ImmediateOrCancel, tradingstate.Bid, 1, 8)
+	trades, rejects, err = BRCx.processImmediateOrder(common.Address{}, nil, statedb, tradingStateDb, orderBook, ioc)
+	if err != nil || len(rejects) != 0 {
+		t.Fatalf("immediate-or-cancel order: rejects %v , err %v", rejects, err)
+	}
+	if filled := tradedQuantity(trades); filled.Cmp(new(big.Int).Mul(common.BasePrice, big.NewInt(5))) != 0 {
+		t.Fatalf("immediate-or-cancel order traded %v , want 5 tokens", filled)
+	}
+	if price, _ := tradingStateDb.GetBestAskPrice(orderBook); price.Sign() != 0 {
+		t.Fatalf("ask left in the book at %v", price)
+	}
+	if price, _ := tradingStateDb.GetBestBidPrice(orderBook); price.Sign() != 0 {
+		t.Fatalf("unmatched part of the immediate-or-cancel order rests in the book at %v", price)
+	}
+	if balance := tradingstate.GetTokenBalance(testBuyer, testBaseToken, statedb); balance.Cmp(new(big.Int).Mul(common.BasePrice, big.NewInt(5))) != 0 {
+		t.Fatalf("buyer received %v base tokens, want 5 tokens", balance)
+	}
+
+	// an immediate-or-cancel order finding nothing to match is rejected
+	ioc = testOrder(tradingstate.ImmediateOrCancel, tradingstate.Bid, 1, 1)
+	trades, rejects, err = BRCx.processImmediateOrder(common.Address{}, nil, statedb, tradingStateDb, orderBook, ioc)
+	if err != nil || len(trades) != 0 || len(rejects) != 1 || rejects[0] != ioc {
+		t.Fatalf("immediate-or-cancel order on an empty book: trades %v , rejects %v , err %v", trades, rejects, err)
+	}
+
+	// a fill-or-kill order the book can fill is matched in full
+	restOrder(t, BRCx, statedb, tradingStateDb, orderBook, testOrder(tradingstate.Limit, tradingstate.Ask, 2, 3))
+	fok = testOrder(tradingstate.FillOrKill, tradingstate.Bid, 2, 3)
+	trades, rejects, err = BRCx.processImmediateOrder(common.Address{}, nil, statedb, tradingStateDb, orderBook, fok)
+	if err != nil || len(rejects) != 0 || tradedQuantity(trades).Cmp(fok.Quantity) != 0 {
+		t.Fatalf("fillable fill-or-kill order: trades %v , rejects %v , err %v", trades, rejects, err)
+	}
+}
+
+func TestProcessTriggeredStopOrders(t *testing.T) {
+	BRCx := New(&DefaultConfig)
+	statedb, tradingStateDb, orderBook := newMatchingTestState(t, BRCx)
+	restOrder(t, BRCx, statedb, tradingStateDb, orderBook, testOrder(tradingstate.Limit, tradingstate.Ask, 2, 1))
+	restOrder(t, BRCx, statedb, tradingStateDb, orderBook, testOrder(tradingstate.Limit, tradingstate.Ask, 3, 2))
+
+	// a stop buy at 2 waits while the price is below
+	stop := testOrder(tradingstate.StopLimit, tradingstate.Bid, 3, 4)
+	stop.StopPrice = new(big.Int).Mul(common.BasePrice, big.NewInt(2))
+	if _, _, err := BRCx.processAdvancedOrder(common.Address{}, nil, statedb, tradingStateDb, orderBook, stop); err != nil {
+		t.Fatalf("failed to add stop order: %v", err)
+	}
+	if trades, rejects := BRCx.processTriggeredStopOrders(common.Address{}, nil, statedb, tradingStateDb, orderBook); len(trades) != 0 || len(rejects) != 0 {
+		t.Fatalf("stop order triggered without a trade: trades %v , rejects %v", trades, rejects)
+	}
+
+	// a trade at 2 triggers it, it takes the ask at 3 and rests for the rest
+	trades, rejects, err := BRCx.processLimitOrder(common.Address{}, nil, statedb, tradingStateDb, orderBook, testOrder(tradingstate.Limit, tradingstate.Bid, 2, 1))
+	if err != nil || len(trades) != 1 || len(rejects) != 0 {
+		t.Fatalf("trade at the stop price: trades %v , rejects %v , err %v", trades, rejects, err)
+	}
+	trades, rejects = BRCx.processTriggeredStopOrders(common.Address{}, nil, statedb, tradingStateDb, orderBook)
+	if len(trades) != 1 || len(rejects) != 0 {
+		t.Fatalf("triggered stop order: trades %v , rejects %v", trades, rejects)
+	}
+	if trades[0].TakerOrderHash != stop.Hash || trades[0].Quantity.Cmp(new(big.Int).Mul(common.BasePrice, big.NewInt(2))) != 0 {
+		t.Fatalf("invalid trade of the triggered stop order: %v", trades[0])
+	}
+	if price := tradingStateDb.GetLastPrice(orderBook); price.Cmp(new(big.Int).Mul(common.BasePrice, big.NewInt(3))) != 0 {
+		t.Fatalf("last price %v , want 3", price)
+	}
+	price, volume := tradingStateDb.GetBestBidPrice(orderBook)
+	if price.Cmp(stop.Price) != 0 || volume.Cmp(new(big.Int).Mul(common.BasePrice, big.NewInt(2))) != 0 {
+		t.Fatalf("unmatched part of the stop order is not in the book: best bid %v , volume %v", price, volume)
+	}
+	if _, found := tradingStateDb.GetTriggeredStopOrder(orderBook, tradingStateDb.GetLastPrice(orderBook)); found {
+		t.Fatalf("triggered stop order left in the stop book")
+	}
+}
+
+func TestSyncTradesToSDKNode(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.DataDir, cfg.DBEngine = t.TempDir(), "embedded"
+	BRCx := New(&cfg)
+	defer BRCx.GetMongoDB().Close()
+	defer BRCx.GetLevelDB().Close()
+
+	statedb, tradingStateDb, orderBook := newMatchingTestState(t, BRCx)
+	maker := testOrder(tradingstate.Limit, tradingstate.Ask, 1, 5)
+	restOrder(t, BRCx, statedb, tradingStateDb, orderBook, maker)
+	taker := testOrder(tradingstate.Limit, tradingstate.Bid, 1, 3)
+	trades, rejects, err := BRCx.processLimitOrder(common.Address{}, nil, statedb, tradingStateDb, orderBook, taker)
+	if err != nil || len(rejects) != 0 || len(trades) != 1 {
+		t.Fatalf("limit order: trades %v , rejects %v , err %v", trades, rejects, err)
+	}
+
+	txHash := common.HexToHash("0x100")
+	txMatchTime := time.Unix(1700000000, 0).UTC()
+	dirtyOrderCount := uint64(0)
+	if err := BRCx.SyncDataToSDKNode(taker, txHash, txMatchTime, statedb, trades, rejects, &dirtyOrderCount); err != nil {
+		t.Fatalf("failed to sync trades: %v", err)
+	}
+	records, err := BRCx.GetTradesByTxHash(txHash)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("stored trades: %v , err %v", records, err)
+	}
+	have, want := records[0], trades[0]
+	if have.TakerOrderHash != taker.Hash || have.MakerOrderHash != maker.Hash || have.Taker != testBuyer || have.Maker != testSeller ||
+		have.Quantity.Cmp(want.Quantity) != 0 || have.Price.Cmp(want.Price) != 0 || have.TakerFee.Cmp(want.TakerFee) != 0 || have.MakerFee.Cmp(want.MakerFee) != 0 ||
+		have.TakerOrderSide != tradingstate.Bid || have.Timestamp != txMatchTime.Unix() {
+		t.Fatalf("wrong stored trade %+v , want %+v", have, want)
+	}
+	if records, err := New(&DefaultConfig).GetTradesByTxHash(txHash); err != ErrNotSDKNode {
+		t.Fatalf("trades returned by a node which isn't a SDK node: %v , err %v", records, err)
+	}
+}
@@ -23,6 +23,12 @@ var (
 	Limit     = "LO"
 	Cancel    = "CANCELLED"
 	OrderNew  = "NEW"
+
+	// order types enabled at TIPBRCXOrderTypes
+	PostOnly          = "PO"  // limit order which is rejected instead of taking liquidity
+	ImmediateOrCancel = "IOC" // limit order whose unmatched part is dropped instead of resting
+	FillOrKill        = "FOK" // limit order which is rejected unless it is matched in full
+	StopLimit         = "SL"  // limit order which waits in the stop book until last price reaches StopPrice
 )
 
 var EmptyHash = common.Hash{}
@@ -50,11 +56,24 @@ var (
 	ErrInvalidOrderType = errors.New("verify order: unsupported order type")
 	ErrInvalidOrderSide = errors.New("verify order: invalid order side")
 	ErrInvalidStatus    = errors.New("verify order: invalid status")
+	ErrInvalidStopPrice = errors.New("verify order: invalid stop price")
 
 	// supported order types
 	MatchingOrderType = map[string]bool{
-		Market: true,
-		Limit:  true,
+		Market:            true,
+		Limit:             true,
+		PostOnly:          true,
+		ImmediateOrCancel: true,
+		FillOrKill:        true,
+		StopLimit:         true,
+	}
+
+	// order types which are only accepted after TIPBRCXOrderTypes
+	AdvancedOrderType = map[string]bool{
+		PostOnly:          true,
+		ImmediateOrCancel: true,
+		FillOrKill:        true,
+		StopLimit:         true,
 	}
 )
 
@@ -78,6 +97,11 @@ type tradingExchangeObject struct {
 	BidRoot                common.Hash // merkle root of the storage trie
 	OrderRoot              common.Hash
 	LiquidationPriceRoot   common.Hash
+	// stop orders waiting for their trigger, keyed by stop price.
+	// Both roots stay empty until the first stop order of the pair, so the
+	// encoding of exchanges created before TIPBRCXOrderTypes does not change
+	StopBuyRoot  common.Hash `rlp:"optional"`
+	StopSellRoot common.Hash `rlp:"optional"`
 }
 
 var (
@@ -116,7 +140,7 @@ type TxMatchBatch struct {
 }
 
 type MatchingResult struct {
-	Trades  []map[string]string
+	Trades  []*TradeRecord
 	Rejects []*OrderItem
 }
 
@@ -113,6 +113,14 @@ func (ch subAmountOrder) undo(s *TradingStateDB) {
 	stateOrderItem.setVolume(newAmount)
 	stateOrderList.insertOrderItem(s.db, ch.orderId, common.BigToHash(newAmount))
 	stateOrderList.AddVolume(ch.amount)
+	// an emptied price level is dropped from the price trie right away, write it back
+	// so the best price lookups see it before the state is finalised
+	switch ch.order.Side {
+	case Ask:
+		stateOrderBook.updateAsksTrie(s.db)
+	case Bid:
+		stateOrderBook.updateBidsTrie(s.db)
+	}
 }
 func (ch nonceChange) undo(s *TradingStateDB) {
 	s.SetNonce(ch.hash, ch.prev)
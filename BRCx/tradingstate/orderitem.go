@@ -44,6 +44,7 @@ type OrderItem struct {
 	UpdatedAt       time.Time      `json:"updatedAt,omitempty"`
 	OrderID         uint64         `json:"orderID,omitempty"`
 	ExtraData       string         `json:"extraData,omitempty"`
+	StopPrice       *big.Int       `json:"stopPrice,omitempty" rlp:"optional"`
 }
 
 // Signature struct
@@ -78,6 +79,7 @@ type OrderItemBSON struct {
 	UpdatedAt       time.Time        `json:"updatedAt,omitempty" bson:"updatedAt"`
 	OrderID         string           `json:"orderID,omitempty" bson:"orderID"`
 	ExtraData       string           `json:"extraData,omitempty" bson:"extraData"`
+	StopPrice       string           `json:"stopPrice,omitempty" bson:"stopPrice"`
 }
 
 func (o *OrderItem) GetBSON() (interface{}, error) {
@@ -104,6 +106,10 @@ func (o *OrderItem) GetBSON() (interface{}, error) {
 		or.FilledAmount = o.FilledAmount.String()
 	}
 
+	if o.StopPrice != nil {
+		or.StopPrice = o.StopPrice.String()
+	}
+
 	if o.Signature != nil {
 		or.Signature = &SignatureRecord{
 			V: o.Signature.V,
@@ -138,6 +144,7 @@ func (o *OrderItem) SetBSON(raw bson.Raw) error {
 		UpdatedAt       time.Time        `json:"updatedAt" bson:"updatedAt"`
 		OrderID         string           `json:"orderID" bson:"orderID"`
 		ExtraData       string           `json:"extraData,omitempty" bson:"extraData"`
+		StopPrice       string           `json:"stopPrice,omitempty" bson:"stopPrice"`
 	})
 
 	err := raw.Unmarshal(decoded)
@@ -169,6 +176,10 @@ func (o *OrderItem) SetBSON(raw bson.Raw) error {
 		o.Price = ToBigInt(decoded.Price)
 	}
 
+	if decoded.StopPrice != "" {
+		o.StopPrice = ToBigInt(decoded.StopPrice)
+	}
+
 	if decoded.Signature != nil {
 		o.Signature = &Signature{
 			V: byte(decoded.Signature.V),
@@ -208,11 +219,16 @@ func (o *OrderItem) VerifyOrder(state *state.StateDB) error {
 func (o *OrderItem) VerifyBasicOrderInfo() error {
 
 	if o.Status == OrderNew {
-		if o.Type == Limit {
+		if o.Type != Market {
 			if err := o.verifyPrice(); err != nil {
 				return err
 			}
 		}
+		if o.Type == StopLimit {
+			if err := o.verifyStopPrice(); err != nil {
+				return err
+			}
+		}
 		if err := o.verifyQuantity(); err != nil {
 			return err
 		}
@@ -253,6 +269,7 @@ func (o *OrderItem) verifySignature() error {
 
 	tx := types.NewOrderTransaction(uint64(n), o.Quantity, o.Price, o.ExchangeAddress, o.UserAddress,
 		o.BaseToken, o.QuoteToken, o.Status, o.Side, o.Type, o.Hash, o.OrderID)
+	tx.SetStopPrice(o.StopPrice)
 	tx.ImportSignature(V, R, S)
 	from, _ := types.OrderSender(types.OrderTxSigner{}, tx)
 	if from != tx.UserAddress() {
@@ -296,6 +313,31 @@ func (o *OrderItem) verifyPrice() error {
 	return nil
 }
 
+// verifyStopPrice make sure stop price of a stop-limit order is a positive number
+func (o *OrderItem) verifyStopPrice() error {
+	if o.StopPrice == nil || o.StopPrice.Sign() <= 0 {
+		log.Debug("Invalid stop price", "stopPrice", o.StopPrice)
+		return ErrInvalidStopPrice
+	}
+	return nil
+}
+
+// CanRest returns true if the unmatched part of the order is kept in the order book
+func (o *OrderItem) CanRest() bool {
+	switch o.Type {
+	case Limit, PostOnly, StopLimit:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsUntriggeredStopOrder returns true if the order is a stop-limit order which
+// still waits in the stop book. The stop price is cleared once it is triggered.
+func (o *OrderItem) IsUntriggeredStopOrder() bool {
+	return o.Type == StopLimit && o.StopPrice != nil && o.StopPrice.Sign() > 0
+}
+
 // verifyQuantity make sure quantity is a positive number
 func (o *OrderItem) verifyQuantity() error {
 	if o.Quantity == nil || o.Quantity.Cmp(big.NewInt(0)) <= 0 {
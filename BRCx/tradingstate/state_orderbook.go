@@ -50,6 +50,8 @@ type tradingExchanges struct {
 	bidsTrie             Trie // storage trie, which becomes non-nil on first access
 	ordersTrie           Trie // storage trie, which becomes non-nil on first access
 	liquidationPriceTrie Trie
+	stopBuysTrie         Trie // stop book, which becomes non-nil on first access
+	stopSellsTrie        Trie // stop book, which becomes non-nil on first access
 
 	stateAskObjects      map[common.Hash]*stateOrderList
 	stateAskObjectsDirty map[common.Hash]struct{}
@@ -63,6 +65,11 @@ type tradingExchanges struct {
 	liquidationPriceStates      map[common.Hash]*liquidationPriceState
 	liquidationPriceStatesDirty map[common.Hash]struct{}
 
+	stateStopBuyObjects       map[common.Hash]*stateOrderList
+	stateStopBuyObjectsDirty  map[common.Hash]struct{}
+	stateStopSellObjects      map[common.Hash]*stateOrderList
+	stateStopSellObjectsDirty map[common.Hash]struct{}
+
 	onDirty func(hash common.Hash) // Callback method to mark a state object newly dirty
 }
 
@@ -98,6 +105,9 @@ func (te *tradingExchanges) empty() bool {
 	if !te.data.LiquidationPriceRoot.IsZero() {
 		return false
 	}
+	if !te.data.StopBuyRoot.IsZero() || !te.data.StopSellRoot.IsZero() {
+		return false
+	}
 	return true
 }
 
@@ -115,6 +125,10 @@ func newStateExchanges(db *TradingStateDB, hash common.Hash, data tradingExchang
 		stateBidObjectsDirty:        make(map[common.Hash]struct{}),
 		stateOrderObjectsDirty:      make(map[common.Hash]struct{}),
 		liquidationPriceStatesDirty: make(map[common.Hash]struct{}),
+		stateStopBuyObjects:         make(map[common.Hash]*stateOrderList),
+		stateStopBuyObjectsDirty:    make(map[common.Hash]struct{}),
+		stateStopSellObjects:        make(map[common.Hash]*stateOrderList),
+		stateStopSellObjectsDirty:   make(map[common.Hash]struct{}),
 		onDirty:                     onDirty,
 	}
 }
@@ -358,6 +372,24 @@ func (te *tradingExchanges) deepCopy(db *TradingStateDB, onDirty func(hash commo
 	for price := range te.liquidationPriceStatesDirty {
 		stateExchanges.liquidationPriceStatesDirty[price] = struct{}{}
 	}
+	if te.stopBuysTrie != nil {
+		stateExchanges.stopBuysTrie = db.db.CopyTrie(te.stopBuysTrie)
+	}
+	if te.stopSellsTrie != nil {
+		stateExchanges.stopSellsTrie = db.db.CopyTrie(te.stopSellsTrie)
+	}
+	for price, stopObject := range te.stateStopBuyObjects {
+		stateExchanges.stateStopBuyObjects[price] = stopObject.deepCopy(db, stateExchanges.MarkStateStopBuyObjectDirty)
+	}
+	for price := range te.stateStopBuyObjectsDirty {
+		stateExchanges.stateStopBuyObjectsDirty[price] = struct{}{}
+	}
+	for price, stopObject := range te.stateStopSellObjects {
+		stateExchanges.stateStopSellObjects[price] = stopObject.deepCopy(db, stateExchanges.MarkStateStopSellObjectDirty)
+	}
+	for price := range te.stateStopSellObjectsDirty {
+		stateExchanges.stateStopSellObjectsDirty[price] = struct{}{}
+	}
 	return stateExchanges
 }
 
@@ -814,3 +846,215 @@ func (t *tradingExchanges) setLendingCount(volume *big.Int) {
 		t.onDirty = nil
 	}
 }
+
+func (t *tradingExchanges) getStopTrie(db Database, side string) Trie {
+	switch side {
+	case Bid:
+		if t.stopBuysTrie == nil {
+			var err error
+			t.stopBuysTrie, err = db.OpenStorageTrie(t.orderBookHash, t.data.StopBuyRoot)
+			if err != nil {
+				t.stopBuysTrie, _ = db.OpenStorageTrie(t.orderBookHash, types.EmptyRootHash)
+				t.setError(fmt.Errorf("can't create stop buys trie: %v", err))
+			}
+		}
+		return t.stopBuysTrie
+	default:
+		if t.stopSellsTrie == nil {
+			var err error
+			t.stopSellsTrie, err = db.OpenStorageTrie(t.orderBookHash, t.data.StopSellRoot)
+			if err != nil {
+				t.stopSellsTrie, _ = db.OpenStorageTrie(t.orderBookHash, types.EmptyRootHash)
+				t.setError(fmt.Errorf("can't create stop sells trie: %v", err))
+			}
+		}
+		return t.stopSellsTrie
+	}
+}
+
+// stopObjects returns the live and dirty stop order lists of the given side
+func (t *tradingExchanges) stopObjects(side string) (map[common.Hash]*stateOrderList, map[common.Hash]struct{}, func(price common.Hash)) {
+	if side == Bid {
+		return t.stateStopBuyObjects, t.stateStopBuyObjectsDirty, t.MarkStateStopBuyObjectDirty
+	}
+	return t.stateStopSellObjects, t.stateStopSellObjectsDirty, t.MarkStateStopSellObjectDirty
+}
+
+// MarkStateStopBuyObjectDirty adds the specified stop price to the dirty map of the stop buys book
+func (t *tradingExchanges) MarkStateStopBuyObjectDirty(price common.Hash) {
+	t.stateStopBuyObjectsDirty[price] = struct{}{}
+	if t.onDirty != nil {
+		t.onDirty(t.Hash())
+		t.onDirty = nil
+	}
+}
+
+// MarkStateStopSellObjectDirty adds the specified stop price to the dirty map of the stop sells book
+func (t *tradingExchanges) MarkStateStopSellObjectDirty(price common.Hash) {
+	t.stateStopSellObjectsDirty[price] = struct{}{}
+	if t.onDirty != nil {
+		t.onDirty(t.Hash())
+		t.onDirty = nil
+	}
+}
+
+// Retrieve the stop order list at the given stop price. Returns nil if not found.
+func (t *tradingExchanges) getStateStopOrderListObject(db Database, side string, price common.Hash) *stateOrderList {
+	objects, _, onDirty := t.stopObjects(side)
+	// Prefer 'live' objects.
+	if obj := objects[price]; obj != nil {
+		return obj
+	}
+	// Load the object from the database.
+	enc, err := t.getStopTrie(db, side).TryGet(price[:])
+	if len(enc) == 0 {
+		t.setError(err)
+		return nil
+	}
+	var data orderList
+	if err := rlp.DecodeBytes(enc, &data); err != nil {
+		log.Error("Failed to decode state stop order list object", "price", price, "err", err)
+		return nil
+	}
+	// Insert into the live set.
+	obj := newStateOrderList(t.db, side, t.orderBookHash, price, data, onDirty)
+	objects[price] = obj
+	return obj
+}
+
+func (t *tradingExchanges) createStateStopOrderListObject(db Database, side string, price common.Hash) (newobj *stateOrderList) {
+	objects, dirty, onDirty := t.stopObjects(side)
+	newobj = newStateOrderList(t.db, side, t.orderBookHash, price, orderList{Volume: Zero}, onDirty)
+	objects[price] = newobj
+	dirty[price] = struct{}{}
+	data, err := rlp.EncodeToBytes(newobj)
+	if err != nil {
+		panic(fmt.Errorf("can't encode stop order list object at %x: %v", price[:], err))
+	}
+	t.setError(t.getStopTrie(db, side).TryUpdate(price[:], data))
+	if t.onDirty != nil {
+		t.onDirty(t.Hash())
+		t.onDirty = nil
+	}
+	return newobj
+}
+
+// removeStateStopOrderListObject also drops the live object, so the stop trie
+// is read back correctly if the price is reused before the next Finalise
+func (t *tradingExchanges) removeStateStopOrderListObject(db Database, side string, stateOrderList *stateOrderList) {
+	objects, dirty, _ := t.stopObjects(side)
+	delete(objects, stateOrderList.price)
+	delete(dirty, stateOrderList.price)
+	t.setError(t.getStopTrie(db, side).TryDelete(stateOrderList.price[:]))
+}
+
+// getBestStopPrice returns the stop price which is reached first by the last price:
+// the lowest one for stop buys and the highest one for stop sells
+func (t *tradingExchanges) getBestStopPrice(db Database, side string) common.Hash {
+	var (
+		encKey, encValue []byte
+		err              error
+	)
+	if side == Bid {
+		encKey, encValue, err = t.getStopTrie(db, side).TryGetBestLeftKeyAndValue()
+	} else {
+		encKey, encValue, err = t.getStopTrie(db, side).TryGetBestRightKeyAndValue()
+	}
+	if err != nil {
+		log.Error("Failed find best stop price", "orderbook", t.orderBookHash.Hex(), "side", side)
+		return EmptyHash
+	}
+	if len(encKey) == 0 || len(encValue) == 0 {
+		return EmptyHash
+	}
+	price := common.BytesToHash(encKey)
+	objects, _, onDirty := t.stopObjects(side)
+	if _, exist := objects[price]; !exist {
+		var data orderList
+		if err := rlp.DecodeBytes(encValue, &data); err != nil {
+			log.Error("Failed to decode state get best stop price", "err", err)
+			return EmptyHash
+		}
+		objects[price] = newStateOrderList(t.db, side, t.orderBookHash, price, data, onDirty)
+	}
+	return price
+}
+
+// updateStopTrie writes cached stop book modifications into the stop trie of the given side.
+func (t *tradingExchanges) updateStopTrie(db Database, side string) Trie {
+	tr := t.getStopTrie(db, side)
+	objects, dirty, _ := t.stopObjects(side)
+	for price, orderList := range objects {
+		if _, isDirty := dirty[price]; isDirty {
+			delete(dirty, price)
+			if orderList.empty() {
+				t.setError(tr.TryDelete(price[:]))
+				continue
+			}
+			err := orderList.updateRoot(db)
+			if err != nil {
+				log.Warn("updateStopTrie updateRoot", "err", err, "price", price, "orderList", *orderList)
+			}
+			// Encoding []byte cannot fail, ok to ignore the error.
+			v, _ := rlp.EncodeToBytes(orderList)
+			t.setError(tr.TryUpdate(price[:], v))
+		}
+	}
+	return tr
+}
+
+// stopRoot keeps an empty stop book encoded as the zero hash, like exchanges
+// which never had a stop order
+func stopRoot(root common.Hash) common.Hash {
+	if root == EmptyRoot {
+		return EmptyHash
+	}
+	return root
+}
+
+// updateStopRoots only touches the stop books which have been opened, so that
+// exchanges without stop orders keep their encoding.
+func (t *tradingExchanges) updateStopRoots(db Database) {
+	if t.stopBuysTrie != nil {
+		t.data.StopBuyRoot = stopRoot(t.updateStopTrie(db, Bid).Hash())
+	}
+	if t.stopSellsTrie != nil {
+		t.data.StopSellRoot = stopRoot(t.updateStopTrie(db, Ask).Hash())
+	}
+}
+
+func (t *tradingExchanges) CommitStopTries(db Database) error {
+	onleaf := func(leaf []byte, parent common.Hash) error {
+		var orderList orderList
+		if err := rlp.DecodeBytes(leaf, &orderList); err != nil {
+			return nil
+		}
+		if orderList.Root != EmptyRoot {
+			db.TrieDB().Reference(orderList.Root, parent)
+		}
+		return nil
+	}
+	if t.stopBuysTrie != nil {
+		t.updateStopTrie(db, Bid)
+		if t.dbErr != nil {
+			return t.dbErr
+		}
+		root, err := t.stopBuysTrie.Commit(onleaf)
+		if err != nil {
+			return err
+		}
+		t.data.StopBuyRoot = stopRoot(root)
+	}
+	if t.stopSellsTrie != nil {
+		t.updateStopTrie(db, Ask)
+		if t.dbErr != nil {
+			return t.dbErr
+		}
+		root, err := t.stopSellsTrie.Commit(onleaf)
+		if err != nil {
+			return err
+		}
+		t.data.StopSellRoot = stopRoot(root)
+	}
+	return nil
+}
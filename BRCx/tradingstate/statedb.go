@@ -26,6 +26,7 @@ import (
 	"BRDPoSChain/common"
 	"BRDPoSChain/log"
 	"BRDPoSChain/rlp"
+	"BRDPoSChain/trie"
 )
 
 type revision struct {
@@ -190,13 +191,23 @@ func (t *TradingStateDB) InsertOrderItem(orderBook common.Hash, orderId common.H
 		stateExchange = t.createExchangeObject(orderBook)
 	}
 	var stateOrderList *stateOrderList
-	switch order.Side {
-	case Ask:
+	switch {
+	case order.IsUntriggeredStopOrder():
+		if order.Side != Ask && order.Side != Bid {
+			return
+		}
+		// waiting stop orders are kept in the stop book, keyed by stop price
+		stopPriceHash := common.BigToHash(order.StopPrice)
+		stateOrderList = stateExchange.getStateStopOrderListObject(t.db, order.Side, stopPriceHash)
+		if stateOrderList == nil {
+			stateOrderList = stateExchange.createStateStopOrderListObject(t.db, order.Side, stopPriceHash)
+		}
+	case order.Side == Ask:
 		stateOrderList = stateExchange.getStateOrderListAskObject(t.db, priceHash)
 		if stateOrderList == nil {
 			stateOrderList = stateExchange.createStateOrderListAskObject(t.db, priceHash)
 		}
-	case Bid:
+	case order.Side == Bid:
 		stateOrderList = stateExchange.getStateBidOrderListObject(t.db, priceHash)
 		if stateOrderList == nil {
 			stateOrderList = stateExchange.createStateBidOrderListObject(t.db, priceHash)
@@ -226,6 +237,34 @@ func (t *TradingStateDB) GetOrder(orderBook common.Hash, orderId common.Hash) Or
 	return stateOrderItem.data
 }
 
+// GetOrderRoot retrieves the root of the orders trie of the given order book
+// or empty if the order book is not found.
+func (t *TradingStateDB) GetOrderRoot(orderBook common.Hash) common.Hash {
+	stateObject := t.getStateExchangeObject(orderBook)
+	if stateObject == nil {
+		return common.Hash{}
+	}
+	return stateObject.data.OrderRoot
+}
+
+// GetOrderBookProof returns the Merkle proof of an order book in the trading state trie.
+func (t *TradingStateDB) GetOrderBookProof(orderBook common.Hash) ([][]byte, error) {
+	var proof trie.ProofList
+	err := t.trie.Prove(orderBook[:], 0, &proof)
+	return proof, err
+}
+
+// GetOrderProof returns the Merkle proof of an order in the orders trie of the order book.
+func (t *TradingStateDB) GetOrderProof(orderBook common.Hash, orderId common.Hash) ([][]byte, error) {
+	var proof trie.ProofList
+	stateObject := t.getStateExchangeObject(orderBook)
+	if stateObject == nil {
+		return proof, fmt.Errorf("not found orderBook: %v", orderBook.Hex())
+	}
+	err := stateObject.getOrdersTrie(t.db).Prove(orderId[:], 0, &proof)
+	return proof, err
+}
+
 func (t *TradingStateDB) SubAmountOrderItem(orderBook common.Hash, orderId common.Hash, price *big.Int, amount *big.Int, side string) error {
 	priceHash := common.BigToHash(price)
 	stateObject := t.GetOrNewStateExchangeObject(orderBook)
@@ -290,14 +329,18 @@ func (t *TradingStateDB) CancelOrder(orderBook common.Hash, order *OrderItem) er
 		return fmt.Errorf("empty OrderItem: order book: %s , order id : %s", orderBook, orderIdHash.Hex())
 	}
 	priceHash := common.BigToHash(stateOrderItem.data.Price)
+	isStopOrder := stateOrderItem.data.IsUntriggeredStopOrder()
 	var stateOrderList *stateOrderList
-	switch stateOrderItem.data.Side {
-	case Ask:
+	switch {
+	case stateOrderItem.data.Side != Ask && stateOrderItem.data.Side != Bid:
+		return fmt.Errorf("not found order.Side: %s", order.Side)
+	case isStopOrder:
+		priceHash = common.BigToHash(stateOrderItem.data.StopPrice)
+		stateOrderList = stateObject.getStateStopOrderListObject(t.db, stateOrderItem.data.Side, priceHash)
+	case stateOrderItem.data.Side == Ask:
 		stateOrderList = stateObject.getStateOrderListAskObject(t.db, priceHash)
-	case Bid:
-		stateOrderList = stateObject.getStateBidOrderListObject(t.db, priceHash)
 	default:
-		return fmt.Errorf("not found order.Side: %s", order.Side)
+		stateOrderList = stateObject.getStateBidOrderListObject(t.db, priceHash)
 	}
 	if stateOrderList == nil || stateOrderList.empty() {
 		return fmt.Errorf("empty OrderList: order book: %s , order id : %s , price : %s", orderBook, orderIdHash.Hex(), priceHash.Hex())
@@ -322,10 +365,12 @@ func (t *TradingStateDB) CancelOrder(orderBook common.Hash, order *OrderItem) er
 	stateOrderList.subVolume(currentAmount)
 	stateOrderList.removeOrderItem(t.db, orderIdHash)
 	if stateOrderList.empty() {
-		switch stateOrderItem.data.Side {
-		case Ask:
+		switch {
+		case isStopOrder:
+			stateObject.removeStateStopOrderListObject(t.db, stateOrderItem.data.Side, stateOrderList)
+		case stateOrderItem.data.Side == Ask:
 			stateObject.removeStateOrderListAskObject(t.db, stateOrderList)
-		case Bid:
+		case stateOrderItem.data.Side == Bid:
 			stateObject.removeStateOrderListBidObject(t.db, stateOrderList)
 		default:
 		}
@@ -333,6 +378,45 @@ func (t *TradingStateDB) CancelOrder(orderBook common.Hash, order *OrderItem) er
 	return nil
 }
 
+// GetTriggeredStopOrder returns the oldest stop order whose stop price has been
+// reached by the given last price. Stop buys are checked before stop sells so
+// that the trigger order is deterministic.
+func (t *TradingStateDB) GetTriggeredStopOrder(orderBook common.Hash, lastPrice *big.Int) (OrderItem, bool) {
+	stateObject := t.getStateExchangeObject(orderBook)
+	if stateObject == nil || lastPrice == nil || lastPrice.Sign() <= 0 {
+		return EmptyOrder, false
+	}
+	if stateObject.data.StopBuyRoot.IsZero() && stateObject.data.StopSellRoot.IsZero() && stateObject.stopBuysTrie == nil && stateObject.stopSellsTrie == nil {
+		return EmptyOrder, false
+	}
+	for _, side := range []string{Bid, Ask} {
+		stopPriceHash := stateObject.getBestStopPrice(t.db, side)
+		if stopPriceHash.IsZero() {
+			continue
+		}
+		stopPrice := new(big.Int).SetBytes(stopPriceHash.Bytes())
+		// stop buys trigger when the price rises to the stop price, stop sells when it falls to it
+		if (side == Bid && lastPrice.Cmp(stopPrice) < 0) || (side == Ask && lastPrice.Cmp(stopPrice) > 0) {
+			continue
+		}
+		stateOrderList := stateObject.getStateStopOrderListObject(t.db, side, stopPriceHash)
+		if stateOrderList == nil || stateOrderList.empty() {
+			continue
+		}
+		key, _, err := stateOrderList.getTrie(t.db).TryGetBestLeftKeyAndValue()
+		if err != nil || len(key) == 0 {
+			log.Error("Failed to get triggered stop order", "orderbook", orderBook.Hex(), "stopPrice", stopPrice, "err", err)
+			continue
+		}
+		stateOrderItem := stateObject.getStateOrderObject(t.db, common.BytesToHash(key))
+		if stateOrderItem == nil || stateOrderItem.empty() {
+			continue
+		}
+		return stateOrderItem.data, true
+	}
+	return EmptyOrder, false
+}
+
 func (t *TradingStateDB) GetVolume(orderBook common.Hash, price *big.Int, orderType string) *big.Int {
 	stateObject := t.GetOrNewStateExchangeObject(orderBook)
 	var volume *big.Int = nil
@@ -548,6 +632,7 @@ func (t *TradingStateDB) Finalise() {
 			stateObject.updateBidsRoot(t.db)
 			stateObject.updateOrdersRoot(t.db)
 			stateObject.updateLiquidationPriceRoot(t.db)
+			stateObject.updateStopRoots(t.db)
 			// Update the object in the main orderId trie.
 			t.updateStateExchangeObject(stateObject)
 			//delete(s.stateExhangeObjectsDirty, addr)
@@ -583,6 +668,9 @@ func (t *TradingStateDB) Commit() (root common.Hash, err error) {
 			if err := stateObject.CommitLiquidationPriceTrie(t.db); err != nil {
 				return EmptyHash, err
 			}
+			if err := stateObject.CommitStopTries(t.db); err != nil {
+				return EmptyHash, err
+			}
 			// Update the object in the main orderId trie.
 			t.updateStateExchangeObject(stateObject)
 			delete(t.stateExhangeObjectsDirty, addr)
@@ -606,6 +694,12 @@ func (t *TradingStateDB) Commit() (root common.Hash, err error) {
 		if exchange.LiquidationPriceRoot != EmptyRoot {
 			t.db.TrieDB().Reference(exchange.LiquidationPriceRoot, parent)
 		}
+		if !exchange.StopBuyRoot.IsZero() && exchange.StopBuyRoot != EmptyRoot {
+			t.db.TrieDB().Reference(exchange.StopBuyRoot, parent)
+		}
+		if !exchange.StopSellRoot.IsZero() && exchange.StopSellRoot != EmptyRoot {
+			t.db.TrieDB().Reference(exchange.StopSellRoot, parent)
+		}
 		return nil
 	})
 	log.Debug("Trading State Trie cache stats after commit", "root", root.Hex())
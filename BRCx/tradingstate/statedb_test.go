@@ -25,6 +25,10 @@ import (
 	"BRDPoSChain/common"
 	"BRDPoSChain/core/rawdb"
 	"BRDPoSChain/core/types"
+	"BRDPoSChain/crypto"
+	"BRDPoSChain/ethdb/memorydb"
+	"BRDPoSChain/rlp"
+	"BRDPoSChain/trie"
 )
 
 func TestEchangeStates(t *testing.T) {
@@ -266,6 +270,87 @@ func TestRevertStates(t *testing.T) {
 	db.Close()
 }
 
+func TestStopOrders(t *testing.T) {
+	orderBook := common.StringToHash("BTC/BRC")
+	stopOrders := []OrderItem{
+		{OrderID: 1, Type: StopLimit, Quantity: big.NewInt(1), Price: big.NewInt(120), StopPrice: big.NewInt(110), Side: Bid, Signature: &Signature{V: 1, R: common.HexToHash("111111"), S: common.HexToHash("222222222222")}},
+		{OrderID: 2, Type: StopLimit, Quantity: big.NewInt(2), Price: big.NewInt(130), StopPrice: big.NewInt(105), Side: Bid, Signature: &Signature{V: 1, R: common.HexToHash("111111"), S: common.HexToHash("222222222222")}},
+		{OrderID: 3, Type: StopLimit, Quantity: big.NewInt(3), Price: big.NewInt(80), StopPrice: big.NewInt(90), Side: Ask, Signature: &Signature{V: 1, R: common.HexToHash("111111"), S: common.HexToHash("222222222222")}},
+		{OrderID: 4, Type: StopLimit, Quantity: big.NewInt(4), Price: big.NewInt(85), StopPrice: big.NewInt(95), Side: Ask, Signature: &Signature{V: 1, R: common.HexToHash("111111"), S: common.HexToHash("222222222222")}},
+	}
+	// Create an empty statedb database
+	db := rawdb.NewMemoryDatabase()
+	stateCache := NewDatabase(db)
+	statedb, _ := New(types.EmptyRootHash, stateCache)
+	statedb.SetLastPrice(orderBook, big.NewInt(100))
+	rootWithoutStops := statedb.IntermediateRoot()
+
+	for _, order := range stopOrders {
+		statedb.InsertOrderItem(orderBook, common.BigToHash(new(big.Int).SetUint64(order.OrderID)), order)
+	}
+	// waiting stop orders are not part of the order book
+	if price, _ := statedb.GetBestBidPrice(orderBook); price.Sign() != 0 {
+		t.Fatalf("stop buy is in the bids tree: best bid %d", price)
+	}
+	if price, _ := statedb.GetBestAskPrice(orderBook); price.Sign() != 0 {
+		t.Fatalf("stop sell is in the asks tree: best ask %d", price)
+	}
+	root := statedb.IntermediateRoot()
+	statedb.Commit()
+	stateCache.TrieDB().Reference(root, common.Hash{})
+	statedb, err := New(root, stateCache)
+	if err != nil {
+		t.Fatalf("Error when get trie in database: %s , err: %v", root.Hex(), err)
+	}
+
+	tests := []struct {
+		lastPrice *big.Int
+		found     bool
+		orderId   uint64
+	}{
+		{big.NewInt(100), false, 0},
+		{big.NewInt(105), true, 2},
+		{big.NewInt(200), true, 2},
+		{big.NewInt(95), true, 4},
+		{big.NewInt(1), true, 4},
+	}
+	for _, test := range tests {
+		order, found := statedb.GetTriggeredStopOrder(orderBook, test.lastPrice)
+		if found != test.found || order.OrderID != test.orderId {
+			t.Fatalf("last price %d: got order %d (found %v), want order %d (found %v)", test.lastPrice, order.OrderID, found, test.orderId, test.found)
+		}
+	}
+
+	// cancel all stop orders, reverting the cancellation restores them
+	snap := statedb.Snapshot()
+	for i := range stopOrders {
+		if err := statedb.CancelOrder(orderBook, &stopOrders[i]); err != nil {
+			t.Fatalf("Error when cancel stop order %d: %v", stopOrders[i].OrderID, err)
+		}
+	}
+	if order, found := statedb.GetTriggeredStopOrder(orderBook, big.NewInt(1)); found {
+		t.Fatalf("cancelled stop order %d is still triggered", order.OrderID)
+	}
+	statedb.RevertToSnapshot(snap)
+	if order, found := statedb.GetTriggeredStopOrder(orderBook, big.NewInt(1)); !found || order.OrderID != 4 {
+		t.Fatalf("stop order is not restored after revert: got order %d (found %v)", order.OrderID, found)
+	}
+
+	// an emptied stop book encodes like an exchange which never had stop orders
+	for i := range stopOrders {
+		statedb.CancelOrder(orderBook, &stopOrders[i])
+	}
+	statedb.IntermediateRoot()
+	exchange := statedb.getStateExchangeObject(orderBook)
+	if !exchange.data.StopBuyRoot.IsZero() || !exchange.data.StopSellRoot.IsZero() {
+		t.Fatalf("stop roots are not reset: buy %s , sell %s", exchange.data.StopBuyRoot.Hex(), exchange.data.StopSellRoot.Hex())
+	}
+	if root == rootWithoutStops {
+		t.Fatalf("stop orders don't change the trading state root")
+	}
+	db.Close()
+}
+
 func TestDumpState(t *testing.T) {
 	orderBook := common.StringToHash("BTC/BRC")
 	numberOrder := 5
@@ -302,3 +387,61 @@ func TestDumpState(t *testing.T) {
 	fmt.Println("bidTrie", bidTrie)
 	db.Close()
 }
+
+func TestOrderProof(t *testing.T) {
+	orderBook := common.StringToHash("BTC/BRC")
+	order := OrderItem{OrderID: 1, Quantity: big.NewInt(10), Price: big.NewInt(100), Side: Ask, Signature: &Signature{V: 1, R: common.HexToHash("111111"), S: common.HexToHash("222222222222")}}
+	orderId := common.BigToHash(new(big.Int).SetUint64(order.OrderID))
+
+	stateCache := NewDatabase(rawdb.NewMemoryDatabase())
+	statedb, _ := New(types.EmptyRootHash, stateCache)
+	statedb.InsertOrderItem(orderBook, orderId, order)
+	root := statedb.IntermediateRoot()
+	statedb.Commit()
+	statedb, err := New(root, stateCache)
+	if err != nil {
+		t.Fatalf("Error when get trie in database: %s , err: %v", root.Hex(), err)
+	}
+
+	bookProof, err := statedb.GetOrderBookProof(orderBook)
+	if err != nil {
+		t.Fatalf("failed to prove order book: %v", err)
+	}
+	enc, err := trie.VerifyProof(root, orderBook[:], proofDb(bookProof))
+	if err != nil || len(enc) == 0 {
+		t.Fatalf("invalid order book proof: %v", err)
+	}
+	var exchange tradingExchangeObject
+	if err := rlp.DecodeBytes(enc, &exchange); err != nil {
+		t.Fatalf("failed to decode order book: %v", err)
+	}
+	if exchange.OrderRoot != statedb.GetOrderRoot(orderBook) {
+		t.Fatalf("order root mismatch: have %x, want %x", exchange.OrderRoot, statedb.GetOrderRoot(orderBook))
+	}
+	orderProof, err := statedb.GetOrderProof(orderBook, orderId)
+	if err != nil {
+		t.Fatalf("failed to prove order: %v", err)
+	}
+	enc, err = trie.VerifyProof(exchange.OrderRoot, orderId[:], proofDb(orderProof))
+	if err != nil || len(enc) == 0 {
+		t.Fatalf("invalid order proof: %v", err)
+	}
+	var proven OrderItem
+	if err := rlp.DecodeBytes(enc, &proven); err != nil {
+		t.Fatalf("failed to decode order: %v", err)
+	}
+	if proven.OrderID != order.OrderID || proven.Quantity.Cmp(order.Quantity) != 0 {
+		t.Fatalf("proven order mismatch: have %v, want %v", proven, order)
+	}
+	if _, err := statedb.GetOrderProof(common.StringToHash("ETH/BRC"), orderId); err == nil {
+		t.Fatalf("proved an order of a missing order book")
+	}
+}
+
+func proofDb(proof [][]byte) *memorydb.Database {
+	db := memorydb.New()
+	for _, node := range proof {
+		db.Put(crypto.Keccak256(node), node)
+	}
+	return db
+}
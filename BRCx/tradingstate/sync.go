@@ -0,0 +1,70 @@
+// Copyright 2015 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tradingstate
+
+import (
+	"BRDPoSChain/common"
+	"BRDPoSChain/ethdb"
+	"BRDPoSChain/rlp"
+	"BRDPoSChain/trie"
+)
+
+// NewStateSync create a new trading state trie download scheduler. Besides the
+// main exchange trie, it follows every order book, order, stop order and
+// liquidation price trie hanging off the exchange objects.
+func NewStateSync(root common.Hash, database ethdb.KeyValueReader, bloom *trie.SyncBloom) *trie.Sync {
+	var syncer *trie.Sync
+
+	addSubTrie := func(root common.Hash, parent common.Hash, callback trie.LeafCallback) {
+		if !root.IsZero() && root != EmptyRoot {
+			syncer.AddSubTrie(root, 64, parent, callback)
+		}
+	}
+	// Price levels of the order books point to the trie of their orders
+	orderListCallback := func(leaf []byte, parent common.Hash) error {
+		var list orderList
+		if err := rlp.DecodeBytes(leaf, &list); err != nil {
+			return err
+		}
+		addSubTrie(list.Root, parent, nil)
+		return nil
+	}
+	// Liquidation prices point to lending books, which point to their trades
+	liquidationPriceCallback := func(leaf []byte, parent common.Hash) error {
+		var list orderList
+		if err := rlp.DecodeBytes(leaf, &list); err != nil {
+			return err
+		}
+		addSubTrie(list.Root, parent, orderListCallback)
+		return nil
+	}
+	callback := func(leaf []byte, parent common.Hash) error {
+		var exchange tradingExchangeObject
+		if err := rlp.DecodeBytes(leaf, &exchange); err != nil {
+			return err
+		}
+		addSubTrie(exchange.AskRoot, parent, orderListCallback)
+		addSubTrie(exchange.BidRoot, parent, orderListCallback)
+		addSubTrie(exchange.StopBuyRoot, parent, orderListCallback)
+		addSubTrie(exchange.StopSellRoot, parent, orderListCallback)
+		addSubTrie(exchange.OrderRoot, parent, nil)
+		addSubTrie(exchange.LiquidationPriceRoot, parent, liquidationPriceCallback)
+		return nil
+	}
+	syncer = trie.NewSync(root, database, callback, bloom)
+	return syncer
+}
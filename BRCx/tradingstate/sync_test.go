@@ -0,0 +1,104 @@
+// Copyright 2015 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tradingstate
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/core/rawdb"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/ethdb/memorydb"
+	"BRDPoSChain/trie"
+)
+
+// Tests that the scheduler reconstructs a trading state together with all of
+// its order book, order and liquidation price tries.
+func TestStateSync(t *testing.T) {
+	// Create a trading state with a few order books to copy
+	db := rawdb.NewMemoryDatabase()
+	srcCache := NewDatabase(db)
+	statedb, _ := New(types.EmptyRootHash, srcCache)
+
+	for i := 0; i < 4; i++ {
+		orderBook := common.BigToHash(big.NewInt(int64(i + 1)))
+		statedb.SetNonce(orderBook, uint64(i+1))
+		statedb.SetLastPrice(orderBook, big.NewInt(int64(100*(i+1))))
+		for j := 0; j < 16; j++ {
+			side := Ask
+			if j%2 == 1 {
+				side = Bid
+			}
+			order := OrderItem{OrderID: uint64(j + 1), Quantity: big.NewInt(int64(j + 1)), Price: big.NewInt(int64(j/2 + 1)), Side: side, Signature: &Signature{V: 1, R: common.HexToHash("11"), S: common.HexToHash("22")}}
+			statedb.InsertOrderItem(orderBook, common.BigToHash(big.NewInt(int64(j+1))), order)
+		}
+		statedb.InsertLiquidationPrice(orderBook, big.NewInt(1), orderBook, 1)
+		statedb.InsertLiquidationPrice(orderBook, big.NewInt(2), orderBook, 2)
+	}
+	root, err := statedb.Commit()
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if err := srcCache.TrieDB().Commit(root, false); err != nil {
+		t.Fatalf("failed to flush state: %v", err)
+	}
+	// Sync the state into an empty database
+	dstDb := memorydb.New()
+	sched := NewStateSync(root, dstDb, trie.NewSyncBloom(1, memorydb.New()))
+
+	queue := append([]common.Hash{}, sched.Missing(10)...)
+	for len(queue) > 0 {
+		results := make([]trie.SyncResult, len(queue))
+		for i, hash := range queue {
+			data, err := srcCache.TrieDB().Node(hash)
+			if err != nil {
+				t.Fatalf("failed to retrieve node data for %x: %v", hash, err)
+			}
+			results[i] = trie.SyncResult{Hash: hash, Data: data}
+		}
+		if _, index, err := sched.Process(results); err != nil {
+			t.Fatalf("failed to process result #%d: %v", index, err)
+		}
+		batch := dstDb.NewBatch()
+		if err := sched.Commit(batch); err != nil {
+			t.Fatalf("failed to commit data: %v", err)
+		}
+		batch.Write()
+		queue = append(queue[:0], sched.Missing(10)...)
+	}
+	// Every node of the source state must have been retrieved
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+
+	for it.Next() {
+		if len(it.Key()) != common.HashLength {
+			continue
+		}
+		if blob, _ := dstDb.Get(it.Key()); !bytes.Equal(blob, it.Value()) {
+			t.Fatalf("node %x missing from synced state", it.Key())
+		}
+	}
+	dststate, err := New(root, NewDatabase(rawdb.NewDatabase(dstDb)))
+	if err != nil {
+		t.Fatalf("failed to open synced state: %v", err)
+	}
+	if price := dststate.GetLastPrice(common.BigToHash(big.NewInt(2))); price.Cmp(big.NewInt(200)) != 0 {
+		t.Errorf("last price mismatch: have %v, want %v", price, 200)
+	}
+}
@@ -11,21 +11,58 @@ import (
 
 const (
 	TradeStatusSuccess = "SUCCESS"
-
-	TradeTakerOrderHash = "takerOrderHash"
-	TradeMakerOrderHash = "makerOrderHash"
-	TradeTimestamp      = "timestamp"
-	TradeQuantity       = "quantity"
-	TradeMakerExchange  = "makerExAddr"
-	TradeMaker          = "uAddr"
-	TradeBaseToken      = "bToken"
-	TradeQuoteToken     = "qToken"
-	TradePrice          = "tradedPrice"
-	MakerOrderType      = "makerOrderType"
-	MakerFee            = "makerFee"
-	TakerFee            = "takerFee"
 )
 
+// TradeRecord is a trade produced by the matching engine. SDK nodes turn it
+// into a Trade once the block including it has been processed.
+type TradeRecord struct {
+	TakerOrderHash common.Hash    `json:"takerOrderHash"`
+	MakerOrderHash common.Hash    `json:"makerOrderHash"`
+	MakerOrderID   uint64         `json:"makerOrderID"`
+	Timestamp      int64          `json:"timestamp"`
+	Quantity       *big.Int       `json:"quantity"`
+	Price          *big.Int       `json:"tradedPrice"` // maker price, trades always happen at the maker price
+	Taker          common.Address `json:"taker"`
+	TakerExchange  common.Address `json:"takerExchange"`
+	Maker          common.Address `json:"maker"`
+	MakerExchange  common.Address `json:"makerExchange"`
+	BaseToken      common.Address `json:"baseToken"`
+	QuoteToken     common.Address `json:"quoteToken"`
+	TakerOrderSide string         `json:"takerOrderSide"`
+	TakerOrderType string         `json:"takerOrderType"`
+	MakerOrderType string         `json:"makerOrderType"`
+	MakerFee       *big.Int       `json:"makerFee"` // nil if the trade was not settled
+	TakerFee       *big.Int       `json:"takerFee"` // nil if the trade was not settled
+}
+
+// ToTrade converts the record into the trade stored by SDK nodes for the
+// matching transaction txHash processed at txMatchTime.
+func (t *TradeRecord) ToTrade(txHash common.Hash, txMatchTime time.Time) *Trade {
+	trade := &Trade{
+		Taker:          t.Taker,
+		Maker:          t.Maker,
+		BaseToken:      t.BaseToken,
+		QuoteToken:     t.QuoteToken,
+		MakerOrderHash: t.MakerOrderHash,
+		TakerOrderHash: t.TakerOrderHash,
+		MakerExchange:  t.MakerExchange,
+		TakerExchange:  t.TakerExchange,
+		TxHash:         txHash,
+		PricePoint:     t.Price,
+		Amount:         t.Quantity,
+		MakeFee:        t.MakerFee,
+		TakeFee:        t.TakerFee,
+		Status:         TradeStatusSuccess,
+		CreatedAt:      txMatchTime,
+		UpdatedAt:      txMatchTime,
+		TakerOrderSide: t.TakerOrderSide,
+		TakerOrderType: t.TakerOrderType,
+		MakerOrderType: t.MakerOrderType,
+	}
+	trade.Hash = trade.ComputeHash()
+	return trade
+}
+
 type Trade struct {
 	Taker          common.Address `json:"taker" bson:"taker"`
 	Maker          common.Address `json:"maker" bson:"maker"`
@@ -132,6 +169,29 @@ func (t *Trade) SetBSON(raw bson.Raw) error {
 	return nil
 }
 
+// Record converts a stored trade back into a trade record. The maker order id
+// isn't stored by SDK nodes, the timestamp is the time of the matching block.
+func (t *Trade) Record() *TradeRecord {
+	return &TradeRecord{
+		TakerOrderHash: t.TakerOrderHash,
+		MakerOrderHash: t.MakerOrderHash,
+		Timestamp:      t.CreatedAt.Unix(),
+		Quantity:       t.Amount,
+		Price:          t.PricePoint,
+		Taker:          t.Taker,
+		TakerExchange:  t.TakerExchange,
+		Maker:          t.Maker,
+		MakerExchange:  t.MakerExchange,
+		BaseToken:      t.BaseToken,
+		QuoteToken:     t.QuoteToken,
+		TakerOrderSide: t.TakerOrderSide,
+		TakerOrderType: t.TakerOrderType,
+		MakerOrderType: t.MakerOrderType,
+		MakerFee:       t.MakeFee,
+		TakerFee:       t.TakeFee,
+	}
+}
+
 // ComputeHash returns hashes the trade
 // The OrderHash, Amount, Taker and TradeNonce attributes must be
 // set before attempting to compute the trade orderBookHash
@@ -0,0 +1,584 @@
+package BRCxDAO
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"sync"
+
+	"BRDPoSChain/BRCx/tradingstate"
+	"BRDPoSChain/BRCxlending/lendingstate"
+	"BRDPoSChain/common"
+	"BRDPoSChain/common/lru"
+	"BRDPoSChain/core/rawdb"
+	"BRDPoSChain/ethdb"
+	"BRDPoSChain/log"
+)
+
+// Secondary indexes of the embedded database
+const (
+	IndexUserAddress = "userAddress" // user, taker/maker of trades, borrower/investor of lending trades
+	IndexPair        = "pair"        // see TradingPairIndex and LendingPairIndex
+	IndexStatus      = "status"
+	IndexTxHash      = "txHash"
+)
+
+var (
+	embeddedObjectPrefix = []byte("o") // embeddedObjectPrefix + collection + 0x00 + hash -> json of the object
+	embeddedIndexPrefix  = []byte("i") // embeddedIndexPrefix + collection + 0x00 + index + 0x00 + value + 0x00 + hash -> nil
+)
+
+// TradingPairIndex returns the value of IndexPair for orders and trades.
+func TradingPairIndex(baseToken, quoteToken common.Address) string {
+	return baseToken.Hex() + quoteToken.Hex()
+}
+
+// LendingPairIndex returns the value of IndexPair for lending items and trades.
+func LendingPairIndex(lendingToken common.Address, term uint64) string {
+	return lendingToken.Hex() + strconv.FormatUint(term, 10)
+}
+
+type embeddedOp struct {
+	collection string
+	hash       common.Hash
+	val        interface{}
+	upsert     bool // insert only if the object doesn't exist otherwise
+}
+
+// EmbeddedDatabase stores the data of SDK nodes in a local LevelDB, it keeps
+// the collections of MongoDatabase with secondary indexes by user address,
+// pair, status and tx hash.
+type EmbeddedDatabase struct {
+	db          ethdb.Database
+	emptyKey    []byte
+	cacheItems  *lru.Cache[string, interface{}] // Cache for reading
+	lock        sync.Mutex
+	bulk        []embeddedOp
+	lendingBulk []embeddedOp
+}
+
+// NewEmbeddedDatabase opens the embedded database in datadir.
+func NewEmbeddedDatabase(datadir string, cacheLimit int) (*EmbeddedDatabase, error) {
+	db, err := rawdb.NewLevelDBDatabase(datadir, 128, 1024, "", false)
+	if err != nil {
+		return nil, err
+	}
+	return newEmbeddedDatabase(db, cacheLimit), nil
+}
+
+func newEmbeddedDatabase(db ethdb.Database, cacheLimit int) *EmbeddedDatabase {
+	itemCacheLimit := defaultCacheLimit
+	if cacheLimit > 0 {
+		itemCacheLimit = cacheLimit
+	}
+	return &EmbeddedDatabase{
+		db:         db,
+		emptyKey:   EmptyKey(),
+		cacheItems: lru.NewCache[string, interface{}](itemCacheLimit),
+	}
+}
+
+// collectionOf returns the collection storing the given type of object, the
+// same collections as MongoDatabase.
+func collectionOf(val interface{}) string {
+	switch item := val.(type) {
+	case *tradingstate.OrderItem:
+		return ordersCollection
+	case *tradingstate.Trade:
+		return tradesCollection
+	case *tradingstate.EpochPriceItem:
+		return epochPriceCollection
+	case *lendingstate.LendingItem:
+		switch item.Type {
+		case lendingstate.Repay:
+			return lendingRepayCollection
+		case lendingstate.TopUp:
+			return lendingTopUpCollection
+		case lendingstate.Recall:
+			return lendingRecallCollection
+		default:
+			return lendingItemsCollection
+		}
+	case *lendingstate.LendingTrade:
+		return lendingTradesCollection
+	}
+	return ""
+}
+
+// indexValues returns the values of the secondary indexes of an object.
+func indexValues(val interface{}) map[string][]string {
+	switch item := val.(type) {
+	case *tradingstate.OrderItem:
+		return map[string][]string{
+			IndexUserAddress: {item.UserAddress.Hex()},
+			IndexPair:        {TradingPairIndex(item.BaseToken, item.QuoteToken)},
+			IndexStatus:      {item.Status},
+			IndexTxHash:      {item.TxHash.Hex()},
+		}
+	case *tradingstate.Trade:
+		return map[string][]string{
+			IndexUserAddress: {item.Taker.Hex(), item.Maker.Hex()},
+			IndexPair:        {TradingPairIndex(item.BaseToken, item.QuoteToken)},
+			IndexStatus:      {item.Status},
+			IndexTxHash:      {item.TxHash.Hex()},
+		}
+	case *lendingstate.LendingItem:
+		return map[string][]string{
+			IndexUserAddress: {item.UserAddress.Hex()},
+			IndexPair:        {LendingPairIndex(item.LendingToken, item.Term)},
+			IndexStatus:      {item.Status},
+			IndexTxHash:      {item.TxHash.Hex()},
+		}
+	case *lendingstate.LendingTrade:
+		return map[string][]string{
+			IndexUserAddress: {item.Borrower.Hex(), item.Investor.Hex()},
+			IndexPair:        {LendingPairIndex(item.LendingToken, item.Term)},
+			IndexStatus:      {item.Status},
+			IndexTxHash:      {item.TxHash.Hex()},
+		}
+	}
+	return nil
+}
+
+// newItem returns an empty object of the type stored in the collection.
+func newItem(collection string) interface{} {
+	switch collection {
+	case ordersCollection:
+		return new(tradingstate.OrderItem)
+	case tradesCollection:
+		return new(tradingstate.Trade)
+	case epochPriceCollection:
+		return new(tradingstate.EpochPriceItem)
+	case lendingItemsCollection, lendingRepayCollection, lendingTopUpCollection, lendingRecallCollection:
+		return new(lendingstate.LendingItem)
+	case lendingTradesCollection:
+		return new(lendingstate.LendingTrade)
+	}
+	return nil
+}
+
+// newList returns an empty typed list of the objects stored in the collection.
+func newList(collection string) interface{} {
+	switch collection {
+	case ordersCollection:
+		return []*tradingstate.OrderItem{}
+	case tradesCollection:
+		return []*tradingstate.Trade{}
+	case epochPriceCollection:
+		return []*tradingstate.EpochPriceItem{}
+	case lendingItemsCollection, lendingRepayCollection, lendingTopUpCollection, lendingRecallCollection:
+		return []*lendingstate.LendingItem{}
+	case lendingTradesCollection:
+		return []*lendingstate.LendingTrade{}
+	}
+	return nil
+}
+
+func appendItem(list interface{}, item interface{}) interface{} {
+	switch l := list.(type) {
+	case []*tradingstate.OrderItem:
+		return append(l, item.(*tradingstate.OrderItem))
+	case []*tradingstate.Trade:
+		return append(l, item.(*tradingstate.Trade))
+	case []*tradingstate.EpochPriceItem:
+		return append(l, item.(*tradingstate.EpochPriceItem))
+	case []*lendingstate.LendingItem:
+		return append(l, item.(*lendingstate.LendingItem))
+	case []*lendingstate.LendingTrade:
+		return append(l, item.(*lendingstate.LendingTrade))
+	}
+	return list
+}
+
+func embeddedObjectKey(collection string, hash common.Hash) []byte {
+	key := append(append([]byte{}, embeddedObjectPrefix...), collection...)
+	key = append(key, 0)
+	return append(key, hash.Bytes()...)
+}
+
+func embeddedIndexPrefixKey(collection, index, value string) []byte {
+	key := append(append([]byte{}, embeddedIndexPrefix...), collection...)
+	key = append(append(key, 0), index...)
+	key = append(append(key, 0), value...)
+	return append(key, 0)
+}
+
+func (db *EmbeddedDatabase) IsEmptyKey(key []byte) bool {
+	return len(key) == 0 || bytes.Equal(key, db.emptyKey)
+}
+
+func (db *EmbeddedDatabase) getCacheKey(key []byte) string {
+	return hex.EncodeToString(key)
+}
+
+// readObject loads an object of the collection, it returns nil if not found.
+func (db *EmbeddedDatabase) readObject(reader ethdb.KeyValueReader, collection string, hash common.Hash) (interface{}, error) {
+	key := embeddedObjectKey(collection, hash)
+	if ok, _ := reader.Has(key); !ok {
+		return nil, nil
+	}
+	data, err := reader.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	item := newItem(collection)
+	if err := json.Unmarshal(data, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// writeObject stores an object and updates its indexes, old is the stored
+// version of the object if any.
+func writeObject(batch ethdb.Batch, collection string, hash common.Hash, old interface{}, val interface{}) error {
+	if old != nil {
+		if err := deleteIndexes(batch, collection, hash, old); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	if err := batch.Put(embeddedObjectKey(collection, hash), data); err != nil {
+		return err
+	}
+	for index, values := range indexValues(val) {
+		for _, value := range values {
+			if err := batch.Put(append(embeddedIndexPrefixKey(collection, index, value), hash.Bytes()...), nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func deleteIndexes(batch ethdb.Batch, collection string, hash common.Hash, val interface{}) error {
+	for index, values := range indexValues(val) {
+		for _, value := range values {
+			if err := batch.Delete(append(embeddedIndexPrefixKey(collection, index, value), hash.Bytes()...)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (db *EmbeddedDatabase) HasObject(hash common.Hash, val interface{}) (bool, error) {
+	if db.IsEmptyKey(hash.Bytes()) {
+		return false, nil
+	}
+	cacheKey := db.getCacheKey(hash.Bytes())
+	if db.cacheItems.Contains(cacheKey) {
+		return true, nil
+	}
+	collection := collectionOf(val)
+	if collection == "" {
+		return false, nil
+	}
+	return db.db.Has(embeddedObjectKey(collection, hash))
+}
+
+func (db *EmbeddedDatabase) GetObject(hash common.Hash, val interface{}) (interface{}, error) {
+	if db.IsEmptyKey(hash.Bytes()) {
+		return nil, nil
+	}
+	cacheKey := db.getCacheKey(hash.Bytes())
+	if cached, ok := db.cacheItems.Get(cacheKey); ok {
+		return cached, nil
+	}
+	collection := collectionOf(val)
+	if collection == "" {
+		return nil, nil
+	}
+	item, err := db.readObject(db.db, collection, hash)
+	if err != nil || item == nil {
+		return nil, err
+	}
+	db.cacheItems.Add(cacheKey, item)
+	return item, nil
+}
+
+// PutObject queues the object in the current bulk, it's written by CommitBulk
+// or CommitLendingBulk.
+func (db *EmbeddedDatabase) PutObject(hash common.Hash, val interface{}) error {
+	cacheKey := db.getCacheKey(hash.Bytes())
+	db.cacheItems.Add(cacheKey, val)
+
+	op := embeddedOp{collection: collectionOf(val), hash: hash, val: val}
+	switch item := val.(type) {
+	case *tradingstate.Trade:
+	case *tradingstate.OrderItem:
+		op.upsert = item.Status != tradingstate.OrderStatusOpen
+	case *tradingstate.EpochPriceItem:
+		op.upsert = true
+	case *lendingstate.LendingTrade:
+		op.upsert = true
+	case *lendingstate.LendingItem:
+		switch item.Type {
+		case lendingstate.Repay, lendingstate.TopUp, lendingstate.Recall:
+			if item.Status != lendingstate.LendingStatusReject {
+				item.Status = item.Type
+			}
+		default:
+			op.upsert = item.Status != lendingstate.LendingStatusOpen
+		}
+	default:
+		log.Error("PutObject: unknown type of object", "val", val)
+		return nil
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	switch val.(type) {
+	case *lendingstate.LendingTrade, *lendingstate.LendingItem:
+		db.lendingBulk = append(db.lendingBulk, op)
+	default:
+		db.bulk = append(db.bulk, op)
+	}
+	return nil
+}
+
+func (db *EmbeddedDatabase) DeleteObject(hash common.Hash, val interface{}) error {
+	cacheKey := db.getCacheKey(hash.Bytes())
+	db.cacheItems.Remove(cacheKey)
+
+	collection := collectionOf(val)
+	if collection == "" {
+		return nil
+	}
+	old, err := db.readObject(db.db, collection, hash)
+	if err != nil || old == nil {
+		return err
+	}
+	batch := db.db.NewBatch()
+	if err := deleteIndexes(batch, collection, hash, old); err != nil {
+		return err
+	}
+	if err := batch.Delete(embeddedObjectKey(collection, hash)); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+func (db *EmbeddedDatabase) InitBulk() {
+	db.lock.Lock()
+	db.bulk = nil
+	db.lock.Unlock()
+}
+
+func (db *EmbeddedDatabase) InitLendingBulk() {
+	db.lock.Lock()
+	db.lendingBulk = nil
+	db.lock.Unlock()
+}
+
+// commit writes the queued objects in one batch. An object which already
+// exists is only replaced by an upsert, like the bulk of MongoDatabase.
+func (db *EmbeddedDatabase) commit(ops []embeddedOp) error {
+	var (
+		batch   = db.db.NewBatch()
+		written = make(map[string]interface{})
+	)
+	for _, op := range ops {
+		key := string(embeddedObjectKey(op.collection, op.hash))
+		old, ok := written[key]
+		if !ok {
+			var err error
+			if old, err = db.readObject(db.db, op.collection, op.hash); err != nil {
+				return err
+			}
+		}
+		if old != nil && !op.upsert {
+			continue
+		}
+		if err := writeObject(batch, op.collection, op.hash, old, op.val); err != nil {
+			return err
+		}
+		// keep a copy of the written version to update its indexes later
+		copied := newItem(op.collection)
+		data, _ := json.Marshal(op.val)
+		if err := json.Unmarshal(data, copied); err != nil {
+			return err
+		}
+		written[key] = copied
+	}
+	return batch.Write()
+}
+
+func (db *EmbeddedDatabase) CommitBulk() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	ops := db.bulk
+	db.bulk = nil
+	return db.commit(ops)
+}
+
+func (db *EmbeddedDatabase) CommitLendingBulk() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	ops := db.lendingBulk
+	db.lendingBulk = nil
+	return db.commit(ops)
+}
+
+// getListItemByIndex returns the objects of the collection whose index has the value.
+func (db *EmbeddedDatabase) getListItemByIndex(collection, index, value string) interface{} {
+	result := newList(collection)
+	it := db.db.NewIterator(embeddedIndexPrefixKey(collection, index, value), nil)
+	defer it.Release()
+	for it.Next() {
+		key := it.Key()
+		hash := common.BytesToHash(key[len(key)-common.HashLength:])
+		item, err := db.readObject(db.db, collection, hash)
+		if err != nil {
+			log.Error("failed to read indexed object", "collection", collection, "index", index, "hash", hash, "err", err)
+			continue
+		}
+		if item != nil {
+			result = appendItem(result, item)
+		}
+	}
+	return result
+}
+
+// GetListItemByIndex returns the objects of the type of val whose secondary
+// index has the given value, e.g. all orders of an user with IndexUserAddress.
+func (db *EmbeddedDatabase) GetListItemByIndex(index string, value string, val interface{}) interface{} {
+	collection := collectionOf(val)
+	if collection == "" {
+		log.Error("GetListItemByIndex: Unknown object type", "index", index, "object", val)
+		return nil
+	}
+	return db.getListItemByIndex(collection, index, value)
+}
+
+// DeleteItemByTxHash deletes all the objects of the type of val created by the tx.
+func (db *EmbeddedDatabase) DeleteItemByTxHash(txhash common.Hash, val interface{}) {
+	collection := collectionOf(val)
+	if collection == "" {
+		log.Error("DeleteItemByTxHash: Unknown object type", "txhash", txhash, "object", val)
+		return
+	}
+	var (
+		batch = db.db.NewBatch()
+		it    = db.db.NewIterator(embeddedIndexPrefixKey(collection, IndexTxHash, txhash.Hex()), nil)
+	)
+	defer it.Release()
+	for it.Next() {
+		key := it.Key()
+		hash := common.BytesToHash(key[len(key)-common.HashLength:])
+		old, err := db.readObject(db.db, collection, hash)
+		if err != nil || old == nil {
+			continue
+		}
+		db.cacheItems.Remove(db.getCacheKey(hash.Bytes()))
+		if err := deleteIndexes(batch, collection, hash, old); err != nil {
+			log.Error("DeleteItemByTxHash: failed to delete indexes", "txhash", txhash, "err", err)
+			return
+		}
+		if err := batch.Delete(embeddedObjectKey(collection, hash)); err != nil {
+			log.Error("DeleteItemByTxHash: failed to delete item", "txhash", txhash, "err", err)
+			return
+		}
+	}
+	if err := batch.Write(); err != nil {
+		log.Error("DeleteItemByTxHash: failed to delete items", "txhash", txhash, "err", err)
+	}
+}
+
+func (db *EmbeddedDatabase) GetListItemByTxHash(txhash common.Hash, val interface{}) interface{} {
+	return db.GetListItemByIndex(IndexTxHash, txhash.Hex(), val)
+}
+
+func (db *EmbeddedDatabase) GetListItemByHashes(hashes []string, val interface{}) interface{} {
+	collection := collectionOf(val)
+	if collection == "" {
+		log.Error("GetListItemByHashes: Unknown object type", "hashes", hashes, "object", val)
+		return nil
+	}
+	result := newList(collection)
+	for _, hash := range hashes {
+		item, err := db.readObject(db.db, collection, common.HexToHash(hash))
+		if err != nil {
+			log.Error("failed to GetListItemByHashes", "collection", collection, "hash", hash, "err", err)
+			continue
+		}
+		if item != nil {
+			result = appendItem(result, item)
+		}
+	}
+	return result
+}
+
+func (db *EmbeddedDatabase) Put(key []byte, val []byte) error {
+	return db.db.Put(key, val)
+}
+
+func (db *EmbeddedDatabase) Delete(key []byte) error {
+	return db.db.Delete(key)
+}
+
+func (db *EmbeddedDatabase) Has(key []byte) (bool, error) {
+	return db.db.Has(key)
+}
+
+func (db *EmbeddedDatabase) Get(key []byte) ([]byte, error) {
+	return db.db.Get(key)
+}
+
+func (db *EmbeddedDatabase) Close() error {
+	return db.db.Close()
+}
+
+func (db *EmbeddedDatabase) NewBatch() ethdb.Batch {
+	return db.db.NewBatch()
+}
+
+// HasAncient returns an error as we don't have a backing chain freezer.
+func (db *EmbeddedDatabase) HasAncient(kind string, number uint64) (bool, error) {
+	return false, errNotSupported
+}
+
+// Ancient returns an error as we don't have a backing chain freezer.
+func (db *EmbeddedDatabase) Ancient(kind string, number uint64) ([]byte, error) {
+	return nil, errNotSupported
+}
+
+// Ancients returns an error as we don't have a backing chain freezer.
+func (db *EmbeddedDatabase) Ancients() (uint64, error) {
+	return 0, errNotSupported
+}
+
+// AncientSize returns an error as we don't have a backing chain freezer.
+func (db *EmbeddedDatabase) AncientSize(kind string) (uint64, error) {
+	return 0, errNotSupported
+}
+
+// AppendAncient returns an error as we don't have a backing chain freezer.
+func (db *EmbeddedDatabase) AppendAncient(number uint64, hash, header, body, receipts, td []byte) error {
+	return errNotSupported
+}
+
+// TruncateAncients returns an error as we don't have a backing chain freezer.
+func (db *EmbeddedDatabase) TruncateAncients(items uint64) error {
+	return errNotSupported
+}
+
+// Sync returns an error as we don't have a backing chain freezer.
+func (db *EmbeddedDatabase) Sync() error {
+	return errNotSupported
+}
+
+func (db *EmbeddedDatabase) NewIterator(prefix []byte, start []byte) ethdb.Iterator {
+	return db.db.NewIterator(prefix, start)
+}
+
+func (db *EmbeddedDatabase) Stat(property string) (string, error) {
+	return db.db.Stat(property)
+}
+
+func (db *EmbeddedDatabase) Compact(start []byte, limit []byte) error {
+	return db.db.Compact(start, limit)
+}
@@ -0,0 +1,134 @@
+package BRCxDAO
+
+import (
+	"math/big"
+	"testing"
+
+	"BRDPoSChain/BRCx/tradingstate"
+	"BRDPoSChain/BRCxlending/lendingstate"
+	"BRDPoSChain/common"
+)
+
+func TestEmbeddedDatabaseOrders(t *testing.T) {
+	db, err := NewEmbeddedDatabase(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var (
+		user   = common.HexToAddress("0x1")
+		base   = common.HexToAddress("0x2")
+		quote  = common.HexToAddress("0x3")
+		txHash = common.HexToHash("0x100")
+		pair   = TradingPairIndex(base, quote)
+	)
+	order := func(hash int64, status string) *tradingstate.OrderItem {
+		return &tradingstate.OrderItem{
+			Hash:        common.BigToHash(big.NewInt(hash)),
+			TxHash:      txHash,
+			UserAddress: user,
+			BaseToken:   base,
+			QuoteToken:  quote,
+			Status:      status,
+			Quantity:    big.NewInt(hash),
+		}
+	}
+
+	db.InitBulk()
+	db.PutObject(order(1, tradingstate.OrderStatusOpen).Hash, order(1, tradingstate.OrderStatusOpen))
+	db.PutObject(order(2, tradingstate.OrderStatusOpen).Hash, order(2, tradingstate.OrderStatusOpen))
+	// inserting an open order again doesn't replace it
+	db.PutObject(order(2, tradingstate.OrderStatusOpen).Hash, &tradingstate.OrderItem{Hash: order(2, "").Hash, Status: tradingstate.OrderStatusOpen})
+	// an updated order replaces the stored one
+	db.PutObject(order(2, tradingstate.OrderStatusFilled).Hash, order(2, tradingstate.OrderStatusFilled))
+	if orders := db.GetListItemByTxHash(txHash, &tradingstate.OrderItem{}).([]*tradingstate.OrderItem); len(orders) != 0 {
+		t.Fatalf("orders are visible before commit: %v", orders)
+	}
+	if err := db.CommitBulk(); err != nil {
+		t.Fatal(err)
+	}
+
+	if orders := db.GetListItemByTxHash(txHash, &tradingstate.OrderItem{}).([]*tradingstate.OrderItem); len(orders) != 2 {
+		t.Fatalf("wrong orders by tx hash: %v", orders)
+	}
+	if orders := db.GetListItemByIndex(IndexUserAddress, user.Hex(), &tradingstate.OrderItem{}).([]*tradingstate.OrderItem); len(orders) != 2 {
+		t.Fatalf("wrong orders by user: %v", orders)
+	}
+	if orders := db.GetListItemByIndex(IndexPair, pair, &tradingstate.OrderItem{}).([]*tradingstate.OrderItem); len(orders) != 2 {
+		t.Fatalf("wrong orders by pair: %v", orders)
+	}
+	open := db.GetListItemByIndex(IndexStatus, tradingstate.OrderStatusOpen, &tradingstate.OrderItem{}).([]*tradingstate.OrderItem)
+	if len(open) != 1 || open[0].Hash != order(1, "").Hash {
+		t.Fatalf("wrong open orders: %v", open)
+	}
+	filled := db.GetListItemByIndex(IndexStatus, tradingstate.OrderStatusFilled, &tradingstate.OrderItem{}).([]*tradingstate.OrderItem)
+	if len(filled) != 1 || filled[0].Hash != order(2, "").Hash || filled[0].Quantity.Cmp(big.NewInt(2)) != 0 {
+		t.Fatalf("wrong filled orders: %v", filled)
+	}
+	hashes := []string{order(1, "").Hash.Hex(), order(3, "").Hash.Hex()}
+	if orders := db.GetListItemByHashes(hashes, &tradingstate.OrderItem{}).([]*tradingstate.OrderItem); len(orders) != 1 {
+		t.Fatalf("wrong orders by hashes: %v", orders)
+	}
+
+	// read without the cache
+	db.cacheItems.Purge()
+	if ok, err := db.HasObject(order(1, "").Hash, &tradingstate.OrderItem{}); !ok || err != nil {
+		t.Fatalf("order not found: %v", err)
+	}
+	val, err := db.GetObject(order(2, "").Hash, &tradingstate.OrderItem{})
+	if err != nil || val.(*tradingstate.OrderItem).Status != tradingstate.OrderStatusFilled {
+		t.Fatalf("wrong order: %v , err %v", val, err)
+	}
+
+	if err := db.DeleteObject(order(1, "").Hash, &tradingstate.OrderItem{}); err != nil {
+		t.Fatal(err)
+	}
+	if orders := db.GetListItemByIndex(IndexStatus, tradingstate.OrderStatusOpen, &tradingstate.OrderItem{}).([]*tradingstate.OrderItem); len(orders) != 0 {
+		t.Fatalf("deleted order is still indexed: %v", orders)
+	}
+	db.DeleteItemByTxHash(txHash, &tradingstate.OrderItem{})
+	if orders := db.GetListItemByIndex(IndexUserAddress, user.Hex(), &tradingstate.OrderItem{}).([]*tradingstate.OrderItem); len(orders) != 0 {
+		t.Fatalf("orders of the tx are not deleted: %v", orders)
+	}
+}
+
+func TestEmbeddedDatabaseTrades(t *testing.T) {
+	db, err := NewEmbeddedDatabase(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var (
+		taker  = common.HexToAddress("0x1")
+		maker  = common.HexToAddress("0x2")
+		txHash = common.HexToHash("0x100")
+	)
+	trade := &tradingstate.Trade{Hash: common.HexToHash("0x1"), TxHash: txHash, Taker: taker, Maker: maker, Status: tradingstate.TradeStatusSuccess}
+	db.InitBulk()
+	db.PutObject(trade.Hash, trade)
+	if err := db.CommitBulk(); err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []common.Address{taker, maker} {
+		if trades := db.GetListItemByIndex(IndexUserAddress, user.Hex(), &tradingstate.Trade{}).([]*tradingstate.Trade); len(trades) != 1 {
+			t.Fatalf("wrong trades of %v : %v", user, trades)
+		}
+	}
+
+	// lending items are stored in the collection of their type
+	repay := &lendingstate.LendingItem{Hash: common.HexToHash("0x2"), TxHash: txHash, Type: lendingstate.Repay, UserAddress: taker}
+	db.InitLendingBulk()
+	db.PutObject(repay.Hash, repay)
+	if err := db.CommitLendingBulk(); err != nil {
+		t.Fatal(err)
+	}
+	if items := db.GetListItemByTxHash(txHash, &lendingstate.LendingItem{}).([]*lendingstate.LendingItem); len(items) != 0 {
+		t.Fatalf("repay found in lending items: %v", items)
+	}
+	items := db.GetListItemByTxHash(txHash, &lendingstate.LendingItem{Type: lendingstate.Repay}).([]*lendingstate.LendingItem)
+	if len(items) != 1 || items[0].Status != lendingstate.Repay {
+		t.Fatalf("wrong repay items: %v", items)
+	}
+}
@@ -166,7 +166,7 @@ func (db *BatchDatabase) Sync() error {
 }
 
 func (db *BatchDatabase) NewIterator(prefix []byte, start []byte) ethdb.Iterator {
-	panic("NewIterator from BRCxDAO leveldb is not supported")
+	return db.db.NewIterator(prefix, start)
 }
 
 func (db *BatchDatabase) Stat(property string) (string, error) {
@@ -33,6 +33,8 @@ const (
 var (
 	ErrNonceTooHigh = errors.New("nonce too high")
 	ErrNonceTooLow  = errors.New("nonce too low")
+
+	ErrNotLiquidationBlock = errors.New("lending trades are not liquidated at this block")
 )
 
 type Lending struct {
@@ -805,10 +807,11 @@ func (l *Lending) RollbackLendingData(txhash common.Hash) error {
 	return nil
 }
 
-func (l *Lending) ProcessLiquidationData(header *types.Header, chain consensus.ChainContext, statedb *state.StateDB, tradingState *tradingstate.TradingStateDB, lendingState *lendingstate.LendingStateDB) (updatedTrades map[common.Hash]*lendingstate.LendingTrade, liquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades []*lendingstate.LendingTrade, err error) {
+func (l *Lending) ProcessLiquidationData(header *types.Header, chain consensus.ChainContext, statedb *state.StateDB, tradingState *tradingstate.TradingStateDB, lendingState *lendingstate.LendingStateDB) (updatedTrades map[common.Hash]*lendingstate.LendingTrade, liquidatedTrades, partiallyLiquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades []*lendingstate.LendingTrade, err error) {
 	time := header.Time
-	updatedTrades = map[common.Hash]*lendingstate.LendingTrade{} // sum of liquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades
+	updatedTrades = map[common.Hash]*lendingstate.LendingTrade{} // sum of liquidatedTrades, partiallyLiquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades
 	liquidatedTrades = []*lendingstate.LendingTrade{}
+	partiallyLiquidatedTrades = []*lendingstate.LendingTrade{}
 	autoRepayTrades = []*lendingstate.LendingTrade{}
 	autoTopUpTrades = []*lendingstate.LendingTrade{}
 	autoRecallTrades = []*lendingstate.LendingTrade{}
@@ -816,12 +819,18 @@ func (l *Lending) ProcessLiquidationData(header *types.Header, chain consensus.C
 	allPairs, err := lendingstate.GetAllLendingPairs(statedb)
 	if err != nil {
 		log.Debug("Not found all trading pairs", "error", err)
-		return updatedTrades, liquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades, nil
+		return updatedTrades, liquidatedTrades, partiallyLiquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades, nil
 	}
 	allLendingBooks, err := lendingstate.GetAllLendingBooks(statedb)
 	if err != nil {
 		log.Debug("Not found all lending books", "error", err)
-		return updatedTrades, liquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades, nil
+		return updatedTrades, liquidatedTrades, partiallyLiquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades, nil
+	}
+
+	// the keeper reward of partial liquidations goes to the block producer if no liquidator is set
+	liquidator := common.LendingLiquidator
+	if liquidator == (common.Address{}) {
+		liquidator = header.Coinbase
 	}
 
 	// liquidate trades by time
@@ -834,7 +843,7 @@ func (l *Lending) ProcessLiquidationData(header *types.Header, chain consensus.C
 				trade, err := l.ProcessRepayLendingTrade(header, chain, lendingState, statedb, tradingState, lendingBook, tradingId.Big().Uint64())
 				if err != nil {
 					log.Error("Fail when process payment ", "time", time, "lendingBook", lendingBook.Hex(), "tradingId", tradingId, "error", err)
-					return updatedTrades, liquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades, err
+					return updatedTrades, liquidatedTrades, partiallyLiquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades, err
 				}
 				if trade != nil && trade.Hash != (common.Hash{}) {
 					updatedTrades[trade.Hash] = trade
@@ -857,7 +866,16 @@ func (l *Lending) ProcessLiquidationData(header *types.Header, chain consensus.C
 			// ignore this pair, do not throw error
 			continue
 		}
-		// liquidate trades
+		// liquidate trades, only the collateral needed to restore the deposit rate after TIPBRCXPartialLiquidation
+		var collateralTokenDecimal *big.Int
+		partialLiquidation := chain.Config().IsTIPBRCXPartialLiquidation(header.Number)
+		if partialLiquidation {
+			collateralTokenDecimal, err = l.BRCx.GetTokenDecimal(chain, statedb, lendingPair.CollateralToken)
+			if err != nil || collateralTokenDecimal.Sign() == 0 {
+				log.Error("Fail when get token decimal of collateral", "CollateralToken", lendingPair.CollateralToken.Hex(), "error", err)
+				partialLiquidation = false
+			}
+		}
 		highestLiquidatePrice, liquidationData := tradingState.GetHighestLiquidationPriceData(orderbook, collateralPrice)
 		for highestLiquidatePrice.Sign() > 0 && collateralPrice.Cmp(highestLiquidatePrice) < 0 {
 			for lendingBook, tradingIds := range liquidationData {
@@ -872,11 +890,25 @@ func (l *Lending) ProcessLiquidationData(header *types.Header, chain consensus.C
 							continue
 						}
 					}
+					if partialLiquidation {
+						newTrade, err := l.PartialLiquidationTrade(lendingState, statedb, tradingState, lendingBook, tradingIdHash.Big().Uint64(), collateralPrice, collateralTokenDecimal, liquidator)
+						if err != nil {
+							log.Error("Fail when partially liquidate trade", "time", time, "lendingBook", lendingBook.Hex(), "tradingIdHash", tradingIdHash.Hex(), "error", err)
+							return updatedTrades, liquidatedTrades, partiallyLiquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades, err
+						}
+						if newTrade != nil {
+							log.Debug("PartialLiquidationTrade", "borrower", newTrade.Borrower.Hex(), "tradingIdHash", tradingIdHash.Hex(), "newAmount", newTrade.Amount, "newLockedAmount", newTrade.CollateralLockedAmount)
+							partiallyLiquidatedTrades = append(partiallyLiquidatedTrades, newTrade)
+							updatedTrades[newTrade.Hash] = newTrade
+							continue
+						}
+						// selling a part of the collateral doesn't restore the deposit rate, liquidate the whole trade
+					}
 					log.Debug("LiquidationTrade", "highestLiquidatePrice", highestLiquidatePrice, "lendingBook", lendingBook.Hex(), "tradingIdHash", tradingIdHash.Hex())
 					newTrade, err := l.LiquidationTrade(lendingState, statedb, tradingState, lendingBook, tradingIdHash.Big().Uint64())
 					if err != nil {
 						log.Error("Fail when remove liquidation newTrade", "time", time, "lendingBook", lendingBook.Hex(), "tradingIdHash", tradingIdHash.Hex(), "error", err)
-						return updatedTrades, liquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades, err
+						return updatedTrades, liquidatedTrades, partiallyLiquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades, err
 					}
 					if newTrade != nil && newTrade.Hash != (common.Hash{}) {
 						newTrade.Status = lendingstate.TradeStatusLiquidated
@@ -914,7 +946,7 @@ func (l *Lending) ProcessLiquidationData(header *types.Header, chain consensus.C
 							_, newTrade, err := l.ProcessRecallLendingTrade(lendingState, statedb, tradingState, lendingBook, tradingIdHash, newLiquidatePrice)
 							if err != nil {
 								log.Error("ProcessRecallLendingTrade", "lendingBook", lendingBook.Hex(), "tradingIdHash", tradingIdHash.Hex(), "newLiquidatePrice", newLiquidatePrice, "err", err)
-								return updatedTrades, liquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades, err
+								return updatedTrades, liquidatedTrades, partiallyLiquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades, err
 							}
 							// if this action complete successfully, do not liquidate this trade in this epoch
 							log.Debug("AutoRecall", "borrower", trade.Borrower.Hex(), "collateral", newTrade.CollateralToken.Hex(), "lendingBook", lendingBook.Hex(), "tradingIdHash", tradingIdHash.Hex(), "newLockedAmount", newTrade.CollateralLockedAmount)
@@ -927,6 +959,6 @@ func (l *Lending) ProcessLiquidationData(header *types.Header, chain consensus.C
 		}
 	}
 
-	log.Debug("ProcessLiquidationData", "updatedTrades", len(updatedTrades), "liquidated", len(liquidatedTrades), "autoRepay", len(autoRepayTrades), "autoTopUp", len(autoTopUpTrades), "autoRecall", len(autoRecallTrades))
-	return updatedTrades, liquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades, nil
+	log.Debug("ProcessLiquidationData", "updatedTrades", len(updatedTrades), "liquidated", len(liquidatedTrades), "partiallyLiquidated", len(partiallyLiquidatedTrades), "autoRepay", len(autoRepayTrades), "autoTopUp", len(autoTopUpTrades), "autoRecall", len(autoRecallTrades))
+	return updatedTrades, liquidatedTrades, partiallyLiquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades, nil
 }
@@ -41,8 +41,9 @@ type lendingObject struct {
 
 // liquidation reasons
 const (
-	LiquidatedByTime  = uint64(0)
-	LiquidatedByPrice = uint64(1)
+	LiquidatedByTime    = uint64(0)
+	LiquidatedByPrice   = uint64(1)
+	LiquidatedPartially = uint64(2) // by price, after TIPBRCXPartialLiquidation
 )
 
 type LiquidationData struct {
@@ -50,6 +51,8 @@ type LiquidationData struct {
 	LiquidationAmount *big.Int
 	CollateralPrice   *big.Int
 	Reason            uint64
+	RepayAmount       *big.Int `json:",omitempty"` // lending token repaid by a partial liquidation
+	KeeperReward      *big.Int `json:",omitempty"` // collateral paid to the liquidator by a partial liquidation
 }
 
 var (
@@ -89,12 +92,13 @@ type MatchingResult struct {
 }
 
 type FinalizedResult struct {
-	Liquidated []common.Hash
-	AutoRepay  []common.Hash
-	AutoTopUp  []common.Hash
-	AutoRecall []common.Hash
-	TxHash     common.Hash
-	Timestamp  int64
+	Liquidated          []common.Hash
+	PartiallyLiquidated []common.Hash `json:",omitempty"` // trades left open by a partial liquidation, since TIPBRCXPartialLiquidation
+	AutoRepay           []common.Hash
+	AutoTopUp           []common.Hash
+	AutoRecall          []common.Hash
+	TxHash              common.Hash
+	Timestamp           int64
 }
 
 // use orderHash instead of tradeId
@@ -205,8 +209,9 @@ func WeiToEther(amount *big.Int) *big.Int {
 	return new(big.Int).Div(amount, new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil))
 }
 
-func EncodeFinalizedResult(liquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades []*LendingTrade) ([]byte, error) {
+func EncodeFinalizedResult(liquidatedTrades, partiallyLiquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades []*LendingTrade) ([]byte, error) {
 	liquidatedHashes := []common.Hash{}
+	var partiallyLiquidatedHashes []common.Hash
 	autoRepayHashes := []common.Hash{}
 	autoTopUpHashes := []common.Hash{}
 	autoRecallHashes := []common.Hash{}
@@ -214,6 +219,9 @@ func EncodeFinalizedResult(liquidatedTrades, autoRepayTrades, autoTopUpTrades, a
 	for _, trade := range liquidatedTrades {
 		liquidatedHashes = append(liquidatedHashes, trade.Hash)
 	}
+	for _, trade := range partiallyLiquidatedTrades {
+		partiallyLiquidatedHashes = append(partiallyLiquidatedHashes, trade.Hash)
+	}
 	for _, trade := range autoRepayTrades {
 		autoRepayHashes = append(autoRepayHashes, trade.Hash)
 	}
@@ -224,11 +232,12 @@ func EncodeFinalizedResult(liquidatedTrades, autoRepayTrades, autoTopUpTrades, a
 		autoRecallHashes = append(autoRecallHashes, trade.Hash)
 	}
 	result := FinalizedResult{
-		Liquidated: liquidatedHashes,
-		AutoRepay:  autoRepayHashes,
-		AutoTopUp:  autoTopUpHashes,
-		AutoRecall: autoRecallHashes,
-		Timestamp:  time.Now().UnixNano(),
+		Liquidated:          liquidatedHashes,
+		PartiallyLiquidated: partiallyLiquidatedHashes,
+		AutoRepay:           autoRepayHashes,
+		AutoTopUp:           autoTopUpHashes,
+		AutoRecall:          autoRecallHashes,
+		Timestamp:           time.Now().UnixNano(),
 	}
 	data, err := json.Marshal(result)
 	if err != nil || data == nil {
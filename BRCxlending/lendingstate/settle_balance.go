@@ -255,3 +255,45 @@ func CalculateTotalRepayValue(finalizeTime, liquidationTime, term uint64, apr ui
 	paymentBalance = new(big.Int).Div(paymentBalance, baseInterestDecimal)
 	return paymentBalance
 }
+
+// CalculatePartialLiquidation returns the collateral sold to the investor, the lending token it repays
+// and the collateral paid to the liquidator to bring a trade back to its deposit rate at collateralPrice.
+// depositRate and rewardRate are in percent.
+// Selling V_sold of the collateral value repays V_sold and costs V_sold * (1 + reward) of collateral:
+// (collateralValue - V_sold * (1 + reward)) = depositRate * (amount - V_sold)
+// => V_sold = (depositRate * amount - collateralValue) / (depositRate - 1 - reward)
+// ok is false if the trade can't be restored by selling only a part of its collateral.
+func CalculatePartialLiquidation(amount, collateralLockedAmount, collateralPrice, collateralTokenDecimal, depositRate, rewardRate *big.Int) (liquidationAmount, repayAmount, rewardAmount *big.Int, ok bool) {
+	if collateralPrice == nil || collateralPrice.Sign() <= 0 || amount == nil || amount.Sign() <= 0 {
+		return nil, nil, nil, false
+	}
+	base := common.BaseLiquidationReward
+	// collateralValue = collateralLockedAmount * collateralPrice / collateralTokenDecimal
+	collateralValue := new(big.Int).Mul(collateralLockedAmount, collateralPrice)
+	collateralValue = new(big.Int).Div(collateralValue, collateralTokenDecimal)
+
+	numerator := new(big.Int).Mul(depositRate, amount)
+	numerator = new(big.Int).Sub(numerator, new(big.Int).Mul(base, collateralValue))
+	denominator := new(big.Int).Sub(depositRate, base)
+	denominator = new(big.Int).Sub(denominator, rewardRate)
+	if numerator.Sign() <= 0 || denominator.Sign() <= 0 {
+		return nil, nil, nil, false
+	}
+	// round up, the trade must not be left below the deposit rate
+	repayAmount = ceilDiv(numerator, denominator)
+	liquidationAmount = ceilDiv(new(big.Int).Mul(repayAmount, collateralTokenDecimal), collateralPrice)
+	rewardAmount = new(big.Int).Mul(liquidationAmount, rewardRate)
+	rewardAmount = new(big.Int).Div(rewardAmount, base)
+	if repayAmount.Cmp(amount) >= 0 || new(big.Int).Add(liquidationAmount, rewardAmount).Cmp(collateralLockedAmount) >= 0 {
+		return nil, nil, nil, false
+	}
+	return liquidationAmount, repayAmount, rewardAmount, true
+}
+
+func ceilDiv(x, y *big.Int) *big.Int {
+	z, m := new(big.Int).DivMod(x, y, new(big.Int))
+	if m.Sign() > 0 {
+		z.Add(z, common.Big1)
+	}
+	return z
+}
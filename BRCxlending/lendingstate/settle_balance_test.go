@@ -460,3 +460,47 @@ func TestCalculateTotalRepayValue(t *testing.T) {
 		})
 	}
 }
+
+func TestCalculatePartialLiquidation(t *testing.T) {
+	decimal := common.BasePrice
+	amount := new(big.Int).Mul(big.NewInt(1000), decimal)
+	tests := []struct {
+		name           string
+		lockedAmount   int64 // collateral tokens, price is 1 lending token
+		rewardRate     int64
+		ok             bool
+		wantAmount     int64 // lending tokens left
+		wantLockedLeft int64 // collateral tokens left
+	}{
+		// collateral value 1300 , deposit rate 150%
+		// sold = (150% * 1000 - 1300) / (150% - 100% - 1%) = 408.16
+		{"reward 1%", 1300, 1, true, 591, 887},
+		// sold = (150% * 1000 - 1300) / (150% - 100%) = 400
+		{"no reward", 1300, 0, true, 600, 900},
+		// sold = (150% * 1000 - 1000) / (150% - 100% - 1%) > 1000
+		{"not enough collateral", 1000, 1, false, 0, 0},
+		// the reward can't be paid before the deposit rate is restored
+		{"reward too high", 1300, 50, false, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lockedAmount := new(big.Int).Mul(big.NewInt(tt.lockedAmount), decimal)
+			liquidationAmount, repayAmount, rewardAmount, ok := CalculatePartialLiquidation(amount, lockedAmount, decimal, decimal, big.NewInt(150), big.NewInt(tt.rewardRate))
+			if ok != tt.ok {
+				t.Fatalf("ok = %v , want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			amountLeft := new(big.Int).Sub(amount, repayAmount)
+			lockedLeft := new(big.Int).Sub(lockedAmount, new(big.Int).Add(liquidationAmount, rewardAmount))
+			if new(big.Int).Div(amountLeft, decimal).Int64() != tt.wantAmount || new(big.Int).Div(lockedLeft, decimal).Int64() != tt.wantLockedLeft {
+				t.Fatalf("amount left %v , locked left %v , want %d , %d", amountLeft, lockedLeft, tt.wantAmount, tt.wantLockedLeft)
+			}
+			// collateral left is worth at least 150% of the debt left
+			if new(big.Int).Mul(lockedLeft, big.NewInt(100)).Cmp(new(big.Int).Mul(amountLeft, big.NewInt(150))) < 0 {
+				t.Fatalf("deposit rate not restored: amount left %v , locked left %v", amountLeft, lockedLeft)
+			}
+		})
+	}
+}
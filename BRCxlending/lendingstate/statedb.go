@@ -26,6 +26,7 @@ import (
 	"BRDPoSChain/common"
 	"BRDPoSChain/log"
 	"BRDPoSChain/rlp"
+	"BRDPoSChain/trie"
 )
 
 type revision struct {
@@ -215,6 +216,21 @@ func (ls *LendingStateDB) UpdateCollateralLockedAmount(orderBook common.Hash, tr
 	stateLendingTrade.SetCollateralLockedAmount(amount)
 }
 
+func (ls *LendingStateDB) UpdateLendingTradeAmount(orderBook common.Hash, tradeId uint64, amount *big.Int) {
+	tradeIdHash := common.Uint64ToHash(tradeId)
+	stateExchange := ls.getLendingExchange(orderBook)
+	if stateExchange == nil {
+		stateExchange = ls.createLendingExchangeObject(orderBook)
+	}
+	stateLendingTrade := stateExchange.getLendingTrade(ls.db, tradeIdHash)
+	ls.journal = append(ls.journal, tradeAmountChange{
+		orderBook: orderBook,
+		tradeId:   tradeIdHash,
+		prev:      stateLendingTrade.data.Amount,
+	})
+	stateLendingTrade.SetAmount(amount)
+}
+
 func (ls *LendingStateDB) GetLendingOrder(orderBook common.Hash, orderId common.Hash) LendingItem {
 	stateObject := ls.GetOrNewLendingExchangeObject(orderBook)
 	if stateObject == nil {
@@ -239,6 +255,35 @@ func (ls *LendingStateDB) GetLendingTrade(orderBook common.Hash, tradeId common.
 	return stateOrderItem.data
 }
 
+// GetLendingTradeRoot retrieves the root of the lending trades trie of the given
+// lending book or empty if the lending book is not found.
+func (ls *LendingStateDB) GetLendingTradeRoot(orderBook common.Hash) common.Hash {
+	stateObject := ls.getLendingExchange(orderBook)
+	if stateObject == nil {
+		return common.Hash{}
+	}
+	return stateObject.data.LendingTradeRoot
+}
+
+// GetLendingBookProof returns the Merkle proof of a lending book in the lending state trie.
+func (ls *LendingStateDB) GetLendingBookProof(orderBook common.Hash) ([][]byte, error) {
+	var proof trie.ProofList
+	err := ls.trie.Prove(orderBook[:], 0, &proof)
+	return proof, err
+}
+
+// GetLendingTradeProof returns the Merkle proof of a lending trade in the lending
+// trades trie of the lending book.
+func (ls *LendingStateDB) GetLendingTradeProof(orderBook common.Hash, tradeId common.Hash) ([][]byte, error) {
+	var proof trie.ProofList
+	stateObject := ls.getLendingExchange(orderBook)
+	if stateObject == nil {
+		return proof, fmt.Errorf("not found lendingBook: %v", orderBook.Hex())
+	}
+	err := stateObject.getLendingTradeTrie(ls.db).Prove(tradeId[:], 0, &proof)
+	return proof, err
+}
+
 func (ls *LendingStateDB) SubAmountLendingItem(orderBook common.Hash, orderId common.Hash, price *big.Int, amount *big.Int, side string) error {
 	priceHash := common.BigToHash(price)
 	lendingExchange := ls.GetOrNewLendingExchangeObject(orderBook)
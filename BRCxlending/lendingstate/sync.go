@@ -0,0 +1,60 @@
+// Copyright 2015 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package lendingstate
+
+import (
+	"BRDPoSChain/common"
+	"BRDPoSChain/ethdb"
+	"BRDPoSChain/rlp"
+	"BRDPoSChain/trie"
+)
+
+// NewStateSync create a new lending state trie download scheduler. Besides the
+// main lending book trie, it follows the investing, borrowing, liquidation time,
+// lending item and lending trade tries hanging off the lending objects.
+func NewStateSync(root common.Hash, database ethdb.KeyValueReader, bloom *trie.SyncBloom) *trie.Sync {
+	var syncer *trie.Sync
+
+	addSubTrie := func(root common.Hash, parent common.Hash, callback trie.LeafCallback) {
+		if !root.IsZero() && root != EmptyRoot {
+			syncer.AddSubTrie(root, 64, parent, callback)
+		}
+	}
+	// Interest rates and liquidation times point to the trie of their items
+	itemListCallback := func(leaf []byte, parent common.Hash) error {
+		var list itemList
+		if err := rlp.DecodeBytes(leaf, &list); err != nil {
+			return err
+		}
+		addSubTrie(list.Root, parent, nil)
+		return nil
+	}
+	callback := func(leaf []byte, parent common.Hash) error {
+		var book lendingObject
+		if err := rlp.DecodeBytes(leaf, &book); err != nil {
+			return err
+		}
+		addSubTrie(book.InvestingRoot, parent, itemListCallback)
+		addSubTrie(book.BorrowingRoot, parent, itemListCallback)
+		addSubTrie(book.LiquidationTimeRoot, parent, itemListCallback)
+		addSubTrie(book.LendingItemRoot, parent, nil)
+		addSubTrie(book.LendingTradeRoot, parent, nil)
+		return nil
+	}
+	syncer = trie.NewSync(root, database, callback, bloom)
+	return syncer
+}
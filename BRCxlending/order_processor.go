@@ -925,6 +925,73 @@ func (l *Lending) LiquidationTrade(lendingStateDB *lendingstate.LendingStateDB,
 	return &lendingTrade, nil
 }
 
+// PartialLiquidationTrade sells to the investor only the collateral needed to bring the trade back to its deposit rate
+// and pays the keeper reward to the liquidator. It returns nil if the trade has to be liquidated fully.
+// Enabled at TIPBRCXPartialLiquidation
+func (l *Lending) PartialLiquidationTrade(lendingStateDB *lendingstate.LendingStateDB, statedb *state.StateDB, tradingstateDB *tradingstate.TradingStateDB, lendingBook common.Hash, lendingTradeId uint64, collateralPrice, collateralTokenDecimal *big.Int, liquidator common.Address) (*lendingstate.LendingTrade, error) {
+	lendingTradeIdHash := common.Uint64ToHash(lendingTradeId)
+	lendingTrade := lendingStateDB.GetLendingTrade(lendingBook, lendingTradeIdHash)
+	if lendingTrade.TradeId != lendingTradeId {
+		return nil, fmt.Errorf("Lending Trade Id not found : %d ", lendingTradeId)
+	}
+	liquidationAmount, repayAmount, rewardAmount, ok := lendingstate.CalculatePartialLiquidation(lendingTrade.Amount, lendingTrade.CollateralLockedAmount, collateralPrice, collateralTokenDecimal, lendingTrade.DepositRate, common.RateLiquidationReward)
+	if !ok {
+		return nil, nil
+	}
+	newAmount := new(big.Int).Sub(lendingTrade.Amount, repayAmount)
+	newLockedAmount := new(big.Int).Sub(lendingTrade.CollateralLockedAmount, liquidationAmount)
+	newLockedAmount = new(big.Int).Sub(newLockedAmount, rewardAmount)
+	// newLiquidationPrice = LiquidationPrice * (newAmount / Amount) * (CollateralLockedAmount / newLockedAmount)
+	newLiquidationPrice := new(big.Int).Mul(lendingTrade.LiquidationPrice, newAmount)
+	newLiquidationPrice = new(big.Int).Mul(newLiquidationPrice, lendingTrade.CollateralLockedAmount)
+	newLiquidationPrice = new(big.Int).Div(newLiquidationPrice, new(big.Int).Mul(lendingTrade.Amount, newLockedAmount))
+	if newLiquidationPrice.Cmp(collateralPrice) >= 0 {
+		// rounding left the trade liquidable
+		return nil, nil
+	}
+
+	err := lendingstate.SubTokenBalance(common.LendingLockAddressBinary, new(big.Int).Add(liquidationAmount, rewardAmount), lendingTrade.CollateralToken, statedb)
+	if err != nil {
+		log.Warn("PartialLiquidationTrade SubTokenBalance", "err", err, "LendingLockAddress", common.LendingLockAddress, "liquidationAmount", liquidationAmount, "rewardAmount", rewardAmount, "lendingTrade.CollateralToken", lendingTrade.CollateralToken)
+	}
+	err = lendingstate.AddTokenBalance(lendingTrade.Investor, liquidationAmount, lendingTrade.CollateralToken, statedb)
+	if err != nil {
+		log.Warn("PartialLiquidationTrade AddTokenBalance", "err", err, "lendingTrade.Investor", lendingTrade.Investor, "liquidationAmount", liquidationAmount, "lendingTrade.CollateralToken", lendingTrade.CollateralToken)
+	}
+	if rewardAmount.Sign() > 0 {
+		err = lendingstate.AddTokenBalance(liquidator, rewardAmount, lendingTrade.CollateralToken, statedb)
+		if err != nil {
+			log.Warn("PartialLiquidationTrade AddTokenBalance", "err", err, "liquidator", liquidator, "rewardAmount", rewardAmount, "lendingTrade.CollateralToken", lendingTrade.CollateralToken)
+		}
+	}
+	err = tradingstateDB.RemoveLiquidationPrice(tradingstate.GetTradingOrderBookHash(lendingTrade.CollateralToken, lendingTrade.LendingToken), lendingTrade.LiquidationPrice, lendingBook, lendingTradeId)
+	if err != nil {
+		log.Debug("PartialLiquidationTrade RemoveLiquidationPrice", "err", err)
+		return nil, err
+	}
+	lendingStateDB.UpdateLendingTradeAmount(lendingBook, lendingTradeId, newAmount)
+	lendingStateDB.UpdateCollateralLockedAmount(lendingBook, lendingTradeId, newLockedAmount)
+	lendingStateDB.UpdateLiquidationPrice(lendingBook, lendingTradeId, newLiquidationPrice)
+	tradingstateDB.InsertLiquidationPrice(tradingstate.GetTradingOrderBookHash(lendingTrade.CollateralToken, lendingTrade.LendingToken), newLiquidationPrice, lendingBook, lendingTradeId)
+
+	newLendingTrade := lendingTrade
+	newLendingTrade.Amount = newAmount
+	newLendingTrade.CollateralLockedAmount = newLockedAmount
+	newLendingTrade.LiquidationPrice = newLiquidationPrice
+	// update liquidationData mongodb
+	liquidationData := lendingstate.LiquidationData{
+		RecallAmount:      common.Big0,
+		LiquidationAmount: liquidationAmount,
+		CollateralPrice:   collateralPrice,
+		Reason:            lendingstate.LiquidatedPartially,
+		RepayAmount:       repayAmount,
+		KeeperReward:      rewardAmount,
+	}
+	extraData, _ := json.Marshal(liquidationData)
+	newLendingTrade.ExtraData = string(extraData)
+	return &newLendingTrade, nil
+}
+
 // cancellation fee = 1/10 borrowing fee
 // deprecated after hardfork at TIPBRCXCancellationFee
 func getCancelFeeV1(collateralTokenDecimal *big.Int, collateralPrice, borrowFee *big.Int, order *lendingstate.LendingItem) *big.Int {
@@ -10,7 +10,10 @@ import (
 	"BRDPoSChain/BRCxlending/lendingstate"
 	"BRDPoSChain/common"
 	"BRDPoSChain/core/rawdb"
+	"BRDPoSChain/core/state"
 	"BRDPoSChain/core/types"
+	"BRDPoSChain/crypto"
+	"BRDPoSChain/params"
 )
 
 func Test_getCancelFeeV1(t *testing.T) {
@@ -541,3 +544,99 @@ func TestGetLendQuantity(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessLiquidationDataPartial(t *testing.T) {
+	defer func(tip *big.Int) { common.TIPBRCXPartialLiquidation = tip }(common.TIPBRCXPartialLiquidation)
+	common.TIPBRCXPartialLiquidation = big.NewInt(0)
+
+	var (
+		lendingToken    = common.BRCNativeAddressBinary
+		collateralToken = common.HexToAddress("0x1000000000000000000000000000000000000003")
+		investor        = common.HexToAddress("0x3000000000000000000000000000000000000001")
+		term            = uint64(86400)
+		lendingBook     = lendingstate.GetLendingOrderBookHash(lendingToken, term)
+		orderBook       = tradingstate.GetTradingOrderBookHash(collateralToken, lendingToken)
+		tokens          = func(n int64) *big.Int { return new(big.Int).Mul(common.BasePrice, big.NewInt(n)) }
+		percent         = func(n int64) *big.Int { return new(big.Int).Div(tokens(n), big.NewInt(100)) }
+	)
+	db := rawdb.NewMemoryDatabase()
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabase(db))
+	tradingState, _ := tradingstate.New(types.EmptyRootHash, tradingstate.NewDatabase(db))
+	lendingState, _ := lendingstate.New(types.EmptyRootHash, lendingstate.NewDatabase(db))
+	BRCx := BRCx.New(&BRCx.DefaultConfig)
+	BRCx.SetTokenDecimal(collateralToken, common.BasePrice)
+	l := New(BRCx)
+
+	// lending registration: one base token, term and collateral, collateral price 0.72 set by the contract
+	setArray := func(slot uint64, value common.Hash) {
+		loc := state.GetLocSimpleVariable(slot)
+		statedb.SetState(common.LendingRegistrationSMC, loc, common.BigToHash(common.Big1))
+		statedb.SetState(common.LendingRegistrationSMC, state.GetLocDynamicArrAtElement(loc, 0, 1), value)
+	}
+	setArray(lendingstate.SupportedBaseSlot, lendingToken.Hash())
+	setArray(lendingstate.SupportedTermSlot, common.BigToHash(new(big.Int).SetUint64(term)))
+	setArray(lendingstate.DefaultCollateralSlot, collateralToken.Hash())
+	collateralLoc := lendingstate.GetLocMappingAtKey(collateralToken.Hash(), lendingstate.CollateralMapSlot)
+	for name, rate := range map[string]int64{"depositRate": 150, "liquidationRate": 110, "recallRate": 200} {
+		statedb.SetState(common.LendingRegistrationSMC, state.GetLocOfStructElement(collateralLoc, lendingstate.CollateralStructSlots[name]), common.BigToHash(big.NewInt(rate)))
+	}
+	priceLoc := crypto.Keccak256(lendingToken.Hash().Bytes(), common.BigToHash(new(big.Int).Add(collateralLoc, lendingstate.CollateralStructSlots["price"])).Bytes())
+	header := &types.Header{Number: big.NewInt(900 + int64(common.LiquidateLendingTradeBlock)), Time: big.NewInt(1000), Coinbase: common.HexToAddress("0x4000000000000000000000000000000000000001")}
+	statedb.SetState(common.LendingRegistrationSMC, common.BytesToHash(priceLoc), common.BigToHash(percent(72)))
+	statedb.SetState(common.LendingRegistrationSMC, common.BigToHash(new(big.Int).Add(new(big.Int).SetBytes(priceLoc), lendingstate.PriceStructSlots["blockNumber"])), common.BigToHash(header.Number))
+
+	statedb.SetNonce(collateralToken, 1)
+	lendingstate.SetTokenBalance(common.LendingLockAddressBinary, tokens(1000), collateralToken, statedb)
+	trade := func(id uint64, amount, collateral int64, liquidationPrice *big.Int) {
+		lendingState.InsertTradingItem(lendingBook, id, lendingstate.LendingTrade{
+			Investor:               investor,
+			LendingToken:           lendingToken,
+			CollateralToken:        collateralToken,
+			Term:                   term,
+			LiquidationPrice:       liquidationPrice,
+			CollateralLockedAmount: tokens(collateral),
+			LiquidationTime:        header.Time.Uint64() + term,
+			DepositRate:            big.NewInt(150),
+			Amount:                 tokens(amount),
+			TradeId:                id,
+			Hash:                   common.BigToHash(new(big.Int).SetUint64(id)),
+		})
+		lendingState.InsertLiquidationTime(lendingBook, new(big.Int).SetUint64(header.Time.Uint64()+term), id)
+		tradingState.InsertLiquidationPrice(orderBook, liquidationPrice, lendingBook, id)
+	}
+	// selling a part of the collateral restores the deposit rate of the first trade, not of the second one
+	trade(1, 100, 150, new(big.Int).Div(tokens(110), big.NewInt(150)))
+	trade(2, 100, 130, percent(90))
+
+	chain := &configChain{config: &params.ChainConfig{BRDPoS: &params.BRDPoSConfig{Epoch: 900}}}
+	updated, liquidated, partiallyLiquidated, _, _, _, err := l.ProcessLiquidationData(header, chain, statedb, tradingState, lendingState)
+	if err != nil {
+		t.Fatalf("failed to process liquidation: %v", err)
+	}
+	if len(liquidated) != 1 || liquidated[0].TradeId != 2 {
+		t.Fatalf("wrong liquidated trades: %v", liquidated)
+	}
+	if len(partiallyLiquidated) != 1 || partiallyLiquidated[0].TradeId != 1 || len(updated) != 2 {
+		t.Fatalf("wrong partially liquidated trades: %v , updated %d", partiallyLiquidated, len(updated))
+	}
+	// the partially liquidated trade stays open with less debt and collateral
+	left := lendingState.GetLendingTrade(lendingBook, common.Uint64ToHash(1))
+	if left.TradeId != 1 || left.Amount.Cmp(tokens(100)) >= 0 || left.CollateralLockedAmount.Cmp(tokens(150)) >= 0 || left.LiquidationPrice.Cmp(percent(72)) >= 0 {
+		t.Fatalf("wrong partially liquidated trade %+v", left)
+	}
+	if closed := lendingState.GetLendingTrade(lendingBook, common.Uint64ToHash(2)); closed.TradeId != 0 {
+		t.Fatalf("liquidated trade still open: %+v", closed)
+	}
+
+	data, err := lendingstate.EncodeFinalizedResult(liquidated, partiallyLiquidated, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := lendingstate.DecodeFinalizedResult(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Liquidated) != 1 || result.Liquidated[0] != liquidated[0].Hash || len(result.PartiallyLiquidated) != 1 || result.PartiallyLiquidated[0] != partiallyLiquidated[0].Hash {
+		t.Fatalf("wrong finalized result %+v", result)
+	}
+}
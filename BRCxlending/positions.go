@@ -0,0 +1,144 @@
+package BRCxlending
+
+import (
+	"math/big"
+	"sort"
+
+	"BRDPoSChain/BRCx/tradingstate"
+	"BRDPoSChain/BRCxlending/lendingstate"
+	"BRDPoSChain/common"
+	"BRDPoSChain/consensus"
+	"BRDPoSChain/core/state"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/log"
+)
+
+// base of the collateral ratio, the deposit, liquidation and recall rates are in percent
+var collateralRatioBase = big.NewInt(100)
+
+// LendingPosition is the health of an open lending trade.
+type LendingPosition struct {
+	Trade               lendingstate.LendingTrade `json:"trade"`
+	CollateralPrice     *big.Int                  `json:"collateralPrice"`     // price of collateral token in lending token, nil if unknown
+	CollateralValue     *big.Int                  `json:"collateralValue"`     // value of the locked collateral in lending token
+	CollateralRatio     *big.Int                  `json:"collateralRatio"`     // collateral value / borrowed amount in percent, like the deposit and liquidation rates
+	LiquidationDistance *big.Int                  `json:"liquidationDistance"` // collateral price drop before liquidation, negative if it's liquidated by the next pass
+	NextTopUpAmount     *big.Int                  `json:"nextTopUpAmount"`     // collateral deposited by the next auto top-up, nil if auto top-up is off
+	TimeToLiquidation   int64                     `json:"timeToLiquidation"`   // seconds before LiquidationTime, negative if expired
+}
+
+// LiquidationPreview lists the trades updated by the liquidation pass of a block.
+type LiquidationPreview struct {
+	BlockNumber         *big.Int                     `json:"blockNumber"`
+	BlockTime           *big.Int                     `json:"blockTime"`
+	Liquidated          []*lendingstate.LendingTrade `json:"liquidated"`
+	PartiallyLiquidated []*lendingstate.LendingTrade `json:"partiallyLiquidated"`
+	AutoRepaid          []*lendingstate.LendingTrade `json:"autoRepaid"`
+	AutoToppedUp        []*lendingstate.LendingTrade `json:"autoToppedUp"`
+	AutoRecalled        []*lendingstate.LendingTrade `json:"autoRecalled"`
+}
+
+// getTopUpAmount returns the collateral AutoTopUp deposits when the collateral
+// price is currentPrice: the new liquidation price is 90% of currentPrice. It
+// mirrors AutoTopUp for the position RPCs, nil if the price is too low for it.
+func getTopUpAmount(lendingTrade *lendingstate.LendingTrade, currentPrice *big.Int) *big.Int {
+	// newLiquidationPrice = currentPrice * 90%
+	newLiquidationPrice := new(big.Int).Mul(currentPrice, common.RateTopUp)
+	newLiquidationPrice = new(big.Int).Div(newLiquidationPrice, common.BaseTopUp)
+	if newLiquidationPrice.Sign() <= 0 {
+		return nil
+	}
+	// newLockedAmount = CollateralLockedAmount *  LiquidationPrice / newLiquidationPrice
+	newLockedAmount := new(big.Int).Mul(lendingTrade.CollateralLockedAmount, lendingTrade.LiquidationPrice)
+	newLockedAmount = new(big.Int).Div(newLockedAmount, newLiquidationPrice)
+	return new(big.Int).Sub(newLockedAmount, lendingTrade.CollateralLockedAmount)
+}
+
+// GetLendingPositions returns the open lending trades of the borrower with
+// their health at the given block.
+func (l *Lending) GetLendingPositions(header *types.Header, chain consensus.ChainContext, statedb *state.StateDB, tradingState *tradingstate.TradingStateDB, lendingState *lendingstate.LendingStateDB, borrower common.Address) ([]*LendingPosition, error) {
+	positions := []*LendingPosition{}
+	allLendingBooks, err := lendingstate.GetAllLendingBooks(statedb)
+	if err != nil {
+		log.Debug("Not found all lending books", "error", err)
+		return positions, nil
+	}
+	for lendingBook := range allLendingBooks {
+		trades, err := lendingState.DumpLendingTradeTrie(lendingBook)
+		if err != nil {
+			// no trade in this lending book
+			continue
+		}
+		for _, trade := range trades {
+			if trade.Borrower != borrower || trade == lendingstate.EmptyLendingTrade {
+				continue
+			}
+			position, err := l.getLendingPosition(header, chain, statedb, tradingState, trade)
+			if err != nil {
+				return nil, err
+			}
+			positions = append(positions, position)
+		}
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		return positions[i].Trade.TradeId < positions[j].Trade.TradeId
+	})
+	return positions, nil
+}
+
+func (l *Lending) getLendingPosition(header *types.Header, chain consensus.ChainContext, statedb *state.StateDB, tradingState *tradingstate.TradingStateDB, trade lendingstate.LendingTrade) (*LendingPosition, error) {
+	position := &LendingPosition{
+		Trade:             trade,
+		TimeToLiquidation: int64(trade.LiquidationTime) - header.Time.Int64(),
+	}
+	_, collateralPrice, err := l.GetCollateralPrices(header, chain, statedb, tradingState, trade.CollateralToken, trade.LendingToken)
+	if err != nil || collateralPrice == nil || collateralPrice.Sign() == 0 {
+		// ProcessLiquidationData ignores the pair as well
+		log.Debug("Fail when get price collateral/lending ", "CollateralToken", trade.CollateralToken.Hex(), "LendingToken", trade.LendingToken.Hex(), "error", err)
+		return position, nil
+	}
+	collateralTokenDecimal, err := l.BRCx.GetTokenDecimal(chain, statedb, trade.CollateralToken)
+	if err != nil {
+		return nil, err
+	}
+	position.CollateralPrice = collateralPrice
+	position.LiquidationDistance = new(big.Int).Sub(collateralPrice, trade.LiquidationPrice)
+
+	// collateralValue = CollateralLockedAmount * collateralPrice / collateralTokenDecimal
+	position.CollateralValue = new(big.Int).Mul(trade.CollateralLockedAmount, collateralPrice)
+	position.CollateralValue = new(big.Int).Div(position.CollateralValue, collateralTokenDecimal)
+	if trade.Amount != nil && trade.Amount.Sign() > 0 {
+		position.CollateralRatio = new(big.Int).Mul(position.CollateralValue, collateralRatioBase)
+		position.CollateralRatio = new(big.Int).Div(position.CollateralRatio, trade.Amount)
+	}
+	if trade.AutoTopUp {
+		// AutoTopUp is triggered once the price falls below the liquidation price
+		triggerPrice := trade.LiquidationPrice
+		if collateralPrice.Cmp(triggerPrice) < 0 {
+			triggerPrice = collateralPrice
+		}
+		position.NextTopUpAmount = getTopUpAmount(&trade, triggerPrice)
+	}
+	return position, nil
+}
+
+// PreviewLiquidation runs the liquidation pass of the block with the given
+// header against copies of the states, the states are left untouched.
+func (l *Lending) PreviewLiquidation(header *types.Header, chain consensus.ChainContext, statedb *state.StateDB, tradingState *tradingstate.TradingStateDB, lendingState *lendingstate.LendingStateDB) (*LiquidationPreview, error) {
+	if config := chain.Config(); config.BRDPoS == nil || header.Number.Uint64()%config.BRDPoS.Epoch != common.LiquidateLendingTradeBlock {
+		return nil, ErrNotLiquidationBlock
+	}
+	_, liquidatedTrades, partiallyLiquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades, err := l.ProcessLiquidationData(header, chain, statedb.Copy(), tradingState.Copy(), lendingState.Copy())
+	if err != nil {
+		return nil, err
+	}
+	return &LiquidationPreview{
+		BlockNumber:         header.Number,
+		BlockTime:           header.Time,
+		Liquidated:          liquidatedTrades,
+		PartiallyLiquidated: partiallyLiquidatedTrades,
+		AutoRepaid:          autoRepayTrades,
+		AutoToppedUp:        autoTopUpTrades,
+		AutoRecalled:        autoRecallTrades,
+	}, nil
+}
@@ -0,0 +1,70 @@
+package BRCxlending
+
+import (
+	"math/big"
+	"testing"
+
+	"BRDPoSChain/BRCx"
+	"BRDPoSChain/BRCx/tradingstate"
+	"BRDPoSChain/BRCxlending/lendingstate"
+	"BRDPoSChain/common"
+	"BRDPoSChain/consensus"
+	"BRDPoSChain/core/rawdb"
+	"BRDPoSChain/core/state"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/params"
+)
+
+func Test_getTopUpAmount(t *testing.T) {
+	trade := &lendingstate.LendingTrade{CollateralLockedAmount: big.NewInt(1000), LiquidationPrice: big.NewInt(100)}
+	tests := []struct {
+		name         string
+		currentPrice *big.Int
+		want         *big.Int
+	}{
+		// new liquidation price 90, new locked amount 1000 * 100 / 90
+		{"at liquidation price", big.NewInt(100), big.NewInt(111)},
+		// new liquidation price 45, new locked amount 1000 * 100 / 45
+		{"half of liquidation price", big.NewInt(50), big.NewInt(1222)},
+		{"zero price", big.NewInt(0), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getTopUpAmount(trade, tt.currentPrice)
+			if (got == nil) != (tt.want == nil) || (got != nil && got.Cmp(tt.want) != 0) {
+				t.Errorf("getTopUpAmount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// configChain is a chain context that only serves the chain config.
+type configChain struct {
+	consensus.ChainContext
+	config *params.ChainConfig
+}
+
+func (c *configChain) Config() *params.ChainConfig { return c.config }
+
+func TestPreviewLiquidationBlock(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabase(db))
+	tradingState, _ := tradingstate.New(types.EmptyRootHash, tradingstate.NewDatabase(db))
+	lendingState, _ := lendingstate.New(types.EmptyRootHash, lendingstate.NewDatabase(db))
+	chain := &configChain{config: &params.ChainConfig{BRDPoS: &params.BRDPoSConfig{Epoch: 900}}}
+	l := New(BRCx.New(&BRCx.DefaultConfig))
+
+	// liquidation only runs at the LiquidateLendingTradeBlock block of an epoch
+	header := &types.Header{Number: new(big.Int).SetUint64(900 + common.LiquidateLendingTradeBlock + 1), Time: big.NewInt(1)}
+	if _, err := l.PreviewLiquidation(header, chain, statedb, tradingState, lendingState); err != ErrNotLiquidationBlock {
+		t.Fatalf("preview of a block without liquidation: err %v , want %v", err, ErrNotLiquidationBlock)
+	}
+	header.Number = new(big.Int).SetUint64(900 + common.LiquidateLendingTradeBlock)
+	preview, err := l.PreviewLiquidation(header, chain, statedb, tradingState, lendingState)
+	if err != nil {
+		t.Fatalf("failed to preview the liquidation block: %v", err)
+	}
+	if preview.BlockNumber.Cmp(header.Number) != 0 || len(preview.Liquidated) != 0 {
+		t.Fatalf("wrong preview %+v", preview)
+	}
+}
@@ -941,7 +941,7 @@ func (fb *filterBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNum
 		return nil, nil
 	case rpc.LatestBlockNumber:
 		return fb.bc.CurrentHeader(), nil
-	case rpc.CommittedBlockNumber:
+	case rpc.CommittedBlockNumber, rpc.SafeBlockNumber:
 		if fb.bc.Config().BRDPoS == nil {
 			return nil, errors.New("only BRDPoS v2 supports committed block lookup")
 		}
@@ -951,8 +951,11 @@ func (fb *filterBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNum
 			current.Extra,
 			BRDPoS.ExtraFieldCheck,
 		) == params.ConsensusEngineVersion2 {
-			confirmedHash := fb.bc.Engine().(*BRDPoS.BRDPoS).EngineV2.GetLatestCommittedBlockInfo().Hash
-			return fb.bc.GetHeaderByHash(confirmedHash), nil
+			engine := fb.bc.Engine().(*BRDPoS.BRDPoS).EngineV2
+			if number == rpc.SafeBlockNumber {
+				return fb.bc.GetHeaderByHash(engine.GetLatestQCBlockInfo().Hash), nil
+			}
+			return fb.bc.GetHeaderByHash(engine.GetLatestCommittedBlockInfo().Hash), nil
 		}
 		return nil, errors.New("only BRDPoS v2 can lookup committed block")
 	default:
@@ -0,0 +1,333 @@
+// Copyright (c) 2024 BRDPoSChain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package external
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/common/hexutil"
+	"BRDPoSChain/consensus/BRDPoS/engines/engine_v1"
+	"BRDPoSChain/consensus/BRDPoS/engines/engine_v2"
+	"BRDPoSChain/consensus/BRDPoS/utils"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/crypto"
+	"BRDPoSChain/crypto/bls"
+	"BRDPoSChain/log"
+	"BRDPoSChain/rlp"
+	"BRDPoSChain/rpc"
+)
+
+// Version is the version of the signer protocol.
+const Version = "1.0.0"
+
+var (
+	errUnknownAccount     = errors.New("unknown account")
+	errForbiddenRecipient = errors.New("transaction is not a masternode special transaction")
+	errNoBLSKey           = errors.New("no BLS key to sign with")
+)
+
+// specialTxRecipients are the contracts masternodes send special transactions to.
+var specialTxRecipients = map[common.Address]bool{
+	common.BlockSignersBinary:                     true,
+	common.RandomizeSMCBinary:                     true,
+	common.BRCXAddrBinary:                         true,
+	common.TradingStateAddrBinary:                 true,
+	common.BRCXLendingAddressBinary:               true,
+	common.BRCXLendingFinalizedTradeAddressBinary: true,
+}
+
+// signedRound is the highest round the signer signed a message of a kind in, with what it signed.
+type signedRound struct {
+	Round types.Round `json:"round"`
+	Hash  common.Hash `json:"hash"`
+}
+
+// signerState is persisted before a vote or header is handed out, so conflicting ones are refused across
+// restarts.
+type signerState struct {
+	Vote   *signedRound `json:"vote,omitempty"`   // Last vote signed, with either key
+	Header *signedRound `json:"header,omitempty"` // Last v2 header signed, by its seal hash
+}
+
+// SignerService is the service of a signer process, signing with a single masternode key and the BLS
+// key it registered. It's served with APIs on an IPC socket.
+type SignerService struct {
+	key       *ecdsa.PrivateKey
+	blsKey    *bls.SecretKey
+	address   common.Address
+	stateFile string
+
+	lock  sync.Mutex
+	state signerState
+}
+
+// NewSignerService creates the service signing with the key, and votes and timeouts after TIPBLS with
+// the BLS key if given. The last vote and header signed are persisted to the state file, so conflicting
+// ones are refused across restarts.
+func NewSignerService(key *ecdsa.PrivateKey, blsKey *bls.SecretKey, stateFile string) (*SignerService, error) {
+	s := &SignerService{
+		key:       key,
+		blsKey:    blsKey,
+		address:   crypto.PubkeyToAddress(key.PublicKey),
+		stateFile: stateFile,
+	}
+	blob, err := os.ReadFile(stateFile)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(blob, &s.state); err != nil {
+			return nil, fmt.Errorf("invalid signer state file %s: %v", stateFile, err)
+		}
+	}
+	return s, nil
+}
+
+// APIs returns the RPC services of the signer protocol.
+func (s *SignerService) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "account",
+			Version:   Version,
+			Service:   &AccountAPI{s},
+		}, {
+			Namespace: "brdpos",
+			Version:   Version,
+			Service:   &ConsensusAPI{s},
+		},
+	}
+}
+
+func (s *SignerService) sign(address common.Address, hash common.Hash) (hexutil.Bytes, error) {
+	if address != s.address {
+		return nil, errUnknownAccount
+	}
+	return crypto.Sign(hash.Bytes(), s.key)
+}
+
+func (s *SignerService) signBLS(address common.Address, hash common.Hash) (hexutil.Bytes, error) {
+	if address != s.address {
+		return nil, errUnknownAccount
+	}
+	if s.blsKey == nil {
+		return nil, errNoBLSKey
+	}
+	return s.blsKey.Sign(hash.Bytes()).Bytes(), nil
+}
+
+// guardVote records the vote of the request, refusing it if it conflicts with the last vote signed.
+func (s *SignerService) guardVote(address common.Address, args VoteArgs) (*types.VoteForSign, error) {
+	if address != s.address {
+		return nil, errUnknownAccount
+	}
+	if args.ProposedBlockInfo.Number == nil {
+		return nil, errors.New("missing proposed block number")
+	}
+	vote := args.vote()
+	if err := s.recordVote(vote); err != nil {
+		log.Warn("Refused to sign vote", "round", vote.ProposedBlockInfo.Round, "hash", vote.ProposedBlockInfo.Hash, "err", err)
+		return nil, err
+	}
+	return vote, nil
+}
+
+// recordVote persists the vote unless it conflicts with the last one signed.
+func (s *SignerService) recordVote(vote *types.VoteForSign) error {
+	info := vote.ProposedBlockInfo
+	if s.state.Vote != nil {
+		if info.Round < s.state.Vote.Round {
+			return fmt.Errorf("refusing to vote in round %d, already voted in round %d", info.Round, s.state.Vote.Round)
+		}
+		if info.Round == s.state.Vote.Round && info.Hash != s.state.Vote.Hash {
+			return fmt.Errorf("refusing to vote for block %v in round %d, already voted for block %v", info.Hash.Hex(), info.Round, s.state.Vote.Hash.Hex())
+		}
+		if info.Round == s.state.Vote.Round {
+			return nil
+		}
+	}
+	state := s.state
+	state.Vote = &signedRound{Round: info.Round, Hash: info.Hash}
+	return s.saveState(state)
+}
+
+// recordHeader persists the seal hash of the v2 header of the round unless it conflicts with the last
+// header signed.
+func (s *SignerService) recordHeader(round types.Round, sigHash common.Hash) error {
+	if s.state.Header != nil {
+		if round < s.state.Header.Round {
+			return fmt.Errorf("refusing to sign a header of round %d, already signed one of round %d", round, s.state.Header.Round)
+		}
+		if round == s.state.Header.Round && sigHash != s.state.Header.Hash {
+			return fmt.Errorf("refusing to sign header %v of round %d, already signed header %v", sigHash.Hex(), round, s.state.Header.Hash.Hex())
+		}
+		if round == s.state.Header.Round {
+			return nil
+		}
+	}
+	state := s.state
+	state.Header = &signedRound{Round: round, Hash: sigHash}
+	return s.saveState(state)
+}
+
+// saveState persists the state, and makes it the current one once written.
+func (s *SignerService) saveState(state signerState) error {
+	blob, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first, a torn state file must not erase the last vote
+	tmp, err := os.CreateTemp(filepath.Dir(s.stateFile), filepath.Base(s.stateFile)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(blob); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), s.stateFile); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	s.state = state
+	return nil
+}
+
+// AccountAPI is the account namespace of the signer protocol.
+type AccountAPI struct {
+	s *SignerService
+}
+
+// Version returns the version of the signer protocol.
+func (api *AccountAPI) Version() string {
+	return Version
+}
+
+// List returns the address of the key of the signer.
+func (api *AccountAPI) List() []common.Address {
+	return []common.Address{api.s.address}
+}
+
+// SignTransaction signs a masternode special transaction: a call moving no value to the block signers,
+// randomize, BRCx trading or lending contracts.
+func (api *AccountAPI) SignTransaction(address common.Address, data hexutil.Bytes, chainID *hexutil.Big) (hexutil.Bytes, error) {
+	if address != api.s.address {
+		return nil, errUnknownAccount
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	if tx.To() == nil || !specialTxRecipients[*tx.To()] || tx.Value().Sign() != 0 {
+		return nil, errForbiddenRecipient
+	}
+	signed, err := types.SignTx(tx, types.LatestSignerForChainID(chainID.ToInt()), api.s.key)
+	if err != nil {
+		return nil, err
+	}
+	return signed.MarshalBinary()
+}
+
+// ConsensusAPI is the brdpos namespace of the signer protocol.
+type ConsensusAPI struct {
+	s *SignerService
+}
+
+// SignHeader signs the seal hash of the RLP encoded header. A v2 header is refused if it conflicts with
+// the last one signed, v1 headers have no rounds to guard.
+func (api *ConsensusAPI) SignHeader(address common.Address, data hexutil.Bytes) (hexutil.Bytes, error) {
+	if address != api.s.address {
+		return nil, errUnknownAccount
+	}
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(data, header); err != nil {
+		return nil, err
+	}
+	var extra types.ExtraFields_v2
+	if err := utils.DecodeBytesExtraFields(header.Extra, &extra); err != nil {
+		sigHash := engine_v1.SigHash(header)
+		log.Info("Signing header", "number", header.Number, "hash", sigHash)
+		return api.s.sign(address, sigHash)
+	}
+	api.s.lock.Lock()
+	defer api.s.lock.Unlock()
+
+	sigHash := engine_v2.SigHash(header)
+	if err := api.s.recordHeader(extra.Round, sigHash); err != nil {
+		log.Warn("Refused to sign header", "number", header.Number, "round", extra.Round, "hash", sigHash, "err", err)
+		return nil, err
+	}
+	log.Info("Signing header", "number", header.Number, "round", extra.Round, "hash", sigHash)
+	return api.s.sign(address, sigHash)
+}
+
+// SignVote signs the vote, unless it conflicts with the last vote signed.
+func (api *ConsensusAPI) SignVote(address common.Address, args VoteArgs) (hexutil.Bytes, error) {
+	api.s.lock.Lock()
+	defer api.s.lock.Unlock()
+
+	vote, err := api.s.guardVote(address, args)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Signing vote", "round", vote.ProposedBlockInfo.Round, "number", vote.ProposedBlockInfo.Number, "hash", vote.ProposedBlockInfo.Hash)
+	return api.s.sign(address, types.VoteSigHash(vote))
+}
+
+// SignBLSVote signs the vote with the BLS key, unless it conflicts with the last vote signed with
+// either key.
+func (api *ConsensusAPI) SignBLSVote(address common.Address, args VoteArgs) (hexutil.Bytes, error) {
+	api.s.lock.Lock()
+	defer api.s.lock.Unlock()
+
+	if api.s.blsKey == nil {
+		return nil, errNoBLSKey
+	}
+	vote, err := api.s.guardVote(address, args)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Signing BLS vote", "round", vote.ProposedBlockInfo.Round, "number", vote.ProposedBlockInfo.Number, "hash", vote.ProposedBlockInfo.Hash)
+	return api.s.signBLS(address, types.VoteSigHash(vote))
+}
+
+// SignTimeout signs the timeout.
+func (api *ConsensusAPI) SignTimeout(address common.Address, args TimeoutArgs) (hexutil.Bytes, error) {
+	timeout := &types.TimeoutForSign{Round: types.Round(args.Round), GapNumber: uint64(args.GapNumber)}
+	log.Info("Signing timeout", "round", timeout.Round)
+	return api.s.sign(address, types.TimeoutSigHash(timeout))
+}
+
+// SignBLSTimeout signs the timeout with the BLS key.
+func (api *ConsensusAPI) SignBLSTimeout(address common.Address, args TimeoutArgs) (hexutil.Bytes, error) {
+	timeout := &types.TimeoutForSign{Round: types.Round(args.Round), GapNumber: uint64(args.GapNumber)}
+	log.Info("Signing BLS timeout", "round", timeout.Round)
+	return api.s.signBLS(address, types.TimeoutSigHash(timeout))
+}
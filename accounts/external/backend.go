@@ -0,0 +1,286 @@
+// Copyright (c) 2024 BRDPoSChain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package external
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	ethereum "BRDPoSChain"
+	"BRDPoSChain/accounts"
+	"BRDPoSChain/common"
+	"BRDPoSChain/common/hexutil"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/event"
+	"BRDPoSChain/log"
+	"BRDPoSChain/rlp"
+	"BRDPoSChain/rpc"
+)
+
+// Scheme is the URL scheme of the wallets of external signers.
+const Scheme = "extapi"
+
+var errNotSupported = errors.New("operation not supported on external signers")
+
+// BlockInfoArgs is the block a vote is cast for.
+type BlockInfoArgs struct {
+	Hash   common.Hash    `json:"hash"`
+	Round  hexutil.Uint64 `json:"round"`
+	Number *hexutil.Big   `json:"number"`
+}
+
+// VoteArgs is the vote of a brdpos_signVote or brdpos_signBLSVote request.
+type VoteArgs struct {
+	ProposedBlockInfo BlockInfoArgs  `json:"proposedBlockInfo"`
+	GapNumber         hexutil.Uint64 `json:"gapNumber"`
+}
+
+// TimeoutArgs is the timeout of a brdpos_signTimeout or brdpos_signBLSTimeout request.
+type TimeoutArgs struct {
+	Round     hexutil.Uint64 `json:"round"`
+	GapNumber hexutil.Uint64 `json:"gapNumber"`
+}
+
+func newVoteArgs(vote *types.VoteForSign) *VoteArgs {
+	return &VoteArgs{
+		ProposedBlockInfo: BlockInfoArgs{
+			Hash:   vote.ProposedBlockInfo.Hash,
+			Round:  hexutil.Uint64(vote.ProposedBlockInfo.Round),
+			Number: (*hexutil.Big)(vote.ProposedBlockInfo.Number),
+		},
+		GapNumber: hexutil.Uint64(vote.GapNumber),
+	}
+}
+
+func (args *VoteArgs) vote() *types.VoteForSign {
+	return &types.VoteForSign{
+		ProposedBlockInfo: &types.BlockInfo{
+			Hash:   args.ProposedBlockInfo.Hash,
+			Round:  types.Round(args.ProposedBlockInfo.Round),
+			Number: args.ProposedBlockInfo.Number.ToInt(),
+		},
+		GapNumber: uint64(args.GapNumber),
+	}
+}
+
+// ExternalBackend is an account backend holding the wallet of a signer process.
+type ExternalBackend struct {
+	signers []accounts.Wallet
+}
+
+// NewExternalBackend connects to the signer process at the endpoint, an IPC path.
+func NewExternalBackend(endpoint string) (*ExternalBackend, error) {
+	signer, err := NewExternalSigner(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &ExternalBackend{signers: []accounts.Wallet{signer}}, nil
+}
+
+func (eb *ExternalBackend) Wallets() []accounts.Wallet {
+	return eb.signers
+}
+
+func (eb *ExternalBackend) Subscribe(sink chan<- accounts.WalletEvent) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
+// ExternalSigner is the wallet of a signer process. Besides transactions, it signs the headers, votes
+// and timeouts of the consensus engine, handing them to the signer rather than their hash. Signing
+// hashes, data and text isn't supported.
+type ExternalSigner struct {
+	client   *rpc.Client
+	endpoint string
+	status   string
+
+	cacheMu sync.RWMutex
+	cache   []accounts.Account
+}
+
+// NewExternalSigner connects to the signer process at the endpoint, an IPC path.
+func NewExternalSigner(endpoint string) (*ExternalSigner, error) {
+	client, err := rpc.DialIPC(context.Background(), endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return newExternalSigner(client, endpoint)
+}
+
+func newExternalSigner(client *rpc.Client, endpoint string) (*ExternalSigner, error) {
+	signer := &ExternalSigner{client: client, endpoint: endpoint}
+	var version string
+	if err := client.Call(&version, "account_version"); err != nil {
+		return nil, err
+	}
+	signer.status = fmt.Sprintf("ok [version=%v]", version)
+	return signer, nil
+}
+
+func (api *ExternalSigner) URL() accounts.URL {
+	return accounts.URL{Scheme: Scheme, Path: api.endpoint}
+}
+
+func (api *ExternalSigner) Status() (string, error) {
+	return api.status, nil
+}
+
+func (api *ExternalSigner) Open(passphrase string) error {
+	return errNotSupported
+}
+
+func (api *ExternalSigner) Close() error {
+	return errNotSupported
+}
+
+func (api *ExternalSigner) Accounts() []accounts.Account {
+	var list []common.Address
+	if err := api.client.Call(&list, "account_list"); err != nil {
+		log.Error("External signer account listing failed", "endpoint", api.endpoint, "err", err)
+		return nil
+	}
+	accnts := make([]accounts.Account, 0, len(list))
+	for _, addr := range list {
+		accnts = append(accnts, accounts.Account{Address: addr, URL: api.URL()})
+	}
+	api.cacheMu.Lock()
+	api.cache = accnts
+	api.cacheMu.Unlock()
+	return accnts
+}
+
+func (api *ExternalSigner) Contains(account accounts.Account) bool {
+	api.cacheMu.RLock()
+	cache := api.cache
+	api.cacheMu.RUnlock()
+
+	if cache == nil {
+		// The accounts haven't been fetched yet
+		cache = api.Accounts()
+	}
+	for _, a := range cache {
+		if a.Address == account.Address && (account.URL == (accounts.URL{}) || account.URL == api.URL()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (api *ExternalSigner) Derive(path accounts.DerivationPath, pin bool) (accounts.Account, error) {
+	return accounts.Account{}, errNotSupported
+}
+
+func (api *ExternalSigner) SelfDerive(bases []accounts.DerivationPath, chain ethereum.ChainStateReader) {
+	log.Error("Operation SelfDerive not supported on external signers")
+}
+
+// SignHash is not supported, as the signer doesn't sign what it can't check.
+func (api *ExternalSigner) SignHash(account accounts.Account, hash []byte) ([]byte, error) {
+	return nil, errNotSupported
+}
+
+func (api *ExternalSigner) SignData(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+	return nil, errNotSupported
+}
+
+func (api *ExternalSigner) SignDataWithPassphrase(account accounts.Account, passphrase, mimeType string, data []byte) ([]byte, error) {
+	return nil, errNotSupported
+}
+
+func (api *ExternalSigner) SignText(account accounts.Account, text []byte) ([]byte, error) {
+	return nil, errNotSupported
+}
+
+func (api *ExternalSigner) SignTextWithPassphrase(account accounts.Account, passphrase string, hash []byte) ([]byte, error) {
+	return nil, errNotSupported
+}
+
+// SignTx signs the transaction with the signer, which only signs the special transactions of masternodes.
+func (api *ExternalSigner) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	data, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	var res hexutil.Bytes
+	if err := api.client.Call(&res, "account_signTransaction", account.Address, hexutil.Bytes(data), (*hexutil.Big)(chainID)); err != nil {
+		return nil, err
+	}
+	signed := new(types.Transaction)
+	if err := signed.UnmarshalBinary(res); err != nil {
+		return nil, err
+	}
+	return signed, nil
+}
+
+func (api *ExternalSigner) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return nil, errNotSupported
+}
+
+// SignHeader signs the seal hash of the header with the signer.
+func (api *ExternalSigner) SignHeader(account accounts.Account, header *types.Header) ([]byte, error) {
+	data, err := rlp.EncodeToBytes(header)
+	if err != nil {
+		return nil, err
+	}
+	var res hexutil.Bytes
+	if err := api.client.Call(&res, "brdpos_signHeader", account.Address, hexutil.Bytes(data)); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// SignVote signs the vote with the signer, which refuses to sign votes conflicting with the ones it signed.
+func (api *ExternalSigner) SignVote(account accounts.Account, vote *types.VoteForSign) ([]byte, error) {
+	var res hexutil.Bytes
+	if err := api.client.Call(&res, "brdpos_signVote", account.Address, newVoteArgs(vote)); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// SignBLSVote signs the vote with the BLS key of the signer, which refuses to sign votes conflicting
+// with the ones it signed.
+func (api *ExternalSigner) SignBLSVote(account accounts.Account, vote *types.VoteForSign) ([]byte, error) {
+	var res hexutil.Bytes
+	if err := api.client.Call(&res, "brdpos_signBLSVote", account.Address, newVoteArgs(vote)); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// SignTimeout signs the timeout with the signer.
+func (api *ExternalSigner) SignTimeout(account accounts.Account, timeout *types.TimeoutForSign) ([]byte, error) {
+	return api.signTimeout("brdpos_signTimeout", account, timeout)
+}
+
+// SignBLSTimeout signs the timeout with the BLS key of the signer.
+func (api *ExternalSigner) SignBLSTimeout(account accounts.Account, timeout *types.TimeoutForSign) ([]byte, error) {
+	return api.signTimeout("brdpos_signBLSTimeout", account, timeout)
+}
+
+func (api *ExternalSigner) signTimeout(method string, account accounts.Account, timeout *types.TimeoutForSign) ([]byte, error) {
+	args := &TimeoutArgs{Round: hexutil.Uint64(timeout.Round), GapNumber: hexutil.Uint64(timeout.GapNumber)}
+	var res hexutil.Bytes
+	if err := api.client.Call(&res, method, account.Address, args); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2024 BRDPoSChain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+/*
+Package external implements a wallet backed by a signer process holding the masternode key outside of
+the node, and the service of such a signer process.
+
+The node talks to the signer over JSON-RPC on an IPC socket, which only the owner of the signer process
+can access. The signer is deliberately not served over HTTP or any other network transport, as anyone
+reaching it could have it sign headers. A signer on another host is reached by forwarding the socket
+over an authenticated channel, such as SSH.
+The signer never signs arbitrary hashes: the node hands it the headers, votes, timeouts and transactions
+to sign, and the signer derives what it signs from them. This lets it refuse to sign conflicting votes
+and headers, even if the node asks it to.
+
+Methods of the protocol:
+
+	account_version() string
+
+Returns the version of the protocol the signer speaks, currently "1.0.0".
+
+	account_list() []address
+
+Returns the addresses of the keys of the signer.
+
+	account_signTransaction(address, tx bytes, chainId quantity) bytes
+
+Signs the binary encoded transaction for the chain id and returns the binary encoding of the signed
+transaction. Only the special transactions of masternodes are signed: calls, moving no value, to the
+block signers (0x...89), randomize (0x...90), BRCx trading (0x...91, 0x...92) and lending (0x...93,
+0x...94) contracts.
+
+	brdpos_signHeader(address, header bytes) bytes
+
+Signs the seal hash of the RLP encoded header, a v2 header if its extra field decodes as v2 extra
+fields, a v1 header otherwise. Returns the 65 bytes [R || S || V] signature. The signer persists the
+highest round it signed a v2 header in with its seal hash, and refuses to sign a header of a lower
+round, or another header of the same round, like it does for votes. v1 headers aren't guarded.
+
+	brdpos_signVote(address, vote {proposedBlockInfo: {hash, round, number}, gapNumber}) bytes
+
+Signs a v2 vote. The signer persists the highest round it voted in with the block it voted for, and
+refuses to sign a vote of a lower round, or of the same round for another block. Signing the same vote
+again is allowed, so a node restarting within a round can resend its vote.
+
+	brdpos_signTimeout(address, timeout {round, gapNumber}) bytes
+
+Signs a v2 timeout.
+
+	brdpos_signBLSVote(address, vote {proposedBlockInfo: {hash, round, number}, gapNumber}) bytes
+	brdpos_signBLSTimeout(address, timeout {round, gapNumber}) bytes
+
+Sign a v2 vote or timeout with the BLS key of the signer, as the node does after TIPBLS. Returns the
+96 bytes compressed signature. BLS votes are guarded against conflicting votes the same way, sharing
+the persisted last vote with brdpos_signVote.
+
+Quantities are hex encoded, bytes are 0x prefixed hex strings.
+*/
+package external
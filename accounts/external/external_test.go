@@ -0,0 +1,294 @@
+// Copyright (c) 2024 BRDPoSChain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package external
+
+import (
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"BRDPoSChain/accounts"
+	"BRDPoSChain/common"
+	"BRDPoSChain/consensus/BRDPoS/engines/engine_v2"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/crypto"
+	"BRDPoSChain/crypto/bls"
+	"BRDPoSChain/rpc"
+)
+
+func newTestSigner(t *testing.T, service *SignerService) *ExternalSigner {
+	srv := rpc.NewServer()
+	for _, api := range service.APIs() {
+		if err := srv.RegisterName(api.Namespace, api.Service); err != nil {
+			t.Fatalf("failed to register API: %v", err)
+		}
+	}
+	t.Cleanup(srv.Stop)
+	signer, err := newExternalSigner(rpc.DialInProc(srv), "inproc")
+	if err != nil {
+		t.Fatalf("failed to connect to signer: %v", err)
+	}
+	return signer
+}
+
+func testVote(round types.Round, hash common.Hash) *types.VoteForSign {
+	return &types.VoteForSign{
+		ProposedBlockInfo: &types.BlockInfo{Hash: hash, Round: round, Number: big.NewInt(int64(round) + 900)},
+		GapNumber:         450,
+	}
+}
+
+func checkSigner(t *testing.T, hash common.Hash, sig []byte, want common.Address) {
+	t.Helper()
+	pubkey, err := crypto.Ecrecover(hash.Bytes(), sig)
+	if err != nil {
+		t.Fatalf("failed to recover signer: %v", err)
+	}
+	var signer common.Address
+	copy(signer[:], crypto.Keccak256(pubkey[1:])[12:])
+	if signer != want {
+		t.Fatalf("signer mismatch: have %v, want %v", signer, want)
+	}
+}
+
+func TestSignVoteDoubleVoteProtection(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	service, err := NewSignerService(key, nil, stateFile)
+	if err != nil {
+		t.Fatalf("failed to create signer service: %v", err)
+	}
+	signer := newTestSigner(t, service)
+	account := accounts.Account{Address: crypto.PubkeyToAddress(key.PublicKey)}
+	if !signer.Contains(account) {
+		t.Fatalf("signer doesn't list account %v", account.Address)
+	}
+
+	vote := testVote(10, common.Hash{0x1})
+	sig, err := signer.SignVote(account, vote)
+	if err != nil {
+		t.Fatalf("failed to sign vote: %v", err)
+	}
+	checkSigner(t, types.VoteSigHash(vote), sig, account.Address)
+
+	if _, err := signer.SignVote(account, vote); err != nil {
+		t.Fatalf("failed to sign the same vote again: %v", err)
+	}
+	if _, err := signer.SignVote(account, testVote(10, common.Hash{0x2})); err == nil {
+		t.Fatalf("signed a conflicting vote in the same round")
+	}
+	if _, err := signer.SignVote(account, testVote(9, common.Hash{0x3})); err == nil {
+		t.Fatalf("signed a vote in an earlier round")
+	}
+	if _, err := signer.SignVote(account, testVote(11, common.Hash{0x2})); err != nil {
+		t.Fatalf("failed to sign vote in a later round: %v", err)
+	}
+
+	// the last vote survives a restart of the signer
+	service, err = NewSignerService(key, nil, stateFile)
+	if err != nil {
+		t.Fatalf("failed to reload signer service: %v", err)
+	}
+	signer = newTestSigner(t, service)
+	if _, err := signer.SignVote(account, testVote(11, common.Hash{0x1})); err == nil {
+		t.Fatalf("signed a conflicting vote after restart")
+	}
+	if _, err := signer.SignVote(account, testVote(11, common.Hash{0x2})); err != nil {
+		t.Fatalf("failed to sign the same vote after restart: %v", err)
+	}
+}
+
+func TestSignBLSVoteAndTimeout(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	blsKey, _ := bls.GenerateKey()
+	service, err := NewSignerService(key, blsKey, filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("failed to create signer service: %v", err)
+	}
+	signer := newTestSigner(t, service)
+	account := accounts.Account{Address: crypto.PubkeyToAddress(key.PublicKey)}
+
+	vote := testVote(10, common.Hash{0x1})
+	sig, err := signer.SignBLSVote(account, vote)
+	if err != nil {
+		t.Fatalf("failed to sign BLS vote: %v", err)
+	}
+	if signature, err := bls.SignatureFromBytes(sig); err != nil || !bls.Verify(blsKey.PublicKey(), types.VoteSigHash(vote).Bytes(), signature) {
+		t.Fatalf("invalid BLS vote signature: %v", err)
+	}
+	// votes signed with either key are guarded against each other
+	if _, err := signer.SignBLSVote(account, testVote(10, common.Hash{0x2})); err == nil {
+		t.Fatalf("signed a conflicting BLS vote in the same round")
+	}
+	if _, err := signer.SignVote(account, testVote(10, common.Hash{0x2})); err == nil {
+		t.Fatalf("signed a vote conflicting with a BLS vote")
+	}
+	if _, err := signer.SignBLSVote(accounts.Account{Address: common.Address{0x1}}, testVote(11, common.Hash{0x1})); err == nil {
+		t.Fatalf("signed a BLS vote with an unknown account")
+	}
+
+	timeout := &types.TimeoutForSign{Round: 12, GapNumber: 450}
+	sig, err = signer.SignBLSTimeout(account, timeout)
+	if err != nil {
+		t.Fatalf("failed to sign BLS timeout: %v", err)
+	}
+	if signature, err := bls.SignatureFromBytes(sig); err != nil || !bls.Verify(blsKey.PublicKey(), types.TimeoutSigHash(timeout).Bytes(), signature) {
+		t.Fatalf("invalid BLS timeout signature: %v", err)
+	}
+
+	// a signer without a BLS key refuses BLS messages
+	service, err = NewSignerService(key, nil, filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("failed to create signer service: %v", err)
+	}
+	signer = newTestSigner(t, service)
+	if _, err := signer.SignBLSVote(account, vote); err == nil {
+		t.Fatalf("signed a BLS vote without a BLS key")
+	}
+	if _, err := signer.SignBLSTimeout(account, timeout); err == nil {
+		t.Fatalf("signed a BLS timeout without a BLS key")
+	}
+}
+
+func TestSignTimeoutAndHeader(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	service, err := NewSignerService(key, nil, filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("failed to create signer service: %v", err)
+	}
+	signer := newTestSigner(t, service)
+	account := accounts.Account{Address: crypto.PubkeyToAddress(key.PublicKey)}
+
+	timeout := &types.TimeoutForSign{Round: 12, GapNumber: 450}
+	sig, err := signer.SignTimeout(account, timeout)
+	if err != nil {
+		t.Fatalf("failed to sign timeout: %v", err)
+	}
+	checkSigner(t, types.TimeoutSigHash(timeout), sig, account.Address)
+
+	extra := &types.ExtraFields_v2{
+		Round:      12,
+		QuorumCert: &types.QuorumCert{ProposedBlockInfo: &types.BlockInfo{Hash: common.Hash{0x1}, Round: 11, Number: big.NewInt(910)}},
+	}
+	extraBytes, err := extra.EncodeToBytes()
+	if err != nil {
+		t.Fatalf("failed to encode extra fields: %v", err)
+	}
+	header := &types.Header{Number: big.NewInt(911), Difficulty: big.NewInt(1), Extra: extraBytes}
+	sig, err = signer.SignHeader(account, header)
+	if err != nil {
+		t.Fatalf("failed to sign header: %v", err)
+	}
+	checkSigner(t, engine_v2.SigHash(header), sig, account.Address)
+
+	if _, err := signer.SignHeader(accounts.Account{Address: common.Address{0x1}}, header); err == nil {
+		t.Fatalf("signed with an unknown account")
+	}
+	if _, err := signer.SignHash(account, header.Hash().Bytes()); err != errNotSupported {
+		t.Fatalf("signed a raw hash: %v", err)
+	}
+}
+
+func testHeader(t *testing.T, round types.Round, time int64) *types.Header {
+	t.Helper()
+	extra := &types.ExtraFields_v2{
+		Round:      round,
+		QuorumCert: &types.QuorumCert{ProposedBlockInfo: &types.BlockInfo{Hash: common.Hash{0x1}, Round: round - 1, Number: big.NewInt(910)}},
+	}
+	extraBytes, err := extra.EncodeToBytes()
+	if err != nil {
+		t.Fatalf("failed to encode extra fields: %v", err)
+	}
+	return &types.Header{Number: big.NewInt(911), Time: big.NewInt(time), Difficulty: big.NewInt(1), Extra: extraBytes}
+}
+
+func TestSignHeaderDoubleSignProtection(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	service, err := NewSignerService(key, nil, stateFile)
+	if err != nil {
+		t.Fatalf("failed to create signer service: %v", err)
+	}
+	signer := newTestSigner(t, service)
+	account := accounts.Account{Address: crypto.PubkeyToAddress(key.PublicKey)}
+
+	header := testHeader(t, 12, 1)
+	if _, err := signer.SignHeader(account, header); err != nil {
+		t.Fatalf("failed to sign header: %v", err)
+	}
+	if _, err := signer.SignHeader(account, header); err != nil {
+		t.Fatalf("failed to sign the same header again: %v", err)
+	}
+	if _, err := signer.SignHeader(account, testHeader(t, 12, 2)); err == nil {
+		t.Fatalf("signed a conflicting header in the same round")
+	}
+	if _, err := signer.SignHeader(account, testHeader(t, 11, 3)); err == nil {
+		t.Fatalf("signed a header in an earlier round")
+	}
+	// the headers and votes are guarded apart
+	if _, err := signer.SignVote(account, testVote(12, common.Hash{0x1})); err != nil {
+		t.Fatalf("failed to vote in the round of the header: %v", err)
+	}
+	if _, err := signer.SignHeader(account, testHeader(t, 13, 4)); err != nil {
+		t.Fatalf("failed to sign header in a later round: %v", err)
+	}
+
+	// the last header survives a restart of the signer, along with the last vote
+	service, err = NewSignerService(key, nil, stateFile)
+	if err != nil {
+		t.Fatalf("failed to reload signer service: %v", err)
+	}
+	signer = newTestSigner(t, service)
+	if _, err := signer.SignHeader(account, testHeader(t, 13, 5)); err == nil {
+		t.Fatalf("signed a conflicting header after restart")
+	}
+	if _, err := signer.SignHeader(account, testHeader(t, 13, 4)); err != nil {
+		t.Fatalf("failed to sign the same header after restart: %v", err)
+	}
+	if _, err := signer.SignVote(account, testVote(12, common.Hash{0x2})); err == nil {
+		t.Fatalf("signed a conflicting vote after restart")
+	}
+}
+
+func TestSignTransactionWhitelist(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	service, err := NewSignerService(key, nil, filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("failed to create signer service: %v", err)
+	}
+	signer := newTestSigner(t, service)
+	account := accounts.Account{Address: crypto.PubkeyToAddress(key.PublicKey)}
+	chainID := big.NewInt(1)
+
+	tx := types.NewTransaction(0, common.BlockSignersBinary, new(big.Int), 200000, big.NewInt(0), []byte{0xe3, 0x41, 0xea, 0xa4})
+	signed, err := signer.SignTx(account, tx, chainID)
+	if err != nil {
+		t.Fatalf("failed to sign block signing transaction: %v", err)
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(chainID), signed)
+	if err != nil || from != account.Address {
+		t.Fatalf("sender mismatch: have %v (%v), want %v", from, err, account.Address)
+	}
+
+	transfer := types.NewTransaction(0, common.Address{0x1}, big.NewInt(1), 21000, big.NewInt(0), nil)
+	if _, err := signer.SignTx(account, transfer, chainID); err == nil {
+		t.Fatalf("signed a transfer")
+	}
+	valued := types.NewTransaction(0, common.BlockSignersBinary, big.NewInt(1), 200000, big.NewInt(0), nil)
+	if _, err := signer.SignTx(account, valued, chainID); err == nil {
+		t.Fatalf("signed a special transaction moving value")
+	}
+}
@@ -67,8 +67,11 @@ It expects the genesis file or the network name [ mainnet | testnet | devnet ] a
 			utils.CacheFlag,
 			utils.SyncModeFlag,
 			utils.GCModeFlag,
+			utils.TransactionHistoryFlag,
 			utils.CacheDatabaseFlag,
 			utils.CacheGCFlag,
+			utils.SnapshotFlag,
+			utils.CacheSnapshotFlag,
 			utils.MetricsEnabledFlag,
 			utils.MetricsEnabledExpensiveFlag,
 			utils.MetricsEnableInfluxDBFlag,
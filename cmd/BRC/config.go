@@ -29,6 +29,7 @@ import (
 	"unicode"
 
 	"BRDPoSChain/BRCx"
+	"BRDPoSChain/accounts/external"
 	"BRDPoSChain/accounts/keystore"
 	"BRDPoSChain/accounts/scwallet"
 	"BRDPoSChain/accounts/usbwallet"
@@ -256,6 +257,11 @@ func makeFullNode(ctx *cli.Context) (*node.Node, BRCConfig) {
 		utils.RegisterEthStatsService(stack, cfg.Ethstats.URL)
 	}
 
+	// Add the GraphQL endpoint if requested.
+	if ctx.Bool(utils.GraphQLEnabledFlag.Name) {
+		utils.RegisterGraphQLService(stack, &cfg.Eth)
+	}
+
 	return stack, cfg
 }
 
@@ -359,6 +365,15 @@ func setAccountManagerBackends(stack *node.Node) error {
 	// If/when we implement some form of lockfile for USB and keystore wallets,
 	// we can have both, but it's very confusing for the user to see the same
 	// accounts in both externally and locally, plus very racey.
+	if len(conf.ExternalSigner) > 0 {
+		log.Info("Using external signer", "url", conf.ExternalSigner)
+		extapi, err := external.NewExternalBackend(conf.ExternalSigner)
+		if err != nil {
+			return fmt.Errorf("error connecting to external signer: %v", err)
+		}
+		am.AddBackend(extapi)
+		return nil
+	}
 	am.AddBackend(keystore.NewKeyStore(keydir, scryptN, scryptP))
 	if conf.USB {
 		// Start a USB hub for Ledger hardware wallets
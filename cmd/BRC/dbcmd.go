@@ -20,6 +20,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"BRDPoSChain/cmd/utils"
@@ -29,6 +31,7 @@ import (
 	"BRDPoSChain/core/rawdb"
 	"BRDPoSChain/ethdb"
 	"BRDPoSChain/log"
+	"BRDPoSChain/params"
 	"github.com/urfave/cli/v2"
 )
 
@@ -55,6 +58,9 @@ Remove blockchain and state databases`,
 			dbGetCmd,
 			dbDeleteCmd,
 			dbPutCmd,
+			dbImportRewardsCmd,
+			dbFreezeCmd,
+			dbConvertCmd,
 		},
 	}
 	dbInspectCmd = &cli.Command{
@@ -144,6 +150,66 @@ WARNING: This is a low-level operation which may cause database corruption!`,
 		Description: `This command sets a given database key to the given value.
 WARNING: This is a low-level operation which may cause database corruption!`,
 	}
+	dbImportRewardsCmd = &cli.Command{
+		Action:    dbImportRewards,
+		Name:      "import-rewards",
+		Usage:     "Import a reward folder written by --store-reward into the database",
+		ArgsUsage: "[<rewardsFolder>]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.SyncModeFlag,
+			utils.MainnetFlag,
+			utils.TestnetFlag,
+			utils.DevnetFlag,
+		},
+		Description: `This command imports the reward files named <number>.<hash> that older
+releases stored in <datadir>/BRC/rewards (or the given folder) into the chain
+database, indexing them by signer and holder address. The folder is left untouched.`,
+	}
+	dbFreezeCmd = &cli.Command{
+		Action: dbFreeze,
+		Name:   "freeze",
+		Usage:  "Move finalized chain segments into the ancient store",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.MainnetFlag,
+			utils.TestnetFlag,
+			utils.DevnetFlag,
+			utils.CacheFlag,
+			utils.CacheDatabaseFlag,
+			dbFreezeThresholdFlag,
+		},
+		Description: `This command moves every canonical block older than the given threshold
+(default 90000 blocks behind the head) from the key-value store into the ancient
+flat files under --datadir.ancient, deleting it afterwards from the key-value store.
+It is meant to migrate an existing database in one go, a running node freezes new
+blocks in the background.`,
+	}
+	dbConvertCmd = &cli.Command{
+		Action: dbConvert,
+		Name:   "convert",
+		Usage:  "Convert the chain database to another storage engine",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.DBEngineFlag,
+			utils.MainnetFlag,
+			utils.TestnetFlag,
+			utils.DevnetFlag,
+			utils.CacheFlag,
+			utils.CacheDatabaseFlag,
+		},
+		Description: `This command copies every entry of the chaindata key-value store into a fresh
+database of the engine chosen with --db.engine. The ancient store, if kept inside
+chaindata, is moved along. Once the copy completes, the new database takes the
+place of chaindata and the old one is kept next to it as chaindata.<engine>.bak,
+to be removed by hand once the node runs fine. The node must not be running.`,
+	}
+	dbFreezeThresholdFlag = &cli.Uint64Flag{
+		Name:  "threshold",
+		Usage: "Number of recent blocks to keep in the key-value store",
+		Value: params.ImmutabilityThreshold,
+	}
 )
 
 func removeDB(ctx *cli.Context) error {
@@ -354,3 +420,172 @@ func dbPut(ctx *cli.Context) error {
 	}
 	return db.Put(key, value)
 }
+
+// dbImportRewards migrates a legacy reward folder into the database
+func dbImportRewards(ctx *cli.Context) error {
+	if ctx.NArg() > 1 {
+		return fmt.Errorf("max 1 argument: %v", ctx.Command.ArgsUsage)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	folder := filepath.Join(stack.DataDir(), "BRC", "rewards")
+	if ctx.NArg() == 1 {
+		folder = ctx.Args().First()
+	}
+	files, err := os.ReadDir(folder)
+	if err != nil {
+		return err
+	}
+	db := utils.MakeChainDatabase(ctx, stack, false)
+	defer db.Close()
+
+	var (
+		start    = time.Now()
+		batch    = db.NewBatch()
+		imported int
+		skipped  int
+	)
+	for _, file := range files {
+		name := file.Name()
+		parts := strings.Split(name, ".")
+		if file.IsDir() || len(parts) != 2 {
+			log.Warn("Skipping unknown reward file", "name", name)
+			skipped++
+			continue
+		}
+		number, err := strconv.ParseUint(parts[0], 10, 64)
+		if err != nil {
+			log.Warn("Skipping reward file with invalid number", "name", name, "err", err)
+			skipped++
+			continue
+		}
+		hash, err := hexutil.Decode(parts[1])
+		if err != nil || len(hash) != common.HashLength {
+			log.Warn("Skipping reward file with invalid hash", "name", name)
+			skipped++
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(folder, name))
+		if err != nil {
+			return err
+		}
+		if err := rawdb.WriteRewards(batch, common.BytesToHash(hash), number, data); err != nil {
+			log.Warn("Skipping invalid reward file", "name", name, "err", err)
+			skipped++
+			continue
+		}
+		imported++
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Info("Imported rewards", "folder", folder, "imported", imported, "skipped", skipped, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// dbFreeze migrates finalized chain segments into the ancient store
+func dbFreeze(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack, false)
+	defer db.Close()
+
+	start := time.Now()
+	before, _ := db.Ancients()
+	if err := rawdb.FreezeAncients(db, ctx.Uint64(dbFreezeThresholdFlag.Name)); err != nil {
+		return err
+	}
+	after, _ := db.Ancients()
+	log.Info("Froze chain segments", "blocks", after-before, "ancients", after, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// dbConvert copies the chain database into a fresh key-value store of another
+// engine and swaps the two afterwards.
+func dbConvert(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	var (
+		src    = stack.ResolvePath("chaindata")
+		dst    = src + ".convert"
+		engine = ctx.String(utils.DBEngineFlag.Name)
+		cache  = ctx.Int(utils.CacheFlag.Name) * ctx.Int(utils.CacheDatabaseFlag.Name) / 100
+	)
+	existing := rawdb.PreexistingDatabase(src)
+	switch {
+	case existing == "":
+		return fmt.Errorf("no chain database found at %s", src)
+	case existing == engine:
+		return fmt.Errorf("chain database at %s already uses %s", src, engine)
+	case common.FileExist(dst):
+		return fmt.Errorf("leftover conversion found at %s, remove it first", dst)
+	}
+	from, err := rawdb.NewKeyValueStore(existing, src, cache/2, 0, "", true)
+	if err != nil {
+		return err
+	}
+	to, err := rawdb.NewKeyValueStore(engine, dst, cache/2, 0, "", false)
+	if err != nil {
+		from.Close()
+		return err
+	}
+	var (
+		start  = time.Now()
+		logged = time.Now()
+		count  uint64
+		batch  = to.NewBatch()
+		it     = from.NewIterator(nil, nil)
+	)
+	for it.Next() {
+		batch.Put(it.Key(), it.Value())
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err = batch.Write(); err != nil {
+				break
+			}
+			batch.Reset()
+		}
+		count++
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Converting chain database", "entries", count, "key", common.Bytes2Hex(it.Key()), "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err == nil {
+		err = it.Error()
+	}
+	it.Release()
+	if err == nil {
+		err = batch.Write()
+	}
+	from.Close()
+	if cerr := to.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	// Move the ancients along if they live inside chaindata, then swap the databases
+	if ancient := filepath.Join(src, "ancient"); common.FileExist(ancient) {
+		if err := os.Rename(ancient, filepath.Join(dst, "ancient")); err != nil {
+			return err
+		}
+	}
+	backup := src + "." + existing + ".bak"
+	if err := os.Rename(src, backup); err != nil {
+		return err
+	}
+	if err := os.Rename(dst, src); err != nil {
+		return err
+	}
+	log.Info("Converted chain database", "engine", engine, "entries", count, "backup", backup, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
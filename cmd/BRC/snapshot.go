@@ -0,0 +1,207 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"BRDPoSChain/cmd/utils"
+	"BRDPoSChain/common"
+	"BRDPoSChain/core/rawdb"
+	"BRDPoSChain/core/state/pruner"
+	"BRDPoSChain/core/state/snapshot"
+	"BRDPoSChain/ethdb"
+	"BRDPoSChain/log"
+	"BRDPoSChain/trie"
+	"github.com/prometheus/prometheus/util/flock"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	snapshotCommand = &cli.Command{
+		Name:        "snapshot",
+		Usage:       "A set of commands based on the state of the recent blocks",
+		ArgsUsage:   "",
+		Description: "",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "prune-state",
+				Usage:     "Prune stale state data not reachable from the recent states",
+				ArgsUsage: "<root>",
+				Action:    pruneState,
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.MainnetFlag,
+					utils.TestnetFlag,
+					utils.DevnetFlag,
+					utils.CacheFlag,
+					utils.CacheDatabaseFlag,
+					utils.BloomFilterSizeFlag,
+				},
+				Description: `
+BRC snapshot prune-state <state-root>
+will prune the historical state data with the help of a state bloom filter. All
+the trie nodes and contract codes reachable from the states of the blocks between
+the given state and the chain head are kept, together with the BRCx trading and
+lending states committed by those blocks. Everything else is deleted from the
+chain and BRCx databases, which are compacted afterwards.
+
+If the state root is not specified, the state of HEAD-127 is picked. Otherwise
+the state root must belong to a recent canonical block.
+
+The node must be stopped while pruning. The state bloom is persisted in the data
+directory before anything is deleted; if the pruning is interrupted, running the
+command again resumes the deletion. Note the bloom filter is probabilistic, so a
+small amount of stale data is left behind.
+`,
+			},
+			{
+				Name:      "verify",
+				Usage:     "Recalculate state hash based on the snapshot for verification",
+				ArgsUsage: "<root>",
+				Action:    verifyState,
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.MainnetFlag,
+					utils.TestnetFlag,
+					utils.DevnetFlag,
+					utils.CacheFlag,
+					utils.CacheDatabaseFlag,
+					utils.CacheSnapshotFlag,
+				},
+				Description: `
+BRC snapshot verify <state-root>
+will compare the flat state snapshot of the given state root with the account
+and storage tries, entry by entry. If the snapshot generation was interrupted,
+it's resumed and finished first.
+
+If the state root is not specified, the state of the chain head is verified.
+The snapshot keeps the diff layers of the recent blocks only, so older states
+can't be verified.
+`,
+			},
+		},
+	}
+)
+
+// pruneState marks the retained states and deletes everything else from the
+// chain and BRCx databases.
+func pruneState(ctx *cli.Context) error {
+	if ctx.NArg() > 1 {
+		return errors.New("too many arguments")
+	}
+	var root common.Hash
+	if ctx.NArg() == 1 {
+		var err error
+		if root, err = parseRoot(ctx.Args().First()); err != nil {
+			return err
+		}
+	}
+	stack, cfg := makeConfigNode(ctx)
+	defer stack.Close()
+
+	// Grab the instance lock, so the pruning never races with a running node
+	instdir := stack.InstanceDir()
+	if !common.FileExist(instdir) {
+		return fmt.Errorf("no node data found at %s", instdir)
+	}
+	release, _, err := flock.New(filepath.Join(instdir, "LOCK"))
+	if err != nil {
+		return fmt.Errorf("datadir %s is in use, stop the node first: %v", instdir, err)
+	}
+	defer release.Release()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack, false)
+	defer chaindb.Close()
+
+	// The BRCx tries are kept in a leveldb of their own, prune it along
+	var BRCxdb ethdb.Database
+	if rawdb.PreexistingDatabase(cfg.BRCX.DataDir) == rawdb.DBLeveldb {
+		if BRCxdb, err = rawdb.NewLevelDBDatabase(cfg.BRCX.DataDir, 128, 1024, "", false); err != nil {
+			return fmt.Errorf("failed to open BRCx database: %v", err)
+		}
+		defer BRCxdb.Close()
+	}
+	pruner, err := pruner.NewPruner(chaindb, BRCxdb, pruner.Config{
+		Datadir:   instdir,
+		BloomSize: ctx.Uint64(utils.BloomFilterSizeFlag.Name),
+	})
+	if err != nil {
+		log.Error("Failed to open state pruner", "err", err)
+		return err
+	}
+	if err = pruner.Prune(root); err != nil {
+		log.Error("Failed to prune state", "err", err)
+		return err
+	}
+	return nil
+}
+
+// verifyState compares the flat state snapshot of the given state root with
+// the state tries.
+func verifyState(ctx *cli.Context) error {
+	if ctx.NArg() > 1 {
+		return errors.New("too many arguments")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack, false)
+	defer chaindb.Close()
+
+	headHash := rawdb.ReadHeadBlockHash(chaindb)
+	number := rawdb.ReadHeaderNumber(chaindb, headHash)
+	if number == nil {
+		return errors.New("failed to load head block")
+	}
+	head := rawdb.ReadHeader(chaindb, headHash, *number)
+	if head == nil {
+		return errors.New("failed to load head block")
+	}
+	root := head.Root
+	if ctx.NArg() == 1 {
+		var err error
+		if root, err = parseRoot(ctx.Args().First()); err != nil {
+			return err
+		}
+	}
+	cache := ctx.Int(utils.CacheFlag.Name) * ctx.Int(utils.CacheSnapshotFlag.Name) / 100
+	snaptree, err := snapshot.New(chaindb, trie.NewDatabase(chaindb), cache, head.Root, false, false)
+	if err != nil {
+		log.Error("Failed to open snapshot tree", "err", err)
+		return err
+	}
+	if err := snaptree.Verify(root); err != nil {
+		log.Error("Failed to verify state", "root", root, "err", err)
+		return err
+	}
+	log.Info("Verified the state", "root", root)
+	return nil
+}
+
+// parseRoot parses a hex encoded state root.
+func parseRoot(input string) (common.Hash, error) {
+	var h common.Hash
+	if err := h.UnmarshalText([]byte(input)); err != nil {
+		return h, err
+	}
+	return h, nil
+}
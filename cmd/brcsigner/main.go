@@ -0,0 +1,100 @@
+// Copyright (c) 2024 BRDPoSChain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// brcsigner runs a signer process holding a masternode key outside of the node, see --signer of BRC.
+package main
+
+import (
+	"flag"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"BRDPoSChain/accounts/external"
+	"BRDPoSChain/accounts/keystore"
+	"BRDPoSChain/cmd/utils"
+	"BRDPoSChain/console"
+	"BRDPoSChain/crypto/bls"
+	"BRDPoSChain/log"
+	"BRDPoSChain/rpc"
+)
+
+func main() {
+	var (
+		keyFile      = flag.String("keyfile", "", "keystore file of the masternode key")
+		passwordFile = flag.String("passwordfile", "", "file containing the password of the keystore file")
+		blsKeyFile   = flag.String("blskeyfile", "", "file holding the hex encoded BLS key to sign votes and timeouts with after the BLS fork")
+		stateFile    = flag.String("state", "brcsigner.json", "file persisting the last vote signed")
+		ipcPath      = flag.String("ipcpath", "brcsigner.ipc", "IPC socket to serve the signer on, only accessible to its owner")
+		verbosity    = flag.Int("verbosity", int(log.LvlInfo), "log verbosity (0-9)")
+	)
+	flag.Parse()
+
+	glogger := log.NewGlogHandler(log.NewTerminalHandler(os.Stderr, false))
+	glogger.Verbosity(log.FromLegacyLevel(*verbosity))
+	log.SetDefault(log.NewLogger(glogger))
+
+	if *keyFile == "" {
+		utils.Fatalf("Use -keyfile to specify the masternode key")
+	}
+	if *ipcPath == "" {
+		utils.Fatalf("Use -ipcpath to serve the signer")
+	}
+	keyjson, err := os.ReadFile(*keyFile)
+	if err != nil {
+		utils.Fatalf("Failed to read the keyfile at '%s': %v", *keyFile, err)
+	}
+	var password string
+	if *passwordFile != "" {
+		content, err := os.ReadFile(*passwordFile)
+		if err != nil {
+			utils.Fatalf("Failed to read password file '%s': %v", *passwordFile, err)
+		}
+		password = strings.TrimRight(string(content), "\r\n")
+	} else if password, err = console.Stdin.PromptPassword("Passphrase: "); err != nil {
+		utils.Fatalf("Failed to read passphrase: %v", err)
+	}
+	key, err := keystore.DecryptKey(keyjson, password)
+	if err != nil {
+		utils.Fatalf("Error decrypting key: %v", err)
+	}
+	var blsKey *bls.SecretKey
+	if *blsKeyFile != "" {
+		if blsKey, err = bls.LoadKey(*blsKeyFile); err != nil {
+			utils.Fatalf("Failed to load the BLS key at '%s': %v", *blsKeyFile, err)
+		}
+	}
+	service, err := external.NewSignerService(key.PrivateKey, blsKey, *stateFile)
+	if err != nil {
+		utils.Fatalf("Failed to create signer: %v", err)
+	}
+	log.Info("Starting signer", "address", key.Address, "bls", blsKey != nil, "state", *stateFile)
+
+	// The signer signs whatever consensus messages it's handed, so it's only served on an IPC socket
+	// restricted to its owner, never over the network
+	listener, srv, err := rpc.StartIPCEndpoint(*ipcPath, service.APIs())
+	if err != nil {
+		utils.Fatalf("Could not start IPC endpoint: %v", err)
+	}
+	defer srv.Stop()
+	defer listener.Close()
+	log.Info("IPC endpoint opened", "url", *ipcPath)
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	<-sigc
+	log.Info("Shutting down signer")
+}
@@ -40,6 +40,7 @@ import (
 	"BRDPoSChain/consensus/BRDPoS"
 	"BRDPoSChain/consensus/ethash"
 	"BRDPoSChain/core"
+	"BRDPoSChain/core/rawdb"
 	"BRDPoSChain/core/txpool"
 	"BRDPoSChain/core/vm"
 	"BRDPoSChain/crypto"
@@ -83,6 +84,23 @@ var (
 		Value:    flags.DirectoryString(node.DefaultDataDir()),
 		Category: flags.EthCategory,
 	}
+	DBEngineFlag = &cli.StringFlag{
+		Name:     "db.engine",
+		Usage:    "Backing database implementation to use for new databases ('leveldb' or 'pebble')",
+		Value:    "leveldb",
+		Category: flags.EthCategory,
+	}
+	BloomFilterSizeFlag = &cli.Uint64Flag{
+		Name:     "bloomfilter.size",
+		Usage:    "Megabytes of memory allocated to bloom-filter for pruning",
+		Value:    2048,
+		Category: flags.EthCategory,
+	}
+	AncientFlag = &flags.DirectoryFlag{
+		Name:     "datadir.ancient",
+		Usage:    "Data directory for ancient chain segments (default = inside chaindata)",
+		Category: flags.EthCategory,
+	}
 	KeyStoreDirFlag = &flags.DirectoryFlag{
 		Name:     "keystore",
 		Usage:    "Directory for the keystore (default = inside the datadir)",
@@ -99,6 +117,11 @@ var (
 		Value:    pcsclite.PCSCDSockName,
 		Category: flags.AccountCategory,
 	}
+	ExternalSignerFlag = &cli.StringFlag{
+		Name:     "signer",
+		Usage:    "External signer holding the masternode key (path to ipc file)",
+		Category: flags.AccountCategory,
+	}
 	NetworkIdFlag = &cli.Uint64Flag{
 		Name:     "networkid",
 		Usage:    "Network identifier (integer, 89=BRDPoSChain)",
@@ -149,7 +172,7 @@ var (
 
 	SyncModeFlag = &cli.StringFlag{
 		Name:     "syncmode",
-		Usage:    `Blockchain sync mode ("fast", "full", or "light")`,
+		Usage:    `Blockchain sync mode ("fast", "full", "snap" or "light")`,
 		Value:    ethconfig.Defaults.SyncMode.String(),
 		Category: flags.EthCategory,
 	}
@@ -159,6 +182,18 @@ var (
 		Value:    "full",
 		Category: flags.EthCategory,
 	}
+	SnapshotFlag = &cli.BoolFlag{
+		Name:     "snapshot",
+		Usage:    `Enables snapshot-database mode (default = enable)`,
+		Value:    true,
+		Category: flags.EthCategory,
+	}
+	TransactionHistoryFlag = &cli.Uint64Flag{
+		Name:     "history.transactions",
+		Usage:    "Number of recent blocks to maintain transactions index for (default = 0, entire chain)",
+		Value:    ethconfig.Defaults.TxLookupLimit,
+		Category: flags.EthCategory,
+	}
 	LightKDFFlag = &cli.BoolFlag{
 		Name:     "lightkdf",
 		Usage:    "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
@@ -316,6 +351,13 @@ var (
 		Value:    25,
 		Category: flags.PerfCategory,
 	}
+	CacheSnapshotFlag = &cli.IntFlag{
+		Name:     "cache-snapshot",
+		Aliases:  []string{"cache.snapshot"},
+		Usage:    "Percentage of cache memory allowance to use for snapshot caching (default = 10%)",
+		Value:    10,
+		Category: flags.PerfCategory,
+	}
 	CacheLogSizeFlag = &cli.IntFlag{
 		Name:     "cache-blocklogs",
 		Aliases:  []string{"cache.blocklogs"},
@@ -364,6 +406,11 @@ var (
 		Value:    "0x000000000000000000000000000000000000abcd",
 		Category: flags.MinerCategory,
 	}
+	MinerBLSKeyFileFlag = &cli.StringFlag{
+		Name:     "miner-blskey",
+		Usage:    "File holding the hex encoded BLS key to sign consensus votes and timeouts with after the BLS fork, unless an external signer is used",
+		Category: flags.MinerCategory,
+	}
 	MinerExtraDataFlag = &cli.StringFlag{
 		Name:     "miner-extradata",
 		Aliases:  []string{"extradata"},
@@ -532,6 +579,51 @@ var (
 		Value:    "*",
 		Category: flags.APICategory,
 	}
+	GraphQLEnabledFlag = &cli.BoolFlag{
+		Name:     "graphql",
+		Usage:    "Enable GraphQL on the HTTP-RPC server. Note that GraphQL can only be started if an HTTP server is started as well.",
+		Category: flags.APICategory,
+	}
+	AuthEnabledFlag = &cli.BoolFlag{
+		Name:     "authrpc",
+		Usage:    "Enable the JWT authenticated RPC server serving the admin, debug and personal APIs",
+		Category: flags.APICategory,
+	}
+	AuthListenFlag = &cli.StringFlag{
+		Name:     "authrpc.addr",
+		Usage:    "Listening address for authenticated APIs",
+		Value:    node.DefaultAuthHost,
+		Category: flags.APICategory,
+	}
+	AuthPortFlag = &cli.IntFlag{
+		Name:     "authrpc.port",
+		Usage:    "Listening port for authenticated APIs",
+		Value:    node.DefaultAuthPort,
+		Category: flags.APICategory,
+	}
+	AuthVirtualHostsFlag = &cli.StringFlag{
+		Name:     "authrpc.vhosts",
+		Usage:    "Comma separated list of virtual hostnames from which to accept requests (server enforced). Accepts '*' wildcard.",
+		Value:    strings.Join(node.DefaultConfig.AuthVirtualHosts, ","),
+		Category: flags.APICategory,
+	}
+	JWTSecretFlag = &flags.DirectoryFlag{
+		Name:     "authrpc.jwtsecret",
+		Usage:    "Path to a JWT secret to use for authenticated RPC endpoints",
+		Category: flags.APICategory,
+	}
+	BatchRequestLimitFlag = &cli.IntFlag{
+		Name:     "rpc.batch-request-limit",
+		Usage:    "Maximum number of requests in a batch (0 = unlimited)",
+		Value:    node.DefaultBatchRequestLimit,
+		Category: flags.APICategory,
+	}
+	BatchResponseMaxSizeFlag = &cli.IntFlag{
+		Name:     "rpc.batch-response-max-size",
+		Usage:    "Maximum number of bytes returned from a batched call (0 = unlimited)",
+		Value:    node.DefaultBatchResponseMaxSize,
+		Category: flags.APICategory,
+	}
 	ExecFlag = &cli.StringFlag{
 		Name:     "exec",
 		Usage:    "Execute JavaScript statement",
@@ -753,7 +845,7 @@ var (
 	}
 	StoreRewardFlag = &cli.BoolFlag{
 		Name:     "store-reward",
-		Usage:    "Store reward to file",
+		Usage:    "Store checkpoint rewards in the chain database",
 		Value:    false,
 		Category: flags.MiscCategory,
 	}
@@ -792,7 +884,7 @@ var (
 	BRCXDBEngineFlag = &cli.StringFlag{
 		Name:     "BRCx-dbengine",
 		Aliases:  []string{"BRCx.dbengine"},
-		Usage:    "Database engine for BRCX (leveldb, mongodb)",
+		Usage:    "Database engine for BRCX (leveldb, mongodb, embedded)",
 		Value:    "leveldb",
 		Category: flags.BrcxCategory,
 	}
@@ -816,6 +908,13 @@ var (
 		Usage:    "ReplicaSetName if Master-Slave is setup",
 		Category: flags.BrcxCategory,
 	}
+	BRCXCandleIntervalsFlag = &cli.StringFlag{
+		Name:     "BRCx-candleintervals",
+		Aliases:  []string{"BRCx.candleintervals"},
+		Usage:    "Comma separated intervals of the OHLCV candles built from BRCX trades (s, m, h, d units)",
+		Value:    "1m,5m,1h,1d",
+		Category: flags.BrcxCategory,
+	}
 )
 
 // MakeDataDir retrieves the currently requested data directory, terminating
@@ -1018,6 +1117,29 @@ func setWS(ctx *cli.Context, cfg *node.Config) {
 	cfg.WSModules = SplitAndTrim(ctx.String(WSApiFlag.Name))
 }
 
+// setAuth configures the authenticated RPC listener and the JWT secret it
+// verifies tokens with from the set command line flags.
+func setAuth(ctx *cli.Context, cfg *node.Config) {
+	if ctx.Bool(AuthEnabledFlag.Name) {
+		cfg.AuthAddr = ctx.String(AuthListenFlag.Name)
+	}
+	if ctx.IsSet(AuthPortFlag.Name) {
+		cfg.AuthPort = ctx.Int(AuthPortFlag.Name)
+	}
+	if ctx.IsSet(AuthVirtualHostsFlag.Name) {
+		cfg.AuthVirtualHosts = SplitAndTrim(ctx.String(AuthVirtualHostsFlag.Name))
+	}
+	if ctx.IsSet(JWTSecretFlag.Name) {
+		cfg.JWTSecret = ctx.String(JWTSecretFlag.Name)
+	}
+	if ctx.IsSet(BatchRequestLimitFlag.Name) {
+		cfg.BatchRequestLimit = ctx.Int(BatchRequestLimitFlag.Name)
+	}
+	if ctx.IsSet(BatchResponseMaxSizeFlag.Name) {
+		cfg.BatchResponseMaxSize = ctx.Int(BatchResponseMaxSizeFlag.Name)
+	}
+}
+
 // setIPC creates an IPC path configuration from the set command line flags,
 // returning an empty string if IPC was explicitly disabled, or the set path.
 func setIPC(ctx *cli.Context, cfg *node.Config) {
@@ -1191,6 +1313,7 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	setIPC(ctx, cfg)
 	setHTTP(ctx, cfg)
 	setWS(ctx, cfg)
+	setAuth(ctx, cfg)
 	setNodeUserIdent(ctx, cfg)
 	setPrefix(ctx, cfg)
 	setSmartCard(ctx, cfg)
@@ -1206,9 +1329,22 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 		cfg.DataDir = filepath.Join(node.DefaultDataDir(), "devnet")
 	}
 
+	if ctx.IsSet(DBEngineFlag.Name) {
+		dbEngine := ctx.String(DBEngineFlag.Name)
+		if dbEngine != rawdb.DBLeveldb && dbEngine != rawdb.DBPebble {
+			Fatalf("Invalid choice for db.engine '%s', allowed 'leveldb' or 'pebble'", dbEngine)
+		}
+		if dbEngine == rawdb.DBPebble && !rawdb.PebbleEnabled {
+			Fatalf("Pebble is not supported on this platform")
+		}
+		cfg.DBEngine = dbEngine
+	}
 	if ctx.IsSet(KeyStoreDirFlag.Name) {
 		cfg.KeyStoreDir = ctx.String(KeyStoreDirFlag.Name)
 	}
+	if ctx.IsSet(ExternalSignerFlag.Name) {
+		cfg.ExternalSigner = ctx.String(ExternalSignerFlag.Name)
+	}
 	if ctx.IsSet(LightKDFFlag.Name) {
 		cfg.UseLightweightKDF = ctx.Bool(LightKDFFlag.Name)
 	}
@@ -1390,6 +1526,9 @@ func SetBRCXConfig(ctx *cli.Context, cfg *BRCx.Config, BRCDataDir string) {
 	if ctx.IsSet(BRCXDBReplicaSetNameFlag.Name) {
 		cfg.ReplicaSetName = ctx.String(BRCXDBReplicaSetNameFlag.Name)
 	}
+	if ctx.IsSet(BRCXCandleIntervalsFlag.Name) {
+		cfg.CandleIntervals = strings.Split(ctx.String(BRCXCandleIntervalsFlag.Name), ",")
+	}
 }
 
 // SetEthConfig applies eth-related command line flags to the config.
@@ -1443,18 +1582,33 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 		cfg.DatabaseCache = ctx.Int(CacheFlag.Name) * ctx.Int(CacheDatabaseFlag.Name) / 100
 	}
 	cfg.DatabaseHandles = MakeDatabaseHandles(ctx.Int(FDLimitFlag.Name))
+	if ctx.IsSet(AncientFlag.Name) {
+		cfg.DatabaseFreezer = ctx.String(AncientFlag.Name)
+	}
 
 	if gcmode := ctx.String(GCModeFlag.Name); gcmode != "full" && gcmode != "archive" {
 		Fatalf("--%s must be either 'full' or 'archive'", GCModeFlag.Name)
 	}
 	cfg.NoPruning = ctx.String(GCModeFlag.Name) == "archive"
+	if ctx.IsSet(TransactionHistoryFlag.Name) {
+		cfg.TxLookupLimit = ctx.Uint64(TransactionHistoryFlag.Name)
+	}
 
 	if ctx.IsSet(CacheFlag.Name) || ctx.IsSet(CacheGCFlag.Name) {
 		cfg.TrieCache = ctx.Int(CacheFlag.Name) * ctx.Int(CacheGCFlag.Name) / 100
 	}
+	if ctx.IsSet(CacheFlag.Name) || ctx.IsSet(CacheSnapshotFlag.Name) {
+		cfg.SnapshotCache = ctx.Int(CacheFlag.Name) * ctx.Int(CacheSnapshotFlag.Name) / 100
+	}
+	if !ctx.Bool(SnapshotFlag.Name) {
+		cfg.SnapshotCache = 0 // Disabled
+	}
 	if ctx.IsSet(MinerThreadsFlag.Name) {
 		cfg.MinerThreads = ctx.Int(MinerThreadsFlag.Name)
 	}
+	if ctx.IsSet(MinerBLSKeyFileFlag.Name) {
+		cfg.BLSKeyFile = ctx.String(MinerBLSKeyFileFlag.Name)
+	}
 	if ctx.IsSet(DocRootFlag.Name) {
 		cfg.DocRoot = ctx.String(DocRootFlag.Name)
 	}
@@ -1484,10 +1638,7 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 		log.Info("Global gas cap disabled")
 	}
 	if ctx.IsSet(StoreRewardFlag.Name) {
-		common.StoreRewardFolder = filepath.Join(stack.DataDir(), "BRC", "rewards")
-		if _, err := os.Stat(common.StoreRewardFolder); os.IsNotExist(err) {
-			os.Mkdir(common.StoreRewardFolder, os.ModePerm)
-		}
+		common.StoreReward = ctx.Bool(StoreRewardFlag.Name)
 	}
 	// Override any default configs for hard coded networks.
 	switch {
@@ -1611,11 +1762,15 @@ func MakeChainDatabase(ctx *cli.Context, stack *node.Node, readonly bool) ethdb.
 		cache   = ctx.Int(CacheFlag.Name) * ctx.Int(CacheDatabaseFlag.Name) / 100
 		handles = MakeDatabaseHandles(ctx.Int(FDLimitFlag.Name))
 	)
-	name := "chaindata"
+	var (
+		chainDb ethdb.Database
+		err     error
+	)
 	if ctx.String(SyncModeFlag.Name) == "light" {
-		name = "lightchaindata"
+		chainDb, err = stack.OpenDatabase("lightchaindata", cache, handles, "", readonly)
+	} else {
+		chainDb, err = stack.OpenDatabaseWithFreezer("chaindata", cache, handles, ctx.String(AncientFlag.Name), "", readonly)
 	}
-	chainDb, err := stack.OpenDatabase(name, cache, handles, "", readonly)
 	if err != nil {
 		Fatalf("Could not open database: %v", err)
 	}
@@ -1670,10 +1825,18 @@ func MakeChain(ctx *cli.Context, stack *node.Node, readonly bool) (chain *core.B
 		Disabled:      ctx.String(GCModeFlag.Name) == "archive",
 		TrieNodeLimit: ethconfig.Defaults.TrieCache,
 		TrieTimeLimit: ethconfig.Defaults.TrieTimeout,
+		TxLookupLimit: ctx.Uint64(TransactionHistoryFlag.Name),
+		SnapshotLimit: ethconfig.Defaults.SnapshotCache,
 	}
 	if ctx.IsSet(CacheFlag.Name) || ctx.IsSet(CacheGCFlag.Name) {
 		cache.TrieNodeLimit = ctx.Int(CacheFlag.Name) * ctx.Int(CacheGCFlag.Name) / 100
 	}
+	if ctx.IsSet(CacheFlag.Name) || ctx.IsSet(CacheSnapshotFlag.Name) {
+		cache.SnapshotLimit = ctx.Int(CacheFlag.Name) * ctx.Int(CacheSnapshotFlag.Name) / 100
+	}
+	if !ctx.Bool(SnapshotFlag.Name) {
+		cache.SnapshotLimit = 0 // Disabled
+	}
 	vmcfg := vm.Config{EnablePreimageRecording: ctx.Bool(VMEnableDebugFlag.Name)}
 	chain, err = core.NewBlockChain(chainDb, cache, config, engine, vmcfg)
 	if err != nil {
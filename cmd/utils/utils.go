@@ -10,7 +10,9 @@ import (
 	"BRDPoSChain/eth"
 	"BRDPoSChain/eth/downloader"
 	"BRDPoSChain/eth/ethconfig"
+	"BRDPoSChain/eth/filters"
 	"BRDPoSChain/ethstats"
+	"BRDPoSChain/graphql"
 	"BRDPoSChain/les"
 	"BRDPoSChain/metrics"
 	"BRDPoSChain/node"
@@ -73,6 +75,26 @@ func RegisterEthStatsService(stack *node.Node, url string) {
 	}
 }
 
+// RegisterGraphQLService adds the GraphQL endpoint to the HTTP RPC server of
+// the node, serving the chain data of the full Ethereum service.
+func RegisterGraphQLService(stack *node.Node, cfg *ethconfig.Config) {
+	if stack.Config().HTTPHost == "" {
+		Fatalf("GraphQL requires the HTTP-RPC server to be enabled")
+	}
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		var ethServ *eth.Ethereum
+		if err := ctx.Service(&ethServ); err != nil {
+			return nil, fmt.Errorf("GraphQL requires a full node: %v", err)
+		}
+		filterSystem := filters.NewFilterSystem(ethServ.ApiBackend, filters.Config{
+			LogCacheSize: cfg.FilterLogCacheSize,
+		})
+		return graphql.New(ctx, ethServ.ApiBackend, ethServ.BlockChain(), filterSystem)
+	}); err != nil {
+		Fatalf("Failed to register the GraphQL service: %v", err)
+	}
+}
+
 func RegisterBRCXService(stack *node.Node, cfg *BRCx.Config) {
 	BRCX := BRCx.New(cfg)
 	if err := stack.Register(func(n *node.ServiceContext) (node.Service, error) {
@@ -15,6 +15,7 @@ const (
 	MaxMasternodes             = 18
 	LimitPenaltyEpoch          = 4
 	LimitPenaltyEpochV2        = 0
+	LimitSlashingEpochV2       = 1 // a vote equivocation is slashable until the end of the epoch after its round
 	LimitThresholdNonceInQueue = 10
 	DefaultMinGasPrice         = 250000000
 	MergeSignRange             = 15
@@ -40,12 +41,15 @@ var (
 
 	RollbackHash Hash
 
-	StoreRewardFolder string
+	StoreReward bool
 
 	TRC21GasPriceBefore = big.NewInt(2500)
 	TRC21GasPrice       = big.NewInt(250000000)
 	MinGasPrice         = big.NewInt(DefaultMinGasPrice)
 
+	SlashingRate = big.NewInt(10) // 10% of the owner stake is burned for a proven vote equivocation
+	BaseSlashing = big.NewInt(100)
+
 	// BRCx and BRCxlending
 	BasePrice         = big.NewInt(1000000000000000000)               // 1
 	RelayerLockedFund = big.NewInt(20000)                             // 20000 BRC
@@ -60,6 +64,8 @@ var (
 	RateTopUp               = big.NewInt(90) // 90%
 	BaseTopUp               = big.NewInt(100)
 	BaseRecall              = big.NewInt(100)
+	RateLiquidationReward   = big.NewInt(1) // 1% of the collateral sold by a partial liquidation, 0 disables the keeper reward
+	BaseLiquidationReward   = big.NewInt(100)
 	BaseLendingInterest     = big.NewInt(100000000)         // 1e8
 	RelayerLendingFee       = big.NewInt(10000000000000000) // 0.01
 	RelayerLendingCancelFee = big.NewInt(1000000000000000)  // 0.001
@@ -91,6 +97,10 @@ type constant struct {
 	tipBRCXReceiverDisable        *big.Int
 	eip1559Block                  *big.Int
 	cancunBlock                   *big.Int
+	tipBRCXOrderTypes             *big.Int
+	tipBRCXPartialLiquidation     *big.Int
+	tipSlashing                   *big.Int
+	tipBLS                        *big.Int
 
 	trc21IssuerSMCTestNet Address
 	trc21IssuerSMC        Address
@@ -101,6 +111,7 @@ type constant struct {
 	relayerRegistrationSMCTestnet Address
 	lendingRegistrationSMC        Address
 	lendingRegistrationSMCTestnet Address
+	lendingLiquidator             Address // receives the keeper reward of partial liquidations, the block producer if empty
 
 	ignoreSignerCheckBlockArray map[uint64]struct{}
 
@@ -132,6 +143,10 @@ var (
 	TIPBRCXReceiverDisable        = MaintnetConstant.tipBRCXReceiverDisable
 	Eip1559Block                  = MaintnetConstant.eip1559Block
 	CancunBlock                   = MaintnetConstant.cancunBlock
+	TIPBRCXOrderTypes             = MaintnetConstant.tipBRCXOrderTypes
+	TIPBRCXPartialLiquidation     = MaintnetConstant.tipBRCXPartialLiquidation
+	TIPSlashing                   = MaintnetConstant.tipSlashing
+	TIPBLS                        = MaintnetConstant.tipBLS
 
 	TRC21IssuerSMCTestNet = MaintnetConstant.trc21IssuerSMCTestNet
 	TRC21IssuerSMC        = MaintnetConstant.trc21IssuerSMC
@@ -142,6 +157,7 @@ var (
 	RelayerRegistrationSMCTestnet = MaintnetConstant.relayerRegistrationSMCTestnet
 	LendingRegistrationSMC        = MaintnetConstant.lendingRegistrationSMC
 	LendingRegistrationSMCTestnet = MaintnetConstant.lendingRegistrationSMCTestnet
+	LendingLiquidator             = MaintnetConstant.lendingLiquidator
 
 	ignoreSignerCheckBlockArray = MaintnetConstant.ignoreSignerCheckBlockArray
 	blacklist                   = MaintnetConstant.blacklist
@@ -197,6 +213,10 @@ func CopyConstans(chainID uint64) {
 	TIPBRCXReceiverDisable = c.tipBRCXReceiverDisable
 	Eip1559Block = c.eip1559Block
 	CancunBlock = c.cancunBlock
+	TIPBRCXOrderTypes = c.tipBRCXOrderTypes
+	TIPBRCXPartialLiquidation = c.tipBRCXPartialLiquidation
+	TIPSlashing = c.tipSlashing
+	TIPBLS = c.tipBLS
 
 	TRC21IssuerSMCTestNet = c.trc21IssuerSMCTestNet
 	TRC21IssuerSMC = c.trc21IssuerSMC
@@ -207,6 +227,7 @@ func CopyConstans(chainID uint64) {
 	RelayerRegistrationSMCTestnet = c.relayerRegistrationSMCTestnet
 	LendingRegistrationSMC = c.lendingRegistrationSMC
 	LendingRegistrationSMCTestnet = c.lendingRegistrationSMCTestnet
+	LendingLiquidator = c.lendingLiquidator
 
 	clear(ignoreSignerCheckBlockArray)
 	maps.Copy(ignoreSignerCheckBlockArray, c.ignoreSignerCheckBlockArray)
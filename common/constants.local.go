@@ -30,6 +30,10 @@ var localConstant = constant{
 	tipBRCXReceiverDisable:        big.NewInt(0),
 	eip1559Block:                  big.NewInt(0),
 	cancunBlock:                   big.NewInt(9999999999),
+	tipBRCXOrderTypes:             big.NewInt(0),
+	tipBRCXPartialLiquidation:     big.NewInt(0),
+	tipSlashing:                   big.NewInt(0),
+	tipBLS:                        big.NewInt(9999999999),
 
 	trc21IssuerSMCTestNet: HexToAddress("0x0E2C88753131CE01c7551B726b28BFD04e44003F"),
 	trc21IssuerSMC:        HexToAddress("0x8c0faeb5C6bEd2129b8674F262Fd45c4e9468bee"),
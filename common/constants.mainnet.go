@@ -30,6 +30,10 @@ var MaintnetConstant = constant{
 	tipBRCXReceiverDisable:        big.NewInt(80370900), // Target 2nd Oct 2024, safer to release after disable miner
 	eip1559Block:                  big.NewInt(9999999999),
 	cancunBlock:                   big.NewInt(9999999999),
+	tipBRCXOrderTypes:             big.NewInt(9999999999),
+	tipBRCXPartialLiquidation:     big.NewInt(9999999999),
+	tipSlashing:                   big.NewInt(9999999999),
+	tipBLS:                        big.NewInt(9999999999),
 
 	trc21IssuerSMCTestNet: HexToAddress("0x0E2C88753131CE01c7551B726b28BFD04e44003F"),
 	trc21IssuerSMC:        HexToAddress("0x8c0faeb5C6bEd2129b8674F262Fd45c4e9468bee"),
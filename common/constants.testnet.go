@@ -30,6 +30,10 @@ var TestnetConstant = constant{
 	tipBRCXReceiverDisable:        big.NewInt(66825000), // Target 26 Aug 2024
 	eip1559Block:                  big.NewInt(71550000), // Target 14th Feb 2025
 	cancunBlock:                   big.NewInt(9999999999),
+	tipBRCXOrderTypes:             big.NewInt(9999999999),
+	tipBRCXPartialLiquidation:     big.NewInt(9999999999),
+	tipSlashing:                   big.NewInt(9999999999),
+	tipBLS:                        big.NewInt(9999999999),
 
 	trc21IssuerSMCTestNet: HexToAddress("0x0E2C88753131CE01c7551B726b28BFD04e44003F"),
 	trc21IssuerSMC:        HexToAddress("0x8c0faeb5C6bEd2129b8674F262Fd45c4e9468bee"),
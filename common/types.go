@@ -45,6 +45,8 @@ const (
 	BRCXLendingFinalizedTradeAddress = "brc0000000000000000000000000000000000000094"
 	BRCNativeAddress                 = "brc0000000000000000000000000000000000000001"
 	LendingLockAddress               = "brc0000000000000000000000000000000000000011"
+	SlashingAddress                  = "brc0000000000000000000000000000000000000095"
+	BLSRegistrationAddress           = "brc0000000000000000000000000000000000000096"
 	VoteMethod                       = "0x6dd7d8ea"
 	UnvoteMethod                     = "0x02aa9be2"
 	ProposeMethod                    = "0x01267951"
@@ -69,6 +71,8 @@ var (
 	BRCXLendingFinalizedTradeAddressBinary = HexToAddress("0x0000000000000000000000000000000000000094")
 	BRCNativeAddressBinary                 = HexToAddress("0x0000000000000000000000000000000000000001")
 	LendingLockAddressBinary               = HexToAddress("0x0000000000000000000000000000000000000011")
+	SlashingAddressBinary                  = HexToAddress("0x0000000000000000000000000000000000000095")
+	BLSRegistrationAddressBinary           = HexToAddress("0x0000000000000000000000000000000000000096")
 )
 
 var (
@@ -176,6 +180,21 @@ func (h *Hash) UnmarshalJSON(input []byte) error {
 	return hexutil.UnmarshalFixedJSON(hashT, input, h[:])
 }
 
+// ImplementsGraphQLType returns true if Hash implements the specified GraphQL type.
+func (Hash) ImplementsGraphQLType(name string) bool { return name == "Bytes32" }
+
+// UnmarshalGraphQL unmarshals the provided GraphQL query data.
+func (h *Hash) UnmarshalGraphQL(input interface{}) error {
+	var err error
+	switch input := input.(type) {
+	case string:
+		err = h.UnmarshalText([]byte(input))
+	default:
+		err = fmt.Errorf("unexpected type %T for Hash", input)
+	}
+	return err
+}
+
 // MarshalText returns the hex representation of h.
 func (h Hash) MarshalText() ([]byte, error) {
 	return hexutil.Bytes(h[:]).MarshalText()
@@ -358,6 +377,21 @@ func (a *Address) UnmarshalJSON(input []byte) error {
 	return hexutil.UnmarshalFixedJSON(addressT, input, a[:])
 }
 
+// ImplementsGraphQLType returns true if Address implements the specified GraphQL type.
+func (a Address) ImplementsGraphQLType(name string) bool { return name == "Address" }
+
+// UnmarshalGraphQL unmarshals the provided GraphQL query data.
+func (a *Address) UnmarshalGraphQL(input interface{}) error {
+	var err error
+	switch input := input.(type) {
+	case string:
+		err = a.UnmarshalText([]byte(input))
+	default:
+		err = fmt.Errorf("unexpected type %T for Address", input)
+	}
+	return err
+}
+
 // UnprefixedAddress allows marshaling an Address without 0x prefix.
 type UnprefixedAddress Address
 
@@ -351,6 +351,8 @@ var testCases = []struct {
 	{BRCXLendingFinalizedTradeAddressBinary, BRCXLendingFinalizedTradeAddress},
 	{BRCNativeAddressBinary, BRCNativeAddress},
 	{LendingLockAddressBinary, LendingLockAddress},
+	{SlashingAddressBinary, SlashingAddress},
+	{BLSRegistrationAddressBinary, BLSRegistrationAddress},
 }
 
 func TestBinaryAddressToString(t *testing.T) {
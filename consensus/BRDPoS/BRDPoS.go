@@ -30,6 +30,7 @@ import (
 	"BRDPoSChain/consensus/clique"
 	"BRDPoSChain/core/state"
 	"BRDPoSChain/core/types"
+	"BRDPoSChain/crypto/bls"
 	"BRDPoSChain/ethdb"
 	"BRDPoSChain/event"
 	"BRDPoSChain/log"
@@ -319,6 +320,19 @@ func (x *BRDPoS) Authorize(signer common.Address, signFn clique.SignerFn) {
 	x.EngineV2.Authorize(signer, signFn)
 }
 
+// AuthorizeBLS injects the BLS key into the v2 consensus to sign votes and
+// timeouts with after TIPBLS.
+func (x *BRDPoS) AuthorizeBLS(key *bls.SecretKey) {
+	x.EngineV2.AuthorizeBLS(key)
+}
+
+// AuthorizeConsensusSigner injects a signer which is handed the headers, votes
+// and timeouts to sign rather than their hash, like a remote signer.
+func (x *BRDPoS) AuthorizeConsensusSigner(consensusSigner utils.ConsensusSigner) {
+	x.EngineV1.AuthorizeConsensusSigner(consensusSigner)
+	x.EngineV2.AuthorizeConsensusSigner(consensusSigner)
+}
+
 func (x *BRDPoS) GetPeriod() uint64 {
 	return x.config.Period
 }
@@ -16,6 +16,7 @@
 package BRDPoS
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
 	"math/big"
@@ -136,6 +137,9 @@ func (api *API) GetMasternodesByNumber(number *rpc.BlockNumber) MasternodesStatu
 	} else if *number == rpc.CommittedBlockNumber {
 		hash := api.BRDPoS.EngineV2.GetLatestCommittedBlockInfo().Hash
 		header = api.chain.GetHeaderByHash(hash)
+	} else if *number == rpc.SafeBlockNumber {
+		hash := api.BRDPoS.EngineV2.GetLatestQCBlockInfo().Hash
+		header = api.chain.GetHeaderByHash(hash)
 	} else {
 		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
 	}
@@ -291,6 +295,9 @@ func (api *API) getHeaderFromApiBlockNum(number *rpc.BlockNumber) *types.Header
 	} else if *number == rpc.CommittedBlockNumber {
 		hash := api.BRDPoS.EngineV2.GetLatestCommittedBlockInfo().Hash
 		header = api.chain.GetHeaderByHash(hash)
+	} else if *number == rpc.SafeBlockNumber {
+		hash := api.BRDPoS.EngineV2.GetLatestQCBlockInfo().Hash
+		header = api.chain.GetHeaderByHash(hash)
 	} else {
 		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
 	}
@@ -366,3 +373,48 @@ func (api *API) GetBlockInfoByEpochNum(epochNumber uint64) (*utils.EpochNumInfo,
 	}
 	return info, nil
 }
+
+// GetForensicProofs returns the forensic proofs persisted by this node, only the ones blaming the signer if it's given.
+func (api *API) GetForensicProofs(signer *common.Address) []*types.ForensicProof {
+	proofs := api.BRDPoS.EngineV2.ForensicsProcessor.GetForensicProofs(signer)
+	if proofs == nil {
+		return []*types.ForensicProof{}
+	}
+	return proofs
+}
+
+// VerifyForensicProof re-checks the QC or vote signatures of a forensic proof against the masternodes of their epoch.
+func (api *API) VerifyForensicProof(proof types.ForensicProof) (bool, error) {
+	if err := api.BRDPoS.EngineV2.VerifyForensicProof(api.chain, &proof); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ForensicProofs creates a subscription that fires for every forensic proof generated by this node.
+func (api *API) ForensicProofs(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		events := make(chan types.ForensicsEvent, 16)
+		eventsSub := api.BRDPoS.SubscribeForensicsEvent(events)
+		defer eventsSub.Unsubscribe()
+
+		for {
+			select {
+			case ev := <-events:
+				notifier.Notify(rpcSub.ID, ev.ForensicsProof)
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
@@ -7,8 +7,6 @@ import (
 	"fmt"
 	"math/big"
 	"math/rand"
-	"os"
-	"path/filepath"
 	"sync"
 	"time"
 
@@ -19,6 +17,7 @@ import (
 	"BRDPoSChain/consensus/BRDPoS/utils"
 	"BRDPoSChain/consensus/clique"
 	"BRDPoSChain/consensus/misc/eip1559"
+	"BRDPoSChain/core/rawdb"
 	"BRDPoSChain/core/state"
 	"BRDPoSChain/core/types"
 	"BRDPoSChain/crypto"
@@ -48,9 +47,10 @@ type BRDPoS_v1 struct {
 	verifiedHeaders     *lru.Cache[common.Hash, struct{}]
 	proposals           map[common.Address]bool // Current list of proposals we are pushing
 
-	signer common.Address  // Ethereum address of the signing key
-	signFn clique.SignerFn // Signer function to authorize hashes with
-	lock   sync.RWMutex    // Protects the signer fields
+	signer          common.Address        // Ethereum address of the signing key
+	signFn          clique.SignerFn       // Signer function to authorize hashes with
+	consensusSigner utils.ConsensusSigner // Signer of headers by content, preferred over signFn if set
+	lock            sync.RWMutex          // Protects the signer fields
 
 	HookReward            func(chain consensus.ChainReader, state *state.StateDB, parentState *state.StateDB, header *types.Header) (map[string]interface{}, error)
 	HookPenalty           func(chain consensus.ChainReader, blockNumberEpoc uint64) ([]common.Address, error)
@@ -825,29 +825,34 @@ func (x *BRDPoS_v1) Finalize(chain consensus.ChainReader, header *types.Header,
 	// set block reward
 	number := header.Number.Uint64()
 	rCheckpoint := chain.Config().BRDPoS.RewardCheckpoint
+	var (
+		rewards map[string]interface{}
+		err     error
+	)
 
 	// _ = c.CacheData(header, txs, receipts)
 
 	if x.HookReward != nil && number%rCheckpoint == 0 {
-		rewards, err := x.HookReward(chain, state, parentState, header)
+		rewards, err = x.HookReward(chain, state, parentState, header)
 		if err != nil {
 			return nil, err
 		}
-		if len(common.StoreRewardFolder) > 0 {
-			data, err := json.Marshal(rewards)
-			if err == nil {
-				err = os.WriteFile(filepath.Join(common.StoreRewardFolder, header.Number.String()+"."+header.Hash().Hex()), data, 0644)
-			}
-			if err != nil {
-				log.Error("Error when save reward info ", "number", header.Number, "hash", header.Hash().Hex(), "err", err)
-			}
-		}
 	}
 
 	// the state remains as is and uncles are dropped
 	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
 	header.UncleHash = types.CalcUncleHash(nil)
 
+	if rewards != nil && common.StoreReward {
+		data, err := json.Marshal(rewards)
+		if err == nil {
+			err = rawdb.WriteRewards(x.db, header.Hash(), header.Number.Uint64(), data)
+		}
+		if err != nil {
+			log.Error("Error when save reward info ", "number", header.Number, "hash", header.Hash().Hex(), "err", err)
+		}
+	}
+
 	// Assemble and return the final block for sealing
 	return types.NewBlock(header, txs, nil, receipts), nil
 }
@@ -862,6 +867,15 @@ func (x *BRDPoS_v1) Authorize(signer common.Address, signFn clique.SignerFn) {
 	x.signFn = signFn
 }
 
+// AuthorizeConsensusSigner injects a signer which is handed the headers to seal rather than their hash,
+// like a remote signer holding the key outside of the node.
+func (x *BRDPoS_v1) AuthorizeConsensusSigner(consensusSigner utils.ConsensusSigner) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	x.consensusSigner = consensusSigner
+}
+
 // Seal implements consensus.Engine, attempting to create a sealed block using
 // the local signing credentials.
 func (x *BRDPoS_v1) Seal(chain consensus.ChainReader, block *types.Block, stop <-chan struct{}) (*types.Block, error) {
@@ -879,7 +893,7 @@ func (x *BRDPoS_v1) Seal(chain consensus.ChainReader, block *types.Block, stop <
 	}
 	// Don't hold the signer fields for the entire sealing procedure
 	x.lock.RLock()
-	signer, signFn := x.signer, x.signFn
+	signer, signFn, consensusSigner := x.signer, x.signFn, x.consensusSigner
 	x.lock.RUnlock()
 
 	// Bail out if we're unauthorized to sign a block
@@ -924,7 +938,12 @@ func (x *BRDPoS_v1) Seal(chain consensus.ChainReader, block *types.Block, stop <
 	default:
 	}
 	// Sign all the things!
-	sighash, err := signFn(accounts.Account{Address: signer}, x.SigHash(header).Bytes())
+	var sighash []byte
+	if consensusSigner != nil {
+		sighash, err = consensusSigner.SignHeader(accounts.Account{Address: signer}, header)
+	} else {
+		sighash, err = signFn(accounts.Account{Address: signer}, x.SigHash(header).Bytes())
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -58,6 +58,11 @@ func getM1M2(masternodes []common.Address, validators []int64, currentHeader *ty
 	return m1m2, moveM2, nil
 }
 
+// SigHash returns the hash a masternode signs to seal a v1 header.
+func SigHash(header *types.Header) common.Hash {
+	return sigHash(header)
+}
+
 func sigHash(header *types.Header) (hash common.Hash) {
 	hasher := sha3.NewLegacyKeccak256()
 
@@ -5,20 +5,21 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
-	"os"
-	"path/filepath"
 	"sync"
 	"time"
 
 	"BRDPoSChain/accounts"
 	"BRDPoSChain/common"
 	"BRDPoSChain/common/countdown"
+	"BRDPoSChain/common/hexutil"
 	"BRDPoSChain/common/lru"
 	"BRDPoSChain/consensus"
 	"BRDPoSChain/consensus/BRDPoS/utils"
 	"BRDPoSChain/consensus/clique"
+	"BRDPoSChain/core/rawdb"
 	"BRDPoSChain/core/state"
 	"BRDPoSChain/core/types"
+	"BRDPoSChain/crypto/bls"
 	"BRDPoSChain/ethdb"
 	"BRDPoSChain/log"
 	"BRDPoSChain/params"
@@ -37,15 +38,20 @@ type BRDPoS_v2 struct {
 	epochSwitches   *lru.Cache[common.Hash, *types.EpochSwitchInfo] // infos of epoch: master nodes, epoch switch block info, parent of that info
 	verifiedHeaders *lru.Cache[common.Hash, struct{}]
 
+	offlineLeaderSets *lru.Cache[common.Hash, *offlineLeaderSet] // offline leaders in the window ending at a block
+
 	// only contains epoch switch block info
 	// input: round, output: infos of epoch switch block and next epoch switch block info
 	round2epochBlockInfo *lru.Cache[types.Round, *types.BlockInfo]
 
 	signer   common.Address  // Ethereum address of the signing key
 	signFn   clique.SignerFn // Signer function to authorize hashes with
+	blsKey   *bls.SecretKey  // BLS key to sign votes and timeouts with after TIPBLS
 	lock     sync.RWMutex    // Protects the signer fields
 	signLock sync.RWMutex    // Protects the signer fields
 
+	consensusSigner utils.ConsensusSigner // Signer of headers, votes and timeouts by content, preferred over signFn if set
+
 	BroadcastCh  chan interface{}
 	minePeriodCh chan int
 	newRoundCh   chan types.Round
@@ -66,6 +72,7 @@ type BRDPoS_v2 struct {
 
 	HookReward  func(chain consensus.ChainReader, state *state.StateDB, parentState *state.StateDB, header *types.Header) (map[string]interface{}, error)
 	HookPenalty func(chain consensus.ChainReader, number *big.Int, parentHash common.Hash, candidates []common.Address) ([]common.Address, error)
+	HookStakes  func(chain consensus.ChainReader, header *types.Header, candidates []common.Address) (map[common.Address]*big.Int, error)
 
 	ForensicsProcessor *Forensics
 
@@ -101,6 +108,7 @@ func New(chainConfig *params.ChainConfig, db ethdb.Database, minePeriodCh chan i
 		newRoundCh:      newRoundCh,
 
 		round2epochBlockInfo: lru.NewCache[types.Round, *types.BlockInfo](utils.InmemoryRound2Epochs),
+		offlineLeaderSets:    lru.NewCache[common.Hash, *offlineLeaderSet](utils.InmemorySnapshots),
 
 		timeoutPool: timeoutPool,
 		votePool:    votePool,
@@ -122,7 +130,7 @@ func New(chainConfig *params.ChainConfig, db ethdb.Database, minePeriodCh chan i
 		},
 		highestVotedRound:  types.Round(0),
 		highestCommitBlock: nil,
-		ForensicsProcessor: NewForensics(),
+		ForensicsProcessor: NewForensics(db),
 	}
 	// Add callback to the timer
 	timeoutTimer.OnTimeoutFn = engine.OnCountdownTimeout
@@ -387,6 +395,7 @@ func (x *BRDPoS_v2) Prepare(chain consensus.ChainReader, header *types.Header) e
 // rewards given, and returns the final block.
 func (x *BRDPoS_v2) Finalize(chain consensus.ChainReader, header *types.Header, state *state.StateDB, parentState *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
 	// set block reward
+	var rewards map[string]interface{}
 
 	isEpochSwitch, _, err := x.IsEpochSwitch(header)
 	if err != nil {
@@ -394,25 +403,26 @@ func (x *BRDPoS_v2) Finalize(chain consensus.ChainReader, header *types.Header,
 		return nil, err
 	}
 	if x.HookReward != nil && isEpochSwitch {
-		rewards, err := x.HookReward(chain, state, parentState, header)
+		rewards, err = x.HookReward(chain, state, parentState, header)
 		if err != nil {
 			return nil, err
 		}
-		if len(common.StoreRewardFolder) > 0 {
-			data, err := json.Marshal(rewards)
-			if err == nil {
-				err = os.WriteFile(filepath.Join(common.StoreRewardFolder, header.Number.String()+"."+header.Hash().Hex()), data, 0644)
-			}
-			if err != nil {
-				log.Error("Error when save reward info ", "number", header.Number, "hash", header.Hash().Hex(), "err", err)
-			}
-		}
 	}
 
 	// the state remains as is and uncles are dropped
 	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
 	header.UncleHash = types.CalcUncleHash(nil)
 
+	if rewards != nil && common.StoreReward {
+		data, err := json.Marshal(rewards)
+		if err == nil {
+			err = rawdb.WriteRewards(x.db, header.Hash(), header.Number.Uint64(), data)
+		}
+		if err != nil {
+			log.Error("Error when save reward info ", "number", header.Number, "hash", header.Hash().Hex(), "err", err)
+		}
+	}
+
 	// Assemble and return the final block for sealing
 	return types.NewBlock(header, txs, nil, receipts), nil
 }
@@ -426,6 +436,24 @@ func (x *BRDPoS_v2) Authorize(signer common.Address, signFn clique.SignerFn) {
 	x.signFn = signFn
 }
 
+// AuthorizeBLS injects the BLS key the masternode registered into the consensus engine to sign votes
+// and timeouts with after TIPBLS.
+func (x *BRDPoS_v2) AuthorizeBLS(key *bls.SecretKey) {
+	x.signLock.Lock()
+	defer x.signLock.Unlock()
+
+	x.blsKey = key
+}
+
+// AuthorizeConsensusSigner injects a signer which is handed the headers, votes and timeouts to sign rather
+// than their hash, like a remote signer holding the key outside of the node.
+func (x *BRDPoS_v2) AuthorizeConsensusSigner(consensusSigner utils.ConsensusSigner) {
+	x.signLock.Lock()
+	defer x.signLock.Unlock()
+
+	x.consensusSigner = consensusSigner
+}
+
 func (x *BRDPoS_v2) Author(header *types.Header) (common.Address, error) {
 	return ecrecover(header, x.signatures)
 }
@@ -443,7 +471,7 @@ func (x *BRDPoS_v2) Seal(chain consensus.ChainReader, block *types.Block, stop <
 
 	// Don't hold the signer fields for the entire sealing procedure
 	x.signLock.RLock()
-	signer, signFn := x.signer, x.signFn
+	signer, signFn, consensusSigner := x.signer, x.signFn, x.consensusSigner
 	x.signLock.RUnlock()
 
 	select {
@@ -453,7 +481,15 @@ func (x *BRDPoS_v2) Seal(chain consensus.ChainReader, block *types.Block, stop <
 	}
 
 	// Sign all the things!
-	signature, err := signFn(accounts.Account{Address: signer}, sigHash(header).Bytes())
+	var (
+		signature []byte
+		err       error
+	)
+	if consensusSigner != nil {
+		signature, err = consensusSigner.SignHeader(accounts.Account{Address: signer}, header)
+	} else {
+		signature, err = signFn(accounts.Account{Address: signer}, sigHash(header).Bytes())
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -502,17 +538,38 @@ func (x *BRDPoS_v2) GetSnapshot(chain consensus.ChainReader, header *types.Heade
 	return snap, nil
 }
 
+// UpdateMasternodes takes the snapshot of the candidates at the gap block header. After TIPBLS, the candidates which
+// haven't registered a BLS public key are left out, as none of their votes or timeouts could be verified.
 func (x *BRDPoS_v2) UpdateMasternodes(chain consensus.ChainReader, header *types.Header, ms []utils.Masternode) error {
 	number := header.Number.Uint64()
 	log.Trace("[UpdateMasternodes]")
 
+	withBLS := x.isBLSGap(number)
 	masterNodes := []common.Address{}
+	blsPublicKeys := make(map[common.Address]hexutil.Bytes)
+	stakes := make(map[common.Address]*big.Int)
 	for _, m := range ms {
+		if withBLS && len(m.BLSPublicKey) == 0 {
+			log.Warn("[UpdateMasternodes] Leave out candidate without BLS public key", "number", number, "address", m.Address)
+			continue
+		}
 		masterNodes = append(masterNodes, m.Address)
+		if m.Stake != nil {
+			stakes[m.Address] = m.Stake
+		}
+		if len(m.BLSPublicKey) != 0 {
+			blsPublicKeys[m.Address] = m.BLSPublicKey
+		}
 	}
 
 	x.lock.RLock()
 	snap := newSnapshot(number, header.Hash(), masterNodes)
+	if len(blsPublicKeys) != 0 {
+		snap.BLSPublicKeys = blsPublicKeys
+	}
+	if len(stakes) != 0 {
+		snap.Stakes = stakes
+	}
 	log.Info("[UpdateMasternodes] take snapshot", "number", number, "hash", header.Hash())
 	x.lock.RUnlock()
 
@@ -524,8 +581,8 @@ func (x *BRDPoS_v2) UpdateMasternodes(chain consensus.ChainReader, header *types
 	x.snapshots.Add(snap.Hash, snap)
 
 	log.Info("[UpdateMasternodes] New set of masternodes has been updated to snapshot", "number", snap.Number, "hash", snap.Hash)
-	for i, n := range ms {
-		log.Info("masternode", "index", i, "address", n.Address.String())
+	for i, n := range masterNodes {
+		log.Info("masternode", "index", i, "address", n.String())
 	}
 
 	return nil
@@ -633,10 +690,10 @@ func (x *BRDPoS_v2) VerifyVoteMessage(chain consensus.ChainReader, vote *types.V
 		log.Error("[VerifyVoteMessage] fail to get snapshot for a vote message", "blockNum", vote.ProposedBlockInfo.Number, "blockHash", vote.ProposedBlockInfo.Hash, "voteHash", vote.Hash(), "error", err.Error())
 		return false, err
 	}
-	verified, signer, err := x.verifyMsgSignature(types.VoteSigHash(&types.VoteForSign{
+	verified, signer, err := x.verifyMessage(chain, types.VoteSigHash(&types.VoteForSign{
 		ProposedBlockInfo: vote.ProposedBlockInfo,
 		GapNumber:         vote.GapNumber,
-	}), vote.Signature, snapshot.NextEpochCandidates)
+	}), vote.Signature, vote.BLSSigner, vote.GapNumber, snapshot.NextEpochCandidates)
 	if err != nil {
 		for i, mn := range snapshot.NextEpochCandidates {
 			log.Warn("[VerifyVoteMessage] Master node list item", "index", i, "Master node", mn.Hex())
@@ -683,10 +740,10 @@ func (x *BRDPoS_v2) VerifyTimeoutMessage(chain consensus.ChainReader, timeoutMsg
 		return false, errors.New("empty master node lists from snapshot")
 	}
 
-	verified, signer, err := x.verifyMsgSignature(types.TimeoutSigHash(&types.TimeoutForSign{
+	verified, signer, err := x.verifyMessage(chain, types.TimeoutSigHash(&types.TimeoutForSign{
 		Round:     timeoutMsg.Round,
 		GapNumber: timeoutMsg.GapNumber,
-	}), timeoutMsg.Signature, snap.NextEpochCandidates)
+	}), timeoutMsg.Signature, timeoutMsg.BLSSigner, timeoutMsg.GapNumber, snap.NextEpochCandidates)
 
 	if err != nil {
 		log.Warn("[VerifyTimeoutMessage] cannot verify timeout signature", "err", err)
@@ -811,62 +868,88 @@ func (x *BRDPoS_v2) verifyQC(blockChainReader consensus.ChainReader, quorumCert
 		return errors.New("fail to verify QC due to failure in getting epoch switch info")
 	}
 
-	signatures, duplicates := UniqueSignatures(quorumCert.Signatures)
-	if len(duplicates) != 0 {
-		for _, d := range duplicates {
-			log.Warn("[verifyQC] duplicated signature in QC", "duplicate", common.Bytes2Hex(d))
-		}
-	}
-
-	qcRound := quorumCert.ProposedBlockInfo.Round
-	certThreshold := x.config.V2.Config(uint64(qcRound)).CertThreshold
-	if (qcRound > 0) && (signatures == nil || float64(len(signatures)) < float64(epochInfo.MasternodesLen)*certThreshold) {
-		//First V2 Block QC, QC Signatures is initial nil
-		log.Warn("[verifyHeader] Invalid QC Signature is nil or less then config", "QCNumber", quorumCert.ProposedBlockInfo.Number, "LenSignatures", len(signatures), "CertThreshold", float64(epochInfo.MasternodesLen)*certThreshold)
-		return utils.ErrInvalidQCSignatures
-	}
-	start := time.Now()
-
-	var wg sync.WaitGroup
-	wg.Add(len(signatures))
-	var haveError error
-
-	for _, signature := range signatures {
-		go func(sig types.Signature) {
-			defer wg.Done()
-			verified, _, err := x.verifyMsgSignature(types.VoteSigHash(&types.VoteForSign{
-				ProposedBlockInfo: quorumCert.ProposedBlockInfo,
-				GapNumber:         quorumCert.GapNumber,
-			}), sig, epochInfo.Masternodes)
-			if err != nil {
-				log.Error("[verifyQC] Error while verfying QC message signatures", "Error", err)
-				haveError = errors.New("error while verfying QC message signatures")
-				return
-			}
-			if !verified {
-				log.Warn("[verifyQC] Signature not verified doing QC verification", "QC", quorumCert)
-				haveError = errors.New("fail to verify QC due to signature mis-match")
-				return
-			}
-		}(signature)
-	}
-	wg.Wait()
-	elapsed := time.Since(start)
-	log.Debug("[verifyQC] time verify message signatures of qc", "elapsed", elapsed)
-	if haveError != nil {
-		return haveError
-	}
 	epochSwitchNumber := epochInfo.EpochSwitchBlockInfo.Number.Uint64()
 	gapNumber := epochSwitchNumber - epochSwitchNumber%x.config.Epoch - x.config.Gap
 	// prevent overflow
 	if epochSwitchNumber-epochSwitchNumber%x.config.Epoch < x.config.Gap {
 		gapNumber = 0
 	}
+	// the gap number selects the signature format and the snapshot of the BLS public keys
 	if gapNumber != quorumCert.GapNumber {
 		log.Error("[verifyQC] QC gap number mismatch", "epochSwitchNumber", epochSwitchNumber, "BlockNum", quorumCert.ProposedBlockInfo.Number, "BlockInfoHash", quorumCert.ProposedBlockInfo.Hash, "Gap", quorumCert.GapNumber, "GapShouldBe", gapNumber)
 		return fmt.Errorf("gap number mismatch QC Gap %d, shouldBe %d", quorumCert.GapNumber, gapNumber)
 	}
 
+	qcRound := quorumCert.ProposedBlockInfo.Round
+	certThreshold := x.config.V2.Config(uint64(qcRound)).CertThreshold
+	start := time.Now()
+
+	if x.isBLSGap(quorumCert.GapNumber) && qcRound > 0 {
+		if len(quorumCert.Signatures) != 0 || !quorumCert.IsAggregated() {
+			log.Warn("[verifyQC] QC is not aggregated after TIPBLS", "QCNumber", quorumCert.ProposedBlockInfo.Number, "GapNumber", quorumCert.GapNumber)
+			return utils.ErrInvalidQCSignatures
+		}
+		signers, err := x.verifyAggregatedSignature(blockChainReader, types.VoteSigHash(&types.VoteForSign{
+			ProposedBlockInfo: quorumCert.ProposedBlockInfo,
+			GapNumber:         quorumCert.GapNumber,
+		}), quorumCert.AggregatedSignature, quorumCert.SignerBitmap, epochInfo.Masternodes, quorumCert.GapNumber)
+		if err != nil {
+			log.Warn("[verifyQC] Aggregated signature not verified doing QC verification", "QC", quorumCert, "err", err)
+			return fmt.Errorf("fail to verify QC aggregated signature: %v", err)
+		}
+		if float64(len(signers)) < float64(epochInfo.MasternodesLen)*certThreshold {
+			log.Warn("[verifyQC] Invalid QC signers less then config", "QCNumber", quorumCert.ProposedBlockInfo.Number, "LenSigners", len(signers), "CertThreshold", float64(epochInfo.MasternodesLen)*certThreshold)
+			return utils.ErrInvalidQCSignatures
+		}
+	} else {
+		if quorumCert.IsAggregated() || len(quorumCert.SignerBitmap) != 0 {
+			log.Warn("[verifyQC] QC is aggregated before TIPBLS", "QCNumber", quorumCert.ProposedBlockInfo.Number, "GapNumber", quorumCert.GapNumber)
+			return utils.ErrInvalidQCSignatures
+		}
+		signatures, duplicates := UniqueSignatures(quorumCert.Signatures)
+		if len(duplicates) != 0 {
+			for _, d := range duplicates {
+				log.Warn("[verifyQC] duplicated signature in QC", "duplicate", common.Bytes2Hex(d))
+			}
+		}
+
+		if (qcRound > 0) && (signatures == nil || float64(len(signatures)) < float64(epochInfo.MasternodesLen)*certThreshold) {
+			//First V2 Block QC, QC Signatures is initial nil
+			log.Warn("[verifyHeader] Invalid QC Signature is nil or less then config", "QCNumber", quorumCert.ProposedBlockInfo.Number, "LenSignatures", len(signatures), "CertThreshold", float64(epochInfo.MasternodesLen)*certThreshold)
+			return utils.ErrInvalidQCSignatures
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(len(signatures))
+		var haveError error
+
+		for _, signature := range signatures {
+			go func(sig types.Signature) {
+				defer wg.Done()
+				verified, _, err := x.verifyMsgSignature(types.VoteSigHash(&types.VoteForSign{
+					ProposedBlockInfo: quorumCert.ProposedBlockInfo,
+					GapNumber:         quorumCert.GapNumber,
+				}), sig, epochInfo.Masternodes)
+				if err != nil {
+					log.Error("[verifyQC] Error while verfying QC message signatures", "Error", err)
+					haveError = errors.New("error while verfying QC message signatures")
+					return
+				}
+				if !verified {
+					log.Warn("[verifyQC] Signature not verified doing QC verification", "QC", quorumCert)
+					haveError = errors.New("fail to verify QC due to signature mis-match")
+					return
+				}
+			}(signature)
+		}
+		wg.Wait()
+		if haveError != nil {
+			return haveError
+		}
+	}
+	elapsed := time.Since(start)
+	log.Debug("[verifyQC] time verify message signatures of qc", "elapsed", elapsed)
+
 	return x.VerifyBlockInfo(blockChainReader, quorumCert.ProposedBlockInfo, parentHeader)
 }
 
@@ -932,10 +1015,16 @@ func (x *BRDPoS_v2) setNewRound(blockChainReader consensus.ChainReader, round ty
 	}
 }
 
+// broadcastToBftChannel hands the message to the bft handler right away if it's ready to take it, keeping the
+// order of the messages. Otherwise the message is handed over in the background, not to block the engine.
 func (x *BRDPoS_v2) broadcastToBftChannel(msg interface{}) {
-	go func() {
-		x.BroadcastCh <- msg
-	}()
+	select {
+	case x.BroadcastCh <- msg:
+	default:
+		go func() {
+			x.BroadcastCh <- msg
+		}()
+	}
 }
 
 func (x *BRDPoS_v2) getSyncInfo() *types.SyncInfo {
@@ -989,7 +1078,9 @@ func (x *BRDPoS_v2) commitBlocks(blockChainReader consensus.ChainReader, propose
 	log.Info("Successfully commit and confirm block from continuous 3 blocks", "num", x.highestCommitBlock.Number, "round", x.highestCommitBlock.Round, "hash", x.highestCommitBlock.Hash)
 	// Perform forensics related operation
 	headerQcToBeCommitted := []types.Header{*parentBlock, *proposedBlockHeader}
-	go x.ForensicsProcessor.ForensicsMonitoring(blockChainReader, x, headerQcToBeCommitted, *incomingQc)
+	x.ForensicsProcessor.inBackground(func() {
+		x.ForensicsProcessor.ForensicsMonitoring(blockChainReader, x, headerQcToBeCommitted, *incomingQc)
+	})
 	return true, nil
 }
 
@@ -1141,3 +1232,9 @@ func (x *BRDPoS_v2) periodicJob() {
 func (x *BRDPoS_v2) GetLatestCommittedBlockInfo() *types.BlockInfo {
 	return x.highestCommitBlock
 }
+
+// GetLatestQCBlockInfo returns the block certified by the highest quorum cert, it can't be reverted without
+// a quorum of masternodes voting against their lock.
+func (x *BRDPoS_v2) GetLatestQCBlockInfo() *types.BlockInfo {
+	return x.highestQuorumCert.ProposedBlockInfo
+}
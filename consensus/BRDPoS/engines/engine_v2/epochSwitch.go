@@ -5,6 +5,7 @@ import (
 	"math/big"
 
 	"BRDPoSChain/common"
+	"BRDPoSChain/common/hexutil"
 	"BRDPoSChain/consensus"
 	"BRDPoSChain/core/types"
 	"BRDPoSChain/log"
@@ -116,6 +117,52 @@ func (x *BRDPoS_v2) getEpochSwitchInfo(chain consensus.ChainReader, header *type
 	return epochSwitchInfo, nil
 }
 
+// GetMasternodesOfRound returns the masternodes of the epoch of the round. The epoch is searched backward on the chain
+// of the header, from the epoch of the header up to limit epochs before it.
+func (x *BRDPoS_v2) GetMasternodesOfRound(chain consensus.ChainReader, header *types.Header, round types.Round, limit int) ([]common.Address, error) {
+	epochSwitchInfo, err := x.getEpochSwitchInfoOfRound(chain, header, round, limit)
+	if err != nil {
+		return nil, err
+	}
+	return epochSwitchInfo.Masternodes, nil
+}
+
+// GetBLSPublicKeysOfRound returns the BLS public keys registered in the gap block snapshot of the epoch of the round,
+// the ones the votes of the round are signed with. The epoch is searched the same way as by GetMasternodesOfRound.
+func (x *BRDPoS_v2) GetBLSPublicKeysOfRound(chain consensus.ChainReader, header *types.Header, round types.Round, limit int) (map[common.Address]hexutil.Bytes, error) {
+	epochSwitchInfo, err := x.getEpochSwitchInfoOfRound(chain, header, round, limit)
+	if err != nil {
+		return nil, err
+	}
+	snap, err := x.getSnapshot(chain, epochSwitchInfo.EpochSwitchBlockInfo.Number.Uint64(), false)
+	if err != nil {
+		return nil, err
+	}
+	return snap.BLSPublicKeys, nil
+}
+
+func (x *BRDPoS_v2) getEpochSwitchInfoOfRound(chain consensus.ChainReader, header *types.Header, round types.Round, limit int) (*types.EpochSwitchInfo, error) {
+	targetEpochNum := x.config.V2.SwitchEpoch + uint64(round)/x.config.Epoch
+	epochSwitchInfo, err := x.getEpochSwitchInfo(chain, header, header.Hash())
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; ; i++ {
+		epochNum := x.config.V2.SwitchEpoch + uint64(epochSwitchInfo.EpochSwitchBlockInfo.Round)/x.config.Epoch
+		if epochNum == targetEpochNum {
+			return epochSwitchInfo, nil
+		}
+		if epochNum < targetEpochNum || i == limit || epochSwitchInfo.EpochSwitchParentBlockInfo == nil {
+			break
+		}
+		epochSwitchInfo, err = x.getEpochSwitchInfo(chain, nil, epochSwitchInfo.EpochSwitchParentBlockInfo.Hash)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("round %d is not in the last %d epochs of block %v", round, limit, header.Number)
+}
+
 // IsEpochSwitchAtRound() is used by miner to check whether it mines a block in the same epoch with parent
 func (x *BRDPoS_v2) isEpochSwitchAtRound(round types.Round, parentHeader *types.Header) (bool, uint64, error) {
 	epochNum := x.config.V2.SwitchEpoch + uint64(round)/x.config.Epoch
@@ -6,14 +6,18 @@ import (
 	"fmt"
 	"math/big"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 
 	"BRDPoSChain/common"
 	"BRDPoSChain/consensus"
 	"BRDPoSChain/consensus/BRDPoS/utils"
+	"BRDPoSChain/core/rawdb"
 	"BRDPoSChain/core/types"
 	"BRDPoSChain/crypto"
+	"BRDPoSChain/ethdb"
 	"BRDPoSChain/event"
 	"BRDPoSChain/log"
 )
@@ -22,16 +26,49 @@ const (
 	NUM_OF_FORENSICS_QC = 3
 )
 
+var (
+	ErrUnknownForensicsType  = errors.New("unknown forensics type")
+	ErrForensicVoteGapNumber = errors.New("vote gap number does not match the epoch of its round")
+)
+
 // Forensics instance. Placeholder for future properties to be added
 type Forensics struct {
 	HighestCommittedQCs []types.QuorumCert
+	db                  ethdb.Database // Database to persist the forensic proofs, proofs are only sent to the feed if nil
 	forensicsFeed       event.Feed
 	scope               event.SubscriptionScope
+
+	running sync.WaitGroup // Forensics started by the engine running in the background
 }
 
 // Initiate a forensics process
-func NewForensics() *Forensics {
-	return &Forensics{}
+func NewForensics(db ethdb.Database) *Forensics {
+	return &Forensics{db: db}
+}
+
+// GetForensicProofs returns the persisted forensic proofs, only the ones blaming the signer if it's not nil.
+func (f *Forensics) GetForensicProofs(signer *common.Address) []*types.ForensicProof {
+	if f.db == nil {
+		return nil
+	}
+	if signer == nil {
+		return rawdb.ReadForensicProofs(f.db)
+	}
+	var proofs []*types.ForensicProof
+	for _, id := range rawdb.ReadForensicProofIds(f.db, *signer) {
+		if proof := rawdb.ReadForensicProof(f.db, id); proof != nil {
+			proofs = append(proofs, proof)
+		}
+	}
+	return proofs
+}
+
+// persist the proof then send it to the subscribers, e.g. the stats server
+func (f *Forensics) sendForensicProof(proof *types.ForensicProof, signers []common.Address) {
+	if f.db != nil {
+		rawdb.WriteForensicProof(f.db, proof, signers)
+	}
+	go f.forensicsFeed.Send(types.ForensicsEvent{ForensicsProof: proof})
 }
 
 // SubscribeForensicsEvent registers a subscription of ForensicsEvent and
@@ -175,12 +212,12 @@ func (f *Forensics) SendForensicProof(chain consensus.ChainReader, engine *BRDPo
 		SmallerRoundInfo: &types.ForensicsInfo{
 			HashPath:        ancestorToLowerRoundPath,
 			QuorumCert:      lowerRoundQC,
-			SignerAddresses: f.getQcSignerAddresses(lowerRoundQC),
+			SignerAddresses: f.getQcSignerAddresses(lowerRoundQC, lowerRoundQcEpochSwitchInfo.Masternodes),
 		},
 		LargerRoundInfo: &types.ForensicsInfo{
 			HashPath:        ancestorToHigherRoundPath,
 			QuorumCert:      higherRoundQC,
-			SignerAddresses: f.getQcSignerAddresses(higherRoundQC),
+			SignerAddresses: f.getQcSignerAddresses(higherRoundQC, higherRoundQcEpochSwitchInfo.Masternodes),
 		},
 	})
 
@@ -195,7 +232,15 @@ func (f *Forensics) SendForensicProof(chain consensus.ChainReader, engine *BRDPo
 		Content:       string(content),
 	}
 	log.Info("Forensics proof report generated, sending to the stats server", "forensicsProof", forensicsProof)
-	go f.forensicsFeed.Send(types.ForensicsEvent{ForensicsProof: forensicsProof})
+	// the masternodes which signed both QCs are blamed
+	var signers []common.Address
+	higherRoundSigners := f.getQcSignerAddresses(higherRoundQC, higherRoundQcEpochSwitchInfo.Masternodes)
+	for _, signer := range f.getQcSignerAddresses(lowerRoundQC, lowerRoundQcEpochSwitchInfo.Masternodes) {
+		if slices.Contains(higherRoundSigners, signer) {
+			signers = append(signers, common.HexToAddress(signer))
+		}
+	}
+	f.sendForensicProof(forensicsProof, signers)
 	return nil
 }
 
@@ -270,10 +315,21 @@ func (f *Forensics) findQCsInSameRound(quorumCerts1 []types.QuorumCert, quorumCe
 	return false, types.QuorumCert{}, types.QuorumCert{}
 }
 
-// Find the signer list from QC signatures
-func (f *Forensics) getQcSignerAddresses(quorumCert types.QuorumCert) []string {
+// Find the signer list from QC signatures, or from the signer bitmap over the epoch masternodes of an aggregated QC
+func (f *Forensics) getQcSignerAddresses(quorumCert types.QuorumCert, masternodes []common.Address) []string {
 	var signerList []string
 
+	if quorumCert.IsAggregated() {
+		signers, err := bitmapSigners(quorumCert.SignerBitmap, masternodes)
+		if err != nil {
+			log.Error("[getQcSignerAddresses] Fail to read signers from the QC signer bitmap", "quorumCert.GapNumber", quorumCert.GapNumber, "quorumCert.ProposedBlockInfo", quorumCert.ProposedBlockInfo, "err", err)
+		}
+		for _, signer := range signers {
+			signerList = append(signerList, signer.Hex())
+		}
+		return signerList
+	}
+
 	// The QC signatures are signed by votes special struct VoteForSign
 	quorumCertSignedHash := types.VoteSigHash(&types.VoteForSign{
 		ProposedBlockInfo: quorumCert.ProposedBlockInfo,
@@ -424,14 +480,19 @@ func (f *Forensics) ProcessVoteEquivocation(chain consensus.ChainReader, engine
 		return err
 	}
 	if isVoteBlamed {
-		signer, err := GetVoteSignerAddresses(incomingVote)
+		signer, err := utils.GetVoteSignerAddresses(incomingVote)
 		if err != nil {
 			log.Error("[ProcessVoteEquivocation] GetVoteSignerAddresses", "error", err)
 		}
 		qc := highestCommittedQCs[NUM_OF_FORENSICS_QC-1]
+		if qc.IsAggregated() {
+			// the individual votes can't be taken apart from an aggregated QC
+			log.Debug("[ProcessVoteEquivocation] Skip the vote equivocation check against an aggregated QC", "qcRound", qc.ProposedBlockInfo.Round)
+			return nil
+		}
 		for _, signature := range qc.Signatures {
 			voteFromQC := &types.Vote{ProposedBlockInfo: qc.ProposedBlockInfo, Signature: signature, GapNumber: qc.GapNumber}
-			signerFromQC, err := GetVoteSignerAddresses(voteFromQC)
+			signerFromQC, err := utils.GetVoteSignerAddresses(voteFromQC)
 			if err != nil {
 				log.Error("[ProcessVoteEquivocation] GetVoteSignerAddresses", "error", err)
 				return err
@@ -485,11 +546,21 @@ func (f *Forensics) isVoteBlamed(chain consensus.ChainReader, highestCommittedQC
 	return false, decodedExtraField.QuorumCert, nil
 }
 
+// inBackground runs the forensics off the engine, keeping track of it until it's done.
+func (f *Forensics) inBackground(fn func()) {
+	f.running.Add(1)
+	go func() {
+		defer f.running.Done()
+		fn()
+	}()
+}
+
+// DetectEquivocationInVotePool proves the votes of the signer of the vote for other blocks of the same round
+// found in the vote pool. These proofs are the ones vote equivocations get slashed with.
 func (f *Forensics) DetectEquivocationInVotePool(vote *types.Vote, votePool *utils.Pool) {
-	return
 	poolKey := vote.PoolKey()
 	votePoolKeys := votePool.PoolObjKeysList()
-	signer, err := GetVoteSignerAddresses(vote)
+	signer, err := utils.GetVoteSignerAddresses(vote)
 	if err != nil {
 		log.Error("[detectEquivocationInVotePool]", "err", err)
 	}
@@ -511,7 +582,7 @@ func (f *Forensics) DetectEquivocationInVotePool(vote *types.Vote, votePool *uti
 					log.Warn("[detectEquivocationInVotePool] obj type is not vote, potential a bug in votePool")
 					continue
 				}
-				signer2, err := GetVoteSignerAddresses(voteTransfered)
+				signer2, err := utils.GetVoteSignerAddresses(voteTransfered)
 				if err != nil {
 					log.Warn("[detectEquivocationInVotePool]", "err", err)
 					continue
@@ -546,21 +617,134 @@ func (f *Forensics) SendVoteEquivocationProof(vote1, vote2 *types.Vote, signer c
 		Content:       string(content),
 	}
 	log.Info("Forensics proof report generated, sending to the stats server", "forensicsProof", forensicsProof)
-	go f.forensicsFeed.Send(types.ForensicsEvent{ForensicsProof: forensicsProof})
+	f.sendForensicProof(forensicsProof, []common.Address{signer})
 	return nil
 }
 
-func GetVoteSignerAddresses(vote *types.Vote) (common.Address, error) {
-	// The QC signatures are signed by votes special struct VoteForSign
+// VerifyForensicProof re-checks the signatures of the conflicting QCs or votes of a forensic proof
+// against the masternode list of their epoch.
+func (x *BRDPoS_v2) VerifyForensicProof(chain consensus.ChainReader, proof *types.ForensicProof) error {
+	switch proof.ForensicsType {
+	case "QC":
+		var content types.ForensicsContent
+		if err := json.Unmarshal([]byte(proof.Content), &content); err != nil {
+			return err
+		}
+		if content.SmallerRoundInfo == nil || content.LargerRoundInfo == nil {
+			return errors.New("forensic proof is missing a QC")
+		}
+		smallerRoundQC, largerRoundQC := content.SmallerRoundInfo.QuorumCert, content.LargerRoundInfo.QuorumCert
+		if smallerRoundQC.ProposedBlockInfo == nil || largerRoundQC.ProposedBlockInfo == nil {
+			return errors.New("forensic proof is missing a QC block info")
+		}
+		if smallerRoundQC.ProposedBlockInfo.Hash == largerRoundQC.ProposedBlockInfo.Hash {
+			return utils.ErrNotConflictingForensics
+		}
+		divergingHash := common.HexToHash(content.DivergingBlockHash)
+		for _, qc := range []*types.QuorumCert{&smallerRoundQC, &largerRoundQC} {
+			if err := x.verifyForensicQC(chain, qc, divergingHash); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "Vote":
+		var content types.VoteEquivocationContent
+		if err := json.Unmarshal([]byte(proof.Content), &content); err != nil {
+			return err
+		}
+		if content.SmallerRoundVote == nil || content.LargerRoundVote == nil || content.SmallerRoundVote.ProposedBlockInfo == nil || content.LargerRoundVote.ProposedBlockInfo == nil {
+			return errors.New("forensic proof is missing a vote")
+		}
+		if content.SmallerRoundVote.ProposedBlockInfo.Hash == content.LargerRoundVote.ProposedBlockInfo.Hash {
+			return utils.ErrNotConflictingForensics
+		}
+		for _, vote := range []*types.Vote{content.SmallerRoundVote, content.LargerRoundVote} {
+			epochInfo, err := x.getVoteEpochSwitchInfo(chain, vote)
+			if err != nil {
+				return err
+			}
+			verified, signer, err := x.verifyMessage(chain, types.VoteSigHash(&types.VoteForSign{
+				ProposedBlockInfo: vote.ProposedBlockInfo,
+				GapNumber:         vote.GapNumber,
+			}), vote.Signature, vote.BLSSigner, vote.GapNumber, epochInfo.Masternodes)
+			if err != nil {
+				return err
+			}
+			if !verified || signer != content.Signer {
+				return fmt.Errorf("vote of round %d is not signed by masternode %v", vote.ProposedBlockInfo.Round, content.Signer.Hex())
+			}
+		}
+		return nil
+	default:
+		return ErrUnknownForensicsType
+	}
+}
+
+// getVoteEpochSwitchInfo resolves the epoch of a vote from its round on the canonical chain, the voted
+// block may be a fork which was never imported. The gap number has to be the one of that epoch.
+func (x *BRDPoS_v2) getVoteEpochSwitchInfo(chain consensus.ChainReader, vote *types.Vote) (*types.EpochSwitchInfo, error) {
+	epochNum := x.config.V2.SwitchEpoch + uint64(vote.ProposedBlockInfo.Round)/x.config.Epoch
+	blockInfo, err := x.GetBlockByEpochNumber(chain, epochNum)
+	if err != nil {
+		return nil, err
+	}
+	epochInfo, err := x.getEpochSwitchInfo(chain, nil, blockInfo.Hash)
+	if err != nil {
+		return nil, err
+	}
+	epochSwitchNumber := epochInfo.EpochSwitchBlockInfo.Number.Uint64()
+	gapNumber := epochSwitchNumber - epochSwitchNumber%x.config.Epoch - x.config.Gap
+	// prevent overflow
+	if epochSwitchNumber-epochSwitchNumber%x.config.Epoch < x.config.Gap {
+		gapNumber = 0
+	}
+	if vote.GapNumber != gapNumber {
+		return nil, ErrForensicVoteGapNumber
+	}
+	return epochInfo, nil
+}
+
+// verifyForensicQC checks the QC is signed by enough masternodes of its epoch. The QC of a forked block
+// which is not in the chain is checked against the epoch of the diverging block.
+func (x *BRDPoS_v2) verifyForensicQC(chain consensus.ChainReader, qc *types.QuorumCert, divergingHash common.Hash) error {
+	epochHash := qc.ProposedBlockInfo.Hash
+	if chain.GetHeaderByHash(epochHash) == nil {
+		epochHash = divergingHash
+	}
+	epochInfo, err := x.getEpochSwitchInfo(chain, nil, epochHash)
+	if err != nil {
+		return err
+	}
+	certThreshold := x.config.V2.Config(uint64(qc.ProposedBlockInfo.Round)).CertThreshold
 	signHash := types.VoteSigHash(&types.VoteForSign{
-		ProposedBlockInfo: vote.ProposedBlockInfo,
-		GapNumber:         vote.GapNumber,
+		ProposedBlockInfo: qc.ProposedBlockInfo,
+		GapNumber:         qc.GapNumber,
 	})
-	var signerAddress common.Address
-	pubkey, err := crypto.Ecrecover(signHash.Bytes(), vote.Signature)
-	if err != nil {
-		return signerAddress, fmt.Errorf("fail to Ecrecover signer from the vote: %v", vote)
+	if x.isBLSGap(qc.GapNumber) {
+		if len(qc.Signatures) != 0 || !qc.IsAggregated() {
+			return utils.ErrInvalidQCSignatures
+		}
+		signers, err := x.verifyAggregatedSignature(chain, signHash, qc.AggregatedSignature, qc.SignerBitmap, epochInfo.Masternodes, qc.GapNumber)
+		if err != nil {
+			return fmt.Errorf("QC of round %d: %v", qc.ProposedBlockInfo.Round, err)
+		}
+		if float64(len(signers)) < float64(epochInfo.MasternodesLen)*certThreshold {
+			return utils.ErrInvalidQCSignatures
+		}
+		return nil
+	}
+	signatures, _ := UniqueSignatures(qc.Signatures)
+	if float64(len(signatures)) < float64(epochInfo.MasternodesLen)*certThreshold {
+		return utils.ErrInvalidQCSignatures
 	}
-	copy(signerAddress[:], crypto.Keccak256(pubkey[1:])[12:])
-	return signerAddress, nil
+	for _, signature := range signatures {
+		verified, signer, err := x.verifyMsgSignature(signHash, signature, epochInfo.Masternodes)
+		if err != nil {
+			return err
+		}
+		if !verified {
+			return fmt.Errorf("QC of round %d is signed by %v which is not a masternode", qc.ProposedBlockInfo.Round, signer.Hex())
+		}
+	}
+	return nil
 }
@@ -11,6 +11,7 @@ import (
 	"BRDPoSChain/accounts"
 	"BRDPoSChain/accounts/keystore"
 	"BRDPoSChain/common"
+	"BRDPoSChain/core/rawdb"
 	"BRDPoSChain/core/types"
 	"BRDPoSChain/crypto"
 	"github.com/stretchr/testify/assert"
@@ -138,3 +139,28 @@ func TestFindQCsInSameRound(t *testing.T) {
 }
 
 // TODO: Add test for FindAncestorBlockHash
+
+func TestSendVoteEquivocationProofPersistsProof(t *testing.T) {
+	forensics := NewForensics(rawdb.NewMemoryDatabase())
+	signer, _, err := getSignerAndSignFn(signer1)
+	assert.Nil(t, err)
+
+	vote := func(hash string, round types.Round) *types.Vote {
+		blockInfo := &types.BlockInfo{Hash: common.StringToHash(hash), Round: round, Number: big.NewInt(910)}
+		return &types.Vote{
+			ProposedBlockInfo: blockInfo,
+			Signature:         SignHashByPK(signer1, types.VoteSigHash(&types.VoteForSign{ProposedBlockInfo: blockInfo, GapNumber: 450}).Bytes()),
+			GapNumber:         450,
+		}
+	}
+	err = forensics.SendVoteEquivocationProof(vote("b2", 11), vote("b1", 10), signer)
+	assert.Nil(t, err)
+
+	proofs := forensics.GetForensicProofs(nil)
+	assert.Equal(t, 1, len(proofs))
+	assert.Equal(t, "Vote", proofs[0].ForensicsType)
+	assert.Equal(t, generateVoteEquivocationId(signer, 10, 11), proofs[0].Id)
+	assert.Equal(t, proofs, forensics.GetForensicProofs(&signer))
+	other := common.HexToAddress("0x1")
+	assert.Equal(t, 0, len(forensics.GetForensicProofs(&other)))
+}
@@ -0,0 +1,222 @@
+package engine_v2
+
+import (
+	"errors"
+	"math/big"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/consensus"
+	"BRDPoSChain/consensus/BRDPoS/utils"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/log"
+)
+
+// maxLeaderWeight caps the number of slots a masternode gets in a stake weighted leader rotation, so a
+// single large stake can't crowd the other masternodes out of the rotation.
+const maxLeaderWeight = 4
+
+// offlineLeaderSet is the set of offline leaders found in the window of blocks ending at a block.
+type offlineLeaderSet struct {
+	window  int
+	leaders map[common.Address]struct{}
+}
+
+// leaderSlots returns the leader rotation of the masternodes of an epoch. Without stake weighting every
+// masternode gets a single slot, in masternode order. With it, every masternode gets a slot per multiple
+// of the smallest stake, up to maxLeaderWeight, interleaved with smooth weighted round robin so the turns
+// of a masternode are spread over the rotation. Every masternode must have a positive stake, as a node
+// guessing at a rotation would pick different leaders than the rest of the network.
+func leaderSlots(masterNodes []common.Address, stakes map[common.Address]*big.Int, weighted bool) ([]common.Address, error) {
+	if !weighted || len(masterNodes) == 0 {
+		return masterNodes, nil
+	}
+	var minStake *big.Int
+	for _, m := range masterNodes {
+		stake := stakes[m]
+		if stake == nil || stake.Sign() <= 0 {
+			return nil, utils.ErrMissingStake
+		}
+		if minStake == nil || stake.Cmp(minStake) < 0 {
+			minStake = stake
+		}
+	}
+	var (
+		weights = make([]int64, len(masterNodes))
+		current = make([]int64, len(masterNodes))
+		total   int64
+	)
+	for i, m := range masterNodes {
+		weight := new(big.Int).Div(stakes[m], minStake)
+		if weight.Cmp(big.NewInt(maxLeaderWeight)) > 0 {
+			weights[i] = maxLeaderWeight
+		} else {
+			weights[i] = weight.Int64()
+		}
+		total += weights[i]
+	}
+	slots := make([]common.Address, 0, total)
+	for int64(len(slots)) < total {
+		best := 0
+		for i := range masterNodes {
+			current[i] += weights[i]
+			if current[i] > current[best] {
+				best = i
+			}
+		}
+		current[best] -= total
+		slots = append(slots, masterNodes[best])
+	}
+	return slots, nil
+}
+
+// scheduledLeader returns the leader of the round in the rotation. The turn of an offline leader passes
+// to the next masternode of the rotation which is not offline. If all of them are offline, the leader
+// keeps its turn.
+func scheduledLeader(slots []common.Address, round types.Round, epoch uint64, offline map[common.Address]struct{}) common.Address {
+	index := uint64(round) % epoch % uint64(len(slots))
+	for i := uint64(0); i < uint64(len(slots)); i++ {
+		leader := slots[(index+i)%uint64(len(slots))]
+		if _, ok := offline[leader]; !ok {
+			return leader
+		}
+	}
+	return slots[index]
+}
+
+// leaderOfRound returns the masternode whose turn it is to propose the block of the round on top of
+// parent, out of the masternodes of the epoch of that block.
+func (x *BRDPoS_v2) leaderOfRound(chain consensus.ChainReader, round types.Round, parent *types.Header, masterNodes []common.Address) (common.Address, error) {
+	config := x.config.V2.Config(uint64(round))
+	if config.OfflineLeaderWindow == 0 && !config.StakeWeightedLeader {
+		return masterNodes[uint64(round)%x.config.Epoch%uint64(len(masterNodes))], nil
+	}
+	slots, err := x.leaderRotation(chain, round, parent, masterNodes)
+	if err != nil {
+		return common.Address{}, err
+	}
+	var offline map[common.Address]struct{}
+	if config.OfflineLeaderWindow > 0 {
+		if offline, err = x.offlineLeaders(chain, parent, config.OfflineLeaderWindow); err != nil {
+			return common.Address{}, err
+		}
+	}
+	return scheduledLeader(slots, round, x.config.Epoch, offline), nil
+}
+
+// leaderRotation returns the leader slots of the masternodes of the epoch of the block of the round on top
+// of parent.
+func (x *BRDPoS_v2) leaderRotation(chain consensus.ChainReader, round types.Round, parent *types.Header, masterNodes []common.Address) ([]common.Address, error) {
+	if !x.config.V2.Config(uint64(round)).StakeWeightedLeader {
+		return masterNodes, nil
+	}
+	isEpochSwitch, _, err := x.isEpochSwitchAtRound(round, parent)
+	if err != nil {
+		return nil, err
+	}
+	epochSwitchNumber := parent.Number.Uint64() + 1
+	if !isEpochSwitch {
+		epochSwitchInfo, err := x.getEpochSwitchInfo(chain, parent, parent.Hash())
+		if err != nil {
+			return nil, err
+		}
+		epochSwitchNumber = epochSwitchInfo.EpochSwitchBlockInfo.Number.Uint64()
+	}
+	return x.stakeWeightedSlots(chain, epochSwitchNumber, masterNodes)
+}
+
+// stakeWeightedSlots returns the stake weighted leader rotation of the masternodes of the epoch starting
+// at the epoch switch block number, with the stakes recorded in the snapshot of the epoch.
+func (x *BRDPoS_v2) stakeWeightedSlots(chain consensus.ChainReader, epochSwitchNumber uint64, masterNodes []common.Address) ([]common.Address, error) {
+	snap, err := x.getSnapshot(chain, epochSwitchNumber, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(snap.Stakes) == 0 && len(snap.NextEpochCandidates) != 0 {
+		if snap, err = x.fillSnapshotStakes(chain, snap); err != nil {
+			return nil, err
+		}
+	}
+	return leaderSlots(masterNodes, snap.Stakes, true)
+}
+
+// fillSnapshotStakes gathers the stakes of the candidates of a snapshot stored before the stakes were
+// recorded, from the state of its gap block, and stores the snapshot again with them.
+func (x *BRDPoS_v2) fillSnapshotStakes(chain consensus.ChainReader, snap *SnapshotV2) (*SnapshotV2, error) {
+	if x.HookStakes == nil {
+		return nil, utils.ErrMissingStake
+	}
+	header := chain.GetHeader(snap.Hash, snap.Number)
+	if header == nil {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	stakes, err := x.HookStakes(chain, header, snap.NextEpochCandidates)
+	if err != nil {
+		log.Error("[fillSnapshotStakes] Fail to gather the stakes of the snapshot", "number", snap.Number, "hash", snap.Hash, "err", err)
+		return nil, err
+	}
+	// the snapshot is shared with the readers of the cache, a copy is stored instead
+	filled := newSnapshot(snap.Number, snap.Hash, snap.NextEpochCandidates)
+	filled.BLSPublicKeys = snap.BLSPublicKeys
+	filled.Stakes = stakes
+	if err := storeSnapshot(filled, x.db); err != nil {
+		return nil, err
+	}
+	x.snapshots.Add(filled.Hash, filled)
+	log.Info("[fillSnapshotStakes] Filled in the stakes of the snapshot", "number", filled.Number, "hash", filled.Hash)
+	return filled, nil
+}
+
+// offlineLeaders returns the masternodes which missed their turn to propose within the window of blocks
+// ending at head. Headers don't carry timeout certificates, but the rounds a timeout certificate was
+// formed for show up as a gap between the round of a block and the round of its parent. Such a round is
+// blamed on its leader in the rotation, regardless of the offline leaders skipped at the time, so the set
+// only depends on the headers of the window.
+func (x *BRDPoS_v2) offlineLeaders(chain consensus.ChainReader, head *types.Header, window int) (map[common.Address]struct{}, error) {
+	if set, ok := x.offlineLeaderSets.Get(head.Hash()); ok && set.window == window {
+		return set.leaders, nil
+	}
+	offline := make(map[common.Address]struct{})
+	header := head
+	for i := 0; i < window && header.Number.Cmp(x.config.V2.SwitchBlock) > 0; i++ {
+		parent := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+		if parent == nil {
+			return nil, consensus.ErrUnknownAncestor
+		}
+		round, err := x.GetRoundNumber(header)
+		if err != nil {
+			return nil, err
+		}
+		parentRound, err := x.GetRoundNumber(parent)
+		if err != nil {
+			return nil, err
+		}
+		if round > parentRound+1 {
+			epochSwitchInfo, err := x.getEpochSwitchInfo(chain, header, header.Hash())
+			if err != nil {
+				return nil, err
+			}
+			masterNodes := epochSwitchInfo.Masternodes
+			if len(masterNodes) == 0 {
+				return nil, errors.New("masternodes not found")
+			}
+			// a rotation repeats itself within an epoch worth of rounds
+			last := round
+			if uint64(round-parentRound) > x.config.Epoch {
+				last = parentRound + 1 + types.Round(x.config.Epoch)
+			}
+			for r := parentRound + 1; r < last; r++ {
+				slots, err := x.leaderRotation(chain, r, parent, masterNodes)
+				if err != nil {
+					return nil, err
+				}
+				offline[scheduledLeader(slots, r, x.config.Epoch, nil)] = struct{}{}
+			}
+		}
+		header = parent
+	}
+	if len(offline) != 0 {
+		log.Debug("[offlineLeaders] Offline leaders in the window", "number", head.Number, "hash", head.Hash(), "window", window, "offline", len(offline))
+	}
+	x.offlineLeaderSets.Add(head.Hash(), &offlineLeaderSet{window: window, leaders: offline})
+	return offline, nil
+}
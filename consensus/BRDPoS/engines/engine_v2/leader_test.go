@@ -0,0 +1,64 @@
+package engine_v2
+
+import (
+	"math/big"
+	"testing"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/consensus/BRDPoS/utils"
+)
+
+func TestStakeWeightedLeaderSlots(t *testing.T) {
+	masterNodes := []common.Address{{0x1}, {0x2}, {0x3}, {0x4}}
+	stakes := map[common.Address]*big.Int{
+		{0x1}: big.NewInt(100),
+		{0x2}: big.NewInt(250),
+		{0x3}: big.NewInt(100000),
+		{0x4}: big.NewInt(199),
+	}
+	if slots, err := leaderSlots(masterNodes, stakes, false); err != nil || len(slots) != len(masterNodes) {
+		t.Fatalf("unweighted rotation has %d slots, want %d: %v", len(slots), len(masterNodes), err)
+	}
+	slots, err := leaderSlots(masterNodes, stakes, true)
+	if err != nil {
+		t.Fatalf("failed to build the weighted rotation: %v", err)
+	}
+	counts := make(map[common.Address]int)
+	for i, slot := range slots {
+		counts[slot]++
+		if i > 0 && slot == slots[i-1] && slot != (common.Address{0x3}) {
+			t.Errorf("slot %d repeats masternode %v", i, slot)
+		}
+	}
+	want := map[common.Address]int{{0x1}: 1, {0x2}: 2, {0x3}: maxLeaderWeight, {0x4}: 1}
+	for m, n := range want {
+		if counts[m] != n {
+			t.Errorf("masternode %v has %d slots, want %d", m, counts[m], n)
+		}
+	}
+	// a missing stake must not silently fall back to another rotation
+	delete(stakes, common.Address{0x4})
+	if _, err := leaderSlots(masterNodes, stakes, true); err != utils.ErrMissingStake {
+		t.Fatalf("rotation with unknown stake: have %v, want %v", err, utils.ErrMissingStake)
+	}
+	if _, err := leaderSlots(masterNodes, nil, true); err != utils.ErrMissingStake {
+		t.Fatalf("rotation without stakes: have %v, want %v", err, utils.ErrMissingStake)
+	}
+}
+
+func TestScheduledLeaderSkipsOffline(t *testing.T) {
+	slots := []common.Address{{0x1}, {0x2}, {0x3}}
+	offline := map[common.Address]struct{}{{0x2}: {}, {0x3}: {}}
+
+	// round 4 belongs to 0x2, the turn passes over the offline 0x3 to 0x1
+	if leader := scheduledLeader(slots, 4, 900, offline); leader != (common.Address{0x1}) {
+		t.Fatalf("leader mismatch: have %v, want %v", leader, common.Address{0x1})
+	}
+	if leader := scheduledLeader(slots, 3, 900, offline); leader != (common.Address{0x1}) {
+		t.Fatalf("online leader lost its turn to %v", leader)
+	}
+	all := map[common.Address]struct{}{{0x1}: {}, {0x2}: {}, {0x3}: {}}
+	if leader := scheduledLeader(slots, 4, 900, all); leader != (common.Address{0x2}) {
+		t.Fatalf("leader mismatch with every masternode offline: have %v, want %v", leader, common.Address{0x2})
+	}
+}
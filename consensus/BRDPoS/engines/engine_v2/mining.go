@@ -50,10 +50,14 @@ func (x *BRDPoS_v2) yourturn(chain consensus.ChainReader, round types.Round, par
 		return false, nil
 	}
 
-	leaderIndex := uint64(round) % x.config.Epoch % uint64(len(masterNodes))
-	x.whosTurn = masterNodes[leaderIndex]
+	leader, err := x.leaderOfRound(chain, round, parent, masterNodes)
+	if err != nil {
+		log.Error("[yourturn] Fail to find the leader of the round", "round", round, "ParentHash", parent.Hash().Hex(), "err", err)
+		return false, err
+	}
+	x.whosTurn = leader
 	if x.whosTurn != signer {
-		log.Info("[yourturn] Not my turn", "curIndex", curIndex, "leaderIndex", leaderIndex, "Hash", parent.Hash().Hex(), "whosTurn", x.whosTurn.Hex(), "myaddr", signer.Hex())
+		log.Info("[yourturn] Not my turn", "curIndex", curIndex, "Hash", parent.Hash().Hex(), "whosTurn", x.whosTurn.Hex(), "myaddr", signer.Hex())
 		return false, nil
 	}
 
@@ -2,9 +2,14 @@ package engine_v2
 
 import (
 	"encoding/json"
+	"fmt"
+	"math/big"
+	"sync"
 
 	"BRDPoSChain/common"
+	"BRDPoSChain/common/hexutil"
 	"BRDPoSChain/consensus"
+	"BRDPoSChain/crypto/bls"
 	"BRDPoSChain/ethdb"
 	"BRDPoSChain/log"
 )
@@ -18,6 +23,15 @@ type SnapshotV2 struct {
 
 	// candidates will get assigned on updateM1
 	NextEpochCandidates []common.Address `json:"masterNodes"` // Set of authorized candidates nodes at this moment for next epoch
+
+	// BLS public keys registered by the candidates, only gathered after TIPBLS
+	BLSPublicKeys map[common.Address]hexutil.Bytes `json:"blsPublicKeys,omitempty"`
+
+	// Stakes of the candidates, used by the stake weighted leader rotation
+	Stakes map[common.Address]*big.Int `json:"stakes,omitempty"`
+
+	blsKeys     map[common.Address]*bls.PublicKey // parsed BLS public keys
+	blsKeysLock sync.Mutex
 }
 
 // create new snapshot for next epoch to use
@@ -62,6 +76,29 @@ func (s *SnapshotV2) GetMappedCandidates() map[common.Address]struct{} {
 	return ms
 }
 
+// BLSPublicKey returns the parsed BLS public key registered by the candidate.
+func (s *SnapshotV2) BLSPublicKey(address common.Address) (*bls.PublicKey, error) {
+	s.blsKeysLock.Lock()
+	defer s.blsKeysLock.Unlock()
+
+	if key, ok := s.blsKeys[address]; ok {
+		return key, nil
+	}
+	raw, ok := s.BLSPublicKeys[address]
+	if !ok {
+		return nil, fmt.Errorf("no BLS public key registered by %v in snapshot %d", address.Hex(), s.Number)
+	}
+	key, err := bls.PublicKeyFromBytes(raw)
+	if err != nil {
+		return nil, err
+	}
+	if s.blsKeys == nil {
+		s.blsKeys = make(map[common.Address]*bls.PublicKey)
+	}
+	s.blsKeys[address] = key
+	return key, nil
+}
+
 func (s *SnapshotV2) IsCandidates(address common.Address) bool {
 	for _, n := range s.NextEpochCandidates {
 		if n == address {
@@ -2,11 +2,17 @@ package engine_v2
 
 import (
 	"fmt"
+	"math/big"
+	"slices"
 	"testing"
 
 	"BRDPoSChain/common"
+	"BRDPoSChain/consensus/BRDPoS/utils"
 	"BRDPoSChain/core/rawdb"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/crypto/bls"
 	"BRDPoSChain/ethdb/leveldb"
+	"BRDPoSChain/params"
 )
 
 func TestGetMasterNodes(t *testing.T) {
@@ -40,3 +46,50 @@ func TestStoreLoadSnapshot(t *testing.T) {
 		t.Error("load snapshot failed", err)
 	}
 }
+
+func TestUpdateMasternodesAcrossTIPBLS(t *testing.T) {
+	defer func(tip *big.Int) { common.TIPBLS = tip }(common.TIPBLS)
+	common.TIPBLS = big.NewInt(1350)
+
+	x := New(params.TestBRDPoSMockChainConfig, rawdb.NewMemoryDatabase(), nil, nil)
+	registered, _ := bls.GenerateKey()
+	unregistered := common.Address{0x2}
+	ms := []utils.Masternode{
+		{Address: common.Address{0x1}, Stake: big.NewInt(2), BLSPublicKey: registered.PublicKey().Bytes()},
+		{Address: unregistered, Stake: big.NewInt(1)},
+	}
+
+	// before TIPBLS the masternode without a BLS public key is still a candidate
+	header := &types.Header{Number: big.NewInt(450)}
+	if err := x.UpdateMasternodes(nil, header, ms); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := loadSnapshot(x.db, header.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(snap.NextEpochCandidates, unregistered) {
+		t.Fatalf("unregistered masternode left out before TIPBLS: %v", snap.NextEpochCandidates)
+	}
+
+	// from TIPBLS on it's left out, every candidate left can be verified
+	header = &types.Header{Number: big.NewInt(1350)}
+	if err := x.UpdateMasternodes(nil, header, ms); err != nil {
+		t.Fatal(err)
+	}
+	snap, err = loadSnapshot(x.db, header.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.NextEpochCandidates) != 1 || snap.NextEpochCandidates[0] != ms[0].Address {
+		t.Fatalf("candidates mismatch after TIPBLS: %v", snap.NextEpochCandidates)
+	}
+	for _, candidate := range snap.NextEpochCandidates {
+		if _, err := snap.BLSPublicKey(candidate); err != nil {
+			t.Errorf("candidate %v can't be verified: %v", candidate, err)
+		}
+	}
+	if _, ok := snap.Stakes[unregistered]; ok {
+		t.Error("stake of the unregistered masternode kept in the snapshot")
+	}
+}
@@ -83,6 +83,16 @@ func (x *BRDPoS_v2) AuthorizeFaker(signer common.Address) {
 	x.signer = signer
 }
 
+// Utils for test to drop the cached offline leaders, as after a restart
+func (x *BRDPoS_v2) PurgeOfflineLeadersFaker() {
+	x.offlineLeaderSets.Purge()
+}
+
 func (x *BRDPoS_v2) GetForensicsFaker() *Forensics {
 	return x.ForensicsProcessor
 }
+
+// Utils for test to wait for the forensics the engine started in the background
+func (x *BRDPoS_v2) WaitForensicsFaker() {
+	x.ForensicsProcessor.running.Wait()
+}
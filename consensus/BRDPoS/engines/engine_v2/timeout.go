@@ -56,8 +56,10 @@ In the engine v2, we will need to:
 */
 func (x *BRDPoS_v2) onTimeoutPoolThresholdReached(blockChainReader consensus.ChainReader, pooledTimeouts map[common.Hash]utils.PoolObj, currentTimeoutMsg utils.PoolObj, gapNumber uint64) error {
 	signatures := []types.Signature{}
+	signerSignatures := make(map[common.Address]types.Signature)
 	for _, v := range pooledTimeouts {
 		signatures = append(signatures, v.(*types.Timeout).Signature)
+		signerSignatures[v.GetSigner()] = v.(*types.Timeout).Signature
 	}
 	// Genrate TC
 	timeoutCert := &types.TimeoutCert{
@@ -65,6 +67,16 @@ func (x *BRDPoS_v2) onTimeoutPoolThresholdReached(blockChainReader consensus.Cha
 		Signatures: signatures,
 		GapNumber:  gapNumber,
 	}
+	// After TIPBLS the signatures of the candidates of the gap block snapshot are aggregated
+	if x.isBLSGap(gapNumber) {
+		snap, err := x.getSnapshot(blockChainReader, gapNumber, true)
+		if err != nil {
+			log.Error("[onTimeoutPoolThresholdReached] Fail to get snapshot to aggregate TC", "GapNumber", gapNumber, "Error", err)
+			return err
+		}
+		timeoutCert.Signatures = []types.Signature{}
+		timeoutCert.AggregatedSignature, timeoutCert.SignerBitmap, _ = aggregateSignatures(signerSignatures, snap.NextEpochCandidates)
+	}
 	// Process TC
 	err := x.processTC(blockChainReader, timeoutCert)
 	if err != nil {
@@ -125,7 +137,7 @@ func (x *BRDPoS_v2) verifyTC(chain consensus.ChainReader, timeoutCert *types.Tim
 					- Use the above public key to find out the brc address
 					- Use the above brc address to check against the master node list from step 1(For the received TC epoch)
 	*/
-	if timeoutCert == nil || timeoutCert.Signatures == nil {
+	if timeoutCert == nil || (timeoutCert.Signatures == nil && !timeoutCert.IsAggregated()) {
 		log.Warn("[verifyTC] TC or TC signatures is Nil")
 		return utils.ErrInvalidTC
 	}
@@ -140,19 +152,44 @@ func (x *BRDPoS_v2) verifyTC(chain consensus.ChainReader, timeoutCert *types.Tim
 		return errors.New("empty master node lists from snapshot")
 	}
 
-	signatures, duplicates := UniqueSignatures(timeoutCert.Signatures)
-	if len(duplicates) != 0 {
-		for _, d := range duplicates {
-			log.Warn("[verifyQC] duplicated signature in QC", "duplicate", common.Bytes2Hex(d))
-		}
-	}
-
 	epochInfo, err := x.getTCEpochInfo(chain, timeoutCert)
 	if err != nil {
 		return err
 	}
 
 	certThreshold := x.config.V2.Config(uint64(timeoutCert.Round)).CertThreshold
+	signedTimeoutObj := types.TimeoutSigHash(&types.TimeoutForSign{
+		Round:     timeoutCert.Round,
+		GapNumber: timeoutCert.GapNumber,
+	})
+
+	if x.isBLSGap(timeoutCert.GapNumber) {
+		if len(timeoutCert.Signatures) != 0 || !timeoutCert.IsAggregated() {
+			log.Warn("[verifyTC] TC is not aggregated after TIPBLS", "tcRound", timeoutCert.Round, "tcGapNumber", timeoutCert.GapNumber)
+			return utils.ErrInvalidTCSignatures
+		}
+		signers, err := x.verifyAggregatedSignature(chain, signedTimeoutObj, timeoutCert.AggregatedSignature, timeoutCert.SignerBitmap, snap.NextEpochCandidates, timeoutCert.GapNumber)
+		if err != nil {
+			log.Warn("[verifyTC] Aggregated signature not verified doing TC verification", "tcRound", timeoutCert.Round, "tcGapNumber", timeoutCert.GapNumber, "error", err)
+			return fmt.Errorf("fail to verify TC aggregated signature: %v", err)
+		}
+		if float64(len(signers)) < float64(epochInfo.MasternodesLen)*certThreshold {
+			log.Warn("[verifyTC] Invalid TC signers less then config", "tcRound", timeoutCert.Round, "tcGapNumber", timeoutCert.GapNumber, "tcSignerLen", len(signers), "certThreshold", float64(epochInfo.MasternodesLen)*certThreshold)
+			return utils.ErrInvalidTCSignatures
+		}
+		return nil
+	}
+	if timeoutCert.IsAggregated() || len(timeoutCert.SignerBitmap) != 0 {
+		log.Warn("[verifyTC] TC is aggregated before TIPBLS", "tcRound", timeoutCert.Round, "tcGapNumber", timeoutCert.GapNumber)
+		return utils.ErrInvalidTCSignatures
+	}
+
+	signatures, duplicates := UniqueSignatures(timeoutCert.Signatures)
+	if len(duplicates) != 0 {
+		for _, d := range duplicates {
+			log.Warn("[verifyQC] duplicated signature in QC", "duplicate", common.Bytes2Hex(d))
+		}
+	}
 	if float64(len(signatures)) < float64(epochInfo.MasternodesLen)*certThreshold {
 		log.Warn("[verifyTC] Invalid TC Signature is less or empty", "tcRound", timeoutCert.Round, "tcGapNumber", timeoutCert.GapNumber, "tcSignLen", len(timeoutCert.Signatures), "certThreshold", float64(epochInfo.MasternodesLen)*certThreshold)
 		return utils.ErrInvalidTCSignatures
@@ -164,11 +201,6 @@ func (x *BRDPoS_v2) verifyTC(chain consensus.ChainReader, timeoutCert *types.Tim
 	var mutex sync.Mutex
 	var haveError error
 
-	signedTimeoutObj := types.TimeoutSigHash(&types.TimeoutForSign{
-		Round:     timeoutCert.Round,
-		GapNumber: timeoutCert.GapNumber,
-	})
-
 	for _, signature := range signatures {
 		go func(sig types.Signature) {
 			defer wg.Done()
@@ -250,10 +282,10 @@ func (x *BRDPoS_v2) sendTimeout(chain consensus.ChainReader) error {
 		log.Debug("[sendTimeout] non-epoch-switch block found its epoch block and calculated the gapNumber", "epochSwitchInfo.EpochSwitchBlockInfo.Number", epochSwitchInfo.EpochSwitchBlockInfo.Number.Uint64(), "gapNumber", gapNumber)
 	}
 
-	signedHash, err := x.signSignature(types.TimeoutSigHash(&types.TimeoutForSign{
+	signedHash, blsSigner, err := x.signMessage(&types.TimeoutForSign{
 		Round:     x.currentRound,
 		GapNumber: gapNumber,
-	}))
+	})
 	if err != nil {
 		log.Error("[sendTimeout] signSignature when sending out TC", "Error", err, "round", x.currentRound, "gap", gapNumber)
 		return err
@@ -262,6 +294,7 @@ func (x *BRDPoS_v2) sendTimeout(chain consensus.ChainReader) error {
 		Round:     x.currentRound,
 		Signature: signedHash,
 		GapNumber: gapNumber,
+		BLSSigner: blsSigner,
 	}
 
 	timeoutMsg.SetSigner(x.signer)
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"slices"
 
 	"BRDPoSChain/accounts"
 	"BRDPoSChain/common"
@@ -11,12 +12,18 @@ import (
 	"BRDPoSChain/consensus/BRDPoS/utils"
 	"BRDPoSChain/core/types"
 	"BRDPoSChain/crypto"
+	"BRDPoSChain/crypto/bls"
 	"BRDPoSChain/log"
 	"BRDPoSChain/rlp"
 
 	"golang.org/x/crypto/sha3"
 )
 
+// SigHash returns the hash a masternode signs to seal a v2 header.
+func SigHash(header *types.Header) common.Hash {
+	return sigHash(header)
+}
+
 func sigHash(header *types.Header) (hash common.Hash) {
 	hasher := sha3.NewLegacyKeccak256()
 
@@ -127,6 +134,177 @@ func (x *BRDPoS_v2) verifyMsgSignature(signedHashToBeVerified common.Hash, signa
 	return false, signerAddress, nil
 }
 
+// isBLSGap returns whether the votes, timeouts and certificates of the epoch gathered at the gap number are
+// signed with BLS.
+func (x *BRDPoS_v2) isBLSGap(gapNumber uint64) bool {
+	return x.chainConfig.IsTIPBLS(new(big.Int).SetUint64(gapNumber))
+}
+
+// signMessage signs a vote or timeout, a *types.VoteForSign or *types.TimeoutForSign, of the epoch gathered at
+// its gap number. After TIPBLS, it's a BLS signature and the returned address is the signer to claim it by, as
+// it can't be recovered from the signature. A consensus signer, if authorized, is handed the message either way.
+func (x *BRDPoS_v2) signMessage(msg interface{}) (types.Signature, common.Address, error) {
+	var (
+		signingHash common.Hash
+		gapNumber   uint64
+	)
+	switch m := msg.(type) {
+	case *types.VoteForSign:
+		signingHash, gapNumber = types.VoteSigHash(m), m.GapNumber
+	case *types.TimeoutForSign:
+		signingHash, gapNumber = types.TimeoutSigHash(m), m.GapNumber
+	default:
+		return nil, common.Address{}, fmt.Errorf("unsupported message type %T", msg)
+	}
+	x.signLock.RLock()
+	signer, blsKey, consensusSigner := x.signer, x.blsKey, x.consensusSigner
+	x.signLock.RUnlock()
+
+	isBLS := x.isBLSGap(gapNumber)
+	if consensusSigner == nil {
+		if !isBLS {
+			signature, err := x.signSignature(signingHash)
+			return signature, common.Address{}, err
+		}
+		if blsKey == nil {
+			return nil, common.Address{}, errors.New("no BLS key authorized for signing")
+		}
+		return blsKey.Sign(signingHash.Bytes()).Bytes(), signer, nil
+	}
+	var (
+		account   = accounts.Account{Address: signer}
+		signature []byte
+		err       error
+	)
+	switch m := msg.(type) {
+	case *types.VoteForSign:
+		if isBLS {
+			signature, err = consensusSigner.SignBLSVote(account, m)
+		} else {
+			signature, err = consensusSigner.SignVote(account, m)
+		}
+	case *types.TimeoutForSign:
+		if isBLS {
+			signature, err = consensusSigner.SignBLSTimeout(account, m)
+		} else {
+			signature, err = consensusSigner.SignTimeout(account, m)
+		}
+	}
+	if err != nil {
+		return nil, common.Address{}, fmt.Errorf("error %v while signing message", err)
+	}
+	if !isBLS {
+		return signature, common.Address{}, nil
+	}
+	return signature, signer, nil
+}
+
+// verifyMessage checks the signature of a vote or timeout of the epoch gathered at the gap number is from one of the
+// masternodes. Before TIPBLS the signer is recovered from the ECDSA signature, after it the BLS signature is checked
+// against the key the claimed signer registered in the gap block snapshot.
+func (x *BRDPoS_v2) verifyMessage(chain consensus.ChainReader, signedHash common.Hash, signature types.Signature, blsSigner common.Address, gapNumber uint64, masternodes []common.Address) (bool, common.Address, error) {
+	if !x.isBLSGap(gapNumber) {
+		return x.verifyMsgSignature(signedHash, signature, masternodes)
+	}
+	if len(masternodes) == 0 {
+		return false, blsSigner, errors.New("empty masternode list detected when verifying message signatures")
+	}
+	if !slices.Contains(masternodes, blsSigner) {
+		log.Warn("[verifyMessage] signer is not part of masternode list", "signer", blsSigner, "masternodes", masternodes)
+		return false, blsSigner, nil
+	}
+	snap, err := x.getSnapshot(chain, gapNumber, true)
+	if err != nil {
+		return false, blsSigner, err
+	}
+	publicKey, err := snap.BLSPublicKey(blsSigner)
+	if err != nil {
+		return false, blsSigner, err
+	}
+	sig, err := bls.SignatureFromBytes(signature)
+	if err != nil {
+		return false, blsSigner, fmt.Errorf("error while verifying message: %v", err)
+	}
+	return bls.Verify(publicKey, signedHash.Bytes(), sig), blsSigner, nil
+}
+
+// aggregateSignatures aggregates the BLS signatures of a certificate. Bit i of the returned bitmap is set if
+// the i-th of the eligible signers signed.
+func aggregateSignatures(signatures map[common.Address]types.Signature, eligible []common.Address) (types.Signature, []byte, int) {
+	var (
+		sigs   []*bls.Signature
+		bitmap = make([]byte, (len(eligible)+7)/8)
+	)
+	for i, signer := range eligible {
+		signature, ok := signatures[signer]
+		if !ok {
+			continue
+		}
+		sig, err := bls.SignatureFromBytes(signature)
+		if err != nil {
+			log.Warn("[aggregateSignatures] Skip invalid BLS signature", "signer", signer, "err", err)
+			continue
+		}
+		sigs = append(sigs, sig)
+		bitmap[i/8] |= 1 << (i % 8)
+	}
+	if len(sigs) == 0 {
+		return nil, bitmap, 0
+	}
+	return bls.AggregateSignatures(sigs).Bytes(), bitmap, len(sigs)
+}
+
+// bitmapSigners returns the eligible signers whose bit is set in the bitmap of a certificate.
+func bitmapSigners(bitmap []byte, eligible []common.Address) ([]common.Address, error) {
+	if len(bitmap) != (len(eligible)+7)/8 {
+		return nil, fmt.Errorf("signer bitmap length %d mismatch for %d signers", len(bitmap), len(eligible))
+	}
+	var signers []common.Address
+	for i := 0; i < len(bitmap)*8; i++ {
+		if bitmap[i/8]&(1<<(i%8)) == 0 {
+			continue
+		}
+		if i >= len(eligible) {
+			return nil, fmt.Errorf("signer bitmap flags signer %d out of %d", i, len(eligible))
+		}
+		signers = append(signers, eligible[i])
+	}
+	return signers, nil
+}
+
+// verifyAggregatedSignature checks the aggregate signature of a certificate of the epoch gathered at the gap
+// number over the signed hash, against the BLS public keys the signers flagged in the bitmap registered in the
+// gap block snapshot. It returns the signers.
+func (x *BRDPoS_v2) verifyAggregatedSignature(chain consensus.ChainReader, signedHash common.Hash, aggregated types.Signature, bitmap []byte, eligible []common.Address, gapNumber uint64) ([]common.Address, error) {
+	signers, err := bitmapSigners(bitmap, eligible)
+	if err != nil {
+		return nil, err
+	}
+	if len(signers) == 0 {
+		return nil, errors.New("no signer in the signer bitmap")
+	}
+	snap, err := x.getSnapshot(chain, gapNumber, true)
+	if err != nil {
+		return nil, err
+	}
+	publicKeys := make([]*bls.PublicKey, 0, len(signers))
+	for _, signer := range signers {
+		publicKey, err := snap.BLSPublicKey(signer)
+		if err != nil {
+			return nil, err
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+	sig, err := bls.SignatureFromBytes(aggregated)
+	if err != nil {
+		return nil, err
+	}
+	if !bls.FastAggregateVerify(publicKeys, signedHash.Bytes(), sig) {
+		return nil, errors.New("aggregated signature mis-match")
+	}
+	return signers, nil
+}
+
 func (x *BRDPoS_v2) getExtraFields(header *types.Header) (*types.QuorumCert, types.Round, []common.Address, error) {
 
 	var masternodes []common.Address
@@ -194,8 +372,10 @@ func (x *BRDPoS_v2) CalculateMissingRounds(chain consensus.ChainReader, header *
 		if parentRound+1 != currRound {
 			// We need to iterate from the parentRound to the currRound to determine which miner did not perform mining.
 			for i := parentRound + 1; i < currRound; i++ {
-				leaderIndex := uint64(i) % x.config.Epoch % uint64(len(masternodes))
-				whosTurn := masternodes[leaderIndex]
+				whosTurn, err := x.leaderOfRound(chain, i, parentHeader, masternodes)
+				if err != nil {
+					return nil, err
+				}
 				missedRounds = append(
 					missedRounds,
 					utils.MissedRoundInfo{
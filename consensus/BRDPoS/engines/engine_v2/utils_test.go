@@ -0,0 +1,121 @@
+package engine_v2
+
+import (
+	"math/big"
+	"testing"
+
+	"BRDPoSChain/accounts"
+	"BRDPoSChain/common"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/crypto/bls"
+	"BRDPoSChain/params"
+)
+
+func TestAggregateSignaturesBitmap(t *testing.T) {
+	var (
+		eligible   = make([]common.Address, 10)
+		keys       = make([]*bls.SecretKey, len(eligible))
+		signatures = make(map[common.Address]types.Signature)
+		msg        = []byte("vote")
+	)
+	for i := range eligible {
+		eligible[i] = common.Address{byte(i + 1)}
+		keys[i], _ = bls.GenerateKey()
+	}
+	signed := []int{0, 3, 8, 9}
+	for _, i := range signed {
+		signatures[eligible[i]] = keys[i].Sign(msg).Bytes()
+	}
+	// signatures of non eligible signers are ignored
+	outsider, _ := bls.GenerateKey()
+	signatures[common.Address{0xff}] = outsider.Sign(msg).Bytes()
+
+	aggregated, bitmap, count := aggregateSignatures(signatures, eligible)
+	if count != len(signed) {
+		t.Fatalf("signer count mismatch: have %d, want %d", count, len(signed))
+	}
+	signers, err := bitmapSigners(bitmap, eligible)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signers) != len(signed) {
+		t.Fatalf("bitmap signers mismatch: have %v", signers)
+	}
+	var pks []*bls.PublicKey
+	for i, signer := range signers {
+		if signer != eligible[signed[i]] {
+			t.Fatalf("bitmap signer %d mismatch: have %v, want %v", i, signer, eligible[signed[i]])
+		}
+		pks = append(pks, keys[signed[i]].PublicKey())
+	}
+	sig, err := bls.SignatureFromBytes(aggregated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bls.FastAggregateVerify(pks, msg, sig) {
+		t.Fatal("aggregated signature doesn't verify against the bitmap signers")
+	}
+
+	if _, err := bitmapSigners(bitmap[:1], eligible); err == nil {
+		t.Error("short bitmap accepted")
+	}
+	if _, err := bitmapSigners([]byte{0, 0x04}, eligible); err == nil {
+		t.Error("bitmap flagging an out of range signer accepted")
+	}
+}
+
+// recordingSigner is a consensus signer answering with the name of the method called.
+type recordingSigner struct{}
+
+func (recordingSigner) SignHeader(accounts.Account, *types.Header) ([]byte, error) {
+	return []byte("header"), nil
+}
+
+func (recordingSigner) SignVote(accounts.Account, *types.VoteForSign) ([]byte, error) {
+	return []byte("vote"), nil
+}
+
+func (recordingSigner) SignTimeout(accounts.Account, *types.TimeoutForSign) ([]byte, error) {
+	return []byte("timeout"), nil
+}
+
+func (recordingSigner) SignBLSVote(accounts.Account, *types.VoteForSign) ([]byte, error) {
+	return []byte("bls vote"), nil
+}
+
+func (recordingSigner) SignBLSTimeout(accounts.Account, *types.TimeoutForSign) ([]byte, error) {
+	return []byte("bls timeout"), nil
+}
+
+func TestSignMessageWithConsensusSigner(t *testing.T) {
+	defer func(tip *big.Int) { common.TIPBLS = tip }(common.TIPBLS)
+	common.TIPBLS = big.NewInt(450)
+
+	// a local BLS key must not be used while a consensus signer is authorized
+	blsKey, _ := bls.GenerateKey()
+	x := &BRDPoS_v2{
+		chainConfig:     params.TestBRDPoSMockChainConfig,
+		signer:          common.Address{0x1},
+		blsKey:          blsKey,
+		consensusSigner: recordingSigner{},
+	}
+	tests := []struct {
+		msg    interface{}
+		want   string
+		signer common.Address
+	}{
+		{&types.VoteForSign{ProposedBlockInfo: &types.BlockInfo{Number: big.NewInt(1)}}, "vote", common.Address{}},
+		{&types.TimeoutForSign{Round: 1}, "timeout", common.Address{}},
+		{&types.VoteForSign{ProposedBlockInfo: &types.BlockInfo{Number: big.NewInt(901)}, GapNumber: 450}, "bls vote", common.Address{0x1}},
+		{&types.TimeoutForSign{Round: 1, GapNumber: 450}, "bls timeout", common.Address{0x1}},
+	}
+	for i, tt := range tests {
+		signature, signer, err := x.signMessage(tt.msg)
+		if err != nil {
+			t.Fatalf("test %d: failed to sign: %v", i, err)
+		}
+		if string(signature) != tt.want || signer != tt.signer {
+			t.Errorf("test %d: have %q claimed by %v, want %q claimed by %v", i, signature, signer, tt.want, tt.signer)
+		}
+	}
+}
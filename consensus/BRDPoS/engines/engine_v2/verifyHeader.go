@@ -179,9 +179,13 @@ func (x *BRDPoS_v2) verifyHeader(chain consensus.ChainReader, header *types.Head
 	}
 	// Check the proposer is the leader
 	curIndex := utils.Position(masterNodes, validatorAddress)
-	leaderIndex := uint64(round) % x.config.Epoch % uint64(len(masterNodes))
-	if masterNodes[leaderIndex] != validatorAddress {
-		log.Warn("[verifyHeader] Invalid blocker proposer, not its turn", "curIndex", curIndex, "leaderIndex", leaderIndex, "Hash", header.Hash().Hex(), "masterNodes[leaderIndex]", masterNodes[leaderIndex], "validatorAddress", validatorAddress)
+	leader, err := x.leaderOfRound(chain, round, parent, masterNodes)
+	if err != nil {
+		log.Warn("[verifyHeader] Fail to find the leader of the round", "round", round, "Hash", header.Hash().Hex(), "err", err)
+		return err
+	}
+	if leader != validatorAddress {
+		log.Warn("[verifyHeader] Invalid blocker proposer, not its turn", "curIndex", curIndex, "Hash", header.Hash().Hex(), "leader", leader, "validatorAddress", validatorAddress)
 		return utils.ErrNotItsTurn
 	}
 
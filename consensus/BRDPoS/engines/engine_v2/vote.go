@@ -34,10 +34,10 @@ func (x *BRDPoS_v2) sendVote(chainReader consensus.ChainReader, blockInfo *types
 	if epochSwitchNumber-epochSwitchNumber%x.config.Epoch < x.config.Gap {
 		gapNumber = 0
 	}
-	signedHash, err := x.signSignature(types.VoteSigHash(&types.VoteForSign{
+	signedHash, blsSigner, err := x.signMessage(&types.VoteForSign{
 		ProposedBlockInfo: blockInfo,
 		GapNumber:         gapNumber,
-	}))
+	})
 	if err != nil {
 		log.Error("signSignature when sending out Vote", "BlockInfoHash", blockInfo.Hash, "Error", err)
 		return err
@@ -48,6 +48,7 @@ func (x *BRDPoS_v2) sendVote(chainReader consensus.ChainReader, blockInfo *types
 		ProposedBlockInfo: blockInfo,
 		Signature:         signedHash,
 		GapNumber:         gapNumber,
+		BLSSigner:         blsSigner,
 	}
 
 	err = x.voteHandler(chainReader, voteMsg)
@@ -77,8 +78,12 @@ func (x *BRDPoS_v2) voteHandler(chain consensus.ChainReader, voteMsg *types.Vote
 	// Collect vote
 	numberOfVotesInPool, pooledVotes := x.votePool.Add(voteMsg)
 	log.Debug("[voteHandler] collect votes", "number", numberOfVotesInPool)
-	go x.ForensicsProcessor.DetectEquivocationInVotePool(voteMsg, x.votePool)
-	go x.ForensicsProcessor.ProcessVoteEquivocation(chain, x, voteMsg)
+	x.ForensicsProcessor.inBackground(func() {
+		x.ForensicsProcessor.DetectEquivocationInVotePool(voteMsg, x.votePool)
+	})
+	x.ForensicsProcessor.inBackground(func() {
+		x.ForensicsProcessor.ProcessVoteEquivocation(chain, x, voteMsg)
+	})
 
 	epochInfo, err := x.getEpochSwitchInfo(chain, nil, voteMsg.ProposedBlockInfo.Hash)
 	if err != nil {
@@ -151,7 +156,7 @@ func (x *BRDPoS_v2) verifyVotes(chain consensus.ChainReader, votes map[common.Ha
 				ProposedBlockInfo: v.ProposedBlockInfo,
 				GapNumber:         v.GapNumber,
 			})
-			verified, masterNode, err := x.verifyMsgSignature(signedVote, v.Signature, masternodes)
+			verified, masterNode, err := x.verifyMessage(chain, signedVote, v.Signature, v.BLSSigner, v.GapNumber, masternodes)
 			if err != nil {
 				log.Warn("[verifyVotes] error while verifying vote signature", "error", err.Error())
 				return
@@ -176,10 +181,12 @@ In the engine v2, we will need to generate and process QC
 func (x *BRDPoS_v2) onVotePoolThresholdReached(chain consensus.ChainReader, pooledVotes map[common.Hash]utils.PoolObj, currentVoteMsg utils.PoolObj, proposedBlockHeader *types.Header) error {
 	// The signature list may contain empty entey. we only care the ones with values
 	var validSignatures []types.Signature
+	signerSignatures := make(map[common.Address]types.Signature)
 	emptySigner := common.Address{}
 	for _, vote := range pooledVotes {
 		if vote.GetSigner() != emptySigner {
 			validSignatures = append(validSignatures, vote.(*types.Vote).Signature)
+			signerSignatures[vote.GetSigner()] = vote.(*types.Vote).Signature
 		}
 	}
 
@@ -189,24 +196,30 @@ func (x *BRDPoS_v2) onVotePoolThresholdReached(chain consensus.ChainReader, pool
 		return errors.New("fail on voteHandler due to failure in getting epoch switch info")
 	}
 
-	// Skip and wait for the next vote to process again if valid votes is less than what we required
-	certThreshold := x.config.V2.Config(uint64(currentVoteMsg.(*types.Vote).ProposedBlockInfo.Round)).CertThreshold
-	if float64(len(validSignatures)) < float64(epochInfo.MasternodesLen)*certThreshold {
-		log.Warn("[onVotePoolThresholdReached] Not enough valid signatures to generate QC", "VotesSignaturesAfterFilter", validSignatures, "NumberOfValidVotes", len(validSignatures), "NumberOfVotes", len(pooledVotes))
-		return nil
-	}
-	// Genrate QC
+	// Genrate QC, after TIPBLS the signatures of the masternodes are aggregated
 	quorumCert := &types.QuorumCert{
 		ProposedBlockInfo: currentVoteMsg.(*types.Vote).ProposedBlockInfo,
 		Signatures:        validSignatures,
 		GapNumber:         currentVoteMsg.(*types.Vote).GapNumber,
 	}
+	numberOfSigners := len(validSignatures)
+	if x.isBLSGap(quorumCert.GapNumber) {
+		quorumCert.Signatures = []types.Signature{}
+		quorumCert.AggregatedSignature, quorumCert.SignerBitmap, numberOfSigners = aggregateSignatures(signerSignatures, epochInfo.Masternodes)
+	}
+
+	// Skip and wait for the next vote to process again if valid votes is less than what we required
+	certThreshold := x.config.V2.Config(uint64(currentVoteMsg.(*types.Vote).ProposedBlockInfo.Round)).CertThreshold
+	if float64(numberOfSigners) < float64(epochInfo.MasternodesLen)*certThreshold {
+		log.Warn("[onVotePoolThresholdReached] Not enough valid signatures to generate QC", "VotesSignaturesAfterFilter", validSignatures, "NumberOfValidVotes", numberOfSigners, "NumberOfVotes", len(pooledVotes))
+		return nil
+	}
 	err = x.processQC(chain, quorumCert)
 	if err != nil {
 		log.Error("Error while processing QC in the Vote handler after reaching pool threshold, ", err)
 		return err
 	}
-	log.Info("Successfully processed the vote and produced QC!", "QcRound", quorumCert.ProposedBlockInfo.Round, "QcNumOfSig", len(quorumCert.Signatures), "QcHash", quorumCert.ProposedBlockInfo.Hash, "QcNumber", quorumCert.ProposedBlockInfo.Number.Uint64())
+	log.Info("Successfully processed the vote and produced QC!", "QcRound", quorumCert.ProposedBlockInfo.Round, "QcNumOfSig", numberOfSigners, "QcHash", quorumCert.ProposedBlockInfo.Hash, "QcNumber", quorumCert.ProposedBlockInfo.Number.Uint64())
 	return nil
 }
 
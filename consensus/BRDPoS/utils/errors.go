@@ -18,6 +18,18 @@ var (
 	// that is not part of the local blockchain.
 	ErrUnknownBlock = errors.New("unknown block")
 
+	// ErrNotConflictingForensics is returned if the two messages of a forensic proof
+	// are for the same block.
+	ErrNotConflictingForensics = errors.New("forensic proof does not have conflicting messages")
+
+	// ErrNotSlashableEquivocation is returned if the two votes of a vote equivocation
+	// proof are not in the same round.
+	ErrNotSlashableEquivocation = errors.New("votes of a slashable equivocation must be in the same round")
+
+	// ErrMissingStake is returned if the stake weighted leader rotation of an epoch
+	// is requested from a snapshot which doesn't record the stakes of all masternodes.
+	ErrMissingStake = errors.New("masternode stake missing from snapshot")
+
 	// errInvalidCheckpointBeneficiary is returned if a checkpoint/epoch transition
 	// block has a beneficiary set to non-zeroes.
 	ErrInvalidCheckpointBeneficiary = errors.New("beneficiary in checkpoint block non-zero")
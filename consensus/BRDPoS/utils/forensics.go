@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/crypto"
+	"BRDPoSChain/crypto/bls"
+)
+
+// GetVoteSignerAddresses returns the signer recovered from the ECDSA signature of the vote. For a BLS signed vote, it
+// returns the claimed signer without checking the signature.
+func GetVoteSignerAddresses(vote *types.Vote) (common.Address, error) {
+	if len(vote.Signature) == bls.SignatureLength {
+		return vote.BLSSigner, nil
+	}
+	// The QC signatures are signed by votes special struct VoteForSign
+	signHash := types.VoteSigHash(&types.VoteForSign{
+		ProposedBlockInfo: vote.ProposedBlockInfo,
+		GapNumber:         vote.GapNumber,
+	})
+	var signerAddress common.Address
+	pubkey, err := crypto.Ecrecover(signHash.Bytes(), vote.Signature)
+	if err != nil {
+		return signerAddress, fmt.Errorf("fail to Ecrecover signer from the vote: %v", vote)
+	}
+	copy(signerAddress[:], crypto.Keccak256(pubkey[1:])[12:])
+	return signerAddress, nil
+}
+
+// VerifyVoteEquivocation checks the two votes of the proof are signed by its signer for different blocks of the same round.
+// BLS signed votes are checked against the BLS public key the signer registered. It only depends on the proof and the key,
+// so every node gets the same result when processing a slashing transaction. Whether the signer is a masternode of the
+// round is left to the caller.
+func VerifyVoteEquivocation(content *types.VoteEquivocationContent, blsPublicKey []byte) error {
+	if content.SmallerRoundVote == nil || content.LargerRoundVote == nil || content.SmallerRoundVote.ProposedBlockInfo == nil || content.LargerRoundVote.ProposedBlockInfo == nil {
+		return errors.New("vote equivocation proof is missing a vote")
+	}
+	if content.SmallerRoundVote.ProposedBlockInfo.Round != content.LargerRoundVote.ProposedBlockInfo.Round {
+		return ErrNotSlashableEquivocation
+	}
+	if content.SmallerRoundVote.ProposedBlockInfo.Hash == content.LargerRoundVote.ProposedBlockInfo.Hash {
+		return ErrNotConflictingForensics
+	}
+	for _, vote := range []*types.Vote{content.SmallerRoundVote, content.LargerRoundVote} {
+		if len(vote.Signature) == bls.SignatureLength {
+			if err := verifyBLSVote(vote, blsPublicKey); err != nil {
+				return err
+			}
+		}
+		signer, err := GetVoteSignerAddresses(vote)
+		if err != nil {
+			return err
+		}
+		if signer != content.Signer {
+			return fmt.Errorf("vote of round %d is signed by %v instead of %v", vote.ProposedBlockInfo.Round, signer.Hex(), content.Signer.Hex())
+		}
+	}
+	return nil
+}
+
+// verifyBLSVote checks the BLS signature of the vote against the public key of its claimed signer.
+func verifyBLSVote(vote *types.Vote, blsPublicKey []byte) error {
+	if len(blsPublicKey) == 0 {
+		return fmt.Errorf("no BLS public key of %v to verify the vote of round %d", vote.BLSSigner.Hex(), vote.ProposedBlockInfo.Round)
+	}
+	publicKey, err := bls.PublicKeyFromBytes(blsPublicKey)
+	if err != nil {
+		return err
+	}
+	sig, err := bls.SignatureFromBytes(vote.Signature)
+	if err != nil {
+		return err
+	}
+	signHash := types.VoteSigHash(&types.VoteForSign{
+		ProposedBlockInfo: vote.ProposedBlockInfo,
+		GapNumber:         vote.GapNumber,
+	})
+	if !bls.Verify(publicKey, signHash.Bytes(), sig) {
+		return fmt.Errorf("vote of round %d is not signed by %v", vote.ProposedBlockInfo.Round, vote.BLSSigner.Hex())
+	}
+	return nil
+}
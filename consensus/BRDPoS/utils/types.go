@@ -6,6 +6,7 @@ import (
 
 	"BRDPoSChain/BRCx/tradingstate"
 	"BRDPoSChain/BRCxlending/lendingstate"
+	"BRDPoSChain/accounts"
 	"BRDPoSChain/common"
 	"BRDPoSChain/common/lru"
 	"BRDPoSChain/common/prque"
@@ -16,8 +17,21 @@ import (
 )
 
 type Masternode struct {
-	Address common.Address
-	Stake   *big.Int
+	Address      common.Address
+	Stake        *big.Int
+	BLSPublicKey []byte // registered BLS public key, only gathered after TIPBLS
+}
+
+// ConsensusSigner signs the consensus messages of a masternode. Unlike a clique.SignerFn, which only gets
+// the hash to sign, it's handed the messages themselves, so a signer holding the key outside of the node
+// can check what it signs and refuse conflicting votes. After TIPBLS, votes and timeouts are signed with
+// the BLS key the masternode registered instead.
+type ConsensusSigner interface {
+	SignHeader(account accounts.Account, header *types.Header) ([]byte, error)
+	SignVote(account accounts.Account, vote *types.VoteForSign) ([]byte, error)
+	SignTimeout(account accounts.Account, timeout *types.TimeoutForSign) ([]byte, error)
+	SignBLSVote(account accounts.Account, vote *types.VoteForSign) ([]byte, error)
+	SignBLSTimeout(account accounts.Account, timeout *types.TimeoutForSign) ([]byte, error)
 }
 
 type TradingService interface {
@@ -27,10 +41,12 @@ type TradingService interface {
 	HasTradingState(block *types.Block, author common.Address) bool
 	GetStateCache() tradingstate.Database
 	GetTriegc() *prque.Prque[int64, common.Hash]
-	ApplyOrder(header *types.Header, coinbase common.Address, chain consensus.ChainContext, statedb *state.StateDB, BRCXstatedb *tradingstate.TradingStateDB, orderBook common.Hash, order *tradingstate.OrderItem) ([]map[string]string, []*tradingstate.OrderItem, error)
+	ApplyOrder(header *types.Header, coinbase common.Address, chain consensus.ChainContext, statedb *state.StateDB, BRCXstatedb *tradingstate.TradingStateDB, orderBook common.Hash, order *tradingstate.OrderItem) ([]*tradingstate.TradeRecord, []*tradingstate.OrderItem, error)
 	UpdateMediumPriceBeforeEpoch(epochNumber uint64, tradingStateDB *tradingstate.TradingStateDB, statedb *state.StateDB) error
 	IsSDKNode() bool
-	SyncDataToSDKNode(takerOrder *tradingstate.OrderItem, txHash common.Hash, txMatchTime time.Time, statedb *state.StateDB, trades []map[string]string, rejectedOrders []*tradingstate.OrderItem, dirtyOrderCount *uint64) error
+	SyncDataToSDKNode(takerOrder *tradingstate.OrderItem, txHash common.Hash, txMatchTime time.Time, statedb *state.StateDB, trades []*tradingstate.TradeRecord, rejectedOrders []*tradingstate.OrderItem, dirtyOrderCount *uint64) error
+	IndexTrades(txHash common.Hash, txMatchTime time.Time, trades []*tradingstate.TradeRecord) error
+	PublishMatchingResult(tradingStateDB *tradingstate.TradingStateDB, order *tradingstate.OrderItem, trades []*tradingstate.TradeRecord, rejects []*tradingstate.OrderItem)
 	RollbackReorgTxMatch(txhash common.Hash) error
 	GetTokenDecimal(chain consensus.ChainContext, statedb *state.StateDB, tokenAddr common.Address) (*big.Int, error)
 }
@@ -44,7 +60,7 @@ type LendingService interface {
 	ApplyOrder(header *types.Header, coinbase common.Address, chain consensus.ChainContext, statedb *state.StateDB, lendingStateDB *lendingstate.LendingStateDB, tradingStateDb *tradingstate.TradingStateDB, lendingOrderBook common.Hash, order *lendingstate.LendingItem) ([]*lendingstate.LendingTrade, []*lendingstate.LendingItem, error)
 	GetCollateralPrices(header *types.Header, chain consensus.ChainContext, statedb *state.StateDB, tradingStateDb *tradingstate.TradingStateDB, collateralToken common.Address, lendingToken common.Address) (*big.Int, *big.Int, error)
 	GetMediumTradePriceBeforeEpoch(chain consensus.ChainContext, statedb *state.StateDB, tradingStateDb *tradingstate.TradingStateDB, baseToken common.Address, quoteToken common.Address) (*big.Int, error)
-	ProcessLiquidationData(header *types.Header, chain consensus.ChainContext, statedb *state.StateDB, tradingState *tradingstate.TradingStateDB, lendingState *lendingstate.LendingStateDB) (updatedTrades map[common.Hash]*lendingstate.LendingTrade, liquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades []*lendingstate.LendingTrade, err error)
+	ProcessLiquidationData(header *types.Header, chain consensus.ChainContext, statedb *state.StateDB, tradingState *tradingstate.TradingStateDB, lendingState *lendingstate.LendingStateDB) (updatedTrades map[common.Hash]*lendingstate.LendingTrade, liquidatedTrades, partiallyLiquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades []*lendingstate.LendingTrade, err error)
 	SyncDataToSDKNode(chain consensus.ChainContext, state *state.StateDB, block *types.Block, takerOrderInTx *lendingstate.LendingItem, txHash common.Hash, txMatchTime time.Time, trades []*lendingstate.LendingTrade, rejectedOrders []*lendingstate.LendingItem, dirtyOrderCount *uint64) error
 	UpdateLiquidatedTrade(blockTime uint64, result lendingstate.FinalizedResult, trades map[common.Hash]*lendingstate.LendingTrade) error
 	RollbackLendingData(txhash common.Hash) error
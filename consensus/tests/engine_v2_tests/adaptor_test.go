@@ -265,3 +265,25 @@ func TestGetParentBlock(t *testing.T) {
 
 	assert.Equal(t, block900.Hash(), block.Hash())
 }
+
+func TestGetMasternodesOfRound(t *testing.T) {
+	blockchain, _, currentBlock, _, _ := PrepareBRCTestBlockChainWithPenaltyForV2Engine(t, 1802, params.TestBRDPoSMockChainConfig)
+	adaptor := blockchain.Engine().(*BRDPoS.BRDPoS)
+	checkpointHeader := blockchain.GetHeaderByNumber(blockchain.Config().BRDPoS.V2.SwitchBlock.Uint64() + 1)
+	err := adaptor.Initial(blockchain, checkpointHeader)
+	assert.Nil(t, err)
+
+	// block 1802 of round 902 is in the epoch from block 1800, the previous epoch is from block 901
+	header := currentBlock.Header()
+	masternodes, err := adaptor.EngineV2.GetMasternodesOfRound(blockchain, header, types.Round(905), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, adaptor.GetMasternodes(blockchain, header), masternodes)
+	masternodes, err = adaptor.EngineV2.GetMasternodesOfRound(blockchain, header, types.Round(5), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, adaptor.GetMasternodesByNumber(blockchain, 1799), masternodes)
+
+	_, err = adaptor.EngineV2.GetMasternodesOfRound(blockchain, header, types.Round(5), 0)
+	assert.NotNil(t, err)
+	_, err = adaptor.EngineV2.GetMasternodesOfRound(blockchain, header, types.Round(1805), 1)
+	assert.NotNil(t, err)
+}
@@ -10,7 +10,9 @@ import (
 
 	"BRDPoSChain/accounts"
 	"BRDPoSChain/accounts/abi/bind/backends"
+	"BRDPoSChain/common"
 	"BRDPoSChain/consensus/BRDPoS"
+	"BRDPoSChain/consensus/BRDPoS/engines/engine_v2"
 	"BRDPoSChain/consensus/BRDPoS/utils"
 	"BRDPoSChain/core/types"
 	"BRDPoSChain/params"
@@ -460,3 +462,33 @@ func TestVoteEquivocationDifferentRound(t *testing.T) {
 		}
 	}
 }
+
+func TestVerifyVoteForensicProofOfUnknownFork(t *testing.T) {
+	blockchain, _, currentBlock, signer, signFn, _ := PrepareBRCTestBlockChainForV2Engine(t, 905, params.TestBRDPoSMockChainConfig, nil)
+	engineV2 := blockchain.Engine().(*BRDPoS.BRDPoS).EngineV2
+
+	var extraField types.ExtraFields_v2
+	err := utils.DecodeBytesExtraFields(currentBlock.Extra(), &extraField)
+	assert.Nil(t, err)
+	vote := func(hash common.Hash, gapNumber uint64) *types.Vote {
+		blockInfo := &types.BlockInfo{Hash: hash, Round: extraField.Round, Number: currentBlock.Number()}
+		signature, err := signFn(accounts.Account{Address: signer}, types.VoteSigHash(&types.VoteForSign{ProposedBlockInfo: blockInfo, GapNumber: gapNumber}).Bytes())
+		assert.Nil(t, err)
+		return &types.Vote{ProposedBlockInfo: blockInfo, Signature: signature, GapNumber: gapNumber}
+	}
+	proof := func(forkVote *types.Vote) *types.ForensicProof {
+		content, err := json.Marshal(&types.VoteEquivocationContent{
+			SmallerRoundVote: vote(currentBlock.Hash(), 450),
+			LargerRoundVote:  forkVote,
+			Signer:           signer,
+		})
+		assert.Nil(t, err)
+		return &types.ForensicProof{ForensicsType: "Vote", Content: string(content)}
+	}
+
+	// the fork block was never imported, its epoch is resolved from the vote round
+	forkHash := common.StringToHash("fork")
+	assert.Nil(t, blockchain.GetHeaderByHash(forkHash))
+	assert.Nil(t, engineV2.VerifyForensicProof(blockchain, proof(vote(forkHash, 450))))
+	assert.Equal(t, engine_v2.ErrForensicVoteGapNumber, engineV2.VerifyForensicProof(blockchain, proof(vote(forkHash, 0))))
+}
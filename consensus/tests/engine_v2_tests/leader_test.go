@@ -0,0 +1,137 @@
+package engine_v2_tests
+
+import (
+	"math/big"
+	"testing"
+
+	"BRDPoSChain/accounts"
+	"BRDPoSChain/common"
+	"BRDPoSChain/consensus"
+	"BRDPoSChain/consensus/BRDPoS"
+	"BRDPoSChain/consensus/BRDPoS/utils"
+	"BRDPoSChain/core"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/params"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// leaderChainConfig returns the mock chain config with leaders of timed out rounds skipped within the
+// given window of blocks, and the leader rotation weighted by stake if asked to.
+func leaderChainConfig(window int, weighted bool) *params.ChainConfig {
+	v2Config := *params.UnitTestV2Configs[0]
+	v2Config.OfflineLeaderWindow = window
+	v2Config.StakeWeightedLeader = weighted
+
+	config := *params.TestBRDPoSMockChainConfig
+	brdpos := *config.BRDPoS
+	brdpos.V2 = &params.V2{
+		SwitchEpoch:   config.BRDPoS.V2.SwitchEpoch,
+		SwitchBlock:   config.BRDPoS.V2.SwitchBlock,
+		CurrentConfig: &v2Config,
+		AllConfigs:    map[uint64]*params.V2Config{params.Default: &v2Config},
+	}
+	config.BRDPoS = &brdpos
+	return &config
+}
+
+// proposeBlock creates the block of the round on top of parent, sealed by the proposer.
+func proposeBlock(bc *core.BlockChain, config *params.ChainConfig, parent *types.Block, round int64, proposer common.Address, proposerFn func(account accounts.Account, hash []byte) ([]byte, error), signer common.Address, signFn func(account accounts.Account, hash []byte) ([]byte, error)) *types.Block {
+	block := CreateBlock(bc, config, parent, int(parent.NumberU64())+1, round, proposer.Hex(), signer, signFn, nil, nil, "")
+	header := block.Header()
+	header.Coinbase = proposer
+	sealHeader(bc, header, proposer, proposerFn)
+	return types.NewBlockWithHeader(header)
+}
+
+func TestOfflineLeadersAreSkipped(t *testing.T) {
+	config := leaderChainConfig(10, false)
+	blockchain, _, currentBlock, signer, signFn, _ := PrepareBRCTestBlockChainForV2Engine(t, 905, config, nil)
+	adaptor := blockchain.Engine().(*BRDPoS.BRDPoS)
+
+	acc1, acc1Fn, err := getSignerAndSignFn(acc1Key)
+	assert.Nil(t, err)
+	acc2, acc2Fn, err := getSignerAndSignFn(acc2Key)
+	assert.Nil(t, err)
+
+	// The rotation is acc1, acc2, acc3, voter, signer. Rounds 6 to 9, owned by acc2, acc3, voter and
+	// signer, time out before acc1 proposes round 10.
+	block := proposeBlock(blockchain, config, currentBlock, 10, acc1, acc1Fn, signer, signFn)
+	assert.Nil(t, adaptor.VerifyHeader(blockchain, block.Header(), true))
+	assert.Nil(t, blockchain.InsertBlock(block))
+	currentBlock = block
+
+	// Round 11 belongs to acc2, which missed its last turn, so it passes over the offline masternodes
+	// back to acc1
+	block = proposeBlock(blockchain, config, currentBlock, 11, acc2, acc2Fn, signer, signFn)
+	assert.Equal(t, utils.ErrNotItsTurn, adaptor.VerifyHeader(blockchain, block.Header(), true))
+	block = proposeBlock(blockchain, config, currentBlock, 11, acc1, acc1Fn, signer, signFn)
+	assert.Nil(t, adaptor.VerifyHeader(blockchain, block.Header(), true))
+	assert.Nil(t, blockchain.InsertBlock(block))
+	currentBlock = block
+
+	// Round 12 is acc1's by substitution and times out as well, round 13 is acc1's again
+	block = proposeBlock(blockchain, config, currentBlock, 13, acc1, acc1Fn, signer, signFn)
+	assert.Nil(t, adaptor.VerifyHeader(blockchain, block.Header(), true))
+	assert.Nil(t, blockchain.InsertBlock(block))
+	currentBlock = block
+
+	// The timed out rounds are reported on the leaders which actually missed them
+	missed, err := adaptor.CalculateMissingRounds(blockchain, currentBlock.Header())
+	assert.Nil(t, err)
+	want := map[types.Round]common.Address{6: acc2, 7: acc3Addr, 8: voterAddr, 9: signer, 12: acc1}
+	assert.Equal(t, len(want), len(missed.MissedRounds))
+	for _, info := range missed.MissedRounds {
+		assert.Equal(t, want[info.Round], info.Miner, "round %d", info.Round)
+	}
+
+	// The skipping only blames the leaders of the rotation, round 12 counts against acc3 rather than its
+	// substitute, so acc1 takes over the turn of signer in round 14 as well. A node restarting with no
+	// offline leaders cached picks the same leader.
+	adaptor.EngineV2.PurgeOfflineLeadersFaker()
+	block = proposeBlock(blockchain, config, currentBlock, 14, signer, signFn, signer, signFn)
+	assert.Equal(t, utils.ErrNotItsTurn, adaptor.VerifyHeader(blockchain, block.Header(), true))
+	block = proposeBlock(blockchain, config, currentBlock, 14, acc1, acc1Fn, signer, signFn)
+	assert.Nil(t, adaptor.VerifyHeader(blockchain, block.Header(), true))
+	assert.Nil(t, blockchain.InsertBlock(block))
+}
+
+func TestStakeWeightedLeaderWithSnapshotWithoutStakes(t *testing.T) {
+	config := leaderChainConfig(0, true)
+	blockchain, _, currentBlock, signer, signFn, _ := PrepareBRCTestBlockChainForV2Engine(t, 905, config, nil)
+	adaptor := blockchain.Engine().(*BRDPoS.BRDPoS)
+
+	acc1, acc1Fn, err := getSignerAndSignFn(acc1Key)
+	assert.Nil(t, err)
+	acc2, acc2Fn, err := getSignerAndSignFn(acc2Key)
+	assert.Nil(t, err)
+
+	// The snapshot of the first v2 epoch is taken at a v1 gap block, without the stakes
+	snap, err := adaptor.EngineV2.GetSnapshot(blockchain, currentBlock.Header())
+	assert.Nil(t, err)
+	assert.Empty(t, snap.Stakes)
+
+	// Without a way to gather the stakes the rotation is unknown
+	block := proposeBlock(blockchain, config, currentBlock, 6, acc2, acc2Fn, signer, signFn)
+	assert.Equal(t, utils.ErrMissingStake, adaptor.VerifyHeader(blockchain, block.Header(), true))
+
+	// The stakes are gathered from the state of the gap block once. With the same stake for every
+	// masternode, round 6 is acc2's turn.
+	var gathered []uint64
+	adaptor.EngineV2.HookStakes = func(chain consensus.ChainReader, header *types.Header, candidates []common.Address) (map[common.Address]*big.Int, error) {
+		gathered = append(gathered, header.Number.Uint64())
+		stakes := make(map[common.Address]*big.Int)
+		for _, candidate := range candidates {
+			stakes[candidate] = big.NewInt(1)
+		}
+		return stakes, nil
+	}
+	wrong := proposeBlock(blockchain, config, currentBlock, 6, acc1, acc1Fn, signer, signFn)
+	assert.Equal(t, utils.ErrNotItsTurn, adaptor.VerifyHeader(blockchain, wrong.Header(), true))
+	assert.Nil(t, adaptor.VerifyHeader(blockchain, block.Header(), true))
+	assert.Equal(t, []uint64{450}, gathered)
+
+	snap, err = adaptor.EngineV2.GetSnapshot(blockchain, currentBlock.Header())
+	assert.Nil(t, err)
+	assert.Equal(t, len(snap.NextEpochCandidates), len(snap.Stakes))
+}
@@ -0,0 +1,210 @@
+package simulator
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"time"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/crypto"
+	"BRDPoSChain/rlp"
+)
+
+// Partition splits the nodes into groups which can't reach each other between From and Until.
+type Partition struct {
+	From   time.Duration
+	Until  time.Duration
+	Groups [][]int
+}
+
+// Crash stops a node from handling any message or timer between At and Until, a zero Until means it never recovers.
+type Crash struct {
+	Node  int
+	At    time.Duration
+	Until time.Duration
+}
+
+type msgKind uint8
+
+const (
+	kindBlock msgKind = iota
+	kindVote
+	kindTimeout
+	kindSyncInfo
+)
+
+func (k msgKind) String() string {
+	switch k {
+	case kindBlock:
+		return "block"
+	case kindVote:
+		return "vote"
+	case kindTimeout:
+		return "timeout"
+	case kindSyncInfo:
+		return "syncInfo"
+	}
+	return "unknown"
+}
+
+// msgID identifies a message for the gossip deduplication.
+type msgID struct {
+	kind msgKind
+	hash common.Hash
+}
+
+// message is a consensus message or a block in flight. The consensus messages are carried RLP encoded so every
+// receiver decodes its own copy, as it would from a real peer.
+type message struct {
+	id    msgID
+	block *types.Block
+	data  []byte
+
+	// Content identifying the message from one run to another. The hashes can't, as the engine puts the
+	// signatures of a certificate in random order, which changes the hash of the blocks and messages carrying it.
+	tag []byte
+}
+
+func (m *message) decode() (interface{}, error) {
+	switch m.id.kind {
+	case kindVote:
+		vote := new(types.Vote)
+		return vote, rlp.DecodeBytes(m.data, vote)
+	case kindTimeout:
+		timeout := new(types.Timeout)
+		return timeout, rlp.DecodeBytes(m.data, timeout)
+	case kindSyncInfo:
+		syncInfo := new(types.SyncInfo)
+		return syncInfo, rlp.DecodeBytes(m.data, syncInfo)
+	}
+	return m.block, nil
+}
+
+type eventKind uint8
+
+const (
+	eventDeliver eventKind = iota
+	eventTimeout
+	eventPropose
+	eventRecover
+)
+
+// event is something happening on a node at a point of the virtual time.
+type event struct {
+	at   time.Duration
+	seq  uint64 // Insertion order, breaks the ties of events happening at the same time
+	kind eventKind
+	node int
+
+	from  int      // Sender of a delivered message
+	msg   *message // Delivered message
+	round types.Round
+}
+
+// eventQueue is a priority queue of events ordered by virtual time.
+type eventQueue []*event
+
+func (q eventQueue) Len() int { return len(q) }
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].at != q[j].at {
+		return q[i].at < q[j].at
+	}
+	return q[i].seq < q[j].seq
+}
+func (q eventQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *eventQueue) Push(x interface{}) { *q = append(*q, x.(*event)) }
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	ev := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return ev
+}
+
+// network decides the fate of every message sent between the nodes. The fate is derived from the seed and the
+// message itself rather than from the order of the sends, so a run is reproducible from its seed.
+type network struct {
+	seed       int64
+	minLatency time.Duration
+	maxLatency time.Duration
+	dropRate   float64
+	partitions []Partition
+	crashes    []Crash
+
+	now    time.Duration
+	seq    uint64
+	events eventQueue
+}
+
+func (n *network) schedule(ev *event) {
+	n.seq++
+	ev.seq = n.seq
+	heap.Push(&n.events, ev)
+}
+
+func (n *network) next() *event {
+	if len(n.events) == 0 {
+		return nil
+	}
+	ev := heap.Pop(&n.events).(*event)
+	n.now = ev.at
+	return ev
+}
+
+// send schedules the delivery of the message, it returns false if the message is lost. The nonce distinguishes
+// the retries of the same message between the same nodes.
+func (n *network) send(from, to int, msg *message, nonce uint64) bool {
+	if n.crashed(from, n.now) || n.partitioned(from, to, n.now) {
+		return false
+	}
+	var buf [8 + 8 + 8 + 8 + 1]byte
+	binary.BigEndian.PutUint64(buf[0:], uint64(n.seed))
+	binary.BigEndian.PutUint64(buf[8:], uint64(from))
+	binary.BigEndian.PutUint64(buf[16:], uint64(to))
+	binary.BigEndian.PutUint64(buf[24:], nonce)
+	buf[32] = byte(msg.id.kind)
+	fate := crypto.Keccak256(buf[:], msg.tag)
+
+	if float64(binary.BigEndian.Uint64(fate[0:8]))/(1<<64) < n.dropRate {
+		return false
+	}
+	latency := n.minLatency
+	if spread := n.maxLatency - n.minLatency; spread > 0 {
+		latency += time.Duration(binary.BigEndian.Uint64(fate[8:16]) % uint64(spread))
+	}
+	n.schedule(&event{at: n.now + latency, kind: eventDeliver, node: to, from: from, msg: msg})
+	return true
+}
+
+func (n *network) crashed(node int, at time.Duration) bool {
+	for _, c := range n.crashes {
+		if c.Node == node && at >= c.At && (c.Until == 0 || at < c.Until) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *network) partitioned(a, b int, at time.Duration) bool {
+	for _, p := range n.partitions {
+		if at < p.From || at >= p.Until {
+			continue
+		}
+		if groupOf(p.Groups, a) != groupOf(p.Groups, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// groupOf returns the group of the node in the partition, the nodes not listed are isolated on their own.
+func groupOf(groups [][]int, node int) int {
+	for i, group := range groups {
+		for _, n := range group {
+			if n == node {
+				return i
+			}
+		}
+	}
+	return -1 - node
+}
@@ -0,0 +1,270 @@
+package simulator
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"time"
+
+	"BRDPoSChain/BRCx"
+	"BRDPoSChain/BRCxlending"
+	"BRDPoSChain/accounts"
+	"BRDPoSChain/common"
+	"BRDPoSChain/consensus"
+	"BRDPoSChain/consensus/BRDPoS"
+	"BRDPoSChain/consensus/BRDPoS/utils"
+	"BRDPoSChain/core"
+	"BRDPoSChain/core/rawdb"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/core/vm"
+	"BRDPoSChain/crypto"
+	"BRDPoSChain/eth/bft"
+	"BRDPoSChain/ethdb"
+	"BRDPoSChain/log"
+	"BRDPoSChain/params"
+	"BRDPoSChain/rlp"
+)
+
+// node is a masternode running the full v2 engine, fed by the simulator instead of the p2p layer.
+type node struct {
+	index       int
+	key         *ecdsa.PrivateKey
+	addr        common.Address
+	equivocator bool
+
+	db     ethdb.Database
+	chain  *core.BlockChain
+	engine *BRDPoS.BRDPoS
+	bfter  *bft.Bfter
+
+	outbox []*message // Blocks and forged votes sent by the node, not yet on the network
+
+	known   map[msgID]bool                 // Messages the node sent, received or has in flight to it
+	orphans map[common.Hash][]*types.Block // Blocks waiting for their parent, keyed by the parent hash
+
+	round           types.Round   // Last round seen by the simulator
+	timeoutAt       time.Duration // Virtual time the round times out at
+	proposedRound   types.Round   // Last round the node proposed a block in
+	committedNumber uint64
+	committedHash   common.Hash
+}
+
+func newNode(index int, key *ecdsa.PrivateKey, genesis *core.Genesis, offlineLeaderWindow int) (*node, error) {
+	n := &node{
+		index:   index,
+		key:     key,
+		addr:    crypto.PubkeyToAddress(key.PublicKey),
+		db:      rawdb.NewMemoryDatabase(),
+		known:   make(map[msgID]bool),
+		orphans: make(map[common.Hash][]*types.Block),
+	}
+	// Every node gets its own chain config, as the engine updates the current v2 config in place
+	config := newChainConfig(offlineLeaderWindow)
+	genesisBlock := (&core.Genesis{
+		Config:     config,
+		Timestamp:  genesis.Timestamp,
+		ExtraData:  genesis.ExtraData,
+		GasLimit:   genesis.GasLimit,
+		Difficulty: genesis.Difficulty,
+		Alloc:      genesis.Alloc,
+	}).MustCommit(n.db)
+
+	n.engine = BRDPoS.NewFaker(n.db, config)
+	// The engine and the bft handler pass their messages into the buffer, where the simulator picks them up once
+	// the engine is done with the event, instead of a bft loop relaying them in the background
+	n.engine.EngineV2.BroadcastCh = make(chan interface{}, broadcastBuffer)
+	BRCXServ := BRCx.New(&BRCx.Config{DataDir: ""})
+	lendingServ := BRCxlending.New(BRCXServ)
+	n.engine.GetBRCXService = func() utils.TradingService {
+		return BRCXServ
+	}
+	n.engine.GetLendingService = func() utils.LendingService {
+		return lendingServ
+	}
+	chain, err := core.NewBlockChain(n.db, nil, config, n.engine, vm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	n.chain = chain
+
+	n.engine.Authorize(n.addr, func(account accounts.Account, hash []byte) ([]byte, error) {
+		return crypto.Sign(hash, key)
+	})
+	if err := n.engine.EngineV2.Initial(chain, genesisBlock.Header()); err != nil {
+		return nil, err
+	}
+
+	n.bfter = bft.New(bft.BroadcastFns{}, chain, func() uint64 {
+		return chain.CurrentBlock().NumberU64()
+	})
+	n.bfter.InitEpochNumber()
+	n.bfter.SetConsensusFuns(n.engine)
+	return n, nil
+}
+
+func (n *node) String() string {
+	return fmt.Sprintf("node%d", n.index)
+}
+
+// push queues a consensus message for the network.
+func (n *node) push(kind msgKind, hash common.Hash, msg interface{}) {
+	data, err := rlp.EncodeToBytes(msg)
+	if err != nil {
+		log.Error("[simulator] Fail to encode message", "node", n, "kind", kind, "err", err)
+		return
+	}
+	n.outbox = append(n.outbox, &message{id: msgID{kind, hash}, data: data})
+}
+
+func (n *node) pushBlock(block *types.Block) {
+	n.outbox = append(n.outbox, &message{id: msgID{kindBlock, block.Hash()}, block: block})
+}
+
+// drain takes the messages out of the outbox and the broadcast channel of the engine. The engine hands its
+// messages over before returning from the call which produced them, so the channel holds all of them.
+func (n *node) drain() []*message {
+	for {
+		select {
+		case obj := <-n.engine.EngineV2.BroadcastCh:
+			switch obj := obj.(type) {
+			case *types.Vote:
+				n.push(kindVote, obj.Hash(), obj)
+			case *types.Timeout:
+				n.push(kindTimeout, obj.Hash(), obj)
+			case *types.SyncInfo:
+				n.push(kindSyncInfo, obj.Hash(), obj)
+			default:
+				log.Error("[simulator] Unknown message type broadcast", "node", n, "type", fmt.Sprintf("%T", obj))
+			}
+		default:
+			msgs := n.outbox
+			n.outbox = nil
+			return msgs
+		}
+	}
+}
+
+func (n *node) currentRound() types.Round {
+	return n.engine.EngineV2.GetCurrentRoundFaker()
+}
+
+// mine builds and seals a block on top of the highest QC at the given virtual time, as the miner does when it's
+// the node's turn. It returns nil if the node isn't the leader of the current round.
+func (n *node) mine(genesisTime uint64, now time.Duration) (*types.Block, error) {
+	parent := n.engine.EngineV2.FindParentBlockToAssign(n.chain)
+	if parent == nil {
+		return nil, nil
+	}
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   parent.GasLimit(),
+		Coinbase:   n.addr,
+	}
+	if err := n.engine.Prepare(n.chain, header); err != nil {
+		if err == consensus.ErrNotReadyToMine || err == consensus.ErrNotReadyToPropose {
+			return nil, nil
+		}
+		return nil, err
+	}
+	// Prepare stamps the wall clock, the simulated chain runs on the virtual one
+	header.Time = new(big.Int).SetUint64(genesisTime + uint64(now/time.Second))
+
+	statedb, err := n.chain.StateAt(parent.Root())
+	if err != nil {
+		return nil, err
+	}
+	block, err := n.engine.Finalize(n.chain, header, statedb, statedb.Copy(), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return n.engine.Seal(n.chain, block, nil)
+}
+
+// forge re-seals the block with a different nonce, giving a conflicting block for the same round.
+func (n *node) forge(block *types.Block) (*types.Block, error) {
+	header := block.Header()
+	copy(header.Nonce[:], utils.NonceAuthVote)
+	return n.engine.Seal(n.chain, types.NewBlockWithHeader(header), nil)
+}
+
+// signVote signs a vote for the block bypassing the voting rules of the engine.
+func (n *node) signVote(block *types.Block) (*types.Vote, error) {
+	var extra types.ExtraFields_v2
+	if err := utils.DecodeBytesExtraFields(block.Extra(), &extra); err != nil {
+		return nil, err
+	}
+	// The block isn't an epoch switch, it shares the gap number of its parent
+	voteForSign := &types.VoteForSign{
+		ProposedBlockInfo: &types.BlockInfo{Hash: block.Hash(), Round: extra.Round, Number: block.Number()},
+		GapNumber:         extra.QuorumCert.GapNumber,
+	}
+	signature, err := crypto.Sign(types.VoteSigHash(voteForSign).Bytes(), n.key)
+	if err != nil {
+		return nil, err
+	}
+	return &types.Vote{
+		ProposedBlockInfo: voteForSign.ProposedBlockInfo,
+		Signature:         signature,
+		GapNumber:         voteForSign.GapNumber,
+	}, nil
+}
+
+// importBlock verifies and inserts a block whose parent is known, then hands it to the engine, as the fetcher does.
+func (n *node) importBlock(block *types.Block) error {
+	if err := n.engine.VerifyHeader(n.chain, block.Header(), true); err != nil {
+		return err
+	}
+	n.pushBlock(block)
+	if err := n.chain.InsertBlock(block); err != nil {
+		return err
+	}
+	if err := n.engine.HandleProposedBlock(n.chain, block.Header()); err != nil {
+		log.Debug("[simulator] Fail to handle proposed block", "node", n, "number", block.Number(), "hash", block.Hash(), "err", err)
+	}
+	return nil
+}
+
+func (n *node) stop() {
+	n.bfter.Stop()
+	n.chain.Stop()
+}
+
+// newChainConfig returns a chain running the v2 engine from the genesis block, skipping the leaders of timed out
+// rounds within the window of blocks if any. The engine timeout is long enough to never fire during a test, the
+// simulator drives the round timeouts on the virtual clock instead.
+func newChainConfig(offlineLeaderWindow int) *params.ChainConfig {
+	v2Config := &params.V2Config{
+		MaxMasternodes:       18,
+		SwitchRound:          0,
+		CertThreshold:        0.667,
+		TimeoutSyncThreshold: 2,
+		TimeoutPeriod:        3600,
+		MinePeriod:           2,
+		ExpTimeoutConfig:     params.ExpTimeoutConfig{Base: 1.0, MaxExponent: 0},
+		OfflineLeaderWindow:  offlineLeaderWindow,
+	}
+	return &params.ChainConfig{
+		ChainId:             big.NewInt(1337),
+		HomesteadBlock:      big.NewInt(0),
+		EIP150Block:         big.NewInt(0),
+		EIP155Block:         big.NewInt(0),
+		EIP158Block:         big.NewInt(0),
+		ByzantiumBlock:      big.NewInt(0),
+		ConstantinopleBlock: big.NewInt(0),
+		Ethash:              new(params.EthashConfig),
+		BRDPoS: &params.BRDPoSConfig{
+			Epoch:               900,
+			Gap:                 450,
+			SkipV1Validation:    true,
+			FoudationWalletAddr: common.HexToAddress("0x0000000000000000000000000000000000000068"),
+			Reward:              250,
+			V2: &params.V2{
+				SwitchEpoch:   0,
+				SwitchBlock:   big.NewInt(0),
+				CurrentConfig: v2Config,
+				AllConfigs:    map[uint64]*params.V2Config{params.Default: v2Config},
+			},
+		},
+	}
+}
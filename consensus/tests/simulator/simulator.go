@@ -0,0 +1,568 @@
+// Package simulator runs a network of masternodes with the full v2 consensus engine in a single process. The
+// nodes talk over a virtual network with a virtual clock, which delays, drops and partitions the messages as
+// configured, while the simulator checks the safety of the committed blocks and the forensics of the equivocations.
+package simulator
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/consensus/BRDPoS/utils"
+	"BRDPoSChain/core"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/crypto"
+	"BRDPoSChain/log"
+	"BRDPoSChain/params"
+)
+
+const (
+	genesisTime = 1700000000 // Timestamp of the genesis block, the virtual clock starts at it
+
+	maxVoteDist = 7 // Maximum distance of a vote from the chain head accepted by the bft handler
+
+	broadcastBuffer = 1024 // Messages a node can pass to its broadcast channel while handling a single event
+)
+
+var drainCheckpoints sync.Once
+
+// Config is the setup of a simulated network.
+type Config struct {
+	Nodes    int           // Number of masternodes
+	Seed     int64         // Seed deciding the fate of the messages
+	Duration time.Duration // Virtual duration of the run
+
+	MinLatency time.Duration // Minimum delay of a message
+	MaxLatency time.Duration // Maximum delay of a message
+	DropRate   float64       // Probability of a message to be lost
+
+	TimeoutPeriod time.Duration // Virtual duration of a round before the nodes time out, 4 seconds if zero
+
+	OfflineLeaderWindow int // Window of blocks the leaders of timed out rounds are skipped in, disabled if zero
+
+	Partitions   []Partition
+	Crashes      []Crash
+	Equivocators []int // Nodes proposing conflicting blocks and voting for both when they lead a round
+}
+
+// Result sums up a run.
+type Result struct {
+	Committed     uint64      // Highest block committed by an honest node
+	Rounds        types.Round // Highest round reached by a node
+	Blocks        int         // Number of blocks proposed
+	Timeouts      int         // Number of round timeouts of the nodes
+	Delivered     int         // Number of messages delivered
+	Dropped       int         // Number of messages lost
+	Equivocations int         // Number of rounds an equivocator proposed conflicting blocks in
+	Proven        int         // Number of those equivocations proven by the forensics of at least one honest node
+	Proofs        int         // Number of equivocations observed by an honest node and proven by its forensics
+	Violations    []string    // Broken invariants
+}
+
+// voteKey identifies the votes of a masternode in a round.
+type voteKey struct {
+	signer common.Address
+	round  types.Round
+}
+
+// Simulator drives the nodes over the virtual network.
+type Simulator struct {
+	config Config
+	nodes  []*node
+	net    *network
+	nonce  uint64
+
+	tags    map[msgID][]byte
+	headers map[common.Hash]*types.Header // Blocks proposed by any node
+
+	committed     map[uint64]common.Hash             // Blocks committed by any honest node, by number
+	observed      []map[voteKey]map[common.Hash]bool // Votes qualified for the vote pool of each node
+	equivocations []voteKey                          // Conflicting votes cast by the equivocators
+	result        Result
+}
+
+// New creates the nodes of the network, all of them masternodes from the genesis block.
+func New(config Config) (*Simulator, error) {
+	if config.Nodes < 1 {
+		return nil, fmt.Errorf("invalid number of nodes: %d", config.Nodes)
+	}
+	if config.MaxLatency < config.MinLatency {
+		return nil, fmt.Errorf("max latency %v below min latency %v", config.MaxLatency, config.MinLatency)
+	}
+	if config.TimeoutPeriod == 0 {
+		config.TimeoutPeriod = 4 * time.Second
+	}
+	// The epoch switch blocks are announced on a global channel nobody listens to in tests
+	drainCheckpoints.Do(func() {
+		go func() {
+			for range core.CheckpointCh {
+			}
+		}()
+	})
+
+	keys := make([]*ecdsa.PrivateKey, config.Nodes)
+	extra := make([]byte, utils.ExtraVanity)
+	for i := range keys {
+		key, err := crypto.ToECDSA(crypto.Keccak256([]byte(fmt.Sprintf("simulator masternode %d", i))))
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+		extra = append(extra, crypto.PubkeyToAddress(key.PublicKey).Bytes()...)
+	}
+	extra = append(extra, make([]byte, utils.ExtraSeal)...)
+	genesis := &core.Genesis{
+		Timestamp:  genesisTime,
+		ExtraData:  extra,
+		GasLimit:   params.GenesisGasLimit,
+		Difficulty: big.NewInt(1),
+		Alloc:      types.GenesisAlloc{},
+	}
+
+	s := &Simulator{
+		config: config,
+		net: &network{
+			seed:       config.Seed,
+			minLatency: config.MinLatency,
+			maxLatency: config.MaxLatency,
+			dropRate:   config.DropRate,
+			partitions: config.Partitions,
+			crashes:    config.Crashes,
+		},
+		tags:      make(map[msgID][]byte),
+		headers:   make(map[common.Hash]*types.Header),
+		committed: make(map[uint64]common.Hash),
+		observed:  make([]map[voteKey]map[common.Hash]bool, config.Nodes),
+	}
+	for i, key := range keys {
+		n, err := newNode(i, key, genesis, config.OfflineLeaderWindow)
+		if err != nil {
+			s.Stop()
+			return nil, err
+		}
+		s.nodes = append(s.nodes, n)
+		s.observed[i] = make(map[voteKey]map[common.Hash]bool)
+	}
+	for _, i := range config.Equivocators {
+		if i < 0 || i >= len(s.nodes) {
+			s.Stop()
+			return nil, fmt.Errorf("invalid equivocator: %d", i)
+		}
+		s.nodes[i].equivocator = true
+	}
+	for _, c := range config.Crashes {
+		if c.Until != 0 {
+			s.net.schedule(&event{at: c.Until, kind: eventRecover, node: c.Node})
+		}
+	}
+	return s, nil
+}
+
+// Stop shuts the nodes down.
+func (s *Simulator) Stop() {
+	for _, n := range s.nodes {
+		n.stop()
+	}
+}
+
+// Run runs the network for the configured virtual duration and checks the invariants.
+func (s *Simulator) Run() *Result {
+	s.step()
+	for {
+		ev := s.net.next()
+		if ev == nil || ev.at > s.config.Duration {
+			break
+		}
+		n := s.nodes[ev.node]
+		if s.net.crashed(n.index, ev.at) {
+			if ev.kind == eventDeliver {
+				// the message never made it, a relay may still bring it later
+				delete(n.known, ev.msg.id)
+				s.result.Dropped++
+			}
+			continue
+		}
+		switch ev.kind {
+		case eventDeliver:
+			s.result.Delivered++
+			s.deliver(n, ev.from, ev.msg)
+		case eventTimeout:
+			if n.round != ev.round || n.timeoutAt != ev.at {
+				continue
+			}
+			s.result.Timeouts++
+			if err := n.engine.EngineV2.OnCountdownTimeout(s.clock(), n.chain); err != nil {
+				log.Debug("[simulator] Fail to time out", "node", n, "round", ev.round, "err", err)
+			}
+			s.armTimeout(n)
+		case eventPropose:
+			if n.round == ev.round && n.proposedRound < ev.round {
+				s.propose(n)
+			}
+		case eventRecover:
+			s.newRound(n)
+		}
+		s.step()
+	}
+	s.checkForensics()
+	return &s.result
+}
+
+// clock returns the virtual wall clock.
+func (s *Simulator) clock() time.Time {
+	return time.Unix(genesisTime, 0).Add(s.net.now)
+}
+
+// step sends the messages the nodes emitted while handling the last event and follows the changes of their rounds
+// and committed blocks. The nodes handle the events synchronously, so they're done with it by now.
+func (s *Simulator) step() {
+	for _, n := range s.nodes {
+		msgs := n.drain()
+		for _, msg := range msgs {
+			s.tag(msg)
+		}
+		// the engines emit concurrently, keep the sends in a stable order
+		sort.Slice(msgs, func(i, j int) bool {
+			if c := bytes.Compare(msgs[i].tag, msgs[j].tag); c != 0 {
+				return c < 0
+			}
+			return bytes.Compare(msgs[i].id.hash[:], msgs[j].id.hash[:]) < 0
+		})
+		for _, msg := range msgs {
+			s.broadcast(n, msg, s.nodes)
+		}
+	}
+	for _, n := range s.nodes {
+		if s.net.crashed(n.index, s.net.now) {
+			continue
+		}
+		if round := n.currentRound(); round != n.round {
+			n.round = round
+			s.newRound(n)
+		}
+		if n.round > s.result.Rounds {
+			s.result.Rounds = n.round
+		}
+		s.checkCommitted(n)
+	}
+}
+
+// broadcast sends the message to the peers which don't have it yet.
+func (s *Simulator) broadcast(from *node, msg *message, peers []*node) {
+	s.tag(msg)
+	from.known[msg.id] = true
+	for _, peer := range peers {
+		if peer == from || peer.known[msg.id] {
+			continue
+		}
+		if s.net.send(from.index, peer.index, msg, 0) {
+			peer.known[msg.id] = true
+		} else {
+			s.result.Dropped++
+		}
+	}
+}
+
+// newRound arms the timeout of the current round of the node and schedules its proposal, which the miner makes
+// once the mine period since the parent block is over.
+func (s *Simulator) newRound(n *node) {
+	s.armTimeout(n)
+
+	at := s.net.now
+	if parent := n.engine.EngineV2.FindParentBlockToAssign(n.chain); parent != nil {
+		minePeriod := time.Duration(n.chain.Config().BRDPoS.V2.CurrentConfig.MinePeriod) * time.Second
+		if ready := time.Duration(parent.Time().Uint64()-genesisTime)*time.Second + minePeriod; ready > at {
+			at = ready
+		}
+	}
+	s.net.schedule(&event{at: at, kind: eventPropose, node: n.index, round: n.round})
+}
+
+// armTimeout restarts the countdown of the node, replacing the pending one.
+func (s *Simulator) armTimeout(n *node) {
+	n.timeoutAt = s.net.now + s.config.TimeoutPeriod
+	s.net.schedule(&event{at: n.timeoutAt, kind: eventTimeout, node: n.index, round: n.round})
+}
+
+func (s *Simulator) propose(n *node) {
+	block, err := n.mine(genesisTime, s.net.now)
+	if err != nil {
+		log.Warn("[simulator] Fail to mine block", "node", n, "round", n.round, "err", err)
+		return
+	}
+	if block == nil {
+		return
+	}
+	n.proposedRound = n.round
+	s.headers[block.Hash()] = block.Header()
+	s.result.Blocks++
+	if err := n.chain.InsertBlock(block); err != nil {
+		log.Warn("[simulator] Fail to insert mined block", "node", n, "number", block.Number(), "err", err)
+		return
+	}
+	isEpochSwitch, _, _ := n.engine.IsEpochSwitch(block.Header())
+	if !n.equivocator || isEpochSwitch {
+		if err := n.engine.HandleProposedBlock(n.chain, block.Header()); err != nil {
+			log.Debug("[simulator] Fail to handle mined block", "node", n, "number", block.Number(), "err", err)
+		}
+		n.pushBlock(block)
+		return
+	}
+	// Equivocate: half of the peers get the block, the other half a conflicting one, and the leader votes for both
+	forged, err := n.forge(block)
+	if err != nil {
+		log.Warn("[simulator] Fail to forge block", "node", n, "number", block.Number(), "err", err)
+		return
+	}
+	vote, err := n.signVote(forged)
+	if err != nil {
+		log.Warn("[simulator] Fail to sign forged vote", "node", n, "number", block.Number(), "err", err)
+		return
+	}
+	if err := n.engine.HandleProposedBlock(n.chain, block.Header()); err != nil {
+		log.Debug("[simulator] Fail to handle mined block", "node", n, "number", block.Number(), "err", err)
+	}
+	s.headers[forged.Hash()] = forged.Header()
+	s.equivocations = append(s.equivocations, voteKey{n.addr, n.round})
+	s.result.Equivocations++
+
+	var first, second []*node
+	for _, peer := range s.nodes {
+		if peer == n {
+			continue
+		}
+		if len(first) <= len(second) {
+			first = append(first, peer)
+		} else {
+			second = append(second, peer)
+		}
+	}
+	s.broadcast(n, &message{id: msgID{kindBlock, block.Hash()}, block: block}, first)
+	s.broadcast(n, &message{id: msgID{kindBlock, forged.Hash()}, block: forged}, second)
+	n.push(kindVote, vote.Hash(), vote)
+}
+
+// tag sets the tag of the message from what it carries: the signer, round and block of a vote or a timeout, the
+// rounds of the certificates of a sync info and the number, round, proposer and nonce of a block.
+func (s *Simulator) tag(msg *message) {
+	if msg.tag != nil {
+		return
+	}
+	if tag, ok := s.tags[msg.id]; ok {
+		msg.tag = tag
+		return
+	}
+	tag := []byte{byte(msg.id.kind)}
+	obj, err := msg.decode()
+	if err != nil {
+		s.violate("can't decode %v %x: %v", msg.id.kind, msg.id.hash, err)
+		return
+	}
+	switch obj := obj.(type) {
+	case *types.Block:
+		tag = s.appendBlock(tag, obj.Hash())
+		tag = append(tag, obj.Coinbase().Bytes()...)
+	case *types.Vote:
+		signer, _ := utils.GetVoteSignerAddresses(obj)
+		tag = append(tag, signer.Bytes()...)
+		tag = s.appendBlock(tag, obj.ProposedBlockInfo.Hash)
+	case *types.Timeout:
+		hash := types.TimeoutSigHash(&types.TimeoutForSign{Round: obj.Round, GapNumber: obj.GapNumber})
+		if pubkey, err := crypto.SigToPub(hash.Bytes(), obj.Signature); err == nil {
+			tag = append(tag, crypto.PubkeyToAddress(*pubkey).Bytes()...)
+		}
+		tag = binary.BigEndian.AppendUint64(tag, uint64(obj.Round))
+	case *types.SyncInfo:
+		tag = s.appendBlock(tag, obj.HighestQuorumCert.ProposedBlockInfo.Hash)
+		tag = binary.BigEndian.AppendUint64(tag, uint64(obj.HighestTimeoutCert.Round))
+	}
+	s.tags[msg.id] = tag
+	msg.tag = tag
+}
+
+// appendBlock appends the number, round and nonce of a proposed block to the tag.
+func (s *Simulator) appendBlock(tag []byte, hash common.Hash) []byte {
+	header := s.headers[hash]
+	if header == nil {
+		// the genesis block
+		return binary.BigEndian.AppendUint64(tag, 0)
+	}
+	var extra types.ExtraFields_v2
+	utils.DecodeBytesExtraFields(header.Extra, &extra)
+	tag = binary.BigEndian.AppendUint64(tag, header.Number.Uint64())
+	tag = binary.BigEndian.AppendUint64(tag, uint64(extra.Round))
+	return append(tag, header.Nonce[:]...)
+}
+
+// deliver hands a message to the node as its protocol handler does.
+func (s *Simulator) deliver(n *node, from int, msg *message) {
+	obj, err := msg.decode()
+	if err != nil {
+		s.violate("%v can't decode %v from node%d: %v", n, msg.id.kind, from, err)
+		return
+	}
+	peer := s.nodes[from].String()
+	switch obj := obj.(type) {
+	case *types.Block:
+		s.receiveBlock(n, from, obj)
+	case *types.Vote:
+		s.observeVote(n, obj)
+		n.bfter.Vote(peer, obj)
+	case *types.Timeout:
+		n.bfter.Timeout(peer, obj)
+	case *types.SyncInfo:
+		n.bfter.SyncInfo(peer, obj)
+	}
+}
+
+// receiveBlock imports the block, or keeps it aside and fetches its parent from the sender if it's unknown yet.
+func (s *Simulator) receiveBlock(n *node, from int, block *types.Block) {
+	if n.chain.HasBlock(block.Hash(), block.NumberU64()) {
+		return
+	}
+	if n.chain.GetBlockByHash(block.ParentHash()) == nil {
+		for _, orphan := range n.orphans[block.ParentHash()] {
+			if orphan.Hash() == block.Hash() {
+				return
+			}
+		}
+		n.orphans[block.ParentHash()] = append(n.orphans[block.ParentHash()], block)
+		if parent := s.nodes[from].chain.GetBlockByHash(block.ParentHash()); parent != nil {
+			msg := &message{id: msgID{kindBlock, parent.Hash()}, block: parent}
+			s.tag(msg)
+			s.nonce++
+			if !s.net.send(from, n.index, msg, s.nonce) {
+				s.result.Dropped++
+			}
+		}
+		return
+	}
+	if err := n.importBlock(block); err != nil {
+		log.Debug("[simulator] Fail to import block", "node", n, "number", block.Number(), "hash", block.Hash(), "err", err)
+		return
+	}
+	children := n.orphans[block.Hash()]
+	delete(n.orphans, block.Hash())
+	for _, child := range children {
+		s.receiveBlock(n, from, child)
+	}
+}
+
+// observeVote records the votes qualified to enter the vote pool of an honest node, any two of them from the same
+// signer in the same round are an equivocation the forensics of the node has to prove.
+func (s *Simulator) observeVote(n *node, vote *types.Vote) {
+	if n.equivocator {
+		return
+	}
+	round := n.currentRound()
+	if vote.ProposedBlockInfo.Round != round && vote.ProposedBlockInfo.Round != round+1 {
+		return
+	}
+	dist := vote.ProposedBlockInfo.Number.Int64() - int64(n.chain.CurrentBlock().NumberU64())
+	if dist < -maxVoteDist || dist > maxVoteDist {
+		return
+	}
+	signer, err := utils.GetVoteSignerAddresses(vote)
+	if err != nil {
+		return
+	}
+	key := voteKey{signer, vote.ProposedBlockInfo.Round}
+	if s.observed[n.index][key] == nil {
+		s.observed[n.index][key] = make(map[common.Hash]bool)
+	}
+	s.observed[n.index][key][vote.ProposedBlockInfo.Hash] = true
+}
+
+// checkCommitted checks the blocks committed by an honest node against the ones committed by all the others.
+func (s *Simulator) checkCommitted(n *node) {
+	if n.equivocator {
+		return
+	}
+	info := n.engine.EngineV2.GetLatestCommittedBlockInfo()
+	if info == nil || info.Hash == n.committedHash {
+		return
+	}
+	if number := info.Number.Uint64(); number < n.committedNumber {
+		s.violate("%v committed block %d after block %d", n, number, n.committedNumber)
+	}
+	n.committedNumber, n.committedHash = info.Number.Uint64(), info.Hash
+	if n.committedNumber > s.result.Committed {
+		s.result.Committed = n.committedNumber
+	}
+	for header := n.chain.GetHeaderByHash(info.Hash); header != nil; {
+		number := header.Number.Uint64()
+		if hash, ok := s.committed[number]; ok {
+			if hash != header.Hash() {
+				s.violate("%v committed block %d %x conflicting with %x", n, number, header.Hash(), hash)
+			}
+			return
+		}
+		s.committed[number] = header.Hash()
+		if number == 0 {
+			return
+		}
+		header = n.chain.GetHeader(header.ParentHash, number-1)
+	}
+}
+
+// checkForensics checks every equivocation an honest node observed got proven by the forensics of the node, and
+// every equivocation cast got proven by at least one honest node.
+func (s *Simulator) checkForensics() {
+	for _, n := range s.nodes {
+		n.engine.EngineV2.WaitForensicsFaker()
+	}
+	for i, observed := range s.observed {
+		n := s.nodes[i]
+		for key, hashes := range observed {
+			if len(hashes) < 2 {
+				continue
+			}
+			if s.proven(n, key) {
+				s.result.Proofs++
+			} else {
+				s.violate("%v has no proof of the equivocation of %x in round %d", n, key.signer, key.round)
+			}
+		}
+	}
+	for _, key := range s.equivocations {
+		proven := false
+		for _, n := range s.nodes {
+			if !n.equivocator && s.proven(n, key) {
+				proven = true
+				break
+			}
+		}
+		if proven {
+			s.result.Proven++
+		} else {
+			s.violate("no honest node has a proof of the equivocation of %x in round %d", key.signer, key.round)
+		}
+	}
+}
+
+func (s *Simulator) proven(n *node, key voteKey) bool {
+	for _, proof := range n.engine.EngineV2.GetForensicsFaker().GetForensicProofs(&key.signer) {
+		if proof.ForensicsType != "Vote" {
+			continue
+		}
+		var content types.VoteEquivocationContent
+		if err := json.Unmarshal([]byte(proof.Content), &content); err != nil {
+			continue
+		}
+		if content.Signer == key.signer && content.SmallerRoundVote.ProposedBlockInfo.Round == key.round && content.LargerRoundVote.ProposedBlockInfo.Round == key.round {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Simulator) violate(format string, args ...interface{}) {
+	s.result.Violations = append(s.result.Violations, fmt.Sprintf("%v: ", s.net.now)+fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,170 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+)
+
+func runSimulation(t *testing.T, config Config) *Result {
+	t.Helper()
+	sim, err := New(config)
+	if err != nil {
+		t.Fatalf("failed to create simulator: %v", err)
+	}
+	defer sim.Stop()
+
+	start := time.Now()
+	result := sim.Run()
+	t.Logf("seed %d: committed %d, rounds %d, blocks %d, timeouts %d, delivered %d, dropped %d, equivocations %d, proven %d, proofs %d in %v",
+		config.Seed, result.Committed, result.Rounds, result.Blocks, result.Timeouts, result.Delivered, result.Dropped, result.Equivocations, result.Proven, result.Proofs, time.Since(start))
+	for _, violation := range result.Violations {
+		t.Errorf("invariant broken: %s", violation)
+	}
+	return result
+}
+
+func TestSimulateHealthyNetwork(t *testing.T) {
+	for _, seed := range []int64{1, 2} {
+		result := runSimulation(t, Config{
+			Nodes:      4,
+			Seed:       seed,
+			Duration:   time.Minute,
+			MinLatency: 10 * time.Millisecond,
+			MaxLatency: 100 * time.Millisecond,
+		})
+		// a block every mine period, minus the ones not committed yet
+		if result.Committed < 25 {
+			t.Errorf("seed %d: committed %d blocks, want at least 25", seed, result.Committed)
+		}
+		if result.Timeouts != 0 {
+			t.Errorf("seed %d: %d timeouts in a healthy network", seed, result.Timeouts)
+		}
+	}
+}
+
+func TestSimulateLossyNetwork(t *testing.T) {
+	for _, seed := range []int64{1, 2, 3} {
+		result := runSimulation(t, Config{
+			Nodes:      7,
+			Seed:       seed,
+			Duration:   2 * time.Minute,
+			MinLatency: 20 * time.Millisecond,
+			MaxLatency: 400 * time.Millisecond,
+			DropRate:   0.1,
+		})
+		if result.Committed < 20 {
+			t.Errorf("seed %d: committed %d blocks, want at least 20", seed, result.Committed)
+		}
+	}
+}
+
+func TestSimulatePartition(t *testing.T) {
+	for _, seed := range []int64{1, 2} {
+		result := runSimulation(t, Config{
+			Nodes:      4,
+			Seed:       seed,
+			Duration:   2 * time.Minute,
+			MinLatency: 10 * time.Millisecond,
+			MaxLatency: 100 * time.Millisecond,
+			Partitions: []Partition{
+				// the majority keeps committing while a node is cut off
+				{From: 20 * time.Second, Until: 40 * time.Second, Groups: [][]int{{0, 1, 2}, {3}}},
+				// no side has a quorum, the network stalls until the partition heals
+				{From: 60 * time.Second, Until: 80 * time.Second, Groups: [][]int{{0, 1}, {2, 3}}},
+			},
+		})
+		if result.Committed < 30 {
+			t.Errorf("seed %d: committed %d blocks, want at least 30", seed, result.Committed)
+		}
+		if result.Timeouts == 0 {
+			t.Errorf("seed %d: no timeout while the network was split", seed)
+		}
+	}
+}
+
+func TestSimulateCrashedNodes(t *testing.T) {
+	for _, seed := range []int64{1, 2} {
+		result := runSimulation(t, Config{
+			Nodes:      7,
+			Seed:       seed,
+			Duration:   2 * time.Minute,
+			MinLatency: 10 * time.Millisecond,
+			MaxLatency: 200 * time.Millisecond,
+			DropRate:   0.05,
+			Crashes: []Crash{
+				{Node: 2, At: 10 * time.Second},
+				{Node: 5, At: 30 * time.Second, Until: 70 * time.Second},
+			},
+		})
+		if result.Committed < 20 {
+			t.Errorf("seed %d: committed %d blocks, want at least 20", seed, result.Committed)
+		}
+	}
+}
+
+func TestSimulateOfflineLeaders(t *testing.T) {
+	for _, seed := range []int64{1, 2} {
+		config := Config{
+			Nodes:      7,
+			Seed:       seed,
+			Duration:   2 * time.Minute,
+			MinLatency: 10 * time.Millisecond,
+			MaxLatency: 200 * time.Millisecond,
+			Crashes: []Crash{
+				{Node: 2, At: 10 * time.Second},
+				{Node: 5, At: 10 * time.Second},
+			},
+		}
+		plain := runSimulation(t, config)
+		config.OfflineLeaderWindow = 30
+		skipping := runSimulation(t, config)
+
+		// the turns of the crashed leaders time out once per window instead of once per rotation
+		if skipping.Timeouts >= plain.Timeouts {
+			t.Errorf("seed %d: %d timeouts skipping offline leaders, %d without", seed, skipping.Timeouts, plain.Timeouts)
+		}
+		if skipping.Committed*uint64(plain.Rounds) <= plain.Committed*uint64(skipping.Rounds) {
+			t.Errorf("seed %d: committed %d blocks in %d rounds skipping offline leaders, %d in %d without",
+				seed, skipping.Committed, skipping.Rounds, plain.Committed, plain.Rounds)
+		}
+	}
+}
+
+func TestSimulateEquivocatingLeader(t *testing.T) {
+	for _, seed := range []int64{1, 2} {
+		result := runSimulation(t, Config{
+			Nodes:        4,
+			Seed:         seed,
+			Duration:     time.Minute,
+			MinLatency:   10 * time.Millisecond,
+			MaxLatency:   100 * time.Millisecond,
+			Equivocators: []int{1},
+		})
+		if result.Equivocations == 0 {
+			t.Fatalf("seed %d: the leader never equivocated", seed)
+		}
+		if result.Proven != result.Equivocations {
+			t.Errorf("seed %d: %d of %d equivocations proven by the forensics", seed, result.Proven, result.Equivocations)
+		}
+		if result.Committed < 15 {
+			t.Errorf("seed %d: committed %d blocks, want at least 15", seed, result.Committed)
+		}
+	}
+}
+
+func TestSimulateDeterministic(t *testing.T) {
+	config := Config{
+		Nodes:      7,
+		Seed:       3,
+		Duration:   time.Minute,
+		MinLatency: 20 * time.Millisecond,
+		MaxLatency: 400 * time.Millisecond,
+		DropRate:   0.1,
+		Crashes:    []Crash{{Node: 4, At: 10 * time.Second, Until: 30 * time.Second}},
+	}
+	first, second := runSimulation(t, config), runSimulation(t, config)
+	if first.Committed != second.Committed || first.Blocks != second.Blocks || first.Timeouts != second.Timeouts ||
+		first.Delivered != second.Delivered || first.Dropped != second.Dropped {
+		t.Errorf("seed %d: runs differ, %+v and %+v", config.Seed, *first, *second)
+	}
+}
@@ -41,6 +41,7 @@ import (
 	contractValidator "BRDPoSChain/contracts/validator/contract"
 	"BRDPoSChain/core/rawdb"
 	"BRDPoSChain/core/state"
+	"BRDPoSChain/core/state/snapshot"
 	"BRDPoSChain/core/types"
 	"BRDPoSChain/core/vm"
 	"BRDPoSChain/crypto"
@@ -127,6 +128,9 @@ type CacheConfig struct {
 	Disabled      bool          // Whether to disable trie write caching (archive node)
 	TrieNodeLimit int           // Memory limit (MB) at which to flush the current in-memory trie to disk
 	TrieTimeLimit time.Duration // Time limit after which to flush the current in-memory trie to disk
+	TxLookupLimit uint64        // Number of recent blocks for which to maintain transaction lookup indices, 0 = all
+	SnapshotLimit int           // Memory allowance (MB) to use for caching snapshot entries in memory, 0 = disabled
+	SnapshotWait  bool          // Wait for snapshot construction on startup
 }
 type ResultProcessBlock struct {
 	logs         []*types.Log
@@ -156,10 +160,11 @@ type BlockChain struct {
 	chainConfig *params.ChainConfig // Chain & network configuration
 	cacheConfig *CacheConfig        // Cache configuration for pruning
 
-	db     ethdb.Database // Low level persistent database to store final content in
-	BRCxDb ethdb.BRCxDatabase
-	triegc *prque.Prque[int64, common.Hash] // Priority queue mapping block numbers to tries to gc
-	gcproc time.Duration                    // Accumulates canonical block processing for trie dumping
+	db        ethdb.Database // Low level persistent database to store final content in
+	BRCxDb    ethdb.BRCxDatabase
+	triegc    *prque.Prque[int64, common.Hash] // Priority queue mapping block numbers to tries to gc
+	gcproc    time.Duration                    // Accumulates canonical block processing for trie dumping
+	lastWrite uint64                           // Last block whose state was flushed in its entirety
 
 	hc            *HeaderChain
 	rmLogsFeed    event.Feed
@@ -180,6 +185,7 @@ type BlockChain struct {
 	currentFastBlock atomic.Value // Current head of the fast-sync chain (may be above the block chain!)
 
 	stateCache state.Database // State database to reuse between imports (contains state cache)
+	snaps      *snapshot.Tree // Snapshot tree for fast trie leaf access
 
 	bodyCache        *lru.Cache[common.Hash, *types.Body]         // Cache for the most recent block bodies
 	bodyRLPCache     *lru.Cache[common.Hash, rlp.RawValue]        // Cache for the most recent block bodies in RLP encoded format
@@ -193,6 +199,8 @@ type BlockChain struct {
 	// future blocks are blocks added for later processing
 	futureBlocks *lru.Cache[common.Hash, *types.Block]
 
+	txIndexer *txIndexer // Transaction indexer, maintaining the lookup entries of the configured range
+
 	wg            sync.WaitGroup
 	quit          chan struct{} // shutdown signal, closed in Stop.
 	running       int32         // 0 if chain is running, 1 when stopped
@@ -225,6 +233,8 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 		cacheConfig = &CacheConfig{
 			TrieNodeLimit: 256 * 1024 * 1024,
 			TrieTimeLimit: 5 * time.Minute,
+			SnapshotLimit: 256,
+			SnapshotWait:  true,
 		}
 	}
 
@@ -273,6 +283,10 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	if err := bc.loadLastState(); err != nil {
 		return nil, err
 	}
+	// Load any existing snapshot, regenerating it if loading failed
+	if bc.cacheConfig.SnapshotLimit > 0 {
+		bc.snaps, _ = snapshot.New(bc.db, bc.stateCache.TrieDB(), bc.cacheConfig.SnapshotLimit, bc.CurrentBlock().Root(), !bc.cacheConfig.SnapshotWait, true)
+	}
 	// Check the current state of the block hashes and make sure that we do not have any of the bad blocks in our chain
 	for hash := range BadHashes {
 		if header := bc.GetHeaderByHash(hash); header != nil {
@@ -291,6 +305,9 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	bc.wg.Add(1)
 	go bc.futureBlocksLoop()
 
+	// Start tx indexer which maintains the lookup entries of the configured range.
+	bc.txIndexer = newTxIndexer(cacheConfig.TxLookupLimit, bc)
+
 	return bc, nil
 }
 
@@ -515,7 +532,14 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	bc.futureBlocks.Purge()
 	bc.blocksHashCache.Purge()
 
-	return bc.loadLastState()
+	if err := bc.loadLastState(); err != nil {
+		return err
+	}
+	// The diff layers of the rewound blocks are gone, rebuild the snapshot
+	if bc.snaps != nil {
+		bc.snaps.Rebuild(bc.CurrentBlock().Root())
+	}
+	return nil
 }
 
 // FastSyncCommitHead sets the current head block to the one defined by the hash
@@ -529,6 +553,22 @@ func (bc *BlockChain) FastSyncCommitHead(hash common.Hash) error {
 	if _, err := trie.NewSecure(block.Root(), bc.stateCache.TrieDB()); err != nil {
 		return err
 	}
+	// The BRCx tries of the block are needed to import its children
+	tradingRoot, lendingRoot := bc.BRCxStateRoots(block)
+	if triedb := bc.TradingTrieDB(); triedb != nil && !tradingRoot.IsZero() {
+		if _, err := trie.New(tradingRoot, triedb); err != nil {
+			return err
+		}
+	}
+	if triedb := bc.LendingTrieDB(); triedb != nil && !lendingRoot.IsZero() {
+		if _, err := trie.New(lendingRoot, triedb); err != nil {
+			return err
+		}
+	}
+	// The snapshot was built for a different state, regenerate it for the new head
+	if bc.snaps != nil {
+		bc.snaps.Rebuild(block.Root())
+	}
 
 	// If all checks out, manually set the head block.
 	if !bc.chainmu.TryLock() {
@@ -594,7 +634,13 @@ func (bc *BlockChain) State() (*state.StateDB, error) {
 
 // StateAt returns a new mutable state based on a particular point in time.
 func (bc *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
-	return state.New(root, bc.stateCache)
+	return state.NewWithSnapshot(root, bc.stateCache, bc.snaps)
+}
+
+// Snapshots returns the blockchain snapshot tree. This method is mainly used
+// for testing, the tree is nil if snapshotting is disabled.
+func (bc *BlockChain) Snapshots() *snapshot.Tree {
+	return bc.snaps
 }
 
 // OrderStateAt returns a new mutable state based on a particular point in time.
@@ -1001,29 +1047,75 @@ func (bc *BlockChain) TrieNode(hash common.Hash) ([]byte, error) {
 	return bc.stateCache.TrieDB().Node(hash)
 }
 
+// StateCache returns the caching database underpinning the blockchain instance.
+func (bc *BlockChain) StateCache() state.Database {
+	return bc.stateCache
+}
+
+// TradingTrieDB returns the trie database of the BRCx trading state, or nil if
+// the BRCx engine is not running.
+func (bc *BlockChain) TradingTrieDB() *trie.Database {
+	if engine, ok := bc.Engine().(*BRDPoS.BRDPoS); ok {
+		if service := engine.GetBRCXService(); service != nil && service.GetStateCache() != nil {
+			return service.GetStateCache().TrieDB()
+		}
+	}
+	return nil
+}
+
+// LendingTrieDB returns the trie database of the BRCx lending state, or nil if
+// the BRCx lending engine is not running.
+func (bc *BlockChain) LendingTrieDB() *trie.Database {
+	if engine, ok := bc.Engine().(*BRDPoS.BRDPoS); ok {
+		if service := engine.GetLendingService(); service != nil && service.GetStateCache() != nil {
+			return service.GetStateCache().TrieDB()
+		}
+	}
+	return nil
+}
+
+// BRCxStateRoots returns the roots of the BRCx trading and lending state tries
+// committed by the given block, which the import of its children builds upon.
+// Both roots are empty if BRCx is not active at the block.
+func (bc *BlockChain) BRCxStateRoots(block *types.Block) (common.Hash, common.Hash) {
+	var tradingRoot, lendingRoot common.Hash
+
+	engine, ok := bc.Engine().(*BRDPoS.BRDPoS)
+	if !ok || bc.chainConfig.BRDPoS == nil || !bc.Config().IsTIPBRCX(block.Number()) || block.NumberU64() <= bc.chainConfig.BRDPoS.Epoch {
+		return tradingRoot, lendingRoot
+	}
+	author, err := bc.Engine().Author(block.Header())
+	if err != nil {
+		return tradingRoot, lendingRoot
+	}
+	if service := engine.GetBRCXService(); service != nil {
+		tradingRoot, _ = service.GetTradingStateRoot(block, author)
+	}
+	if service := engine.GetLendingService(); service != nil {
+		lendingRoot, _ = service.GetLendingStateRoot(block, author)
+	}
+	return tradingRoot, lendingRoot
+}
+
 func (bc *BlockChain) saveData() {
 	// Ensure the state of a recent block is also stored to disk before exiting.
 	// We're writing three different states to catch different restart scenarios:
 	//  - HEAD:     So we don't need to reprocess any blocks in the general case
 	//  - HEAD-1:   So we don't do large reorgs if our HEAD becomes an uncle
 	//  - HEAD-127: So we have a hard limit on the number of blocks reexecuted
+	//
+	// The snapshot diff layers are journalled as well, along with the state of
+	// the snapshot disk layer to resume any pending generation from.
+	var snapBase common.Hash
+	if bc.snaps != nil {
+		var err error
+		if snapBase, err = bc.snaps.Journal(bc.CurrentBlock().Root()); err != nil {
+			log.Error("Failed to journal state snapshot", "err", err)
+		}
+	}
 	if !bc.cacheConfig.Disabled {
-		var tradingTriedb *trie.Database
-		var lendingTriedb *trie.Database
-		engine, _ := bc.Engine().(*BRDPoS.BRDPoS)
 		triedb := bc.stateCache.TrieDB()
-		var tradingService utils.TradingService
-		var lendingService utils.LendingService
-		if bc.Config().IsTIPBRCX(bc.CurrentBlock().Number()) && bc.chainConfig.BRDPoS != nil && bc.CurrentBlock().NumberU64() > bc.chainConfig.BRDPoS.Epoch && engine != nil {
-			tradingService = engine.GetBRCXService()
-			if tradingService != nil && tradingService.GetStateCache() != nil {
-				tradingTriedb = tradingService.GetStateCache().TrieDB()
-			}
-			lendingService = engine.GetLendingService()
-			if lendingService != nil && lendingService.GetStateCache() != nil {
-				lendingTriedb = lendingService.GetStateCache().TrieDB()
-			}
-		}
+		trading, lending := bc.brcxTrieCaches(bc.CurrentBlock().Number())
 		for _, offset := range []uint64{0, 1, triesInMemory - 1} {
 			if number := bc.CurrentBlock().NumberU64(); number > offset {
 				recent := bc.GetBlockByNumber(number - offset)
@@ -1032,42 +1124,24 @@ func (bc *BlockChain) saveData() {
 				if err := triedb.Commit(recent.Root(), true); err != nil {
 					log.Error("Failed to commit recent state trie", "err", err)
 				}
-				if bc.Config().IsTIPBRCXReceiver(recent.Number()) && bc.chainConfig.BRDPoS != nil && recent.NumberU64() > bc.chainConfig.BRDPoS.Epoch && engine != nil {
+				if t, l := bc.brcxTrieCaches(recent.Number()); t != nil || l != nil {
 					author, _ := bc.Engine().Author(recent.Header())
-					if tradingService != nil {
-						tradingRoot, _ := tradingService.GetTradingStateRoot(recent, author)
-						if !tradingRoot.IsZero() && tradingTriedb != nil {
-							if err := tradingTriedb.Commit(tradingRoot, true); err != nil {
-								log.Error("Failed to commit trading state recent state trie", "err", err)
-							}
-						}
-					}
-					if lendingService != nil {
-						lendingRoot, _ := lendingService.GetLendingStateRoot(recent, author)
-						if !lendingRoot.IsZero() && lendingTriedb != nil {
-							if err := lendingTriedb.Commit(lendingRoot, true); err != nil {
-								log.Error("Failed to commit lending state recent state trie", "err", err)
-							}
-						}
-					}
+					t.flush(recent, author)
+					l.flush(recent, author)
 				}
 			}
 		}
+		if snapBase != (common.Hash{}) {
+			log.Info("Writing snapshot state to disk", "root", snapBase)
+			if err := triedb.Commit(snapBase, true); err != nil {
+				log.Error("Failed to commit recent state trie", "err", err)
+			}
+		}
 		for !bc.triegc.Empty() {
 			triedb.Dereference(bc.triegc.PopItem())
 		}
-		if tradingTriedb != nil && lendingTriedb != nil {
-			if tradingService.GetTriegc() != nil {
-				for !tradingService.GetTriegc().Empty() {
-					tradingTriedb.Dereference(tradingService.GetTriegc().PopItem())
-				}
-			}
-			if lendingService.GetTriegc() != nil {
-				for !lendingService.GetTriegc().Empty() {
-					lendingTriedb.Dereference(lendingService.GetTriegc().PopItem())
-				}
-			}
-		}
+		trading.release()
+		lending.release()
 		if size, _ := triedb.Size(); size != 0 {
 			log.Error("Dangling trie nodes after full cleanup")
 		}
@@ -1081,6 +1155,9 @@ func (bc *BlockChain) Stop() {
 		return
 	}
 
+	// Stop the tx indexer before its chain head subscription goes away.
+	bc.txIndexer.close()
+
 	// Unsubscribe all subscriptions registered from blockchain.
 	bc.scope.Close()
 
@@ -1289,8 +1366,6 @@ func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain [
 	return 0, nil
 }
 
-var lastWrite uint64
-
 // writeBlockWithoutState writes only the block and its metadata to the database,
 // but does not write any state. This is used to construct competing side forks
 // up to the point where they exceed the canonical total difficulty.
@@ -1314,7 +1389,11 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 		return NonStatTy, errInsertionInterrupted
 	}
 	defer bc.chainmu.Unlock()
-	return bc.writeBlockWithState(block, receipts, state, tradingState, lendingState)
+	status, err = bc.writeBlockWithState(block, receipts, state, tradingState, lendingState)
+	if err == nil && status == CanonStatTy && bc.chainConfig.IsTIPBRCX(block.Number()) && bc.chainConfig.BRDPoS != nil && block.NumberU64() > bc.chainConfig.BRDPoS.Epoch {
+		bc.logExchangeData(block)
+	}
+	return status, err
 }
 
 // writeBlockWithState writes the block and all associated state to the database,
@@ -1368,65 +1447,31 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 		}
 	}
 
-	engine, _ := bc.Engine().(*BRDPoS.BRDPoS)
-	var tradingTrieDb *trie.Database
-	var tradingService utils.TradingService
-	var lendingTrieDb *trie.Database
-	var lendingService utils.LendingService
-	if bc.Config().IsTIPBRCXReceiver(block.Number()) && bc.chainConfig.BRDPoS != nil && block.NumberU64() > bc.chainConfig.BRDPoS.Epoch && engine != nil {
-		tradingService = engine.GetBRCXService()
-		if tradingService != nil {
-			tradingTrieDb = tradingService.GetStateCache().TrieDB()
-		}
-		lendingService = engine.GetLendingService()
-		if lendingService != nil {
-			lendingTrieDb = lendingService.GetStateCache().TrieDB()
-		}
-	}
+	trading, lending := bc.brcxTrieCaches(block.Number())
 
 	// If we're running an archive node, always flush
 	if bc.cacheConfig.Disabled {
 		if err := triedb.Commit(root, false); err != nil {
 			return NonStatTy, err
 		}
-		if tradingTrieDb != nil {
-			if err := tradingTrieDb.Commit(tradingRoot, false); err != nil {
-				return NonStatTy, err
-			}
+		if err := trading.commit(tradingRoot); err != nil {
+			return NonStatTy, err
 		}
-		if lendingTrieDb != nil {
-			if err := lendingTrieDb.Commit(lendingRoot, false); err != nil {
-				return NonStatTy, err
-			}
+		if err := lending.commit(lendingRoot); err != nil {
+			return NonStatTy, err
 		}
 	} else {
 		// Full but not archive node, do proper garbage collection
 		triedb.Reference(root, common.Hash{}) // metadata reference to keep trie alive
 		bc.triegc.Push(root, -int64(block.NumberU64()))
-		if tradingTrieDb != nil {
-			tradingTrieDb.Reference(tradingRoot, common.Hash{})
-		}
-		if tradingService != nil {
-			tradingService.GetTriegc().Push(tradingRoot, -int64(block.NumberU64()))
-		}
-		if lendingTrieDb != nil {
-			lendingTrieDb.Reference(lendingRoot, common.Hash{})
-		}
-		if lendingService != nil {
-			lendingService.GetTriegc().Push(lendingRoot, -int64(block.NumberU64()))
-		}
+		trading.reference(tradingRoot, block.NumberU64())
+		lending.reference(lendingRoot, block.NumberU64())
+
 		if current := block.NumberU64(); current > triesInMemory {
 			// Find the next state trie we need to commit
 			chosen := current - triesInMemory
 			// Only write to disk if we exceeded our memory allowance *and* also have at
 			// least a given number of tries gapped.
-			//
-			//if tradingTrieDb != nil {
-			//	size = size + tradingTrieDb.Size()
-			//}
-			//if lendingTrieDb != nil {
-			//	size = size + lendingTrieDb.Size()
-			//}
 			var (
 				nodes, imgs = triedb.Size()
 				limit       = common.StorageSize(bc.cacheConfig.TrieNodeLimit) * 1024 * 1024
@@ -1434,7 +1479,10 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 			if nodes > limit || imgs > 4*1024*1024 {
 				triedb.Cap(limit - ethdb.IdealBatchSize)
 			}
-			if bc.gcproc > bc.cacheConfig.TrieTimeLimit || chosen > lastWrite+triesInMemory {
+			trading.cap(limit / brcxTrieShare)
+			lending.cap(limit / brcxTrieShare)
+
+			if bc.gcproc > bc.cacheConfig.TrieTimeLimit || chosen > bc.lastWrite+triesInMemory {
 				// If the header is missing (canonical chain behind), we're reorging a low
 				// diff sidechain. Suspend committing until this operation is completed.
 				header := bc.GetHeaderByNumber(chosen)
@@ -1443,20 +1491,21 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 				} else {
 					// If we're exceeding limits but haven't reached a large enough memory gap,
 					// warn the user that the system is becoming unstable.
-					if chosen < lastWrite+triesInMemory && bc.gcproc >= 2*bc.cacheConfig.TrieTimeLimit {
-						log.Info("State in memory for too long, committing", "time", bc.gcproc, "allowance", bc.cacheConfig.TrieTimeLimit, "optimum", float64(chosen-lastWrite)/triesInMemory)
+					if chosen < bc.lastWrite+triesInMemory && bc.gcproc >= 2*bc.cacheConfig.TrieTimeLimit {
+						log.Info("State in memory for too long, committing", "time", bc.gcproc, "allowance", bc.cacheConfig.TrieTimeLimit, "optimum", float64(chosen-bc.lastWrite)/triesInMemory)
 					}
 					// Flush an entire trie and restart the counters
 					triedb.Commit(header.Root, true)
-					lastWrite = chosen
+					bc.lastWrite = chosen
 					bc.gcproc = 0
-					if tradingTrieDb != nil && lendingTrieDb != nil {
-						b := bc.GetBlock(header.Hash(), current-triesInMemory)
-						author, _ := bc.Engine().Author(b.Header())
-						oldTradingRoot, _ := tradingService.GetTradingStateRoot(b, author)
-						oldLendingRoot, _ := lendingService.GetLendingStateRoot(b, author)
-						tradingTrieDb.Commit(oldTradingRoot, true)
-						lendingTrieDb.Commit(oldLendingRoot, true)
+
+					// Flush the BRCx tries of the same block along with it
+					if trading != nil || lending != nil {
+						if b := bc.GetBlock(header.Hash(), chosen); b != nil {
+							author, _ := bc.Engine().Author(header)
+							trading.flush(b, author)
+							lending.flush(b, author)
+						}
 					}
 				}
 			}
@@ -1469,26 +1518,8 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 				}
 				triedb.Dereference(root)
 			}
-			if tradingService != nil {
-				for !tradingService.GetTriegc().Empty() {
-					tradingRoot, number := tradingService.GetTriegc().Pop()
-					if uint64(-number) > chosen {
-						tradingService.GetTriegc().Push(tradingRoot, number)
-						break
-					}
-					tradingTrieDb.Dereference(tradingRoot)
-				}
-			}
-			if lendingService != nil {
-				for !lendingService.GetTriegc().Empty() {
-					lendingRoot, number := lendingService.GetTriegc().Pop()
-					if uint64(-number) > chosen {
-						lendingService.GetTriegc().Push(lendingRoot, number)
-						break
-					}
-					lendingTrieDb.Dereference(lendingRoot)
-				}
-			}
+			trading.gc(chosen)
+			lending.gc(chosen)
 		}
 	}
 
@@ -1701,7 +1732,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, []
 		} else {
 			parent = chain[i-1]
 		}
-		statedb, err := state.New(parent.Root(), bc.stateCache)
+		statedb, err := state.NewWithSnapshot(parent.Root(), bc.stateCache, bc.snaps)
 		if err != nil {
 			return i, events, coalescedLogs, err
 		}
@@ -1772,7 +1803,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, []
 					}
 					// liquidate / finalize open lendingTrades
 					if block.Number().Uint64()%bc.chainConfig.BRDPoS.Epoch == common.LiquidateLendingTradeBlock {
-						finalizedTrades, _, _, _, _, err := lendingService.ProcessLiquidationData(block.Header(), bc, statedb, tradingState, lendingState)
+						finalizedTrades, _, _, _, _, _, err := lendingService.ProcessLiquidationData(block.Header(), bc, statedb, tradingState, lendingState)
 						if err != nil {
 							return i, events, coalescedLogs, fmt.Errorf("failed to ProcessLiquidationData. Err: %v", err)
 						}
@@ -2002,7 +2033,7 @@ func (bc *BlockChain) getResultBlock(block *types.Block, verifiedM2 bool) (*Resu
 	// Create a new statedb using the parent block and report an
 	// error if it fails.
 	var parent = bc.GetBlock(block.ParentHash(), block.NumberU64()-1)
-	statedb, err := state.New(parent.Root(), bc.stateCache)
+	statedb, err := state.NewWithSnapshot(parent.Root(), bc.stateCache, bc.snaps)
 	if err != nil {
 		return nil, err
 	}
@@ -2074,7 +2105,7 @@ func (bc *BlockChain) getResultBlock(block *types.Block, verifiedM2 bool) (*Resu
 				}
 				// liquidate / finalize open lendingTrades
 				if block.Number().Uint64()%bc.chainConfig.BRDPoS.Epoch == common.LiquidateLendingTradeBlock {
-					finalizedTrades, _, _, _, _, err := lendingService.ProcessLiquidationData(block.Header(), bc, statedb, tradingState, lendingState)
+					finalizedTrades, _, _, _, _, _, err := lendingService.ProcessLiquidationData(block.Header(), bc, statedb, tradingState, lendingState)
 					if err != nil {
 						return nil, fmt.Errorf("failed to ProcessLiquidationData. Err: %v", err)
 					}
@@ -2452,6 +2483,9 @@ func (bc *BlockChain) reorg(oldHead, newHead *types.Header) error {
 		for _, tx := range block.Transactions() {
 			deletedTxs = append(deletedTxs, tx.Hash())
 		}
+		if bc.chainConfig.IsTIPBRCX(block.Number()) && bc.chainConfig.BRDPoS != nil && block.NumberU64() > bc.chainConfig.BRDPoS.Epoch {
+			bc.rollbackExchangeData(block)
+		}
 		// Collect deleted logs and emit them for new integrations
 		// if logs := bc.collectLogs(block, true); len(logs) > 0 {
 		// 	slices.Reverse(logs) // Emit revertals latest first, older then
@@ -2478,6 +2512,10 @@ func (bc *BlockChain) reorg(oldHead, newHead *types.Header) error {
 		}
 		// Update the head block
 		bc.writeHeadBlock(block, true)
+		// the new head block is logged by the caller once it has been written
+		if i > 0 && bc.chainConfig.IsTIPBRCX(block.Number()) && bc.chainConfig.BRDPoS != nil && block.NumberU64() > bc.chainConfig.BRDPoS.Epoch {
+			bc.logExchangeData(block)
+		}
 		// prepare set of masternodes for the next epoch
 		if bc.chainConfig.BRDPoS != nil && ((block.NumberU64() % bc.chainConfig.BRDPoS.Epoch) == (bc.chainConfig.BRDPoS.Epoch - bc.chainConfig.BRDPoS.Gap)) {
 			if err := bc.UpdateM1(); err != nil {
@@ -2715,6 +2753,11 @@ func (bc *BlockChain) SubscribeChainEvent(ch chan<- ChainEvent) event.Subscripti
 	return bc.scope.Track(bc.chainFeed.Subscribe(ch))
 }
 
+// TxIndexProgress returns the transaction indexing progress.
+func (bc *BlockChain) TxIndexProgress() (TxIndexProgress, error) {
+	return bc.txIndexer.txIndexProgress()
+}
+
 // SubscribeChainHeadEvent registers a subscription of ChainHeadEvent.
 func (bc *BlockChain) SubscribeChainHeadEvent(ch chan<- ChainHeadEvent) event.Subscription {
 	return bc.scope.Track(bc.chainHeadFeed.Subscribe(ch))
@@ -2778,6 +2821,8 @@ func (bc *BlockChain) UpdateM1() error {
 		candidates = state.GetCandidates(stateDB)
 	}
 
+	// the BLS public keys are only kept in the state, the snapshot is taken at the current header
+	withBLS := stateDB != nil && bc.Config().IsTIPBLS(bc.CurrentHeader().Number)
 	var ms []utils.Masternode
 	for _, candidate := range candidates {
 		v, err := validator.GetCandidateCap(opts, candidate)
@@ -2786,7 +2831,11 @@ func (bc *BlockChain) UpdateM1() error {
 		}
 		// TODO: smart contract shouldn't return "0x0000000000000000000000000000000000000000"
 		if !candidate.IsZero() {
-			ms = append(ms, utils.Masternode{Address: candidate, Stake: v})
+			m := utils.Masternode{Address: candidate, Stake: v}
+			if withBLS {
+				m.BLSPublicKey = state.GetCandidateBLSPublicKey(stateDB, candidate)
+			}
+			ms = append(ms, m)
 		}
 	}
 	if len(ms) == 0 {
@@ -2820,7 +2869,7 @@ func (bc *BlockChain) logExchangeData(block *types.Block) {
 		return
 	}
 	BRCXService := engine.GetBRCXService()
-	if BRCXService == nil || !BRCXService.IsSDKNode() {
+	if BRCXService == nil {
 		return
 	}
 	txMatchBatchData, err := ExtractTradingTransactions(block.Transactions())
@@ -2831,10 +2880,19 @@ func (bc *BlockChain) logExchangeData(block *types.Block) {
 	if len(txMatchBatchData) == 0 {
 		return
 	}
-	currentState, err := bc.State()
-	if err != nil {
-		log.Crit("logExchangeData: failed to get current state", "err", err)
-		return
+	var currentState *state.StateDB
+	if BRCXService.IsSDKNode() {
+		if currentState, err = bc.State(); err != nil {
+			log.Crit("logExchangeData: failed to get current state", "err", err)
+			return
+		}
+	}
+	// matching events are published for the trading state after the block
+	var tradingState *tradingstate.TradingStateDB
+	if author, err := engine.Author(block.Header()); err != nil {
+		log.Warn("logExchangeData: failed to get block author", "number", block.Number(), "err", err)
+	} else if tradingState, err = BRCXService.GetTradingState(block, author); err != nil {
+		log.Warn("logExchangeData: failed to get trading state", "number", block.Number(), "err", err)
 	}
 	start := time.Now()
 	defer func() {
@@ -2843,12 +2901,14 @@ func (bc *BlockChain) logExchangeData(block *types.Block) {
 		log.Debug("logExchangeData takes", "time", common.PrettyDuration(time.Since(start)), "blockNumber", block.NumberU64())
 	}()
 
+	txMatchTime := time.Unix(block.Header().Time.Int64(), 0).UTC()
 	for _, txMatchBatch := range txMatchBatchData {
 		dirtyOrderCount := uint64(0)
+		txTrades := []*tradingstate.TradeRecord{}
 		for _, txMatch := range txMatchBatch.Data {
 			var (
 				takerOrderInTx *tradingstate.OrderItem
-				trades         []map[string]string
+				trades         []*tradingstate.TradeRecord
 				rejectedOrders []*tradingstate.OrderItem
 			)
 
@@ -2860,7 +2920,7 @@ func (bc *BlockChain) logExchangeData(block *types.Block) {
 			// getTrades from cache
 			resultTrades, ok := bc.resultTrade.Get(cacheKey)
 			if ok && resultTrades != nil {
-				trades = resultTrades.([]map[string]string)
+				trades = resultTrades.([]*tradingstate.TradeRecord)
 			}
 
 			// getRejectedOrder from cache
@@ -2869,12 +2929,44 @@ func (bc *BlockChain) logExchangeData(block *types.Block) {
 				rejectedOrders = rejected.([]*tradingstate.OrderItem)
 			}
 
-			txMatchTime := time.Unix(block.Header().Time.Int64(), 0).UTC()
+			txTrades = append(txTrades, trades...)
+			if tradingState != nil {
+				BRCXService.PublishMatchingResult(tradingState, takerOrderInTx, trades, rejectedOrders)
+			}
+			if !BRCXService.IsSDKNode() {
+				continue
+			}
 			if err := BRCXService.SyncDataToSDKNode(takerOrderInTx, txMatchBatch.TxHash, txMatchTime, currentState, trades, rejectedOrders, &dirtyOrderCount); err != nil {
 				log.Crit("failed to SyncDataToSDKNode ", "blockNumber", block.Number(), "err", err)
 				return
 			}
 		}
+		if err := BRCXService.IndexTrades(txMatchBatch.TxHash, txMatchTime, txTrades); err != nil {
+			log.Error("failed to index trades", "blockNumber", block.Number(), "txhash", txMatchBatch.TxHash.Hex(), "err", err)
+		}
+	}
+}
+
+// rollbackExchangeData reverts the BRCx data derived from the matching
+// transactions of a block which has been removed from the canonical chain.
+func (bc *BlockChain) rollbackExchangeData(block *types.Block) {
+	engine, ok := bc.Engine().(*BRDPoS.BRDPoS)
+	if !ok || engine == nil {
+		return
+	}
+	BRCXService := engine.GetBRCXService()
+	if BRCXService == nil {
+		return
+	}
+	txMatchBatchData, err := ExtractTradingTransactions(block.Transactions())
+	if err != nil {
+		log.Crit("failed to extract matching transaction", "err", err)
+		return
+	}
+	for _, txMatchBatch := range txMatchBatchData {
+		if err := BRCXService.RollbackReorgTxMatch(txMatchBatch.TxHash); err != nil {
+			log.Crit("failed to RollbackReorgTxMatch", "blockNumber", block.Number(), "txhash", txMatchBatch.TxHash.Hex(), "err", err)
+		}
 	}
 }
 
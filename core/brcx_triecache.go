@@ -0,0 +1,170 @@
+// Copyright (c) 2024 BRDPoSChain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/common/prque"
+	"BRDPoSChain/consensus/BRDPoS"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/ethdb"
+	"BRDPoSChain/log"
+	"BRDPoSChain/metrics"
+	"BRDPoSChain/trie"
+)
+
+// brcxTrieShare is the divisor applied to the trie cache allowance of the
+// account trie to get the allowance of each of the BRCx trie databases.
+const brcxTrieShare = 4
+
+var (
+	tradingDirtyGauge = metrics.NewRegisteredGauge("chain/brcx/trading/dirty", nil)
+	lendingDirtyGauge = metrics.NewRegisteredGauge("chain/brcx/lending/dirty", nil)
+)
+
+// brcxTrieCache is the in-memory trie database of one of the BRCx states
+// (trading or lending), garbage collected in lockstep with the account trie:
+// every block references its root, the roots falling out of the retention
+// window are dereferenced and the trie is flushed whenever the account trie is.
+//
+// All methods are safe to call on a nil cache, which is what the BRCx states
+// resolve to on blocks without BRCx or on nodes not running the BRCx engine.
+type brcxTrieCache struct {
+	name   string                                                               // Name of the state for logging
+	triedb *trie.Database                                                       // In-memory trie database of the state
+	triegc *prque.Prque[int64, common.Hash]                                     // Priority queue mapping block numbers to roots to gc
+	rootAt func(block *types.Block, author common.Address) (common.Hash, error) // Resolves the root of the state at a block
+	dirty  *metrics.Gauge                                                       // Gauge tracking the dirty cache size
+}
+
+// brcxTrieCaches returns the caches of the trading and lending states at the
+// given block number. Either may be nil if the state is not maintained.
+func (bc *BlockChain) brcxTrieCaches(number *big.Int) (trading *brcxTrieCache, lending *brcxTrieCache) {
+	engine, ok := bc.Engine().(*BRDPoS.BRDPoS)
+	if !ok || bc.chainConfig.BRDPoS == nil || !bc.chainConfig.IsTIPBRCXReceiver(number) || number.Uint64() <= bc.chainConfig.BRDPoS.Epoch {
+		return nil, nil
+	}
+	if service := engine.GetBRCXService(); service != nil && service.GetStateCache() != nil {
+		trading = &brcxTrieCache{
+			name:   "trading",
+			triedb: service.GetStateCache().TrieDB(),
+			triegc: service.GetTriegc(),
+			rootAt: service.GetTradingStateRoot,
+			dirty:  tradingDirtyGauge,
+		}
+	}
+	if service := engine.GetLendingService(); service != nil && service.GetStateCache() != nil {
+		lending = &brcxTrieCache{
+			name:   "lending",
+			triedb: service.GetStateCache().TrieDB(),
+			triegc: service.GetTriegc(),
+			rootAt: service.GetLendingStateRoot,
+			dirty:  lendingDirtyGauge,
+		}
+	}
+	return trading, lending
+}
+
+// commit writes the trie of the given root to disk (archive mode).
+func (c *brcxTrieCache) commit(root common.Hash) error {
+	if c == nil {
+		return nil
+	}
+	if err := c.triedb.Commit(root, false); err != nil {
+		return err
+	}
+	c.updateMetrics()
+	return nil
+}
+
+// reference keeps the trie of the given root alive in memory until the block
+// with the given number falls out of the retention window.
+func (c *brcxTrieCache) reference(root common.Hash, number uint64) {
+	if c == nil {
+		return
+	}
+	c.triedb.Reference(root, common.Hash{})
+	c.triegc.Push(root, -int64(number))
+}
+
+// cap flushes trie nodes to disk until the dirty cache fits into the given
+// memory allowance.
+func (c *brcxTrieCache) cap(limit common.StorageSize) {
+	if c == nil {
+		return
+	}
+	if nodes, imgs := c.triedb.Size(); nodes > limit || imgs > 4*1024*1024 {
+		if err := c.triedb.Cap(limit - ethdb.IdealBatchSize); err != nil {
+			log.Error("Failed to cap BRCx trie cache", "state", c.name, "err", err)
+		}
+	}
+	c.updateMetrics()
+}
+
+// flush writes the state of the given block to disk in its entirety.
+func (c *brcxTrieCache) flush(block *types.Block, author common.Address) {
+	if c == nil {
+		return
+	}
+	root, err := c.rootAt(block, author)
+	if err != nil {
+		log.Error("Failed to resolve BRCx state root", "state", c.name, "number", block.Number(), "err", err)
+		return
+	}
+	if err := c.triedb.Commit(root, true); err != nil {
+		log.Error("Failed to commit BRCx state trie", "state", c.name, "number", block.Number(), "root", root, "err", err)
+	}
+	c.updateMetrics()
+}
+
+// gc dereferences the tries of all blocks up to and including chosen.
+func (c *brcxTrieCache) gc(chosen uint64) {
+	if c == nil {
+		return
+	}
+	for !c.triegc.Empty() {
+		root, number := c.triegc.Pop()
+		if uint64(-number) > chosen {
+			c.triegc.Push(root, number)
+			break
+		}
+		c.triedb.Dereference(root)
+	}
+	c.updateMetrics()
+}
+
+// release dereferences all tries still held in memory, reporting any nodes that
+// are left dangling afterwards.
+func (c *brcxTrieCache) release() {
+	if c == nil {
+		return
+	}
+	for !c.triegc.Empty() {
+		c.triedb.Dereference(c.triegc.PopItem())
+	}
+	if size, _ := c.triedb.Size(); size != 0 {
+		log.Error("Dangling BRCx trie nodes after full cleanup", "state", c.name, "size", size)
+	}
+	c.updateMetrics()
+}
+
+// updateMetrics reports the current size of the dirty cache.
+func (c *brcxTrieCache) updateMetrics() {
+	nodes, _ := c.triedb.Size()
+	c.dirty.Update(int64(nodes))
+}
@@ -0,0 +1,265 @@
+// Copyright (c) 2024 BRDPoSChain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// The chain level tests of the BRCx trie cache live in an external package as
+// the BRCx services themselves depend on core.
+package core_test
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"BRDPoSChain/BRCx"
+	"BRDPoSChain/BRCx/tradingstate"
+	"BRDPoSChain/BRCxlending"
+	"BRDPoSChain/BRCxlending/lendingstate"
+	"BRDPoSChain/common"
+	"BRDPoSChain/common/prque"
+	"BRDPoSChain/consensus/BRDPoS"
+	"BRDPoSChain/consensus/BRDPoS/engines/engine_v1"
+	"BRDPoSChain/consensus/BRDPoS/utils"
+	"BRDPoSChain/core"
+	"BRDPoSChain/core/rawdb"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/core/vm"
+	"BRDPoSChain/crypto"
+	"BRDPoSChain/ethdb"
+	"BRDPoSChain/metrics"
+	"BRDPoSChain/params"
+)
+
+// triesInMemory mirrors the number of recent tries core keeps in memory.
+const triesInMemory = 128
+
+// brcxTestChain builds a v1 BRDPoS chain whose blocks all change the trading
+// and lending states, written the same way a miner writes its sealed blocks.
+type brcxTestChain struct {
+	db      ethdb.Database
+	config  *params.ChainConfig
+	key     *ecdsa.PrivateKey
+	trading *BRCx.BRCX
+	lending *BRCxlending.Lending
+}
+
+func newBRCxTestChain(t *testing.T) *brcxTestChain {
+	// Keep the masternode list untouched, the chain has no validator contract
+	config := *params.TestBRDPoSMockChainConfig
+	brdpos := *config.BRDPoS
+	brdpos.Epoch, brdpos.Gap = 10, 0
+	config.BRDPoS = &brdpos
+
+	key, _ := crypto.GenerateKey()
+	db := rawdb.NewMemoryDatabase()
+	genesis := core.Genesis{
+		Config:    &config,
+		GasLimit:  10000000,
+		ExtraData: make([]byte, utils.ExtraVanity+utils.ExtraSeal),
+	}
+	genesis.MustCommit(db)
+
+	trading := BRCx.New(&BRCx.Config{DataDir: t.TempDir()})
+	t.Cleanup(func() { trading.GetLevelDB().Close() })
+
+	return &brcxTestChain{
+		db:      db,
+		config:  &config,
+		key:     key,
+		trading: trading,
+		lending: BRCxlending.New(trading),
+	}
+}
+
+// open starts a blockchain on the database, with empty BRCx trie caches as
+// after a restart of the node.
+func (c *brcxTestChain) open(t *testing.T) *core.BlockChain {
+	c.trading.StateCache = tradingstate.NewDatabase(c.trading.GetLevelDB())
+	c.trading.Triegc = prque.New[int64, common.Hash](nil)
+	c.lending.StateCache = lendingstate.NewDatabase(c.lending.GetLevelDB())
+	c.lending.Triegc = prque.New[int64, common.Hash](nil)
+
+	engine := BRDPoS.NewFaker(c.db, c.config)
+	engine.GetBRCXService = func() utils.TradingService { return c.trading }
+	engine.GetLendingService = func() utils.LendingService { return c.lending }
+
+	bc, err := core.NewBlockChain(c.db, nil, c.config, engine, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	return bc
+}
+
+// insert seals and writes the blocks from the given number on, up to and
+// including head, on top of the canonical chain.
+func (c *brcxTestChain) insert(t *testing.T, bc *core.BlockChain, from, head uint64) {
+	author := crypto.PubkeyToAddress(c.key.PublicKey)
+
+	for number := from; number <= head; number++ {
+		parent := bc.GetBlockByNumber(number - 1)
+		statedb, err := bc.StateAt(parent.Root())
+		if err != nil {
+			t.Fatalf("block %d: failed to open parent state: %v", number, err)
+		}
+		statedb.AddBalance(author, big.NewInt(1))
+
+		var (
+			txs          types.Transactions
+			tradingState *tradingstate.TradingStateDB
+			lendingState *lendingstate.LendingStateDB
+		)
+		if number > c.config.BRDPoS.Epoch {
+			tradingRoot, _ := c.trading.GetTradingStateRoot(parent, author)
+			if tradingState, err = tradingstate.New(tradingRoot, c.trading.GetStateCache()); err != nil {
+				t.Fatalf("block %d: failed to open parent trading state: %v", number, err)
+			}
+			lendingRoot, _ := c.lending.GetLendingStateRoot(parent, author)
+			if lendingState, err = lendingstate.New(lendingRoot, c.lending.GetStateCache()); err != nil {
+				t.Fatalf("block %d: failed to open parent lending state: %v", number, err)
+			}
+			orderBook := common.BigToHash(new(big.Int).SetUint64(number%7 + 1))
+			tradingState.SetNonce(orderBook, number)
+			tradingState.InsertOrderItem(orderBook, common.BigToHash(new(big.Int).SetUint64(number)), tradingstate.OrderItem{
+				OrderID:   number,
+				Quantity:  big.NewInt(1),
+				Price:     new(big.Int).SetUint64(number),
+				Side:      tradingstate.Ask,
+				Signature: &tradingstate.Signature{V: 1, R: common.HexToHash("11"), S: common.HexToHash("22")},
+			})
+			lendingState.SetNonce(orderBook, number)
+
+			// The roots of the states are published by the block author
+			data := append(tradingState.IntermediateRoot().Bytes(), lendingState.IntermediateRoot().Bytes()...)
+			tx, err := types.SignTx(types.NewTransaction(number, common.TradingStateAddrBinary, big.NewInt(0), 0, big.NewInt(0), data), types.HomesteadSigner{}, c.key)
+			if err != nil {
+				t.Fatalf("block %d: failed to sign state root transaction: %v", number, err)
+			}
+			txs = append(txs, tx)
+		}
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).SetUint64(number),
+			GasLimit:   parent.GasLimit(),
+			Time:       new(big.Int).Add(parent.Time(), big.NewInt(2)),
+			Difficulty: big.NewInt(1),
+			Root:       statedb.IntermediateRoot(c.config.IsEIP158(parent.Number())),
+			Extra:      make([]byte, utils.ExtraVanity+utils.ExtraSeal),
+		}
+		block := types.NewBlock(header, txs, nil, nil)
+		header = block.Header()
+		sig, err := crypto.Sign(engine_v1.SigHash(header).Bytes(), c.key)
+		if err != nil {
+			t.Fatalf("block %d: failed to seal: %v", number, err)
+		}
+		copy(header.Extra[utils.ExtraVanity:], sig)
+		block = block.WithSeal(header)
+
+		if _, err := bc.WriteBlockWithState(block, nil, statedb, tradingState, lendingState); err != nil {
+			t.Fatalf("block %d: failed to write: %v", number, err)
+		}
+	}
+}
+
+// verify checks that the trading and lending states of the given block are
+// complete on disk and hold the changes of the block.
+func (c *brcxTestChain) verify(t *testing.T, block *types.Block) {
+	author := crypto.PubkeyToAddress(c.key.PublicKey)
+	orderBook := common.BigToHash(new(big.Int).SetUint64(block.NumberU64()%7 + 1))
+
+	tradingRoot, _ := c.trading.GetTradingStateRoot(block, author)
+	tradingTrie, err := c.trading.GetStateCache().OpenTrie(tradingRoot)
+	if err != nil {
+		t.Fatalf("failed to open trading trie of block %d: %v", block.NumberU64(), err)
+	}
+	it := tradingTrie.NodeIterator(nil)
+	for it.Next(true) {
+	}
+	if err := it.Error(); err != nil {
+		t.Fatalf("trading trie of block %d incomplete: %v", block.NumberU64(), err)
+	}
+	tradingState, _ := tradingstate.New(tradingRoot, c.trading.GetStateCache())
+	if nonce := tradingState.GetNonce(orderBook); nonce != block.NumberU64() {
+		t.Fatalf("trading nonce mismatch at block %d: have %d", block.NumberU64(), nonce)
+	}
+	lendingRoot, _ := c.lending.GetLendingStateRoot(block, author)
+	lendingTrie, err := c.lending.GetStateCache().OpenTrie(lendingRoot)
+	if err != nil {
+		t.Fatalf("failed to open lending trie of block %d: %v", block.NumberU64(), err)
+	}
+	it = lendingTrie.NodeIterator(nil)
+	for it.Next(true) {
+	}
+	if err := it.Error(); err != nil {
+		t.Fatalf("lending trie of block %d incomplete: %v", block.NumberU64(), err)
+	}
+	lendingState, _ := lendingstate.New(lendingRoot, c.lending.GetStateCache())
+	if nonce := lendingState.GetNonce(orderBook); nonce != block.NumberU64() {
+		t.Fatalf("lending nonce mismatch at block %d: have %d", block.NumberU64(), nonce)
+	}
+}
+
+// Tests that a node crashing with the BRCx tries of the recent blocks held in
+// memory restarts from the last block flushed in its entirety, that the states
+// of that block are complete and that re-importing the lost blocks leads to the
+// same head. A clean shutdown afterwards must keep the head states.
+func TestBRCxTrieCacheCrashRecovery(t *testing.T) {
+	defer func(tip *big.Int) { common.TIPBRCX = tip }(common.TIPBRCX)
+	common.TIPBRCX = big.NewInt(0)
+
+	const (
+		head = 3*triesInMemory + triesInMemory/2
+		// The state is flushed once more than triesInMemory blocks have passed
+		// since the last flush, i.e. at blocks 129 and 258 of the chain
+		flushed = 2 * (triesInMemory + 1)
+	)
+	chain := newBRCxTestChain(t)
+	bc := chain.open(t)
+	chain.insert(t, bc, 1, head)
+	headHash := bc.CurrentBlock().Hash()
+
+	if size, _ := chain.trading.GetStateCache().TrieDB().Size(); size == 0 {
+		t.Fatalf("recent trading tries not held in memory")
+	}
+	// Simulate a crash by restarting without stopping the chain
+	bc = chain.open(t)
+	if number := bc.CurrentBlock().NumberU64(); number != flushed {
+		t.Fatalf("recovered head mismatch: have %d, want %d", number, flushed)
+	}
+	chain.verify(t, bc.CurrentBlock())
+
+	// Re-import the lost blocks and make sure the same head is reached
+	chain.insert(t, bc, flushed+1, head)
+	if hash := bc.CurrentBlock().Hash(); hash != headHash {
+		t.Fatalf("head mismatch after recovery: have %x, want %x", hash, headHash)
+	}
+	// A clean shutdown flushes the head and leaves nothing dangling in memory
+	bc.Stop()
+	if size, _ := chain.trading.GetStateCache().TrieDB().Size(); size != 0 {
+		t.Fatalf("dangling trading trie nodes after shutdown: %v", size)
+	}
+	if size, _ := chain.lending.GetStateCache().TrieDB().Size(); size != 0 {
+		t.Fatalf("dangling lending trie nodes after shutdown: %v", size)
+	}
+	for _, name := range []string{"chain/brcx/trading/dirty", "chain/brcx/lending/dirty"} {
+		if value := metrics.GetOrRegisterGauge(name, nil).Snapshot().Value(); value != 0 {
+			t.Fatalf("%s gauge not reset: %d", name, value)
+		}
+	}
+	bc = chain.open(t)
+	defer bc.Stop()
+	if hash := bc.CurrentBlock().Hash(); hash != headHash {
+		t.Fatalf("head not kept on shutdown: have %x, want %x", hash, headHash)
+	}
+	chain.verify(t, bc.CurrentBlock())
+}
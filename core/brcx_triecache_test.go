@@ -0,0 +1,38 @@
+// Copyright (c) 2024 BRDPoSChain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/core/types"
+)
+
+// Tests that a nil cache, as used on blocks without BRCx, is a no-op.
+func TestBRCxTrieCacheNil(t *testing.T) {
+	var cache *brcxTrieCache
+
+	if err := cache.commit(common.Hash{1}); err != nil {
+		t.Fatalf("nil commit failed: %v", err)
+	}
+	cache.reference(common.Hash{1}, 1)
+	cache.cap(0)
+	cache.flush(types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)}), common.Address{})
+	cache.gc(1)
+	cache.release()
+}
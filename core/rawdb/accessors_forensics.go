@@ -0,0 +1,69 @@
+package rawdb
+
+import (
+	"BRDPoSChain/common"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/ethdb"
+	"BRDPoSChain/log"
+	"BRDPoSChain/rlp"
+)
+
+// ReadForensicProof retrieves the forensic proof with the given id.
+func ReadForensicProof(db ethdb.KeyValueReader, id string) *types.ForensicProof {
+	data, _ := db.Get(forensicProofKey(id))
+	if len(data) == 0 {
+		return nil
+	}
+	proof := new(types.ForensicProof)
+	if err := rlp.DecodeBytes(data, proof); err != nil {
+		log.Error("Invalid forensic proof RLP", "id", id, "err", err)
+		return nil
+	}
+	return proof
+}
+
+// ReadForensicProofs retrieves all the stored forensic proofs.
+func ReadForensicProofs(db ethdb.Iteratee) []*types.ForensicProof {
+	it := db.NewIterator(forensicProofPrefix, nil)
+	defer it.Release()
+
+	var proofs []*types.ForensicProof
+	for it.Next() {
+		proof := new(types.ForensicProof)
+		if err := rlp.DecodeBytes(it.Value(), proof); err != nil {
+			log.Error("Invalid forensic proof RLP", "key", it.Key(), "err", err)
+			continue
+		}
+		proofs = append(proofs, proof)
+	}
+	return proofs
+}
+
+// ReadForensicProofIds retrieves the ids of the forensic proofs blaming the signer.
+func ReadForensicProofIds(db ethdb.Iteratee, signer common.Address) []string {
+	prefix := append(append([]byte{}, forensicProofSignerPrefix...), signer.Bytes()...)
+	it := db.NewIterator(prefix, nil)
+	defer it.Release()
+
+	var ids []string
+	for it.Next() {
+		ids = append(ids, string(it.Key()[len(prefix):]))
+	}
+	return ids
+}
+
+// WriteForensicProof stores a forensic proof and indexes it by the signers it blames.
+func WriteForensicProof(db ethdb.KeyValueWriter, proof *types.ForensicProof, signers []common.Address) {
+	data, err := rlp.EncodeToBytes(proof)
+	if err != nil {
+		log.Crit("Failed to RLP encode forensic proof", "err", err)
+	}
+	if err := db.Put(forensicProofKey(proof.Id), data); err != nil {
+		log.Crit("Failed to store forensic proof", "err", err)
+	}
+	for _, signer := range signers {
+		if err := db.Put(forensicProofSignerKey(signer, proof.Id), nil); err != nil {
+			log.Crit("Failed to store forensic proof signer index", "err", err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package rawdb
+
+import (
+	"testing"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/core/types"
+)
+
+// Tests that forensic proofs can be stored and retrieved by signer.
+func TestForensicProofStorage(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	signer1, signer2 := common.HexToAddress("0x1"), common.HexToAddress("0x2")
+	qcProof := &types.ForensicProof{Id: "qc", ForensicsType: "QC", Content: "{}"}
+	voteProof := &types.ForensicProof{Id: "vote", ForensicsType: "Vote", Content: "{}"}
+
+	if proof := ReadForensicProof(db, qcProof.Id); proof != nil {
+		t.Fatalf("non existent forensic proof returned: %v", proof)
+	}
+	WriteForensicProof(db, qcProof, []common.Address{signer1, signer2})
+	WriteForensicProof(db, voteProof, []common.Address{signer2})
+
+	if proof := ReadForensicProof(db, qcProof.Id); proof == nil || *proof != *qcProof {
+		t.Fatalf("forensic proof mismatch: have %v, want %v", proof, qcProof)
+	}
+	if proofs := ReadForensicProofs(db); len(proofs) != 2 {
+		t.Fatalf("forensic proofs count mismatch: have %d, want 2", len(proofs))
+	}
+	if ids := ReadForensicProofIds(db, signer1); len(ids) != 1 || ids[0] != qcProof.Id {
+		t.Fatalf("forensic proof ids of signer1 mismatch: %v", ids)
+	}
+	if ids := ReadForensicProofIds(db, signer2); len(ids) != 2 {
+		t.Fatalf("forensic proof ids of signer2 mismatch: %v", ids)
+	}
+	if ids := ReadForensicProofIds(db, common.HexToAddress("0x3")); len(ids) != 0 {
+		t.Fatalf("forensic proof ids of unknown signer: %v", ids)
+	}
+}
@@ -0,0 +1,81 @@
+package rawdb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/ethdb"
+	"BRDPoSChain/log"
+)
+
+// storedRewards is the subset of the checkpoint rewards needed to index them
+// by address: the signers of the epoch and the holders rewarded per signer.
+type storedRewards struct {
+	Signers map[common.Address]json.RawMessage                    `json:"signers"`
+	Rewards map[common.Address]map[common.Address]json.RawMessage `json:"rewards"`
+}
+
+// ReadRewards retrieves the JSON encoded rewards paid at the given checkpoint block.
+func ReadRewards(db ethdb.KeyValueReader, hash common.Hash, number uint64) []byte {
+	data, _ := db.Get(rewardsKey(number, hash))
+	return data
+}
+
+// HasRewards verifies the existence of the rewards paid at the given checkpoint block.
+func HasRewards(db ethdb.KeyValueReader, hash common.Hash, number uint64) bool {
+	if has, err := db.Has(rewardsKey(number, hash)); !has || err != nil {
+		return false
+	}
+	return true
+}
+
+// WriteRewards stores the JSON encoded rewards paid at the given checkpoint block
+// and indexes the checkpoint by every signer and holder address it rewards.
+func WriteRewards(db ethdb.KeyValueWriter, hash common.Hash, number uint64, data []byte) error {
+	var rewards storedRewards
+	if err := json.Unmarshal(data, &rewards); err != nil {
+		return err
+	}
+	if err := db.Put(rewardsKey(number, hash), data); err != nil {
+		log.Crit("Failed to store rewards", "err", err)
+	}
+	addresses := make(map[common.Address]struct{})
+	for signer := range rewards.Signers {
+		addresses[signer] = struct{}{}
+	}
+	for signer, holders := range rewards.Rewards {
+		addresses[signer] = struct{}{}
+		for holder := range holders {
+			addresses[holder] = struct{}{}
+		}
+	}
+	for addr := range addresses {
+		if err := db.Put(rewardIndexKey(addr, number), nil); err != nil {
+			log.Crit("Failed to store reward index", "err", err)
+		}
+	}
+	return nil
+}
+
+// ReadRewardNumbers retrieves the numbers of the checkpoint blocks in [from, to]
+// rewarding the given address, in ascending order.
+func ReadRewardNumbers(db ethdb.Iteratee, addr common.Address, from, to uint64) []uint64 {
+	prefix := append(append([]byte{}, rewardIndexPrefix...), addr.Bytes()...)
+	it := db.NewIterator(prefix, encodeBlockNumber(from))
+	defer it.Release()
+
+	var numbers []uint64
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(prefix)+8 {
+			continue
+		}
+		number := binary.BigEndian.Uint64(key[len(prefix):])
+		if number > to {
+			break
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers
+}
@@ -0,0 +1,47 @@
+package rawdb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"BRDPoSChain/common"
+)
+
+// Tests that checkpoint rewards can be stored and looked up by address.
+func TestRewardsStorage(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	signer, holder := common.HexToAddress("0x1"), common.HexToAddress("0x2")
+	hash900, hash1800 := common.HexToHash("0x900"), common.HexToHash("0x1800")
+	rewards900 := []byte(`{"signers":{"0x0000000000000000000000000000000000000001":{"sign":3,"reward":100}},"rewards":{"0x0000000000000000000000000000000000000001":{"0x0000000000000000000000000000000000000002":90}}}`)
+	rewards1800 := []byte(`{"signers":{"0x0000000000000000000000000000000000000001":{"sign":2,"reward":50}},"rewards":{}}`)
+
+	if data := ReadRewards(db, hash900, 900); data != nil {
+		t.Fatalf("non existent rewards returned: %s", data)
+	}
+	if err := WriteRewards(db, hash900, 900, []byte("invalid")); err == nil {
+		t.Fatalf("invalid rewards stored")
+	}
+	if err := WriteRewards(db, hash900, 900, rewards900); err != nil {
+		t.Fatalf("failed to store rewards: %v", err)
+	}
+	if err := WriteRewards(db, hash1800, 1800, rewards1800); err != nil {
+		t.Fatalf("failed to store rewards: %v", err)
+	}
+	if data := ReadRewards(db, hash900, 900); !bytes.Equal(data, rewards900) {
+		t.Fatalf("rewards mismatch: have %s, want %s", data, rewards900)
+	}
+	if !HasRewards(db, hash1800, 1800) || HasRewards(db, hash900, 1800) {
+		t.Fatalf("rewards existence mismatch")
+	}
+	if numbers := ReadRewardNumbers(db, signer, 0, 1800); !reflect.DeepEqual(numbers, []uint64{900, 1800}) {
+		t.Fatalf("signer checkpoints mismatch: have %v, want [900 1800]", numbers)
+	}
+	if numbers := ReadRewardNumbers(db, signer, 901, 1799); len(numbers) != 0 {
+		t.Fatalf("signer checkpoints out of range: %v", numbers)
+	}
+	if numbers := ReadRewardNumbers(db, holder, 0, 1800); !reflect.DeepEqual(numbers, []uint64{900}) {
+		t.Fatalf("holder checkpoints mismatch: have %v, want [900]", numbers)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"math/big"
+	"time"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/ethdb"
+	"BRDPoSChain/log"
+)
+
+// txIndexLogInterval is the frequency of progress reports while (un)indexing
+// transactions.
+const txIndexLogInterval = 8 * time.Second
+
+// IndexTransactions creates txlookup indices of the specified block range. The
+// from is included while to is excluded.
+//
+// This function iterates canonical chain in reverse order, so the tx index tail
+// flag can be written periodically even before the whole indexing procedure is
+// finished. An interrupted run is resumed quickly next time.
+//
+// The whole procedure is interrupted if any signal is received on the passed
+// channel.
+func IndexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}) {
+	if from >= to {
+		return
+	}
+	var (
+		batch  = db.NewBatch()
+		start  = time.Now()
+		logged = start
+		txs    int
+		tail   = to
+	)
+	for tail > from {
+		select {
+		case <-interrupt:
+			log.Debug("Transaction indexing interrupted", "blocks", to-tail, "txs", txs, "tail", tail, "elapsed", common.PrettyDuration(time.Since(start)))
+			WriteTxIndexTail(batch, tail)
+			if err := batch.Write(); err != nil {
+				log.Crit("Failed writing batch to db", "error", err)
+			}
+			return
+		default:
+		}
+		number := tail - 1
+		hash := ReadCanonicalHash(db, number)
+		body := ReadBody(db, hash, number)
+		if body == nil {
+			log.Warn("Canonical block body missing, stop indexing", "number", number, "hash", hash)
+			break
+		}
+		for _, tx := range body.Transactions {
+			if err := batch.Put(txLookupKey(tx.Hash()), new(big.Int).SetUint64(number).Bytes()); err != nil {
+				log.Crit("Failed to store transaction lookup entry", "err", err)
+			}
+		}
+		txs += len(body.Transactions)
+		tail = number
+
+		// Flush the batch together with the new tail once it's large enough
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			WriteTxIndexTail(batch, tail)
+			if err := batch.Write(); err != nil {
+				log.Crit("Failed writing batch to db", "error", err)
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > txIndexLogInterval {
+			log.Info("Indexing transactions", "blocks", to-tail, "txs", txs, "tail", tail, "total", to-from, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	WriteTxIndexTail(batch, tail)
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed writing batch to db", "error", err)
+	}
+	log.Info("Indexed transactions", "blocks", to-tail, "txs", txs, "tail", tail, "elapsed", common.PrettyDuration(time.Since(start)))
+}
+
+// UnindexTransactions removes txlookup indices of the specified block range. The
+// from is included while to is excluded.
+//
+// The tail flag is moved forward along the way, so an interrupted run leaves a
+// consistent index behind. The whole procedure is interrupted if any signal is
+// received on the passed channel.
+func UnindexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}) {
+	if from >= to {
+		return
+	}
+	var (
+		batch  = db.NewBatch()
+		start  = time.Now()
+		logged = start
+		txs    int
+		tail   = from
+	)
+	for tail < to {
+		select {
+		case <-interrupt:
+			log.Debug("Transaction unindexing interrupted", "blocks", tail-from, "txs", txs, "tail", tail, "elapsed", common.PrettyDuration(time.Since(start)))
+			WriteTxIndexTail(batch, tail)
+			if err := batch.Write(); err != nil {
+				log.Crit("Failed writing batch to db", "error", err)
+			}
+			return
+		default:
+		}
+		hash := ReadCanonicalHash(db, tail)
+		if body := ReadBody(db, hash, tail); body != nil {
+			for _, tx := range body.Transactions {
+				DeleteTxLookupEntry(batch, tx.Hash())
+			}
+			txs += len(body.Transactions)
+		}
+		tail++
+
+		// Flush the batch together with the new tail once it's large enough
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			WriteTxIndexTail(batch, tail)
+			if err := batch.Write(); err != nil {
+				log.Crit("Failed writing batch to db", "error", err)
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > txIndexLogInterval {
+			log.Info("Unindexing transactions", "blocks", tail-from, "txs", txs, "tail", tail, "total", to-from, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	WriteTxIndexTail(batch, tail)
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed writing batch to db", "error", err)
+	}
+	log.Info("Unindexed transactions", "blocks", tail-from, "txs", txs, "tail", tail, "elapsed", common.PrettyDuration(time.Since(start)))
+}
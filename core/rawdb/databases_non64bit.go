@@ -0,0 +1,37 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+//go:build !((arm64 || amd64) && !openbsd)
+
+package rawdb
+
+import (
+	"errors"
+
+	"BRDPoSChain/ethdb"
+)
+
+// Pebble is unsupported on 32bit architecture
+const PebbleEnabled = false
+
+// errPebbleUnsupported is returned if the pebble engine is requested on a
+// platform it doesn't build on.
+var errPebbleUnsupported = errors.New("pebble is not supported on this platform")
+
+// newPebbleKeyValueStore opens a bare pebble key-value store.
+func newPebbleKeyValueStore(file string, cache int, handles int, namespace string, readonly bool) (ethdb.KeyValueStore, error) {
+	return nil, errPebbleUnsupported
+}
@@ -0,0 +1,134 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"BRDPoSChain/metrics"
+)
+
+// getChunk returns a chunk of data, filled with the given byte.
+func getChunk(size int, b int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(b)
+	}
+	return data
+}
+
+// Tests that items written into a table can be read back after reopening it,
+// also when they are spread over several data files.
+func TestFreezerBasics(t *testing.T) {
+	t.Parallel()
+
+	var (
+		dir   = t.TempDir()
+		rm    = metrics.NewMeter()
+		wm    = metrics.NewMeter()
+		sg    = metrics.NewGauge()
+		fname = fmt.Sprintf("basics-%d", 1)
+	)
+	// Set a max file size of 50 bytes, so every data file holds three 15 byte items
+	f, err := newCustomTable(dir, fname, rm, wm, sg, 50, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 255; x++ {
+		if err := f.Append(uint64(x), getChunk(15, x)); err != nil {
+			t.Fatalf("failed to append item %d: %v", x, err)
+		}
+	}
+	if err := f.Append(300, getChunk(15, 0)); err == nil {
+		t.Fatalf("out of order item appended")
+	}
+	f.Close()
+
+	// Reopen the table and check all items
+	if f, err = newCustomTable(dir, fname, rm, wm, sg, 50, true); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for y := 0; y < 255; y++ {
+		exp := getChunk(15, y)
+		got, err := f.Retrieve(uint64(y))
+		if err != nil {
+			t.Fatalf("failed to retrieve item %d: %v", y, err)
+		}
+		if !bytes.Equal(got, exp) {
+			t.Fatalf("item %d mismatch: have %x, want %x", y, got, exp)
+		}
+	}
+	if _, err := f.Retrieve(255); err != errOutOfBounds {
+		t.Fatalf("out of bounds item retrieved: %v", err)
+	}
+}
+
+// Tests that a truncated table drops the items above the limit, reuses the
+// earlier data files and accepts new items from the truncation point on.
+func TestFreezerTruncate(t *testing.T) {
+	t.Parallel()
+
+	var (
+		dir   = t.TempDir()
+		rm    = metrics.NewMeter()
+		wm    = metrics.NewMeter()
+		sg    = metrics.NewGauge()
+		fname = fmt.Sprintf("truncation-%d", 1)
+	)
+	f, err := newCustomTable(dir, fname, rm, wm, sg, 50, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for x := 0; x < 30; x++ {
+		if err := f.Append(uint64(x), getChunk(15, x)); err != nil {
+			t.Fatalf("failed to append item %d: %v", x, err)
+		}
+	}
+	if err := f.truncate(10); err != nil {
+		t.Fatalf("failed to truncate table: %v", err)
+	}
+	if f.items.Load() != 10 {
+		t.Fatalf("item count mismatch: have %d, want 10", f.items.Load())
+	}
+	if _, err := f.Retrieve(10); err != errOutOfBounds {
+		t.Fatalf("truncated item retrieved: %v", err)
+	}
+	for x := 10; x < 20; x++ {
+		if err := f.Append(uint64(x), getChunk(15, 0xff-x)); err != nil {
+			t.Fatalf("failed to append item %d: %v", x, err)
+		}
+	}
+	for y := 0; y < 20; y++ {
+		exp := getChunk(15, y)
+		if y >= 10 {
+			exp = getChunk(15, 0xff-y)
+		}
+		got, err := f.Retrieve(uint64(y))
+		if err != nil {
+			t.Fatalf("failed to retrieve item %d: %v", y, err)
+		}
+		if !bytes.Equal(got, exp) {
+			t.Fatalf("item %d mismatch: have %x, want %x", y, got, exp)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package rawdb
+
+import (
+	"math/big"
+	"testing"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/ethdb/memorydb"
+)
+
+// Tests that the freezer moves old canonical blocks out of the key-value store
+// and that the chain accessors transparently serve them from the ancients.
+func TestFreezeAncients(t *testing.T) {
+	db, err := NewDatabaseWithFreezer(memorydb.New(), t.TempDir(), "", true)
+	if err != nil {
+		t.Fatalf("failed to create database with freezer: %v", err)
+	}
+	defer db.Close()
+
+	var (
+		parent common.Hash
+		blocks []*types.Block
+	)
+	for i := 0; i < 10; i++ {
+		block := types.NewBlockWithHeader(&types.Header{
+			Number:      big.NewInt(int64(i)),
+			ParentHash:  parent,
+			Extra:       []byte("test block"),
+			UncleHash:   types.EmptyUncleHash,
+			TxHash:      types.EmptyRootHash,
+			ReceiptHash: types.EmptyRootHash,
+		})
+		WriteBlock(db, block)
+		WriteTd(db, block.Hash(), block.NumberU64(), big.NewInt(int64(i+1)))
+		WriteReceipts(db, block.Hash(), block.NumberU64(), nil)
+		WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		WriteHeadBlockHash(db, block.Hash())
+
+		blocks = append(blocks, block)
+		parent = block.Hash()
+	}
+	if err := FreezeAncients(db, 3); err != nil {
+		t.Fatalf("failed to freeze ancients: %v", err)
+	}
+	if frozen, _ := db.Ancients(); frozen != 7 {
+		t.Fatalf("frozen block count mismatch: have %d, want 7", frozen)
+	}
+	for _, block := range blocks {
+		hash, number := block.Hash(), block.NumberU64()
+		if has, _ := db.Has(headerKey(number, hash)); has != (number == 0 || number >= 7) {
+			t.Errorf("block %d key-value presence mismatch: have %v", number, has)
+		}
+		if header := ReadHeader(db, hash, number); header == nil || header.Hash() != hash {
+			t.Errorf("block %d header mismatch: have %v", number, header)
+		}
+		if !HasBody(db, hash, number) || ReadBody(db, hash, number) == nil {
+			t.Errorf("block %d body missing", number)
+		}
+		if !HasReceipts(db, hash, number) || ReadReceiptsRLP(db, hash, number) == nil {
+			t.Errorf("block %d receipts missing", number)
+		}
+		if td := ReadTd(db, hash, number); td == nil || td.Uint64() != number+1 {
+			t.Errorf("block %d total difficulty mismatch: have %v", number, td)
+		}
+		if canon := ReadCanonicalHash(db, number); canon != hash {
+			t.Errorf("block %d canonical hash mismatch: have %x, want %x", number, canon, hash)
+		}
+	}
+}
@@ -0,0 +1,535 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/core/rawdb"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/crypto"
+	"BRDPoSChain/ethdb"
+	"BRDPoSChain/log"
+	"BRDPoSChain/params"
+	"BRDPoSChain/rlp"
+	"BRDPoSChain/trie"
+)
+
+const (
+	// stateBloomFilePrefix is the filename prefix of state bloom filter.
+	stateBloomFilePrefix = "statebloom"
+
+	// stateBloomFileSuffix is the filename suffix of state bloom filter.
+	stateBloomFileSuffix = "bf.gz"
+
+	// stateBloomFileTempSuffix is the filename suffix of state bloom filter
+	// while it is being written out to detect write aborts.
+	stateBloomFileTempSuffix = ".tmp"
+
+	// retainedStates is the number of recent blocks whose state is kept by
+	// default, matching the states a running node keeps in memory.
+	retainedStates = 128
+
+	// pruneLogInterval is the frequency of progress reports while marking and
+	// sweeping.
+	pruneLogInterval = 8 * time.Second
+)
+
+// errNotTrieNode is returned if a root to walk doesn't hold a trie node, like
+// a contract code referenced from an account.
+var errNotTrieNode = errors.New("not a trie node")
+
+// Config includes all the configurations for pruning.
+type Config struct {
+	Datadir   string // The directory of the state bloom filter
+	BloomSize uint64 // The megabytes of memory allocated to the state bloom
+}
+
+// Pruner is an offline tool to prune the stale state trie nodes. It marks all
+// the nodes reachable from the states of the recent blocks, including the BRCx
+// trading and lending states committed by those blocks, in a bloom filter and
+// deletes every other trie node and contract code from the databases.
+//
+// The pruning procedure runs against a closed node only. The state bloom is
+// committed to disk before anything is deleted, so that an interrupted run can
+// be resumed by running the pruner again.
+type Pruner struct {
+	config  Config
+	chainDb ethdb.Database
+	BRCxDb  ethdb.Database // Database of the BRCx trading and lending tries, optional
+	head    *types.Header
+	chain   *params.ChainConfig
+}
+
+// NewPruner creates the pruner instance. The BRCx database might be nil if the
+// node doesn't keep one.
+func NewPruner(chainDb, BRCxDb ethdb.Database, config Config) (*Pruner, error) {
+	headHash := rawdb.ReadHeadBlockHash(chainDb)
+	number := rawdb.ReadHeaderNumber(chainDb, headHash)
+	if number == nil {
+		return nil, errors.New("failed to load head block")
+	}
+	head := rawdb.ReadHeader(chainDb, headHash, *number)
+	if head == nil {
+		return nil, errors.New("failed to load head block")
+	}
+	chain, err := rawdb.ReadChainConfig(chainDb, rawdb.ReadCanonicalHash(chainDb, 0))
+	if err != nil {
+		return nil, err
+	}
+	if config.BloomSize < 256 {
+		log.Warn("Sanitizing bloomfilter size", "provided(MB)", config.BloomSize, "updated(MB)", 256)
+		config.BloomSize = 256
+	}
+	return &Pruner{
+		config:  config,
+		chainDb: chainDb,
+		BRCxDb:  BRCxDb,
+		head:    head,
+		chain:   chain,
+	}, nil
+}
+
+// Prune deletes all the state which is not reachable from the states of the
+// blocks between the given target state and the chain head. If the target is
+// not specified, the state of HEAD-127 is picked, which keeps every state a
+// freshly started node might need.
+//
+// If an unfinished pruning is found on disk, it's resumed instead. A target
+// conflicting with the interrupted one is rejected.
+func (p *Pruner) Prune(root common.Hash) error {
+	bloomPath, bloomRoot, err := findBloomFilter(p.config.Datadir)
+	if err != nil {
+		return err
+	}
+	if bloomPath != "" {
+		if root != (common.Hash{}) && root != bloomRoot {
+			return fmt.Errorf("unfinished pruning of state %x found, rerun without target or with the same one", bloomRoot)
+		}
+		bloom, err := newStateBloomFromDisk(bloomPath)
+		if err != nil {
+			return err
+		}
+		log.Info("Resuming interrupted state pruning", "root", bloomRoot)
+		return p.sweep(bloom, bloomPath)
+	}
+	target, err := p.findTarget(root)
+	if err != nil {
+		return err
+	}
+	bloom, err := newStateBloomWithSize(p.config.BloomSize)
+	if err != nil {
+		return err
+	}
+	if err := p.mark(bloom, target); err != nil {
+		return err
+	}
+	// Persist the bloom so that the deletion can be resumed if it's interrupted
+	bloomPath = bloomFilterName(p.config.Datadir, target.Root)
+	if err := bloom.Commit(bloomPath, bloomPath+stateBloomFileTempSuffix); err != nil {
+		return err
+	}
+	return p.sweep(bloom, bloomPath)
+}
+
+// findTarget resolves the oldest block whose state should be retained.
+func (p *Pruner) findTarget(root common.Hash) (*types.Header, error) {
+	var (
+		number = p.head.Number.Uint64()
+		limit  uint64
+	)
+	if root == (common.Hash{}) {
+		target := uint64(0)
+		if number >= retainedStates {
+			target = number - retainedStates + 1
+		}
+		header := p.canonicalHeader(target)
+		if header == nil {
+			return nil, fmt.Errorf("missing canonical header #%d", target)
+		}
+		return header, nil
+	}
+	// Search the specified state among the recent blocks. Blocks beyond the
+	// immutability threshold are left alone as the node never rewinds there.
+	if number > params.ImmutabilityThreshold {
+		limit = number - params.ImmutabilityThreshold
+	}
+	for n := number; ; n-- {
+		header := p.canonicalHeader(n)
+		if header == nil {
+			return nil, fmt.Errorf("missing canonical header #%d", n)
+		}
+		if header.Root == root {
+			return header, nil
+		}
+		if n == limit {
+			return nil, fmt.Errorf("state %x is not a recent canonical state", root)
+		}
+	}
+}
+
+// canonicalHeader retrieves the canonical header with the given number.
+func (p *Pruner) canonicalHeader(number uint64) *types.Header {
+	hash := rawdb.ReadCanonicalHash(p.chainDb, number)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	return rawdb.ReadHeader(p.chainDb, hash, number)
+}
+
+// retainedBlocks returns the numbers of the blocks whose states should be kept
+// in ascending order.
+func (p *Pruner) retainedBlocks(target *types.Header) []uint64 {
+	var (
+		head    = p.head.Number.Uint64()
+		numbers []uint64
+	)
+	// The masternode list of the upcoming epoch is read from the state of the
+	// gap block, keep it around if it's already passed.
+	if config := p.chain.BRDPoS; config != nil && config.Epoch > config.Gap {
+		checkpoint := head - head%config.Epoch + config.Epoch
+		if gap := checkpoint - config.Gap; gap <= head && gap < target.Number.Uint64() {
+			numbers = append(numbers, gap)
+		}
+	}
+	for n := target.Number.Uint64(); n <= head; n++ {
+		numbers = append(numbers, n)
+	}
+	return numbers
+}
+
+// mark walks the retained states and pushes all the reachable trie nodes and
+// contract codes into the bloom filter.
+func (p *Pruner) mark(bloom *stateBloom, target *types.Header) error {
+	var (
+		chain = newMarker(p.chainDb, bloom)
+		BRCx  *marker
+
+		stateRoot, tradingRoot, lendingRoot common.Hash
+	)
+	if p.BRCxDb != nil {
+		BRCx = newMarker(p.BRCxDb, bloom)
+	}
+	numbers := p.retainedBlocks(target)
+	log.Info("Marking retained states", "blocks", len(numbers), "target", target.Number, "root", target.Root)
+
+	for _, number := range numbers {
+		hash := rawdb.ReadCanonicalHash(p.chainDb, number)
+		block := rawdb.ReadBlock(p.chainDb, hash, number)
+		if block == nil {
+			return fmt.Errorf("missing canonical block #%d", number)
+		}
+		// Consecutive states share most of their nodes, only walk the difference
+		if err := chain.markTrie(stateRoot, block.Root()); err != nil {
+			return fmt.Errorf("state of block #%d is not available: %v", number, err)
+		}
+		stateRoot = block.Root()
+
+		if BRCx == nil {
+			continue
+		}
+		for _, tx := range block.Transactions() {
+			if to := tx.To(); to == nil || *to != common.TradingStateAddrBinary {
+				continue
+			}
+			// The author isn't verified offline, roots committed by anyone else
+			// are just retained on top if they happen to be present.
+			data := tx.Data()
+			if len(data) >= common.HashLength {
+				root := common.BytesToHash(data[:common.HashLength])
+				if err := BRCx.markTrie(tradingRoot, root); err != nil {
+					log.Warn("Trading state is not available", "number", number, "root", root, "err", err)
+				} else {
+					tradingRoot = root
+				}
+			}
+			if len(data) >= 2*common.HashLength {
+				root := common.BytesToHash(data[common.HashLength:])
+				if err := BRCx.markTrie(lendingRoot, root); err != nil {
+					log.Warn("Lending state is not available", "number", number, "root", root, "err", err)
+				} else {
+					lendingRoot = root
+				}
+			}
+		}
+	}
+	log.Info("Marked retained states", "nodes", chain.nodes, "elapsed", common.PrettyDuration(time.Since(chain.start)))
+	if BRCx != nil {
+		log.Info("Marked retained BRCx states", "nodes", BRCx.nodes, "elapsed", common.PrettyDuration(time.Since(BRCx.start)))
+	}
+	return nil
+}
+
+// sweep deletes all the unmarked state entries, drops the state bloom and
+// compacts the databases.
+func (p *Pruner) sweep(bloom *stateBloom, bloomPath string) error {
+	if err := sweepDatabase(p.chainDb, bloom, "chain"); err != nil {
+		return err
+	}
+	if p.BRCxDb != nil {
+		if err := sweepDatabase(p.BRCxDb, bloom, "BRCx"); err != nil {
+			return err
+		}
+	}
+	// Pruning is done, the bloom filter isn't needed for resuming anymore
+	os.RemoveAll(bloomPath)
+
+	compactDatabase(p.chainDb, "chain")
+	if p.BRCxDb != nil {
+		compactDatabase(p.BRCxDb, "BRCx")
+	}
+	return nil
+}
+
+// marker walks tries in a single database and pushes the visited nodes into
+// the state bloom.
+type marker struct {
+	db     ethdb.KeyValueStore
+	triedb *trie.Database
+	bloom  *stateBloom
+
+	nodes  uint64
+	start  time.Time
+	logged time.Time
+}
+
+func newMarker(db ethdb.KeyValueStore, bloom *stateBloom) *marker {
+	return &marker{
+		db:     db,
+		triedb: trie.NewDatabase(db),
+		bloom:  bloom,
+		start:  time.Now(),
+		logged: time.Now(),
+	}
+}
+
+// markTrie marks all the nodes of the trie with the given root which are not
+// present in the trie of the parent root, the latter being already marked.
+//
+// Leaves are scanned for references to further tries (account storage, BRCx
+// order books and the like) and contract codes; any 32 byte string found in a
+// leaf which is present in the database is marked and walked as well. This
+// might retain a few extra entries, but never misses a nested trie no matter
+// which structure the leaf encodes.
+func (m *marker) markTrie(parent, root common.Hash) error {
+	if root == parent || root == types.EmptyRootHash || root == (common.Hash{}) {
+		return nil
+	}
+	// Entries referenced from leaves might be codes or other blobs, which the
+	// trie database refuses to load.
+	if blob, err := m.db.Get(root.Bytes()); err != nil {
+		return err
+	} else if !trie.IsNode(blob) {
+		return errNotTrieNode
+	}
+	tr, err := trie.New(root, m.triedb)
+	if err != nil {
+		return err
+	}
+	var (
+		it  trie.NodeIterator
+		old *trie.Trie
+	)
+	if parent != types.EmptyRootHash && parent != (common.Hash{}) {
+		old, _ = trie.New(parent, m.triedb)
+	}
+	if old != nil {
+		it, _ = trie.NewDifferenceIterator(old.NodeIterator(nil), tr.NodeIterator(nil))
+	} else {
+		it = tr.NodeIterator(nil)
+	}
+	for it.Next(true) {
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			m.bloom.Put(hash.Bytes(), nil)
+			m.nodes++
+		}
+		if it.Leaf() {
+			refs := m.references(it.LeafBlob())
+			if len(refs) == 0 {
+				continue
+			}
+			// Pair the references with the ones of the previous leaf version,
+			// so that nested tries are diffed against their ancestors too.
+			var prev []common.Hash
+			if old != nil {
+				if blob, err := old.TryGet(it.LeafKey()); err == nil && len(blob) > 0 {
+					prev = m.references(blob)
+				}
+			}
+			for i, ref := range refs {
+				m.bloom.Put(ref.Bytes(), nil)
+
+				var base common.Hash
+				if i < len(prev) {
+					base = prev[i]
+				}
+				if err := m.markTrie(base, ref); err != nil && err != errNotTrieNode {
+					log.Debug("Failed to walk nested trie", "root", ref, "err", err)
+				}
+			}
+		}
+		if time.Since(m.logged) > pruneLogInterval {
+			log.Info("Marking retained state", "nodes", m.nodes, "elapsed", common.PrettyDuration(time.Since(m.start)))
+			m.logged = time.Now()
+		}
+	}
+	return it.Error()
+}
+
+// references returns all the 32 byte strings in an RLP encoded leaf which
+// are present in the database.
+func (m *marker) references(blob []byte) []common.Hash {
+	var (
+		refs []common.Hash
+		walk func([]byte)
+	)
+	walk = func(buf []byte) {
+		for len(buf) > 0 {
+			kind, content, rest, err := rlp.Split(buf)
+			if err != nil {
+				return
+			}
+			switch kind {
+			case rlp.List:
+				walk(content)
+			case rlp.String:
+				if len(content) != common.HashLength {
+					break
+				}
+				hash := common.BytesToHash(content)
+				if hash == types.EmptyRootHash || hash == types.EmptyCodeHash {
+					break
+				}
+				if ok, _ := m.db.Has(content); ok {
+					refs = append(refs, hash)
+				}
+			}
+			buf = rest
+		}
+	}
+	walk(blob)
+	return refs
+}
+
+// sweepDatabase deletes all the trie nodes and contract codes not contained
+// in the state bloom. Only entries keyed by the hash of their value are
+// considered, anything else stored under a bare hash is left alone.
+func sweepDatabase(db ethdb.Database, bloom *stateBloom, name string) error {
+	var (
+		count  int
+		size   common.StorageSize
+		start  = time.Now()
+		logged = time.Now()
+		batch  = db.NewBatch()
+		iter   = db.NewIterator(nil, nil)
+	)
+	defer iter.Release()
+
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) != common.HashLength || bloom.Contain(key) {
+			continue
+		}
+		if !bytes.Equal(crypto.Keccak256(iter.Value()), key) {
+			continue
+		}
+		count++
+		size += common.StorageSize(len(key) + len(iter.Value()))
+		batch.Delete(key)
+
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > pruneLogInterval {
+			// Keys are evenly distributed hashes, the first two bytes tell
+			// the progress well enough.
+			done := float64(uint64(key[0])<<8|uint64(key[1])) / 65536 * 100
+			log.Info("Pruning state data", "database", name, "nodes", count, "size", size, "progress", fmt.Sprintf("%.2f%%", done), "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Info("Pruned state data", "database", name, "nodes", count, "size", size, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// compactDatabase compacts the entire key space of the database to reclaim
+// the disk space released by the deletions.
+func compactDatabase(db ethdb.Database, name string) {
+	start := time.Now()
+	log.Info("Compacting database", "database", name)
+	if err := db.Compact(nil, nil); err != nil {
+		log.Error("Database compaction failed", "database", name, "err", err)
+		return
+	}
+	log.Info("Compacted database", "database", name, "elapsed", common.PrettyDuration(time.Since(start)))
+}
+
+// bloomFilterName returns the path of the state bloom for the given target.
+func bloomFilterName(datadir string, root common.Hash) string {
+	return filepath.Join(datadir, fmt.Sprintf("%s.%s.%s", stateBloomFilePrefix, root.Hex(), stateBloomFileSuffix))
+}
+
+// isBloomFilter reports whether the filename is a state bloom and returns
+// the target state root encoded in it.
+func isBloomFilter(filename string) (bool, common.Hash) {
+	filename = filepath.Base(filename)
+	if strings.HasPrefix(filename, stateBloomFilePrefix+".") && strings.HasSuffix(filename, "."+stateBloomFileSuffix) {
+		return true, common.HexToHash(filename[len(stateBloomFilePrefix)+1 : len(filename)-len(stateBloomFileSuffix)-1])
+	}
+	return false, common.Hash{}
+}
+
+// findBloomFilter looks for a committed state bloom left behind by an
+// interrupted pruning.
+func findBloomFilter(datadir string) (string, common.Hash, error) {
+	var (
+		stateBloomPath string
+		stateBloomRoot common.Hash
+	)
+	if err := filepath.Walk(datadir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != datadir && info.IsDir() {
+			return filepath.SkipDir
+		}
+		if ok, root := isBloomFilter(path); !info.IsDir() && ok {
+			stateBloomPath = path
+			stateBloomRoot = root
+		}
+		return nil
+	}); err != nil {
+		return "", common.Hash{}, err
+	}
+	return stateBloomPath, stateBloomRoot, nil
+}
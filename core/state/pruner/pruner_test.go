@@ -0,0 +1,166 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"math/big"
+	"testing"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/consensus/ethash"
+	"BRDPoSChain/core"
+	"BRDPoSChain/core/rawdb"
+	"BRDPoSChain/core/state"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/core/vm"
+	"BRDPoSChain/crypto"
+	"BRDPoSChain/ethdb"
+	"BRDPoSChain/params"
+)
+
+// newTestChain creates an archive chain of the given length where every block
+// sends a value transfer to a fresh account and writes a new storage slot of a
+// contract, so that consecutive states differ both in accounts and storage.
+func newTestChain(t *testing.T, length int) (ethdb.Database, []*types.Block, common.Address) {
+	var (
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address  = crypto.PubkeyToAddress(key.PublicKey)
+		contract = common.HexToAddress("0xc0de")
+		gspec    = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: types.GenesisAlloc{
+				address: {Balance: new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(1000))},
+				// PUSH1 0 CALLDATALOAD DUP1 SSTORE STOP
+				contract: {Balance: big.NewInt(0), Code: common.Hex2Bytes("6000358055")},
+			},
+			BaseFee: big.NewInt(params.InitialBaseFee),
+		}
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = gspec.MustCommit(gendb)
+		signer  = types.LatestSigner(gspec.Config)
+		db      = rawdb.NewMemoryDatabase()
+	)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, length, func(i int, block *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(address), common.BigToAddress(big.NewInt(int64(i+1))), big.NewInt(1000), params.TxGas, big.NewInt(params.InitialBaseFee), nil), signer, key)
+		block.AddTx(tx)
+
+		tx, _ = types.SignTx(types.NewTransaction(block.TxNonce(address), contract, common.Big0, 100000, big.NewInt(params.InitialBaseFee), common.BigToHash(big.NewInt(int64(i+1))).Bytes()), signer, key)
+		block.AddTx(tx)
+	})
+	gspec.MustCommit(db)
+
+	chain, err := core.NewBlockChain(db, &core.CacheConfig{Disabled: true}, gspec.Config, ethash.NewFaker(), vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	chain.Stop()
+	return db, blocks, contract
+}
+
+// checkState iterates over the entire state of the given root, failing if any
+// trie node or contract code is missing.
+func checkState(t *testing.T, db ethdb.Database, root common.Hash) {
+	t.Helper()
+
+	statedb, err := state.New(root, state.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("state %x unavailable: %v", root, err)
+	}
+	it := state.NewNodeIterator(statedb)
+	for it.Next() {
+	}
+	if it.Error != nil {
+		t.Fatalf("state %x is incomplete: %v", root, it.Error)
+	}
+}
+
+// Tests that pruning keeps the recent states intact and deletes the stale ones,
+// leaving the rest of the database alone.
+func TestPruneState(t *testing.T) {
+	db, blocks, contract := newTestChain(t, 200)
+
+	// Store something unrelated under a bare hash, which must survive
+	junk := crypto.Keccak256Hash([]byte("junk"))
+	db.Put(junk.Bytes(), []byte("not a trie node"))
+
+	pruner, err := NewPruner(db, nil, Config{Datadir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to create pruner: %v", err)
+	}
+	if err := pruner.Prune(common.Hash{}); err != nil {
+		t.Fatalf("failed to prune state: %v", err)
+	}
+	for _, block := range blocks[len(blocks)-retainedStates:] {
+		checkState(t, db, block.Root())
+	}
+	// The storage written by the head block must be readable
+	statedb, _ := state.New(blocks[len(blocks)-1].Root(), state.NewDatabase(db))
+	slot := common.BigToHash(big.NewInt(int64(len(blocks))))
+	if have := statedb.GetState(contract, slot); have != slot {
+		t.Fatalf("storage slot mismatch: have %x, want %x", have, slot)
+	}
+	for _, block := range blocks[:len(blocks)-retainedStates] {
+		if ok, _ := db.Has(block.Root().Bytes()); ok {
+			t.Fatalf("stale state of block #%d not pruned", block.NumberU64())
+		}
+	}
+	if ok, _ := db.Has(junk.Bytes()); !ok {
+		t.Fatalf("unrelated entry deleted")
+	}
+}
+
+// Tests that an interrupted pruning is resumed from the state bloom left on
+// disk, and that a conflicting target is refused meanwhile.
+func TestPruneStateResume(t *testing.T) {
+	var (
+		db, blocks, _ = newTestChain(t, 200)
+		datadir       = t.TempDir()
+	)
+	pruner, err := NewPruner(db, nil, Config{Datadir: datadir})
+	if err != nil {
+		t.Fatalf("failed to create pruner: %v", err)
+	}
+	// Mark the states and commit the bloom, as if the sweep crashed afterwards
+	target := blocks[len(blocks)-retainedStates].Header()
+	bloom, err := newStateBloomWithSize(pruner.config.BloomSize)
+	if err != nil {
+		t.Fatalf("failed to create bloom: %v", err)
+	}
+	if err := pruner.mark(bloom, target); err != nil {
+		t.Fatalf("failed to mark states: %v", err)
+	}
+	path := bloomFilterName(datadir, target.Root)
+	if err := bloom.Commit(path, path+stateBloomFileTempSuffix); err != nil {
+		t.Fatalf("failed to commit bloom: %v", err)
+	}
+	if err := pruner.Prune(blocks[len(blocks)-1].Root()); err == nil {
+		t.Fatalf("conflicting target accepted")
+	}
+	if err := pruner.Prune(common.Hash{}); err != nil {
+		t.Fatalf("failed to resume pruning: %v", err)
+	}
+	if found, _, _ := findBloomFilter(datadir); found != "" {
+		t.Fatalf("state bloom left behind: %s", found)
+	}
+	checkState(t, db, blocks[len(blocks)-1].Root())
+	if ok, _ := db.Has(blocks[0].Root().Bytes()); ok {
+		t.Fatalf("stale state not pruned")
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"time"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/core/rawdb"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/ethdb"
+	"BRDPoSChain/log"
+	"BRDPoSChain/rlp"
+	"BRDPoSChain/trie"
+	"github.com/VictoriaMetrics/fastcache"
+)
+
+// generatorLogInterval is the time interval between two generation progress
+// reports.
+const generatorLogInterval = 8 * time.Second
+
+// journalGenerator is a disk layer entry containing the generator progress marker.
+type journalGenerator struct {
+	Done   bool   // Whether the generator finished creating the snapshot
+	Marker []byte // Last account hash fully covered by the generator
+}
+
+// generateSnapshot regenerates a brand new snapshot based on an existing state
+// database and head block asynchronously. The snapshot is returned immediately
+// and generation is continued in the background until done.
+func generateSnapshot(diskdb ethdb.KeyValueStore, triedb *trie.Database, cache int, root common.Hash) *diskLayer {
+	// Create a new disk layer with an initialized state marker at zero
+	batch := diskdb.NewBatch()
+
+	rawdb.WriteSnapshotRoot(batch, root)
+	journalProgress(batch, []byte{})
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to write initialized state marker", "err", err)
+	}
+	base := &diskLayer{
+		diskdb:     diskdb,
+		triedb:     triedb,
+		root:       root,
+		cache:      fastcache.New(cache * 1024 * 1024),
+		genMarker:  []byte{}, // Initialized but empty!
+		genPending: make(chan struct{}),
+		genAbort:   make(chan chan struct{}),
+	}
+	go base.generate()
+	log.Debug("Start snapshot generation", "root", root)
+	return base
+}
+
+// journalProgress persists the generator stats into the database to resume later.
+func journalProgress(db ethdb.KeyValueWriter, marker []byte) {
+	entry := journalGenerator{
+		Done:   marker == nil,
+		Marker: marker,
+	}
+	blob, err := rlp.EncodeToBytes(entry)
+	if err != nil {
+		panic(err) // Cannot happen, here to catch dev errors
+	}
+	rawdb.WriteSnapshotGenerator(db, blob)
+}
+
+// generate is a background thread that iterates over the state and storage tries,
+// constructing the state snapshot. The method surfs the blocks as they arrive,
+// often being aborted and restarted on a newer disk layer from the last marker.
+func (dl *diskLayer) generate() {
+	dl.lock.RLock()
+	accMarker := dl.genMarker
+	dl.lock.RUnlock()
+
+	var (
+		batch   = dl.diskdb.NewBatch()
+		start   = time.Now()
+		logged  = time.Now()
+		aborted chan struct{}
+
+		accounts, slots uint64
+	)
+	// checkAbort reports whether generation was requested to be aborted. It's
+	// non-blocking, the request is remembered to be answered later.
+	checkAbort := func() bool {
+		select {
+		case aborted = <-dl.genAbort:
+			return true
+		default:
+			return false
+		}
+	}
+	// waitAbort blocks until generation is aborted, used when there's nothing
+	// more to do.
+	waitAbort := func() {
+		if aborted == nil {
+			aborted = <-dl.genAbort
+		}
+		aborted <- struct{}{}
+	}
+	// Wipe any leftover of a previous snapshot when starting from scratch
+	if len(accMarker) == 0 {
+		for _, prefix := range []struct {
+			prefix []byte
+			length int
+		}{{rawdb.SnapshotAccountPrefix, accountKeyLength}, {rawdb.SnapshotStoragePrefix, storageKeyLength}} {
+			it := dl.diskdb.NewIterator(prefix.prefix, nil)
+			for it.Next() {
+				if key := it.Key(); len(key) == prefix.length {
+					batch.Delete(key)
+				}
+				if batch.ValueSize() > ethdb.IdealBatchSize {
+					if err := batch.Write(); err != nil {
+						log.Crit("Failed to wipe snapshot", "err", err)
+					}
+					batch.Reset()
+				}
+			}
+			it.Release()
+		}
+		if err := batch.Write(); err != nil {
+			log.Crit("Failed to wipe snapshot", "err", err)
+		}
+		batch.Reset()
+		dl.cache.Reset()
+	}
+	// Iterate the account trie from the last marker on
+	accTrie, err := trie.New(dl.root, dl.triedb)
+	if err != nil {
+		// The account trie is missing (GC), surf the chain until one becomes available
+		log.Info("Snapshot generator waiting for state", "root", dl.root, "err", err)
+		waitAbort()
+		return
+	}
+	// persist flushes the generated data and advances the marker to the last
+	// fully generated account.
+	persist := func(marker []byte) {
+		journalProgress(batch, marker)
+		if err := batch.Write(); err != nil {
+			log.Crit("Failed to write generated snapshot", "err", err)
+		}
+		batch.Reset()
+
+		dl.lock.Lock()
+		dl.genMarker = marker
+		dl.lock.Unlock()
+	}
+	accIt := trie.NewIterator(accTrie.NodeIterator(accMarker))
+	for accIt.Next() {
+		// Skip the account covered already by the marker
+		if len(accMarker) > 0 && bytes.Equal(accIt.Key, accMarker) {
+			continue
+		}
+		accountHash := common.BytesToHash(accIt.Key)
+
+		// Drop any leftover storage of an interrupted run before regenerating
+		it := rawdb.IterateStorageSnapshots(dl.diskdb, accountHash)
+		for it.Next() {
+			if key := it.Key(); len(key) == storageKeyLength {
+				batch.Delete(key)
+			}
+		}
+		it.Release()
+
+		var acc Account
+		if err := rlp.DecodeBytes(accIt.Value, &acc); err != nil {
+			log.Crit("Invalid account encountered during snapshot creation", "err", err)
+		}
+		rawdb.WriteAccountSnapshot(batch, accountHash, accIt.Value)
+		accounts++
+
+		// If the account has storage, generate all the slots too
+		if acc.Root != types.EmptyRootHash {
+			storeTrie, err := trie.New(acc.Root, dl.triedb)
+			if err != nil {
+				log.Info("Snapshot generator waiting for storage", "root", dl.root, "account", accountHash, "err", err)
+				waitAbort()
+				return
+			}
+			storeIt := trie.NewIterator(storeTrie.NodeIterator(nil))
+			for storeIt.Next() {
+				rawdb.WriteStorageSnapshot(batch, accountHash, common.BytesToHash(storeIt.Key), storeIt.Value)
+				slots++
+
+				// Large storage tries are flushed midway, the marker is not moved
+				// forward though until the whole account is done
+				if batch.ValueSize() > ethdb.IdealBatchSize {
+					if err := batch.Write(); err != nil {
+						log.Crit("Failed to write generated snapshot", "err", err)
+					}
+					batch.Reset()
+				}
+			}
+			if storeIt.Err != nil {
+				log.Info("Snapshot generator waiting for storage", "root", dl.root, "account", accountHash, "err", storeIt.Err)
+				waitAbort()
+				return
+			}
+		}
+		accMarker = accountHash[:]
+
+		// Persist the progress if the batch grew large enough or if the generator
+		// was requested to be aborted
+		if batch.ValueSize() > ethdb.IdealBatchSize || checkAbort() {
+			persist(accMarker)
+			if aborted != nil {
+				aborted <- struct{}{}
+				return
+			}
+		}
+		if time.Since(logged) > generatorLogInterval {
+			log.Info("Generating state snapshot", "root", dl.root, "at", accountHash, "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if accIt.Err != nil {
+		// Persist whatever was finished before the trie turned out incomplete
+		persist(accMarker)
+		log.Info("Snapshot generator waiting for state", "root", dl.root, "err", accIt.Err)
+		waitAbort()
+		return
+	}
+	// Snapshot fully generated, set the marker to nil
+	persist(nil)
+
+	log.Info("Generated state snapshot", "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+
+	dl.lock.Lock()
+	close(dl.genPending)
+	dl.lock.Unlock()
+
+	// Someone will be looking for us, wait it out
+	waitAbort()
+}
@@ -0,0 +1,255 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/core/rawdb"
+	"BRDPoSChain/ethdb"
+	"BRDPoSChain/log"
+	"BRDPoSChain/rlp"
+	"BRDPoSChain/trie"
+	"github.com/VictoriaMetrics/fastcache"
+)
+
+// journalVersion is the version of the diff layer journal. Journals of other
+// versions are discarded on startup.
+const journalVersion uint64 = 0
+
+// journalDestruct is an account deletion entry in a diffLayer's disk journal.
+type journalDestruct struct {
+	Hash common.Hash
+}
+
+// journalAccount is an account entry in a diffLayer's disk journal.
+type journalAccount struct {
+	Hash common.Hash
+	Blob []byte
+}
+
+// journalStorage is an account's storage map in a diffLayer's disk journal.
+type journalStorage struct {
+	Hash common.Hash
+	Keys []common.Hash
+	Vals [][]byte
+}
+
+// encodeJournalVersion writes the journal version as the first journal entry.
+func encodeJournalVersion(w io.Writer) error {
+	return rlp.Encode(w, journalVersion)
+}
+
+// loadSnapshot loads a pre-existing state snapshot backed by a key-value store.
+func loadSnapshot(diskdb ethdb.KeyValueStore, triedb *trie.Database, cache int, root common.Hash) (snapshot, error) {
+	// Retrieve the block number and hash of the snapshot, failing if no snapshot
+	// is present in the database (or crashed mid-update).
+	baseRoot := rawdb.ReadSnapshotRoot(diskdb)
+	if baseRoot == (common.Hash{}) {
+		return nil, errors.New("missing or corrupted snapshot")
+	}
+	base := &diskLayer{
+		diskdb: diskdb,
+		triedb: triedb,
+		cache:  fastcache.New(cache * 1024 * 1024),
+		root:   baseRoot,
+	}
+	// Retrieve the generator progress of the disk layer
+	blob := rawdb.ReadSnapshotGenerator(diskdb)
+	if len(blob) == 0 {
+		return nil, errors.New("missing snapshot generator")
+	}
+	var generator journalGenerator
+	if err := rlp.DecodeBytes(blob, &generator); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot generator: %v", err)
+	}
+	if !generator.Done {
+		base.genMarker = append([]byte{}, generator.Marker...)
+	}
+	// Load all the snapshot diffs from the journal. A broken journal only loses
+	// the diff layers, the disk layer may still match the requested head.
+	snapshot, err := loadDiffLayers(diskdb, base)
+	if err != nil {
+		log.Warn("Failed to load snapshot journal, discarding diffs", "err", err)
+		snapshot = base
+	}
+	// Entire snapshot journal loaded, sanity check the head and return
+	if head := snapshot.Root(); head != root {
+		return nil, fmt.Errorf("head doesn't match snapshot: have %#x, want %#x", head, root)
+	}
+	// Everything loaded correctly, resume any suspended operations
+	if base.genMarker != nil {
+		base.genPending = make(chan struct{})
+		base.genAbort = make(chan chan struct{})
+		go base.generate()
+	}
+	log.Info("Loaded snapshot", "root", root, "disk", baseRoot, "generating", base.genMarker != nil)
+	return snapshot, nil
+}
+
+// loadDiffLayers loads the diff layers journalled on top of the disk layer. A
+// missing journal is not an error, the disk layer is the head then.
+func loadDiffLayers(db ethdb.KeyValueReader, base *diskLayer) (snapshot, error) {
+	journal := rawdb.ReadSnapshotJournal(db)
+	if len(journal) == 0 {
+		return base, nil
+	}
+	r := rlp.NewStream(bytes.NewReader(journal), 0)
+
+	// Firstly, resolve the journal version and the disk layer root
+	var version uint64
+	if err := r.Decode(&version); err != nil {
+		return nil, fmt.Errorf("failed to decode journal version: %v", err)
+	}
+	if version != journalVersion {
+		return nil, fmt.Errorf("journal version mismatch: have %d, want %d", version, journalVersion)
+	}
+	var root common.Hash
+	if err := r.Decode(&root); err != nil {
+		return nil, fmt.Errorf("failed to decode disk layer root: %v", err)
+	}
+	if root != base.root {
+		return nil, fmt.Errorf("journal disk layer mismatch: have %#x, want %#x", root, base.root)
+	}
+	// Load the diff layers bottom-up
+	var parent snapshot = base
+	for {
+		var root common.Hash
+		if err := r.Decode(&root); err != nil {
+			// The first read may fail with EOF, marking the end of the journal
+			if err == io.EOF {
+				return parent, nil
+			}
+			return nil, fmt.Errorf("failed to decode diff layer root: %v", err)
+		}
+		var destructs []journalDestruct
+		if err := r.Decode(&destructs); err != nil {
+			return nil, fmt.Errorf("failed to decode destructs: %v", err)
+		}
+		destructSet := make(map[common.Hash]struct{})
+		for _, entry := range destructs {
+			destructSet[entry.Hash] = struct{}{}
+		}
+		var accounts []journalAccount
+		if err := r.Decode(&accounts); err != nil {
+			return nil, fmt.Errorf("failed to decode accounts: %v", err)
+		}
+		accountData := make(map[common.Hash][]byte)
+		for _, entry := range accounts {
+			if len(entry.Blob) > 0 { // RLP loses nil-ness, but `[]byte{}` is not a valid item, so reinterpret that
+				accountData[entry.Hash] = entry.Blob
+			} else {
+				accountData[entry.Hash] = nil
+			}
+		}
+		var storage []journalStorage
+		if err := r.Decode(&storage); err != nil {
+			return nil, fmt.Errorf("failed to decode storage: %v", err)
+		}
+		storageData := make(map[common.Hash]map[common.Hash][]byte)
+		for _, entry := range storage {
+			if len(entry.Keys) != len(entry.Vals) {
+				return nil, fmt.Errorf("storage key/value count mismatch: %d != %d", len(entry.Keys), len(entry.Vals))
+			}
+			slots := make(map[common.Hash][]byte)
+			for i, key := range entry.Keys {
+				if len(entry.Vals[i]) > 0 { // RLP loses nil-ness, but `[]byte{}` is not a valid item, so reinterpret that
+					slots[key] = entry.Vals[i]
+				} else {
+					slots[key] = nil
+				}
+			}
+			storageData[entry.Hash] = slots
+		}
+		parent = newDiffLayer(parent, root, destructSet, accountData, storageData)
+	}
+}
+
+// Journal terminates any in-progress snapshot generation and writes the disk
+// layer root into the journal buffer. The generator progress is persisted into
+// the database, to be resumed on the next startup.
+func (dl *diskLayer) Journal(buffer *bytes.Buffer) (common.Hash, error) {
+	// If the snapshot is currently being generated, abort it
+	dl.abortGeneration()
+
+	// Ensure the layer didn't get stale
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return common.Hash{}, ErrSnapshotStale
+	}
+	if err := rlp.Encode(buffer, dl.root); err != nil {
+		return common.Hash{}, err
+	}
+	log.Debug("Journalled disk layer", "root", dl.root)
+	return dl.root, nil
+}
+
+// Journal writes the memory layer contents into a buffer to be stored in the
+// database as the snapshot journal.
+func (dl *diffLayer) Journal(buffer *bytes.Buffer) (common.Hash, error) {
+	// Journal the parent first
+	base, err := dl.Parent().Journal(buffer)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	// Ensure the layer didn't get stale
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return common.Hash{}, ErrSnapshotStale
+	}
+	// Everything below was journalled, persist this layer too
+	if err := rlp.Encode(buffer, dl.root); err != nil {
+		return common.Hash{}, err
+	}
+	destructs := make([]journalDestruct, 0, len(dl.destructSet))
+	for hash := range dl.destructSet {
+		destructs = append(destructs, journalDestruct{Hash: hash})
+	}
+	if err := rlp.Encode(buffer, destructs); err != nil {
+		return common.Hash{}, err
+	}
+	accounts := make([]journalAccount, 0, len(dl.accountData))
+	for hash, blob := range dl.accountData {
+		accounts = append(accounts, journalAccount{Hash: hash, Blob: blob})
+	}
+	if err := rlp.Encode(buffer, accounts); err != nil {
+		return common.Hash{}, err
+	}
+	storage := make([]journalStorage, 0, len(dl.storageData))
+	for hash, slots := range dl.storageData {
+		keys := make([]common.Hash, 0, len(slots))
+		vals := make([][]byte, 0, len(slots))
+		for key, val := range slots {
+			keys = append(keys, key)
+			vals = append(vals, val)
+		}
+		storage = append(storage, journalStorage{Hash: hash, Keys: keys, Vals: vals})
+	}
+	if err := rlp.Encode(buffer, storage); err != nil {
+		return common.Hash{}, err
+	}
+	log.Debug("Journalled diff layer", "root", dl.root, "parent", dl.parent.Root())
+	return base, nil
+}
@@ -0,0 +1,257 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/core/rawdb"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/crypto"
+	"BRDPoSChain/ethdb"
+	"BRDPoSChain/rlp"
+	"BRDPoSChain/trie"
+	"github.com/VictoriaMetrics/fastcache"
+)
+
+// testAccount generates an encoded account with the given balance.
+func testAccount(balance int64) []byte {
+	blob, _ := rlp.EncodeToBytes(Account{
+		Balance:  big.NewInt(balance),
+		Root:     types.EmptyRootHash,
+		CodeHash: types.EmptyCodeHash.Bytes(),
+	})
+	return blob
+}
+
+// newTestTree creates a snapshot tree with a single, fully generated disk layer
+// on top of the given database.
+func newTestTree(db ethdb.KeyValueStore, root common.Hash) *Tree {
+	rawdb.WriteSnapshotRoot(db, root)
+	journalProgress(db, nil)
+
+	base := &diskLayer{
+		diskdb: db,
+		root:   root,
+		cache:  fastcache.New(1024 * 500),
+	}
+	return &Tree{
+		diskdb: db,
+		layers: map[common.Hash]snapshot{root: base},
+	}
+}
+
+// Tests that reads are resolved from the topmost layer knowing about an item,
+// honouring the deletions of the layers in between.
+func TestDiffLayerReads(t *testing.T) {
+	var (
+		db    = rawdb.NewMemoryDatabase()
+		acc1  = common.HexToHash("0x01")
+		acc2  = common.HexToHash("0x02")
+		slot1 = common.HexToHash("0x11")
+		slot2 = common.HexToHash("0x12")
+	)
+	rawdb.WriteAccountSnapshot(db, acc1, testAccount(1))
+	rawdb.WriteAccountSnapshot(db, acc2, testAccount(2))
+	rawdb.WriteStorageSnapshot(db, acc1, slot1, []byte{0x01})
+	rawdb.WriteStorageSnapshot(db, acc1, slot2, []byte{0x02})
+
+	snaps := newTestTree(db, common.HexToHash("0xff00"))
+
+	// Update a slot of the first account and destruct the second one
+	if err := snaps.Update(common.HexToHash("0xff01"), common.HexToHash("0xff00"), map[common.Hash]struct{}{acc2: {}}, nil, map[common.Hash]map[common.Hash][]byte{acc1: {slot1: []byte{0x03}}}); err != nil {
+		t.Fatalf("failed to create diff layer: %v", err)
+	}
+	// Resurrect the second account and delete a slot of the first one
+	if err := snaps.Update(common.HexToHash("0xff02"), common.HexToHash("0xff01"), nil, map[common.Hash][]byte{acc2: testAccount(3)}, map[common.Hash]map[common.Hash][]byte{acc1: {slot2: nil}}); err != nil {
+		t.Fatalf("failed to create diff layer: %v", err)
+	}
+	snap := snaps.Snapshot(common.HexToHash("0xff02"))
+
+	if acc, err := snap.Account(acc1); err != nil || acc.Balance.Int64() != 1 {
+		t.Errorf("account 1 mismatch: have %v, err %v", acc, err)
+	}
+	if acc, err := snap.Account(acc2); err != nil || acc.Balance.Int64() != 3 {
+		t.Errorf("account 2 mismatch: have %v, err %v", acc, err)
+	}
+	if blob, err := snap.Storage(acc1, slot1); err != nil || !bytes.Equal(blob, []byte{0x03}) {
+		t.Errorf("slot 1 mismatch: have %x, err %v", blob, err)
+	}
+	if blob, err := snap.Storage(acc1, slot2); err != nil || len(blob) != 0 {
+		t.Errorf("slot 2 mismatch: have %x, err %v", blob, err)
+	}
+	// The middle layer must see the second account deleted
+	if acc, err := snaps.Snapshot(common.HexToHash("0xff01")).Account(acc2); err != nil || acc != nil {
+		t.Errorf("destructed account mismatch: have %v, err %v", acc, err)
+	}
+	// Self loops must be rejected
+	if err := snaps.Update(common.HexToHash("0xff02"), common.HexToHash("0xff02"), nil, nil, nil); err != errSnapshotCycle {
+		t.Errorf("cycle error mismatch: have %v, want %v", err, errSnapshotCycle)
+	}
+}
+
+// Tests that capping the tree flattens the bottom diff layers into the disk
+// and drops the layers of the abandoned forks.
+func TestCap(t *testing.T) {
+	var (
+		db   = rawdb.NewMemoryDatabase()
+		acc1 = common.HexToHash("0x01")
+		acc2 = common.HexToHash("0x02")
+		slot = common.HexToHash("0x11")
+	)
+	rawdb.WriteAccountSnapshot(db, acc1, testAccount(1))
+	rawdb.WriteAccountSnapshot(db, acc2, testAccount(2))
+	rawdb.WriteStorageSnapshot(db, acc2, slot, []byte{0x01})
+
+	snaps := newTestTree(db, common.HexToHash("0xff00"))
+	base := snaps.Snapshot(common.HexToHash("0xff00"))
+
+	snaps.Update(common.HexToHash("0xff01"), common.HexToHash("0xff00"), nil, map[common.Hash][]byte{acc1: testAccount(10)}, nil)
+	snaps.Update(common.HexToHash("0xff02"), common.HexToHash("0xff01"), map[common.Hash]struct{}{acc2: {}}, nil, nil)
+	snaps.Update(common.HexToHash("0xff03"), common.HexToHash("0xff02"), nil, map[common.Hash][]byte{acc1: testAccount(30)}, nil)
+
+	// Fork off the first layer, this branch must be dropped by the cap
+	snaps.Update(common.HexToHash("0xee02"), common.HexToHash("0xff01"), nil, map[common.Hash][]byte{acc1: testAccount(20)}, nil)
+	fork := snaps.Snapshot(common.HexToHash("0xee02"))
+
+	if err := snaps.Cap(common.HexToHash("0xff03"), 1); err != nil {
+		t.Fatalf("failed to cap snapshot tree: %v", err)
+	}
+	if n := len(snaps.layers); n != 2 {
+		t.Fatalf("layer count mismatch: have %d, want %d", n, 2)
+	}
+	if root := rawdb.ReadSnapshotRoot(db); root != common.HexToHash("0xff02") {
+		t.Fatalf("disk root mismatch: have %x, want %x", root, common.HexToHash("0xff02"))
+	}
+	if blob := rawdb.ReadAccountSnapshot(db, acc1); !bytes.Equal(blob, testAccount(10)) {
+		t.Errorf("flattened account mismatch: have %x, want %x", blob, testAccount(10))
+	}
+	if blob := rawdb.ReadAccountSnapshot(db, acc2); len(blob) != 0 {
+		t.Errorf("destructed account not deleted: %x", blob)
+	}
+	if blob := rawdb.ReadStorageSnapshot(db, acc2, slot); len(blob) != 0 {
+		t.Errorf("destructed storage not deleted: %x", blob)
+	}
+	if acc, err := snaps.Snapshot(common.HexToHash("0xff03")).Account(acc1); err != nil || acc.Balance.Int64() != 30 {
+		t.Errorf("head account mismatch: have %v, err %v", acc, err)
+	}
+	// The old disk layer and the fork must be unusable
+	if _, err := base.Account(acc1); err != ErrSnapshotStale {
+		t.Errorf("stale disk layer error mismatch: have %v, want %v", err, ErrSnapshotStale)
+	}
+	if _, err := fork.Account(acc1); err != ErrSnapshotStale {
+		t.Errorf("dropped fork error mismatch: have %v, want %v", err, ErrSnapshotStale)
+	}
+}
+
+// Tests that the diff layers survive a journal round trip.
+func TestJournal(t *testing.T) {
+	var (
+		db   = rawdb.NewMemoryDatabase()
+		acc1 = common.HexToHash("0x01")
+		acc2 = common.HexToHash("0x02")
+		slot = common.HexToHash("0x11")
+	)
+	rawdb.WriteAccountSnapshot(db, acc1, testAccount(1))
+	rawdb.WriteAccountSnapshot(db, acc2, testAccount(2))
+
+	snaps := newTestTree(db, common.HexToHash("0xff00"))
+	snaps.Update(common.HexToHash("0xff01"), common.HexToHash("0xff00"), map[common.Hash]struct{}{acc2: {}}, map[common.Hash][]byte{acc1: testAccount(10)}, map[common.Hash]map[common.Hash][]byte{acc1: {slot: []byte{0x01}}})
+	snaps.Update(common.HexToHash("0xff02"), common.HexToHash("0xff01"), nil, nil, map[common.Hash]map[common.Hash][]byte{acc1: {slot: nil}})
+
+	base, err := snaps.Journal(common.HexToHash("0xff02"))
+	if err != nil {
+		t.Fatalf("failed to journal snapshot: %v", err)
+	}
+	if base != common.HexToHash("0xff00") {
+		t.Fatalf("journal base mismatch: have %x, want %x", base, common.HexToHash("0xff00"))
+	}
+	loaded, err := New(db, trie.NewDatabase(db), 1, common.HexToHash("0xff02"), false, false)
+	if err != nil {
+		t.Fatalf("failed to load snapshot: %v", err)
+	}
+	if n := len(loaded.layers); n != 3 {
+		t.Fatalf("layer count mismatch: have %d, want %d", n, 3)
+	}
+	mid, head := loaded.Snapshot(common.HexToHash("0xff01")), loaded.Snapshot(common.HexToHash("0xff02"))
+	if acc, err := head.Account(acc1); err != nil || acc.Balance.Int64() != 10 {
+		t.Errorf("account mismatch: have %v, err %v", acc, err)
+	}
+	if acc, err := head.Account(acc2); err != nil || acc != nil {
+		t.Errorf("destructed account mismatch: have %v, err %v", acc, err)
+	}
+	if blob, err := mid.Storage(acc1, slot); err != nil || !bytes.Equal(blob, []byte{0x01}) {
+		t.Errorf("slot mismatch: have %x, err %v", blob, err)
+	}
+	if blob, err := head.Storage(acc1, slot); err != nil || len(blob) != 0 {
+		t.Errorf("deleted slot mismatch: have %x, err %v", blob, err)
+	}
+	// A snapshot of a different head must be refused
+	if _, err := New(db, trie.NewDatabase(db), 1, common.HexToHash("0xff01"), false, false); err == nil {
+		t.Fatalf("mismatching head accepted")
+	}
+}
+
+// Tests that a snapshot generated from the state tries matches them, and that
+// the verification catches any deviation.
+func TestGeneration(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		triedb = trie.NewDatabase(db)
+	)
+	// Create a state with a few accounts, one of them with storage
+	storage, _ := trie.NewSecure(common.Hash{}, triedb)
+	for i := byte(1); i <= 10; i++ {
+		storage.Update([]byte{i}, []byte{i})
+	}
+	storageRoot, _ := storage.Commit(nil)
+
+	accounts, _ := trie.NewSecure(common.Hash{}, triedb)
+	for i := byte(1); i <= 20; i++ {
+		acc := Account{Balance: big.NewInt(int64(i)), Root: types.EmptyRootHash, CodeHash: types.EmptyCodeHash.Bytes()}
+		if i == 1 {
+			acc.Root = storageRoot
+		}
+		blob, _ := rlp.EncodeToBytes(acc)
+		accounts.Update([]byte{i}, blob)
+	}
+	root, _ := accounts.Commit(nil)
+	triedb.Commit(root, false)
+
+	// Leave some junk behind which must be wiped by the generator
+	junk := common.HexToHash("0xdead")
+	rawdb.WriteAccountSnapshot(db, junk, testAccount(1))
+
+	snaps, err := New(db, triedb, 1, root, false, true)
+	if err != nil {
+		t.Fatalf("failed to generate snapshot: %v", err)
+	}
+	if blob := rawdb.ReadAccountSnapshot(db, junk); len(blob) != 0 {
+		t.Fatalf("junk account survived generation")
+	}
+	if err := snaps.Verify(root); err != nil {
+		t.Fatalf("failed to verify generated snapshot: %v", err)
+	}
+	// Corrupt a storage slot, verification must fail
+	rawdb.WriteStorageSnapshot(db, crypto.Keccak256Hash([]byte{1}), crypto.Keccak256Hash([]byte{1}), []byte{0xff})
+	if err := snaps.Verify(root); err == nil {
+		t.Fatalf("corrupted snapshot verified")
+	}
+}
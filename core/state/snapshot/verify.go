@@ -0,0 +1,276 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/core/rawdb"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/ethdb"
+	"BRDPoSChain/log"
+	"BRDPoSChain/rlp"
+	"BRDPoSChain/trie"
+)
+
+// flatIterator walks the flat entries of a snapshot in ascending hash order,
+// overlaying the flattened diff layers on top of the disk layer content.
+type flatIterator struct {
+	disk    ethdb.Iterator // Disk layer iterator, nil if the disk content is ignored
+	keyLen  int            // Length of the disk keys to consider
+	diskKey common.Hash    // Current hash of the disk iterator
+	diskVal []byte         // Current value of the disk iterator
+	diskOk  bool           // Whether the disk iterator has a current entry
+
+	keys []common.Hash          // Sorted hashes of the overlaid entries
+	vals map[common.Hash][]byte // Overlaid entries, nil meaning deleted
+
+	Hash  common.Hash // Hash of the current entry
+	Value []byte      // Value of the current entry
+}
+
+// newFlatIterator creates an iterator merging the disk entries with the given
+// overlay.
+func newFlatIterator(disk ethdb.Iterator, keyLen int, overlay map[common.Hash][]byte) *flatIterator {
+	it := &flatIterator{
+		disk:   disk,
+		keyLen: keyLen,
+		vals:   overlay,
+	}
+	for hash := range overlay {
+		it.keys = append(it.keys, hash)
+	}
+	sort.Slice(it.keys, func(i, j int) bool { return bytes.Compare(it.keys[i][:], it.keys[j][:]) < 0 })
+	it.nextDisk()
+	return it
+}
+
+// nextDisk moves the disk iterator to the next entry with a valid key length.
+func (it *flatIterator) nextDisk() {
+	it.diskOk = false
+	if it.disk == nil {
+		return
+	}
+	for it.disk.Next() {
+		if key := it.disk.Key(); len(key) == it.keyLen {
+			it.diskKey = common.BytesToHash(key[len(key)-common.HashLength:])
+			it.diskVal = common.CopyBytes(it.disk.Value())
+			it.diskOk = true
+			return
+		}
+	}
+}
+
+// Next moves the iterator to the next live entry, returning whether there was
+// one.
+func (it *flatIterator) Next() bool {
+	for it.diskOk || len(it.keys) > 0 {
+		switch {
+		case len(it.keys) == 0 || (it.diskOk && bytes.Compare(it.diskKey[:], it.keys[0][:]) < 0):
+			// Disk entry not touched by the overlay
+			it.Hash, it.Value = it.diskKey, it.diskVal
+			it.nextDisk()
+
+		default:
+			// Overlay entry, shadowing the disk entry if it's the same
+			if it.diskOk && it.diskKey == it.keys[0] {
+				it.nextDisk()
+			}
+			it.Hash, it.Value = it.keys[0], it.vals[it.keys[0]]
+			it.keys = it.keys[1:]
+		}
+		if len(it.Value) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Error returns any failure of the underlying disk iterator.
+func (it *flatIterator) Error() error {
+	if it.disk == nil {
+		return nil
+	}
+	return it.disk.Error()
+}
+
+// Release releases the underlying disk iterator.
+func (it *flatIterator) Release() {
+	if it.disk != nil {
+		it.disk.Release()
+	}
+}
+
+// Verify iterates the whole state (all the accounts as well as the corresponding
+// storages) of the snapshot with the specified root and compares it entry by
+// entry with the state tries.
+func (t *Tree) Verify(root common.Hash) error {
+	snap := t.Snapshot(root)
+	if snap == nil {
+		return fmt.Errorf("snapshot [%#x] missing", root)
+	}
+	// Gather the layers from the disk upwards
+	var (
+		disk  *diskLayer
+		diffs []*diffLayer
+	)
+	for layer := snap.(snapshot); layer != nil; layer = layer.Parent() {
+		switch layer := layer.(type) {
+		case *diskLayer:
+			disk = layer
+		case *diffLayer:
+			diffs = append([]*diffLayer{layer}, diffs...)
+		}
+	}
+	if disk.generating() {
+		return errors.New("snapshot is not fully generated yet")
+	}
+	// Flatten the diff layers into a single overlay, oldest first
+	var (
+		destructs = make(map[common.Hash]struct{})
+		accounts  = make(map[common.Hash][]byte)
+		storage   = make(map[common.Hash]map[common.Hash][]byte)
+	)
+	for _, diff := range diffs {
+		diff.lock.RLock()
+		for hash := range diff.destructSet {
+			destructs[hash] = struct{}{}
+			accounts[hash] = nil
+			delete(storage, hash)
+		}
+		for hash, data := range diff.accountData {
+			accounts[hash] = data
+		}
+		for hash, slots := range diff.storageData {
+			if storage[hash] == nil {
+				storage[hash] = make(map[common.Hash][]byte)
+			}
+			for key, val := range slots {
+				storage[hash][key] = val
+			}
+		}
+		diff.lock.RUnlock()
+	}
+	accTrie, err := trie.New(root, t.triedb)
+	if err != nil {
+		return err
+	}
+	var (
+		start  = time.Now()
+		logged = time.Now()
+		count  uint64
+
+		trieIt = trie.NewIterator(accTrie.NodeIterator(nil))
+		snapIt = newFlatIterator(t.diskdb.NewIterator(rawdb.SnapshotAccountPrefix, nil), accountKeyLength, accounts)
+	)
+	defer snapIt.Release()
+
+loop:
+	for {
+		trieOk, snapOk := trieIt.Next(), snapIt.Next()
+		if !trieOk || !snapOk {
+			if trieIt.Err != nil {
+				return trieIt.Err
+			}
+			if err := snapIt.Error(); err != nil {
+				return err
+			}
+			switch {
+			case trieOk:
+				return fmt.Errorf("account %x missing from snapshot", trieIt.Key)
+			case snapOk:
+				return fmt.Errorf("account %x missing from trie", snapIt.Hash)
+			}
+			break loop
+		}
+		hash := common.BytesToHash(trieIt.Key)
+		if hash != snapIt.Hash {
+			return fmt.Errorf("account mismatch: trie %x, snapshot %x", hash, snapIt.Hash)
+		}
+		if !bytes.Equal(trieIt.Value, snapIt.Value) {
+			return fmt.Errorf("account %x content mismatch", hash)
+		}
+		var acc Account
+		if err := rlp.DecodeBytes(trieIt.Value, &acc); err != nil {
+			return fmt.Errorf("invalid account %x: %v", hash, err)
+		}
+		// Verify the storage of the account, ignoring the disk content if the
+		// account was destructed in the diffs
+		var diskIt ethdb.Iterator
+		if _, ok := destructs[hash]; !ok {
+			diskIt = rawdb.IterateStorageSnapshots(t.diskdb, hash)
+		}
+		if err := verifyStorage(t.triedb, hash, acc.Root, newFlatIterator(diskIt, storageKeyLength, storage[hash])); err != nil {
+			return err
+		}
+		count++
+		if time.Since(logged) > generatorLogInterval {
+			log.Info("Verifying state snapshot", "at", hash, "accounts", count, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	log.Info("Verified state snapshot", "root", root, "accounts", count, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// verifyStorage compares the storage trie of an account with the snapshot
+// storage entries of the given iterator.
+func verifyStorage(triedb *trie.Database, account common.Hash, root common.Hash, snapIt *flatIterator) error {
+	defer snapIt.Release()
+
+	if root == types.EmptyRootHash {
+		if snapIt.Next() {
+			return fmt.Errorf("account %x has dangling storage %x in snapshot", account, snapIt.Hash)
+		}
+		return snapIt.Error()
+	}
+	storeTrie, err := trie.New(root, triedb)
+	if err != nil {
+		return err
+	}
+	trieIt := trie.NewIterator(storeTrie.NodeIterator(nil))
+	for {
+		trieOk, snapOk := trieIt.Next(), snapIt.Next()
+		if !trieOk || !snapOk {
+			if trieIt.Err != nil {
+				return trieIt.Err
+			}
+			if err := snapIt.Error(); err != nil {
+				return err
+			}
+			switch {
+			case trieOk:
+				return fmt.Errorf("account %x slot %x missing from snapshot", account, trieIt.Key)
+			case snapOk:
+				return fmt.Errorf("account %x slot %x missing from trie", account, snapIt.Hash)
+			}
+			return nil
+		}
+		hash := common.BytesToHash(trieIt.Key)
+		if hash != snapIt.Hash {
+			return fmt.Errorf("account %x slot mismatch: trie %x, snapshot %x", account, hash, snapIt.Hash)
+		}
+		if !bytes.Equal(trieIt.Value, snapIt.Value) {
+			return fmt.Errorf("account %x slot %x content mismatch", account, hash)
+		}
+	}
+}
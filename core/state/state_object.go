@@ -81,6 +81,8 @@ type stateObject struct {
 	dirtyStorage  Storage // Storage entries that need to be flushed to disk
 	fakeStorage   Storage // Fake storage which constructed by caller for debugging purpose.
 
+	snapStorage map[common.Hash][]byte // Storage entries written to the trie, keyed by hash, for the snapshot
+
 	// Cache flags.
 	dirtyCode bool // true if the code was updated
 
@@ -188,7 +190,7 @@ func (s *stateObject) GetCommittedState(db Database, key common.Hash) common.Has
 	defer func(start time.Time) { s.db.StorageReads += time.Since(start) }(time.Now())
 	value := common.Hash{}
 	// Load from DB in case it is missing.
-	enc, err := s.getTrie(db).TryGet(key[:])
+	enc, err := s.readStorage(db, key)
 	if err != nil {
 		s.setError(err)
 		return common.Hash{}
@@ -213,7 +215,7 @@ func (s *stateObject) GetState(db Database, key common.Hash) common.Hash {
 		return value
 	}
 	// Load from DB in case it is missing.
-	enc, err := s.getTrie(db).TryGet(key[:])
+	enc, err := s.readStorage(db, key)
 	if err != nil {
 		s.setError(err)
 		return common.Hash{}
@@ -231,6 +233,27 @@ func (s *stateObject) GetState(db Database, key common.Hash) common.Hash {
 	return value
 }
 
+// readStorage retrieves the encoded storage slot from the snapshot if there's
+// one, falling back to the storage trie if the snapshot can't serve it. The
+// slots written to the trie since the state was opened are served from the
+// snapshot change set of the object.
+func (s *stateObject) readStorage(db Database, key common.Hash) ([]byte, error) {
+	if s.db.snap != nil {
+		keyHash := crypto.Keccak256Hash(key[:])
+		if enc, ok := s.snapStorage[keyHash]; ok {
+			return enc, nil
+		}
+		// If the account was destructed in this block, the snapshot holds the
+		// storage of the old incarnation, leave it to the trie
+		if _, destructed := s.db.snapDestructs[s.addrHash]; !destructed {
+			if enc, err := s.db.snap.Storage(s.addrHash, keyHash); err == nil {
+				return enc, nil
+			}
+		}
+	}
+	return s.getTrie(db).TryGet(key[:])
+}
+
 // SetState updates a value in account storage.
 func (s *stateObject) SetState(db Database, key, value common.Hash) {
 	// If the fake storage is set, put the temporary state update here.
@@ -285,15 +308,24 @@ func (s *stateObject) updateTrie(db Database) Trie {
 	// Track the amount of time wasted on updating the storage trie
 	defer func(start time.Time) { s.db.StorageUpdates += time.Since(start) }(time.Now())
 	tr := s.getTrie(db)
+	if s.db.snap != nil && s.snapStorage == nil && len(s.dirtyStorage) > 0 {
+		s.snapStorage = make(map[common.Hash][]byte)
+	}
 	for key, value := range s.dirtyStorage {
 		delete(s.dirtyStorage, key)
+
+		var v []byte
 		if (value == common.Hash{}) {
 			s.setError(tr.TryDelete(key[:]))
-			continue
+		} else {
+			// Encoding []byte cannot fail, ok to ignore the error.
+			v, _ = rlp.EncodeToBytes(common.TrimLeftZeroes(value[:]))
+			s.setError(tr.TryUpdate(key[:], v))
+		}
+		// Track the written slot for the snapshot diff of the block
+		if s.db.snap != nil {
+			s.snapStorage[crypto.Keccak256Hash(key[:])] = v
 		}
-		// Encoding []byte cannot fail, ok to ignore the error.
-		v, _ := rlp.EncodeToBytes(common.TrimLeftZeroes(value[:]))
-		s.setError(tr.TryUpdate(key[:], v))
 	}
 	return tr
 }
@@ -373,6 +405,12 @@ func (s *stateObject) deepCopy(db *StateDB, onDirty func(addr common.Address)) *
 	stateObject.code = s.code
 	stateObject.dirtyStorage = s.dirtyStorage.Copy()
 	stateObject.cachedStorage = s.dirtyStorage.Copy()
+	if s.snapStorage != nil {
+		stateObject.snapStorage = make(map[common.Hash][]byte, len(s.snapStorage))
+		for hash, enc := range s.snapStorage {
+			stateObject.snapStorage[hash] = enc
+		}
+	}
 	stateObject.selfDestructed = s.selfDestructed
 	stateObject.dirtyCode = s.dirtyCode
 	stateObject.deleted = s.deleted
@@ -18,6 +18,7 @@
 package state
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
 	"sort"
@@ -25,6 +26,7 @@ import (
 	"time"
 
 	"BRDPoSChain/common"
+	"BRDPoSChain/core/state/snapshot"
 	"BRDPoSChain/core/types"
 	"BRDPoSChain/crypto"
 	"BRDPoSChain/log"
@@ -33,6 +35,10 @@ import (
 	"BRDPoSChain/trie"
 )
 
+// snapshotLayers is the number of diff layers kept in memory by the snapshot
+// tree, matching the number of recent tries kept in memory by the blockchain.
+const snapshotLayers = 128
+
 type revision struct {
 	id           int
 	journalIndex int
@@ -47,6 +53,12 @@ type StateDB struct {
 	db   Database
 	trie Trie
 
+	snaps         *snapshot.Tree
+	snap          snapshot.Snapshot
+	snapDestructs map[common.Hash]struct{}
+	snapAccounts  map[common.Hash][]byte
+	snapStorage   map[common.Hash]map[common.Hash][]byte
+
 	// This map holds 'live' objects, which will get modified while processing a state transition.
 	stateObjects      map[common.Address]*stateObject
 	stateObjectsDirty map[common.Address]struct{}
@@ -120,20 +132,44 @@ func (s *StateDB) GetCommittedState(addr common.Address, hash common.Hash) commo
 
 // Create a new state from a given trie.
 func New(root common.Hash, db Database) (*StateDB, error) {
+	return NewWithSnapshot(root, db, nil)
+}
+
+// NewWithSnapshot creates a new state from a given trie, reading the accounts
+// and storage slots from the flat snapshot of the root if one is available.
+// The changes committed to the state are pushed into the snapshot tree too.
+func NewWithSnapshot(root common.Hash, db Database, snaps *snapshot.Tree) (*StateDB, error) {
 	tr, err := db.OpenTrie(root)
 	if err != nil {
 		return nil, err
 	}
-	return &StateDB{
+	sdb := &StateDB{
 		db:                db,
 		trie:              tr,
+		snaps:             snaps,
 		stateObjects:      make(map[common.Address]*stateObject),
 		stateObjectsDirty: make(map[common.Address]struct{}),
 		logs:              make(map[common.Hash][]*types.Log),
 		preimages:         make(map[common.Hash][]byte),
 		accessList:        newAccessList(),
 		transientStorage:  newTransientStorage(),
-	}, nil
+	}
+	sdb.openSnapshot(root)
+	return sdb, nil
+}
+
+// openSnapshot looks up the snapshot of the given root and resets the snapshot
+// change sets.
+func (s *StateDB) openSnapshot(root common.Hash) {
+	s.snap, s.snapDestructs, s.snapAccounts, s.snapStorage = nil, nil, nil, nil
+	if s.snaps == nil {
+		return
+	}
+	if s.snap = s.snaps.Snapshot(root); s.snap != nil {
+		s.snapDestructs = make(map[common.Hash]struct{})
+		s.snapAccounts = make(map[common.Hash][]byte)
+		s.snapStorage = make(map[common.Hash]map[common.Hash][]byte)
+	}
 }
 
 // setError remembers the first non-nil error it is called with.
@@ -155,6 +191,7 @@ func (s *StateDB) Reset(root common.Hash) error {
 		return err
 	}
 	s.trie = tr
+	s.openSnapshot(root)
 	s.stateObjects = make(map[common.Address]*stateObject)
 	s.stateObjectsDirty = make(map[common.Address]struct{})
 	s.thash = common.Hash{}
@@ -254,6 +291,24 @@ func (s *StateDB) GetStorageRoot(addr common.Address) common.Hash {
 	return common.Hash{}
 }
 
+// GetProof returns the Merkle proof for a given account.
+func (s *StateDB) GetProof(addr common.Address) ([][]byte, error) {
+	var proof trie.ProofList
+	err := s.trie.Prove(crypto.Keccak256(addr.Bytes()), 0, &proof)
+	return proof, err
+}
+
+// GetStorageProof returns the Merkle proof for given storage slot.
+func (s *StateDB) GetStorageProof(a common.Address, key common.Hash) ([][]byte, error) {
+	var proof trie.ProofList
+	trie := s.StorageTrie(a)
+	if trie == nil {
+		return proof, errors.New("storage trie for requested address does not exist")
+	}
+	err := trie.Prove(crypto.Keccak256(key.Bytes()), 0, &proof)
+	return proof, err
+}
+
 // TxIndex returns the current transaction index set by Prepare.
 func (s *StateDB) TxIndex() int {
 	return s.txIndex
@@ -477,6 +532,11 @@ func (s *StateDB) updateStateObject(stateObject *stateObject) {
 		panic(fmt.Errorf("can't encode object at %x: %v", addr[:], err))
 	}
 	s.setError(s.trie.TryUpdate(addr[:], data))
+
+	// Track the written account for the snapshot diff of the block
+	if s.snap != nil {
+		s.snapAccounts[stateObject.addrHash] = data
+	}
 }
 
 // deleteStateObject removes the given object from the state trie.
@@ -489,6 +549,14 @@ func (s *StateDB) deleteStateObject(stateObject *stateObject) {
 
 	addr := stateObject.Address()
 	s.setError(s.trie.TryDelete(addr[:]))
+
+	// Track the deletion for the snapshot diff of the block, dropping anything
+	// written to the account earlier
+	if s.snap != nil {
+		s.snapDestructs[stateObject.addrHash] = struct{}{}
+		delete(s.snapAccounts, stateObject.addrHash)
+		delete(s.snapStorage, stateObject.addrHash)
+	}
 }
 
 // DeleteAddress removes the address from the state trie.
@@ -512,7 +580,7 @@ func (s *StateDB) getStateObject(addr common.Address) (stateObject *stateObject)
 	defer func(start time.Time) { s.AccountReads += time.Since(start) }(time.Now())
 
 	// Load the object from the database
-	enc, err := s.trie.TryGet(addr[:])
+	enc, err := s.readAccount(addr)
 	if len(enc) == 0 {
 		s.setError(err)
 		return nil
@@ -528,6 +596,26 @@ func (s *StateDB) getStateObject(addr common.Address) (stateObject *stateObject)
 	return obj
 }
 
+// readAccount retrieves the encoded account from the snapshot if there's one,
+// falling back to the account trie if the snapshot can't serve it. The accounts
+// written to the trie since the state was opened are served from the snapshot
+// change sets.
+func (s *StateDB) readAccount(addr common.Address) ([]byte, error) {
+	if s.snap != nil {
+		addrHash := crypto.Keccak256Hash(addr[:])
+		if enc, ok := s.snapAccounts[addrHash]; ok {
+			return enc, nil
+		}
+		if _, destructed := s.snapDestructs[addrHash]; destructed {
+			return nil, nil
+		}
+		if enc, err := s.snap.AccountRLP(addrHash); err == nil {
+			return enc, nil
+		}
+	}
+	return s.trie.TryGet(addr[:])
+}
+
 func (s *StateDB) setStateObject(object *stateObject) {
 	s.stateObjects[object.Address()] = object
 }
@@ -551,12 +639,21 @@ func (s *StateDB) MarkStateObjectDirty(addr common.Address) {
 // the given address, it is overwritten and returned as the second return value.
 func (s *StateDB) createObject(addr common.Address) (newobj, prev *stateObject) {
 	prev = s.getStateObject(addr)
+
+	// The storage of an overwritten account is gone, the snapshot needs to know
+	var prevdestruct bool
+	if s.snap != nil && prev != nil {
+		_, prevdestruct = s.snapDestructs[prev.addrHash]
+		if !prevdestruct {
+			s.snapDestructs[prev.addrHash] = struct{}{}
+		}
+	}
 	newobj = newObject(s, addr, Account{}, s.MarkStateObjectDirty)
 	newobj.setNonce(0) // sets the object to dirty
 	if prev == nil {
 		s.journal = append(s.journal, createObjectChange{account: &addr})
 	} else {
-		s.journal = append(s.journal, resetObjectChange{prev: prev})
+		s.journal = append(s.journal, resetObjectChange{prev: prev, prevdestruct: prevdestruct})
 	}
 
 	newobj.created = true
@@ -614,6 +711,8 @@ func (s *StateDB) Copy() *StateDB {
 	state := &StateDB{
 		db:                s.db,
 		trie:              s.db.CopyTrie(s.trie),
+		snaps:             s.snaps,
+		snap:              s.snap,
 		stateObjects:      make(map[common.Address]*stateObject, len(s.stateObjectsDirty)),
 		stateObjectsDirty: make(map[common.Address]struct{}, len(s.stateObjectsDirty)),
 		refund:            s.refund,
@@ -649,6 +748,28 @@ func (s *StateDB) Copy() *StateDB {
 
 	state.transientStorage = s.transientStorage.Copy()
 
+	if s.snap != nil {
+		// In order for the miner to be able to use and make additions
+		// to the snapshot tree, we need to copy that as well.
+		// Otherwise, any block mined by ourselves will cause gaps in the tree,
+		// and force the miner to operate trie-backed only
+		state.snapDestructs = make(map[common.Hash]struct{}, len(s.snapDestructs))
+		for k, v := range s.snapDestructs {
+			state.snapDestructs[k] = v
+		}
+		state.snapAccounts = make(map[common.Hash][]byte, len(s.snapAccounts))
+		for k, v := range s.snapAccounts {
+			state.snapAccounts[k] = v
+		}
+		state.snapStorage = make(map[common.Hash]map[common.Hash][]byte, len(s.snapStorage))
+		for k, v := range s.snapStorage {
+			temp := make(map[common.Hash][]byte, len(v))
+			for kk, vv := range v {
+				temp[kk] = vv
+			}
+			state.snapStorage[k] = temp
+		}
+	}
 	return state
 }
 
@@ -777,6 +898,15 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (root common.Hash, err error)
 		}
 		delete(s.stateObjectsDirty, addr)
 	}
+	// Gather the storage writes of the live accounts for the snapshot
+	if s.snap != nil {
+		for _, stateObject := range s.stateObjects {
+			if !stateObject.deleted && len(stateObject.snapStorage) > 0 {
+				s.snapStorage[stateObject.addrHash] = stateObject.snapStorage
+			}
+			stateObject.snapStorage = nil
+		}
+	}
 	// Write the account trie changes, measuing the amount of wasted time
 	defer func(start time.Time) { s.AccountCommits += time.Since(start) }(time.Now())
 
@@ -794,7 +924,24 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (root common.Hash, err error)
 		}
 		return nil
 	})
-	return root, err
+	if err != nil {
+		return root, err
+	}
+	// If snapshotting is enabled, push the changes of the block as a new diff
+	// layer and flatten the layers beyond the in-memory tries into the disk
+	if s.snap != nil {
+		// Only update if there's a state transition (skip empty blocks)
+		if parent := s.snap.Root(); parent != root {
+			if err := s.snaps.Update(root, parent, s.snapDestructs, s.snapAccounts, s.snapStorage); err != nil {
+				log.Warn("Failed to update snapshot tree", "from", parent, "to", root, "err", err)
+			}
+			if err := s.snaps.Cap(root, snapshotLayers); err != nil {
+				log.Warn("Failed to cap snapshot tree", "root", root, "layers", snapshotLayers, "err", err)
+			}
+		}
+		s.snap, s.snapDestructs, s.snapAccounts, s.snapStorage = nil, nil, nil, nil
+	}
+	return root, nil
 }
 
 // Prepare handles the preparatory steps for executing a state transition with.
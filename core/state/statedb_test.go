@@ -30,6 +30,7 @@ import (
 
 	"BRDPoSChain/common"
 	"BRDPoSChain/core/rawdb"
+	"BRDPoSChain/core/state/snapshot"
 	"BRDPoSChain/core/types"
 	check "gopkg.in/check.v1"
 )
@@ -657,3 +658,61 @@ func TestStateDBTransientStorage(t *testing.T) {
 		t.Fatalf("transient storage mismatch: have %x, want %x", got, value)
 	}
 }
+
+// Tests that a state backed by a snapshot reads the same values as the tries
+// and that committing it keeps the snapshot in sync, including accounts that
+// are destructed and later resurrected.
+func TestStateDBSnapshot(t *testing.T) {
+	var (
+		memDb = rawdb.NewMemoryDatabase()
+		db    = NewDatabase(memDb)
+		addr1 = common.Address{0x01}
+		addr2 = common.Address{0x02}
+		key1  = common.Hash{0x11}
+		key2  = common.Hash{0x12}
+	)
+	state, _ := New(types.EmptyRootHash, db)
+	state.SetBalance(addr1, big.NewInt(1))
+	state.SetState(addr1, key1, common.Hash{0x01})
+	state.SetBalance(addr2, big.NewInt(2))
+	state.SetState(addr2, key2, common.Hash{0x02})
+	root, _ := state.Commit(false)
+	db.TrieDB().Commit(root, false)
+
+	snaps, err := snapshot.New(memDb, db.TrieDB(), 1, root, false, true)
+	if err != nil {
+		t.Fatalf("failed to generate snapshot: %v", err)
+	}
+	// Modify the storage of the first account and destruct the second one
+	state, _ = NewWithSnapshot(root, db, snaps)
+	if got := state.GetState(addr2, key2); got != (common.Hash{0x02}) {
+		t.Fatalf("storage mismatch: have %x, want %x", got, common.Hash{0x02})
+	}
+	state.SetState(addr1, key1, common.Hash{})
+	state.SetState(addr1, key2, common.Hash{0x03})
+	state.SelfDestruct(addr2)
+	root, _ = state.Commit(false)
+
+	if err := snaps.Verify(root); err != nil {
+		t.Fatalf("snapshot mismatch after destruct: %v", err)
+	}
+	// Resurrect the second account, its old storage must not leak back
+	state, _ = NewWithSnapshot(root, db, snaps)
+	if state.Exist(addr2) {
+		t.Fatalf("destructed account still exists")
+	}
+	if got := state.GetState(addr1, key2); got != (common.Hash{0x03}) {
+		t.Fatalf("storage mismatch: have %x, want %x", got, common.Hash{0x03})
+	}
+	state.SetBalance(addr2, big.NewInt(3))
+	state.SetState(addr2, key1, common.Hash{0x04})
+	root, _ = state.Commit(false)
+
+	if err := snaps.Verify(root); err != nil {
+		t.Fatalf("snapshot mismatch after resurrection: %v", err)
+	}
+	state, _ = NewWithSnapshot(root, db, snaps)
+	if got := state.GetState(addr2, key2); got != (common.Hash{}) {
+		t.Fatalf("resurrected storage mismatch: have %x, want empty", got)
+	}
+}
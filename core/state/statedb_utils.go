@@ -87,6 +87,12 @@ var (
 		"candidateWithdrawDelay": 14,
 		"voterWithdrawDelay":     15,
 	}
+	// storage of the BLS registration system address, written by the registration transactions with the layout of
+	// "mapping(address => bytes) publicKeys" and "mapping(bytes32 => address) keyCandidates" (keyed by the key hash)
+	slotBLSRegistrationMapping = map[string]uint64{
+		"publicKeys":    0,
+		"keyCandidates": 1,
+	}
 )
 
 func GetCandidates(statedb *StateDB) []common.Address {
@@ -152,3 +158,90 @@ func GetVoterCap(statedb *StateDB, candidate, voter common.Address) *big.Int {
 	ret := statedb.GetState(common.MasternodeVotingSMCBinary, common.BytesToHash(retByte))
 	return ret.Big()
 }
+
+func SetCandidateCap(statedb *StateDB, candidate common.Address, cap *big.Int) {
+	slot := slotValidatorMapping["validatorsState"]
+	// validatorsState[_candidate].cap;
+	locValidatorsState := GetLocMappingAtKey(candidate.Hash(), slot)
+	locCandidateCap := locValidatorsState.Add(locValidatorsState, new(big.Int).SetUint64(uint64(1)))
+	statedb.SetState(common.MasternodeVotingSMCBinary, common.BigToHash(locCandidateCap), common.BigToHash(cap))
+}
+
+func SetVoterCap(statedb *StateDB, candidate, voter common.Address, cap *big.Int) {
+	slot := slotValidatorMapping["validatorsState"]
+	locValidatorsState := GetLocMappingAtKey(candidate.Hash(), slot)
+	locCandidateVoters := locValidatorsState.Add(locValidatorsState, new(big.Int).SetUint64(uint64(2)))
+	retByte := crypto.Keccak256(voter.Hash().Bytes(), common.BigToHash(locCandidateVoters).Bytes())
+	statedb.SetState(common.MasternodeVotingSMCBinary, common.BytesToHash(retByte), common.BigToHash(cap))
+}
+
+// slashing key of a signer and a round, keccak256(signer, round)
+func getSlashingKey(signer common.Address, round uint64) common.Hash {
+	return crypto.Keccak256Hash(signer.Hash().Bytes(), common.BigToHash(new(big.Int).SetUint64(round)).Bytes())
+}
+
+// IsSlashed returns whether the signer has already been slashed for the votes of the round
+func IsSlashed(statedb *StateDB, signer common.Address, round uint64) bool {
+	return !statedb.GetState(common.SlashingAddressBinary, getSlashingKey(signer, round)).IsZero()
+}
+
+// SetSlashed records the signer is slashed for the votes of the round in the block
+func SetSlashed(statedb *StateDB, signer common.Address, round uint64, number uint64) {
+	// an empty account is deleted with its storage
+	if statedb.GetNonce(common.SlashingAddressBinary) == 0 {
+		statedb.SetNonce(common.SlashingAddressBinary, 1)
+	}
+	statedb.SetState(common.SlashingAddressBinary, getSlashingKey(signer, round), common.BigToHash(common.Big1))
+	statedb.SetState(common.SlashingAddressBinary, signer.Hash(), common.BigToHash(new(big.Int).SetUint64(number)))
+}
+
+// GetLastSlashedBlock returns the number of the last block the signer is slashed in, 0 if it's never slashed
+func GetLastSlashedBlock(statedb *StateDB, signer common.Address) uint64 {
+	return statedb.GetState(common.SlashingAddressBinary, signer.Hash()).Big().Uint64()
+}
+
+// GetCandidateBLSPublicKey returns the BLS public key registered for the candidate, nil if none
+func GetCandidateBLSPublicKey(statedb *StateDB, candidate common.Address) []byte {
+	slot := slotBLSRegistrationMapping["publicKeys"]
+	// publicKeys[_candidate], a long bytes value stores length*2+1 in its slot and the data from keccak256(slot)
+	locKey := common.BigToHash(GetLocMappingAtKey(candidate.Hash(), slot))
+	header := statedb.GetState(common.BLSRegistrationAddressBinary, locKey).Big()
+	if header.Bit(0) == 0 {
+		return nil
+	}
+	length := new(big.Int).Rsh(header, 1).Uint64()
+	locData := crypto.Keccak256Hash(locKey.Bytes()).Big()
+	ret := make([]byte, 0, length+common.HashLength)
+	for i := uint64(0); uint64(len(ret)) < length; i++ {
+		word := statedb.GetState(common.BLSRegistrationAddressBinary, common.BigToHash(new(big.Int).Add(locData, new(big.Int).SetUint64(i))))
+		ret = append(ret, word.Bytes()...)
+	}
+	return ret[:length]
+}
+
+// GetBLSPublicKeyCandidate returns the candidate the BLS public key is registered for, the zero address if none
+func GetBLSPublicKeyCandidate(statedb *StateDB, publicKey []byte) common.Address {
+	slot := slotBLSRegistrationMapping["keyCandidates"]
+	locKey := common.BigToHash(GetLocMappingAtKey(crypto.Keccak256Hash(publicKey), slot))
+	return common.BytesToAddress(statedb.GetState(common.BLSRegistrationAddressBinary, locKey).Bytes())
+}
+
+// SetCandidateBLSPublicKey stores the BLS public key of the candidate. The key has to be longer than 31 bytes.
+func SetCandidateBLSPublicKey(statedb *StateDB, candidate common.Address, publicKey []byte) {
+	// an empty account is deleted with its storage
+	if statedb.GetNonce(common.BLSRegistrationAddressBinary) == 0 {
+		statedb.SetNonce(common.BLSRegistrationAddressBinary, 1)
+	}
+	slot := slotBLSRegistrationMapping["publicKeys"]
+	locKey := common.BigToHash(GetLocMappingAtKey(candidate.Hash(), slot))
+	length := new(big.Int).SetUint64(uint64(len(publicKey)))
+	statedb.SetState(common.BLSRegistrationAddressBinary, locKey, common.BigToHash(length.Add(length.Lsh(length, 1), common.Big1)))
+	locData := crypto.Keccak256Hash(locKey.Bytes()).Big()
+	for i := 0; i*common.HashLength < len(publicKey); i++ {
+		var word common.Hash
+		copy(word[:], publicKey[i*common.HashLength:])
+		statedb.SetState(common.BLSRegistrationAddressBinary, common.BigToHash(new(big.Int).Add(locData, big.NewInt(int64(i)))), word)
+	}
+	slot = slotBLSRegistrationMapping["keyCandidates"]
+	statedb.SetState(common.BLSRegistrationAddressBinary, common.BigToHash(GetLocMappingAtKey(crypto.Keccak256Hash(publicKey), slot)), candidate.Hash())
+}
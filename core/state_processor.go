@@ -17,21 +17,28 @@
 package core
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 
 	"math/big"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
 
 	"BRDPoSChain/BRCx/tradingstate"
 	"BRDPoSChain/common"
+	"BRDPoSChain/common/hexutil"
 	"BRDPoSChain/consensus"
+	"BRDPoSChain/consensus/BRDPoS"
+	"BRDPoSChain/consensus/BRDPoS/utils"
 	"BRDPoSChain/consensus/misc"
 	"BRDPoSChain/core/state"
 	"BRDPoSChain/core/types"
 	"BRDPoSChain/core/vm"
 	"BRDPoSChain/crypto"
+	"BRDPoSChain/crypto/bls"
 	"BRDPoSChain/log"
 	"BRDPoSChain/params"
 )
@@ -90,6 +97,7 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, tra
 	blockContext := NewEVMBlockContext(header, p.bc, nil)
 	vmenv := vm.NewEVM(blockContext, vm.TxContext{}, statedb, tradingState, p.config, cfg)
 	coinbaseOwner := getCoinbaseOwner(p.bc, statedb, header, nil)
+	masternodes := getRoundMasternodes(p.bc, header)
 	// Iterate over and process the individual transactions
 	for i, tx := range block.Transactions() {
 		// check black-list txs after hf
@@ -118,7 +126,7 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, tra
 			}
 		}
 		statedb.SetTxContext(tx.Hash(), i)
-		receipt, gas, err, tokenFeeUsed := applyTransaction(p.config, balanceFee, gp, statedb, coinbaseOwner, blockNumber, header.BaseFee, blockHash, tx, usedGas, vmenv)
+		receipt, gas, err, tokenFeeUsed := applyTransaction(p.config, balanceFee, gp, statedb, coinbaseOwner, blockNumber, header.BaseFee, blockHash, tx, usedGas, masternodes, vmenv)
 		if err != nil {
 			return nil, nil, 0, fmt.Errorf("could not apply tx %d [%v]: %w", i, tx.Hash().Hex(), err)
 		}
@@ -169,6 +177,7 @@ func (p *StateProcessor) ProcessBlockNoValidator(cBlock *CalculatedBlock, stated
 	blockContext := NewEVMBlockContext(header, p.bc, nil)
 	vmenv := vm.NewEVM(blockContext, vm.TxContext{}, statedb, tradingState, p.config, cfg)
 	coinbaseOwner := getCoinbaseOwner(p.bc, statedb, header, nil)
+	masternodes := getRoundMasternodes(p.bc, header)
 	// Iterate over and process the individual transactions
 	receipts = make([]*types.Receipt, block.Transactions().Len())
 	for i, tx := range block.Transactions() {
@@ -198,7 +207,7 @@ func (p *StateProcessor) ProcessBlockNoValidator(cBlock *CalculatedBlock, stated
 			}
 		}
 		statedb.SetTxContext(tx.Hash(), i)
-		receipt, gas, err, tokenFeeUsed := applyTransaction(p.config, balanceFee, gp, statedb, coinbaseOwner, blockNumber, header.BaseFee, blockHash, tx, usedGas, vmenv)
+		receipt, gas, err, tokenFeeUsed := applyTransaction(p.config, balanceFee, gp, statedb, coinbaseOwner, blockNumber, header.BaseFee, blockHash, tx, usedGas, masternodes, vmenv)
 		if err != nil {
 			return nil, nil, 0, err
 		}
@@ -220,7 +229,7 @@ func (p *StateProcessor) ProcessBlockNoValidator(cBlock *CalculatedBlock, stated
 	return receipts, allLogs, *usedGas, nil
 }
 
-func applyTransaction(config *params.ChainConfig, tokensFee map[common.Address]*big.Int, gp *GasPool, statedb *state.StateDB, coinbaseOwner common.Address, blockNumber, baseFee *big.Int, blockHash common.Hash, tx *types.Transaction, usedGas *uint64, evm *vm.EVM) (*types.Receipt, uint64, error, bool) {
+func applyTransaction(config *params.ChainConfig, tokensFee map[common.Address]*big.Int, gp *GasPool, statedb *state.StateDB, coinbaseOwner common.Address, blockNumber, baseFee *big.Int, blockHash common.Hash, tx *types.Transaction, usedGas *uint64, masternodes roundMasternodes, evm *vm.EVM) (*types.Receipt, uint64, error, bool) {
 	to := tx.To()
 	if to != nil {
 		if *to == common.BlockSignersBinary && config.IsTIPSigning(blockNumber) {
@@ -229,6 +238,12 @@ func applyTransaction(config *params.ChainConfig, tokensFee map[common.Address]*
 		if *to == common.TradingStateAddrBinary && config.IsTIPBRCXReceiver(blockNumber) {
 			return ApplyEmptyTransaction(config, statedb, blockNumber, blockHash, tx, usedGas)
 		}
+		if *to == common.SlashingAddressBinary && config.IsTIPSlashing(blockNumber) {
+			return ApplySlashingTransaction(config, gp, statedb, coinbaseOwner, blockNumber, baseFee, blockHash, tx, usedGas, masternodes)
+		}
+		if *to == common.BLSRegistrationAddressBinary && config.IsTIPBLS(blockNumber) {
+			return ApplyBLSRegistrationTransaction(config, gp, statedb, coinbaseOwner, blockNumber, baseFee, blockHash, tx, usedGas)
+		}
 		if *to == common.BRCXLendingAddressBinary && config.IsTIPBRCXReceiver(blockNumber) {
 			return ApplyEmptyTransaction(config, statedb, blockNumber, blockHash, tx, usedGas)
 		}
@@ -467,7 +482,35 @@ func ApplyTransaction(config *params.ChainConfig, tokensFee map[common.Address]*
 	vmenv := vm.NewEVM(blockContext, vm.TxContext{}, statedb, BRCxState, config, cfg)
 	coinbaseOwner := getCoinbaseOwner(bc, statedb, header, author)
 	// return applyTransaction(config, tokensFee, gp, statedb, coinbaseOwner, header.Number, header.BaseFee, header.Hash(), tx, usedGas, vmenv)
-	return applyTransaction(config, tokensFee, gp, statedb, coinbaseOwner, header.Number, header.BaseFee, header.Hash(), tx, usedGas, vmenv)
+	return applyTransaction(config, tokensFee, gp, statedb, coinbaseOwner, header.Number, header.BaseFee, header.Hash(), tx, usedGas, getRoundMasternodes(bc, header), vmenv)
+}
+
+// roundMasternodes returns the masternodes of the epoch of a v2 round and the BLS public keys they signed the votes
+// of the epoch with.
+type roundMasternodes func(round types.Round) ([]common.Address, map[common.Address]hexutil.Bytes, error)
+
+// getRoundMasternodes looks up the masternodes of a round in the epochs of the chain the header extends, and their
+// BLS public keys in the gap block snapshot of the epoch.
+func getRoundMasternodes(bc *BlockChain, header *types.Header) roundMasternodes {
+	return func(round types.Round) ([]common.Address, map[common.Address]hexutil.Bytes, error) {
+		engine, ok := bc.Engine().(*BRDPoS.BRDPoS)
+		if !ok {
+			return nil, nil, errors.New("masternodes of a round are only known by the BRDPoS engine")
+		}
+		parent := bc.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+		if parent == nil {
+			return nil, nil, consensus.ErrUnknownAncestor
+		}
+		masternodes, err := engine.EngineV2.GetMasternodesOfRound(bc, parent, round, common.LimitSlashingEpochV2)
+		if err != nil {
+			return nil, nil, err
+		}
+		blsPublicKeys, err := engine.EngineV2.GetBLSPublicKeysOfRound(bc, parent, round, common.LimitSlashingEpochV2)
+		if err != nil {
+			return nil, nil, err
+		}
+		return masternodes, blsPublicKeys, nil
+	}
 }
 
 func ApplySignTransaction(config *params.ChainConfig, statedb *state.StateDB, blockNumber *big.Int, blockHash common.Hash, tx *types.Transaction, usedGas *uint64) (*types.Receipt, uint64, error, bool) {
@@ -508,6 +551,189 @@ func ApplySignTransaction(config *params.ChainConfig, statedb *state.StateDB, bl
 	return receipt, 0, nil, false
 }
 
+// ApplySlashingTransaction burns a part of the stake of a masternode proven to have signed two votes in the same round.
+// The transaction data is the json of the types.VoteEquivocationContent of the forensic proof. The sender pays the
+// intrinsic gas of the proof. The receipt is failed if the proof is invalid, the signer is not a masternode of the
+// round or it's already slashed for the round. BLS signed votes are checked against the key of the signer in the
+// snapshot of the epoch of the round, which a later key rotation doesn't change.
+func ApplySlashingTransaction(config *params.ChainConfig, gp *GasPool, statedb *state.StateDB, coinbaseOwner common.Address, blockNumber, baseFee *big.Int, blockHash common.Hash, tx *types.Transaction, usedGas *uint64, masternodes roundMasternodes) (*types.Receipt, uint64, error, bool) {
+	msg, err := tx.AsMessage(types.MakeSigner(config, blockNumber), nil, blockNumber, baseFee)
+	if err != nil {
+		return nil, 0, err, false
+	}
+	from := msg.From()
+	nonce := statedb.GetNonce(from)
+	if nonce < tx.Nonce() {
+		return nil, 0, ErrNonceTooHigh, false
+	} else if nonce > tx.Nonce() {
+		return nil, 0, ErrNonceTooLow, false
+	}
+	gas, err := buyIntrinsicGas(config, gp, statedb, coinbaseOwner, blockNumber, msg)
+	if err != nil {
+		return nil, 0, err, false
+	}
+	statedb.SetNonce(from, nonce+1)
+	*usedGas += gas
+
+	failed := false
+	var content types.VoteEquivocationContent
+	if err := json.Unmarshal(tx.Data(), &content); err != nil {
+		log.Debug("Invalid vote equivocation proof", "tx", tx.Hash(), "err", err)
+		failed = true
+	} else if content.SmallerRoundVote == nil || content.SmallerRoundVote.ProposedBlockInfo == nil {
+		log.Debug("Invalid vote equivocation proof", "tx", tx.Hash(), "err", "missing vote")
+		failed = true
+	} else {
+		offender, round := content.Signer, content.SmallerRoundVote.ProposedBlockInfo.Round
+		if epochMasternodes, blsPublicKeys, err := masternodes(round); err != nil || !slices.Contains(epochMasternodes, offender) {
+			log.Debug("Vote equivocation signer is not a masternode of the round", "tx", tx.Hash(), "offender", offender, "round", round, "err", err)
+			failed = true
+		} else if err := utils.VerifyVoteEquivocation(&content, blsPublicKeys[offender]); err != nil {
+			log.Debug("Invalid vote equivocation proof", "tx", tx.Hash(), "err", err)
+			failed = true
+		} else if state.IsSlashed(statedb, offender, uint64(round)) {
+			log.Debug("Vote equivocation is already slashed", "tx", tx.Hash(), "offender", offender, "round", round)
+			failed = true
+		} else {
+			slashMasternodeStake(statedb, offender)
+			state.SetSlashed(statedb, offender, uint64(round), blockNumber.Uint64())
+			log.Info("Slashed masternode for vote equivocation", "offender", offender, "round", round, "number", blockNumber)
+		}
+	}
+	return newSystemReceipt(config, statedb, blockNumber, blockHash, tx, usedGas, gas, failed), gas, nil, false
+}
+
+// newSystemReceipt finalises the state changes of a transaction applied outside of the EVM and creates its receipt,
+// logging the system address the transaction is sent to.
+func newSystemReceipt(config *params.ChainConfig, statedb *state.StateDB, blockNumber *big.Int, blockHash common.Hash, tx *types.Transaction, usedGas *uint64, gas uint64, failed bool) *types.Receipt {
+	// Update the state with pending changes
+	var root []byte
+	if config.IsByzantium(blockNumber) {
+		statedb.Finalise(true)
+	} else {
+		root = statedb.IntermediateRoot(config.IsEIP158(blockNumber)).Bytes()
+	}
+	// Create a new receipt for the transaction, storing the intermediate root and gas used by the tx
+	// based on the eip phase, we're passing wether the root touch-delete accounts.
+	receipt := types.NewReceipt(root, failed, *usedGas)
+	receipt.TxHash = tx.Hash()
+	receipt.GasUsed = gas
+	// Set the receipt logs and create a bloom for filtering
+	log := &types.Log{}
+	log.Address = *tx.To()
+	log.BlockNumber = blockNumber.Uint64()
+	statedb.AddLog(log)
+	receipt.Logs = statedb.GetLogs(tx.Hash(), blockHash)
+	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+	receipt.BlockHash = blockHash
+	receipt.BlockNumber = blockNumber
+	receipt.TransactionIndex = uint(statedb.TxIndex())
+	return receipt
+}
+
+// buyIntrinsicGas charges the sender of a transaction which is not run by the EVM the intrinsic gas of its data,
+// taken from the gas pool of the block, and pays the fee to the coinbase owner. It returns the gas used.
+func buyIntrinsicGas(config *params.ChainConfig, gp *GasPool, statedb *state.StateDB, coinbaseOwner common.Address, blockNumber *big.Int, msg types.Message) (uint64, error) {
+	gas, err := IntrinsicGas(msg.Data(), msg.AccessList(), false, true, config.IsEIP1559(blockNumber))
+	if err != nil {
+		return 0, err
+	}
+	if msg.Gas() < gas {
+		return 0, fmt.Errorf("%w: have %d, want %d", ErrIntrinsicGas, msg.Gas(), gas)
+	}
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(gas), msg.GasPrice())
+	if have := statedb.GetBalance(msg.From()); have.Cmp(fee) < 0 {
+		return 0, fmt.Errorf("%w: address %v have %v want %v", ErrInsufficientFunds, msg.From().Hex(), have, fee)
+	}
+	if err := gp.SubGas(gas); err != nil {
+		return 0, err
+	}
+	statedb.SubBalance(msg.From(), fee)
+	if (coinbaseOwner != common.Address{}) {
+		statedb.AddBalance(coinbaseOwner, fee)
+	}
+	return gas, nil
+}
+
+// ApplyBLSRegistrationTransaction registers the BLS public key a masternode signs its v2 votes and timeouts with.
+// The transaction data is the candidate address, the compressed public key and its proof of possession bound to the
+// candidate address. The sender pays the intrinsic gas of the registration. The receipt is failed if the sender is
+// neither the candidate nor its owner, the proof of possession is invalid or the key is already registered.
+func ApplyBLSRegistrationTransaction(config *params.ChainConfig, gp *GasPool, statedb *state.StateDB, coinbaseOwner common.Address, blockNumber, baseFee *big.Int, blockHash common.Hash, tx *types.Transaction, usedGas *uint64) (*types.Receipt, uint64, error, bool) {
+	msg, err := tx.AsMessage(types.MakeSigner(config, blockNumber), nil, blockNumber, baseFee)
+	if err != nil {
+		return nil, 0, err, false
+	}
+	from := msg.From()
+	nonce := statedb.GetNonce(from)
+	if nonce < tx.Nonce() {
+		return nil, 0, ErrNonceTooHigh, false
+	} else if nonce > tx.Nonce() {
+		return nil, 0, ErrNonceTooLow, false
+	}
+	gas, err := buyIntrinsicGas(config, gp, statedb, coinbaseOwner, blockNumber, msg)
+	if err != nil {
+		return nil, 0, err, false
+	}
+	statedb.SetNonce(from, nonce+1)
+	*usedGas += gas
+
+	failed := false
+	if candidate, publicKey, err := verifyBLSRegistration(statedb, from, tx.Data()); err != nil {
+		log.Debug("Invalid BLS public key registration", "tx", tx.Hash(), "from", from, "err", err)
+		failed = true
+	} else {
+		state.SetCandidateBLSPublicKey(statedb, candidate, publicKey)
+		log.Info("Registered masternode BLS public key", "candidate", candidate, "number", blockNumber)
+	}
+	return newSystemReceipt(config, statedb, blockNumber, blockHash, tx, usedGas, gas, failed), gas, nil, false
+}
+
+// verifyBLSRegistration decodes the data of a BLS registration transaction and checks it may be applied by the sender.
+func verifyBLSRegistration(statedb *state.StateDB, from common.Address, data []byte) (common.Address, []byte, error) {
+	if len(data) != common.AddressLength+bls.PublicKeyLength+bls.SignatureLength {
+		return common.Address{}, nil, fmt.Errorf("invalid data length %d", len(data))
+	}
+	candidate := common.BytesToAddress(data[:common.AddressLength])
+	owner := state.GetCandidateOwner(statedb, candidate)
+	if owner.IsZero() {
+		return common.Address{}, nil, fmt.Errorf("%v is not a candidate", candidate.Hex())
+	}
+	if from != candidate && from != owner {
+		return common.Address{}, nil, fmt.Errorf("%v is neither the candidate nor its owner", from.Hex())
+	}
+	publicKeyBytes := data[common.AddressLength : common.AddressLength+bls.PublicKeyLength]
+	if registered := state.GetBLSPublicKeyCandidate(statedb, publicKeyBytes); !registered.IsZero() {
+		return common.Address{}, nil, fmt.Errorf("key already registered for %v", registered.Hex())
+	}
+	publicKey, err := bls.PublicKeyFromBytes(publicKeyBytes)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	proof, err := bls.SignatureFromBytes(data[common.AddressLength+bls.PublicKeyLength:])
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	if !bls.VerifyPossession(publicKey, proof, candidate.Bytes()) {
+		return common.Address{}, nil, errors.New("invalid proof of possession")
+	}
+	return candidate, common.CopyBytes(publicKeyBytes), nil
+}
+
+// slashMasternodeStake burns SlashingRate of the owner stake of the candidate from the validator contract.
+func slashMasternodeStake(statedb *state.StateDB, candidate common.Address) {
+	owner := state.GetCandidateOwner(statedb, candidate)
+	ownerCap := state.GetVoterCap(statedb, candidate, owner)
+	amount := new(big.Int).Mul(ownerCap, common.SlashingRate)
+	amount = new(big.Int).Div(amount, common.BaseSlashing)
+	if amount.Sign() == 0 {
+		return
+	}
+	state.SetVoterCap(statedb, candidate, owner, new(big.Int).Sub(ownerCap, amount))
+	state.SetCandidateCap(statedb, candidate, new(big.Int).Sub(state.GetCandidateCap(statedb, candidate), amount))
+	statedb.SubBalance(common.MasternodeVotingSMCBinary, amount)
+}
+
 func ApplyEmptyTransaction(config *params.ChainConfig, statedb *state.StateDB, blockNumber *big.Int, blockHash common.Hash, tx *types.Transaction, usedGas *uint64) (*types.Receipt, uint64, error, bool) {
 	// Update the state with pending changes
 	var root []byte
@@ -17,16 +17,23 @@
 package core
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
 	"math/big"
 	"testing"
 
 	"BRDPoSChain/common"
+	"BRDPoSChain/common/hexutil"
 	"BRDPoSChain/consensus"
 	"BRDPoSChain/consensus/ethash"
 	"BRDPoSChain/core/rawdb"
+	"BRDPoSChain/core/state"
 	"BRDPoSChain/core/types"
 	"BRDPoSChain/core/vm"
 	"BRDPoSChain/crypto"
+	"BRDPoSChain/crypto/bls"
 	"BRDPoSChain/params"
 
 	"golang.org/x/crypto/sha3"
@@ -289,3 +296,221 @@ func GenerateBadBlock(t *testing.T, parent *types.Block, engine consensus.Engine
 	// Assemble and return the final block for sealing
 	return types.NewBlock(header, txs, nil, receipts)
 }
+
+func TestApplySlashingTransaction(t *testing.T) {
+	defer func(tipSlashing *big.Int) { common.TIPSlashing = tipSlashing }(common.TIPSlashing)
+	common.TIPSlashing = big.NewInt(0)
+
+	var (
+		config         = &params.ChainConfig{ChainId: big.NewInt(1), EIP155Block: big.NewInt(0), EIP158Block: big.NewInt(0), ByzantiumBlock: big.NewInt(0)}
+		signer         = types.LatestSigner(config)
+		senderKey, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		offenderKey, _ = crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+		sender         = crypto.PubkeyToAddress(senderKey.PublicKey)
+		offender       = crypto.PubkeyToAddress(offenderKey.PublicKey)
+		owner          = common.HexToAddress("0x1234")
+		coinbaseOwner  = common.HexToAddress("0x5678")
+		stake          = new(big.Int).Mul(big.NewInt(50000), big.NewInt(params.Ether))
+		statedb, _     = state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	)
+	// register the offender as a candidate of the validator contract, owned by owner
+	candidatesSlot := common.BigToHash(big.NewInt(8))
+	statedb.SetState(common.MasternodeVotingSMCBinary, candidatesSlot, common.BigToHash(common.Big1))
+	statedb.SetState(common.MasternodeVotingSMCBinary, state.GetLocDynamicArrAtElement(candidatesSlot, 0, 1), offender.Hash())
+	statedb.SetState(common.MasternodeVotingSMCBinary, common.BigToHash(state.GetLocMappingAtKey(offender.Hash(), 1)), owner.Hash())
+	state.SetCandidateCap(statedb, offender, stake)
+	state.SetVoterCap(statedb, offender, owner, stake)
+	statedb.SetBalance(common.MasternodeVotingSMCBinary, stake)
+
+	statedb.SetBalance(sender, big.NewInt(params.Ether))
+
+	vote := func(hash string, round types.Round) *types.Vote {
+		blockInfo := &types.BlockInfo{Hash: common.StringToHash(hash), Round: round, Number: big.NewInt(910)}
+		sig, _ := crypto.Sign(types.VoteSigHash(&types.VoteForSign{ProposedBlockInfo: blockInfo, GapNumber: 450}).Bytes(), offenderKey)
+		return &types.Vote{ProposedBlockInfo: blockInfo, Signature: sig, GapNumber: 450}
+	}
+	masternodes := []common.Address{offender}
+	blsPublicKeys := make(map[common.Address]hexutil.Bytes)
+	roundMasternodes := func(round types.Round) ([]common.Address, map[common.Address]hexutil.Bytes, error) {
+		if round != 10 && round != 20 {
+			return nil, nil, errors.New("unknown round")
+		}
+		return masternodes, blsPublicKeys, nil
+	}
+	nonce := uint64(0)
+	apply := func(content *types.VoteEquivocationContent) *types.Receipt {
+		t.Helper()
+		data, _ := json.Marshal(content)
+		tx, _ := types.SignTx(types.NewTransaction(nonce, common.SlashingAddressBinary, common.Big0, 100000, common.Big1, data), signer, senderKey)
+		nonce++
+		usedGas := uint64(0)
+		gp := new(GasPool).AddGas(params.GenesisGasLimit)
+		receipt, gas, err, _ := applyTransaction(config, nil, gp, statedb, coinbaseOwner, big.NewInt(1), nil, common.Hash{}, tx, &usedGas, roundMasternodes, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the proof is paid for even if it's invalid
+		if want, _ := IntrinsicGas(data, nil, false, true, false); gas != want || receipt.GasUsed != want || usedGas != want || gp.Gas() != params.GenesisGasLimit-want {
+			t.Fatalf("gas mismatch: have %d, receipt %d, used %d, want %d", gas, receipt.GasUsed, usedGas, want)
+		}
+		return receipt
+	}
+
+	// votes of different rounds can't be verified without the chain
+	if receipt := apply(&types.VoteEquivocationContent{SmallerRoundVote: vote("b1", 10), LargerRoundVote: vote("b2", 11), Signer: offender}); receipt.Status != types.ReceiptStatusFailed {
+		t.Fatal("votes of different rounds are slashed")
+	}
+	// only masternodes of the round are slashed
+	if receipt := apply(&types.VoteEquivocationContent{SmallerRoundVote: vote("b1", 11), LargerRoundVote: vote("b2", 11), Signer: offender}); receipt.Status != types.ReceiptStatusFailed {
+		t.Fatal("vote equivocation of an unknown round is slashed")
+	}
+	proof := &types.VoteEquivocationContent{SmallerRoundVote: vote("b1", 10), LargerRoundVote: vote("b2", 10), Signer: offender}
+	masternodes = []common.Address{owner}
+	if receipt := apply(proof); receipt.Status != types.ReceiptStatusFailed {
+		t.Fatal("vote equivocation of a non-masternode is slashed")
+	}
+	masternodes = []common.Address{offender}
+	if receipt := apply(proof); receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatal("vote equivocation is not slashed")
+	}
+	if number := state.GetLastSlashedBlock(statedb, offender); number != 1 {
+		t.Fatalf("last slashed block mismatch: have %d, want 1", number)
+	}
+	slashed := new(big.Int).Div(stake, big.NewInt(10))
+	left := new(big.Int).Sub(stake, slashed)
+	if cap := state.GetCandidateCap(statedb, offender); cap.Cmp(left) != 0 {
+		t.Fatalf("candidate cap mismatch: have %v, want %v", cap, left)
+	}
+	if cap := state.GetVoterCap(statedb, offender, owner); cap.Cmp(left) != 0 {
+		t.Fatalf("owner cap mismatch: have %v, want %v", cap, left)
+	}
+	if balance := statedb.GetBalance(common.MasternodeVotingSMCBinary); balance.Cmp(left) != 0 {
+		t.Fatalf("validator contract balance mismatch: have %v, want %v", balance, left)
+	}
+	// the same equivocation is only slashed once
+	if receipt := apply(proof); receipt.Status != types.ReceiptStatusFailed {
+		t.Fatal("vote equivocation is slashed twice")
+	}
+	// BLS signed votes are checked against the key of the epoch of the round, the offender rotating its key after
+	// equivocating doesn't void the proof
+	blsKey, _ := bls.GenerateKey()
+	rotatedKey, _ := bls.GenerateKey()
+	blsVote := func(hash string, round types.Round) *types.Vote {
+		blockInfo := &types.BlockInfo{Hash: common.StringToHash(hash), Round: round, Number: big.NewInt(920)}
+		sig := blsKey.Sign(types.VoteSigHash(&types.VoteForSign{ProposedBlockInfo: blockInfo, GapNumber: 450}).Bytes())
+		return &types.Vote{ProposedBlockInfo: blockInfo, Signature: sig.Bytes(), GapNumber: 450, BLSSigner: offender}
+	}
+	blsProof := &types.VoteEquivocationContent{SmallerRoundVote: blsVote("b1", 20), LargerRoundVote: blsVote("b2", 20), Signer: offender}
+	state.SetCandidateBLSPublicKey(statedb, offender, rotatedKey.PublicKey().Bytes())
+	blsPublicKeys[offender] = rotatedKey.PublicKey().Bytes()
+	if receipt := apply(blsProof); receipt.Status != types.ReceiptStatusFailed {
+		t.Fatal("vote equivocation is slashed with a key the votes aren't signed with")
+	}
+	blsPublicKeys[offender] = blsKey.PublicKey().Bytes()
+	if receipt := apply(blsProof); receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatal("vote equivocation is not slashed after a key rotation")
+	}
+	if !state.IsSlashed(statedb, offender, 20) {
+		t.Fatal("offender is not slashed for the round after a key rotation")
+	}
+	// the fees of the proofs go to the coinbase owner
+	if fees := new(big.Int).Sub(big.NewInt(params.Ether), statedb.GetBalance(sender)); fees.Sign() <= 0 || fees.Cmp(statedb.GetBalance(coinbaseOwner)) != 0 {
+		t.Fatalf("fees mismatch: paid %v, received %v", fees, statedb.GetBalance(coinbaseOwner))
+	}
+}
+
+func TestApplyBLSRegistrationTransaction(t *testing.T) {
+	defer func(tipBLS *big.Int) { common.TIPBLS = tipBLS }(common.TIPBLS)
+	common.TIPBLS = big.NewInt(0)
+
+	var (
+		config         = &params.ChainConfig{ChainId: big.NewInt(1), EIP155Block: big.NewInt(0), EIP158Block: big.NewInt(0), ByzantiumBlock: big.NewInt(0)}
+		signer         = types.LatestSigner(config)
+		ownerKey, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		otherKey, _    = crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+		owner          = crypto.PubkeyToAddress(ownerKey.PublicKey)
+		candidate      = common.HexToAddress("0x5678")
+		otherCandidate = common.HexToAddress("0x9abc")
+		coinbaseOwner  = common.HexToAddress("0xdef0")
+		statedb, _     = state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+		blsKey, _      = bls.GenerateKey()
+		otherBLSKey, _ = bls.GenerateKey()
+	)
+	// register the candidates in the validator contract, owned by owner
+	statedb.SetCode(common.MasternodeVotingSMCBinary, []byte{0x1})
+	statedb.SetState(common.MasternodeVotingSMCBinary, common.BigToHash(state.GetLocMappingAtKey(candidate.Hash(), 1)), owner.Hash())
+	statedb.SetState(common.MasternodeVotingSMCBinary, common.BigToHash(state.GetLocMappingAtKey(otherCandidate.Hash(), 1)), owner.Hash())
+
+	statedb.SetBalance(owner, big.NewInt(params.Ether))
+	statedb.SetBalance(crypto.PubkeyToAddress(otherKey.PublicKey), big.NewInt(params.Ether))
+
+	nonces := make(map[common.Address]uint64)
+	apply := func(key *ecdsa.PrivateKey, data []byte) *types.Receipt {
+		t.Helper()
+		from := crypto.PubkeyToAddress(key.PublicKey)
+		tx, _ := types.SignTx(types.NewTransaction(nonces[from], common.BLSRegistrationAddressBinary, common.Big0, 100000, common.Big1, data), signer, key)
+		nonces[from]++
+		usedGas := uint64(0)
+		gp := new(GasPool).AddGas(params.GenesisGasLimit)
+		balance := statedb.GetBalance(from)
+		receipt, gas, err, _ := applyTransaction(config, nil, gp, statedb, coinbaseOwner, big.NewInt(1), nil, common.Hash{}, tx, &usedGas, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the registration is paid for even if it's invalid
+		if want, _ := IntrinsicGas(data, nil, false, true, false); gas != want || receipt.GasUsed != want || usedGas != want || gp.Gas() != params.GenesisGasLimit-want {
+			t.Fatalf("gas mismatch: have %d, receipt %d, used %d, want %d", gas, receipt.GasUsed, usedGas, want)
+		}
+		if paid := new(big.Int).Sub(balance, statedb.GetBalance(from)); paid.Uint64() != gas {
+			t.Fatalf("fee mismatch: paid %v, want %d", paid, gas)
+		}
+		return receipt
+	}
+	registration := func(candidate common.Address, key *bls.SecretKey, proof *bls.Signature) []byte {
+		data := append(candidate.Bytes(), key.PublicKey().Bytes()...)
+		return append(data, proof.Bytes()...)
+	}
+
+	if receipt := apply(otherKey, registration(candidate, blsKey, blsKey.Prove(candidate.Bytes()))); receipt.Status != types.ReceiptStatusFailed {
+		t.Fatal("key registered by a stranger")
+	}
+	if receipt := apply(ownerKey, registration(candidate, blsKey, otherBLSKey.Prove(candidate.Bytes()))); receipt.Status != types.ReceiptStatusFailed {
+		t.Fatal("key registered with an invalid proof of possession")
+	}
+	if receipt := apply(ownerKey, registration(candidate, blsKey, blsKey.Prove(otherCandidate.Bytes()))); receipt.Status != types.ReceiptStatusFailed {
+		t.Fatal("key registered with the proof of possession of another candidate")
+	}
+	if receipt := apply(ownerKey, registration(common.HexToAddress("0x1234"), blsKey, blsKey.Prove(common.HexToAddress("0x1234").Bytes()))); receipt.Status != types.ReceiptStatusFailed {
+		t.Fatal("key registered for a non-candidate")
+	}
+	if key := state.GetCandidateBLSPublicKey(statedb, candidate); len(key) != 0 {
+		t.Fatalf("unexpected key after failed registrations: %x", key)
+	}
+	if receipt := apply(ownerKey, registration(candidate, blsKey, blsKey.Prove(candidate.Bytes()))); receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatal("valid registration failed")
+	}
+	if key := state.GetCandidateBLSPublicKey(statedb, candidate); !bytes.Equal(key, blsKey.PublicKey().Bytes()) {
+		t.Fatalf("registered key mismatch: have %x, want %x", key, blsKey.PublicKey().Bytes())
+	}
+	// a key is registered once, whatever the candidate
+	if receipt := apply(ownerKey, registration(otherCandidate, blsKey, blsKey.Prove(otherCandidate.Bytes()))); receipt.Status != types.ReceiptStatusFailed {
+		t.Fatal("key registered for two candidates")
+	}
+	if receipt := apply(ownerKey, registration(candidate, blsKey, blsKey.Prove(candidate.Bytes()))); receipt.Status != types.ReceiptStatusFailed {
+		t.Fatal("key registered twice")
+	}
+	// the candidate may rotate to a new key
+	if receipt := apply(ownerKey, registration(candidate, otherBLSKey, otherBLSKey.Prove(candidate.Bytes()))); receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatal("key rotation failed")
+	}
+	if key := state.GetCandidateBLSPublicKey(statedb, candidate); !bytes.Equal(key, otherBLSKey.PublicKey().Bytes()) {
+		t.Fatalf("rotated key mismatch: have %x, want %x", key, otherBLSKey.PublicKey().Bytes())
+	}
+	if key := state.GetCandidateBLSPublicKey(statedb, otherCandidate); len(key) != 0 {
+		t.Fatalf("unexpected key of the other candidate: %x", key)
+	}
+	// the keys are kept by the registration system address, not the validator contract
+	if statedb.GetNonce(common.BLSRegistrationAddressBinary) == 0 {
+		t.Fatal("registration address is empty")
+	}
+}
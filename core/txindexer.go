@@ -0,0 +1,215 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"BRDPoSChain/core/rawdb"
+	"BRDPoSChain/ethdb"
+	"BRDPoSChain/log"
+)
+
+// errTxIndexerClosed is returned if the progress of a stopped indexer is queried.
+var errTxIndexerClosed = errors.New("transaction indexer is closed")
+
+// TxIndexProgress is the struct describing the progress for transaction indexing.
+type TxIndexProgress struct {
+	Indexed   uint64 // number of blocks whose transactions are indexed
+	Remaining uint64 // number of blocks whose transactions are not indexed yet
+	Tail      uint64 // oldest block whose transactions are indexed
+}
+
+// Done returns an indicator if the transaction indexing is finished.
+func (progress TxIndexProgress) Done() bool {
+	return progress.Remaining == 0
+}
+
+// txIndexer is the module responsible for maintaining transaction indexes
+// according to the configured indexing range by users.
+type txIndexer struct {
+	// limit is the maximum number of blocks from head whose tx indexes
+	// are reserved:
+	//  * 0: means the entire chain should be indexed
+	//  * N: means the latest N blocks [HEAD-N+1, HEAD] should be indexed
+	//       and all others shouldn't.
+	limit    uint64
+	db       ethdb.Database
+	progress chan chan TxIndexProgress
+	term     chan chan struct{}
+	closed   chan struct{}
+}
+
+// newTxIndexer initializes the transaction indexer.
+func newTxIndexer(limit uint64, chain *BlockChain) *txIndexer {
+	indexer := &txIndexer{
+		limit:    limit,
+		db:       chain.db,
+		progress: make(chan chan TxIndexProgress),
+		term:     make(chan chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	go indexer.loop(chain)
+
+	if limit != 0 {
+		log.Info("Initialized transaction indexer", "range", fmt.Sprintf("last %d blocks", limit))
+	}
+	return indexer
+}
+
+// run executes the scheduled indexing/unindexing task in a separate thread.
+// If the stop channel is closed, the task should be terminated as soon as
+// possible, the done channel will be closed once the task is finished.
+func (indexer *txIndexer) run(tail *uint64, head uint64, stop chan struct{}, done chan struct{}) {
+	defer func() { close(done) }()
+
+	// Short circuit if chain is empty and nothing to index.
+	if head == 0 {
+		return
+	}
+	// Every block used to be indexed on import, so a missing tail flag means
+	// that the entire chain is indexed.
+	from := uint64(0)
+	if tail != nil {
+		from = *tail
+	}
+	// The tail flag might be above the head after a rewind, in which case the
+	// blocks in between will be indexed again on import.
+	if from > head {
+		from = head
+	}
+	switch wanted := indexer.wantedTail(head); {
+	case wanted < from:
+		// Reindex a part of missing indices and rewind index tail to HEAD-limit
+		rawdb.IndexTransactions(indexer.db, wanted, from, stop)
+	case wanted > from:
+		// Unindex a part of stale indices and forward index tail to HEAD-limit
+		rawdb.UnindexTransactions(indexer.db, from, wanted, stop)
+	case tail == nil:
+		// Nothing to (un)index, but persist the tail so the range is known
+		rawdb.WriteTxIndexTail(indexer.db, from)
+	}
+}
+
+// wantedTail returns the oldest block whose transactions should be indexed
+// with the given chain head.
+func (indexer *txIndexer) wantedTail(head uint64) uint64 {
+	if indexer.limit == 0 || head < indexer.limit {
+		return 0
+	}
+	return head - indexer.limit + 1
+}
+
+// loop is the scheduler of the indexer, assigning indexing/unindexing tasks depending
+// on the received chain event.
+func (indexer *txIndexer) loop(chain *BlockChain) {
+	defer close(indexer.closed)
+
+	// Listening to chain events and manipulate the transaction indexes.
+	var (
+		stop     chan struct{} // Non-nil if background routine is active.
+		done     chan struct{} // Non-nil if background routine is active.
+		lastHead uint64        // The latest announced chain head (whose tx indexes are assumed created)
+
+		headCh = make(chan ChainHeadEvent)
+		sub    = chain.SubscribeChainHeadEvent(headCh)
+	)
+	defer sub.Unsubscribe()
+
+	// Launch the initial processing if chain is not empty (head != genesis).
+	// This step is useful in these scenarios that chain has no progress.
+	if head := chain.CurrentBlock(); head != nil && head.NumberU64() != 0 {
+		stop = make(chan struct{})
+		done = make(chan struct{})
+		lastHead = head.NumberU64()
+		go indexer.run(rawdb.ReadTxIndexTail(indexer.db), head.NumberU64(), stop, done)
+	}
+	for {
+		select {
+		case head := <-headCh:
+			if done == nil {
+				stop = make(chan struct{})
+				done = make(chan struct{})
+				go indexer.run(rawdb.ReadTxIndexTail(indexer.db), head.Block.NumberU64(), stop, done)
+			}
+			lastHead = head.Block.NumberU64()
+		case <-done:
+			stop = nil
+			done = nil
+		case ch := <-indexer.progress:
+			ch <- indexer.report(lastHead)
+		case ch := <-indexer.term:
+			if stop != nil {
+				close(stop)
+			}
+			if done != nil {
+				log.Info("Waiting background transaction indexer to exit")
+				<-done
+			}
+			close(ch)
+			return
+		}
+	}
+}
+
+// report returns the tx indexing progress.
+func (indexer *txIndexer) report(head uint64) TxIndexProgress {
+	var (
+		wanted = indexer.wantedTail(head)
+		tail   uint64
+	)
+	if stored := rawdb.ReadTxIndexTail(indexer.db); stored != nil {
+		tail = *stored
+	}
+	if tail > head {
+		tail = head
+	}
+	// Blocks below the wanted tail still waiting for removal don't count as
+	// missing, only the ones that still need to be indexed do.
+	var remaining uint64
+	if tail > wanted {
+		remaining = tail - wanted
+	}
+	return TxIndexProgress{
+		Indexed:   head - tail + 1,
+		Remaining: remaining,
+		Tail:      tail,
+	}
+}
+
+// txIndexProgress retrieves the tx indexing progress, or an error if the
+// background tx indexer is already stopped.
+func (indexer *txIndexer) txIndexProgress() (TxIndexProgress, error) {
+	ch := make(chan TxIndexProgress, 1)
+	select {
+	case indexer.progress <- ch:
+		return <-ch, nil
+	case <-indexer.closed:
+		return TxIndexProgress{}, errTxIndexerClosed
+	}
+}
+
+// close shutdown the indexer. Safe to be called for multiple times.
+func (indexer *txIndexer) close() {
+	ch := make(chan struct{})
+	select {
+	case indexer.term <- ch:
+		<-ch
+	case <-indexer.closed:
+	}
+}
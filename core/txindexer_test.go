@@ -0,0 +1,113 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/consensus/ethash"
+	"BRDPoSChain/core/rawdb"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/core/vm"
+	"BRDPoSChain/crypto"
+	"BRDPoSChain/params"
+)
+
+// Tests that the transaction indexer keeps lookup entries only for the configured
+// range, unindexing the tail when the limit shrinks and reindexing it when the
+// limit is raised again.
+func TestTxIndexer(t *testing.T) {
+	var (
+		gendb   = rawdb.NewMemoryDatabase()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{
+			Config:  params.TestChainConfig,
+			Alloc:   types.GenesisAlloc{address: {Balance: new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(1000))}},
+			BaseFee: big.NewInt(params.InitialBaseFee),
+		}
+		genesis = gspec.MustCommit(gendb)
+		signer  = types.LatestSigner(gspec.Config)
+		chainDb = rawdb.NewMemoryDatabase()
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, 128, func(i int, block *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x00}, big.NewInt(1000), params.TxGas, block.header.BaseFee, nil), signer, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	gspec.MustCommit(chainDb)
+
+	// verify waits for the indexer to settle and checks the lookup entries
+	verify := func(chain *BlockChain, tail uint64) {
+		t.Helper()
+
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			progress, err := chain.TxIndexProgress()
+			if err != nil {
+				t.Fatalf("failed to retrieve indexing progress: %v", err)
+			}
+			if stored := rawdb.ReadTxIndexTail(chainDb); progress.Done() && stored != nil && *stored == tail {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("indexer didn't settle, progress %+v, want tail %d", progress, tail)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		for _, block := range blocks {
+			for _, tx := range block.Transactions() {
+				entry := rawdb.ReadTxLookupEntry(chainDb, tx.Hash())
+				if block.NumberU64() < tail && entry != nil {
+					t.Errorf("block %d: stale lookup entry left", block.NumberU64())
+				}
+				if block.NumberU64() >= tail && (entry == nil || *entry != block.NumberU64()) {
+					t.Errorf("block %d: lookup entry mismatch: have %v", block.NumberU64(), entry)
+				}
+			}
+		}
+	}
+	// Import the chain indexing everything
+	chain, err := NewBlockChain(chainDb, nil, gspec.Config, ethash.NewFaker(), vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	verify(chain, 0)
+	chain.Stop()
+
+	// Shrink the range and raise it again, the indexer should follow
+	for _, limit := range []uint64{32, 64, 0} {
+		chain, err = NewBlockChain(chainDb, &CacheConfig{TrieNodeLimit: 256 * 1024 * 1024, TrieTimeLimit: 5 * time.Minute, TxLookupLimit: limit}, gspec.Config, ethash.NewFaker(), vm.Config{})
+		if err != nil {
+			t.Fatalf("failed to reopen chain: %v", err)
+		}
+		tail := uint64(0)
+		if limit != 0 {
+			tail = uint64(len(blocks)) - limit + 1
+		}
+		verify(chain, tail)
+		chain.Stop()
+	}
+}
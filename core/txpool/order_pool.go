@@ -49,11 +49,17 @@ var (
 	ErrInvalidOrderPrice       = errors.New("invalid order price")
 	ErrInvalidOrderHash        = errors.New("invalid order hash")
 	ErrInvalidCancelledOrder   = errors.New("invalid cancel orderid")
+	ErrInvalidOrderStopPrice   = errors.New("invalid order stop price")
+	ErrOrderTypeNotEnabled     = errors.New("order type is not enabled yet")
 )
 
 var (
 	OrderTypeLimit    = "LO"
 	OrderTypeMarket   = "MO"
+	OrderTypePostOnly = "PO"
+	OrderTypeIOC      = "IOC"
+	OrderTypeFOK      = "FOK"
+	OrderTypeStop     = "SL"
 	OrderStatusNew    = "NEW"
 	OrderStatusCancle = "CANCELLED"
 	OrderSideBid      = "BUY"
@@ -455,14 +461,27 @@ func (pool *OrderPool) validateOrder(tx *types.OrderTransaction) error {
 		if orderSide != OrderSideAsk && orderSide != OrderSideBid {
 			return ErrInvalidOrderSide
 		}
-		if orderType != OrderTypeLimit && orderType != OrderTypeMarket {
+		switch orderType {
+		case OrderTypeLimit, OrderTypeMarket:
+		case OrderTypePostOnly, OrderTypeIOC, OrderTypeFOK, OrderTypeStop:
+			// the order is matched in the next block at the earliest
+			nextBlock := new(big.Int).Add(pool.chain.CurrentBlock().Number(), common.Big1)
+			if !pool.chainconfig.IsTIPBRCXOrderTypes(nextBlock) {
+				return ErrOrderTypeNotEnabled
+			}
+			if orderType == OrderTypeStop {
+				if stopPrice := tx.StopPrice(); stopPrice == nil || stopPrice.Sign() <= 0 {
+					return ErrInvalidOrderStopPrice
+				}
+			}
+		default:
 			return ErrInvalidOrderType
 		}
 		if err := tradingstate.VerifyPair(cloneStateDb, tx.ExchangeAddress(), tx.BaseToken(), tx.QuoteToken()); err != nil {
 			return err
 		}
 
-		if orderType == OrderTypeLimit {
+		if orderType != OrderTypeMarket {
 			BRDPoSEngine, ok := pool.chain.Engine().(*BRDPoS.BRDPoS)
 			if !ok {
 				return core.ErrNotBRDPoS
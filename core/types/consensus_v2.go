@@ -25,6 +25,8 @@ type Vote struct {
 	ProposedBlockInfo *BlockInfo     `json:"proposedBlockInfo"`
 	Signature         Signature      `json:"signature"`
 	GapNumber         uint64         `json:"gapNumber"`
+	// BLSSigner is the masternode claiming a BLS signed vote, as the signer can't be recovered from a BLS signature
+	BLSSigner common.Address `json:"blsSigner" rlp:"optional"`
 }
 
 func (v *Vote) Hash() common.Hash {
@@ -50,6 +52,7 @@ type Timeout struct {
 	Round     Round
 	Signature Signature
 	GapNumber uint64
+	BLSSigner common.Address `rlp:"optional"` // masternode claiming a BLS signed timeout
 }
 
 func (t *Timeout) Hash() common.Hash {
@@ -80,17 +83,35 @@ func (s *SyncInfo) Hash() common.Hash {
 }
 
 // Quorum Certificate struct in BRDPoS 2.0
+// After TIPBLS, Signatures is empty and the votes are aggregated into AggregatedSignature. Bit i of SignerBitmap
+// is set if the i-th masternode of the epoch signed the certificate.
 type QuorumCert struct {
-	ProposedBlockInfo *BlockInfo  `json:"proposedBlockInfo"`
-	Signatures        []Signature `json:"signatures"`
-	GapNumber         uint64      `json:"gapNumber"`
+	ProposedBlockInfo   *BlockInfo  `json:"proposedBlockInfo"`
+	Signatures          []Signature `json:"signatures"`
+	GapNumber           uint64      `json:"gapNumber"`
+	AggregatedSignature Signature   `json:"aggregatedSignature,omitempty" rlp:"optional"`
+	SignerBitmap        []byte      `json:"signerBitmap,omitempty" rlp:"optional"`
+}
+
+// IsAggregated returns whether the QC carries a BLS aggregate signature instead of the ECDSA signatures
+func (qc *QuorumCert) IsAggregated() bool {
+	return len(qc.AggregatedSignature) != 0
 }
 
 // Timeout Certificate struct in BRDPoS 2.0
+// After TIPBLS, the timeouts are aggregated into AggregatedSignature and bit i of SignerBitmap is set if
+// the i-th candidate of the gap block snapshot signed the certificate.
 type TimeoutCert struct {
-	Round      Round
-	Signatures []Signature
-	GapNumber  uint64
+	Round               Round
+	Signatures          []Signature
+	GapNumber           uint64
+	AggregatedSignature Signature `rlp:"optional"`
+	SignerBitmap        []byte    `rlp:"optional"`
+}
+
+// IsAggregated returns whether the TC carries a BLS aggregate signature instead of the ECDSA signatures
+func (tc *TimeoutCert) IsAggregated() bool {
+	return len(tc.AggregatedSignature) != 0
 }
 
 // The parsed extra fields in block header in BRDPoS 2.0 (excluding the version byte)
@@ -114,3 +114,44 @@ func TestPoolKeyFormat(t *testing.T) {
 	assert.Equal(t, "4", voteKey[2])
 	assert.Equal(t, common.Hash{1}.String(), voteKey[3])
 }
+
+func TestAggregatedCertEncodeDecode(t *testing.T) {
+	// A QC without aggregated signature keeps the encoding from before TIPBLS
+	legacy, err := rlp.EncodeToBytes([]interface{}{toyExtraFields().QuorumCert.ProposedBlockInfo, toyExtraFields().QuorumCert.Signatures, uint64(450)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := rlp.EncodeToBytes(toyExtraFields().QuorumCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, legacy, encoded)
+
+	extraFields := toyExtraFields()
+	extraFields.QuorumCert.Signatures = nil
+	extraFields.QuorumCert.AggregatedSignature = []byte{9, 8, 7}
+	extraFields.QuorumCert.SignerBitmap = []byte{0x05}
+	encoded, err = extraFields.EncodeToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded ExtraFields_v2
+	if err := DecodeBytesExtraFields(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, decoded.QuorumCert.IsAggregated())
+	assert.Equal(t, extraFields.QuorumCert.AggregatedSignature, decoded.QuorumCert.AggregatedSignature)
+	assert.Equal(t, extraFields.QuorumCert.SignerBitmap, decoded.QuorumCert.SignerBitmap)
+
+	timeoutCert := &TimeoutCert{Round: 10, GapNumber: 450, AggregatedSignature: []byte{1}, SignerBitmap: []byte{0x03}}
+	encoded, err = rlp.EncodeToBytes(timeoutCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decodedTC TimeoutCert
+	if err := rlp.DecodeBytes(encoded, &decodedTC); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, decodedTC.IsAggregated())
+	assert.Equal(t, timeoutCert.SignerBitmap, decodedTC.SignerBitmap)
+}
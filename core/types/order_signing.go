@@ -114,11 +114,14 @@ func (ordersign OrderTxSigner) OrderCreateHash(tx *OrderTransaction) common.Hash
 	sha.Write(tx.BaseToken().Bytes())
 	sha.Write(tx.QuoteToken().Bytes())
 	sha.Write(common.BigToHash(tx.Quantity()).Bytes())
-	if tx.IsLoTypeOrder() {
+	if !tx.IsMoTypeOrder() {
 		if tx.Price() != nil {
 			sha.Write(common.BigToHash(tx.Price()).Bytes())
 		}
 	}
+	if tx.IsSlTypeOrder() && tx.StopPrice() != nil {
+		sha.Write(common.BigToHash(tx.StopPrice()).Bytes())
+	}
 	sha.Write(common.BigToHash(tx.EncodedSide()).Bytes())
 	sha.Write([]byte(tx.Status()))
 	sha.Write([]byte(tx.Type()))
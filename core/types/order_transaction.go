@@ -40,6 +40,10 @@ const (
 	OrderStatusCancelled     = "CANCELLED"
 	OrderTypeMo              = "MO"
 	OrderTypeLo              = "LO"
+	OrderTypePo              = "PO"
+	OrderTypeIoc             = "IOC"
+	OrderTypeFok             = "FOK"
+	OrderTypeSl              = "SL"
 )
 
 // OrderTransaction order transaction
@@ -70,6 +74,9 @@ type ordertxdata struct {
 
 	// This is only used when marshaling to JSON.
 	Hash common.Hash `json:"hash"`
+
+	// Trigger price of stop-limit orders
+	StopPrice *big.Int `json:"stopPrice,omitempty" rlp:"optional"`
 }
 
 // IsCancelledOrder check if tx is cancelled transaction
@@ -87,6 +94,11 @@ func (tx *OrderTransaction) IsLoTypeOrder() bool {
 	return tx.Type() == OrderTypeLo
 }
 
+// IsSlTypeOrder check if tx type is stop-limit Order
+func (tx *OrderTransaction) IsSlTypeOrder() bool {
+	return tx.Type() == OrderTypeSl
+}
+
 // EncodeRLP implements rlp.Encoder
 func (tx *OrderTransaction) EncodeRLP(w io.Writer) error {
 	return rlp.Encode(w, &tx.data)
@@ -117,6 +129,7 @@ func (tx *OrderTransaction) Type() string                    { return tx.data.Ty
 func (tx *OrderTransaction) Signature() (V, R, S *big.Int)   { return tx.data.V, tx.data.R, tx.data.S }
 func (tx *OrderTransaction) OrderHash() common.Hash          { return tx.data.Hash }
 func (tx *OrderTransaction) OrderID() uint64                 { return tx.data.OrderID }
+func (tx *OrderTransaction) StopPrice() *big.Int             { return tx.data.StopPrice }
 func (tx *OrderTransaction) EncodedSide() *big.Int {
 	if tx.Side() == "BUY" {
 		return big.NewInt(0)
@@ -126,6 +139,15 @@ func (tx *OrderTransaction) EncodedSide() *big.Int {
 }
 func (tx *OrderTransaction) SetOrderHash(h common.Hash) { tx.data.Hash = h }
 
+// SetStopPrice sets the trigger price of a stop-limit order, nil clears it
+func (tx *OrderTransaction) SetStopPrice(price *big.Int) {
+	if price == nil {
+		tx.data.StopPrice = nil
+		return
+	}
+	tx.data.StopPrice = new(big.Int).Set(price)
+}
+
 // From get transaction from
 func (tx *OrderTransaction) From() *common.Address {
 	if tx.data.V != nil {
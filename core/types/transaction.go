@@ -505,6 +505,11 @@ func (tx *Transaction) IsLendingFinalizedTradeTransaction() bool {
 	return to != nil && *to == common.BRCXLendingFinalizedTradeAddressBinary
 }
 
+func (tx *Transaction) IsBLSRegistrationTransaction() bool {
+	to := tx.To()
+	return to != nil && *to == common.BLSRegistrationAddressBinary
+}
+
 func (tx *Transaction) IsSkipNonceTransaction() bool {
 	to := tx.To()
 	return to != nil && skipNonceDestinationAddress[*to]
@@ -0,0 +1,260 @@
+// Copyright (c) 2024 BRDPoSChain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package bls implements BLS signatures over the BLS12-381 curve, with public
+// keys in G1 and signatures in G2 (the "minimal public key size" variant). Keys
+// must be registered with a proof of possession, which makes it safe to verify
+// aggregate signatures over a single message against the plain sum of the
+// public keys.
+package bls
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+)
+
+const (
+	// SecretKeyLength is the length of a serialized secret key.
+	SecretKeyLength = fr.Bytes
+	// PublicKeyLength is the length of a compressed public key.
+	PublicKeyLength = bls12381.SizeOfG1AffineCompressed
+	// SignatureLength is the length of a compressed signature.
+	SignatureLength = bls12381.SizeOfG2AffineCompressed
+)
+
+var (
+	// dstSignature and dstPossession are the domain separation tags of the
+	// proof of possession ciphersuite of the IETF BLS signature draft.
+	dstSignature  = []byte("BLS_SIG_BLS12381G2_XMD:SHA-256_SSWU_RO_POP_")
+	dstPossession = []byte("BLS_POP_BLS12381G2_XMD:SHA-256_SSWU_RO_POP_")
+)
+
+var (
+	errInvalidSecretKey = errors.New("invalid BLS secret key")
+	errInvalidPublicKey = errors.New("invalid BLS public key")
+	errInvalidSignature = errors.New("invalid BLS signature")
+)
+
+// SecretKey is a BLS secret key.
+type SecretKey struct {
+	k fr.Element
+}
+
+// PublicKey is a BLS public key, a point in G1.
+type PublicKey struct {
+	p bls12381.G1Affine
+}
+
+// Signature is a BLS signature, a point in G2.
+type Signature struct {
+	p bls12381.G2Affine
+}
+
+// GenerateKey creates a new random secret key.
+func GenerateKey() (*SecretKey, error) {
+	sk := new(SecretKey)
+	for sk.k.IsZero() {
+		if _, err := sk.k.SetRandom(); err != nil {
+			return nil, err
+		}
+	}
+	return sk, nil
+}
+
+// SecretKeyFromBytes parses a big endian encoded secret key.
+func SecretKeyFromBytes(b []byte) (*SecretKey, error) {
+	if len(b) != SecretKeyLength {
+		return nil, errInvalidSecretKey
+	}
+	sk := new(SecretKey)
+	if err := sk.k.SetBytesCanonical(b); err != nil {
+		return nil, errInvalidSecretKey
+	}
+	if sk.k.IsZero() {
+		return nil, errInvalidSecretKey
+	}
+	return sk, nil
+}
+
+// Bytes returns the big endian encoding of the secret key.
+func (sk *SecretKey) Bytes() []byte {
+	b := sk.k.Bytes()
+	return b[:]
+}
+
+// PublicKey returns the public key belonging to the secret key.
+func (sk *SecretKey) PublicKey() *PublicKey {
+	pk := new(PublicKey)
+	pk.p.ScalarMultiplicationBase(sk.k.BigInt(new(big.Int)))
+	return pk
+}
+
+// Sign signs the message with the secret key.
+func (sk *SecretKey) Sign(msg []byte) *Signature {
+	return sk.sign(msg, dstSignature)
+}
+
+// Prove creates the proof of possession of the secret key, which has to be
+// presented along with the public key before the key is trusted in aggregate
+// verification. The proof is bound to the given context, e.g. the account the
+// key is registered for, so it can't be replayed for another one.
+func (sk *SecretKey) Prove(context []byte) *Signature {
+	return sk.sign(possessionMessage(sk.PublicKey(), context), dstPossession)
+}
+
+func (sk *SecretKey) sign(msg, dst []byte) *Signature {
+	h, err := bls12381.HashToG2(msg, dst)
+	if err != nil {
+		// Hashing only fails on an oversized tag, which is a constant here
+		panic(err)
+	}
+	sig := new(Signature)
+	sig.p.ScalarMultiplication(&h, sk.k.BigInt(new(big.Int)))
+	return sig
+}
+
+// PublicKeyFromBytes parses a compressed public key, checking that it is a
+// valid non-identity point of the G1 subgroup.
+func PublicKeyFromBytes(b []byte) (*PublicKey, error) {
+	if len(b) != PublicKeyLength {
+		return nil, errInvalidPublicKey
+	}
+	pk := new(PublicKey)
+	if _, err := pk.p.SetBytes(b); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidPublicKey, err)
+	}
+	if pk.p.IsInfinity() {
+		return nil, errInvalidPublicKey
+	}
+	return pk, nil
+}
+
+// Bytes returns the compressed encoding of the public key.
+func (pk *PublicKey) Bytes() []byte {
+	b := pk.p.Bytes()
+	return b[:]
+}
+
+// SignatureFromBytes parses a compressed signature, checking that it is a
+// point of the G2 subgroup.
+func SignatureFromBytes(b []byte) (*Signature, error) {
+	if len(b) != SignatureLength {
+		return nil, errInvalidSignature
+	}
+	sig := new(Signature)
+	if _, err := sig.p.SetBytes(b); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidSignature, err)
+	}
+	return sig, nil
+}
+
+// Bytes returns the compressed encoding of the signature.
+func (sig *Signature) Bytes() []byte {
+	b := sig.p.Bytes()
+	return b[:]
+}
+
+// AggregateSignatures sums the given signatures into a single one.
+func AggregateSignatures(sigs []*Signature) *Signature {
+	var acc bls12381.G2Jac
+	for _, sig := range sigs {
+		acc.AddMixed(&sig.p)
+	}
+	agg := new(Signature)
+	agg.p.FromJacobian(&acc)
+	return agg
+}
+
+// AggregatePublicKeys sums the given public keys into a single one.
+func AggregatePublicKeys(pks []*PublicKey) *PublicKey {
+	var acc bls12381.G1Jac
+	for _, pk := range pks {
+		acc.AddMixed(&pk.p)
+	}
+	agg := new(PublicKey)
+	agg.p.FromJacobian(&acc)
+	return agg
+}
+
+// Verify checks that the signature is valid for the message and public key.
+func Verify(pk *PublicKey, msg []byte, sig *Signature) bool {
+	return verify(pk, msg, sig, dstSignature)
+}
+
+// FastAggregateVerify checks that the aggregate signature was produced by all
+// the given public keys over the same message. The keys must have been
+// checked with VerifyPossession before.
+func FastAggregateVerify(pks []*PublicKey, msg []byte, sig *Signature) bool {
+	if len(pks) == 0 {
+		return false
+	}
+	return verify(AggregatePublicKeys(pks), msg, sig, dstSignature)
+}
+
+// VerifyPossession checks the proof of possession of a public key, bound to
+// the given context.
+func VerifyPossession(pk *PublicKey, proof *Signature, context []byte) bool {
+	return verify(pk, possessionMessage(pk, context), proof, dstPossession)
+}
+
+// possessionMessage is the message signed by a proof of possession.
+func possessionMessage(pk *PublicKey, context []byte) []byte {
+	return append(pk.Bytes(), context...)
+}
+
+// verify checks e(pk, H(msg)) == e(g1, sig).
+func verify(pk *PublicKey, msg []byte, sig *Signature, dst []byte) bool {
+	if pk.p.IsInfinity() {
+		return false
+	}
+	h, err := bls12381.HashToG2(msg, dst)
+	if err != nil {
+		return false
+	}
+	_, _, g1, _ := bls12381.Generators()
+	var negG1 bls12381.G1Affine
+	negG1.Neg(&g1)
+
+	ok, err := bls12381.PairingCheck([]bls12381.G1Affine{negG1, pk.p}, []bls12381.G2Affine{sig.p, h})
+	return err == nil && ok
+}
+
+// LoadKey loads a hex encoded secret key from the given file. Surrounding
+// whitespace is ignored.
+func LoadKey(file string) (*SecretKey, error) {
+	blob, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(blob)))
+	if err != nil {
+		return nil, err
+	}
+	return SecretKeyFromBytes(key)
+}
+
+// SaveKey saves a secret key to the given file with restrictive permissions.
+// The key data is saved hex-encoded.
+func SaveKey(file string, key *SecretKey) error {
+	k := hex.EncodeToString(key.Bytes())
+	return os.WriteFile(file, []byte(k), 0600)
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2024 BRDPoSChain
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package bls
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func newKeys(t *testing.T, n int) []*SecretKey {
+	keys := make([]*SecretKey, n)
+	for i := range keys {
+		key, err := GenerateKey()
+		if err != nil {
+			t.Fatalf("failed to generate key: %v", err)
+		}
+		keys[i] = key
+	}
+	return keys
+}
+
+func TestSignVerify(t *testing.T) {
+	keys := newKeys(t, 2)
+	msg := []byte("vote for block")
+
+	sig := keys[0].Sign(msg)
+	if !Verify(keys[0].PublicKey(), msg, sig) {
+		t.Fatal("valid signature rejected")
+	}
+	if Verify(keys[1].PublicKey(), msg, sig) {
+		t.Fatal("signature accepted for wrong key")
+	}
+	if Verify(keys[0].PublicKey(), []byte("other"), sig) {
+		t.Fatal("signature accepted for wrong message")
+	}
+	// Signatures and proofs of possession must not be interchangeable
+	if VerifyPossession(keys[0].PublicKey(), keys[0].Sign(keys[0].PublicKey().Bytes()), nil) {
+		t.Fatal("plain signature accepted as proof of possession")
+	}
+	if !VerifyPossession(keys[0].PublicKey(), keys[0].Prove([]byte("context")), []byte("context")) {
+		t.Fatal("valid proof of possession rejected")
+	}
+	if VerifyPossession(keys[0].PublicKey(), keys[0].Prove([]byte("context")), []byte("other")) {
+		t.Fatal("proof of possession accepted for another context")
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	keys := newKeys(t, 4)
+	msg := []byte("timeout for round")
+
+	var (
+		pks  []*PublicKey
+		sigs []*Signature
+	)
+	for _, key := range keys {
+		pks = append(pks, key.PublicKey())
+		sigs = append(sigs, key.Sign(msg))
+	}
+	agg := AggregateSignatures(sigs)
+	if !FastAggregateVerify(pks, msg, agg) {
+		t.Fatal("valid aggregate rejected")
+	}
+	if FastAggregateVerify(pks[:3], msg, agg) {
+		t.Fatal("aggregate accepted for a subset of the signers")
+	}
+	if FastAggregateVerify(pks, msg, AggregateSignatures(sigs[:3])) {
+		t.Fatal("partial aggregate accepted for all signers")
+	}
+	if FastAggregateVerify(nil, msg, agg) {
+		t.Fatal("aggregate accepted without signers")
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	key := newKeys(t, 1)[0]
+
+	dec, err := SecretKeyFromBytes(key.Bytes())
+	if err != nil || !bytes.Equal(dec.Bytes(), key.Bytes()) {
+		t.Fatalf("secret key roundtrip failed: %v", err)
+	}
+	pk, err := PublicKeyFromBytes(key.PublicKey().Bytes())
+	if err != nil || !bytes.Equal(pk.Bytes(), key.PublicKey().Bytes()) {
+		t.Fatalf("public key roundtrip failed: %v", err)
+	}
+	sig := key.Sign([]byte("msg"))
+	decSig, err := SignatureFromBytes(sig.Bytes())
+	if err != nil || !bytes.Equal(decSig.Bytes(), sig.Bytes()) {
+		t.Fatalf("signature roundtrip failed: %v", err)
+	}
+	if _, err := SecretKeyFromBytes(make([]byte, SecretKeyLength)); err == nil {
+		t.Error("zero secret key accepted")
+	}
+	if _, err := PublicKeyFromBytes(make([]byte, PublicKeyLength-1)); err == nil {
+		t.Error("short public key accepted")
+	}
+	if _, err := SignatureFromBytes(bytes.Repeat([]byte{0xff}, SignatureLength)); err == nil {
+		t.Error("garbage signature accepted")
+	}
+
+	file := filepath.Join(t.TempDir(), "bls.key")
+	if err := SaveKey(file, key); err != nil {
+		t.Fatalf("failed to save key: %v", err)
+	}
+	loaded, err := LoadKey(file)
+	if err != nil || !bytes.Equal(loaded.Bytes(), key.Bytes()) {
+		t.Fatalf("key file roundtrip failed: %v", err)
+	}
+}
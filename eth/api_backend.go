@@ -21,8 +21,6 @@ import (
 	"encoding/json"
 	"errors"
 	"math/big"
-	"os"
-	"path/filepath"
 
 	"BRDPoSChain/BRCx"
 	"BRDPoSChain/BRCx/tradingstate"
@@ -78,22 +76,12 @@ func (b *EthApiBackend) HeaderByNumber(ctx context.Context, blockNr rpc.BlockNum
 	// Otherwise resolve and return the block
 	if blockNr == rpc.LatestBlockNumber {
 		return b.eth.blockchain.CurrentBlock().Header(), nil
-	} else if blockNr == rpc.CommittedBlockNumber {
-		if b.eth.chainConfig.BRDPoS == nil {
-			return nil, errors.New("PoW does not support confirmed block lookup")
-		}
-		current := b.eth.blockchain.CurrentBlock().Header()
-		if b.eth.blockchain.Config().BRDPoS.BlockConsensusVersion(
-			current.Number,
-			current.Extra,
-			BRDPoS.ExtraFieldCheck,
-		) == params.ConsensusEngineVersion2 {
-			// TO CHECK: why calling config in BRDPoS is blocked (not field and method)
-			confirmedHash := b.BRDPoS.EngineV2.GetLatestCommittedBlockInfo().Hash
-			return b.eth.blockchain.GetHeaderByHash(confirmedHash), nil
-		} else {
-			return nil, errors.New("PoS V1 does not support confirmed block lookup")
+	} else if blockNr == rpc.CommittedBlockNumber || blockNr == rpc.SafeBlockNumber {
+		hash, err := b.consensusBlockHash(blockNr)
+		if err != nil {
+			return nil, err
 		}
+		return b.eth.blockchain.GetHeaderByHash(hash), nil
 	}
 	header := b.eth.blockchain.GetHeaderByNumber(uint64(blockNr))
 	if header == nil {
@@ -102,6 +90,27 @@ func (b *EthApiBackend) HeaderByNumber(ctx context.Context, blockNr rpc.BlockNum
 	return header, nil
 }
 
+// consensusBlockHash resolves the committed and safe block numbers to the blocks the BRDPoS v2 engine has
+// committed and certified with a quorum cert.
+func (b *EthApiBackend) consensusBlockHash(blockNr rpc.BlockNumber) (common.Hash, error) {
+	if b.eth.chainConfig.BRDPoS == nil {
+		return common.Hash{}, errors.New("PoW does not support confirmed block lookup")
+	}
+	current := b.eth.blockchain.CurrentBlock().Header()
+	if b.eth.blockchain.Config().BRDPoS.BlockConsensusVersion(
+		current.Number,
+		current.Extra,
+		BRDPoS.ExtraFieldCheck,
+	) != params.ConsensusEngineVersion2 {
+		return common.Hash{}, errors.New("PoS V1 does not support confirmed block lookup")
+	}
+	// TO CHECK: why calling config in BRDPoS is blocked (not field and method)
+	if blockNr == rpc.SafeBlockNumber {
+		return b.BRDPoS.EngineV2.GetLatestQCBlockInfo().Hash, nil
+	}
+	return b.BRDPoS.EngineV2.GetLatestCommittedBlockInfo().Hash, nil
+}
+
 func (b *EthApiBackend) HeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.Header, error) {
 	if blockNr, ok := blockNrOrHash.Number(); ok {
 		return b.HeaderByNumber(ctx, blockNr)
@@ -131,22 +140,12 @@ func (b *EthApiBackend) BlockByNumber(ctx context.Context, blockNr rpc.BlockNumb
 	// Otherwise resolve and return the block
 	if blockNr == rpc.LatestBlockNumber {
 		return b.eth.blockchain.CurrentBlock(), nil
-	} else if blockNr == rpc.CommittedBlockNumber {
-		if b.eth.chainConfig.BRDPoS == nil {
-			return nil, errors.New("PoW does not support confirmed block lookup")
-		}
-		current := b.eth.blockchain.CurrentBlock().Header()
-		if b.eth.blockchain.Config().BRDPoS.BlockConsensusVersion(
-			current.Number,
-			current.Extra,
-			BRDPoS.ExtraFieldCheck,
-		) == params.ConsensusEngineVersion2 {
-			// TO CHECK: why calling config in BRDPoS is blocked (not field and method)
-			confirmedHash := b.BRDPoS.EngineV2.GetLatestCommittedBlockInfo().Hash
-			return b.eth.blockchain.GetBlockByHash(confirmedHash), nil
-		} else {
-			return nil, errors.New("PoS V1 does not support confirmed block lookup")
+	} else if blockNr == rpc.CommittedBlockNumber || blockNr == rpc.SafeBlockNumber {
+		hash, err := b.consensusBlockHash(blockNr)
+		if err != nil {
+			return nil, err
 		}
+		return b.eth.blockchain.GetBlockByHash(hash), nil
 	}
 	return b.eth.blockchain.GetBlockByNumber(uint64(blockNr)), nil
 }
@@ -341,6 +340,10 @@ func (b *EthApiBackend) Downloader() *downloader.Downloader {
 	return b.eth.Downloader()
 }
 
+func (b *EthApiBackend) TxIndexProgress() (core.TxIndexProgress, error) {
+	return b.eth.blockchain.TxIndexProgress()
+}
+
 func (b *EthApiBackend) ProtocolVersion() int {
 	return b.eth.EthVersion()
 }
@@ -411,27 +414,20 @@ func (b *EthApiBackend) StateAtBlock(ctx context.Context, block *types.Block, re
 }
 
 func (s *EthApiBackend) GetRewardByHash(hash common.Hash) map[string]map[string]map[string]*big.Int {
+	rewards := make(map[string]map[string]map[string]*big.Int)
 	header := s.eth.blockchain.GetHeaderByHash(hash)
 	if header != nil {
-		data, err := os.ReadFile(filepath.Join(common.StoreRewardFolder, header.Number.String()+"."+header.Hash().Hex()))
-		if err == nil {
-			rewards := make(map[string]map[string]map[string]*big.Int)
-			err = json.Unmarshal(data, &rewards)
-			if err == nil {
-				return rewards
-			}
-		} else {
-			data, err = os.ReadFile(filepath.Join(common.StoreRewardFolder, header.Number.String()+"."+header.HashNoValidator().Hex()))
-			if err == nil {
-				rewards := make(map[string]map[string]map[string]*big.Int)
-				err = json.Unmarshal(data, &rewards)
-				if err == nil {
-					return rewards
-				}
+		data := rawdb.ReadRewards(s.eth.chainDb, header.Hash(), header.Number.Uint64())
+		if data == nil {
+			data = rawdb.ReadRewards(s.eth.chainDb, header.HashNoValidator(), header.Number.Uint64())
+		}
+		if data != nil {
+			if err := json.Unmarshal(data, &rewards); err != nil {
+				log.Error("Invalid rewards JSON", "number", header.Number, "hash", hash, "err", err)
 			}
 		}
 	}
-	return make(map[string]map[string]map[string]*big.Int)
+	return rewards
 }
 
 // GetVotersRewards return a map of voters of snapshot at given block hash
@@ -42,6 +42,7 @@ import (
 	"BRDPoSChain/core/txpool"
 	"BRDPoSChain/core/types"
 	"BRDPoSChain/core/vm"
+	"BRDPoSChain/crypto/bls"
 	"BRDPoSChain/eth/downloader"
 	"BRDPoSChain/eth/ethconfig"
 	"BRDPoSChain/eth/filters"
@@ -122,7 +123,7 @@ func New(ctx *node.ServiceContext, config *ethconfig.Config, BRCXServ *BRCx.BRCX
 	}
 
 	// Assemble the Ethereum object
-	chainDb, err := ctx.OpenDatabase("chaindata", config.DatabaseCache, config.DatabaseHandles, "eth/db/chaindata/", false)
+	chainDb, err := ctx.OpenDatabaseWithFreezer("chaindata", config.DatabaseCache, config.DatabaseHandles, config.DatabaseFreezer, "eth/db/chaindata/", false)
 	if err != nil {
 		return nil, err
 	}
@@ -185,7 +186,7 @@ func New(ctx *node.ServiceContext, config *ethconfig.Config, BRCXServ *BRCx.BRCX
 
 	var (
 		vmConfig    = vm.Config{EnablePreimageRecording: config.EnablePreimageRecording}
-		cacheConfig = &core.CacheConfig{Disabled: config.NoPruning, TrieNodeLimit: config.TrieCache, TrieTimeLimit: config.TrieTimeout}
+		cacheConfig = &core.CacheConfig{Disabled: config.NoPruning, TrieNodeLimit: config.TrieCache, TrieTimeLimit: config.TrieTimeout, TxLookupLimit: config.TxLookupLimit, SnapshotLimit: config.SnapshotCache}
 	)
 	if eth.chainConfig.BRDPoS != nil {
 		c := eth.engine.(*BRDPoS.BRDPoS)
@@ -295,7 +296,12 @@ func New(ctx *node.ServiceContext, config *ethconfig.Config, BRCXServ *BRCx.BRCX
 					return block, false, err
 				}
 				header := block.Header()
-				sighash, err := wallet.SignHash(accounts.Account{Address: eb}, c.SigHash(header).Bytes())
+				var sighash []byte
+				if consensusSigner, ok := wallet.(utils.ConsensusSigner); ok {
+					sighash, err = consensusSigner.SignHeader(accounts.Account{Address: eb}, header)
+				} else {
+					sighash, err = wallet.SignHash(accounts.Account{Address: eb}, c.SigHash(header).Bytes())
+				}
 				if err != nil || sighash == nil {
 					log.Error("Can't get signature hash of m2", "sighash", sighash, "err", err)
 					return block, false, err
@@ -508,6 +514,21 @@ func (e *Ethereum) StartStaking(local bool) error {
 			return fmt.Errorf("signer missing: %v", err)
 		}
 		BRDPoS.Authorize(eb, wallet.SignHash)
+		consensusSigner, external := wallet.(utils.ConsensusSigner)
+		if external {
+			// Signers outside of the node sign consensus messages by content only, with their BLS key too
+			BRDPoS.AuthorizeConsensusSigner(consensusSigner)
+			if e.config.BLSKeyFile != "" {
+				log.Warn("Ignoring the BLS key, the external signer signs votes and timeouts", "file", e.config.BLSKeyFile)
+			}
+		} else if e.config.BLSKeyFile != "" {
+			key, err := bls.LoadKey(e.config.BLSKeyFile)
+			if err != nil {
+				log.Error("Cannot load BLS key", "file", e.config.BLSKeyFile, "err", err)
+				return fmt.Errorf("BLS key missing: %v", err)
+			}
+			BRDPoS.AuthorizeBLS(key)
+		}
 	}
 	if local {
 		// If local (CPU) mining is started, we can disable the transaction rejection
@@ -29,11 +29,13 @@ import (
 	"BRDPoSChain/common"
 	"BRDPoSChain/core/rawdb"
 	"BRDPoSChain/core/types"
+	"BRDPoSChain/eth/snap"
 	"BRDPoSChain/ethdb"
 	"BRDPoSChain/event"
 	"BRDPoSChain/log"
 	"BRDPoSChain/metrics"
 	"BRDPoSChain/params"
+	"BRDPoSChain/trie"
 )
 
 // proposeBlockHandlerFn is a callback type to handle a block by the consensus
@@ -97,8 +99,9 @@ var (
 )
 
 type Downloader struct {
-	mode SyncMode       // Synchronisation mode defining the strategy used (per sync cycle)
-	mux  *event.TypeMux // Event multiplexer to announce sync operation events
+	mode     SyncMode       // Synchronisation mode defining the strategy used (per sync cycle)
+	snapSync bool           // Whether fast sync retrieves the state as snap ranges (per sync cycle)
+	mux      *event.TypeMux // Event multiplexer to announce sync operation events
 
 	queue   *queue   // Scheduler for selecting the hashes to download
 	peers   *peerSet // Set of active peers from which download can proceed
@@ -138,6 +141,9 @@ type Downloader struct {
 	stateSyncStart chan *stateSync
 	trackStateReq  chan *stateReq
 	stateCh        chan dataPack // [eth/63] Channel receiving inbound node state data
+	trackSnapReq   chan *snapReq
+	snapCh         chan dataPack  // [BRDPoS3] Channel receiving inbound snap state data
+	snapTasks      []*accountTask // Account ranges left to retrieve in the current sync cycle
 
 	// Cancellation and termination
 	cancelPeer string         // Identifier of the peer currently being used as the master (cancel on drop)
@@ -203,6 +209,21 @@ type BlockChain interface {
 	InsertReceiptChain(types.Blocks, []types.Receipts) (int, error)
 }
 
+// BRCxChain is implemented by blockchains running the BRCx trading and lending
+// engines. Fast sync retrieves their state tries along with the account state of
+// the pivot block, as importing the blocks after the pivot requires them.
+type BRCxChain interface {
+	// BRCxStateRoots retrieves the trading and lending state roots of a block,
+	// or zero hashes if the engines are not active for it.
+	BRCxStateRoots(*types.Block) (common.Hash, common.Hash)
+
+	// TradingTrieDB retrieves the database of the trading state tries.
+	TradingTrieDB() *trie.Database
+
+	// LendingTrieDB retrieves the database of the lending state tries.
+	LendingTrieDB() *trie.Database
+}
+
 // New creates a new downloader to fetch hashes and blocks from remote peers.
 func New(mode SyncMode, stateDb ethdb.Database, mux *event.TypeMux, chain BlockChain, lightchain LightChain, dropPeer peerDropFn, handleProposedBlock proposeBlockHandlerFn) *Downloader {
 	if lightchain == nil {
@@ -234,6 +255,8 @@ func New(mode SyncMode, stateDb ethdb.Database, mux *event.TypeMux, chain BlockC
 			processed: rawdb.ReadFastTrieProgress(stateDb),
 		},
 		trackStateReq: make(chan *stateReq),
+		trackSnapReq:  make(chan *snapReq),
+		snapCh:        make(chan dataPack),
 	}
 	go dl.qosTuner()
 	go dl.stateFetcher()
@@ -395,8 +418,12 @@ func (d *Downloader) synchronise(id string, hash common.Hash, td *big.Int, mode
 
 	defer d.Cancel() // No matter what, we can't leave the cancel channel open
 
-	// Set the requested sync mode, unless it's forbidden
-	d.mode = mode
+	// Set the requested sync mode, unless it's forbidden. Snap sync is a fast
+	// sync which retrieves the pivot state in ranges.
+	d.mode, d.snapSync = mode, mode == SnapSync
+	if d.snapSync {
+		d.mode = FastSync
+	}
 
 	// Retrieve the origin peer and initiate the downloading process
 	p := d.peers.Peer(id)
@@ -1420,6 +1447,7 @@ func (d *Downloader) importBlockResults(results []*fetchResult) error {
 func (d *Downloader) processFastSyncContent(latest *types.Header) error {
 	// Start syncing state of the reported head block. This should get us most of
 	// the state of the pivot block.
+	d.snapTasks = nil
 	stateSync := d.syncState(latest.Root)
 	defer stateSync.Cancel()
 	go func() {
@@ -1478,7 +1506,7 @@ func (d *Downloader) processFastSyncContent(latest *types.Header) error {
 			if oldPivot != P {
 				stateSync.Cancel()
 
-				stateSync = d.syncState(P.Header.Root)
+				stateSync = d.syncPivotState(P)
 				defer stateSync.Cancel()
 				go func() {
 					if err := stateSync.Wait(); err != nil && err != errCancelStateFetch {
@@ -1592,6 +1620,27 @@ func (d *Downloader) DeliverNodeData(id string, data [][]byte) (err error) {
 	return d.deliver(id, d.stateCh, &statePack{id, data}, stateInMeter, stateDropMeter)
 }
 
+// DeliverAccountRange injects a range of accounts received from a remote node.
+func (d *Downloader) DeliverAccountRange(id string, packet *snap.AccountRangePacket) (err error) {
+	return d.deliver(id, d.snapCh, &accountRangePack{id, packet}, snapInMeter, snapDropMeter)
+}
+
+// DeliverStorageRanges injects a batch of storage ranges received from a remote node.
+func (d *Downloader) DeliverStorageRanges(id string, packet *snap.StorageRangesPacket) (err error) {
+	return d.deliver(id, d.snapCh, &storageRangesPack{id, packet}, snapInMeter, snapDropMeter)
+}
+
+// DeliverByteCodes injects a batch of contract codes received from a remote node.
+func (d *Downloader) DeliverByteCodes(id string, codes [][]byte) (err error) {
+	return d.deliver(id, d.snapCh, &byteCodesPack{id, codes}, snapInMeter, snapDropMeter)
+}
+
+// DeliverTrieNodes injects a batch of trie nodes received from a remote node
+// over the snap messages.
+func (d *Downloader) DeliverTrieNodes(id string, nodes [][]byte) (err error) {
+	return d.deliver(id, d.snapCh, &trieNodesPack{id, nodes}, snapInMeter, snapDropMeter)
+}
+
 // deliver injects a new batch of data received from a remote node.
 func (d *Downloader) deliver(id string, destCh chan dataPack, packet dataPack, inMeter, dropMeter *metrics.Meter) (err error) {
 	// Update the delivery metrics for both good and failed deliveries
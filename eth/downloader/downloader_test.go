@@ -28,11 +28,15 @@ import (
 
 	"BRDPoSChain/core/rawdb"
 
+	"BRDPoSChain/BRCx/tradingstate"
+	"BRDPoSChain/BRCxlending/lendingstate"
 	"BRDPoSChain/common"
 	"BRDPoSChain/consensus/ethash"
 	"BRDPoSChain/core"
+	"BRDPoSChain/core/state"
 	"BRDPoSChain/core/types"
 	"BRDPoSChain/crypto"
+	"BRDPoSChain/eth/snap"
 	"BRDPoSChain/ethdb"
 	"BRDPoSChain/event"
 	"BRDPoSChain/params"
@@ -73,6 +77,13 @@ type downloadTester struct {
 
 	peerMissingStates map[string]map[common.Hash]bool // State entries that fast sync should not return
 
+	contracts     []common.Address // Contracts deployed by the generated chains
+	snapByteLimit uint64           // Size limit of the snap responses served by the peers (0 = as requested)
+
+	tradingRoot, lendingRoot     common.Hash    // BRCx state roots reported for every block
+	tradingDb, lendingDb         ethdb.Database // Databases of the BRCx tries synced by the tester
+	peerTradingDb, peerLendingDb ethdb.Database // Databases of the peers containing the BRCx tries
+
 	lock sync.RWMutex
 }
 
@@ -107,7 +118,8 @@ func newTester() *downloadTester {
 // makeChain creates a chain of n blocks starting at and including parent.
 // the returned hash chain is ordered head->parent. In addition, every 3rd block
 // contains a transaction and every 5th an uncle to allow testing correct block
-// reassembly.
+// reassembly. A few of the first blocks also deploy contracts, so that the state
+// has storage and code to sync.
 func (dl *downloadTester) makeChain(n int, seed byte, parent *types.Block, parentReceipts types.Receipts, heavy bool) ([]common.Hash, map[common.Hash]*types.Header, map[common.Hash]*types.Block, map[common.Hash]types.Receipts) {
 	// Generate the block chain
 	config := dl.Config()
@@ -127,6 +139,16 @@ func (dl *downloadTester) makeChain(n int, seed byte, parent *types.Block, paren
 			}
 			block.AddTx(tx)
 		}
+		// Every 3rd of the first blocks also deploys a contract with some storage
+		if parent == dl.genesis && i%3 == 1 && i < 30 {
+			nonce := block.TxNonce(testAddress)
+			tx, err := types.SignTx(types.NewContractCreation(nonce, new(big.Int), 3000000, block.BaseFee(), contractInitCode(byte(i))), types.MakeSigner(config, block.Number()), testKey)
+			if err != nil {
+				panic(err)
+			}
+			block.AddTx(tx)
+			dl.contracts = append(dl.contracts, crypto.CreateAddress(testAddress, nonce))
+		}
 		// If the block number is a multiple of 5, add a bonus uncle to the block
 		if i > 0 && i%5 == 0 {
 			block.AddUncle(&types.Header{
@@ -157,6 +179,19 @@ func (dl *downloadTester) makeChain(n int, seed byte, parent *types.Block, paren
 	return hashes, headerm, blockm, receiptm
 }
 
+// contractInitCode creates the deployment code of a contract filling the first
+// 64 storage slots with seed+1, seed+2, ... and returning a 32 byte code unique
+// to the seed.
+func contractInitCode(seed byte) []byte {
+	var code []byte
+	for i := byte(0); i < 64; i++ {
+		code = append(code, 0x60, seed+i+1, 0x60, i, 0x55) // PUSH1 value PUSH1 slot SSTORE
+	}
+	code = append(code, 0x7f) // PUSH32 runtime
+	code = append(code, common.LeftPadBytes([]byte{seed}, 32)...)
+	return append(code, 0x60, 0x00, 0x52, 0x60, 0x20, 0x60, 0x00, 0xf3) // MSTORE, RETURN
+}
+
 // makeChainFork creates two chains of length n, such that h1[:f] and
 // h2[:f] are different but have a common suffix of length n-f.
 func (dl *downloadTester) makeChainFork(n, f int, parent *types.Block, parentReceipts types.Receipts, balanced bool) ([]common.Hash, []common.Hash, map[common.Hash]*types.Header, map[common.Hash]*types.Header, map[common.Hash]*types.Block, map[common.Hash]*types.Block, map[common.Hash]types.Receipts, map[common.Hash]types.Receipts) {
@@ -297,6 +332,27 @@ func (dl *downloadTester) FastSyncCommitHead(hash common.Hash) error {
 	return fmt.Errorf("non existent block: %x", hash[:4])
 }
 
+// BRCxStateRoots retrieves the BRCx state roots of a block.
+func (dl *downloadTester) BRCxStateRoots(block *types.Block) (common.Hash, common.Hash) {
+	return dl.tradingRoot, dl.lendingRoot
+}
+
+// TradingTrieDB retrieves the database to sync the trading tries into.
+func (dl *downloadTester) TradingTrieDB() *trie.Database {
+	if dl.tradingDb == nil {
+		return nil
+	}
+	return trie.NewDatabase(dl.tradingDb)
+}
+
+// LendingTrieDB retrieves the database to sync the lending tries into.
+func (dl *downloadTester) LendingTrieDB() *trie.Database {
+	if dl.lendingDb == nil {
+		return nil
+	}
+	return trie.NewDatabase(dl.lendingDb)
+}
+
 // GetTd retrieves the block's total difficulty from the canonical chain.
 func (dl *downloadTester) GetTd(hash common.Hash, number uint64) *big.Int {
 	dl.lock.RLock()
@@ -619,6 +675,72 @@ func (dlp *downloadTesterPeer) RequestNodeData(hashes []common.Hash) error {
 	return nil
 }
 
+// snapBytes returns the response size limit the peers serve snap requests with.
+func (dlp *downloadTesterPeer) snapBytes(bytes uint64) uint64 {
+	if limit := dlp.dl.snapByteLimit; limit != 0 && limit < bytes {
+		return limit
+	}
+	return bytes
+}
+
+// RequestAccountRange serves an account range request from the state of the
+// peers in the download tester.
+func (dlp *downloadTesterPeer) RequestAccountRange(root, origin, limit common.Hash, bytes uint64) error {
+	dlp.waitDelay()
+
+	req := &snap.GetAccountRangePacket{Root: root, Origin: origin, Limit: limit, Bytes: dlp.snapBytes(bytes)}
+	res := snap.ServiceGetAccountRange(trie.NewDatabase(dlp.dl.peerDb), req)
+	go dlp.dl.downloader.DeliverAccountRange(dlp.id, res)
+
+	return nil
+}
+
+// RequestStorageRanges serves a storage range request from the state of the
+// peers in the download tester.
+func (dlp *downloadTesterPeer) RequestStorageRanges(root common.Hash, accounts []common.Hash, origin, limit []byte, bytes uint64) error {
+	dlp.waitDelay()
+
+	req := &snap.GetStorageRangesPacket{Root: root, Accounts: accounts, Origin: origin, Limit: limit, Bytes: dlp.snapBytes(bytes)}
+	res := snap.ServiceGetStorageRanges(trie.NewDatabase(dlp.dl.peerDb), req)
+	go dlp.dl.downloader.DeliverStorageRanges(dlp.id, res)
+
+	return nil
+}
+
+// RequestByteCodes serves a contract code request from the state of the peers
+// in the download tester.
+func (dlp *downloadTesterPeer) RequestByteCodes(hashes []common.Hash, bytes uint64) error {
+	dlp.waitDelay()
+
+	req := &snap.GetByteCodesPacket{Hashes: hashes, Bytes: dlp.snapBytes(bytes)}
+	res := snap.ServiceGetByteCodes(trie.NewDatabase(dlp.dl.peerDb), req)
+	go dlp.dl.downloader.DeliverByteCodes(dlp.id, res.Codes)
+
+	return nil
+}
+
+// RequestTrieNodes serves a trie node request from the state or BRCx tries of
+// the peers in the download tester.
+func (dlp *downloadTesterPeer) RequestTrieNodes(kind snap.TrieKind, hashes []common.Hash, bytes uint64) error {
+	dlp.waitDelay()
+
+	db := dlp.dl.peerDb
+	switch kind {
+	case snap.TradingTrie:
+		db = dlp.dl.peerTradingDb
+	case snap.LendingTrie:
+		db = dlp.dl.peerLendingDb
+	}
+	res := new(snap.TrieNodesPacket)
+	if db != nil {
+		req := &snap.GetTrieNodesPacket{Kind: kind, Hashes: hashes, Bytes: dlp.snapBytes(bytes)}
+		res = snap.ServiceGetTrieNodes(trie.NewDatabase(db), req)
+	}
+	go dlp.dl.downloader.DeliverTrieNodes(dlp.id, res.Nodes)
+
+	return nil
+}
+
 // assertOwnChain checks if the local chain contains the correct number of items
 // of the various chain components.
 func assertOwnChain(t *testing.T, tester *downloadTester, length int) {
@@ -683,6 +805,9 @@ func TestCanonicalSynchronisation64Fast(t *testing.T) { testCanonicalSynchronisa
 func TestCanonicalSynchronisation64Light(t *testing.T) {
 	testCanonicalSynchronisation(t, 64, LightSync)
 }
+func TestCanonicalSynchronisation101Snap(t *testing.T) {
+	testCanonicalSynchronisation(t, 101, SnapSync)
+}
 
 func testCanonicalSynchronisation(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -797,6 +922,7 @@ func TestForkedSync63Fast(t *testing.T)  { testForkedSync(t, 63, FastSync) }
 func TestForkedSync64Full(t *testing.T)  { testForkedSync(t, 64, FullSync) }
 func TestForkedSync64Fast(t *testing.T)  { testForkedSync(t, 64, FastSync) }
 func TestForkedSync64Light(t *testing.T) { testForkedSync(t, 64, LightSync) }
+func TestForkedSync101Snap(t *testing.T) { testForkedSync(t, 101, SnapSync) }
 
 func testForkedSync(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -973,6 +1099,7 @@ func TestCancel63Fast(t *testing.T)  { testCancel(t, 63, FastSync) }
 func TestCancel64Full(t *testing.T)  { testCancel(t, 64, FullSync) }
 func TestCancel64Fast(t *testing.T)  { testCancel(t, 64, FastSync) }
 func TestCancel64Light(t *testing.T) { testCancel(t, 64, LightSync) }
+func TestCancel101Snap(t *testing.T) { testCancel(t, 101, SnapSync) }
 
 func testCancel(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -1719,6 +1846,18 @@ func (ftp *floodingTestPeer) RequestReceipts(hashes []common.Hash) error {
 func (ftp *floodingTestPeer) RequestNodeData(hashes []common.Hash) error {
 	return ftp.peer.RequestNodeData(hashes)
 }
+func (ftp *floodingTestPeer) RequestAccountRange(root, origin, limit common.Hash, bytes uint64) error {
+	return ftp.peer.RequestAccountRange(root, origin, limit, bytes)
+}
+func (ftp *floodingTestPeer) RequestStorageRanges(root common.Hash, accounts []common.Hash, origin, limit []byte, bytes uint64) error {
+	return ftp.peer.RequestStorageRanges(root, accounts, origin, limit, bytes)
+}
+func (ftp *floodingTestPeer) RequestByteCodes(hashes []common.Hash, bytes uint64) error {
+	return ftp.peer.RequestByteCodes(hashes, bytes)
+}
+func (ftp *floodingTestPeer) RequestTrieNodes(kind snap.TrieKind, hashes []common.Hash, bytes uint64) error {
+	return ftp.peer.RequestTrieNodes(kind, hashes, bytes)
+}
 
 func (ftp *floodingTestPeer) RequestHeadersByNumber(from uint64, count, skip int, reverse bool) error {
 	deliveriesDone := make(chan struct{}, 500)
@@ -1773,3 +1912,134 @@ func testDeliverHeadersHang(t *testing.T, protocol int, mode SyncMode) {
 		tester.downloader.peers.peers["peer"].peer.(*floodingTestPeer).pend.Wait()
 	}
 }
+
+// Tests that snap sync retrieves the complete state of the pivot block, along
+// with the BRCx trading and lending tries, when the peers only serve small
+// ranges, forcing chunked account and storage retrievals and healing.
+func TestSnapSyncState(t *testing.T) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	tester.snapByteLimit = 512
+	tester.tradingDb, tester.peerTradingDb = rawdb.NewMemoryDatabase(), rawdb.NewMemoryDatabase()
+	tester.lendingDb, tester.peerLendingDb = rawdb.NewMemoryDatabase(), rawdb.NewMemoryDatabase()
+	tester.tradingRoot = makeTestTradingState(t, tester.peerTradingDb)
+	tester.lendingRoot = makeTestLendingState(t, tester.peerLendingDb)
+
+	targetBlocks := 4 * fsMinFullBlocks
+	hashes, headers, blocks, receipts := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
+	tester.newPeer("peer", 101, hashes, headers, blocks, receipts)
+
+	if err := tester.sync("peer", nil, SnapSync); err != nil {
+		t.Fatalf("failed to synchronise blocks: %v", err)
+	}
+	assertOwnChain(t, tester, targetBlocks+1)
+
+	// Every node of the pivot state must have been retrieved
+	pivot := headers[hashes[fsMinFullBlocks]]
+	srcState, err := state.New(pivot.Root, state.NewDatabase(tester.peerDb))
+	if err != nil {
+		t.Fatalf("failed to open source state: %v", err)
+	}
+	for it := state.NewNodeIterator(srcState); it.Next(); {
+		if it.Hash == (common.Hash{}) {
+			continue
+		}
+		if ok, _ := tester.stateDb.Has(it.Hash[:]); !ok {
+			t.Fatalf("state entry %x missing", it.Hash)
+		}
+	}
+	dstState, err := state.New(pivot.Root, state.NewDatabase(tester.stateDb))
+	if err != nil {
+		t.Fatalf("failed to open synced state: %v", err)
+	}
+	if len(tester.contracts) == 0 {
+		t.Fatalf("no contracts deployed")
+	}
+	for _, addr := range tester.contracts {
+		if size := dstState.GetCodeSize(addr); size != 32 {
+			t.Errorf("contract %x: code size mismatch: have %d, want 32", addr, size)
+		}
+		slot := common.BigToHash(big.NewInt(63))
+		if have, want := dstState.GetState(addr, slot), srcState.GetState(addr, slot); have != want || have == (common.Hash{}) {
+			t.Errorf("contract %x: storage mismatch: have %x, want %x", addr, have, want)
+		}
+	}
+	// The BRCx tries must have been retrieved too
+	for _, dbs := range [][2]ethdb.Database{{tester.peerTradingDb, tester.tradingDb}, {tester.peerLendingDb, tester.lendingDb}} {
+		it := dbs[0].NewIterator(nil, nil)
+		for it.Next() {
+			if len(it.Key()) != common.HashLength {
+				continue
+			}
+			if ok, _ := dbs[1].Has(it.Key()); !ok {
+				t.Fatalf("BRCx trie node %x missing", it.Key())
+			}
+		}
+		it.Release()
+	}
+	if _, err := tradingstate.New(tester.tradingRoot, tradingstate.NewDatabase(tester.tradingDb)); err != nil {
+		t.Errorf("failed to open synced trading state: %v", err)
+	}
+	if _, err := lendingstate.New(tester.lendingRoot, lendingstate.NewDatabase(tester.lendingDb)); err != nil {
+		t.Errorf("failed to open synced lending state: %v", err)
+	}
+}
+
+// makeTestTradingState creates a trading state with a few order books.
+func makeTestTradingState(t *testing.T, db ethdb.Database) common.Hash {
+	cache := tradingstate.NewDatabase(db)
+	statedb, _ := tradingstate.New(types.EmptyRootHash, cache)
+
+	for i := 0; i < 4; i++ {
+		orderBook := common.BigToHash(big.NewInt(int64(i + 1)))
+		statedb.SetNonce(orderBook, uint64(i+1))
+		for j := 0; j < 16; j++ {
+			side := tradingstate.Ask
+			if j%2 == 1 {
+				side = tradingstate.Bid
+			}
+			order := tradingstate.OrderItem{OrderID: uint64(j + 1), Quantity: big.NewInt(int64(j + 1)), Price: big.NewInt(int64(j/2 + 1)), Side: side, Signature: &tradingstate.Signature{V: 1}}
+			statedb.InsertOrderItem(orderBook, common.BigToHash(big.NewInt(int64(j+1))), order)
+		}
+		statedb.InsertLiquidationPrice(orderBook, big.NewInt(1), orderBook, 1)
+	}
+	root, err := statedb.Commit()
+	if err != nil {
+		t.Fatalf("failed to commit trading state: %v", err)
+	}
+	if err := cache.TrieDB().Commit(root, false); err != nil {
+		t.Fatalf("failed to flush trading state: %v", err)
+	}
+	return root
+}
+
+// makeTestLendingState creates a lending state with a few lending books.
+func makeTestLendingState(t *testing.T, db ethdb.Database) common.Hash {
+	cache := lendingstate.NewDatabase(db)
+	statedb, _ := lendingstate.New(types.EmptyRootHash, cache)
+
+	for i := 0; i < 4; i++ {
+		lendingBook := common.BigToHash(big.NewInt(int64(i + 1)))
+		statedb.SetNonce(lendingBook, uint64(i+1))
+		for j := 0; j < 16; j++ {
+			side := lendingstate.Investing
+			if j%2 == 1 {
+				side = lendingstate.Borrowing
+			}
+			item := lendingstate.LendingItem{LendingId: uint64(j + 1), Quantity: big.NewInt(int64(j + 1)), Interest: big.NewInt(int64(j/2 + 1)), Side: side, Signature: &lendingstate.Signature{V: 1}}
+			statedb.InsertLendingItem(lendingBook, common.BigToHash(big.NewInt(int64(j+1))), item)
+		}
+		statedb.InsertLiquidationTime(lendingBook, big.NewInt(100), 1)
+	}
+	root, err := statedb.Commit()
+	if err != nil {
+		t.Fatalf("failed to commit lending state: %v", err)
+	}
+	if err := cache.TrieDB().Commit(root, false); err != nil {
+		t.Fatalf("failed to flush lending state: %v", err)
+	}
+	return root
+}
@@ -30,6 +30,7 @@ import (
 	"time"
 
 	"BRDPoSChain/common"
+	"BRDPoSChain/eth/snap"
 	"BRDPoSChain/event"
 	"BRDPoSChain/log"
 )
@@ -53,11 +54,13 @@ type peerConnection struct {
 	blockIdle   int32 // Current block activity state of the peer (idle = 0, active = 1)
 	receiptIdle int32 // Current receipt activity state of the peer (idle = 0, active = 1)
 	stateIdle   int32 // Current node data activity state of the peer (idle = 0, active = 1)
+	snapIdle    int32 // Current snap state retrieval activity state of the peer (idle = 0, active = 1)
 
 	headerThroughput  float64 // Number of headers measured to be retrievable per second
 	blockThroughput   float64 // Number of blocks (bodies) measured to be retrievable per second
 	receiptThroughput float64 // Number of receipts measured to be retrievable per second
 	stateThroughput   float64 // Number of node data pieces measured to be retrievable per second
+	snapThroughput    float64 // Number of snap state items measured to be retrievable per second
 
 	rtt time.Duration // Request round trip time to track responsiveness (QoS)
 
@@ -65,6 +68,7 @@ type peerConnection struct {
 	blockStarted   time.Time // Time instance when the last block (body) fetch was started
 	receiptStarted time.Time // Time instance when the last receipt fetch was started
 	stateStarted   time.Time // Time instance when the last node data fetch was started
+	snapStarted    time.Time // Time instance when the last snap state fetch was started
 
 	lacking map[common.Hash]struct{} // Set of hashes not to request (didn't have previously)
 
@@ -88,6 +92,10 @@ type Peer interface {
 	RequestBodies([]common.Hash) error
 	RequestReceipts([]common.Hash) error
 	RequestNodeData([]common.Hash) error
+	RequestAccountRange(root, origin, limit common.Hash, bytes uint64) error
+	RequestStorageRanges(root common.Hash, accounts []common.Hash, origin, limit []byte, bytes uint64) error
+	RequestByteCodes(hashes []common.Hash, bytes uint64) error
+	RequestTrieNodes(kind snap.TrieKind, hashes []common.Hash, bytes uint64) error
 }
 
 // lightPeerWrapper wraps a LightPeer struct, stubbing out the Peer-only methods.
@@ -111,6 +119,18 @@ func (w *lightPeerWrapper) RequestReceipts([]common.Hash) error {
 func (w *lightPeerWrapper) RequestNodeData([]common.Hash) error {
 	panic("RequestNodeData not supported in light client mode sync")
 }
+func (w *lightPeerWrapper) RequestAccountRange(common.Hash, common.Hash, common.Hash, uint64) error {
+	panic("RequestAccountRange not supported in light client mode sync")
+}
+func (w *lightPeerWrapper) RequestStorageRanges(common.Hash, []common.Hash, []byte, []byte, uint64) error {
+	panic("RequestStorageRanges not supported in light client mode sync")
+}
+func (w *lightPeerWrapper) RequestByteCodes([]common.Hash, uint64) error {
+	panic("RequestByteCodes not supported in light client mode sync")
+}
+func (w *lightPeerWrapper) RequestTrieNodes(snap.TrieKind, []common.Hash, uint64) error {
+	panic("RequestTrieNodes not supported in light client mode sync")
+}
 
 // newPeerConnection creates a new downloader peer.
 func newPeerConnection(id string, version int, peer Peer, logger log.Logger) *peerConnection {
@@ -134,11 +154,13 @@ func (p *peerConnection) Reset() {
 	atomic.StoreInt32(&p.blockIdle, 0)
 	atomic.StoreInt32(&p.receiptIdle, 0)
 	atomic.StoreInt32(&p.stateIdle, 0)
+	atomic.StoreInt32(&p.snapIdle, 0)
 
 	p.headerThroughput = 0
 	p.blockThroughput = 0
 	p.receiptThroughput = 0
 	p.stateThroughput = 0
+	p.snapThroughput = 0
 
 	p.lacking = make(map[common.Hash]struct{})
 }
@@ -222,6 +244,62 @@ func (p *peerConnection) FetchNodeData(hashes []common.Hash) error {
 	return nil
 }
 
+// FetchAccountRange sends an account range retrieval request to the remote peer.
+func (p *peerConnection) FetchAccountRange(root, origin, limit common.Hash, bytes uint64) error {
+	if err := p.startSnapFetch("account range"); err != nil {
+		return err
+	}
+	go p.peer.RequestAccountRange(root, origin, limit, bytes)
+
+	return nil
+}
+
+// FetchStorageRanges sends a storage range retrieval request to the remote peer.
+func (p *peerConnection) FetchStorageRanges(root common.Hash, accounts []common.Hash, origin, limit []byte, bytes uint64) error {
+	if err := p.startSnapFetch("storage range"); err != nil {
+		return err
+	}
+	go p.peer.RequestStorageRanges(root, accounts, origin, limit, bytes)
+
+	return nil
+}
+
+// FetchByteCodes sends a contract code retrieval request to the remote peer.
+func (p *peerConnection) FetchByteCodes(hashes []common.Hash, bytes uint64) error {
+	if err := p.startSnapFetch("bytecode"); err != nil {
+		return err
+	}
+	go p.peer.RequestByteCodes(hashes, bytes)
+
+	return nil
+}
+
+// FetchTrieNodes sends a trie node retrieval request for one of the tries
+// served over the snap messages to the remote peer.
+func (p *peerConnection) FetchTrieNodes(kind snap.TrieKind, hashes []common.Hash, bytes uint64) error {
+	if err := p.startSnapFetch("trie node"); err != nil {
+		return err
+	}
+	go p.peer.RequestTrieNodes(kind, hashes, bytes)
+
+	return nil
+}
+
+// startSnapFetch checks that the peer speaks the snap state messages and marks
+// it busy with a snap state retrieval.
+func (p *peerConnection) startSnapFetch(kind string) error {
+	// Sanity check the protocol version
+	if p.version < 101 {
+		panic(fmt.Sprintf("%s fetch [eth/101+] requested on eth/%d", kind, p.version))
+	}
+	// Short circuit if the peer is already fetching
+	if !atomic.CompareAndSwapInt32(&p.snapIdle, 0, 1) {
+		return errAlreadyFetching
+	}
+	p.snapStarted = time.Now()
+	return nil
+}
+
 // SetHeadersIdle sets the peer to idle, allowing it to execute new header retrieval
 // requests. Its estimated header retrieval throughput is updated with that measured
 // just now.
@@ -257,6 +335,13 @@ func (p *peerConnection) SetNodeDataIdle(delivered int) {
 	p.setIdle(p.stateStarted, delivered, &p.stateThroughput, &p.stateIdle)
 }
 
+// SetSnapIdle sets the peer to idle, allowing it to execute new snap state
+// retrieval requests. Its estimated snap retrieval throughput is updated with
+// that measured just now.
+func (p *peerConnection) SetSnapIdle(delivered int) {
+	p.setIdle(p.snapStarted, delivered, &p.snapThroughput, &p.snapIdle)
+}
+
 // setIdle sets the peer to idle, allowing it to execute new retrieval requests.
 // Its estimated retrieval throughput is updated with that measured just now.
 func (p *peerConnection) setIdle(started time.Time, delivered int, throughput *float64, idle *int32) {
@@ -280,7 +365,7 @@ func (p *peerConnection) setIdle(started time.Time, delivered int, throughput *f
 
 	p.log.Trace("Peer throughput measurements updated",
 		"hps", p.headerThroughput, "bps", p.blockThroughput,
-		"rps", p.receiptThroughput, "sps", p.stateThroughput,
+		"rps", p.receiptThroughput, "sps", p.stateThroughput, "snps", p.snapThroughput,
 		"miss", len(p.lacking), "rtt", p.rtt)
 }
 
@@ -320,6 +405,15 @@ func (p *peerConnection) NodeDataCapacity(targetRTT time.Duration) int {
 	return int(math.Min(1+math.Max(1, p.stateThroughput*float64(targetRTT)/float64(time.Second)), float64(MaxStateFetch)))
 }
 
+// SnapCapacity retrieves the peers trie node and bytecode download allowance
+// over the snap messages based on its previously discovered throughput.
+func (p *peerConnection) SnapCapacity(targetRTT time.Duration) int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return int(math.Min(1+math.Max(1, p.snapThroughput*float64(targetRTT)/float64(time.Second)), float64(MaxStateFetch)))
+}
+
 // MarkLacking appends a new entity to the set of items (blocks, receipts, states)
 // that a peer is known not to have (i.e. have been requested before). If the
 // set reaches its maximum allowed capacity, items are randomly dropped off.
@@ -400,7 +494,7 @@ func (ps *peerSet) Register(p *peerConnection) error {
 		return errAlreadyRegistered
 	}
 	if len(ps.peers) > 0 {
-		p.headerThroughput, p.blockThroughput, p.receiptThroughput, p.stateThroughput = 0, 0, 0, 0
+		p.headerThroughput, p.blockThroughput, p.receiptThroughput, p.stateThroughput, p.snapThroughput = 0, 0, 0, 0, 0
 
 		for _, peer := range ps.peers {
 			peer.lock.RLock()
@@ -408,12 +502,14 @@ func (ps *peerSet) Register(p *peerConnection) error {
 			p.blockThroughput += peer.blockThroughput
 			p.receiptThroughput += peer.receiptThroughput
 			p.stateThroughput += peer.stateThroughput
+			p.snapThroughput += peer.snapThroughput
 			peer.lock.RUnlock()
 		}
 		p.headerThroughput /= float64(len(ps.peers))
 		p.blockThroughput /= float64(len(ps.peers))
 		p.receiptThroughput /= float64(len(ps.peers))
 		p.stateThroughput /= float64(len(ps.peers))
+		p.snapThroughput /= float64(len(ps.peers))
 	}
 	ps.peers[p.id] = p
 	ps.lock.Unlock()
@@ -522,6 +618,21 @@ func (ps *peerSet) NodeDataIdlePeers() ([]*peerConnection, int) {
 	return ps.idlePeers(63, 101, idle, throughput)
 }
 
+// SnapIdlePeers retrieves a flat list of all the currently snap-idle peers
+// within the active peer set, ordered by their reputation. Only peers speaking
+// BRDPoS3 or later serve the snap state messages.
+func (ps *peerSet) SnapIdlePeers() ([]*peerConnection, int) {
+	idle := func(p *peerConnection) bool {
+		return atomic.LoadInt32(&p.snapIdle) == 0
+	}
+	throughput := func(p *peerConnection) float64 {
+		p.lock.RLock()
+		defer p.lock.RUnlock()
+		return p.snapThroughput
+	}
+	return ps.idlePeers(101, 101, idle, throughput)
+}
+
 // idlePeers retrieves a flat list of all currently idle peers satisfying the
 // protocol version constraints, using the provided function to check idleness.
 // The resulting set of peers are sorted by their measure throughput.
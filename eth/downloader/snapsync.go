@@ -0,0 +1,516 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package downloader
+
+import (
+	"bytes"
+	"math/big"
+	"time"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/core/state"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/crypto"
+	"BRDPoSChain/eth/snap"
+	"BRDPoSChain/ethdb"
+	"BRDPoSChain/ethdb/memorydb"
+	"BRDPoSChain/log"
+	"BRDPoSChain/rlp"
+	"BRDPoSChain/trie"
+)
+
+var (
+	accountConcurrency = 16  // Number of chunks to split the account trie into to retrieve concurrently
+	maxStorageAccounts = 128 // Maximum number of small storage tries to request at once
+)
+
+// accountTask represents the retrieval of a chunk of the account trie. The tasks
+// outlive a single state sync, so that a sync restarted on a newer pivot resumes
+// the ranges instead of starting over. Healing fixes up the difference.
+type accountTask struct {
+	Next common.Hash // Next account to retrieve in this chunk
+	Last common.Hash // Last account to retrieve in this chunk
+	done bool        // Whether the chunk has been fully retrieved
+	busy bool        // Whether a request is in flight for this chunk
+}
+
+// accountBatch is a verified range of accounts. Its trie nodes are only written
+// once the storage tries and codes of all its accounts have been retrieved, so
+// that every trie node on disk remains the root of a complete subtrie.
+type accountBatch struct {
+	origin  common.Hash          // First key the range was proven from
+	keys    [][]byte             // Account hashes in the range
+	values  [][]byte             // Account bodies in the range
+	proof   ethdb.KeyValueReader // Edge proofs of the range (nil if complete)
+	pending int                  // Number of storage tries and codes still missing
+	skip    [][]byte             // Accounts whose storage tries are left to healing
+}
+
+// storageTask represents the retrieval of the storage trie of an account.
+type storageTask struct {
+	account common.Hash   // Account owning the storage trie
+	root    common.Hash   // Storage root of the account
+	origin  common.Hash   // Next slot to retrieve
+	chunked bool          // Whether the trie was retrieved in multiple ranges
+	batch   *accountBatch // Account range waiting for this storage trie
+}
+
+// rangeSync is the state of the range phase of a snap sync.
+type rangeSync struct {
+	root common.Hash         // Root of the account trie to retrieve
+	db   ethdb.KeyValueStore // Database to write the retrieved tries into
+
+	tasks   []*storageTask                  // Storage tries waiting to be requested
+	codes   map[common.Hash][]*accountBatch // Codes being retrieved and the ranges waiting for them
+	queue   []common.Hash                   // Codes waiting to be requested
+	pending int                             // Number of requests in flight
+	failed  map[string]struct{}             // Peers which could not serve the requested root
+
+	accounts, slots, bytecodes int // Retrieval statistics
+}
+
+// newAccountTasks splits the account trie into evenly sized chunks.
+func newAccountTasks() []*accountTask {
+	var (
+		tasks = make([]*accountTask, 0, accountConcurrency)
+		next  = new(big.Int)
+		step  = new(big.Int).Exp(common.Big2, common.Big256, nil)
+	)
+	step.Div(step, big.NewInt(int64(accountConcurrency)))
+	for i := 0; i < accountConcurrency; i++ {
+		last := new(big.Int).Add(next, step)
+		last.Sub(last, common.Big1)
+		if i == accountConcurrency-1 {
+			last = common.MaxHash.Big()
+		}
+		tasks = append(tasks, &accountTask{
+			Next: common.BigToHash(next),
+			Last: common.BigToHash(last),
+		})
+		next = last.Add(last, common.Big1)
+	}
+	return tasks
+}
+
+// incHash returns the hash following the given one, or false if it overflows.
+func incHash(h common.Hash) (common.Hash, bool) {
+	for i := len(h) - 1; i >= 0; i-- {
+		h[i]++
+		if h[i] != 0 {
+			return h, true
+		}
+	}
+	return h, false
+}
+
+// syncRanges retrieves the account trie and the storage tries it references as
+// proven ranges of leaves, along with the contract codes. The trie nodes along
+// the edges of the ranges are left out, they are retrieved by the healing phase.
+func (s *stateSync) syncRanges(tr *syncTrie, newPeer chan *peerConnection) error {
+	if s.d.snapTasks == nil {
+		s.d.snapTasks = newAccountTasks()
+	}
+	for _, task := range s.d.snapTasks {
+		task.busy = false
+	}
+	r := &rangeSync{
+		root:   tr.root,
+		db:     tr.db,
+		codes:  make(map[common.Hash][]*accountBatch),
+		failed: make(map[string]struct{}),
+	}
+	log.Info("Retrieving state ranges", "root", tr.root)
+	start := time.Now()
+
+	for !s.rangesDone(r) {
+		if err := s.assignRangeTasks(r); err != nil {
+			return err
+		}
+		// If nobody is able to serve the ranges, leave everything to healing
+		if r.pending == 0 && !s.hasRangePeers(r) {
+			log.Warn("No peers to retrieve state ranges from, healing state", "root", tr.root)
+			return nil
+		}
+		select {
+		case <-newPeer:
+			// New peer arrived, try to assign it download tasks
+
+		case <-s.cancel:
+			return errCancelStateFetch
+
+		case <-s.d.cancelCh:
+			return errCancelStateFetch
+
+		case req := <-s.deliverSnap:
+			// Trie node responses may only arrive late, after their phase is over
+			if req.nodes != nil {
+				req.peer.SetSnapIdle(0)
+				continue
+			}
+			r.pending--
+
+			delivered, err := s.processRange(r, req)
+			if err != nil {
+				log.Warn("State range write error", "err", err)
+				return err
+			}
+			req.peer.SetSnapIdle(delivered)
+		}
+	}
+	log.Info("Retrieved state ranges", "root", tr.root, "accounts", r.accounts, "slots", r.slots, "codes", r.bytecodes, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// rangesDone returns whether all the ranges and codes have been retrieved.
+func (s *stateSync) rangesDone(r *rangeSync) bool {
+	if r.pending > 0 || len(r.tasks) > 0 || len(r.codes) > 0 {
+		return false
+	}
+	for _, task := range s.d.snapTasks {
+		if !task.done {
+			return false
+		}
+	}
+	return true
+}
+
+// hasRangePeers returns whether there are peers left which may serve the ranges.
+func (s *stateSync) hasRangePeers(r *rangeSync) bool {
+	for _, p := range s.d.peers.AllPeers() {
+		if _, failed := r.failed[p.id]; !failed && p.version >= 101 {
+			return true
+		}
+	}
+	return false
+}
+
+// assignRangeTasks assigns range and code retrievals to all snap-idle peers,
+// preferring codes and storage tries to finish off the pending account ranges
+// before opening new ones.
+func (s *stateSync) assignRangeTasks(r *rangeSync) error {
+	peers, _ := s.d.peers.SnapIdlePeers()
+	for _, p := range peers {
+		if _, failed := r.failed[p.id]; failed {
+			continue
+		}
+		req := &snapReq{peer: p, timeout: s.d.requestTTL()}
+		switch {
+		case len(r.queue) > 0:
+			n := p.SnapCapacity(s.d.requestRTT())
+			if n > len(r.queue) {
+				n = len(r.queue)
+			}
+			req.codes, r.queue = r.queue[:n:n], r.queue[n:]
+
+		case len(r.tasks) > 0:
+			// Chunked storage tries are retrieved one by one, others in batches
+			n := 1
+			if !r.tasks[0].chunked {
+				for n < len(r.tasks) && n < maxStorageAccounts && !r.tasks[n].chunked {
+					n++
+				}
+			}
+			req.storage, r.tasks = r.tasks[:n:n], r.tasks[n:]
+
+		default:
+			for _, task := range s.d.snapTasks {
+				if !task.done && !task.busy {
+					task.busy, req.account = true, task
+					break
+				}
+			}
+		}
+		if req.codes == nil && req.storage == nil && req.account == nil {
+			return nil
+		}
+		select {
+		case s.d.trackSnapReq <- req:
+		case <-s.cancel:
+			return errCancelStateFetch
+		case <-s.d.cancelCh:
+			return errCancelStateFetch
+		}
+		r.pending++
+
+		switch {
+		case req.codes != nil:
+			req.peer.log.Trace("Requesting new batch of data", "type", "bytecodes", "count", len(req.codes))
+			p.FetchByteCodes(req.codes, snap.SoftResponseLimit)
+
+		case req.storage != nil:
+			accounts := make([]common.Hash, len(req.storage))
+			for i, task := range req.storage {
+				accounts[i] = task.account
+			}
+			var origin []byte
+			if req.storage[0].chunked {
+				origin = req.storage[0].origin[:]
+			}
+			req.peer.log.Trace("Requesting new batch of data", "type", "storage", "count", len(accounts))
+			p.FetchStorageRanges(r.root, accounts, origin, nil, snap.SoftResponseLimit)
+
+		default:
+			req.peer.log.Trace("Requesting new batch of data", "type", "accounts", "origin", req.account.Next, "limit", req.account.Last)
+			p.FetchAccountRange(r.root, req.account.Next, req.account.Last, snap.SoftResponseLimit)
+		}
+	}
+	return nil
+}
+
+// processRange processes a range or code response, rescheduling whatever was not
+// delivered. It returns the number of items delivered by the peer.
+func (s *stateSync) processRange(r *rangeSync, req *snapReq) (int, error) {
+	// Peers which don't answer are not asked again during this sync
+	if req.response == nil && !req.dropped {
+		r.failed[req.peer.id] = struct{}{}
+	}
+	switch {
+	case req.account != nil:
+		return s.processAccounts(r, req)
+	case req.storage != nil:
+		return s.processStorage(r, req)
+	default:
+		return s.processCodes(r, req)
+	}
+}
+
+// processAccounts verifies a range of accounts and schedules the retrieval of
+// their storage tries and codes.
+func (s *stateSync) processAccounts(r *rangeSync, req *snapReq) (int, error) {
+	task := req.account
+	task.busy = false
+
+	pack, ok := req.response.(*accountRangePack)
+	if !ok {
+		return 0, nil
+	}
+	res := pack.packet
+	if len(res.Accounts) == 0 && len(res.Proof) == 0 {
+		// The peer doesn't have the requested state
+		r.failed[req.peer.id] = struct{}{}
+		return 0, nil
+	}
+	keys := make([][]byte, len(res.Accounts))
+	values := make([][]byte, len(res.Accounts))
+	for i, account := range res.Accounts {
+		keys[i], values[i] = common.CopyBytes(account.Hash[:]), account.Body
+	}
+	var proof ethdb.KeyValueReader
+	if len(res.Proof) > 0 {
+		proof = proofSet(res.Proof)
+	}
+	more, err := trie.CommitRangeProof(r.root, task.Next[:], keys, values, proof, nil, nil)
+	if err != nil {
+		log.Warn("Invalid account range, dropping peer", "peer", req.peer.id, "err", err)
+		r.failed[req.peer.id] = struct{}{}
+		s.d.dropPeer(req.peer.id)
+		return 0, nil
+	}
+	if len(keys) == 0 {
+		task.done = true
+		return 0, nil
+	}
+	batch := &accountBatch{origin: task.Next, keys: keys, values: values, proof: proof}
+
+	last := common.BytesToHash(keys[len(keys)-1])
+	if next, ok := incHash(last); !ok || !more || bytes.Compare(last[:], task.Last[:]) >= 0 {
+		task.done = true
+	} else {
+		task.Next = next
+	}
+	// Schedule the retrieval of everything the accounts reference
+	for i, value := range values {
+		var account state.Account
+		if err := rlp.DecodeBytes(value, &account); err != nil {
+			return 0, err
+		}
+		if account.Root != types.EmptyRootHash {
+			if ok, _ := r.db.Has(account.Root[:]); !ok {
+				r.tasks = append(r.tasks, &storageTask{
+					account: common.BytesToHash(keys[i]),
+					root:    account.Root,
+					batch:   batch,
+				})
+				batch.pending++
+			}
+		}
+		if hash := common.BytesToHash(account.CodeHash); hash != types.EmptyCodeHash {
+			if waiting, ok := r.codes[hash]; ok {
+				r.codes[hash] = append(waiting, batch)
+				batch.pending++
+			} else if ok, _ := r.db.Has(hash[:]); !ok {
+				r.codes[hash] = []*accountBatch{batch}
+				r.queue = append(r.queue, hash)
+				batch.pending++
+			}
+		}
+	}
+	r.accounts += len(keys)
+	if batch.pending == 0 {
+		return len(keys), s.commitAccounts(r, batch)
+	}
+	return len(keys), nil
+}
+
+// processStorage verifies and writes a batch of storage ranges.
+func (s *stateSync) processStorage(r *rangeSync, req *snapReq) (int, error) {
+	pack, ok := req.response.(*storageRangesPack)
+	if !ok || len(pack.packet.Slots) == 0 {
+		if ok {
+			// The peer doesn't have the requested state
+			r.failed[req.peer.id] = struct{}{}
+		}
+		r.tasks = append(req.storage, r.tasks...)
+		return 0, nil
+	}
+	res := pack.packet
+	if len(res.Slots) > len(req.storage) {
+		log.Warn("Invalid storage ranges, dropping peer", "peer", req.peer.id, "requested", len(req.storage), "delivered", len(res.Slots))
+		r.failed[req.peer.id] = struct{}{}
+		s.d.dropPeer(req.peer.id)
+		r.tasks = append(req.storage, r.tasks...)
+		return 0, nil
+	}
+	var (
+		delivered int
+		retry     = req.storage[len(res.Slots):]
+	)
+	for i, slots := range res.Slots {
+		task := req.storage[i]
+
+		keys := make([][]byte, len(slots))
+		values := make([][]byte, len(slots))
+		for j, slot := range slots {
+			keys[j], values[j] = common.CopyBytes(slot.Hash[:]), slot.Body
+		}
+		// Only the last range may be incomplete and come with a proof
+		var proof ethdb.KeyValueReader
+		if i == len(res.Slots)-1 && len(res.Proof) > 0 {
+			proof = proofSet(res.Proof)
+		}
+		batch := r.db.NewBatch()
+		more, err := trie.CommitRangeProof(task.root, task.origin[:], keys, values, proof, nil, batch)
+		if err != nil {
+			log.Warn("Invalid storage range, dropping peer", "peer", req.peer.id, "account", task.account, "err", err)
+			r.failed[req.peer.id] = struct{}{}
+			s.d.dropPeer(req.peer.id)
+			r.tasks = append(req.storage[i:], r.tasks...)
+			return delivered, nil
+		}
+		if err := batch.Write(); err != nil {
+			return delivered, err
+		}
+		delivered += len(keys)
+
+		if proof != nil {
+			task.chunked = true
+		}
+		if more && len(keys) > 0 {
+			if next, ok := incHash(common.BytesToHash(keys[len(keys)-1])); ok {
+				task.origin = next
+				retry = append([]*storageTask{task}, retry...)
+				continue
+			}
+		}
+		// Storage trie complete, the edges of chunked ones are left to healing
+		if task.chunked {
+			task.batch.skip = append(task.batch.skip, task.account[:])
+		}
+		if err := s.resolveAccounts(r, task.batch); err != nil {
+			return delivered, err
+		}
+	}
+	r.tasks = append(retry, r.tasks...)
+	r.slots += delivered
+	return delivered, nil
+}
+
+// processCodes writes a batch of contract codes.
+func (s *stateSync) processCodes(r *rangeSync, req *snapReq) (int, error) {
+	var codes [][]byte
+	if pack, ok := req.response.(*byteCodesPack); ok {
+		if codes = pack.codes; len(codes) == 0 {
+			// The peer doesn't have the requested codes
+			r.failed[req.peer.id] = struct{}{}
+		}
+	}
+	delivered := make(map[common.Hash]struct{})
+
+	batch := r.db.NewBatch()
+	for _, code := range codes {
+		hash := crypto.Keccak256Hash(code)
+		if _, ok := r.codes[hash]; !ok {
+			continue
+		}
+		if err := batch.Put(hash[:], code); err != nil {
+			return 0, err
+		}
+		delivered[hash] = struct{}{}
+	}
+	if err := batch.Write(); err != nil {
+		return 0, err
+	}
+	for _, hash := range req.codes {
+		if _, ok := delivered[hash]; !ok {
+			r.queue = append(r.queue, hash)
+			continue
+		}
+		waiting := r.codes[hash]
+		delete(r.codes, hash)
+
+		for _, batch := range waiting {
+			if err := s.resolveAccounts(r, batch); err != nil {
+				return len(delivered), err
+			}
+		}
+	}
+	r.bytecodes += len(delivered)
+	return len(delivered), nil
+}
+
+// resolveAccounts marks a storage trie or code of an account range retrieved,
+// writing the range once nothing is missing anymore.
+func (s *stateSync) resolveAccounts(r *rangeSync, batch *accountBatch) error {
+	if batch.pending--; batch.pending > 0 {
+		return nil
+	}
+	return s.commitAccounts(r, batch)
+}
+
+// commitAccounts writes the trie nodes of a complete account range.
+func (s *stateSync) commitAccounts(r *rangeSync, batch *accountBatch) error {
+	start := time.Now()
+
+	b := r.db.NewBatch()
+	if _, err := trie.CommitRangeProof(r.root, batch.origin[:], batch.keys, batch.values, batch.proof, batch.skip, b); err != nil {
+		return err
+	}
+	if err := b.Write(); err != nil {
+		return err
+	}
+	s.updateStats(len(batch.keys), 0, 0, time.Since(start))
+	return nil
+}
+
+// proofSet collects the nodes of a range proof into a database keyed by hash.
+func proofSet(nodes [][]byte) *memorydb.Database {
+	db := memorydb.New()
+	for _, node := range nodes {
+		db.Put(crypto.Keccak256(node), node)
+	}
+	return db
+}
@@ -22,9 +22,13 @@ import (
 	"sync"
 	"time"
 
+	"BRDPoSChain/BRCx/tradingstate"
+	"BRDPoSChain/BRCxlending/lendingstate"
 	"BRDPoSChain/common"
 	"BRDPoSChain/core/rawdb"
 	"BRDPoSChain/core/state"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/eth/snap"
 	"BRDPoSChain/ethdb"
 	"BRDPoSChain/ethdb/memorydb"
 	"BRDPoSChain/log"
@@ -36,6 +40,7 @@ import (
 // stateReq represents a batch of state fetch requests groupped together into
 // a single data retrieval network packet.
 type stateReq struct {
+	kind     snap.TrieKind              // Trie the state items belong to
 	items    []common.Hash              // Hashes of the state items to download
 	tasks    map[common.Hash]*stateTask // Download tasks to track previous attempts
 	timeout  time.Duration              // Maximum round trip time for this to complete
@@ -50,6 +55,49 @@ func (req *stateReq) timedOut() bool {
 	return req.response == nil
 }
 
+// snapReq represents a state retrieval request sent over the snap messages of
+// BRDPoS3: a chunk of the account trie, a batch of storage ranges, a batch of
+// contract codes or a batch of trie nodes to heal.
+type snapReq struct {
+	account  *accountTask   // Account range being retrieved
+	storage  []*storageTask // Storage ranges being retrieved
+	codes    []common.Hash  // Contract codes being retrieved
+	nodes    *stateReq      // Trie nodes being healed
+	timeout  time.Duration  // Maximum round trip time for this to complete
+	timer    *time.Timer    // Timer to fire when the RTT timeout expires
+	peer     *peerConnection
+	response dataPack // Response data of the peer (nil for timeouts)
+	dropped  bool     // Flag whether the peer dropped off early
+}
+
+// timedOut returns if this request timed out.
+func (req *snapReq) timedOut() bool {
+	return req.response == nil
+}
+
+// expects returns whether the delivered data pack answers this request.
+func (req *snapReq) expects(pack dataPack) bool {
+	switch pack.(type) {
+	case *accountRangePack:
+		return req.account != nil
+	case *storageRangesPack:
+		return req.storage != nil
+	case *byteCodesPack:
+		return req.codes != nil
+	case *trieNodesPack:
+		return req.nodes != nil
+	}
+	return false
+}
+
+// syncTrie is a trie retrieved by a state sync, along with the database its
+// nodes are written into.
+type syncTrie struct {
+	kind snap.TrieKind
+	root common.Hash
+	db   ethdb.KeyValueStore
+}
+
 // stateSyncStats is a collection of progress stats to report during a state trie
 // sync to RPC requests as well as to display in user logs.
 type stateSyncStats struct {
@@ -61,7 +109,41 @@ type stateSyncStats struct {
 
 // syncState starts downloading state with the given root hash.
 func (d *Downloader) syncState(root common.Hash) *stateSync {
-	s := newStateSync(d, root)
+	return d.syncTries([]*syncTrie{{kind: snap.StateTrie, root: root, db: d.stateDB}})
+}
+
+// syncPivotState starts downloading the state of the pivot block, including the
+// BRCx trading and lending tries needed to import the blocks after it.
+func (d *Downloader) syncPivotState(pivot *fetchResult) *stateSync {
+	tries := []*syncTrie{{kind: snap.StateTrie, root: pivot.Header.Root, db: d.stateDB}}
+
+	if chain, ok := d.blockchain.(BRCxChain); ok {
+		block := types.NewBlockWithHeader(pivot.Header).WithBody(pivot.Transactions, pivot.Uncles)
+		trading, lending := chain.BRCxStateRoots(block)
+
+		tries = appendBRCxTrie(tries, snap.TradingTrie, trading, chain.TradingTrieDB())
+		tries = appendBRCxTrie(tries, snap.LendingTrie, lending, chain.LendingTrieDB())
+	}
+	return d.syncTries(tries)
+}
+
+// appendBRCxTrie adds a BRCx trie to the set of tries to sync if the engine is
+// active and its database is writable.
+func appendBRCxTrie(tries []*syncTrie, kind snap.TrieKind, root common.Hash, triedb *trie.Database) []*syncTrie {
+	if triedb == nil || root == (common.Hash{}) || root == types.EmptyRootHash {
+		return tries
+	}
+	db, ok := triedb.DiskDB().(ethdb.KeyValueStore)
+	if !ok {
+		log.Warn("Unwritable trie database, skipping sync", "kind", kind, "root", root)
+		return tries
+	}
+	return append(tries, &syncTrie{kind: kind, root: root, db: db})
+}
+
+// syncTries starts downloading the given tries one after the other.
+func (d *Downloader) syncTries(tries []*syncTrie) *stateSync {
+	s := newStateSync(d, tries)
 	select {
 	case d.stateSyncStart <- s:
 	case <-d.quitCh:
@@ -82,6 +164,8 @@ func (d *Downloader) stateFetcher() {
 			}
 		case <-d.stateCh:
 			// Ignore state responses while no sync is running.
+		case <-d.snapCh:
+			// Ignore snap responses while no sync is running.
 		case <-d.quitCh:
 			return
 		}
@@ -95,6 +179,10 @@ func (d *Downloader) runStateSync(s *stateSync) *stateSync {
 		active   = make(map[string]*stateReq) // Currently in-flight requests
 		finished []*stateReq                  // Completed or failed requests
 		timeout  = make(chan *stateReq)       // Timed out active requests
+
+		activeSnap   = make(map[string]*snapReq) // Currently in-flight snap requests
+		finishedSnap []*snapReq                  // Completed or failed snap requests
+		timeoutSnap  = make(chan *snapReq)       // Timed out active snap requests
 	)
 	defer func() {
 		// Cancel active request timers on exit. Also set peers to idle so they're
@@ -103,6 +191,18 @@ func (d *Downloader) runStateSync(s *stateSync) *stateSync {
 			req.timer.Stop()
 			req.peer.SetNodeDataIdle(len(req.items))
 		}
+		for _, req := range activeSnap {
+			req.timer.Stop()
+			req.peer.SetSnapIdle(0)
+		}
+		// Requests finished but not yet processed by the sync would otherwise
+		// leave their peers busy forever.
+		for _, req := range finished {
+			req.peer.SetNodeDataIdle(len(req.response))
+		}
+		for _, req := range finishedSnap {
+			req.peer.SetSnapIdle(0)
+		}
 	}()
 	// Run the state sync.
 	go s.run()
@@ -123,6 +223,14 @@ func (d *Downloader) runStateSync(s *stateSync) *stateSync {
 			deliverReq = finished[0]
 			deliverReqCh = s.deliver
 		}
+		var (
+			deliverSnap   *snapReq
+			deliverSnapCh chan *snapReq
+		)
+		if len(finishedSnap) > 0 {
+			deliverSnap = finishedSnap[0]
+			deliverSnapCh = s.deliverSnap
+		}
 
 		select {
 		// The stateSync lifecycle:
@@ -139,6 +247,11 @@ func (d *Downloader) runStateSync(s *stateSync) *stateSync {
 			finished[len(finished)-1] = nil
 			finished = finished[:len(finished)-1]
 
+		case deliverSnapCh <- deliverSnap:
+			copy(finishedSnap, finishedSnap[1:])
+			finishedSnap[len(finishedSnap)-1] = nil
+			finishedSnap = finishedSnap[:len(finishedSnap)-1]
+
 		// Handle incoming state packs:
 		case pack := <-d.stateCh:
 			// Discard any data not requested (or previsouly timed out)
@@ -154,19 +267,38 @@ func (d *Downloader) runStateSync(s *stateSync) *stateSync {
 			finished = append(finished, req)
 			delete(active, pack.PeerId())
 
-			// Handle dropped peer connections:
-		case p := <-peerDrop:
-			// Skip if no request is currently pending
-			req := active[p.id]
-			if req == nil {
+		// Handle incoming snap packs:
+		case pack := <-d.snapCh:
+			// Discard any data not requested (or previsouly timed out)
+			req := activeSnap[pack.PeerId()]
+			if req == nil || !req.expects(pack) {
+				log.Debug("Unrequested snap data", "peer", pack.PeerId(), "len", pack.Items())
 				continue
 			}
 			// Finalize the request and queue up for processing
 			req.timer.Stop()
-			req.dropped = true
+			req.response = pack
 
-			finished = append(finished, req)
-			delete(active, p.id)
+			finishedSnap = append(finishedSnap, req)
+			delete(activeSnap, pack.PeerId())
+
+			// Handle dropped peer connections:
+		case p := <-peerDrop:
+			// Finalize any pending request and queue up for processing
+			if req := active[p.id]; req != nil {
+				req.timer.Stop()
+				req.dropped = true
+
+				finished = append(finished, req)
+				delete(active, p.id)
+			}
+			if req := activeSnap[p.id]; req != nil {
+				req.timer.Stop()
+				req.dropped = true
+
+				finishedSnap = append(finishedSnap, req)
+				delete(activeSnap, p.id)
+			}
 
 		// Handle timed-out requests:
 		case req := <-timeout:
@@ -180,6 +312,15 @@ func (d *Downloader) runStateSync(s *stateSync) *stateSync {
 			finished = append(finished, req)
 			delete(active, req.peer.id)
 
+		case req := <-timeoutSnap:
+			if activeSnap[req.peer.id] != req {
+				continue
+			}
+			snapTimeoutMeter.Mark(1)
+
+			finishedSnap = append(finishedSnap, req)
+			delete(activeSnap, req.peer.id)
+
 		// Track outgoing state requests:
 		case req := <-d.trackStateReq:
 			// If an active request already exists for this peer, we have a problem. In
@@ -207,27 +348,50 @@ func (d *Downloader) runStateSync(s *stateSync) *stateSync {
 				}
 			})
 			active[req.peer.id] = req
+
+		// Track outgoing snap requests:
+		case req := <-d.trackSnapReq:
+			// Same as for the state requests, never silently overwrite a request
+			if old := activeSnap[req.peer.id]; old != nil {
+				log.Warn("Busy peer assigned new snap fetch", "peer", old.peer.id)
+
+				old.timer.Stop()
+				old.dropped = true
+
+				finishedSnap = append(finishedSnap, old)
+			}
+			req.timer = time.AfterFunc(req.timeout, func() {
+				select {
+				case timeoutSnap <- req:
+				case <-s.done:
+				}
+			})
+			activeSnap[req.peer.id] = req
 		}
 	}
 }
 
-// stateSync schedules requests for downloading a particular state trie defined
-// by a given state root.
+// stateSync schedules requests for downloading a set of tries defined by their
+// roots: the account state trie and optionally the BRCx tries.
 type stateSync struct {
 	d *Downloader // Downloader instance to access and manage current peerset
 
-	sched  *trie.Sync                 // State trie sync scheduler defining the tasks
+	tries  []*syncTrie                // Tries to retrieve, in order
+	trie   *syncTrie                  // Trie currently being healed
+	sched  *trie.Sync                 // Trie sync scheduler defining the tasks
+	bloom  *trie.SyncBloom            // Bloom filter of the trie nodes already on disk
 	keccak hash.Hash                  // Keccak256 hasher to verify deliveries with
 	tasks  map[common.Hash]*stateTask // Set of tasks currently queued for retrieval
 
 	numUncommitted   int
 	bytesUncommitted int
 
-	deliver    chan *stateReq // Delivery channel multiplexing peer responses
-	cancel     chan struct{}  // Channel to signal a termination request
-	cancelOnce sync.Once      // Ensures cancel only ever gets called once
-	done       chan struct{}  // Channel to signal termination completion
-	err        error          // Any error hit during sync (set before completion)
+	deliver     chan *stateReq // Delivery channel multiplexing peer responses
+	deliverSnap chan *snapReq  // Delivery channel multiplexing peer snap responses
+	cancel      chan struct{}  // Channel to signal a termination request
+	cancelOnce  sync.Once      // Ensures cancel only ever gets called once
+	done        chan struct{}  // Channel to signal termination completion
+	err         error          // Any error hit during sync (set before completion)
 }
 
 // stateTask represents a single trie node download taks, containing a set of
@@ -236,18 +400,39 @@ type stateTask struct {
 	attempts map[string]struct{}
 }
 
-// newStateSync creates a new state trie download scheduler. This method does not
+// newStateSync creates a new trie download scheduler. This method does not
 // yet start the sync. The user needs to call run to initiate.
-// only use fast sync but BRC only run full sync
-func newStateSync(d *Downloader, root common.Hash) *stateSync {
+func newStateSync(d *Downloader, tries []*syncTrie) *stateSync {
 	return &stateSync{
-		d:       d,
-		sched:   state.NewStateSync(root, d.stateDB, trie.NewSyncBloom(1, memorydb.New())),
-		keccak:  sha3.NewLegacyKeccak256(),
-		tasks:   make(map[common.Hash]*stateTask),
-		deliver: make(chan *stateReq),
-		cancel:  make(chan struct{}),
-		done:    make(chan struct{}),
+		d:           d,
+		tries:       tries,
+		keccak:      sha3.NewLegacyKeccak256(),
+		deliver:     make(chan *stateReq),
+		deliverSnap: make(chan *snapReq),
+		cancel:      make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// newScheduler creates the trie sync scheduler of the given trie.
+//
+// Fast sync only uses the bloom filter to skip the nodes it retrieved itself,
+// as BRC nodes normally run full sync. Snap sync needs to know about the nodes
+// written by its range phase, so it loads the bloom filter from the database.
+func (s *stateSync) newScheduler(tr *syncTrie) (*trie.Sync, *trie.SyncBloom) {
+	var bloom *trie.SyncBloom
+	if s.d.snapSync {
+		bloom = trie.NewSyncBloom(1, tr.db)
+	} else {
+		bloom = trie.NewSyncBloom(1, memorydb.New())
+	}
+	switch tr.kind {
+	case snap.TradingTrie:
+		return tradingstate.NewStateSync(tr.root, tr.db, bloom), bloom
+	case snap.LendingTrie:
+		return lendingstate.NewStateSync(tr.root, tr.db, bloom), bloom
+	default:
+		return state.NewStateSync(tr.root, tr.db, bloom), bloom
 	}
 }
 
@@ -283,6 +468,30 @@ func (s *stateSync) loop() error {
 	peerSub := s.d.peers.SubscribeNewPeers(newPeer)
 	defer peerSub.Unsubscribe()
 
+	for _, tr := range s.tries {
+		// Snap sync retrieves the bulk of the account state as ranges first
+		if s.d.snapSync && tr.kind == snap.StateTrie {
+			if err := s.syncRanges(tr, newPeer); err != nil {
+				return err
+			}
+		}
+		// Fill in whatever is still missing node by node
+		if err := s.heal(tr, newPeer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// heal retrieves all the missing nodes of a trie.
+func (s *stateSync) heal(tr *syncTrie, newPeer chan *peerConnection) error {
+	s.trie, s.tasks = tr, make(map[common.Hash]*stateTask)
+	s.sched, s.bloom = s.newScheduler(tr)
+	defer s.bloom.Close()
+
+	if tr.kind != snap.StateTrie {
+		log.Info("Syncing BRCx state", "kind", tr.kind, "root", tr.root)
+	}
 	// Keep assigning new tasks until the sync completes or aborts
 	for s.sched.Pending() > 0 {
 		if err := s.commit(false); err != nil {
@@ -315,6 +524,29 @@ func (s *stateSync) loop() error {
 				return err
 			}
 			req.peer.SetNodeDataIdle(len(req.response))
+
+		case sreq := <-s.deliverSnap:
+			// Range responses may only arrive late, after their phase is over
+			req := sreq.nodes
+			if req == nil {
+				sreq.peer.SetSnapIdle(0)
+				continue
+			}
+			if pack, ok := sreq.response.(*trieNodesPack); ok {
+				req.response = pack.nodes
+			}
+			req.dropped = sreq.dropped
+
+			log.Trace("Received trie node response", "peer", req.peer.id, "kind", req.kind, "count", len(req.response), "dropped", req.dropped, "timeout", !req.dropped && req.timedOut())
+			if len(req.items) <= 2 && !req.dropped && req.timedOut() {
+				log.Warn("Stalling state sync, dropping peer", "peer", req.peer.id)
+				s.d.dropPeer(req.peer.id)
+			}
+			if err := s.process(req); err != nil {
+				log.Warn("Trie node write error", "kind", req.kind, "err", err)
+				return err
+			}
+			req.peer.SetSnapIdle(len(req.response))
 		}
 	}
 	return s.commit(true)
@@ -325,7 +557,7 @@ func (s *stateSync) commit(force bool) error {
 		return nil
 	}
 	start := time.Now()
-	b := s.d.stateDB.NewBatch()
+	b := s.trie.db.NewBatch()
 	s.sched.Commit(b)
 	if err := b.Write(); err != nil {
 		return fmt.Errorf("write DB error: %v", err)
@@ -339,6 +571,11 @@ func (s *stateSync) commit(force bool) error {
 // assignTasks attempts to assing new tasks to all idle peers, either from the
 // batch currently being retried, or fetching new data from the trie sync itself.
 func (s *stateSync) assignTasks() {
+	// The BRCx tries are only served over the snap messages
+	if s.trie.kind != snap.StateTrie {
+		s.assignTrieNodeTasks()
+		return
+	}
 	// Iterate over all idle peers and try to assign them state fetches
 	peers, _ := s.d.peers.NodeDataIdlePeers()
 	for _, p := range peers {
@@ -360,6 +597,27 @@ func (s *stateSync) assignTasks() {
 	}
 }
 
+// assignTrieNodeTasks attempts to assign trie node fetches of the trie being
+// healed to all snap-idle peers.
+func (s *stateSync) assignTrieNodeTasks() {
+	peers, _ := s.d.peers.SnapIdlePeers()
+	for _, p := range peers {
+		req := &stateReq{kind: s.trie.kind, peer: p, timeout: s.d.requestTTL()}
+		s.fillTasks(p.SnapCapacity(s.d.requestRTT()), req)
+
+		if len(req.items) > 0 {
+			req.peer.log.Trace("Requesting new batch of data", "type", req.kind, "count", len(req.items))
+			sreq := &snapReq{nodes: req, peer: p, timeout: req.timeout}
+			select {
+			case s.d.trackSnapReq <- sreq:
+				req.peer.FetchTrieNodes(req.kind, req.items, snap.SoftResponseLimit)
+			case <-s.cancel:
+			case <-s.d.cancelCh:
+			}
+		}
+	}
+}
+
 // fillTasks fills the given request object with a maximum of n state download
 // tasks to send to the remote peer.
 func (s *stateSync) fillTasks(n int, req *stateReq) {
@@ -418,12 +676,15 @@ func (s *stateSync) process(req *stateReq) error {
 		case trie.ErrAlreadyProcessed:
 			duplicate++
 		default:
-			return fmt.Errorf("invalid state node %s: %v", hash.TerminalString(), err)
+			return fmt.Errorf("invalid %s node %s: %v", req.kind, hash.TerminalString(), err)
 		}
 		delete(req.tasks, hash)
 	}
 	// Put unfulfilled tasks back into the retry queue
 	npeers := s.d.peers.Len()
+	if req.kind != snap.StateTrie {
+		_, npeers = s.d.peers.SnapIdlePeers()
+	}
 	for hash, task := range req.tasks {
 		// If the node did deliver something, missing items may be due to a protocol
 		// limit or a previous timeout + delayed delivery. Both cases should permit
@@ -434,7 +695,7 @@ func (s *stateSync) process(req *stateReq) error {
 		// If we've requested the node too many times already, it may be a malicious
 		// sync where nobody has the right data. Abort.
 		if len(task.attempts) >= npeers {
-			return fmt.Errorf("state node %s failed with all peers (%d tries, %d peers)", hash.TerminalString(), len(task.attempts), npeers)
+			return fmt.Errorf("%s node %s failed with all peers (%d tries, %d peers)", req.kind, hash.TerminalString(), len(task.attempts), npeers)
 		}
 		// Missing item, place into the retry queue.
 		s.tasks[hash] = task
@@ -460,7 +721,9 @@ func (s *stateSync) updateStats(written, duplicate, unexpected int, duration tim
 	s.d.syncStatsLock.Lock()
 	defer s.d.syncStatsLock.Unlock()
 
-	s.d.syncStatsState.pending = uint64(s.sched.Pending())
+	if s.sched != nil {
+		s.d.syncStatsState.pending = uint64(s.sched.Pending())
+	}
 	s.d.syncStatsState.processed += uint64(written)
 	s.d.syncStatsState.duplicate += uint64(duplicate)
 	s.d.syncStatsState.unexpected += uint64(unexpected)
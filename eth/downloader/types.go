@@ -20,6 +20,7 @@ import (
 	"fmt"
 
 	"BRDPoSChain/core/types"
+	"BRDPoSChain/eth/snap"
 )
 
 // peerDropFn is a callback type for dropping a peer detected as malicious.
@@ -77,3 +78,54 @@ type statePack struct {
 func (p *statePack) PeerId() string { return p.peerId }
 func (p *statePack) Items() int     { return len(p.states) }
 func (p *statePack) Stats() string  { return fmt.Sprintf("%d", len(p.states)) }
+
+// accountRangePack is a range of accounts returned by a peer.
+type accountRangePack struct {
+	peerId string
+	packet *snap.AccountRangePacket
+}
+
+func (p *accountRangePack) PeerId() string { return p.peerId }
+func (p *accountRangePack) Items() int     { return len(p.packet.Accounts) }
+func (p *accountRangePack) Stats() string {
+	return fmt.Sprintf("%d:%d", len(p.packet.Accounts), len(p.packet.Proof))
+}
+
+// storageRangesPack is a batch of storage ranges returned by a peer.
+type storageRangesPack struct {
+	peerId string
+	packet *snap.StorageRangesPacket
+}
+
+func (p *storageRangesPack) PeerId() string { return p.peerId }
+func (p *storageRangesPack) Items() int {
+	items := 0
+	for _, slots := range p.packet.Slots {
+		items += len(slots)
+	}
+	return items
+}
+func (p *storageRangesPack) Stats() string {
+	return fmt.Sprintf("%d:%d:%d", len(p.packet.Slots), p.Items(), len(p.packet.Proof))
+}
+
+// byteCodesPack is a batch of contract codes returned by a peer.
+type byteCodesPack struct {
+	peerId string
+	codes  [][]byte
+}
+
+func (p *byteCodesPack) PeerId() string { return p.peerId }
+func (p *byteCodesPack) Items() int     { return len(p.codes) }
+func (p *byteCodesPack) Stats() string  { return fmt.Sprintf("%d", len(p.codes)) }
+
+// trieNodesPack is a batch of trie nodes returned by a peer over the snap
+// messages.
+type trieNodesPack struct {
+	peerId string
+	nodes  [][]byte
+}
+
+func (p *trieNodesPack) PeerId() string { return p.peerId }
+func (p *trieNodesPack) Items() int     { return len(p.nodes) }
+func (p *trieNodesPack) Stats() string  { return fmt.Sprintf("%d", len(p.nodes)) }
@@ -70,6 +70,7 @@ var Defaults = Config{
 	DatabaseCache:      768,
 	TrieCache:          256,
 	TrieTimeout:        5 * time.Minute,
+	SnapshotCache:      102,
 	FilterLogCacheSize: 32,
 	GasPrice:           big.NewInt(0.25 * params.Shannon),
 
@@ -114,6 +115,10 @@ type Config struct {
 	SyncMode  downloader.SyncMode
 	NoPruning bool
 
+	// TxLookupLimit is the maximum number of blocks from head whose tx indices
+	// are reserved, 0 means the entire chain is indexed.
+	TxLookupLimit uint64 `toml:",omitempty"`
+
 	// Light client options
 	LightServ  int `toml:",omitempty"` // Maximum percentage of time allowed for serving LES requests
 	LightPeers int `toml:",omitempty"` // Maximum number of LES client peers
@@ -122,8 +127,10 @@ type Config struct {
 	SkipBcVersionCheck bool `toml:"-"`
 	DatabaseHandles    int  `toml:"-"`
 	DatabaseCache      int
+	DatabaseFreezer    string
 	TrieCache          int
 	TrieTimeout        time.Duration
+	SnapshotCache      int
 
 	// This is the number of blocks for which logs will be cached in the filter system.
 	FilterLogCacheSize int
@@ -133,6 +140,7 @@ type Config struct {
 	MinerThreads int            `toml:",omitempty"`
 	ExtraData    []byte         `toml:",omitempty"`
 	GasPrice     *big.Int
+	BLSKeyFile   string `toml:",omitempty"` // BLS key the masternode signs v2 votes and timeouts with after TIPBLS
 
 	// Ethash options
 	Ethash ethash.Config
@@ -162,6 +162,11 @@ const (
 	PendingTransactionsSubscription
 	// BlocksSubscription queries hashes for blocks that are imported
 	BlocksSubscription
+	// FinalizedBlocksSubscription queries headers for blocks that are committed
+	// by the consensus
+	FinalizedBlocksSubscription
+	// FinalizedLogsSubscription queries for logs in committed blocks
+	FinalizedLogsSubscription
 	// LastSubscription keeps track of the last index
 	LastIndexSubscription
 )
@@ -198,6 +203,8 @@ type EventSystem struct {
 	lightMode bool
 	lastHead  *types.Header
 
+	lastFinalized *types.Header // Last committed header notified to the finalized subscriptions
+
 	// Subscriptions
 	txsSub         event.Subscription // Subscription for new transaction event
 	logsSub        event.Subscription // Subscription for new log event
@@ -317,6 +324,10 @@ func (es *EventSystem) SubscribeLogs(crit ethereum.FilterQuery, logs chan []*typ
 	if from == rpc.PendingBlockNumber && to == rpc.PendingBlockNumber {
 		return es.subscribePendingLogs(crit, logs), nil
 	}
+	// only interested in logs of committed blocks, which can't be reorged
+	if from == rpc.CommittedBlockNumber && to == rpc.CommittedBlockNumber {
+		return es.subscribeFinalizedLogs(crit, logs), nil
+	}
 	// only interested in new mined logs
 	if from == rpc.LatestBlockNumber && to == rpc.LatestBlockNumber {
 		return es.subscribeLogs(crit, logs), nil
@@ -370,6 +381,23 @@ func (es *EventSystem) subscribeLogs(crit ethereum.FilterQuery, logs chan []*typ
 	return es.subscribe(sub)
 }
 
+// subscribeFinalizedLogs creates a subscription that will write the logs of the
+// committed blocks matching the given criteria to the given logs channel.
+func (es *EventSystem) subscribeFinalizedLogs(crit ethereum.FilterQuery, logs chan []*types.Log) *Subscription {
+	sub := &subscription{
+		id:        rpc.NewID(),
+		typ:       FinalizedLogsSubscription,
+		logsCrit:  crit,
+		created:   time.Now(),
+		logs:      logs,
+		hashes:    make(chan []common.Hash),
+		headers:   make(chan *types.Header),
+		installed: make(chan struct{}),
+		err:       make(chan error),
+	}
+	return es.subscribe(sub)
+}
+
 // subscribePendingLogs creates a subscription that writes transaction hashes for
 // transactions that enter the transaction pool.
 func (es *EventSystem) subscribePendingLogs(crit ethereum.FilterQuery, logs chan []*types.Log) *Subscription {
@@ -403,6 +431,23 @@ func (es *EventSystem) SubscribeNewHeads(headers chan *types.Header) *Subscripti
 	return es.subscribe(sub)
 }
 
+// SubscribeNewFinalizedHeads creates a subscription that writes the header of a
+// block once it's committed by the consensus. The headers are written in order,
+// each of them only once.
+func (es *EventSystem) SubscribeNewFinalizedHeads(headers chan *types.Header) *Subscription {
+	sub := &subscription{
+		id:        rpc.NewID(),
+		typ:       FinalizedBlocksSubscription,
+		created:   time.Now(),
+		logs:      make(chan []*types.Log),
+		hashes:    make(chan []common.Hash),
+		headers:   headers,
+		installed: make(chan struct{}),
+		err:       make(chan error),
+	}
+	return es.subscribe(sub)
+}
+
 // SubscribePendingTxs creates a subscription that writes transaction hashes for
 // transactions that enter the transaction pool.
 func (es *EventSystem) SubscribePendingTxs(hashes chan []common.Hash) *Subscription {
@@ -483,6 +528,57 @@ func (es *EventSystem) handleChainEvent(filters filterIndex, ev core.ChainEvent)
 			}
 		})
 	}
+	if len(filters[FinalizedBlocksSubscription]) == 0 && len(filters[FinalizedLogsSubscription]) == 0 {
+		// nobody listens, start again from the committed block of the next subscription
+		es.lastFinalized = nil
+		return
+	}
+	es.finalizedNewHeads(func(header *types.Header) {
+		for _, f := range filters[FinalizedBlocksSubscription] {
+			f.headers <- header
+		}
+		for _, f := range filters[FinalizedLogsSubscription] {
+			if matchedLogs := es.lightFilterLogs(header, f.logsCrit.Addresses, f.logsCrit.Topics, false); len(matchedLogs) > 0 {
+				f.logs <- matchedLogs
+			}
+		}
+	})
+}
+
+// committedHeader returns the header of the latest block committed by the
+// consensus, or nil if the engine doesn't commit blocks.
+func (es *EventSystem) committedHeader() *types.Header {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	header, _ := es.backend.HeaderByNumber(ctx, rpc.CommittedBlockNumber)
+	return header
+}
+
+// finalizedNewHeads calls back with the headers committed since the last call,
+// from the oldest to the newest. A committed block is final, the committed
+// chain only ever grows.
+func (es *EventSystem) finalizedNewHeads(callBack func(*types.Header)) {
+	newHeader := es.committedHeader()
+	if newHeader == nil {
+		return
+	}
+	oldh := es.lastFinalized
+	if oldh != nil && newHeader.Number.Cmp(oldh.Number) <= 0 {
+		return
+	}
+	es.lastFinalized = newHeader
+	if oldh == nil {
+		return
+	}
+	// collect the newly committed headers (array is in reverse order)
+	var newHeaders []*types.Header
+	for h := newHeader; h != nil && h.Number.Cmp(oldh.Number) > 0; {
+		newHeaders = append(newHeaders, h)
+		h = rawdb.ReadHeader(es.backend.ChainDb(), h.ParentHash, h.Number.Uint64()-1)
+	}
+	for i := len(newHeaders) - 1; i >= 0; i-- {
+		callBack(newHeaders[i])
+	}
 }
 
 func (es *EventSystem) lightFilterNewHead(newHeader *types.Header, callBack func(*types.Header, bool)) {
@@ -518,7 +614,7 @@ func (es *EventSystem) lightFilterNewHead(newHeader *types.Header, callBack func
 	}
 }
 
-// filter logs of a single header in light client mode
+// filter logs of a single header in light client mode or once it is committed
 func (es *EventSystem) lightFilterLogs(header *types.Header, addresses []common.Address, topics [][]common.Hash, remove bool) []*types.Log {
 	if !bloomFilter(header.Bloom, addresses, topics) {
 		return nil
@@ -592,6 +688,10 @@ func (es *EventSystem) eventLoop() {
 			} else {
 				index[f.typ][f.id] = f
 			}
+			if (f.typ == FinalizedBlocksSubscription || f.typ == FinalizedLogsSubscription) && es.lastFinalized == nil {
+				// notify the blocks committed from now on
+				es.lastFinalized = es.committedHeader()
+			}
 			close(f.installed)
 
 		case f := <-es.uninstall:
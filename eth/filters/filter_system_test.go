@@ -24,6 +24,7 @@ import (
 	"math/rand"
 	"reflect"
 	"runtime"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -50,6 +51,7 @@ type testBackend struct {
 	rmLogsFeed      event.Feed
 	pendingLogsFeed event.Feed
 	chainFeed       event.Feed
+	committed       atomic.Pointer[types.Header]
 }
 
 func (b *testBackend) ChainConfig() *params.ChainConfig {
@@ -78,6 +80,8 @@ func (b *testBackend) HeaderByNumber(ctx context.Context, blockNr rpc.BlockNumbe
 		}
 		num = *number
 	case rpc.CommittedBlockNumber:
+		return b.committed.Load(), nil
+	case rpc.SafeBlockNumber:
 		return nil, nil
 	default:
 		num = uint64(blockNr)
@@ -761,6 +765,138 @@ func TestLightFilterLogs(t *testing.T) {
 	}
 }
 
+// TestFinalizedSubscription tests if the finalized heads and logs subscriptions
+// only notify the committed blocks, in order and once, however the committed
+// block advances between the chain events.
+func TestFinalizedSubscription(t *testing.T) {
+	t.Parallel()
+
+	var (
+		db           = rawdb.NewMemoryDatabase()
+		backend, sys = newTestFilterSystem(t, db, Config{})
+		api          = NewFilterAPI(sys, false)
+		signer       = types.HomesteadSigner{}
+
+		firstAddr  = common.HexToAddress("0x1111111111111111111111111111111111111111")
+		secondAddr = common.HexToAddress("0x2222222222222222222222222222222222222222")
+
+		allLogs = []*types.Log{
+			{Address: firstAddr, Topics: []common.Hash{}, Data: []byte{}, BlockNumber: 1, Index: 0},
+			{Address: secondAddr, Topics: []common.Hash{}, Data: []byte{}, BlockNumber: 2, Index: 0},
+			{Address: firstAddr, Topics: []common.Hash{}, Data: []byte{}, BlockNumber: 3, Index: 0},
+		}
+		finalized = big.NewInt(rpc.CommittedBlockNumber.Int64())
+
+		testCases = []struct {
+			crit     FilterCriteria
+			expected []*types.Log
+			id       rpc.ID
+		}{
+			// all committed logs
+			0: {FilterCriteria{FromBlock: finalized, ToBlock: finalized}, allLogs, ""},
+			// committed logs based on addresses
+			1: {FilterCriteria{FromBlock: finalized, ToBlock: finalized, Addresses: []common.Address{firstAddr}}, []*types.Log{allLogs[0], allLogs[2]}, ""},
+		}
+
+		key, _  = crypto.GenerateKey()
+		addr    = crypto.PubkeyToAddress(key.PublicKey)
+		genesis = &core.Genesis{Config: params.TestChainConfig,
+			Alloc: types.GenesisAlloc{
+				addr: {Balance: big.NewInt(params.Ether)},
+			},
+		}
+	)
+
+	gendb, blocks, _ := core.GenerateChainWithGenesis(genesis, ethash.NewFaker(), 3, func(i int, b *core.BlockGen) {
+		receipt := &types.Receipt{Logs: []*types.Log{allLogs[i]}}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		b.AddUncheckedReceipt(receipt)
+		tx, _ := types.SignTx(types.NewTx(&types.LegacyTx{Nonce: uint64(i), To: &common.Address{}, Value: big.NewInt(1000), Gas: params.TxGas, GasPrice: big.NewInt(2100), Data: nil}), signer, key)
+		b.AddTx(tx)
+	})
+	genesisBlock := rawdb.ReadBlock(gendb, rawdb.ReadCanonicalHash(gendb, 0), 0)
+	blocks = append([]*types.Block{genesisBlock}, blocks...)
+	for i, block := range blocks {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		rawdb.WriteHeadBlockHash(db, block.Hash())
+		if i > 0 {
+			rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), []*types.Receipt{{Logs: []*types.Log{allLogs[i-1]}}})
+		}
+	}
+	// the blocks committed before the subscriptions are not notified
+	backend.committed.Store(blocks[0].Header())
+
+	headers := make(chan *types.Header)
+	headersSub := api.events.SubscribeNewFinalizedHeads(headers)
+	defer headersSub.Unsubscribe()
+	for i := range testCases {
+		id, err := api.NewFilter(testCases[i].crit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testCases[i].id = id
+	}
+
+	// the committed block lags behind the head and skips a block
+	go func() {
+		backend.committed.Store(blocks[1].Header())
+		backend.chainFeed.Send(core.ChainEvent{Block: blocks[2], Hash: blocks[2].Hash()})
+		backend.chainFeed.Send(core.ChainEvent{Block: blocks[3], Hash: blocks[3].Hash()})
+		backend.committed.Store(blocks[3].Header())
+		backend.chainFeed.Send(core.ChainEvent{Block: blocks[3], Hash: blocks[3].Hash()})
+	}()
+
+	for i := 1; i < len(blocks); i++ {
+		select {
+		case header := <-headers:
+			if header.Hash() != blocks[i].Hash() {
+				t.Fatalf("invalid finalized header, want block %d, got block %d", i, header.Number)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("finalized header %d not notified", i)
+		}
+	}
+	select {
+	case header := <-headers:
+		t.Fatalf("unexpected finalized header %d", header.Number)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	for i, tt := range testCases {
+		var fetched []*types.Log
+		timeout := time.Now().Add(1 * time.Second)
+		for { // fetch all expected logs
+			results, err := api.GetFilterChanges(tt.id)
+			if err != nil {
+				t.Fatalf("Unable to fetch logs: %v", err)
+			}
+			fetched = append(fetched, results.([]*types.Log)...)
+			if len(fetched) >= len(tt.expected) {
+				break
+			}
+			// check timeout
+			if time.Now().After(timeout) {
+				break
+			}
+
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		if len(fetched) != len(tt.expected) {
+			t.Fatalf("invalid number of logs for case %d, want %d log(s), got %d", i, len(tt.expected), len(fetched))
+		}
+		for l := range fetched {
+			expected := *tt.expected[l]
+			expected.BlockHash = blocks[expected.BlockNumber].Hash()
+			expected.TxHash = blocks[expected.BlockNumber].Transactions()[0].Hash()
+			if !reflect.DeepEqual(fetched[l], &expected) {
+				t.Errorf("invalid log on index %d for case %d", l, i)
+			}
+		}
+	}
+}
+
 // TestPendingTxFilterDeadlock tests if the event loop hangs when pending
 // txes arrive at the same time that one of multiple filters is timing out.
 // Please refer to #22131 for more details.
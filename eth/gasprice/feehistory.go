@@ -172,8 +172,8 @@ func (oracle *Oracle) resolveBlockRange(ctx context.Context, reqEnd rpc.BlockNum
 		case rpc.LatestBlockNumber:
 			// Retrieved above.
 			resolved = headBlock
-		case rpc.CommittedBlockNumber:
-			resolved, err = oracle.backend.HeaderByNumber(ctx, rpc.CommittedBlockNumber)
+		case rpc.CommittedBlockNumber, rpc.SafeBlockNumber:
+			resolved, err = oracle.backend.HeaderByNumber(ctx, reqEnd)
 		case rpc.EarliestBlockNumber:
 			resolved, err = oracle.backend.HeaderByNumber(ctx, rpc.EarliestBlockNumber)
 		}
@@ -35,6 +35,7 @@ import (
 	"BRDPoSChain/eth/bft"
 	"BRDPoSChain/eth/downloader"
 	"BRDPoSChain/eth/fetcher"
+	"BRDPoSChain/eth/snap"
 	"BRDPoSChain/ethdb"
 	"BRDPoSChain/event"
 	"BRDPoSChain/log"
@@ -42,6 +43,7 @@ import (
 	"BRDPoSChain/p2p/discover"
 	"BRDPoSChain/params"
 	"BRDPoSChain/rlp"
+	"BRDPoSChain/trie"
 )
 
 const (
@@ -69,6 +71,7 @@ type ProtocolManager struct {
 	networkId uint64
 
 	fastSync  uint32 // Flag whether fast sync is enabled (gets disabled if we already have blocks)
+	snapSync  uint32 // Flag whether fast sync should retrieve the state via snap ranges
 	acceptTxs uint32 // Flag whether we're considered synchronised (enables transaction processing)
 
 	txpool      txPool
@@ -151,18 +154,21 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 		lendingTxSub:   nil,
 	}
 	// Figure out whether to allow fast sync or not
-	if mode == downloader.FastSync && blockchain.CurrentBlock().NumberU64() > 0 {
+	if (mode == downloader.FastSync || mode == downloader.SnapSync) && blockchain.CurrentBlock().NumberU64() > 0 {
 		log.Warn("Blockchain not empty, fast sync disabled")
 		mode = downloader.FullSync
 	}
-	if mode == downloader.FastSync {
+	if mode == downloader.FastSync || mode == downloader.SnapSync {
 		manager.fastSync = uint32(1)
 	}
+	if mode == downloader.SnapSync {
+		manager.snapSync = uint32(1)
+	}
 	// Initiate a sub-protocol for every implemented version we can handle
 	manager.SubProtocols = make([]p2p.Protocol, 0, len(ProtocolVersions))
 	for i, version := range ProtocolVersions {
 		// Skip protocol version if incompatible with the mode of operation
-		if mode == downloader.FastSync && version < eth63 {
+		if (mode == downloader.FastSync || mode == downloader.SnapSync) && version < eth63 {
 			continue
 		}
 		// Compatible; initialise the sub-protocol
@@ -698,6 +704,90 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			log.Debug("Failed to deliver receipts", "err", err)
 		}
 
+	case p.version >= BRDPoS3 && msg.Code == GetAccountRangeMsg:
+		// Decode the account range retrieval and serve it from the state trie
+		var req snap.GetAccountRangePacket
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		return p.SendAccountRange(snap.ServiceGetAccountRange(pm.blockchain.StateCache().TrieDB(), &req))
+
+	case p.version >= BRDPoS3 && msg.Code == AccountRangeMsg:
+		// A range of accounts arrived to one of our previous requests
+		var res snap.AccountRangePacket
+		if err := msg.Decode(&res); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		if err := pm.downloader.DeliverAccountRange(p.id, &res); err != nil {
+			log.Debug("Failed to deliver account range", "err", err)
+		}
+
+	case p.version >= BRDPoS3 && msg.Code == GetStorageRangesMsg:
+		// Decode the storage range retrieval and serve it from the state trie
+		var req snap.GetStorageRangesPacket
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		return p.SendStorageRanges(snap.ServiceGetStorageRanges(pm.blockchain.StateCache().TrieDB(), &req))
+
+	case p.version >= BRDPoS3 && msg.Code == StorageRangesMsg:
+		// A batch of storage ranges arrived to one of our previous requests
+		var res snap.StorageRangesPacket
+		if err := msg.Decode(&res); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		if err := pm.downloader.DeliverStorageRanges(p.id, &res); err != nil {
+			log.Debug("Failed to deliver storage ranges", "err", err)
+		}
+
+	case p.version >= BRDPoS3 && msg.Code == GetByteCodesMsg:
+		// Decode the bytecode retrieval and serve it from the state database
+		var req snap.GetByteCodesPacket
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		return p.SendByteCodes(snap.ServiceGetByteCodes(pm.blockchain.StateCache().TrieDB(), &req))
+
+	case p.version >= BRDPoS3 && msg.Code == ByteCodesMsg:
+		// A batch of contract codes arrived to one of our previous requests
+		var res snap.ByteCodesPacket
+		if err := msg.Decode(&res); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		if err := pm.downloader.DeliverByteCodes(p.id, res.Codes); err != nil {
+			log.Debug("Failed to deliver byte codes", "err", err)
+		}
+
+	case p.version >= BRDPoS3 && msg.Code == GetTrieNodesMsg:
+		// Decode the trie node retrieval and serve it from the requested trie family
+		var req snap.GetTrieNodesPacket
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		var triedb *trie.Database
+		switch req.Kind {
+		case snap.StateTrie:
+			triedb = pm.blockchain.StateCache().TrieDB()
+		case snap.TradingTrie:
+			triedb = pm.blockchain.TradingTrieDB()
+		case snap.LendingTrie:
+			triedb = pm.blockchain.LendingTrieDB()
+		}
+		if triedb == nil {
+			return p.SendTrieNodes(&snap.TrieNodesPacket{})
+		}
+		return p.SendTrieNodes(snap.ServiceGetTrieNodes(triedb, &req))
+
+	case p.version >= BRDPoS3 && msg.Code == TrieNodesMsg:
+		// A batch of trie nodes arrived to one of our previous requests
+		var res snap.TrieNodesPacket
+		if err := msg.Decode(&res); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		if err := pm.downloader.DeliverTrieNodes(p.id, res.Nodes); err != nil {
+			log.Debug("Failed to deliver trie nodes", "err", err)
+		}
+
 	case msg.Code == NewBlockHashesMsg:
 		var announces newBlockHashesData
 		if err := msg.Decode(&announces); err != nil {
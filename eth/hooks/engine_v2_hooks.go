@@ -3,6 +3,7 @@ package hooks
 import (
 	"errors"
 	"math/big"
+	"slices"
 	"time"
 
 	"BRDPoSChain/common"
@@ -82,6 +83,18 @@ func AttachConsensusV2Hooks(adaptor *BRDPoS.BRDPoS, bc *core.BlockChain, chainCo
 			}
 		}
 
+		// masternodes slashed for vote equivocation in this epoch are penalized as well
+		offenders, err := getSlashedMasternodes(bc, chain, number.Uint64()-1, currentHash, parentNumber, candidates)
+		if err != nil {
+			return []common.Address{}, err
+		}
+		for _, offender := range offenders {
+			if !slices.Contains(penalties, offender) {
+				log.Info("[HookPenalty] Find a node slashed for vote equivocation", "addr", offender.Hex())
+				penalties = append(penalties, offender)
+			}
+		}
+
 		// get list check penalties signing block & list master nodes wil comeback
 		// start to calc comeback at v2 block + limitPenaltyEpochV2 to avoid reading v1 blocks
 		comebackHeight := (common.LimitPenaltyEpochV2+1)*chain.Config().BRDPoS.Epoch + chain.Config().BRDPoS.V2.SwitchBlock.Uint64()
@@ -157,6 +170,21 @@ func AttachConsensusV2Hooks(adaptor *BRDPoS.BRDPoS, bc *core.BlockChain, chainCo
 		return penalties, nil
 	}
 
+	// Hook gathers the stakes of the candidates in the state of a gap block, for the snapshots stored before they
+	// were recorded
+	adaptor.EngineV2.HookStakes = func(chain consensus.ChainReader, header *types.Header, candidates []common.Address) (map[common.Address]*big.Int, error) {
+		statedb, err := bc.StateAt(header.Root)
+		if err != nil {
+			log.Error("[HookStakes] Missing state to gather the stakes", "number", header.Number, "hash", header.Hash().Hex(), "err", err)
+			return nil, err
+		}
+		stakes := make(map[common.Address]*big.Int)
+		for _, candidate := range candidates {
+			stakes[candidate] = state.GetCandidateCap(statedb, candidate)
+		}
+		return stakes, nil
+	}
+
 	// Hook calculates reward for masternodes
 	adaptor.EngineV2.HookReward = func(chain consensus.ChainReader, stateBlock *state.StateDB, parentState *state.StateDB, header *types.Header) (map[string]interface{}, error) {
 		number := header.Number.Uint64()
@@ -301,3 +329,29 @@ func GetSigningTxCount(c *BRDPoS.BRDPoS, chain consensus.ChainReader, header *ty
 
 	return signers, nil
 }
+
+// getSlashedMasternodes returns the candidates slashed for vote equivocation in the state of the block of the hash,
+// from the block number since on. The penalties depend on it, so a missing header or state is an error rather
+// than an empty list.
+func getSlashedMasternodes(bc *core.BlockChain, chain consensus.ChainReader, number uint64, hash common.Hash, since uint64, candidates []common.Address) ([]common.Address, error) {
+	offenders := []common.Address{}
+	if !chain.Config().IsTIPSlashing(new(big.Int).SetUint64(number)) {
+		return offenders, nil
+	}
+	header := chain.GetHeader(hash, number)
+	if header == nil {
+		log.Error("[HookPenalty] Missing header to find slashed nodes", "number", number, "hash", hash.Hex())
+		return nil, consensus.ErrUnknownAncestor
+	}
+	statedb, err := bc.StateAt(header.Root)
+	if err != nil {
+		log.Error("[HookPenalty] Missing state to find slashed nodes", "number", number, "hash", hash.Hex(), "err", err)
+		return nil, err
+	}
+	for _, candidate := range candidates {
+		if slashed := state.GetLastSlashedBlock(statedb, candidate); slashed != 0 && slashed >= since {
+			offenders = append(offenders, candidate)
+		}
+	}
+	return offenders, nil
+}
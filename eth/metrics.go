@@ -50,6 +50,10 @@ var (
 	reqReceiptInTrafficMeter  = metrics.NewRegisteredMeter("eth/req/receipts/in/traffic", nil)
 	reqReceiptOutPacketsMeter = metrics.NewRegisteredMeter("eth/req/receipts/out/packets", nil)
 	reqReceiptOutTrafficMeter = metrics.NewRegisteredMeter("eth/req/receipts/out/traffic", nil)
+	reqSnapInPacketsMeter     = metrics.NewRegisteredMeter("eth/req/snap/in/packets", nil)
+	reqSnapInTrafficMeter     = metrics.NewRegisteredMeter("eth/req/snap/in/traffic", nil)
+	reqSnapOutPacketsMeter    = metrics.NewRegisteredMeter("eth/req/snap/out/packets", nil)
+	reqSnapOutTrafficMeter    = metrics.NewRegisteredMeter("eth/req/snap/out/traffic", nil)
 	miscInPacketsMeter        = metrics.NewRegisteredMeter("eth/misc/in/packets", nil)
 	miscInTrafficMeter        = metrics.NewRegisteredMeter("eth/misc/in/traffic", nil)
 	miscOutPacketsMeter       = metrics.NewRegisteredMeter("eth/misc/out/packets", nil)
@@ -96,6 +100,8 @@ func (rw *meteredMsgReadWriter) ReadMsg() (p2p.Msg, error) {
 		packets, traffic = reqStateInPacketsMeter, reqStateInTrafficMeter
 	case rw.version >= eth63 && msg.Code == ReceiptsMsg:
 		packets, traffic = reqReceiptInPacketsMeter, reqReceiptInTrafficMeter
+	case rw.version >= BRDPoS3 && (msg.Code == AccountRangeMsg || msg.Code == StorageRangesMsg || msg.Code == ByteCodesMsg || msg.Code == TrieNodesMsg):
+		packets, traffic = reqSnapInPacketsMeter, reqSnapInTrafficMeter
 
 	case msg.Code == NewBlockHashesMsg:
 		packets, traffic = propHashInPacketsMeter, propHashInTrafficMeter
@@ -123,6 +129,8 @@ func (rw *meteredMsgReadWriter) WriteMsg(msg p2p.Msg) error {
 		packets, traffic = reqStateOutPacketsMeter, reqStateOutTrafficMeter
 	case rw.version >= eth63 && msg.Code == ReceiptsMsg:
 		packets, traffic = reqReceiptOutPacketsMeter, reqReceiptOutTrafficMeter
+	case rw.version >= BRDPoS3 && (msg.Code == AccountRangeMsg || msg.Code == StorageRangesMsg || msg.Code == ByteCodesMsg || msg.Code == TrieNodesMsg):
+		packets, traffic = reqSnapOutPacketsMeter, reqSnapOutTrafficMeter
 
 	case msg.Code == NewBlockHashesMsg:
 		packets, traffic = propHashOutPacketsMeter, propHashOutTrafficMeter
@@ -25,6 +25,7 @@ import (
 
 	"BRDPoSChain/common"
 	"BRDPoSChain/core/types"
+	"BRDPoSChain/eth/snap"
 	"BRDPoSChain/p2p"
 	"BRDPoSChain/rlp"
 	mapset "github.com/deckarep/golang-set/v2"
@@ -317,6 +318,46 @@ func (p *peer) SendReceiptsRLP(receipts []rlp.RawValue) error {
 	}
 }
 
+// SendAccountRange sends a batch of proven accounts, corresponding to the range
+// requested.
+func (p *peer) SendAccountRange(packet *snap.AccountRangePacket) error {
+	if p.pairRw != nil {
+		return p2p.Send(p.pairRw, AccountRangeMsg, packet)
+	} else {
+		return p2p.Send(p.rw, AccountRangeMsg, packet)
+	}
+}
+
+// SendStorageRanges sends a batch of storage slot ranges, corresponding to the
+// accounts requested.
+func (p *peer) SendStorageRanges(packet *snap.StorageRangesPacket) error {
+	if p.pairRw != nil {
+		return p2p.Send(p.pairRw, StorageRangesMsg, packet)
+	} else {
+		return p2p.Send(p.rw, StorageRangesMsg, packet)
+	}
+}
+
+// SendByteCodes sends a batch of contract bytecodes, corresponding to the hashes
+// requested.
+func (p *peer) SendByteCodes(packet *snap.ByteCodesPacket) error {
+	if p.pairRw != nil {
+		return p2p.Send(p.pairRw, ByteCodesMsg, packet)
+	} else {
+		return p2p.Send(p.rw, ByteCodesMsg, packet)
+	}
+}
+
+// SendTrieNodes sends a batch of trie nodes, corresponding to the hashes
+// requested.
+func (p *peer) SendTrieNodes(packet *snap.TrieNodesPacket) error {
+	if p.pairRw != nil {
+		return p2p.Send(p.pairRw, TrieNodesMsg, packet)
+	} else {
+		return p2p.Send(p.rw, TrieNodesMsg, packet)
+	}
+}
+
 func (p *peer) SendVote(vote *types.Vote) error {
 	for p.knownVote.Cardinality() >= maxKnownVote {
 		p.knownVote.Pop()
@@ -437,6 +478,54 @@ func (p *peer) RequestReceipts(hashes []common.Hash) error {
 	}
 }
 
+// RequestAccountRange fetches a batch of accounts rooted in a specific account
+// trie, starting with the origin.
+func (p *peer) RequestAccountRange(root common.Hash, origin, limit common.Hash, bytes uint64) error {
+	p.Log().Debug("Fetching range of accounts", "root", root, "origin", origin, "limit", limit, "bytes", common.StorageSize(bytes))
+	packet := &snap.GetAccountRangePacket{Root: root, Origin: origin, Limit: limit, Bytes: bytes}
+	if p.pairRw != nil {
+		return p2p.Send(p.pairRw, GetAccountRangeMsg, packet)
+	} else {
+		return p2p.Send(p.rw, GetAccountRangeMsg, packet)
+	}
+}
+
+// RequestStorageRanges fetches a batch of storage slots belonging to one or more
+// accounts. If slots from only one account is requested, an origin marker may
+// also be used to retrieve from there.
+func (p *peer) RequestStorageRanges(root common.Hash, accounts []common.Hash, origin, limit []byte, bytes uint64) error {
+	p.Log().Debug("Fetching ranges of storage slots", "root", root, "accounts", len(accounts), "origin", origin, "limit", limit, "bytes", common.StorageSize(bytes))
+	packet := &snap.GetStorageRangesPacket{Root: root, Accounts: accounts, Origin: origin, Limit: limit, Bytes: bytes}
+	if p.pairRw != nil {
+		return p2p.Send(p.pairRw, GetStorageRangesMsg, packet)
+	} else {
+		return p2p.Send(p.rw, GetStorageRangesMsg, packet)
+	}
+}
+
+// RequestByteCodes fetches a batch of bytecodes by hash.
+func (p *peer) RequestByteCodes(hashes []common.Hash, bytes uint64) error {
+	p.Log().Debug("Fetching set of byte codes", "count", len(hashes), "bytes", common.StorageSize(bytes))
+	packet := &snap.GetByteCodesPacket{Hashes: hashes, Bytes: bytes}
+	if p.pairRw != nil {
+		return p2p.Send(p.pairRw, GetByteCodesMsg, packet)
+	} else {
+		return p2p.Send(p.rw, GetByteCodesMsg, packet)
+	}
+}
+
+// RequestTrieNodes fetches a batch of trie nodes of the given trie family by
+// hash.
+func (p *peer) RequestTrieNodes(kind snap.TrieKind, hashes []common.Hash, bytes uint64) error {
+	p.Log().Debug("Fetching set of trie nodes", "kind", kind, "count", len(hashes), "bytes", common.StorageSize(bytes))
+	packet := &snap.GetTrieNodesPacket{Kind: kind, Hashes: hashes, Bytes: bytes}
+	if p.pairRw != nil {
+		return p2p.Send(p.pairRw, GetTrieNodesMsg, packet)
+	} else {
+		return p2p.Send(p.rw, GetTrieNodesMsg, packet)
+	}
+}
+
 // Handshake executes the eth protocol handshake, negotiating version number,
 // network IDs, difficulties, head and genesis blocks.
 func (p *peer) Handshake(network uint64, td *big.Int, head common.Hash, genesis common.Hash) error {
@@ -33,16 +33,17 @@ const (
 	eth62   = 62
 	eth63   = 63
 	BRDPoS2 = 100
+	BRDPoS3 = 101
 )
 
 // Official short name of the protocol used during capability negotiation.
 var ProtocolName = "eth"
 
 // Supported versions of the eth protocol (first is primary).
-var ProtocolVersions = []uint{BRDPoS2, eth63, eth62}
+var ProtocolVersions = []uint{BRDPoS3, BRDPoS2, eth63, eth62}
 
 // Number of implemented message corresponding to different protocol versions.
-var ProtocolLengths = []uint64{227, 17, 8}
+var ProtocolLengths = []uint64{227, 227, 17, 8}
 
 const ProtocolMaxMsgSize = 10 * 1024 * 1024 // Maximum cap on the size of a protocol message
 
@@ -65,6 +66,16 @@ const (
 	GetReceiptsMsg = 0x0f
 	ReceiptsMsg    = 0x10
 
+	// Protocol messages belonging to BRDPoS3/101
+	GetAccountRangeMsg  = 0x11
+	AccountRangeMsg     = 0x12
+	GetStorageRangesMsg = 0x13
+	StorageRangesMsg    = 0x14
+	GetByteCodesMsg     = 0x15
+	ByteCodesMsg        = 0x16
+	GetTrieNodesMsg     = 0x17
+	TrieNodesMsg        = 0x18
+
 	// Protocol messages belonging to BRDPoS2/100
 	VoteMsg     = 0xe0
 	TimeoutMsg  = 0xe1
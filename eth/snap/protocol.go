@@ -0,0 +1,126 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package snap implements the range based state retrieval messages of the eth
+// protocol, which allow a node to download the state trie as proven ranges of
+// accounts and storage slots instead of trie node by trie node.
+package snap
+
+import (
+	"BRDPoSChain/common"
+	"BRDPoSChain/rlp"
+)
+
+// TrieKind identifies which of the tries a trie node request is served from.
+type TrieKind uint8
+
+const (
+	StateTrie   TrieKind = iota // Account and storage tries of the main state
+	TradingTrie                 // BRCx trading state tries
+	LendingTrie                 // BRCx lending state tries
+)
+
+// String implements fmt.Stringer.
+func (kind TrieKind) String() string {
+	switch kind {
+	case StateTrie:
+		return "state"
+	case TradingTrie:
+		return "trading"
+	case LendingTrie:
+		return "lending"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	// SoftResponseLimit is the target maximum size of replies to data retrievals.
+	SoftResponseLimit = 2 * 1024 * 1024
+
+	// maxCodeLookups is the maximum number of bytecodes to serve. This number is
+	// there to limit the number of disk lookups.
+	maxCodeLookups = 1024
+
+	// maxTrieNodeLookups is the maximum number of trie nodes to serve. This number
+	// is there to limit the number of disk lookups.
+	maxTrieNodeLookups = 1024
+)
+
+// GetAccountRangePacket represents an account query.
+type GetAccountRangePacket struct {
+	Root   common.Hash // Root hash of the account trie to serve
+	Origin common.Hash // Hash of the first account to retrieve
+	Limit  common.Hash // Hash of the last account to retrieve
+	Bytes  uint64      // Soft limit at which to stop returning data
+}
+
+// AccountRangePacket represents an account query response.
+type AccountRangePacket struct {
+	Accounts []*AccountData // List of consecutive accounts from the trie
+	Proof    [][]byte       // List of trie nodes proving the account range
+}
+
+// AccountData represents a single account in a query response.
+type AccountData struct {
+	Hash common.Hash  // Hash of the account
+	Body rlp.RawValue // Account body in consensus format
+}
+
+// GetStorageRangesPacket represents an storage slot query.
+type GetStorageRangesPacket struct {
+	Root     common.Hash   // Root hash of the account trie to serve
+	Accounts []common.Hash // Account hashes of the storage tries to serve
+	Origin   []byte        // Hash of the first storage slot to retrieve (large contract mode)
+	Limit    []byte        // Hash of the last storage slot to retrieve (large contract mode)
+	Bytes    uint64        // Soft limit at which to stop returning data
+}
+
+// StorageRangesPacket represents a storage slot query response.
+type StorageRangesPacket struct {
+	Slots [][]*StorageData // Lists of consecutive storage slots for the requested accounts
+	Proof [][]byte         // Merkle proofs for the *last* slot range, if it's incomplete
+}
+
+// StorageData represents a single storage slot in a query response.
+type StorageData struct {
+	Hash common.Hash // Hash of the storage slot
+	Body []byte      // Data content of the slot
+}
+
+// GetByteCodesPacket represents a contract bytecode query.
+type GetByteCodesPacket struct {
+	Hashes []common.Hash // Code hashes to retrieve the code for
+	Bytes  uint64        // Soft limit at which to stop returning data
+}
+
+// ByteCodesPacket represents a contract bytecode query response.
+type ByteCodesPacket struct {
+	Codes [][]byte // Requested contract bytecodes
+}
+
+// GetTrieNodesPacket represents a trie node query, used to heal the tries after
+// the range retrieval and to fetch the BRCx tries.
+type GetTrieNodesPacket struct {
+	Kind   TrieKind      // Trie family the nodes belong to
+	Hashes []common.Hash // Hashes of the trie nodes to retrieve
+	Bytes  uint64        // Soft limit at which to stop returning data
+}
+
+// TrieNodesPacket represents a trie node query response.
+type TrieNodesPacket struct {
+	Nodes [][]byte // Requested trie nodes
+}
@@ -0,0 +1,228 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/core/state"
+	"BRDPoSChain/crypto"
+	"BRDPoSChain/ethdb/memorydb"
+	"BRDPoSChain/log"
+	"BRDPoSChain/rlp"
+	"BRDPoSChain/trie"
+)
+
+// emptyCode is the known hash of the empty EVM bytecode.
+var emptyCode = crypto.Keccak256Hash(nil)
+
+// responseLimit caps the soft size limit requested by a remote peer.
+func responseLimit(requested uint64) uint64 {
+	if requested > SoftResponseLimit {
+		return SoftResponseLimit
+	}
+	return requested
+}
+
+// ServiceGetAccountRange assembles the response to an account range query. The
+// range starts at the requested origin and runs until the limit hash (including
+// the first account at or past it) or until the byte limit is reached. The proof
+// covers the origin and the last returned account. An unknown root results in an
+// empty response without any proof.
+func ServiceGetAccountRange(triedb *trie.Database, req *GetAccountRangePacket) *AccountRangePacket {
+	tr, err := trie.New(req.Root, triedb)
+	if err != nil {
+		return &AccountRangePacket{}
+	}
+	var (
+		accounts []*AccountData
+		size     uint64
+		limit    = responseLimit(req.Bytes)
+	)
+	it := trie.NewIterator(tr.NodeIterator(req.Origin[:]))
+	for it.Next() {
+		hash := common.BytesToHash(it.Key)
+		accounts = append(accounts, &AccountData{Hash: hash, Body: common.CopyBytes(it.Value)})
+		size += uint64(common.HashLength + len(it.Value))
+
+		if bytes.Compare(hash[:], req.Limit[:]) >= 0 || size >= limit {
+			break
+		}
+	}
+	if it.Err != nil {
+		log.Debug("Failed to iterate account range", "root", req.Root, "err", it.Err)
+		return &AccountRangePacket{}
+	}
+	// Generate the Merkle proofs for the first and last account
+	proof := memorydb.New()
+	if err := tr.Prove(req.Origin[:], 0, proof); err != nil {
+		log.Debug("Failed to prove account range", "origin", req.Origin, "err", err)
+		return &AccountRangePacket{}
+	}
+	if len(accounts) > 0 {
+		if err := tr.Prove(accounts[len(accounts)-1].Hash[:], 0, proof); err != nil {
+			log.Debug("Failed to prove account range", "last", accounts[len(accounts)-1].Hash, "err", err)
+			return &AccountRangePacket{}
+		}
+	}
+	return &AccountRangePacket{Accounts: accounts, Proof: proofNodes(proof)}
+}
+
+// ServiceGetStorageRanges assembles the response to a storage range query. The
+// origin only applies to the first requested account and the limit only to the
+// last one. A proof is only attached if the last returned range does not start
+// at the beginning of its trie or is cut short by the byte limit; all other
+// ranges are complete and can be verified against the storage roots as is.
+func ServiceGetStorageRanges(triedb *trie.Database, req *GetStorageRangesPacket) *StorageRangesPacket {
+	accTrie, err := trie.New(req.Root, triedb)
+	if err != nil {
+		return &StorageRangesPacket{}
+	}
+	var (
+		slots [][]*StorageData
+		proof [][]byte
+		size  uint64
+		limit = responseLimit(req.Bytes)
+	)
+	for i, account := range req.Accounts {
+		// If we've exceeded the requested data limit, abort without opening a new
+		// storage range (that we'd need to prove due to exceeded size)
+		if size >= limit {
+			break
+		}
+		var origin, last common.Hash
+		if i == 0 && len(req.Origin) > 0 {
+			origin = common.BytesToHash(req.Origin)
+		}
+		last = common.MaxHash
+		if i == len(req.Accounts)-1 && len(req.Limit) > 0 {
+			last = common.BytesToHash(req.Limit)
+		}
+		// Resolve the storage trie of the account
+		blob, err := accTrie.TryGet(account[:])
+		if err != nil || blob == nil {
+			break
+		}
+		var data state.Account
+		if err := rlp.DecodeBytes(blob, &data); err != nil {
+			break
+		}
+		stTrie, err := trie.New(data.Root, triedb)
+		if err != nil {
+			break
+		}
+		// Retrieve the requested storage slots until the limits are hit
+		var (
+			storage []*StorageData
+			abort   bool
+		)
+		it := trie.NewIterator(stTrie.NodeIterator(origin[:]))
+		for it.Next() {
+			if size >= limit {
+				abort = true
+				break
+			}
+			hash := common.BytesToHash(it.Key)
+			storage = append(storage, &StorageData{Hash: hash, Body: common.CopyBytes(it.Value)})
+			size += uint64(common.HashLength + len(it.Value))
+
+			if bytes.Compare(hash[:], last[:]) >= 0 {
+				break
+			}
+		}
+		if it.Err != nil {
+			break
+		}
+		slots = append(slots, storage)
+
+		// If the range is not complete, prove it and stop
+		if origin != (common.Hash{}) || abort {
+			nodes := memorydb.New()
+			if err := stTrie.Prove(origin[:], 0, nodes); err != nil {
+				log.Debug("Failed to prove storage range", "origin", origin, "err", err)
+				return &StorageRangesPacket{}
+			}
+			if len(storage) > 0 {
+				if err := stTrie.Prove(storage[len(storage)-1].Hash[:], 0, nodes); err != nil {
+					log.Debug("Failed to prove storage range", "last", storage[len(storage)-1].Hash, "err", err)
+					return &StorageRangesPacket{}
+				}
+			}
+			proof = proofNodes(nodes)
+			break
+		}
+	}
+	return &StorageRangesPacket{Slots: slots, Proof: proof}
+}
+
+// ServiceGetByteCodes assembles the response to a bytecode query, skipping any
+// unknown codes.
+func ServiceGetByteCodes(triedb *trie.Database, req *GetByteCodesPacket) *ByteCodesPacket {
+	var (
+		codes [][]byte
+		size  uint64
+		limit = responseLimit(req.Bytes)
+	)
+	for i, hash := range req.Hashes {
+		if i >= maxCodeLookups || size >= limit {
+			break
+		}
+		if hash == emptyCode {
+			// Peers should not request the empty code, but if they do, at
+			// least sent them back a correct response without db lookups
+			codes = append(codes, []byte{})
+		} else if blob, err := triedb.Node(hash); err == nil {
+			codes = append(codes, blob)
+			size += uint64(len(blob))
+		}
+	}
+	return &ByteCodesPacket{Codes: codes}
+}
+
+// ServiceGetTrieNodes assembles the response to a trie node query from the trie
+// database of the requested kind, skipping any unknown nodes.
+func ServiceGetTrieNodes(triedb *trie.Database, req *GetTrieNodesPacket) *TrieNodesPacket {
+	var (
+		nodes [][]byte
+		size  uint64
+		limit = responseLimit(req.Bytes)
+	)
+	for i, hash := range req.Hashes {
+		if i >= maxTrieNodeLookups || size >= limit {
+			break
+		}
+		if blob, err := triedb.Node(hash); err == nil {
+			nodes = append(nodes, blob)
+			size += uint64(len(blob))
+		}
+	}
+	return &TrieNodesPacket{Nodes: nodes}
+}
+
+// proofNodes flattens a proof set into the list of its nodes.
+func proofNodes(db *memorydb.Database) [][]byte {
+	var nodes [][]byte
+
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+
+	for it.Next() {
+		nodes = append(nodes, common.CopyBytes(it.Value()))
+	}
+	return nodes
+}
@@ -0,0 +1,146 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"math/big"
+	"testing"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/core/rawdb"
+	"BRDPoSChain/core/state"
+	"BRDPoSChain/crypto"
+	"BRDPoSChain/ethdb/memorydb"
+	"BRDPoSChain/trie"
+)
+
+// makeTestState creates a committed state with a number of plain accounts and
+// a single contract with a few storage slots.
+func makeTestState(t *testing.T) (*trie.Database, common.Hash, common.Address) {
+	sdb := state.NewDatabase(rawdb.NewMemoryDatabase())
+	statedb, _ := state.New(common.Hash{}, sdb)
+	for i := byte(0); i < 100; i++ {
+		statedb.AddBalance(common.BytesToAddress([]byte{i + 1}), big.NewInt(int64(i)+1))
+	}
+	contract := common.HexToAddress("0xc0de")
+	statedb.SetCode(contract, []byte{0x60, 0x00, 0x60, 0x00})
+	for i := byte(0); i < 20; i++ {
+		statedb.SetState(contract, common.BytesToHash([]byte{i}), common.BytesToHash([]byte{i + 1}))
+	}
+	root, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if err := sdb.TrieDB().Commit(root, false); err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	return sdb.TrieDB(), root, contract
+}
+
+// proofDb converts a list of proof nodes into a database to verify against.
+func proofDb(nodes [][]byte) *memorydb.Database {
+	db := memorydb.New()
+	for _, node := range nodes {
+		db.Put(crypto.Keccak256(node), node)
+	}
+	return db
+}
+
+// Tests that the whole account trie can be retrieved and verified in small,
+// consecutive ranges.
+func TestServiceAccountRange(t *testing.T) {
+	triedb, root, _ := makeTestState(t)
+
+	var (
+		origin common.Hash
+		total  int
+	)
+	for {
+		res := ServiceGetAccountRange(triedb, &GetAccountRangePacket{Root: root, Origin: origin, Limit: common.MaxHash, Bytes: 500})
+		if len(res.Accounts) == 0 {
+			t.Fatalf("empty response at origin %x", origin)
+		}
+		keys := make([][]byte, len(res.Accounts))
+		vals := make([][]byte, len(res.Accounts))
+		for i, account := range res.Accounts {
+			keys[i], vals[i] = account.Hash[:], account.Body
+		}
+		more, err := trie.CommitRangeProof(root, origin[:], keys, vals, proofDb(res.Proof), nil, nil)
+		if err != nil {
+			t.Fatalf("invalid range at origin %x: %v", origin, err)
+		}
+		total += len(res.Accounts)
+		if !more {
+			break
+		}
+		origin = incHash(res.Accounts[len(res.Accounts)-1].Hash)
+	}
+	if total != 101 {
+		t.Fatalf("account count mismatch: have %d, want %d", total, 101)
+	}
+	// Unknown roots must result in an empty response
+	if res := ServiceGetAccountRange(triedb, &GetAccountRangePacket{Root: common.Hash{1}, Limit: common.MaxHash, Bytes: 500}); len(res.Accounts) != 0 || len(res.Proof) != 0 {
+		t.Fatalf("unexpected response for unknown root: %d accounts, %d proof nodes", len(res.Accounts), len(res.Proof))
+	}
+}
+
+// Tests that storage ranges are proven only when they are incomplete.
+func TestServiceStorageRanges(t *testing.T) {
+	triedb, root, contract := makeTestState(t)
+	account := crypto.Keccak256Hash(contract[:])
+
+	res := ServiceGetStorageRanges(triedb, &GetStorageRangesPacket{Root: root, Accounts: []common.Hash{account}, Bytes: SoftResponseLimit})
+	if len(res.Slots) != 1 || len(res.Slots[0]) != 20 {
+		t.Fatalf("slot count mismatch: have %v", res.Slots)
+	}
+	if len(res.Proof) != 0 {
+		t.Fatalf("complete range should not be proven")
+	}
+	res = ServiceGetStorageRanges(triedb, &GetStorageRangesPacket{Root: root, Accounts: []common.Hash{account}, Bytes: 100})
+	if len(res.Slots) != 1 || len(res.Slots[0]) == 20 {
+		t.Fatalf("byte limit not honoured: have %d slots", len(res.Slots[0]))
+	}
+	if len(res.Proof) == 0 {
+		t.Fatalf("incomplete range should be proven")
+	}
+}
+
+// Tests that bytecodes and trie nodes are served by hash, skipping unknowns.
+func TestServiceByteCodesAndTrieNodes(t *testing.T) {
+	triedb, root, _ := makeTestState(t)
+
+	code := []byte{0x60, 0x00, 0x60, 0x00}
+	res := ServiceGetByteCodes(triedb, &GetByteCodesPacket{Hashes: []common.Hash{crypto.Keccak256Hash(code), {1}}, Bytes: SoftResponseLimit})
+	if len(res.Codes) != 1 || string(res.Codes[0]) != string(code) {
+		t.Fatalf("bytecode mismatch: have %x", res.Codes)
+	}
+	nodes := ServiceGetTrieNodes(triedb, &GetTrieNodesPacket{Kind: StateTrie, Hashes: []common.Hash{{1}, root}, Bytes: SoftResponseLimit})
+	if len(nodes.Nodes) != 1 || crypto.Keccak256Hash(nodes.Nodes[0]) != root {
+		t.Fatalf("trie node mismatch: have %d nodes", len(nodes.Nodes))
+	}
+}
+
+// incHash returns the hash following h.
+func incHash(h common.Hash) common.Hash {
+	for i := len(h) - 1; i >= 0; i-- {
+		h[i]++
+		if h[i] != 0 {
+			break
+		}
+	}
+	return h
+}
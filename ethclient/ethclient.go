@@ -313,6 +313,12 @@ func (ec *Client) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header)
 	return ec.c.EthSubscribe(ctx, ch, "newHeads", map[string]struct{}{})
 }
 
+// SubscribeNewFinalizedHead subscribes to notifications about the blocks committed
+// by the consensus on the given channel.
+func (ec *Client) SubscribeNewFinalizedHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	return ec.c.EthSubscribe(ctx, ch, "newFinalizedHeads")
+}
+
 // State Access
 
 // NetworkID returns the network ID (also known as the chain ID) for this chain.
@@ -538,6 +544,12 @@ func toBlockNumArg(number *big.Int) string {
 	if number.Cmp(pending) == 0 {
 		return "pending"
 	}
+	switch rpc.BlockNumber(number.Int64()) {
+	case rpc.CommittedBlockNumber:
+		return "finalized"
+	case rpc.SafeBlockNumber:
+		return "safe"
+	}
 	return hexutil.EncodeBig(number)
 }
 
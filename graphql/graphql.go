@@ -0,0 +1,1003 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package graphql provides a GraphQL interface to Ethereum node data.
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/common/hexutil"
+	"BRDPoSChain/consensus"
+	"BRDPoSChain/consensus/BRDPoS"
+	"BRDPoSChain/consensus/BRDPoS/utils"
+	"BRDPoSChain/core/rawdb"
+	"BRDPoSChain/core/state"
+	"BRDPoSChain/core/types"
+	"BRDPoSChain/eth/filters"
+	"BRDPoSChain/internal/ethapi"
+	"BRDPoSChain/rpc"
+)
+
+// maxBlockRange is the maximum number of blocks a single blocks query resolves.
+const maxBlockRange = 1000
+
+var (
+	errInvalidBlock       = errors.New("invalid block number or hash")
+	errBlockRangeTooLarge = fmt.Errorf("block range exceeds the maximum of %d blocks", maxBlockRange)
+)
+
+// Long is a 64 bit integer accepted as a GraphQL input in decimal or
+// hexadecimal form.
+type Long int64
+
+// ImplementsGraphQLType returns true if Long implements the provided GraphQL type.
+func (b Long) ImplementsGraphQLType(name string) bool { return name == "Long" }
+
+// UnmarshalGraphQL unmarshals the provided GraphQL query data.
+func (b *Long) UnmarshalGraphQL(input interface{}) error {
+	var err error
+	switch input := input.(type) {
+	case string:
+		if len(input) >= 2 && input[0] == '0' && (input[1] == 'x' || input[1] == 'X') {
+			// apply leniency and support hex representations of longs.
+			value, err := hexutil.DecodeUint64(input)
+			*b = Long(value)
+			return err
+		} else {
+			value, err := strconv.ParseInt(input, 10, 64)
+			*b = Long(value)
+			return err
+		}
+	case int32:
+		*b = Long(input)
+	case int64:
+		*b = Long(input)
+	case float64:
+		*b = Long(input)
+	default:
+		err = fmt.Errorf("unexpected type %T for Long", input)
+	}
+	return err
+}
+
+// Account represents an Ethereum account at a particular block.
+type Account struct {
+	r             *Resolver
+	address       common.Address
+	blockNrOrHash rpc.BlockNumberOrHash
+}
+
+// getState fetches the StateDB object for an account.
+func (a *Account) getState(ctx context.Context) (*state.StateDB, error) {
+	state, _, err := a.r.backend.StateAndHeaderByNumberOrHash(ctx, a.blockNrOrHash)
+	return state, err
+}
+
+func (a *Account) Address(ctx context.Context) (common.Address, error) {
+	return a.address, nil
+}
+
+func (a *Account) Balance(ctx context.Context) (hexutil.Big, error) {
+	state, err := a.getState(ctx)
+	if err != nil {
+		return hexutil.Big{}, err
+	}
+	return hexutil.Big(*state.GetBalance(a.address)), nil
+}
+
+func (a *Account) TransactionCount(ctx context.Context) (hexutil.Uint64, error) {
+	state, err := a.getState(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return hexutil.Uint64(state.GetNonce(a.address)), nil
+}
+
+func (a *Account) Code(ctx context.Context) (hexutil.Bytes, error) {
+	state, err := a.getState(ctx)
+	if err != nil {
+		return hexutil.Bytes{}, err
+	}
+	return state.GetCode(a.address), nil
+}
+
+func (a *Account) Storage(ctx context.Context, args struct{ Slot common.Hash }) (common.Hash, error) {
+	state, err := a.getState(ctx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return state.GetState(a.address, args.Slot), nil
+}
+
+// Log represents an individual log message. All arguments are mandatory.
+type Log struct {
+	r           *Resolver
+	transaction *Transaction
+	log         *types.Log
+}
+
+func (l *Log) Transaction(ctx context.Context) *Transaction {
+	return l.transaction
+}
+
+func (l *Log) Account(ctx context.Context, args BlockNumberArgs) *Account {
+	return &Account{
+		r:             l.r,
+		address:       l.log.Address,
+		blockNrOrHash: args.NumberOrLatest(),
+	}
+}
+
+func (l *Log) Index(ctx context.Context) int32 {
+	return int32(l.log.Index)
+}
+
+func (l *Log) Topics(ctx context.Context) []common.Hash {
+	return l.log.Topics
+}
+
+func (l *Log) Data(ctx context.Context) hexutil.Bytes {
+	return l.log.Data
+}
+
+// Transaction represents an Ethereum transaction.
+// backend and hash are mandatory; all others will be fetched when required.
+type Transaction struct {
+	r    *Resolver
+	hash common.Hash // Must be present after initialization
+
+	mu    sync.Mutex // Protects the fields below
+	tx    *types.Transaction
+	block *Block
+	index uint64
+}
+
+// resolve returns the internal transaction object, fetching it if needed.
+// It also returns the block the tx belongs to, unless it is a pending tx.
+func (t *Transaction) resolve(ctx context.Context) (*types.Transaction, *Block) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tx != nil {
+		return t.tx, t.block
+	}
+	// Try to return an already finalized transaction
+	tx, blockHash, _, index := rawdb.ReadTransaction(t.r.backend.ChainDb(), t.hash)
+	if tx != nil {
+		blockNrOrHash := rpc.BlockNumberOrHashWithHash(blockHash, false)
+		t.tx = tx
+		t.block = &Block{r: t.r, numberOrHash: &blockNrOrHash, hash: blockHash}
+		t.index = index
+		return t.tx, t.block
+	}
+	// No finalized transaction, try to retrieve it from the pool
+	t.tx = t.r.backend.GetPoolTransaction(t.hash)
+	return t.tx, nil
+}
+
+func (t *Transaction) Hash(ctx context.Context) common.Hash {
+	return t.hash
+}
+
+func (t *Transaction) InputData(ctx context.Context) hexutil.Bytes {
+	tx, _ := t.resolve(ctx)
+	if tx == nil {
+		return hexutil.Bytes{}
+	}
+	return tx.Data()
+}
+
+func (t *Transaction) Gas(ctx context.Context) hexutil.Uint64 {
+	tx, _ := t.resolve(ctx)
+	if tx == nil {
+		return 0
+	}
+	return hexutil.Uint64(tx.Gas())
+}
+
+func (t *Transaction) GasPrice(ctx context.Context) hexutil.Big {
+	tx, _ := t.resolve(ctx)
+	if tx == nil {
+		return hexutil.Big{}
+	}
+	return hexutil.Big(*tx.GasPrice())
+}
+
+func (t *Transaction) Value(ctx context.Context) hexutil.Big {
+	tx, _ := t.resolve(ctx)
+	if tx == nil {
+		return hexutil.Big{}
+	}
+	return hexutil.Big(*tx.Value())
+}
+
+func (t *Transaction) Nonce(ctx context.Context) hexutil.Uint64 {
+	tx, _ := t.resolve(ctx)
+	if tx == nil {
+		return 0
+	}
+	return hexutil.Uint64(tx.Nonce())
+}
+
+func (t *Transaction) To(ctx context.Context, args BlockNumberArgs) *Account {
+	tx, _ := t.resolve(ctx)
+	if tx == nil || tx.To() == nil {
+		return nil
+	}
+	return &Account{
+		r:             t.r,
+		address:       *tx.To(),
+		blockNrOrHash: args.NumberOrLatest(),
+	}
+}
+
+func (t *Transaction) From(ctx context.Context, args BlockNumberArgs) *Account {
+	tx, _ := t.resolve(ctx)
+	if tx == nil {
+		return nil
+	}
+	signer := types.LatestSignerForChainID(tx.ChainId())
+	from, _ := types.Sender(signer, tx)
+	return &Account{
+		r:             t.r,
+		address:       from,
+		blockNrOrHash: args.NumberOrLatest(),
+	}
+}
+
+func (t *Transaction) Block(ctx context.Context) *Block {
+	_, block := t.resolve(ctx)
+	return block
+}
+
+func (t *Transaction) Index(ctx context.Context) *hexutil.Uint64 {
+	_, block := t.resolve(ctx)
+	// Pending tx
+	if block == nil {
+		return nil
+	}
+	index := hexutil.Uint64(t.index)
+	return &index
+}
+
+// getReceipt returns the receipt associated with this transaction, if any.
+func (t *Transaction) getReceipt(ctx context.Context) (*types.Receipt, error) {
+	_, block := t.resolve(ctx)
+	// Pending tx
+	if block == nil {
+		return nil, nil
+	}
+	receipts, err := block.resolveReceipts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(receipts)) <= t.index {
+		return nil, nil
+	}
+	return receipts[t.index], nil
+}
+
+func (t *Transaction) Status(ctx context.Context) (*hexutil.Uint64, error) {
+	receipt, err := t.getReceipt(ctx)
+	if err != nil || receipt == nil {
+		return nil, err
+	}
+	ret := hexutil.Uint64(receipt.Status)
+	return &ret, nil
+}
+
+func (t *Transaction) GasUsed(ctx context.Context) (*hexutil.Uint64, error) {
+	receipt, err := t.getReceipt(ctx)
+	if err != nil || receipt == nil {
+		return nil, err
+	}
+	ret := hexutil.Uint64(receipt.GasUsed)
+	return &ret, nil
+}
+
+func (t *Transaction) CumulativeGasUsed(ctx context.Context) (*hexutil.Uint64, error) {
+	receipt, err := t.getReceipt(ctx)
+	if err != nil || receipt == nil {
+		return nil, err
+	}
+	ret := hexutil.Uint64(receipt.CumulativeGasUsed)
+	return &ret, nil
+}
+
+func (t *Transaction) CreatedContract(ctx context.Context, args BlockNumberArgs) (*Account, error) {
+	receipt, err := t.getReceipt(ctx)
+	if err != nil || receipt == nil || receipt.ContractAddress == (common.Address{}) {
+		return nil, err
+	}
+	return &Account{
+		r:             t.r,
+		address:       receipt.ContractAddress,
+		blockNrOrHash: args.NumberOrLatest(),
+	}, nil
+}
+
+func (t *Transaction) Logs(ctx context.Context) (*[]*Log, error) {
+	receipt, err := t.getReceipt(ctx)
+	if err != nil || receipt == nil {
+		return nil, err
+	}
+	ret := make([]*Log, 0, len(receipt.Logs))
+	for _, log := range receipt.Logs {
+		ret = append(ret, &Log{
+			r:           t.r,
+			transaction: t,
+			log:         log,
+		})
+	}
+	return &ret, nil
+}
+
+// Block represents an Ethereum block.
+// backend, and numberOrHash are mandatory. All other fields are lazily fetched
+// when required.
+type Block struct {
+	r            *Resolver
+	numberOrHash *rpc.BlockNumberOrHash // Field resolvers assume numberOrHash is always present
+
+	mu       sync.Mutex // Protects the fields below
+	hash     common.Hash
+	block    *types.Block
+	receipts []*types.Receipt
+}
+
+// resolve returns the internal Block object representing this block, fetching
+// it if necessary.
+func (b *Block) resolve(ctx context.Context) (*types.Block, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.block != nil {
+		return b.block, nil
+	}
+	if b.numberOrHash == nil {
+		latest := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+		b.numberOrHash = &latest
+	}
+	var err error
+	if hash, ok := b.numberOrHash.Hash(); ok {
+		b.block, err = b.r.backend.BlockByHash(ctx, hash)
+	} else {
+		b.block, err = b.r.backend.BlockByNumberOrHash(ctx, *b.numberOrHash)
+	}
+	if b.block != nil {
+		b.hash = b.block.Hash()
+	}
+	return b.block, err
+}
+
+// resolveBlock is like resolve but fails if the block is unknown.
+func (b *Block) resolveBlock(ctx context.Context) (*types.Block, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, errInvalidBlock
+	}
+	return block, nil
+}
+
+// resolveReceipts returns the list of receipts for this block, fetching them
+// if necessary.
+func (b *Block) resolveReceipts(ctx context.Context) ([]*types.Receipt, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.receipts == nil {
+		receipts, err := b.r.backend.GetReceipts(ctx, block.Hash())
+		if err != nil {
+			return nil, err
+		}
+		b.receipts = receipts
+	}
+	return b.receipts, nil
+}
+
+func (b *Block) Number(ctx context.Context) (hexutil.Uint64, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return hexutil.Uint64(block.NumberU64()), nil
+}
+
+func (b *Block) Hash(ctx context.Context) (common.Hash, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return block.Hash(), nil
+}
+
+func (b *Block) GasLimit(ctx context.Context) (hexutil.Uint64, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return hexutil.Uint64(block.GasLimit()), nil
+}
+
+func (b *Block) GasUsed(ctx context.Context) (hexutil.Uint64, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return hexutil.Uint64(block.GasUsed()), nil
+}
+
+func (b *Block) Parent(ctx context.Context) (*Block, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil || block.NumberU64() == 0 {
+		return nil, err
+	}
+	numberOrHash := rpc.BlockNumberOrHashWithHash(block.ParentHash(), false)
+	return &Block{
+		r:            b.r,
+		numberOrHash: &numberOrHash,
+		hash:         block.ParentHash(),
+	}, nil
+}
+
+func (b *Block) Difficulty(ctx context.Context) (hexutil.Big, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return hexutil.Big{}, err
+	}
+	return hexutil.Big(*block.Difficulty()), nil
+}
+
+func (b *Block) Timestamp(ctx context.Context) (hexutil.Big, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return hexutil.Big{}, err
+	}
+	return hexutil.Big(*block.Time()), nil
+}
+
+func (b *Block) Nonce(ctx context.Context) (hexutil.Bytes, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return hexutil.Bytes{}, err
+	}
+	nonce := block.Header().Nonce
+	return nonce[:], nil
+}
+
+func (b *Block) TransactionsRoot(ctx context.Context) (common.Hash, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return block.TxHash(), nil
+}
+
+func (b *Block) StateRoot(ctx context.Context) (common.Hash, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return block.Root(), nil
+}
+
+func (b *Block) ReceiptsRoot(ctx context.Context) (common.Hash, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return block.ReceiptHash(), nil
+}
+
+func (b *Block) ExtraData(ctx context.Context) (hexutil.Bytes, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return hexutil.Bytes{}, err
+	}
+	return block.Extra(), nil
+}
+
+func (b *Block) LogsBloom(ctx context.Context) (hexutil.Bytes, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return hexutil.Bytes{}, err
+	}
+	return block.Bloom().Bytes(), nil
+}
+
+func (b *Block) TotalDifficulty(ctx context.Context) (hexutil.Big, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return hexutil.Big{}, err
+	}
+	td := b.r.backend.GetTd(block.Hash())
+	if td == nil {
+		return hexutil.Big{}, fmt.Errorf("total difficulty not found %x", block.Hash())
+	}
+	return hexutil.Big(*td), nil
+}
+
+func (b *Block) Miner(ctx context.Context, args BlockNumberArgs) (*Account, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Account{
+		r:             b.r,
+		address:       block.Coinbase(),
+		blockNrOrHash: args.NumberOrLatest(),
+	}, nil
+}
+
+func (b *Block) TransactionCount(ctx context.Context) (*int32, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	count := int32(len(block.Transactions()))
+	return &count, nil
+}
+
+func (b *Block) Transactions(ctx context.Context) (*[]*Transaction, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*Transaction, 0, len(block.Transactions()))
+	for i, tx := range block.Transactions() {
+		ret = append(ret, &Transaction{
+			r:     b.r,
+			hash:  tx.Hash(),
+			tx:    tx,
+			block: b,
+			index: uint64(i),
+		})
+	}
+	return &ret, nil
+}
+
+func (b *Block) TransactionAt(ctx context.Context, args struct{ Index int32 }) (*Transaction, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	txs := block.Transactions()
+	if args.Index < 0 || int(args.Index) >= len(txs) {
+		return nil, nil
+	}
+	tx := txs[args.Index]
+	return &Transaction{
+		r:     b.r,
+		hash:  tx.Hash(),
+		tx:    tx,
+		block: b,
+		index: uint64(args.Index),
+	}, nil
+}
+
+// BlockFilterCriteria encapsulates criteria passed to a `logs` accessor inside
+// a block.
+type BlockFilterCriteria struct {
+	Addresses *[]common.Address // restricts matches to events created by specific contracts
+
+	// The Topic list restricts matches to particular event topics. Each event has a list
+	// of topics. Topics matches a prefix of that list. An empty element slice matches any
+	// topic. Non-empty elements represent an alternative that matches any of the
+	// contained topics.
+	//
+	// Examples:
+	// {} or nil          matches any topic list
+	// {{A}}              matches topic A in first position
+	// {{}, {B}}          matches any topic in first position, B in second position
+	// {{A}, {B}}         matches topic A in first position, B in second position
+	// {{A, B}}, {C, D}}  matches topic (A OR B) in first position, (C OR D) in second position
+	Topics *[][]common.Hash
+}
+
+// runFilter runs a filter and returns the logs matched, resolving the
+// transactions that emitted them.
+func runFilter(ctx context.Context, r *Resolver, filter *filters.Filter) ([]*Log, error) {
+	logs, err := filter.Logs(ctx)
+	if err != nil || logs == nil {
+		return nil, err
+	}
+	ret := make([]*Log, 0, len(logs))
+	for _, log := range logs {
+		ret = append(ret, &Log{
+			r:           r,
+			transaction: &Transaction{r: r, hash: log.TxHash},
+			log:         log,
+		})
+	}
+	return ret, nil
+}
+
+func (b *Block) Logs(ctx context.Context, args struct{ Filter BlockFilterCriteria }) ([]*Log, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var addresses []common.Address
+	if args.Filter.Addresses != nil {
+		addresses = *args.Filter.Addresses
+	}
+	var topics [][]common.Hash
+	if args.Filter.Topics != nil {
+		topics = *args.Filter.Topics
+	}
+	// Construct the range filter
+	filter := b.r.filterSystem.NewBlockFilter(block.Hash(), addresses, topics)
+
+	// Run the filter and return all the logs
+	return runFilter(ctx, b.r, filter)
+}
+
+func (b *Block) Account(ctx context.Context, args struct{ Address common.Address }) (*Account, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Account{
+		r:             b.r,
+		address:       args.Address,
+		blockNrOrHash: rpc.BlockNumberOrHashWithHash(block.Hash(), false),
+	}, nil
+}
+
+// Signers returns the masternodes that signed the block.
+func (b *Block) Signers(ctx context.Context) ([]common.Address, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return b.r.chainAPI.GetBlockSignersByHash(ctx, block.Hash())
+}
+
+// Finality returns the percentage of the masternodes that signed the block.
+func (b *Block) Finality(ctx context.Context) (int32, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	finality, err := b.r.chainAPI.GetBlockFinalityByHash(ctx, block.Hash())
+	return int32(finality), err
+}
+
+// isV2 reports whether the block is sealed by the BRDPoS v2 consensus.
+func (b *Block) isV2(block *types.Block) bool {
+	config := b.r.backend.ChainConfig().BRDPoS
+	return b.r.consensusAPI != nil && config != nil && config.V2 != nil && config.V2.SwitchBlock != nil &&
+		block.Number().Cmp(config.V2.SwitchBlock) > 0
+}
+
+// v2Info returns the BRDPoS v2 consensus information of the block, or nil for
+// blocks sealed before the v2 switch.
+func (b *Block) v2Info(ctx context.Context) (*BRDPoS.V2BlockInfo, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil || !b.isV2(block) {
+		return nil, err
+	}
+	canonical := b.r.chain.GetHeaderByNumber(block.NumberU64())
+	uncle := canonical == nil || canonical.Hash() != block.Hash()
+
+	info := b.r.consensusAPI.GetV2BlockByHeader(block.Header(), uncle)
+	if info.Error != "" {
+		return nil, errors.New(info.Error)
+	}
+	return info, nil
+}
+
+// Round returns the BRDPoS v2 consensus round of the block.
+func (b *Block) Round(ctx context.Context) (*hexutil.Uint64, error) {
+	info, err := b.v2Info(ctx)
+	if err != nil || info == nil {
+		return nil, err
+	}
+	round := hexutil.Uint64(info.Round)
+	return &round, nil
+}
+
+// Committed reports whether the block is committed by the BRDPoS v2 consensus.
+func (b *Block) Committed(ctx context.Context) (*bool, error) {
+	info, err := b.v2Info(ctx)
+	if err != nil || info == nil {
+		return nil, err
+	}
+	return &info.Committed, nil
+}
+
+// QuorumCert returns the quorum certificate the block carries for its parent.
+func (b *Block) QuorumCert(ctx context.Context) (*QuorumCert, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil || !b.isV2(block) {
+		return nil, err
+	}
+	var fields types.ExtraFields_v2
+	if err := utils.DecodeBytesExtraFields(block.Extra(), &fields); err != nil {
+		return nil, err
+	}
+	if fields.QuorumCert == nil || fields.QuorumCert.ProposedBlockInfo == nil {
+		return nil, nil
+	}
+	return &QuorumCert{qc: fields.QuorumCert}, nil
+}
+
+// Masternodes returns the masternodes of the epoch the block belongs to.
+func (b *Block) Masternodes(ctx context.Context) ([]common.Address, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	engine, ok := b.r.backend.GetEngine().(*BRDPoS.BRDPoS)
+	if !ok {
+		return []common.Address{}, nil
+	}
+	return engine.GetMasternodes(b.r.chain, block.Header()), nil
+}
+
+// Penalties returns the masternodes penalized in the epoch the block belongs to.
+func (b *Block) Penalties(ctx context.Context) ([]common.Address, error) {
+	block, err := b.resolveBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	engine, ok := b.r.backend.GetEngine().(*BRDPoS.BRDPoS)
+	if !ok {
+		return []common.Address{}, nil
+	}
+	if b.isV2(block) {
+		return engine.EngineV2.GetPenalties(b.r.chain, block.Header()), nil
+	}
+	// Before the v2 switch penalties are recorded in the epoch checkpoint header
+	epoch := b.r.backend.ChainConfig().BRDPoS.Epoch
+	checkpoint := b.r.chain.GetHeaderByNumber(block.NumberU64() - block.NumberU64()%epoch)
+	if checkpoint == nil {
+		return nil, errInvalidBlock
+	}
+	return common.ExtractAddressFromBytes(checkpoint.Penalties), nil
+}
+
+// QuorumCert represents the quorum certificate of a BRDPoS v2 block.
+type QuorumCert struct {
+	qc *types.QuorumCert
+}
+
+func (q *QuorumCert) ProposedBlockHash(ctx context.Context) common.Hash {
+	return q.qc.ProposedBlockInfo.Hash
+}
+
+func (q *QuorumCert) ProposedBlockRound(ctx context.Context) hexutil.Uint64 {
+	return hexutil.Uint64(q.qc.ProposedBlockInfo.Round)
+}
+
+func (q *QuorumCert) ProposedBlockNumber(ctx context.Context) hexutil.Uint64 {
+	if q.qc.ProposedBlockInfo.Number == nil {
+		return 0
+	}
+	return hexutil.Uint64(q.qc.ProposedBlockInfo.Number.Uint64())
+}
+
+func (q *QuorumCert) Signatures(ctx context.Context) []hexutil.Bytes {
+	sigs := make([]hexutil.Bytes, len(q.qc.Signatures))
+	for i, sig := range q.qc.Signatures {
+		sigs[i] = hexutil.Bytes(sig)
+	}
+	return sigs
+}
+
+func (q *QuorumCert) GapNumber(ctx context.Context) hexutil.Uint64 {
+	return hexutil.Uint64(q.qc.GapNumber)
+}
+
+// BlockNumberArgs encapsulates arguments to accessors that specify a block number.
+type BlockNumberArgs struct {
+	// TODO: Ideally we could use input unions to allow the query to specify the
+	// block parameter by hash, block number, or tag but input unions aren't part of the
+	// standard GraphQL schema SDL yet, see: https://github.com/graphql/graphql-spec/issues/488
+	Block *Long
+}
+
+// NumberOr returns the provided block number argument, or the "current" block number or hash if none
+// was provided.
+func (a BlockNumberArgs) NumberOr(current rpc.BlockNumberOrHash) rpc.BlockNumberOrHash {
+	if a.Block != nil {
+		blockNr := rpc.BlockNumber(*a.Block)
+		return rpc.BlockNumberOrHashWithNumber(blockNr)
+	}
+	return current
+}
+
+// NumberOrLatest returns the provided block number argument, or the "latest" block number if none
+// was provided.
+func (a BlockNumberArgs) NumberOrLatest() rpc.BlockNumberOrHash {
+	return a.NumberOr(rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber))
+}
+
+// Resolver is the top-level object in the GraphQL hierarchy.
+type Resolver struct {
+	backend      ethapi.Backend
+	chain        consensus.ChainReader
+	filterSystem *filters.FilterSystem
+	chainAPI     *ethapi.PublicBlockChainAPI // Block signers and finality
+	consensusAPI *BRDPoS.API                 // BRDPoS v2 block information, nil without BRDPoS
+}
+
+func (r *Resolver) Block(ctx context.Context, args struct {
+	Number *Long
+	Hash   *common.Hash
+}) (*Block, error) {
+	if args.Number != nil && args.Hash != nil {
+		return nil, errors.New("only one of number or hash must be specified")
+	}
+	var numberOrHash rpc.BlockNumberOrHash
+	if args.Number != nil {
+		if *args.Number < 0 {
+			return nil, nil
+		}
+		numberOrHash = rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(*args.Number))
+	} else if args.Hash != nil {
+		numberOrHash = rpc.BlockNumberOrHashWithHash(*args.Hash, false)
+	} else {
+		numberOrHash = rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+	}
+	block := &Block{
+		r:            r,
+		numberOrHash: &numberOrHash,
+	}
+	// Resolve the block, return nil if it doesn't exist.
+	if b, err := block.resolve(ctx); err != nil || b == nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+func (r *Resolver) Blocks(ctx context.Context, args struct {
+	From *Long
+	To   *Long
+}) ([]*Block, error) {
+	current := r.backend.CurrentBlock().NumberU64()
+
+	var from uint64
+	if args.From != nil {
+		if *args.From < 0 {
+			return nil, errors.New("from block number must be non-negative")
+		}
+		from = uint64(*args.From)
+	}
+	to := current
+	if args.To != nil {
+		if *args.To < 0 {
+			return nil, errors.New("to block number must be non-negative")
+		}
+		to = uint64(*args.To)
+	}
+	if to < from {
+		return []*Block{}, nil
+	}
+	if to-from >= maxBlockRange {
+		return nil, errBlockRangeTooLarge
+	}
+	if to > current {
+		to = current
+	}
+	ret := make([]*Block, 0, to-from+1)
+	for i := from; i <= to; i++ {
+		numberOrHash := rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(i))
+		block := &Block{
+			r:            r,
+			numberOrHash: &numberOrHash,
+		}
+		// Resolve the block, stop at the first one that doesn't exist.
+		b, err := block.resolve(ctx)
+		if err != nil {
+			return nil, err
+		} else if b == nil {
+			break
+		}
+		ret = append(ret, block)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+func (r *Resolver) Transaction(ctx context.Context, args struct{ Hash common.Hash }) *Transaction {
+	tx := &Transaction{
+		r:    r,
+		hash: args.Hash,
+	}
+	// Resolve the transaction; if it doesn't exist, return nil.
+	if t, _ := tx.resolve(ctx); t == nil {
+		return nil
+	}
+	return tx
+}
+
+// FilterCriteria encapsulates the arguments to `logs` on the root resolver object.
+type FilterCriteria struct {
+	FromBlock *Long             // beginning of the queried range, nil means genesis block
+	ToBlock   *Long             // end of the range, nil means latest block
+	Addresses *[]common.Address // restricts matches to events created by specific contracts
+
+	// The Topic list restricts matches to particular event topics. Each event has a list
+	// of topics. Topics matches a prefix of that list. An empty element slice matches any
+	// topic. Non-empty elements represent an alternative that matches any of the
+	// contained topics.
+	//
+	// Examples:
+	// {} or nil          matches any topic list
+	// {{A}}              matches topic A in first position
+	// {{}, {B}}          matches any topic in first position, B in second position
+	// {{A}, {B}}         matches topic A in first position, B in second position
+	// {{A, B}}, {C, D}}  matches topic (A OR B) in first position, (C OR D) in second position
+	Topics *[][]common.Hash
+}
+
+func (r *Resolver) Logs(ctx context.Context, args struct{ Filter FilterCriteria }) ([]*Log, error) {
+	// Convert the RPC block numbers into internal representations
+	begin := rpc.LatestBlockNumber.Int64()
+	if args.Filter.FromBlock != nil {
+		begin = int64(*args.Filter.FromBlock)
+	}
+	end := rpc.LatestBlockNumber.Int64()
+	if args.Filter.ToBlock != nil {
+		end = int64(*args.Filter.ToBlock)
+	}
+	var addresses []common.Address
+	if args.Filter.Addresses != nil {
+		addresses = *args.Filter.Addresses
+	}
+	var topics [][]common.Hash
+	if args.Filter.Topics != nil {
+		topics = *args.Filter.Topics
+	}
+	// Construct the range filter
+	filter := r.filterSystem.NewRangeFilter(begin, end, addresses, topics)
+	return runFilter(ctx, r, filter)
+}
+
+func (r *Resolver) ChainID(ctx context.Context) (hexutil.Big, error) {
+	return hexutil.Big(*r.backend.ChainConfig().ChainId), nil
+}
+
+// newResolver creates the root resolver over the given backend.
+func newResolver(backend ethapi.Backend, chain consensus.ChainReader, filterSystem *filters.FilterSystem) *Resolver {
+	r := &Resolver{
+		backend:      backend,
+		chain:        chain,
+		filterSystem: filterSystem,
+		chainAPI:     ethapi.NewPublicBlockChainAPI(backend, chain),
+	}
+	if engine, ok := backend.GetEngine().(*BRDPoS.BRDPoS); ok {
+		for _, api := range engine.APIs(chain) {
+			if service, ok := api.Service.(*BRDPoS.API); ok {
+				r.consensusAPI = service
+			}
+		}
+	}
+	return r
+}
@@ -0,0 +1,167 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"BRDPoSChain/BRCx"
+	"BRDPoSChain/BRCxlending"
+	"BRDPoSChain/common"
+	"BRDPoSChain/core"
+	"BRDPoSChain/eth"
+	"BRDPoSChain/eth/ethconfig"
+	"BRDPoSChain/eth/filters"
+	"BRDPoSChain/node"
+	"BRDPoSChain/p2p"
+)
+
+var testSigner = common.HexToAddress("0x71562b71999873db5b286df957af199ec94617f7")
+
+// newTestStack creates a node serving the GraphQL endpoint next to the HTTP
+// RPC API of an Ethereum service.
+func newTestStack(t *testing.T) *node.Node {
+	stack, err := node.New(&node.Config{
+		DataDir:           t.TempDir(),
+		UseLightweightKDF: true,
+		HTTPHost:          "127.0.0.1",
+		HTTPPort:          0,
+		HTTPModules:       []string{"eth"},
+		HTTPVirtualHosts:  []string{"*"},
+		P2P:               p2p.Config{NoDiscovery: true},
+	})
+	if err != nil {
+		t.Fatalf("could not create node: %v", err)
+	}
+
+	ethConf := &ethconfig.Config{
+		Genesis: core.DeveloperGenesisBlock(15, testSigner),
+	}
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		return eth.New(ctx, ethConf, &BRCx.BRCX{}, &BRCxlending.Lending{})
+	}); err != nil {
+		t.Fatalf("could not register eth service: %v", err)
+	}
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		var ethServ *eth.Ethereum
+		if err := ctx.Service(&ethServ); err != nil {
+			return nil, err
+		}
+		return New(ctx, ethServ.ApiBackend, ethServ.BlockChain(), filters.NewFilterSystem(ethServ.ApiBackend, filters.Config{}))
+	}); err != nil {
+		t.Fatalf("could not register graphql service: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("could not start node: %v", err)
+	}
+	t.Cleanup(func() { stack.Stop() })
+	return stack
+}
+
+// post sends a request with the given body to the path of the HTTP endpoint.
+func post(t *testing.T, stack *node.Node, path, body string) (int, string) {
+	resp, err := http.Post(fmt.Sprintf("http://%s%s", stack.HTTPEndpoint(), path), "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("could not post: %v", err)
+	}
+	defer resp.Body.Close()
+	blob, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("could not read from response body: %v", err)
+	}
+	return resp.StatusCode, string(blob)
+}
+
+// Tests that the GraphQL endpoint resolves queries against the chain and that
+// the JSON-RPC API is still served next to it.
+func TestGraphQLQueries(t *testing.T) {
+	stack := newTestStack(t)
+
+	for i, tt := range []struct {
+		body string
+		want string
+		code int
+	}{
+		{
+			body: `{"query": "{block{number}}"}`,
+			want: `{"data":{"block":{"number":"0x0"}}}`,
+			code: 200,
+		},
+		{
+			body: `{"query": "{block(number:0){number parent{number} round committed quorumCert{gapNumber}}}"}`,
+			want: `{"data":{"block":{"number":"0x0","parent":null,"round":null,"committed":null,"quorumCert":null}}}`,
+			code: 200,
+		},
+		{
+			body: `{"query": "query($n: Long){block(number:$n){transactionCount}}", "variables": {"n": "0x0"}}`,
+			want: `{"data":{"block":{"transactionCount":0}}}`,
+			code: 200,
+		},
+		{
+			body: `{"query": "{block(number:1){number}}"}`,
+			want: `{"data":{"block":null}}`,
+			code: 200,
+		},
+		{
+			body: `{"query": "{transaction(hash:\"0x0000000000000000000000000000000000000000000000000000000000000001\"){hash}}"}`,
+			want: `{"data":{"transaction":null}}`,
+			code: 200,
+		},
+		{
+			body: `{"query": "{blocks(from:0){number}}"}`,
+			want: `{"data":{"blocks":[{"number":"0x0"}]}}`,
+			code: 200,
+		},
+		{
+			body: `{"query": "{blocks(from:0,to:1000){number}}"}`,
+			want: `{"errors":[{"message":"block range exceeds the maximum of 1000 blocks","path":["blocks"]}],"data":null}`,
+			code: 400,
+		},
+		{
+			body: `{"query": "{block{parent{parent{parent{parent{parent{parent{parent{parent{parent{parent{parent{parent{parent{parent{parent{parent{parent{parent{parent{parent{number}}}}}}}}}}}}}}}}}}}}}}"}`,
+			want: `{"errors":[{"message":"Field \"parent\" has depth 21 that exceeds max depth 20","locations":[{"line":1,"column":141}]}]}`,
+			code: 400,
+		},
+		{
+			body: `{"query": "{block{masternodes}}"}`,
+			want: `{"data":{"block":{"masternodes":["0x71562b71999873db5b286df957af199ec94617f7"]}}}`,
+			code: 200,
+		},
+		{
+			body: `{"query": "{bleh{number}}"}`,
+			want: `{"errors":[{"message":"Cannot query field \"bleh\" on type \"Query\".","locations":[{"line":1,"column":2}]}]}`,
+			code: 400,
+		},
+	} {
+		code, body := post(t, stack, "/graphql", tt.body)
+		if body != tt.want {
+			t.Errorf("test %d: body mismatch: have %s, want %s", i, body, tt.want)
+		}
+		if code != tt.code {
+			t.Errorf("test %d: status mismatch: have %d, want %d", i, code, tt.code)
+		}
+	}
+	// The JSON-RPC API must still be served on the root path
+	code, body := post(t, stack, "/", `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`)
+	if code != http.StatusOK || !strings.Contains(body, `"result":"0x0"`) {
+		t.Errorf("rpc request failed: status %d, body %s", code, body)
+	}
+}
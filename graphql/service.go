@@ -0,0 +1,103 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"BRDPoSChain/consensus"
+	"BRDPoSChain/eth/filters"
+	"BRDPoSChain/internal/ethapi"
+	"BRDPoSChain/node"
+	"BRDPoSChain/p2p"
+	"BRDPoSChain/rpc"
+	"github.com/graph-gophers/graphql-go"
+)
+
+// maxQueryDepth is the maximum nesting of the fields of a query, it bounds the
+// work of the queries walking the chain through the parent of the blocks.
+const maxQueryDepth = 20
+
+type handler struct {
+	Schema *graphql.Schema
+}
+
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		Query         string                 `json:"query"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	response := h.Schema.Exec(r.Context(), params.Query, params.OperationName, params.Variables)
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if len(response.Errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	w.Write(responseJSON)
+}
+
+// Service encapsulates a GraphQL service, serving the chain data of the given
+// backend on the /graphql path of the HTTP RPC endpoint.
+type Service struct {
+	handler http.Handler // The handler mounted on the HTTP RPC endpoint
+}
+
+// New constructs a new GraphQL service instance and registers its handler with
+// the node.
+func New(ctx *node.ServiceContext, backend ethapi.Backend, chain consensus.ChainReader, filterSystem *filters.FilterSystem) (*Service, error) {
+	h, err := newHandler(backend, chain, filterSystem)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.RegisterHandler("GraphQL", "/graphql", h); err != nil {
+		return nil, err
+	}
+	return &Service{handler: h}, nil
+}
+
+// newHandler parses the schema against the resolvers of the given backend.
+func newHandler(backend ethapi.Backend, chain consensus.ChainReader, filterSystem *filters.FilterSystem) (http.Handler, error) {
+	s, err := graphql.ParseSchema(schema, newResolver(backend, chain, filterSystem), graphql.MaxDepth(maxQueryDepth))
+	if err != nil {
+		return nil, err
+	}
+	return handler{Schema: s}, nil
+}
+
+// Protocols returns the list of protocols exported by this service.
+func (s *Service) Protocols() []p2p.Protocol { return nil }
+
+// APIs returns the list of APIs exported by this service.
+func (s *Service) APIs() []rpc.API { return nil }
+
+// Start is called after all services have been constructed and the networking
+// layer was also initialized to spawn any goroutines required by the service.
+func (s *Service) Start(server *p2p.Server) error { return nil }
+
+// Stop terminates all goroutines belonging to the service, blocking until they
+// are all terminated.
+func (s *Service) Stop() error { return nil }
@@ -27,6 +27,7 @@ import (
 	"time"
 
 	"BRDPoSChain/BRCx/tradingstate"
+	"BRDPoSChain/BRCxlending"
 	"BRDPoSChain/BRCxlending/lendingstate"
 	"BRDPoSChain/accounts"
 	"BRDPoSChain/accounts/abi"
@@ -68,10 +69,17 @@ const (
 	fieldCandidates  = "candidates"
 	fieldSuccess     = "success"
 	fieldEpoch       = "epoch"
+
+	// maxRewardEpochs is the maximum number of epochs eth_getRewardsByAddress scans
+	maxRewardEpochs = 10000
 )
 
 var errEmptyHeader = errors.New("empty header")
 
+// errTxIndexingInProgress is returned if a transaction is not found while the
+// transaction lookup index is still being built.
+var errTxIndexingInProgress = errors.New("transaction indexing is in progress")
+
 // PublicEthereumAPI provides an API to access Ethereum related information.
 // It offers only methods that operate on public data that is freely available to anyone.
 type PublicEthereumAPI struct {
@@ -158,18 +166,23 @@ func (s *PublicEthereumAPI) ProtocolVersion() hexutil.Uint {
 // - knownStates:   number of known state entries that still need to be pulled
 func (s *PublicEthereumAPI) Syncing() (interface{}, error) {
 	progress := s.b.Downloader().Progress()
-
-	// Return not syncing if the synchronisation already completed
-	if progress.CurrentBlock >= progress.HighestBlock {
+	txProgress, err := s.b.TxIndexProgress()
+	if err != nil {
+		return nil, err
+	}
+	// Return not syncing if the synchronisation and the tx indexing already completed
+	if progress.CurrentBlock >= progress.HighestBlock && txProgress.Done() {
 		return false, nil
 	}
 	// Otherwise gather the block sync stats
 	return map[string]interface{}{
-		"startingBlock": hexutil.Uint64(progress.StartingBlock),
-		"currentBlock":  hexutil.Uint64(progress.CurrentBlock),
-		"highestBlock":  hexutil.Uint64(progress.HighestBlock),
-		"pulledStates":  hexutil.Uint64(progress.PulledStates),
-		"knownStates":   hexutil.Uint64(progress.KnownStates),
+		"startingBlock":          hexutil.Uint64(progress.StartingBlock),
+		"currentBlock":           hexutil.Uint64(progress.CurrentBlock),
+		"highestBlock":           hexutil.Uint64(progress.HighestBlock),
+		"pulledStates":           hexutil.Uint64(progress.PulledStates),
+		"knownStates":            hexutil.Uint64(progress.KnownStates),
+		"txIndexFinishedBlocks":  hexutil.Uint64(txProgress.Indexed),
+		"txIndexRemainingBlocks": hexutil.Uint64(txProgress.Remaining),
 	}, nil
 }
 
@@ -590,6 +603,84 @@ func (s *PublicBlockChainAPI) GetRewardByHash(hash common.Hash) map[string]map[s
 	return s.b.GetRewardByHash(hash)
 }
 
+// AddressRewards are the rewards of an address at a reward checkpoint.
+type AddressRewards struct {
+	Number     hexutil.Uint64      `json:"number"`
+	Hash       common.Hash         `json:"hash"`
+	Epoch      hexutil.Uint64      `json:"epoch"`
+	Signer     map[string]*big.Int `json:"signer,omitempty"`     // signing count and reward of the address as a signer
+	Masternode map[string]*big.Int `json:"masternode,omitempty"` // rewards paid to the holders of the address as a masternode
+	Holder     map[string]*big.Int `json:"holder,omitempty"`     // rewards paid to the address as a holder, per masternode
+}
+
+// GetRewardsByAddress returns the rewards of the given address at the reward
+// checkpoints of the canonical chain between fromEpoch and toEpoch inclusive.
+// Rewards are only available for checkpoints processed with --store-reward.
+func (s *PublicBlockChainAPI) GetRewardsByAddress(ctx context.Context, address common.Address, fromEpoch, toEpoch hexutil.Uint64) ([]*AddressRewards, error) {
+	if toEpoch < fromEpoch {
+		return nil, errors.New("toEpoch is lower than fromEpoch")
+	}
+	if toEpoch-fromEpoch >= maxRewardEpochs {
+		return nil, fmt.Errorf("epoch range too large, max %d", maxRewardEpochs)
+	}
+	config := s.b.ChainConfig()
+	if config.BRDPoS == nil {
+		return nil, errors.New("undefined BRDPoS consensus engine")
+	}
+	epoch := config.BRDPoS.Epoch
+	from, to := uint64(fromEpoch)*epoch, (uint64(toEpoch)+1)*epoch-1
+
+	result := make([]*AddressRewards, 0)
+	for _, number := range rawdb.ReadRewardNumbers(s.b.ChainDb(), address, from, to) {
+		header, err := s.b.HeaderByNumber(ctx, rpc.BlockNumber(number))
+		if err != nil || header == nil {
+			continue
+		}
+		rewards := s.b.GetRewardByHash(header.Hash())
+		if len(rewards) == 0 {
+			// the index points at a block which is no longer canonical
+			continue
+		}
+		entry := &AddressRewards{
+			Number: hexutil.Uint64(number),
+			Hash:   header.Hash(),
+			Epoch:  hexutil.Uint64(number / epoch),
+		}
+		for signer, rewardLog := range rewards["signers"] {
+			if isAddressKey(signer, address) {
+				entry.Signer = rewardLog
+			}
+		}
+		for masternode, holders := range rewards["rewards"] {
+			if isAddressKey(masternode, address) {
+				entry.Masternode = holders
+			}
+			for holder, reward := range holders {
+				if isAddressKey(holder, address) {
+					if entry.Holder == nil {
+						entry.Holder = make(map[string]*big.Int)
+					}
+					entry.Holder[masternode] = reward
+				}
+			}
+		}
+		if entry.Signer == nil && entry.Masternode == nil && entry.Holder == nil {
+			continue
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// isAddressKey reports whether the JSON map key holds the given address.
+func isAddressKey(key string, address common.Address) bool {
+	var addr common.Address
+	if err := addr.UnmarshalText([]byte(key)); err != nil {
+		return false
+	}
+	return addr == address
+}
+
 // GetBalance returns the amount of wei for the given address in the state of the
 // given block number. The rpc.LatestBlockNumber and rpc.PendingBlockNumber meta
 // block numbers are also allowed.
@@ -2182,6 +2273,23 @@ func (s *PublicTransactionPoolAPI) GetTransactionCount(ctx context.Context, addr
 	return (*hexutil.Uint64)(&nonce), state.Error()
 }
 
+// txLookupError returns the error to report for a transaction missing from the
+// lookup index, or nil if the index covers the whole chain and the transaction
+// is simply unknown.
+func txLookupError(b Backend) error {
+	progress, err := b.TxIndexProgress()
+	if err != nil {
+		return nil
+	}
+	if !progress.Done() {
+		return errTxIndexingInProgress
+	}
+	if progress.Tail > 0 {
+		return fmt.Errorf("transaction not found, lookup index is pruned below block %d", progress.Tail)
+	}
+	return nil
+}
+
 // GetTransactionByHash returns the transaction for the given hash
 func (s *PublicTransactionPoolAPI) GetTransactionByHash(ctx context.Context, hash common.Hash) (*RPCTransaction, error) {
 	// Try to return an already finalized transaction
@@ -2198,8 +2306,8 @@ func (s *PublicTransactionPoolAPI) GetTransactionByHash(ctx context.Context, has
 		return newRPCPendingTransaction(tx, s.b.CurrentHeader(), s.b.ChainConfig()), nil
 	}
 
-	// Transaction unknown, return as such
-	return nil, nil
+	// Transaction unknown, return as such unless the index is incomplete
+	return nil, txLookupError(s.b)
 }
 
 // GetRawTransactionByHash returns the bytes of the transaction for the given hash.
@@ -2209,7 +2317,7 @@ func (s *PublicTransactionPoolAPI) GetRawTransactionByHash(ctx context.Context,
 	if tx == nil {
 		if tx = s.b.GetPoolTransaction(hash); tx == nil {
 			// Transaction not found anywhere, abort
-			return nil, nil
+			return nil, txLookupError(s.b)
 		}
 	}
 	// Serialize to RLP and return
@@ -2220,9 +2328,13 @@ func (s *PublicTransactionPoolAPI) GetRawTransactionByHash(ctx context.Context,
 func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, hash common.Hash) (map[string]interface{}, error) {
 	tx, blockHash, blockNumber, index := rawdb.ReadTransaction(s.b.ChainDb(), hash)
 	if tx == nil {
-		// When the transaction doesn't exist, the RPC method should return JSON null
-		// as per specification.
-		return nil, nil
+		// When the transaction doesn't exist or is still pending, the RPC method
+		// should return JSON null as per specification. A transaction possibly
+		// hidden by an incomplete lookup index is reported as an error instead.
+		if s.b.GetPoolTransaction(hash) != nil {
+			return nil, nil
+		}
+		return nil, txLookupError(s.b)
 	}
 	receipts, err := s.b.GetReceipts(ctx, blockHash)
 	if err != nil {
@@ -2451,6 +2563,15 @@ func (s *PublicBRCXTransactionPoolAPI) GetOrderTxMatchByHash(ctx context.Context
 
 }
 
+// GetTradesByTxHash returns the trades matched at the tx of the given hash, only SDK nodes store them
+func (s *PublicBRCXTransactionPoolAPI) GetTradesByTxHash(ctx context.Context, hash common.Hash) ([]*tradingstate.TradeRecord, error) {
+	BRCxService := s.b.BRCxService()
+	if BRCxService == nil {
+		return nil, errors.New("not find BRCX service")
+	}
+	return BRCxService.GetTradesByTxHash(hash)
+}
+
 // GetOrderPoolContent return pending, queued content
 func (s *PublicBRCXTransactionPoolAPI) GetOrderPoolContent(ctx context.Context) interface{} {
 	pendingOrders := []*tradingstate.OrderItem{}
@@ -2537,6 +2658,7 @@ type OrderMsg struct {
 	Side            string         `json:"side,omitempty"`
 	Type            string         `json:"type,omitempty"`
 	OrderID         hexutil.Uint64 `json:"orderid,omitempty"`
+	StopPrice       *hexutil.Big   `json:"stopPrice,omitempty"`
 	// Signature values
 	V hexutil.Big `json:"v" gencodec:"required"`
 	R hexutil.Big `json:"r" gencodec:"required"`
@@ -2587,6 +2709,9 @@ type InterestVolume struct {
 // The sender is responsible for signing the transaction and using the correct nonce.
 func (s *PublicBRCXTransactionPoolAPI) SendOrder(ctx context.Context, msg OrderMsg) (common.Hash, error) {
 	tx := types.NewOrderTransaction(uint64(msg.AccountNonce), msg.Quantity.ToInt(), msg.Price.ToInt(), msg.ExchangeAddress, msg.UserAddress, msg.BaseToken, msg.QuoteToken, msg.Status, msg.Side, msg.Type, msg.Hash, uint64(msg.OrderID))
+	if msg.StopPrice != nil {
+		tx.SetStopPrice(msg.StopPrice.ToInt())
+	}
 	tx = tx.ImportSignature(msg.V.ToInt(), msg.R.ToInt(), msg.S.ToInt())
 	return submitOrderTransaction(ctx, s.b, tx)
 }
@@ -3174,7 +3299,8 @@ func (s *PublicBRCXTransactionPoolAPI) GetLendingTxMatchByHash(ctx context.Conte
 	return batch.Data, nil
 }
 
-// GetLiquidatedTradesByTxHash returns trades which closed by BRCX protocol at the tx of the give hash
+// GetLiquidatedTradesByTxHash returns trades which closed by BRCX protocol at the tx of the give hash,
+// trades left open by a partial liquidation are listed apart
 func (s *PublicBRCXTransactionPoolAPI) GetLiquidatedTradesByTxHash(ctx context.Context, hash common.Hash) (lendingstate.FinalizedResult, error) {
 	var tx *types.Transaction
 	if tx, _, _, _ = rawdb.ReadTransaction(s.b.ChainDb(), hash); tx == nil {
@@ -3245,6 +3371,101 @@ func (s *PublicBRCXTransactionPoolAPI) GetLendingTradeById(ctx context.Context,
 	return lendingItem, nil
 }
 
+// backendChainContext adapts the backend to consensus.ChainContext.
+type backendChainContext struct {
+	b Backend
+}
+
+func (c *backendChainContext) Engine() consensus.Engine {
+	return c.b.GetEngine()
+}
+
+func (c *backendChainContext) GetHeader(hash common.Hash, number uint64) *types.Header {
+	header, _ := c.b.HeaderByHash(context.Background(), hash)
+	if header == nil || header.Number.Uint64() != number {
+		return nil
+	}
+	return header
+}
+
+func (c *backendChainContext) CurrentHeader() *types.Header {
+	return c.b.CurrentHeader()
+}
+
+func (c *backendChainContext) Config() *params.ChainConfig {
+	return c.b.ChainConfig()
+}
+
+// lendingStates returns the state, trading state and lending state after the given block.
+func (s *PublicBRCXTransactionPoolAPI) lendingStates(ctx context.Context, block *types.Block) (*state.StateDB, *tradingstate.TradingStateDB, *lendingstate.LendingStateDB, error) {
+	BRCxService := s.b.BRCxService()
+	if BRCxService == nil {
+		return nil, nil, nil, errors.New("not find BRCX service")
+	}
+	lendingService := s.b.LendingService()
+	if lendingService == nil {
+		return nil, nil, nil, errors.New("not find BRCX Lending service")
+	}
+	author, err := s.b.GetEngine().Author(block.Header())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	statedb, _, err := s.b.StateAndHeaderByNumberOrHash(ctx, rpc.BlockNumberOrHashWithHash(block.Hash(), false))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tradingState, err := BRCxService.GetTradingState(block, author)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	lendingState, err := lendingService.GetLendingState(block, author)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return statedb, tradingState, lendingState, nil
+}
+
+// GetLendingPositions returns the open lending trades of the borrower with their
+// collateral ratio, distance to liquidation, next auto top-up and time to expiry.
+func (s *PublicBRCXTransactionPoolAPI) GetLendingPositions(ctx context.Context, borrower common.Address) ([]*BRCxlending.LendingPosition, error) {
+	block := s.b.CurrentBlock()
+	if block == nil {
+		return nil, errors.New("not find current block")
+	}
+	statedb, tradingState, lendingState, err := s.lendingStates(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+	return s.b.LendingService().GetLendingPositions(block.Header(), &backendChainContext{s.b}, statedb, tradingState, lendingState, borrower)
+}
+
+// PreviewLiquidation simulates the liquidation pass of the next liquidation block
+// against the state of the current block, nothing is written.
+func (s *PublicBRCXTransactionPoolAPI) PreviewLiquidation(ctx context.Context) (*BRCxlending.LiquidationPreview, error) {
+	block := s.b.CurrentBlock()
+	if block == nil {
+		return nil, errors.New("not find current block")
+	}
+	config := s.b.ChainConfig()
+	if config.BRDPoS == nil {
+		return nil, errors.New("BRCX lending requires BRDPoS")
+	}
+	statedb, tradingState, lendingState, err := s.lendingStates(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+	// liquidation only runs at the LiquidateLendingTradeBlock block of an epoch
+	number := block.NumberU64() + 1
+	if offset := number % config.BRDPoS.Epoch; offset != common.LiquidateLendingTradeBlock {
+		number += (common.LiquidateLendingTradeBlock + config.BRDPoS.Epoch - offset) % config.BRDPoS.Epoch
+	}
+	header := types.CopyHeader(block.Header())
+	header.ParentHash = block.Hash()
+	header.Number = new(big.Int).SetUint64(number)
+	header.Time = new(big.Int).Add(block.Time(), new(big.Int).SetUint64((number-block.NumberU64())*config.BRDPoS.Period))
+	return s.b.LendingService().PreviewLiquidation(header, &backendChainContext{s.b}, statedb, tradingState, lendingState)
+}
+
 // Sign calculates an ECDSA signature for:
 // keccack256("\x19Ethereum Signed Message:\n" + len(message) + message).
 //
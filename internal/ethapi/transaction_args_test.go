@@ -400,6 +400,10 @@ func (b *backendMock) Downloader() *downloader.Downloader {
 	return nil
 }
 
+func (b *backendMock) TxIndexProgress() (core.TxIndexProgress, error) {
+	return core.TxIndexProgress{}, nil
+}
+
 func (b *backendMock) EventMux() *event.TypeMux {
 	return nil
 }
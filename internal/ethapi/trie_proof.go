@@ -2,10 +2,17 @@ package ethapi
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"math/big"
 
+	"BRDPoSChain/BRCx/tradingstate"
+	"BRDPoSChain/BRCxlending/lendingstate"
+	"BRDPoSChain/common"
 	"BRDPoSChain/common/hexutil"
 	"BRDPoSChain/core/types"
 	"BRDPoSChain/rlp"
+	"BRDPoSChain/rpc"
 	"BRDPoSChain/trie"
 )
 
@@ -37,3 +44,239 @@ func deriveTrie(list types.DerivableList) *trie.Trie {
 	}
 	return trie
 }
+
+// toHexSlice creates a slice of hex-strings based on []byte.
+func toHexSlice(b [][]byte) []string {
+	r := make([]string, len(b))
+	for i := range b {
+		r[i] = hexutil.Encode(b[i])
+	}
+	return r
+}
+
+// AccountResult is the result of eth_getProof.
+type AccountResult struct {
+	Address      common.Address  `json:"address"`
+	AccountProof []string        `json:"accountProof"`
+	Balance      *hexutil.Big    `json:"balance"`
+	CodeHash     common.Hash     `json:"codeHash"`
+	Nonce        hexutil.Uint64  `json:"nonce"`
+	StorageHash  common.Hash     `json:"storageHash"`
+	StorageProof []StorageResult `json:"storageProof"`
+}
+
+// StorageResult is the proof of a storage slot in AccountResult.
+type StorageResult struct {
+	Key   string       `json:"key"`
+	Value *hexutil.Big `json:"value"`
+	Proof []string     `json:"proof"`
+}
+
+// GetProof returns the Merkle-proof for a given account and optionally some storage keys.
+func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNrOrHash rpc.BlockNumberOrHash) (*AccountResult, error) {
+	state, _, err := s.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	storageTrie := state.StorageTrie(address)
+	storageHash := types.EmptyRootHash
+	codeHash := state.GetCodeHash(address)
+	storageProof := make([]StorageResult, len(storageKeys))
+
+	// if we have a storageTrie, (which means the account exists), we can update the storagehash
+	if storageTrie != nil {
+		storageHash = storageTrie.Hash()
+	} else {
+		// no storageTrie means the account does not exist, so the codeHash is the hash of an empty bytearray.
+		codeHash = types.EmptyCodeHash
+	}
+
+	// create the proof for the storageKeys
+	for i, hexKey := range storageKeys {
+		key, err := decodeHash(hexKey)
+		if err != nil {
+			return nil, err
+		}
+		if storageTrie != nil {
+			proof, storageError := state.GetStorageProof(address, key)
+			if storageError != nil {
+				return nil, storageError
+			}
+			storageProof[i] = StorageResult{hexKey, (*hexutil.Big)(state.GetState(address, key).Big()), toHexSlice(proof)}
+		} else {
+			storageProof[i] = StorageResult{hexKey, &hexutil.Big{}, []string{}}
+		}
+	}
+
+	// create the accountProof
+	accountProof, proofErr := state.GetProof(address)
+	if proofErr != nil {
+		return nil, proofErr
+	}
+
+	return &AccountResult{
+		Address:      address,
+		AccountProof: toHexSlice(accountProof),
+		Balance:      (*hexutil.Big)(state.GetBalance(address)),
+		CodeHash:     codeHash,
+		Nonce:        hexutil.Uint64(state.GetNonce(address)),
+		StorageHash:  storageHash,
+		StorageProof: storageProof,
+	}, state.Error()
+}
+
+// decodeHash parses a hex-encoded 32-byte hash. The input may optionally
+// be prefixed by 0x and can have a byte length up to 32.
+func decodeHash(s string) (common.Hash, error) {
+	if len(s) >= 2 && (s[:2] == "0x" || s[:2] == "0X") {
+		s = s[2:]
+	}
+	if (len(s) & 1) > 0 {
+		s = "0" + s
+	}
+	b, err := hexutil.Decode("0x" + s)
+	if err != nil {
+		return common.Hash{}, errors.New("hex string invalid")
+	}
+	if len(b) > 32 {
+		return common.Hash{}, errors.New("hex string too long, want at most 32 bytes")
+	}
+	return common.BytesToHash(b), nil
+}
+
+// OrderProofResult is the result of BRCx_getOrderProof. The order book proof is
+// checked against the trading state root committed by the block producer, the
+// order proof against the order root found in the proven order book.
+type OrderProofResult struct {
+	TradingStateRoot common.Hash             `json:"tradingStateRoot"`
+	OrderBook        common.Hash             `json:"orderBook"`
+	OrderBookProof   []string                `json:"orderBookProof"`
+	OrderRoot        common.Hash             `json:"orderRoot"`
+	OrderId          common.Hash             `json:"orderId"`
+	Order            *tradingstate.OrderItem `json:"order"`
+	OrderProof       []string                `json:"orderProof"`
+}
+
+// GetOrderProof returns the Merkle-proof of an order of the given pair against
+// the trading state root of the given block.
+func (s *PublicBRCXTransactionPoolAPI) GetOrderProof(ctx context.Context, baseToken, quoteToken common.Address, orderId uint64, blockNrOrHash rpc.BlockNumberOrHash) (*OrderProofResult, error) {
+	block, err := s.b.BlockByNumberOrHash(ctx, blockNrOrHash)
+	if block == nil || err != nil {
+		return nil, err
+	}
+	BRCxService := s.b.BRCxService()
+	if BRCxService == nil {
+		return nil, errors.New("not find BRCX service")
+	}
+	author, err := s.b.GetEngine().Author(block.Header())
+	if err != nil {
+		return nil, err
+	}
+	root, err := BRCxService.GetTradingStateRoot(block, author)
+	if err != nil {
+		return nil, err
+	}
+	BRCxState, err := BRCxService.GetTradingState(block, author)
+	if err != nil {
+		return nil, err
+	}
+	orderBook := tradingstate.GetTradingOrderBookHash(baseToken, quoteToken)
+	orderBookProof, err := BRCxState.GetOrderBookProof(orderBook)
+	if err != nil {
+		return nil, err
+	}
+	result := &OrderProofResult{
+		TradingStateRoot: root,
+		OrderBook:        orderBook,
+		OrderBookProof:   toHexSlice(orderBookProof),
+		OrderRoot:        BRCxState.GetOrderRoot(orderBook),
+		OrderId:          common.BigToHash(new(big.Int).SetUint64(orderId)),
+		OrderProof:       []string{},
+	}
+	if !BRCxState.Exist(orderBook) {
+		return result, nil
+	}
+	orderProof, err := BRCxState.GetOrderProof(orderBook, result.OrderId)
+	if err != nil {
+		return nil, err
+	}
+	result.OrderProof = toHexSlice(orderProof)
+	if order := BRCxState.GetOrder(orderBook, result.OrderId); order.Quantity != nil && order.Quantity.Sign() != 0 {
+		result.Order = &order
+	}
+	return result, BRCxState.Error()
+}
+
+// PublicBRCXLendingStateAPI provides the lending state methods of the
+// BRCxlending namespace that need access to the chain.
+type PublicBRCXLendingStateAPI struct {
+	b Backend
+}
+
+// NewPublicBRCXLendingStateAPI creates a new RPC service for the lending state.
+func NewPublicBRCXLendingStateAPI(b Backend) *PublicBRCXLendingStateAPI {
+	return &PublicBRCXLendingStateAPI{b}
+}
+
+// LendingTradeProofResult is the result of BRCxlending_getTradeProof. The lending
+// book proof is checked against the lending state root committed by the block
+// producer, the trade proof against the trade root found in the proven lending book.
+type LendingTradeProofResult struct {
+	LendingStateRoot common.Hash                `json:"lendingStateRoot"`
+	LendingBook      common.Hash                `json:"lendingBook"`
+	LendingBookProof []string                   `json:"lendingBookProof"`
+	TradeRoot        common.Hash                `json:"tradeRoot"`
+	TradeId          common.Hash                `json:"tradeId"`
+	Trade            *lendingstate.LendingTrade `json:"trade"`
+	TradeProof       []string                   `json:"tradeProof"`
+}
+
+// GetTradeProof returns the Merkle-proof of a lending trade of the given lending
+// book against the lending state root of the given block.
+func (s *PublicBRCXLendingStateAPI) GetTradeProof(ctx context.Context, lendingToken common.Address, term uint64, tradeId uint64, blockNrOrHash rpc.BlockNumberOrHash) (*LendingTradeProofResult, error) {
+	block, err := s.b.BlockByNumberOrHash(ctx, blockNrOrHash)
+	if block == nil || err != nil {
+		return nil, err
+	}
+	lendingService := s.b.LendingService()
+	if lendingService == nil {
+		return nil, errors.New("not find BRCX Lending service")
+	}
+	author, err := s.b.GetEngine().Author(block.Header())
+	if err != nil {
+		return nil, err
+	}
+	root, err := lendingService.GetLendingStateRoot(block, author)
+	if err != nil {
+		return nil, err
+	}
+	lendingState, err := lendingService.GetLendingState(block, author)
+	if err != nil {
+		return nil, err
+	}
+	lendingBook := lendingstate.GetLendingOrderBookHash(lendingToken, term)
+	lendingBookProof, err := lendingState.GetLendingBookProof(lendingBook)
+	if err != nil {
+		return nil, err
+	}
+	result := &LendingTradeProofResult{
+		LendingStateRoot: root,
+		LendingBook:      lendingBook,
+		LendingBookProof: toHexSlice(lendingBookProof),
+		TradeRoot:        lendingState.GetLendingTradeRoot(lendingBook),
+		TradeId:          common.BigToHash(new(big.Int).SetUint64(tradeId)),
+		TradeProof:       []string{},
+	}
+	if !lendingState.Exist(lendingBook) {
+		return result, nil
+	}
+	tradeProof, err := lendingState.GetLendingTradeProof(lendingBook, result.TradeId)
+	if err != nil {
+		return nil, err
+	}
+	result.TradeProof = toHexSlice(tradeProof)
+	if trade := lendingState.GetLendingTrade(lendingBook, result.TradeId); trade.TradeId == tradeId {
+		result.Trade = &trade
+	}
+	return result, lendingState.Error()
+}
@@ -173,6 +173,17 @@ web3._extend({
 			call: 'BRDPoS_getBlockInfoByEpochNum',
 			params: 1,
 		}),
+		new web3._extend.Method({
+			name: 'getForensicProofs',
+			call: 'BRDPoS_getForensicProofs',
+			params: 1,
+			inputFormatter: [null]
+		}),
+		new web3._extend.Method({
+			name: 'verifyForensicProof',
+			call: 'BRDPoS_verifyForensicProof',
+			params: 1,
+		}),
 	],
 	properties: [
 		new web3._extend.Property({
@@ -523,6 +534,18 @@ web3._extend({
 			call: 'eth_getRewardByHash',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'getRewardsByAddress',
+			call: 'eth_getRewardsByAddress',
+			params: 3,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, web3._extend.utils.fromDecimal, web3._extend.utils.fromDecimal]
+		}),
+		new web3._extend.Method({
+			name: 'getProof',
+			call: 'eth_getProof',
+			params: 3,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, null, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
 		new web3._extend.Method({
 			name: 'getTransactionAndReceiptProof',
 			call: 'eth_getTransactionAndReceiptProof',
@@ -759,6 +782,11 @@ web3._extend({
 		new web3._extend.Method({
             name: 'getOrderTxMatchByHash',
             call: 'BRCx_getOrderTxMatchByHash',
+            params: 1
+		}),
+		new web3._extend.Method({
+            name: 'getTradesByTxHash',
+            call: 'BRCx_getTradesByTxHash',
             params: 1
 		}),
 		new web3._extend.Method({
@@ -911,6 +939,32 @@ web3._extend({
             call: 'BRCx_getLendingTradeById',
             params: 3
 		}),
+		new web3._extend.Method({
+            name: 'getCandles',
+            call: 'BRCx_getCandles',
+            params: 5
+		}),
+		new web3._extend.Method({
+            name: 'getTicker',
+            call: 'BRCx_getTicker',
+            params: 2
+		}),
+		new web3._extend.Method({
+            name: 'getLendingPositions',
+            call: 'BRCx_getLendingPositions',
+            params: 1
+		}),
+		new web3._extend.Method({
+            name: 'previewLiquidation',
+            call: 'BRCx_previewLiquidation',
+            params: 0
+		}),
+		new web3._extend.Method({
+            name: 'getOrderProof',
+            call: 'BRCx_getOrderProof',
+            params: 4,
+            inputFormatter: [null, null, null, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
 	]
 });
 `
@@ -1014,6 +1068,12 @@ web3._extend({
             call: 'BRCxlending_getPrice',
             params: 2
 		}),
+		new web3._extend.Method({
+            name: 'getTradeProof',
+            call: 'BRCxlending_getTradeProof',
+            params: 4,
+            inputFormatter: [null, null, null, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
 	]
 });
 `
@@ -21,8 +21,6 @@ import (
 	"encoding/json"
 	"errors"
 	"math/big"
-	"os"
-	"path/filepath"
 
 	"BRDPoSChain/BRCx"
 	"BRDPoSChain/BRCx/tradingstate"
@@ -43,6 +41,7 @@ import (
 	"BRDPoSChain/ethdb"
 	"BRDPoSChain/event"
 	"BRDPoSChain/light"
+	"BRDPoSChain/log"
 	"BRDPoSChain/params"
 	"BRDPoSChain/rpc"
 )
@@ -274,6 +273,12 @@ func (b *LesApiBackend) Downloader() *downloader.Downloader {
 	return b.eth.Downloader()
 }
 
+// TxIndexProgress reports a finished indexing, light clients retrieve
+// transactions on demand instead of maintaining a local index.
+func (b *LesApiBackend) TxIndexProgress() (core.TxIndexProgress, error) {
+	return core.TxIndexProgress{}, nil
+}
+
 func (b *LesApiBackend) ProtocolVersion() int {
 	return b.eth.LesVersion() + 10000
 }
@@ -334,27 +339,20 @@ func (b *LesApiBackend) GetEngine() consensus.Engine {
 	return b.eth.engine
 }
 func (s *LesApiBackend) GetRewardByHash(hash common.Hash) map[string]map[string]map[string]*big.Int {
+	rewards := make(map[string]map[string]map[string]*big.Int)
 	header := s.eth.blockchain.GetHeaderByHash(hash)
 	if header != nil {
-		data, err := os.ReadFile(filepath.Join(common.StoreRewardFolder, header.Number.String()+"."+header.Hash().Hex()))
-		if err == nil {
-			rewards := make(map[string]map[string]map[string]*big.Int)
-			err = json.Unmarshal(data, &rewards)
-			if err == nil {
-				return rewards
-			}
-		} else {
-			data, err = os.ReadFile(filepath.Join(common.StoreRewardFolder, header.Number.String()+"."+header.HashNoValidator().Hex()))
-			if err == nil {
-				rewards := make(map[string]map[string]map[string]*big.Int)
-				err = json.Unmarshal(data, &rewards)
-				if err == nil {
-					return rewards
-				}
+		data := rawdb.ReadRewards(s.eth.chainDb, header.Hash(), header.Number.Uint64())
+		if data == nil {
+			data = rawdb.ReadRewards(s.eth.chainDb, header.HashNoValidator(), header.Number.Uint64())
+		}
+		if data != nil {
+			if err := json.Unmarshal(data, &rewards); err != nil {
+				log.Error("Invalid rewards JSON", "number", header.Number, "hash", hash, "err", err)
 			}
 		}
 	}
-	return make(map[string]map[string]map[string]*big.Int)
+	return rewards
 }
 
 // GetVotersRewards return a map of voters of snapshot at given block hash
@@ -710,6 +710,7 @@ func (w *worker) commitNewWork() {
 		lendingInput                                                         []*lendingstate.LendingItem
 		updatedTrades                                                        map[common.Hash]*lendingstate.LendingTrade
 		liquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades []*lendingstate.LendingTrade
+		partiallyLiquidatedTrades                                            []*lendingstate.LendingTrade
 		lendingFinalizedTradeTransaction                                     *types.Transaction
 	)
 	feeCapacity := state.GetTRC21FeeCapacityFromStateWithCache(parent.Root(), work.state)
@@ -757,7 +758,7 @@ func (w *worker) commitNewWork() {
 					lendingInput, lendingMatchingResults = BRCXLending.ProcessOrderPending(header, w.coinbase, w.chain, lendingOrderPending, work.state, work.lendingState, work.tradingState)
 					log.Debug("lending transaction matches found", "lendingInput", len(lendingInput), "lendingMatchingResults", len(lendingMatchingResults))
 					if header.Number.Uint64()%w.config.BRDPoS.Epoch == common.LiquidateLendingTradeBlock {
-						updatedTrades, liquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades, err = BRCXLending.ProcessLiquidationData(header, w.chain, work.state, work.tradingState, work.lendingState)
+						updatedTrades, liquidatedTrades, partiallyLiquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades, err = BRCXLending.ProcessLiquidationData(header, w.chain, work.state, work.tradingState, work.lendingState)
 						if err != nil {
 							log.Error("Fail when process lending liquidation data ", "error", err)
 							return
@@ -825,7 +826,7 @@ func (w *worker) commitNewWork() {
 
 				if len(updatedTrades) > 0 {
 					log.Debug("M1 finalized trades")
-					finalizedTradeData, err := lendingstate.EncodeFinalizedResult(liquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades)
+					finalizedTradeData, err := lendingstate.EncodeFinalizedResult(liquidatedTrades, partiallyLiquidatedTrades, autoRepayTrades, autoTopUpTrades, autoRecallTrades)
 					if err != nil {
 						log.Error("Fail to marshal lendingData", "error", err)
 						return
@@ -39,6 +39,7 @@ const (
 	datadirStaticNodes     = "static-nodes.json"  // Path within the datadir to the static node list
 	datadirTrustedNodes    = "trusted-nodes.json" // Path within the datadir to the trusted node list
 	datadirNodeDatabase    = "nodes"              // Path within the datadir to store the node infos
+	datadirJWTKey          = "jwtsecret"          // Path within the datadir to the JWT secret of the authenticated RPC
 )
 
 // Config represents a small collection of configuration values to fine tune the
@@ -64,6 +65,11 @@ type Config struct {
 	// in memory.
 	DataDir string
 
+	// DBEngine is the key-value storage engine (leveldb or pebble) to use for new
+	// databases. Existing databases are always opened with the engine they were
+	// created with.
+	DBEngine string `toml:",omitempty"`
+
 	// Configuration of peer-to-peer networking.
 	P2P p2p.Config
 
@@ -93,6 +99,11 @@ type Config struct {
 	// SmartCardDaemonPath is the path to the smartcard daemon's socket.
 	SmartCardDaemonPath string `toml:",omitempty"`
 
+	// ExternalSigner specifies an external signer holding the masternode key, the
+	// path of its IPC socket. The signer is only reachable over IPC, there is no
+	// HTTP transport as anyone reaching the signer could have it sign.
+	ExternalSigner string `toml:",omitempty"`
+
 	// IPCPath is the requested location to place the IPC endpoint. If the path is
 	// a simple file name, it is placed inside the data directory (or on the root
 	// pipe path on Windows), whereas if it's a resolvable path name (absolute or
@@ -157,6 +168,33 @@ type Config struct {
 	// private APIs to untrusted users is a major security risk.
 	WSExposeAll bool `toml:",omitempty"`
 
+	// AuthAddr is the host interface on which to start the authenticated RPC
+	// server, serving the privileged API modules over HTTP and websocket to
+	// clients presenting a valid JWT. If this field is empty, no authenticated
+	// endpoint will be started.
+	AuthAddr string `toml:",omitempty"`
+
+	// AuthPort is the TCP port number on which to start the authenticated RPC
+	// server.
+	AuthPort int `toml:",omitempty"`
+
+	// AuthVirtualHosts is the list of virtual hostnames which are allowed on
+	// incoming requests to the authenticated RPC server.
+	AuthVirtualHosts []string `toml:",omitempty"`
+
+	// JWTSecret is the path to the hex encoded 32 byte secret used to verify the
+	// tokens of the authenticated RPC server. If the file does not exist, a new
+	// secret is generated into it. Empty defaults to a file in the datadir.
+	JWTSecret string `toml:",omitempty"`
+
+	// BatchRequestLimit is the maximum number of calls in a JSON-RPC batch served
+	// over HTTP, websocket and the authenticated endpoint. Zero is unlimited.
+	BatchRequestLimit int `toml:",omitempty"`
+
+	// BatchResponseMaxSize is the maximum number of bytes returned from a JSON-RPC
+	// batch before the remaining calls are failed. Zero is unlimited.
+	BatchResponseMaxSize int `toml:",omitempty"`
+
 	// Logger is a custom logger to use with the p2p.Server.
 	Logger log.Logger `toml:",omitempty"`
 
@@ -236,6 +274,15 @@ func (c *Config) WSEndpoint() string {
 	return fmt.Sprintf("%s:%d", c.WSHost, c.WSPort)
 }
 
+// AuthEndpoint resolves the authenticated RPC endpoint based on the configured
+// host interface and port parameters.
+func (c *Config) AuthEndpoint() string {
+	if c.AuthAddr == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", c.AuthAddr, c.AuthPort)
+}
+
 // DefaultWSEndpoint returns the websocket endpoint used by default.
 func DefaultWSEndpoint() string {
 	config := &Config{WSHost: DefaultWSHost, WSPort: DefaultWSPort}
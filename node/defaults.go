@@ -32,6 +32,11 @@ const (
 	DefaultHTTPPort = 8545        // Default TCP port for the HTTP RPC server
 	DefaultWSHost   = "localhost" // Default host interface for the websocket RPC server
 	DefaultWSPort   = 8546        // Default TCP port for the websocket RPC server
+	DefaultAuthHost = "localhost" // Default host interface for the authenticated RPC server
+	DefaultAuthPort = 8551        // Default TCP port for the authenticated RPC server
+
+	DefaultBatchRequestLimit    = 1000             // Default maximum number of calls in a JSON-RPC batch
+	DefaultBatchResponseMaxSize = 25 * 1000 * 1000 // Default maximum size of the results of a JSON-RPC batch
 )
 
 // DefaultConfig contains reasonable default settings.
@@ -43,6 +48,11 @@ var DefaultConfig = Config{
 	HTTPTimeouts:     rpc.DefaultHTTPTimeouts,
 	WSPort:           DefaultWSPort,
 	WSModules:        []string{"net", "web3"},
+	AuthPort:         DefaultAuthPort,
+	AuthVirtualHosts: []string{"localhost"},
+
+	BatchRequestLimit:    DefaultBatchRequestLimit,
+	BatchResponseMaxSize: DefaultBatchResponseMaxSize,
 	P2P: p2p.Config{
 		ListenAddr: ":30303",
 		MaxPeers:   50,
@@ -0,0 +1,135 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package node
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// jwtExpiryTimeout is the maximum allowed difference between the issuance time
+// of a token and the local clock.
+const jwtExpiryTimeout = 60 * time.Second
+
+var (
+	errMissingToken     = errors.New("missing token")
+	errMalformedToken   = errors.New("malformed token")
+	errUnsupportedAlg   = errors.New("unsupported signing algorithm")
+	errInvalidSignature = errors.New("invalid token signature")
+	errMissingIssuedAt  = errors.New("missing issued-at")
+	errStaleToken       = errors.New("stale token")
+	errFutureToken      = errors.New("future token")
+	errExpiredToken     = errors.New("token is expired")
+)
+
+// jwtHandler is a handler which only lets requests through that carry a valid
+// HS256 signed JSON web token in their Authorization header.
+type jwtHandler struct {
+	secret []byte
+	next   http.Handler
+}
+
+// newJWTHandler creates a http.Handler with jwt authentication support.
+func newJWTHandler(secret []byte, next http.Handler) http.Handler {
+	return &jwtHandler{
+		secret: secret,
+		next:   next,
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (handler *jwtHandler) ServeHTTP(out http.ResponseWriter, r *http.Request) {
+	var token string
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if err := verifyJWT(token, handler.secret, time.Now()); err != nil {
+		http.Error(out, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	handler.next.ServeHTTP(out, r)
+}
+
+// jwtClaims are the token claims checked by the authenticated endpoint.
+type jwtClaims struct {
+	IssuedAt  *int64 `json:"iat"`
+	ExpiresAt *int64 `json:"exp"`
+}
+
+// verifyJWT checks that the token is signed with the given secret using HS256,
+// and that it was issued within jwtExpiryTimeout of now and has not expired.
+func verifyJWT(token string, secret []byte, now time.Time) error {
+	if token == "" {
+		return errMissingToken
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errMalformedToken
+	}
+	// Check the header, only accepting HMAC-SHA256 signatures
+	blob, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return errMalformedToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(blob, &header); err != nil {
+		return errMalformedToken
+	}
+	if header.Alg != "HS256" {
+		return errUnsupportedAlg
+	}
+	// Verify the signature before looking at the claims
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return errMalformedToken
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return errInvalidSignature
+	}
+	// Check the issuance and expiry times
+	if blob, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		return errMalformedToken
+	}
+	var claims jwtClaims
+	if err := json.Unmarshal(blob, &claims); err != nil {
+		return errMalformedToken
+	}
+	if claims.IssuedAt == nil {
+		return errMissingIssuedAt
+	}
+	issued := time.Unix(*claims.IssuedAt, 0)
+	if issued.Before(now.Add(-jwtExpiryTimeout)) {
+		return errStaleToken
+	}
+	if issued.After(now.Add(jwtExpiryTimeout)) {
+		return errFutureToken
+	}
+	if claims.ExpiresAt != nil && !now.Before(time.Unix(*claims.ExpiresAt, 0)) {
+		return errExpiredToken
+	}
+	return nil
+}
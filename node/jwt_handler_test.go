@@ -0,0 +1,150 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package node
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"BRDPoSChain/common"
+	"BRDPoSChain/common/hexutil"
+	"BRDPoSChain/rpc"
+)
+
+var testJWTSecret = common.Hex2Bytes("7365637265747365637265747365637265747365637265747365637265747365")
+
+// makeJWT creates a token with the given header and claims, signed with secret.
+func makeJWT(header, claims string, secret []byte) string {
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyJWT(t *testing.T) {
+	var (
+		now    = time.Unix(1700000000, 0)
+		header = `{"alg":"HS256","typ":"JWT"}`
+		iat    = func(offset time.Duration) string {
+			return fmt.Sprintf(`{"iat":%d}`, now.Add(offset).Unix())
+		}
+	)
+	tests := []struct {
+		token string
+		err   error
+	}{
+		{makeJWT(header, iat(0), testJWTSecret), nil},
+		{makeJWT(header, iat(-59*time.Second), testJWTSecret), nil},
+		{makeJWT(header, iat(59*time.Second), testJWTSecret), nil},
+		{"", errMissingToken},
+		{"abc.def", errMalformedToken},
+		{makeJWT(`{"alg":"none"}`, iat(0), testJWTSecret), errUnsupportedAlg},
+		{makeJWT(header, iat(0), []byte("wrong secret")), errInvalidSignature},
+		{makeJWT(header, `{}`, testJWTSecret), errMissingIssuedAt},
+		{makeJWT(header, iat(-61*time.Second), testJWTSecret), errStaleToken},
+		{makeJWT(header, iat(61*time.Second), testJWTSecret), errFutureToken},
+		{makeJWT(header, fmt.Sprintf(`{"iat":%d,"exp":%d}`, now.Unix(), now.Unix()), testJWTSecret), errExpiredToken},
+	}
+	for i, tt := range tests {
+		if err := verifyJWT(tt.token, testJWTSecret, now); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+// Tests that the authenticated endpoint only serves requests with valid tokens
+// and only exposes the privileged modules.
+func TestAuthEndpoint(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "jwtsecret")
+	if err := os.WriteFile(secretFile, []byte(hexutil.Encode(testJWTSecret)), 0600); err != nil {
+		t.Fatalf("failed to write secret: %v", err)
+	}
+	node, err := New(&Config{JWTSecret: secretFile})
+	if err != nil {
+		t.Fatalf("could not create a new node: %v", err)
+	}
+	apis := []rpc.API{
+		{Namespace: "admin", Version: "1.0", Service: new(testAuthService)},
+		{Namespace: "eth", Version: "1.0", Service: new(testAuthService), Public: true},
+	}
+	if err := node.startAuth("127.0.0.1:0", apis, []string{"localhost"}, rpc.DefaultHTTPTimeouts); err != nil {
+		t.Fatalf("could not start authenticated endpoint: %v", err)
+	}
+	defer node.stopAuth()
+
+	call := func(token, method string) (int, string) {
+		body := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"%s","params":[]}`, method)
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%v/", node.authListenerAddr), strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp := doHTTPRequest(t, req)
+		blob, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(blob)
+	}
+	valid := makeJWT(`{"alg":"HS256"}`, fmt.Sprintf(`{"iat":%d}`, time.Now().Unix()), testJWTSecret)
+
+	if status, _ := call("", "admin_ping"); status != http.StatusUnauthorized {
+		t.Errorf("unauthenticated request: status mismatch: have %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status, _ := call(makeJWT(`{"alg":"HS256"}`, fmt.Sprintf(`{"iat":%d}`, time.Now().Unix()), []byte("wrong")), "admin_ping"); status != http.StatusUnauthorized {
+		t.Errorf("badly signed request: status mismatch: have %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status, body := call(valid, "admin_ping"); status != http.StatusOK || !strings.Contains(body, `"result":"pong"`) {
+		t.Errorf("authenticated request failed: status %d, body %s", status, body)
+	}
+	if _, body := call(valid, "eth_ping"); !strings.Contains(body, "does not exist") {
+		t.Errorf("unprivileged module exposed: %s", body)
+	}
+}
+
+// Tests that a missing JWT secret file is generated and loaded afterwards.
+func TestObtainJWTSecret(t *testing.T) {
+	node, err := New(&Config{})
+	if err != nil {
+		t.Fatalf("could not create a new node: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "jwtsecret")
+	generated, err := node.obtainJWTSecret(path)
+	if err != nil || len(generated) != 32 {
+		t.Fatalf("failed to generate secret: %x, %v", generated, err)
+	}
+	loaded, err := node.obtainJWTSecret(path)
+	if err != nil || string(loaded) != string(generated) {
+		t.Fatalf("loaded secret mismatch: have %x, want %x (%v)", loaded, generated, err)
+	}
+	if err := os.WriteFile(path, []byte("0x1234"), 0600); err != nil {
+		t.Fatalf("failed to overwrite secret: %v", err)
+	}
+	if _, err := node.obtainJWTSecret(path); err == nil {
+		t.Fatalf("short secret accepted")
+	}
+}
+
+type testAuthService struct{}
+
+func (s *testAuthService) Ping() string { return "pong" }
@@ -18,8 +18,10 @@ package node
 
 import (
 	"context"
+	crand "crypto/rand"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"net"
 	"net/http"
 	"os"
@@ -29,6 +31,8 @@ import (
 	"sync"
 
 	"BRDPoSChain/accounts"
+	"BRDPoSChain/common"
+	"BRDPoSChain/common/hexutil"
 	"BRDPoSChain/core/rawdb"
 	"BRDPoSChain/ethdb"
 	"BRDPoSChain/event"
@@ -65,17 +69,23 @@ type Node struct {
 	ipcListener net.Listener // IPC RPC listener socket to serve API requests
 	ipcHandler  *rpc.Server  // IPC RPC request handler to process the API requests
 
-	httpEndpoint     string       // HTTP endpoint (interface + port) to listen at (empty = HTTP disabled)
-	httpWhitelist    []string     // HTTP RPC modules to allow through this endpoint
-	httpListenerAddr net.Addr     // Address of HTTP RPC listener socket serving API requests
-	httpServer       *http.Server // HTTP RPC HTTP server
-	httpHandler      *rpc.Server  // HTTP RPC request handler to process the API requests
+	httpEndpoint     string                  // HTTP endpoint (interface + port) to listen at (empty = HTTP disabled)
+	httpWhitelist    []string                // HTTP RPC modules to allow through this endpoint
+	httpListenerAddr net.Addr                // Address of HTTP RPC listener socket serving API requests
+	httpServer       *http.Server            // HTTP RPC HTTP server
+	httpHandler      *rpc.Server             // HTTP RPC request handler to process the API requests
+	httpHandlers     map[string]namedHandler // Additional handlers served on the HTTP RPC endpoint, keyed by path
 
 	wsEndpoint     string       // WebSocket endpoint (interface + port) to listen at (empty = WebSocket disabled)
 	wsListenerAddr net.Addr     // Address of WebSocket RPC listener socket serving API requests
 	wsHTTPServer   *http.Server // WebSocket RPC HTTP server
 	wsHandler      *rpc.Server  // WebSocket RPC request handler to process the API requests
 
+	authEndpoint     string       // Authenticated RPC endpoint (interface + port) to listen at (empty = disabled)
+	authListenerAddr net.Addr     // Address of authenticated RPC listener socket serving API requests
+	authHTTPServer   *http.Server // Authenticated RPC HTTP server
+	authHandler      *rpc.Server  // Authenticated RPC request handler to process the API requests
+
 	stop chan struct{} // Channel to wait for termination notifications
 	lock sync.RWMutex
 }
@@ -121,6 +131,7 @@ func New(conf *Config) (*Node, error) {
 		ipcEndpoint:  conf.IPCEndpoint(),
 		httpEndpoint: conf.HTTPEndpoint(),
 		wsEndpoint:   conf.WSEndpoint(),
+		authEndpoint: conf.AuthEndpoint(),
 	}
 
 	keyDir, isEphem, err := getKeyStoreDir(conf)
@@ -211,11 +222,13 @@ func (n *Node) Start() error {
 
 	// Otherwise copy and specialize the P2P configuration
 	services := make(map[reflect.Type]Service)
+	handlers := make(map[string]namedHandler)
 	for _, constructor := range n.serviceFuncs {
 		// Create a new context for the particular service
 		ctx := &ServiceContext{
 			config:         n.config,
 			services:       make(map[reflect.Type]Service),
+			handlers:       handlers,
 			EventMux:       n.eventmux,
 			AccountManager: n.accman,
 		}
@@ -256,6 +269,7 @@ func (n *Node) Start() error {
 		started = append(started, kind)
 	}
 	// Lastly, start the configured RPC interfaces
+	n.httpHandlers = handlers
 	if err := n.startRPC(services); err != nil {
 		for _, service := range services {
 			service.Stop()
@@ -322,6 +336,13 @@ func (n *Node) startRPC(services map[reflect.Type]Service) error {
 		}
 	}
 
+	if err := n.startAuth(n.authEndpoint, apis, n.config.AuthVirtualHosts, n.config.HTTPTimeouts); err != nil {
+		n.stopWS()
+		n.stopHTTP()
+		n.stopIPC()
+		n.stopInProc()
+		return err
+	}
 	// All API endpoints started successfully
 	n.rpcAPIs = apis
 	return nil
@@ -397,11 +418,22 @@ func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors
 	}
 	// register apis and create handler stack
 	srv := rpc.NewServer()
+	srv.SetBatchLimits(n.config.BatchRequestLimit, n.config.BatchResponseMaxSize)
 	err := RegisterApisFromWhitelist(apis, modules, srv, false)
 	if err != nil {
 		return err
 	}
-	handler := NewHTTPHandlerStack(srv, cors, vhosts, &timeouts)
+	// mount any additional handlers registered by the services next to the RPC API
+	var mux http.Handler = srv
+	if len(n.httpHandlers) > 0 {
+		paths := http.NewServeMux()
+		paths.Handle("/", srv)
+		for path, h := range n.httpHandlers {
+			paths.Handle(path, h.handler)
+		}
+		mux = paths
+	}
+	handler := NewHTTPHandlerStack(mux, cors, vhosts, &timeouts)
 	// wrap handler in WebSocket handler only if WebSocket port is the same as http rpc
 	if n.httpEndpoint == n.wsEndpoint {
 		handler = NewWebsocketUpgradeHandler(handler, srv.WebsocketHandler(wsOrigins))
@@ -416,6 +448,9 @@ func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors
 	if n.httpEndpoint == n.wsEndpoint {
 		n.log.Info("WebSocket endpoint opened", "url", fmt.Sprintf("ws://%v", addr))
 	}
+	for path, h := range n.httpHandlers {
+		n.log.Info(fmt.Sprintf("%s enabled", h.name), "url", fmt.Sprintf("http://%v%s", addr, path))
+	}
 	// All listeners booted successfully
 	n.httpEndpoint = endpoint
 	n.httpListenerAddr = addr
@@ -446,6 +481,7 @@ func (n *Node) startWS(endpoint string, apis []rpc.API, modules []string, wsOrig
 	}
 
 	srv := rpc.NewServer()
+	srv.SetBatchLimits(n.config.BatchRequestLimit, n.config.BatchResponseMaxSize)
 	handler := srv.WebsocketHandler(wsOrigins)
 	err := RegisterApisFromWhitelist(apis, modules, srv, exposeAll)
 	if err != nil {
@@ -478,6 +514,90 @@ func (n *Node) stopWS() {
 	}
 }
 
+// authModules are the privileged API modules served on the authenticated endpoint.
+var authModules = []string{"admin", "debug", "personal"}
+
+// startAuth initializes and starts the authenticated RPC endpoint, serving the
+// privileged API modules over HTTP and WebSocket to JWT authenticated clients.
+func (n *Node) startAuth(endpoint string, apis []rpc.API, vhosts []string, timeouts rpc.HTTPTimeouts) error {
+	// Short circuit if the authenticated endpoint isn't being exposed
+	if endpoint == "" {
+		return nil
+	}
+	secret, err := n.obtainJWTSecret(n.config.JWTSecret)
+	if err != nil {
+		return err
+	}
+	srv := rpc.NewServer()
+	srv.SetBatchLimits(n.config.BatchRequestLimit, n.config.BatchResponseMaxSize)
+	if err := RegisterApisFromWhitelist(apis, authModules, srv, false); err != nil {
+		return err
+	}
+	handler := NewWebsocketUpgradeHandler(NewHTTPHandlerStack(srv, nil, vhosts, &timeouts), srv.WebsocketHandler([]string{"*"}))
+	handler = newJWTHandler(secret, handler)
+
+	httpServer, addr, err := StartHTTPEndpoint(endpoint, timeouts, handler)
+	if err != nil {
+		return err
+	}
+	n.log.Info("Authenticated RPC endpoint opened", "http", fmt.Sprintf("http://%v/", addr), "ws", fmt.Sprintf("ws://%v", addr),
+		"vhosts", strings.Join(vhosts, ","), "modules", strings.Join(authModules, ","))
+
+	// All listeners booted successfully
+	n.authEndpoint = endpoint
+	n.authListenerAddr = addr
+	n.authHTTPServer = httpServer
+	n.authHandler = srv
+
+	return nil
+}
+
+// stopAuth terminates the authenticated RPC endpoint.
+func (n *Node) stopAuth() {
+	if n.authHTTPServer != nil {
+		// Don't bother imposing a timeout here.
+		n.authHTTPServer.Shutdown(context.Background())
+		n.log.Info("Authenticated RPC endpoint closed", "url", fmt.Sprintf("http://%v/", n.authListenerAddr))
+		n.authHTTPServer = nil
+	}
+	if n.authHandler != nil {
+		n.authHandler.Stop()
+		n.authHandler = nil
+	}
+}
+
+// obtainJWTSecret loads the JWT secret from the given file, or generates a new
+// one into it if the file does not exist yet. An empty path defaults to a file
+// in the datadir, or to an ephemeral secret if there is no datadir.
+func (n *Node) obtainJWTSecret(path string) ([]byte, error) {
+	if path == "" {
+		path = n.ResolvePath(datadirJWTKey)
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		secret := common.FromHex(strings.TrimSpace(string(data)))
+		if len(secret) != 32 {
+			n.log.Error("Invalid JWT secret", "path", path, "length", len(secret))
+			return nil, errors.New("invalid JWT secret")
+		}
+		n.log.Info("Loaded JWT secret file", "path", path, "crc32", fmt.Sprintf("%#x", crc32.ChecksumIEEE(secret)))
+		return secret, nil
+	}
+	// No secret available yet, generate a new one
+	secret := make([]byte, 32)
+	if _, err := crand.Read(secret); err != nil {
+		return nil, err
+	}
+	if path == "" {
+		n.log.Info("Generated ephemeral JWT secret", "secret", hexutil.Encode(secret))
+		return secret, nil
+	}
+	if err := os.WriteFile(path, []byte(hexutil.Encode(secret)), 0600); err != nil {
+		return nil, err
+	}
+	n.log.Info("Generated JWT secret", "path", path)
+	return secret, nil
+}
+
 // Stop terminates a running node along with all it's services. In the node was
 // not started, an error is returned.
 func (n *Node) Stop() error {
@@ -490,6 +610,7 @@ func (n *Node) Stop() error {
 	}
 
 	// Terminate the API, services and the p2p server.
+	n.stopAuth()
 	n.stopWS()
 	n.stopHTTP()
 	n.stopIPC()
@@ -674,7 +795,27 @@ func (n *Node) OpenDatabase(name string, cache, handles int, namespace string, r
 	if n.config.DataDir == "" {
 		return rawdb.NewMemoryDatabase(), nil
 	}
-	return rawdb.NewLevelDBDatabase(n.config.ResolvePath(name), cache, handles, namespace, readonly)
+	return rawdb.NewEngineDatabase(n.config.DBEngine, n.config.ResolvePath(name), cache, handles, namespace, readonly)
+}
+
+// OpenDatabaseWithFreezer opens an existing database with the given name (or
+// creates one if no previous can be found) from within the node's data directory,
+// also attaching a chain freezer to it that moves ancient chain data from the
+// database to immutable append-only files. If the node is an ephemeral one, a
+// memory database is returned.
+func (n *Node) OpenDatabaseWithFreezer(name string, cache, handles int, freezer, namespace string, readonly bool) (ethdb.Database, error) {
+	if n.config.DataDir == "" {
+		return rawdb.NewMemoryDatabase(), nil
+	}
+	root := n.config.ResolvePath(name)
+
+	switch {
+	case freezer == "":
+		freezer = filepath.Join(root, "ancient")
+	case !filepath.IsAbs(freezer):
+		freezer = n.config.ResolvePath(freezer)
+	}
+	return rawdb.NewEngineDatabaseWithFreezer(n.config.DBEngine, root, cache, handles, freezer, namespace, readonly)
 }
 
 // ResolvePath returns the absolute path of a resource in the instance directory.
@@ -18,6 +18,8 @@ package node
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"reflect"
 	"testing"
@@ -594,6 +596,54 @@ func TestAPIGather(t *testing.T) {
 	}
 }
 
+// Tests that handlers registered by services are served on the HTTP RPC
+// endpoint and that a path can only be registered once.
+func TestServiceHandlers(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "handled")
+	})
+	register := func(ctx *ServiceContext) (Service, error) {
+		if err := ctx.RegisterHandler("Test", "/test", handler); err != nil {
+			return nil, err
+		}
+		return new(NoopService), nil
+	}
+	conf := testNodeConfig()
+	conf.HTTPHost = "127.0.0.1"
+
+	// Registering the same path twice must abort the startup
+	stack, err := New(conf)
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	stack.Register(register)
+	stack.Register(func(ctx *ServiceContext) (Service, error) {
+		if err := ctx.RegisterHandler("Test", "/test", handler); err != nil {
+			return nil, err
+		}
+		return new(NoopServiceA), nil
+	})
+	if err := stack.Start(); err == nil {
+		stack.Stop()
+		t.Fatalf("duplicate handler path accepted")
+	}
+	// A single registration is served next to the RPC API
+	stack, err = New(conf)
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	stack.Register(register)
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start protocol stack: %v", err)
+	}
+	defer stack.Stop()
+
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s/test", stack.HTTPEndpoint()), nil)
+	if blob, _ := io.ReadAll(doHTTPRequest(t, req).Body); string(blob) != "handled" {
+		t.Fatalf("handler response mismatch: have %q, want %q", blob, "handled")
+	}
+}
+
 func TestWebsocketHTTPOnSamePort_WebsocketRequest(t *testing.T) {
 	node := startHTTP(t)
 	defer node.stopHTTP()
@@ -17,6 +17,9 @@
 package node
 
 import (
+	"fmt"
+	"net/http"
+	"path/filepath"
 	"reflect"
 
 	"BRDPoSChain/accounts"
@@ -33,6 +36,7 @@ import (
 type ServiceContext struct {
 	config         *Config
 	services       map[reflect.Type]Service // Index of the already constructed services
+	handlers       map[string]namedHandler  // Additional HTTP handlers registered by the services
 	EventMux       *event.TypeMux           // Event multiplexer used for decoupled notifications
 	AccountManager *accounts.Manager        // Account manager created by the node.
 }
@@ -44,13 +48,33 @@ func (ctx *ServiceContext) OpenDatabase(name string, cache int, handles int, nam
 	if ctx.config.DataDir == "" {
 		return rawdb.NewMemoryDatabase(), nil
 	}
-	db, err := rawdb.NewLevelDBDatabase(ctx.config.ResolvePath(name), cache, handles, namespace, readonly)
+	db, err := rawdb.NewEngineDatabase(ctx.config.DBEngine, ctx.config.ResolvePath(name), cache, handles, namespace, readonly)
 	if err != nil {
 		return nil, err
 	}
 	return db, nil
 }
 
+// OpenDatabaseWithFreezer opens an existing database with the given name (or
+// creates one if no previous can be found) from within the node's data directory,
+// also attaching a chain freezer to it that moves ancient chain data from the
+// database to immutable append-only files. If the node is an ephemeral one, a
+// memory database is returned.
+func (ctx *ServiceContext) OpenDatabaseWithFreezer(name string, cache int, handles int, freezer string, namespace string, readonly bool) (ethdb.Database, error) {
+	if ctx.config.DataDir == "" {
+		return rawdb.NewMemoryDatabase(), nil
+	}
+	root := ctx.config.ResolvePath(name)
+
+	switch {
+	case freezer == "":
+		freezer = filepath.Join(root, "ancient")
+	case !filepath.IsAbs(freezer):
+		freezer = ctx.config.ResolvePath(freezer)
+	}
+	return rawdb.NewEngineDatabaseWithFreezer(ctx.config.DBEngine, root, cache, handles, freezer, namespace, readonly)
+}
+
 // ResolvePath resolves a user path into the data directory if that was relative
 // and if the user actually uses persistent storage. It will return an empty string
 // for emphemeral storage and the user's own input for absolute paths.
@@ -68,6 +92,23 @@ func (ctx *ServiceContext) Service(service interface{}) error {
 	return ErrServiceUnknown
 }
 
+// RegisterHandler mounts a handler on the given path of the HTTP RPC endpoint,
+// next to the JSON-RPC API. The handler is only served if HTTP RPC is enabled.
+func (ctx *ServiceContext) RegisterHandler(name, path string, handler http.Handler) error {
+	if _, exists := ctx.handlers[path]; exists {
+		return fmt.Errorf("duplicate HTTP handler for path %q", path)
+	}
+	ctx.handlers[path] = namedHandler{name: name, handler: handler}
+	return nil
+}
+
+// namedHandler is an HTTP handler registered by a service along with the name
+// it is reported under.
+type namedHandler struct {
+	name    string
+	handler http.Handler
+}
+
 // Get current node config.
 func (ctx *ServiceContext) GetConfig() *Config {
 	return ctx.config
@@ -444,6 +444,11 @@ type V2Config struct {
 	CertThreshold        float64 `json:"certificateThreshold"` // Necessary number of messages from master nodes to form a certificate
 
 	ExpTimeoutConfig ExpTimeoutConfig `json:"expTimeoutConfig"`
+
+	// Leader schedule, in effect from SwitchRound. Stake weighting reads the stakes recorded in the
+	// epoch snapshots, so nodes shall be upgraded at least an epoch before it's switched on.
+	OfflineLeaderWindow int  `json:"offlineLeaderWindow,omitempty"` // Number of recent blocks in which leaders of timed out rounds are skipped, 0 to disable
+	StakeWeightedLeader bool `json:"stakeWeightedLeader,omitempty"` // Weight leader slots by masternode stake
 }
 
 type ExpTimeoutConfig struct {
@@ -499,7 +504,9 @@ func (c *V2Config) Description(name string, indent int) string {
 	banner += fmt.Sprintf("%s- MinePeriod: %v\n", prefix, c.MinePeriod)
 	banner += fmt.Sprintf("%s- TimeoutSyncThreshold: %v\n", prefix, c.TimeoutSyncThreshold)
 	banner += fmt.Sprintf("%s- TimeoutPeriod: %v\n", prefix, c.TimeoutPeriod)
-	banner += fmt.Sprintf("%s- CertThreshold: %v", prefix, c.CertThreshold)
+	banner += fmt.Sprintf("%s- CertThreshold: %v\n", prefix, c.CertThreshold)
+	banner += fmt.Sprintf("%s- OfflineLeaderWindow: %v\n", prefix, c.OfflineLeaderWindow)
+	banner += fmt.Sprintf("%s- StakeWeightedLeader: %v", prefix, c.StakeWeightedLeader)
 	return banner
 }
 
@@ -739,6 +746,27 @@ func (c *ChainConfig) IsTIPBRCXCancellationFee(num *big.Int) bool {
 	return isForked(common.TIPBRCXCancellationFee, num)
 }
 
+// IsTIPBRCXOrderTypes enables post-only, IOC, FOK and stop-limit orders in the BRCx matching engine
+func (c *ChainConfig) IsTIPBRCXOrderTypes(num *big.Int) bool {
+	return isForked(common.TIPBRCXOrderTypes, num)
+}
+
+// IsTIPBRCXPartialLiquidation liquidates only the collateral needed to restore the deposit rate of a lending trade
+func (c *ChainConfig) IsTIPBRCXPartialLiquidation(num *big.Int) bool {
+	return isForked(common.TIPBRCXPartialLiquidation, num)
+}
+
+// IsTIPSlashing accepts vote equivocation proofs sent to the slashing address and penalizes the offender
+func (c *ChainConfig) IsTIPSlashing(num *big.Int) bool {
+	return isForked(common.TIPSlashing, num)
+}
+
+// IsTIPBLS accepts BLS public key registrations of masternodes and switches the v2 votes, timeouts and
+// certificates of the epochs gathered at or after the fork to BLS aggregate signatures
+func (c *ChainConfig) IsTIPBLS(num *big.Int) bool {
+	return isForked(common.TIPBLS, num)
+}
+
 // GasTable returns the gas table corresponding to the current phase (homestead or homestead reprice).
 //
 // The returned GasTable's fields shouldn't, under any circumstances, be changed.
@@ -24,3 +24,9 @@ const (
 	// contains.
 	BloomBitsBlocks uint64 = 4096
 )
+
+// ImmutabilityThreshold is the number of blocks after which a chain segment is
+// considered immutable (i.e. soft finality). It is used by the chain freezer to
+// decide which blocks can be moved out of the key-value store into the ancient
+// flat files.
+const ImmutabilityThreshold = 90000
@@ -46,6 +46,9 @@ type Server struct {
 	idgen    func() ID
 	run      int32
 	codecs   mapset.Set[*ServerCodec]
+
+	batchRequestLimit    int
+	batchResponseMaxSize int
 }
 
 // NewServer creates a new server instance with no registered handlers.
@@ -58,6 +61,19 @@ func NewServer() *Server {
 	return server
 }
 
+// SetBatchLimits sets limits applied to batch requests. There are two limits: the
+// maximum number of calls in a single batch and the maximum accumulated size of
+// the results. Batches exceeding the first limit are rejected as a whole, the
+// calls remaining once the second limit is exceeded fail with an error. A value
+// of zero disables the respective limit.
+//
+// This method should be called before processing any requests via ServeCodec,
+// ServeHTTP, ServeListener etc.
+func (s *Server) SetBatchLimits(requestLimit, responseMaxSize int) {
+	s.batchRequestLimit = requestLimit
+	s.batchResponseMaxSize = responseMaxSize
+}
+
 // RegisterName creates a service for the given receiver type under the given name. When no
 // methods on the given receiver match the criteria to be either a RPC method or a
 // subscription an error is returned. Otherwise a new service is created and added to the
@@ -83,7 +99,7 @@ func (s *Server) ServeCodec(codec ServerCodec, options CodecOption) {
 	s.codecs.Add(&codec)
 	defer s.codecs.Remove(&codec)
 
-	c := initClient(codec, s.idgen, &s.services)
+	c := initClient(codec, s.idgen, &s.services, s.batchRequestLimit, s.batchResponseMaxSize)
 	<-codec.closed()
 	c.Close()
 }
@@ -97,7 +113,7 @@ func (s *Server) serveSingleRequest(ctx context.Context, codec ServerCodec) {
 		return
 	}
 
-	h := newHandler(ctx, codec, s.idgen, &s.services)
+	h := newHandler(ctx, codec, s.idgen, &s.services, s.batchRequestLimit, s.batchResponseMaxSize)
 	h.allowSubscribe = false
 	defer h.close(io.EOF, nil)
 
@@ -19,8 +19,12 @@ package rpc
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
@@ -150,3 +154,50 @@ func TestServerShortLivedConn(t *testing.T) {
 		}
 	}
 }
+
+func TestServerBatchLimits(t *testing.T) {
+	server := newTestServer()
+	server.SetBatchLimits(3, 100)
+	defer server.Stop()
+
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	call := func(body string) []jsonrpcMessage {
+		resp, err := http.Post(ts.URL, contentType, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var msgs []jsonrpcMessage
+		if err := json.NewDecoder(resp.Body).Decode(&msgs); err != nil {
+			t.Fatalf("invalid response: %v", err)
+		}
+		return msgs
+	}
+	echo := func(id int) string {
+		return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"test_echo","params":["xxxxxxxxxxxxxxxxxxxx",%d]}`, id, id)
+	}
+	// Batches within the limits are served in full
+	msgs := call("[" + echo(1) + "," + echo(2) + "]")
+	if len(msgs) != 2 || msgs[0].Error != nil || msgs[1].Error != nil {
+		t.Fatalf("unexpected response to small batch: %+v", msgs)
+	}
+	// Batches with too many calls are rejected as a whole
+	msgs = call("[" + echo(1) + "," + echo(2) + "," + echo(3) + "," + echo(4) + "]")
+	if len(msgs) != 1 || string(msgs[0].ID) != "1" || msgs[0].Error == nil || msgs[0].Error.Code != -32600 || msgs[0].Error.Message != errMsgBatchTooLarge {
+		t.Fatalf("unexpected response to large batch: %+v", msgs)
+	}
+	// Calls beyond the response size limit fail
+	msgs = call("[" + echo(1) + "," + echo(2) + "," + echo(3) + "]")
+	if len(msgs) != 3 {
+		t.Fatalf("response count mismatch: have %d, want 3", len(msgs))
+	}
+	if msgs[0].Error != nil || msgs[1].Error != nil {
+		t.Fatalf("calls within the size limit failed: %+v", msgs)
+	}
+	if msgs[2].Error == nil || msgs[2].Error.Code != errcodeResponseTooLarge || string(msgs[2].ID) != "3" {
+		t.Fatalf("call beyond the size limit not rejected: %+v", msgs[2])
+	}
+}
@@ -72,6 +72,7 @@ type BlockNumber int64
 type EpochNumber int64
 
 const (
+	SafeBlockNumber      = BlockNumber(-4)
 	CommittedBlockNumber = BlockNumber(-3)
 	PendingBlockNumber   = BlockNumber(-2)
 	LatestBlockNumber    = BlockNumber(-1)
@@ -80,7 +81,8 @@ const (
 )
 
 // UnmarshalJSON parses the given JSON fragment into a BlockNumber. It supports:
-// - "latest", "earliest", "pending" and "committed" as string arguments
+// - "latest", "earliest", "pending", "committed" and "safe" as string arguments
+// - "finalized" as an alias of "committed"
 // - the block number
 // Returned errors:
 // - an invalid block number error when the given argument isn't a known strings
@@ -101,9 +103,12 @@ func (bn *BlockNumber) UnmarshalJSON(data []byte) error {
 	case "pending":
 		*bn = PendingBlockNumber
 		return nil
-	case "committed":
+	case "committed", "finalized":
 		*bn = CommittedBlockNumber
 		return nil
+	case "safe":
+		*bn = SafeBlockNumber
+		return nil
 	}
 
 	blckNum, err := hexutil.DecodeUint64(input)
@@ -181,10 +186,14 @@ func (bnh *BlockNumberOrHash) UnmarshalJSON(data []byte) error {
 		bn := PendingBlockNumber
 		bnh.BlockNumber = &bn
 		return nil
-	case "committed":
+	case "committed", "finalized":
 		bn := CommittedBlockNumber
 		bnh.BlockNumber = &bn
 		return nil
+	case "safe":
+		bn := SafeBlockNumber
+		bnh.BlockNumber = &bn
+		return nil
 	default:
 		if len(input) == 66 {
 			hash := common.Hash{}
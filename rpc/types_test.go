@@ -47,6 +47,9 @@ func TestBlockNumberJSONUnmarshal(t *testing.T) {
 		14: {`someString`, true, BlockNumber(0)},
 		15: {`""`, true, BlockNumber(0)},
 		16: {``, true, BlockNumber(0)},
+		17: {`"committed"`, false, CommittedBlockNumber},
+		18: {`"finalized"`, false, CommittedBlockNumber},
+		19: {`"safe"`, false, SafeBlockNumber},
 	}
 
 	for i, test := range tests {
@@ -98,6 +101,11 @@ func TestBlockNumberOrHash_UnmarshalJSON(t *testing.T) {
 		23: {`{"blockNumber":"latest"}`, false, BlockNumberOrHashWithNumber(LatestBlockNumber)},
 		24: {`{"blockNumber":"earliest"}`, false, BlockNumberOrHashWithNumber(EarliestBlockNumber)},
 		25: {`{"blockNumber":"0x1", "blockHash":"0x0000000000000000000000000000000000000000000000000000000000000000"}`, true, BlockNumberOrHash{}},
+		26: {`"committed"`, false, BlockNumberOrHashWithNumber(CommittedBlockNumber)},
+		27: {`"finalized"`, false, BlockNumberOrHashWithNumber(CommittedBlockNumber)},
+		28: {`"safe"`, false, BlockNumberOrHashWithNumber(SafeBlockNumber)},
+		29: {`{"blockNumber":"finalized"}`, false, BlockNumberOrHashWithNumber(CommittedBlockNumber)},
+		30: {`{"blockNumber":"safe"}`, false, BlockNumberOrHashWithNumber(SafeBlockNumber)},
 	}
 
 	for i, test := range tests {
@@ -113,6 +113,12 @@ func MustDecodeNode(hash, buf []byte) Node {
 	return n
 }
 
+// IsNode reports whether the blob is a valid RLP encoding of a trie Node.
+func IsNode(buf []byte) bool {
+	_, err := decodeNode(nil, buf)
+	return err == nil
+}
+
 // decodeNode parses the RLP encoding of a trie Node.
 func decodeNode(hash, buf []byte) (Node, error) {
 	if len(buf) == 0 {
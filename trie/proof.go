@@ -28,6 +28,18 @@ import (
 	"BRDPoSChain/rlp"
 )
 
+// ProofList collects the nodes of a merkle proof in the order Prove writes them.
+type ProofList [][]byte
+
+func (n *ProofList) Put(key []byte, value []byte) error {
+	*n = append(*n, value)
+	return nil
+}
+
+func (n *ProofList) Delete(key []byte) error {
+	panic("not supported")
+}
+
 // Prove constructs a merkle proof for key. The result contains all encoded nodes
 // on the path to the value at key. The value itself is also included in the last
 // Node and can be retrieved by verifying the proof.
@@ -404,16 +416,24 @@ func hasRightElement(node Node, key []byte) bool {
 // Except returning the error to indicate the proof is valid or not, the function will
 // also return a flag to indicate whether there exists more accounts/slots in the trie.
 func VerifyRangeProof(rootHash common.Hash, firstKey []byte, keys [][]byte, values [][]byte, firstProof ethdb.KeyValueReader, lastProof ethdb.KeyValueReader) (error, bool) {
+	_, more, err := verifyRangeProof(rootHash, firstKey, keys, values, firstProof, lastProof)
+	return err, more
+}
+
+// verifyRangeProof is the internal version of VerifyRangeProof which also returns
+// the trie rebuilt from the proofs and the leaves. The returned trie is nil if
+// the range consists of a single proven element.
+func verifyRangeProof(rootHash common.Hash, firstKey []byte, keys [][]byte, values [][]byte, firstProof ethdb.KeyValueReader, lastProof ethdb.KeyValueReader) (*Trie, bool, error) {
 	if len(keys) != len(values) {
-		return fmt.Errorf("inconsistent proof data, keys: %d, values: %d", len(keys), len(values)), false
+		return nil, false, fmt.Errorf("inconsistent proof data, keys: %d, values: %d", len(keys), len(values))
 	}
 	if len(keys) == 0 {
-		return errors.New("empty proof"), false
+		return nil, false, errors.New("empty proof")
 	}
 	// Ensure the received batch is monotonic increasing.
 	for i := 0; i < len(keys)-1; i++ {
 		if bytes.Compare(keys[i], keys[i+1]) >= 0 {
-			return errors.New("range is not monotonically increasing"), false
+			return nil, false, errors.New("range is not monotonically increasing")
 		}
 	}
 	// Special case, there is no edge proof at all. The given range is expected
@@ -421,46 +441,46 @@ func VerifyRangeProof(rootHash common.Hash, firstKey []byte, keys [][]byte, valu
 	if firstProof == nil && lastProof == nil {
 		emptytrie, err := New(emptyRoot, NewDatabase(memorydb.New()))
 		if err != nil {
-			return err, false
+			return nil, false, err
 		}
 		for index, key := range keys {
 			emptytrie.TryUpdate(key, values[index])
 		}
 		if emptytrie.Hash() != rootHash {
-			return fmt.Errorf("invalid proof, want hash %x, got %x", rootHash, emptytrie.Hash()), false
+			return nil, false, fmt.Errorf("invalid proof, want hash %x, got %x", rootHash, emptytrie.Hash())
 		}
-		return nil, false // no more element.
+		return emptytrie, false, nil // no more element.
 	}
 	// Special case, there is only one element and left edge
 	// proof is an existent one.
 	if len(keys) == 1 && bytes.Equal(keys[0], firstKey) {
 		root, val, err := proofToPath(rootHash, nil, firstKey, firstProof, false)
 		if err != nil {
-			return err, false
+			return nil, false, err
 		}
 		if !bytes.Equal(val, values[0]) {
-			return errors.New("correct proof but invalid data"), false
+			return nil, false, errors.New("correct proof but invalid data")
 		}
-		return nil, hasRightElement(root, keys[0])
+		return nil, hasRightElement(root, keys[0]), nil
 	}
 	// Convert the edge proofs to edge trie paths. Then we can
 	// have the same tree architecture with the original one.
 	// For the first edge proof, non-existent proof is allowed.
 	root, _, err := proofToPath(rootHash, nil, firstKey, firstProof, true)
 	if err != nil {
-		return err, false
+		return nil, false, err
 	}
 	// Pass the root Node here, the second path will be merged
 	// with the first one. For the last edge proof, non-existent
 	// proof is not allowed.
 	root, _, err = proofToPath(rootHash, root, keys[len(keys)-1], lastProof, false)
 	if err != nil {
-		return err, false
+		return nil, false, err
 	}
 	// Remove all internal references. All the removed parts should
 	// be re-filled(or re-constructed) by the given leaves range.
 	if err := unsetInternal(root, firstKey, keys[len(keys)-1]); err != nil {
-		return err, false
+		return nil, false, err
 	}
 	// Rebuild the trie with the leave stream, the shape of trie
 	// should be same with the original one.
@@ -469,9 +489,98 @@ func VerifyRangeProof(rootHash common.Hash, firstKey []byte, keys [][]byte, valu
 		newtrie.TryUpdate(key, values[index])
 	}
 	if newtrie.Hash() != rootHash {
-		return fmt.Errorf("invalid proof, want hash %x, got %x", rootHash, newtrie.Hash()), false
+		return nil, false, fmt.Errorf("invalid proof, want hash %x, got %x", rootHash, newtrie.Hash())
+	}
+	return newtrie, hasRightElement(root, keys[len(keys)-1]), nil
+}
+
+// CommitRangeProof verifies a range of leaves against the given root the same way
+// as VerifyRangeProof does (with both edge proofs merged into a single proof set,
+// or a nil proof for a complete leaf-set), and writes the trie nodes rebuilt from
+// the range into the given writer.
+//
+// Only nodes whose whole subtrie is covered by the range are written. The nodes
+// along the edge paths and along the paths to any of the skip keys are left out,
+// so that the presence of a node in the database keeps implying the presence of
+// all its children. The missing nodes need to be healed afterwards.
+//
+// Contrary to VerifyRangeProof, an empty range is accepted if the proof shows
+// that there are no leaves at or after firstKey.
+//
+// If w is nil, the range is only verified.
+func CommitRangeProof(rootHash common.Hash, firstKey []byte, keys [][]byte, values [][]byte, proof ethdb.KeyValueReader, skip [][]byte, w ethdb.KeyValueWriter) (bool, error) {
+	if len(keys) == 0 {
+		if proof == nil {
+			return false, errors.New("empty range without proof")
+		}
+		root, _, err := proofToPath(rootHash, nil, firstKey, proof, true)
+		if err != nil {
+			return false, err
+		}
+		if hasRightElement(root, firstKey) {
+			return false, errors.New("more entries available")
+		}
+		return false, nil
+	}
+	tr, more, err := verifyRangeProof(rootHash, firstKey, keys, values, proof, proof)
+	if err != nil || tr == nil || w == nil {
+		return more, err
+	}
+	// Gather the nodes whose subtries are not complete locally
+	excluded := make(map[common.Hash]struct{})
+	if proof != nil {
+		skip = append([][]byte{firstKey, keys[len(keys)-1]}, skip...)
+	}
+	for _, key := range skip {
+		pathHashes(tr.root, keybytesToHex(key), excluded)
+	}
+	// Flush the rebuilt trie into a scratch database and copy the complete nodes
+	scratch := memorydb.New()
+	tr.Db = NewDatabase(scratch)
+
+	root, err := tr.Commit(nil)
+	if err != nil {
+		return more, err
+	}
+	if err := tr.Db.Commit(root, false); err != nil {
+		return more, err
+	}
+	it := scratch.NewIterator(nil, nil)
+	defer it.Release()
+
+	for it.Next() {
+		if _, ok := excluded[common.BytesToHash(it.Key())]; ok {
+			continue
+		}
+		if err := w.Put(it.Key(), it.Value()); err != nil {
+			return more, err
+		}
+	}
+	return more, it.Error()
+}
+
+// pathHashes collects the hashes of all the hashed nodes along the given path of
+// a fully hashed, in-memory trie.
+func pathHashes(n Node, key []byte, hashes map[common.Hash]struct{}) {
+	for n != nil {
+		if hash, _ := n.Cache(); hash != nil {
+			hashes[common.BytesToHash(hash)] = struct{}{}
+		}
+		switch rn := n.(type) {
+		case *ShortNode:
+			if len(key) < len(rn.Key) || !bytes.Equal(rn.Key, key[:len(rn.Key)]) {
+				return
+			}
+			n, key = rn.Val, key[len(rn.Key):]
+		case *FullNode:
+			if len(key) == 0 {
+				return
+			}
+			n, key = rn.Children[key[0]], key[1:]
+		default:
+			return
+		}
 	}
-	return nil, hasRightElement(root, keys[len(keys)-1])
 }
 
 // get returns the child of the given Node. Return nil if the
@@ -18,6 +18,7 @@ package trie
 
 import (
 	"bytes"
+	"sort"
 	"testing"
 
 	"BRDPoSChain/common"
@@ -368,3 +369,85 @@ func TestIncompleteSync(t *testing.T) {
 		diskdb.Put(key, value)
 	}
 }
+
+// Tests that a trie can be reconstructed from consecutive proven leaf ranges and
+// that only the nodes along the range edges need to be healed afterwards.
+func TestRangeCommitHealSync(t *testing.T) {
+	// Create a random trie to copy and split its leaves into proven ranges
+	srcDb, srcTrie, srcData := makeTestTrie()
+
+	keys := make([][]byte, 0, len(srcData))
+	for key := range srcData {
+		keys = append(keys, []byte(key))
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+
+	diskdb := memorydb.New()
+	for start := 0; start < len(keys); start += 300 {
+		end := start + 300
+		if end > len(keys) {
+			end = len(keys)
+		}
+		proof := memorydb.New()
+		if err := srcTrie.Prove(keys[start], 0, proof); err != nil {
+			t.Fatalf("failed to prove first key: %v", err)
+		}
+		if err := srcTrie.Prove(keys[end-1], 0, proof); err != nil {
+			t.Fatalf("failed to prove last key: %v", err)
+		}
+		vals := make([][]byte, 0, end-start)
+		for _, key := range keys[start:end] {
+			vals = append(vals, srcData[string(key)])
+		}
+		more, err := CommitRangeProof(srcTrie.Hash(), keys[start], keys[start:end], vals, proof, nil, diskdb)
+		if err != nil {
+			t.Fatalf("range %d-%d: failed to commit: %v", start, end, err)
+		}
+		if more != (end < len(keys)) {
+			t.Fatalf("range %d-%d: continuation flag mismatch: have %v, want %v", start, end, more, end < len(keys))
+		}
+	}
+	// Ensure every written node roots a complete subtrie, but the root is missing
+	triedb := NewDatabase(diskdb)
+	if ok, _ := diskdb.Has(srcTrie.Hash().Bytes()); ok {
+		t.Fatalf("edge node root written")
+	}
+	it := diskdb.NewIterator(nil, nil)
+	for it.Next() {
+		if err := checkTrieConsistency(triedb, common.BytesToHash(it.Key())); err != nil {
+			t.Fatalf("incomplete subtrie %x written: %v", it.Key(), err)
+		}
+	}
+	it.Release()
+
+	// Heal the missing edges and cross check the two tries
+	sched := NewSync(srcTrie.Hash(), diskdb, nil, NewSyncBloom(1, diskdb))
+
+	healed := 0
+	queue := append([]common.Hash{}, sched.Missing(100)...)
+	for len(queue) > 0 {
+		results := make([]SyncResult, len(queue))
+		for i, hash := range queue {
+			data, err := srcDb.Node(hash)
+			if err != nil {
+				t.Fatalf("failed to retrieve Node data for %x: %v", hash, err)
+			}
+			results[i] = SyncResult{hash, data}
+		}
+		if _, index, err := sched.Process(results); err != nil {
+			t.Fatalf("failed to process result #%d: %v", index, err)
+		}
+		batch := diskdb.NewBatch()
+		if err := sched.Commit(batch); err != nil {
+			t.Fatalf("failed to commit data: %v", err)
+		}
+		batch.Write()
+
+		healed += len(queue)
+		queue = append(queue[:0], sched.Missing(100)...)
+	}
+	if total := len(srcDb.Nodes()); healed >= total/2 {
+		t.Errorf("healed too many nodes: have %d, total %d", healed, total)
+	}
+	checkTrieContents(t, triedb, srcTrie.Hash().Bytes(), srcData)
+}